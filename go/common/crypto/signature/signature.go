@@ -57,6 +57,8 @@ var (
 
 	errKeyMismatch = errors.New("signature: public key PEM is not for private key")
 
+	_ error = (*ContextMismatchError)(nil)
+
 	_ encoding.BinaryMarshaler   = PublicKey{}
 	_ encoding.BinaryUnmarshaler = (*PublicKey)(nil)
 	_ encoding.BinaryMarshaler   = RawSignature{}
@@ -81,6 +83,26 @@ var (
 	)
 )
 
+// ContextMismatchError is the error returned when a signature is not valid under the expected
+// signature context, but is valid under another known context. This usually means that the
+// signer used the wrong signing tooling. The signature is still rejected.
+type ContextMismatchError struct {
+	// Expected is the expected signature context.
+	Expected Context
+	// Actual is the signature context the signature is valid under.
+	Actual Context
+}
+
+// Error returns a string representation of the error.
+func (e *ContextMismatchError) Error() string {
+	return fmt.Sprintf("%s: signed under context '%s' but expected '%s'", ErrVerifyFailed, e.Actual, e.Expected)
+}
+
+// Unwrap returns ErrVerifyFailed, so the error can be handled as any other verification failure.
+func (e *ContextMismatchError) Unwrap() error {
+	return ErrVerifyFailed
+}
+
 // PublicKey is a public key used for signing.
 type PublicKey [PublicKeySize]byte
 
@@ -348,6 +370,28 @@ func (s *Signature) Verify(context Context, message []byte) bool {
 	return s.PublicKey.Verify(context, message, s.Signature[:])
 }
 
+// DiagnoseContext diagnoses a signature over the given message which failed verification under
+// the expected context. It returns a *ContextMismatchError in case the signature is valid under
+// one of the candidate contexts and ErrVerifyFailed otherwise.
+//
+// The signature is verified under all candidate contexts, so that the time taken does not depend
+// on which of them (if any) the signature is valid under.
+func (s *Signature) DiagnoseContext(expected Context, candidates []Context, message []byte) error {
+	var actual *Context
+	for i := range candidates {
+		if candidates[i] == expected {
+			continue
+		}
+		if s.Verify(candidates[i], message) && actual == nil {
+			actual = &candidates[i]
+		}
+	}
+	if actual == nil {
+		return ErrVerifyFailed
+	}
+	return &ContextMismatchError{Expected: expected, Actual: *actual}
+}
+
 // SanityCheck checks if the signature appears to be well formed.
 func (s *Signature) SanityCheck(expectedPubKey PublicKey) error {
 	if len(s.PublicKey) != PublicKeySize {
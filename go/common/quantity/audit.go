@@ -0,0 +1,28 @@
+//go:build quantityaudit
+// +build quantityaudit
+
+package quantity
+
+import "fmt"
+
+// AuditEnabled is true iff the quantity audit mode is enabled.
+const AuditEnabled = true
+
+// audit tracks whether a quantity is owned by the state.
+type audit struct {
+	stateOwned bool
+}
+
+// MarkStateOwned marks q as owned by the state. Any further mutation of q other than through Set
+// results in a panic.
+//
+// Copies of q made by assignment retain the mark, use Clone to obtain a mutable copy.
+func (q *Quantity) MarkStateOwned() {
+	q.audit.stateOwned = true
+}
+
+func (q *Quantity) checkMutable() {
+	if q.audit.stateOwned {
+		panic(fmt.Sprintf("quantity: mutation of state-owned quantity %s", q))
+	}
+}
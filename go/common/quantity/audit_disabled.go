@@ -0,0 +1,21 @@
+//go:build !quantityaudit
+// +build !quantityaudit
+
+package quantity
+
+// AuditEnabled is true iff the quantity audit mode is enabled.
+const AuditEnabled = false
+
+// audit tracks whether a quantity is owned by the state. Nothing is tracked when the quantity
+// audit mode is disabled.
+type audit struct{}
+
+// MarkStateOwned marks q as owned by the state. Any further mutation of q other than through Set
+// results in a panic.
+//
+// This is a no-op unless the quantity audit mode is enabled using the quantityaudit build tag.
+func (q *Quantity) MarkStateOwned() {
+}
+
+func (q *Quantity) checkMutable() {
+}
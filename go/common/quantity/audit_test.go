@@ -0,0 +1,40 @@
+//go:build quantityaudit
+// +build quantityaudit
+
+package quantity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditStateOwned(t *testing.T) {
+	require := require.New(t)
+
+	state := map[string]*Quantity{"balance": fromInt(100)}
+	state["balance"].MarkStateOwned()
+
+	// Mutating an alias of a state-owned quantity should panic.
+	balance := state["balance"]
+	require.Panics(func() { _ = balance.Sub(fromInt(10)) }, "Sub on a state-owned quantity")
+	require.Panics(func() { _ = balance.Add(fromInt(10)) }, "Add on a state-owned quantity")
+	require.Panics(func() { _, _ = balance.SubUpTo(fromInt(10)) }, "SubUpTo on a state-owned quantity")
+	require.Panics(func() { _ = balance.Mul(fromInt(10)) }, "Mul on a state-owned quantity")
+	require.Panics(func() { _ = balance.Quo(fromInt(10)) }, "Quo on a state-owned quantity")
+	require.Panics(func() { _ = balance.FromUint64(10) }, "FromUint64 on a state-owned quantity")
+	require.Panics(func() { _ = Move(NewQuantity(), balance, fromInt(10)) }, "Move from a state-owned quantity")
+	require.True(balance.eqInt(100), "state-owned quantity should not be modified")
+
+	// Non-mutating forms and clones are fine.
+	diff, err := balance.SubQ(fromInt(10))
+	require.NoError(err, "SubQ")
+	require.True(diff.eqInt(90), "SubQ value")
+	clone := balance.Clone()
+	require.NotPanics(func() { _ = clone.Sub(fromInt(10)) }, "Sub on a clone of a state-owned quantity")
+
+	// The sanctioned setter is fine as well.
+	balance.Set(diff)
+	require.True(state["balance"].eqInt(90), "Set value")
+	require.Panics(func() { _ = balance.Add(fromInt(10)) }, "quantity should remain state-owned after Set")
+}
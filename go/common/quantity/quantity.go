@@ -4,6 +4,7 @@ import (
 	"encoding"
 	"errors"
 	"math/big"
+	"strings"
 )
 
 var (
@@ -20,22 +21,38 @@ var (
 
 	_ encoding.BinaryMarshaler   = (*Quantity)(nil)
 	_ encoding.BinaryUnmarshaler = (*Quantity)(nil)
+	_ encoding.TextMarshaler     = Quantity{}
+	_ encoding.TextUnmarshaler   = (*Quantity)(nil)
 
 	zero big.Int
 )
 
 // Quantity is a arbitrary precision unsigned integer that never underflows.
+//
+// Arithmetic methods mutate the receiver. When the quantityaudit build tag is set, quantities
+// marked as owned by the state using MarkStateOwned panic when mutated other than through Set,
+// which helps catch values from the state being mutated in place through aliases.
 type Quantity struct {
+	// NOTE: The audit field is zero-sized unless the audit mode is enabled and must come first
+	//       so that it does not affect the size of the struct.
+	audit audit
 	inner big.Int
 }
 
-// Clone copies a Quantity.
+// Clone copies a Quantity. The copy is never owned by the state.
 func (q *Quantity) Clone() *Quantity {
 	tmp := NewQuantity()
 	tmp.inner.Set(&q.inner)
 	return tmp
 }
 
+// Set sets q to the value of n.
+//
+// This is the only way to update a quantity owned by the state.
+func (q *Quantity) Set(n *Quantity) {
+	q.inner.Set(&n.inner)
+}
+
 // MarshalBinary encodes a Quantity into binary form.
 func (q *Quantity) MarshalBinary() ([]byte, error) {
 	return append([]byte{}, q.inner.Bytes()...), nil
@@ -43,6 +60,8 @@ func (q *Quantity) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary decodes a byte slice into a Quantity.
 func (q *Quantity) UnmarshalBinary(data []byte) error {
+	q.checkMutable()
+
 	var tmp big.Int
 	tmp.SetBytes(data)
 	q.inner.Set(&tmp)
@@ -54,12 +73,16 @@ func (q *Quantity) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
-// MarshalText encodes a Quantity into text form.
+// MarshalText encodes a Quantity into text form as a decimal string.
 func (q Quantity) MarshalText() ([]byte, error) {
 	return q.inner.MarshalText()
 }
 
 // UnmarshalText decodes a text slice into a Quantity.
+//
+// Note that any integer literal accepted by big.Int is accepted (e.g., with a
+// base prefix or underscore separators), use FromString to only accept plain
+// decimal strings.
 func (q *Quantity) UnmarshalText(text []byte) error {
 	var tmp big.Int
 	if err := tmp.UnmarshalText(text); err != nil {
@@ -87,8 +110,26 @@ func (q *Quantity) FromUint64(n uint64) error {
 	return q.FromBigInt(&tmp)
 }
 
+// FromString converts from a decimal string to a Quantity. Only non-empty
+// strings consisting of decimal digits are accepted.
+func (q *Quantity) FromString(s string) error {
+	q.checkMutable()
+	if !isDecimal(s) {
+		return ErrInvalidQuantity
+	}
+
+	var tmp big.Int
+	if _, ok := tmp.SetString(s, 10); !ok {
+		return ErrInvalidQuantity
+	}
+	q.inner.Set(&tmp)
+
+	return nil
+}
+
 // FromBigInt converts from a big.Int to a Quantity.
 func (q *Quantity) FromBigInt(n *big.Int) error {
+	q.checkMutable()
 	if n == nil || !isValid(n) {
 		return ErrInvalidQuantity
 	}
@@ -108,6 +149,7 @@ func (q *Quantity) ToBigInt() *big.Int {
 
 // Add adds n to q, returning an error if n < 0 or n == nil.
 func (q *Quantity) Add(n *Quantity) error {
+	q.checkMutable()
 	if n == nil || !n.IsValid() {
 		return ErrInvalidQuantity
 	}
@@ -120,6 +162,7 @@ func (q *Quantity) Add(n *Quantity) error {
 // Sub subtracts exactly n from q, returning an error if q < n, n < 0 or
 // n == nil.
 func (q *Quantity) Sub(n *Quantity) error {
+	q.checkMutable()
 	if n == nil || !n.IsValid() {
 		return ErrInvalidQuantity
 	}
@@ -135,6 +178,7 @@ func (q *Quantity) Sub(n *Quantity) error {
 // SubUpTo subtracts up to n from q, and returns the amount subtracted,
 // returning an error if n < 0 or n == nil.
 func (q *Quantity) SubUpTo(n *Quantity) (*Quantity, error) {
+	q.checkMutable()
 	if n == nil || !n.IsValid() {
 		return nil, ErrInvalidQuantity
 	}
@@ -152,8 +196,28 @@ func (q *Quantity) SubUpTo(n *Quantity) (*Quantity, error) {
 	return &Quantity{inner: amount}, nil
 }
 
+// AddQ returns the sum of q and n without modifying q, returning an error if n < 0 or n == nil.
+func (q *Quantity) AddQ(n *Quantity) (*Quantity, error) {
+	tmp := q.Clone()
+	if err := tmp.Add(n); err != nil {
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// SubQ returns the difference of q and n without modifying q, returning an error if q < n,
+// n < 0 or n == nil.
+func (q *Quantity) SubQ(n *Quantity) (*Quantity, error) {
+	tmp := q.Clone()
+	if err := tmp.Sub(n); err != nil {
+		return nil, err
+	}
+	return tmp, nil
+}
+
 // Mul multiplies n with q, returning an error if n < 0 or n == nil.
 func (q *Quantity) Mul(n *Quantity) error {
+	q.checkMutable()
 	if n == nil || !n.IsValid() {
 		return ErrInvalidQuantity
 	}
@@ -165,6 +229,7 @@ func (q *Quantity) Mul(n *Quantity) error {
 
 // Quo divides q with n, returning an error if n <= 0 or n == nil.
 func (q *Quantity) Quo(n *Quantity) error {
+	q.checkMutable()
 	if n == nil || !n.IsValid() || n.IsZero() {
 		return ErrInvalidQuantity
 	}
@@ -197,6 +262,24 @@ func (q Quantity) String() string {
 	return tmp.String()
 }
 
+// ToTokenString returns the decimal representation of q in tokens, where
+// 1 token = 10**exponent base units.
+//
+// The conversion is exact. Trailing zeros of the fractional part are omitted,
+// as is the decimal point in case there is no fractional part.
+func (q Quantity) ToTokenString(exponent uint8) string {
+	var whole, frac big.Int
+	whole.QuoRem(&q.inner, tokenDenominator(exponent), &frac)
+	if frac.Sign() == 0 {
+		return whole.String()
+	}
+
+	// Prefix the fractional part with the appropriate number of zeros.
+	fracStr := frac.String()
+	fracStr = strings.Repeat("0", int(exponent)-len(fracStr)) + fracStr
+	return whole.String() + "." + strings.TrimRight(fracStr, "0")
+}
+
 // IsValid returns true iff the quantity is in the valid range.
 func (q *Quantity) IsValid() bool {
 	return isValid(&q.inner)
@@ -216,6 +299,57 @@ func NewFromUint64(n uint64) *Quantity {
 	return &q
 }
 
+// NewFromTokens creates a new Quantity from a token amount given by the
+// decimal strings of its whole and fractional parts, where
+// 1 token = 10**exponent base units.
+//
+// The fractional part may be empty and must not be more precise than a single
+// base unit, as the conversion is exact.
+func NewFromTokens(whole, frac string, exponent uint8) (*Quantity, error) {
+	var q Quantity
+	if err := q.FromString(whole); err != nil {
+		return nil, err
+	}
+	q.inner.Mul(&q.inner, tokenDenominator(exponent))
+
+	if frac == "" {
+		return &q, nil
+	}
+	if !isDecimal(frac) {
+		return nil, ErrInvalidQuantity
+	}
+	frac = strings.TrimRight(frac, "0")
+	switch {
+	case frac == "":
+		return &q, nil
+	case len(frac) > int(exponent):
+		return nil, ErrInvalidQuantity
+	}
+	var fracQ Quantity
+	if err := fracQ.FromString(frac + strings.Repeat("0", int(exponent)-len(frac))); err != nil {
+		return nil, err
+	}
+	q.inner.Add(&q.inner, &fracQ.inner)
+
+	return &q, nil
+}
+
+func tokenDenominator(exponent uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func isValid(n *big.Int) bool {
 	return n.Cmp(&zero) >= 0
 }
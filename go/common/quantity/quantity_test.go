@@ -2,6 +2,8 @@ package quantity
 
 import (
 	"encoding/hex"
+	"encoding/json"
+	"math"
 	"math/big"
 	"testing"
 
@@ -123,6 +125,127 @@ func TestQuantityCBORRoundTrip(t *testing.T) {
 	}
 }
 
+func TestFromString(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		s        string
+		expected *big.Int
+	}{
+		{"0", big.NewInt(0)},
+		{"000", big.NewInt(0)},
+		{"42", big.NewInt(42)},
+		{"9223372036854775807", big.NewInt(math.MaxInt64)},
+		{"340282366920938463463374607431768211456", new(big.Int).Lsh(big.NewInt(1), 128)},
+	} {
+		var q Quantity
+		err := q.FromString(tc.s)
+		require.NoError(err, "FromString(%s)", tc.s)
+		require.Zero(tc.expected.Cmp(q.ToBigInt()), "FromString(%s) value", tc.s)
+	}
+
+	for _, s := range []string{"", "-1", "+1", "1.5", "0x10", "1_000", " 1", "1 ", "1e6", "abc"} {
+		var q Quantity
+		err := q.FromString(s)
+		require.Equal(ErrInvalidQuantity, err, "FromString(%s) should fail", s)
+	}
+}
+
+func TestQuantityTextRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		value    *Quantity
+		expected string
+	}{
+		{NewQuantity(), `"0"`},
+		{NewFromUint64(1000), `"1000"`},
+		{NewFromUint64(math.MaxInt64), `"9223372036854775807"`},
+		{NewFromUint64(math.MaxUint64), `"18446744073709551615"`},
+	} {
+		enc, err := json.Marshal(tc.value)
+		require.NoError(err, "json.Marshal")
+		require.Equal(tc.expected, string(enc), "JSON encoding should be a decimal string")
+
+		var dec Quantity
+		err = json.Unmarshal(enc, &dec)
+		require.NoError(err, "json.Unmarshal")
+		require.Zero(tc.value.Cmp(&dec), "JSON encoding should round-trip")
+	}
+
+	var q Quantity
+	for _, s := range []string{`"-1"`, `"1.0"`, `""`} {
+		err := json.Unmarshal([]byte(s), &q)
+		require.Error(err, "json.Unmarshal(%s) should fail", s)
+	}
+
+	// Text decoding should remain lenient for compatibility.
+	for _, tc := range []struct {
+		s        string
+		expected uint64
+	}{
+		{"0x10", 16},
+		{"1_000", 1000},
+	} {
+		err := q.UnmarshalText([]byte(tc.s))
+		require.NoError(err, "UnmarshalText(%s)", tc.s)
+		require.Zero(NewFromUint64(tc.expected).Cmp(&q), "UnmarshalText(%s) value", tc.s)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		whole    string
+		frac     string
+		exponent uint8
+		base     uint64
+		tokens   string
+	}{
+		{"0", "", 0, 0, "0"},
+		{"0", "", 9, 0, "0"},
+		{"0", "000", 9, 0, "0"},
+		{"1", "", 0, 1, "1"},
+		{"1", "", 9, 1_000_000_000, "1"},
+		{"1", "5", 9, 1_500_000_000, "1.5"},
+		{"0", "000000001", 9, 1, "0.000000001"},
+		{"12", "0340", 3, 12_034, "12.034"},
+		{"9223372036", "854775807", 9, math.MaxInt64, "9223372036.854775807"},
+		{"9223372036854775807", "", 0, math.MaxInt64, "9223372036854775807"},
+		{"18446744073", "709551615", 9, math.MaxUint64, "18446744073.709551615"},
+	} {
+		q, err := NewFromTokens(tc.whole, tc.frac, tc.exponent)
+		require.NoError(err, "NewFromTokens(%s, %s, %d)", tc.whole, tc.frac, tc.exponent)
+		require.Zero(NewFromUint64(tc.base).Cmp(q), "NewFromTokens(%s, %s, %d) value", tc.whole, tc.frac, tc.exponent)
+		require.Equal(tc.tokens, q.ToTokenString(tc.exponent), "ToTokenString(%d)", tc.exponent)
+	}
+
+	// Amounts too large for 64 bits should be converted exactly.
+	q, err := NewFromTokens("1000000000000000000000", "000000000000000001", 18)
+	require.NoError(err, "NewFromTokens(large)")
+	require.Equal("1000000000000000000000000000000000000001", q.String(), "NewFromTokens(large) value")
+	require.Equal("1000000000000000000000.000000000000000001", q.ToTokenString(18), "ToTokenString(18) of large value")
+
+	for _, tc := range []struct {
+		whole    string
+		frac     string
+		exponent uint8
+	}{
+		{"", "", 9},
+		{"-1", "", 9},
+		{"1", "-5", 9},
+		{"1.5", "", 9},
+		{"1", "5.0", 9},
+		{"1", "x", 9},
+		{"1", "1", 0},
+		{"0", "0000000001", 9},
+	} {
+		_, err := NewFromTokens(tc.whole, tc.frac, tc.exponent)
+		require.Equal(ErrInvalidQuantity, err, "NewFromTokens(%s, %s, %d) should fail", tc.whole, tc.frac, tc.exponent)
+	}
+}
+
 func TestQuantityAdd(t *testing.T) {
 	require := require.New(t)
 
@@ -158,6 +281,56 @@ func TestQuantitySub(t *testing.T) {
 	require.True(q.eqInt(77), "Sub(23) value")
 }
 
+func TestQuantityAddQSubQ(t *testing.T) {
+	require := require.New(t)
+
+	q := fromInt(100)
+
+	_, err := q.AddQ(nil)
+	require.Equal(ErrInvalidQuantity, err, "AddQ(nil)")
+	_, err = q.SubQ(fromInt(-1))
+	require.Equal(ErrInvalidQuantity, err, "SubQ(-1)")
+	_, err = q.SubQ(fromInt(200))
+	require.Equal(ErrInsufficientBalance, err, "SubQ(200)")
+
+	sum, err := q.AddQ(fromInt(200))
+	require.NoError(err, "AddQ")
+	require.True(sum.eqInt(300), "AddQ(200) value")
+
+	diff, err := q.SubQ(fromInt(23))
+	require.NoError(err, "SubQ")
+	require.True(diff.eqInt(77), "SubQ(23) value")
+
+	require.True(q.eqInt(100), "AddQ and SubQ should not modify the receiver")
+
+	// Results should be the same as when using the mutating forms.
+	for _, n := range []int{0, 1, 23, 100} {
+		expected := q.Clone()
+		require.NoError(expected.Add(fromInt(n)), "Add")
+		sum, err = q.AddQ(fromInt(n))
+		require.NoError(err, "AddQ")
+		require.Zero(expected.Cmp(sum), "AddQ(%d) should match Add", n)
+
+		expected = q.Clone()
+		require.NoError(expected.Sub(fromInt(n)), "Sub")
+		diff, err = q.SubQ(fromInt(n))
+		require.NoError(err, "SubQ")
+		require.Zero(expected.Cmp(diff), "SubQ(%d) should match Sub", n)
+	}
+}
+
+func TestQuantitySet(t *testing.T) {
+	require := require.New(t)
+
+	q := fromInt(100)
+
+	n := fromInt(23)
+	q.Set(n)
+	require.True(q.eqInt(23), "Set(23) value")
+	_ = n.Add(fromInt(1))
+	require.True(q.eqInt(23), "Set should copy the value")
+}
+
 func TestQuantitySubUpTo(t *testing.T) {
 	require := require.New(t)
 
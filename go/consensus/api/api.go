@@ -100,6 +100,10 @@ type ClientBackend interface {
 	// in a block. Use SubmitTxNoWait if you only need to broadcast the transaction.
 	SubmitTx(ctx context.Context, tx *transaction.SignedTransaction) error
 
+	// SubmitMultiSignedTx submits a multi-signed consensus transaction on behalf of a
+	// multi-signature account and waits for the transaction to be included in a block.
+	SubmitMultiSignedTx(ctx context.Context, tx *staking.MultiSignedTransaction) error
+
 	// StateToGenesis returns the genesis state at the specified block height.
 	StateToGenesis(ctx context.Context, height int64) (*genesis.Document, error)
 
@@ -32,6 +32,9 @@ var (
 
 	registeredMethods sync.Map
 
+	knownSignatureContextsLock sync.RWMutex
+	knownSignatureContexts     = []signature.Context{SignatureContext}
+
 	_ prettyprint.PrettyPrinter = (*Transaction)(nil)
 	_ prettyprint.PrettyPrinter = (*SignedTransaction)(nil)
 )
@@ -207,8 +210,37 @@ func (s SignedTransaction) PrettyType() (interface{}, error) {
 }
 
 // Open first verifies the blob signature and then unmarshals the blob.
+//
+// In case the transaction has been signed under another known signature context, the returned
+// error is a *signature.ContextMismatchError.
 func (s *SignedTransaction) Open(tx *Transaction) error { // nolint: interfacer
-	return s.Signed.Open(SignatureContext, tx)
+	if !s.Signature.Verify(SignatureContext, s.Blob) {
+		return s.Signature.DiagnoseContext(SignatureContext, KnownSignatureContexts(), s.Blob)
+	}
+	return cbor.Unmarshal(s.Blob, tx)
+}
+
+// RegisterKnownSignatureContext registers a signature context under which transactions may be
+// signed by mistake (e.g., the context of another transaction envelope), so that such transactions
+// are rejected with a *signature.ContextMismatchError instead of a generic verification failure.
+func RegisterKnownSignatureContext(context signature.Context) {
+	knownSignatureContextsLock.Lock()
+	defer knownSignatureContextsLock.Unlock()
+
+	for _, known := range knownSignatureContexts {
+		if known == context {
+			return
+		}
+	}
+	knownSignatureContexts = append(knownSignatureContexts, context)
+}
+
+// KnownSignatureContexts returns the known signature contexts of transaction envelopes.
+func KnownSignatureContexts() []signature.Context {
+	knownSignatureContextsLock.RLock()
+	defer knownSignatureContextsLock.RUnlock()
+
+	return append([]signature.Context{}, knownSignatureContexts...)
 }
 
 // Sign signs a transaction.
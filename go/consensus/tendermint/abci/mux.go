@@ -30,6 +30,7 @@ import (
 	consensusGenesis "github.com/oasisprotocol/oasis-core/go/consensus/genesis"
 	abciState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/abci/state"
 	"github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
 	storageApi "github.com/oasisprotocol/oasis-core/go/storage/api"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/checkpoint"
 	upgrade "github.com/oasisprotocol/oasis-core/go/upgrade/api"
@@ -360,6 +361,16 @@ func (mux *abciMux) InitChain(req types.RequestInitChain) types.ResponseInitChai
 	if err = state.SetConsensusParameters(ctx, &st.Consensus.Parameters); err != nil {
 		panic(fmt.Errorf("mux: failed to set consensus parameters: %w", err))
 	}
+	// Application state created from genesis is always at the latest schema version.
+	for _, app := range mux.appsByLexOrder {
+		version := abciState.LatestSchemaVersion(app.Name())
+		if version == 0 {
+			continue
+		}
+		if err = state.SetSchemaVersion(ctx, app.Name(), version); err != nil {
+			panic(fmt.Errorf("mux: failed to set schema version of application '%s': %w", app.Name(), err))
+		}
+	}
 	// Since InitChain does not have a commit step, perform some state updates here.
 	if err = mux.state.doInitChain(st.Time); err != nil {
 		panic(fmt.Errorf("mux: failed to init chain state: %w", err))
@@ -497,10 +508,12 @@ func (mux *abciMux) BeginBlock(req types.RequestBeginBlock) types.ResponseBeginB
 	return response
 }
 
-func (mux *abciMux) decodeTx(ctx *api.Context, rawTx []byte) (*transaction.Transaction, *transaction.SignedTransaction, error) {
+// decodeTx unmarshals the transaction envelope, verifies the transaction and sets the
+// authenticated transaction signer(s) on the context.
+func (mux *abciMux) decodeTx(ctx *api.Context, rawTx []byte) (*transaction.Transaction, error) {
 	if mux.state.haltMode {
 		ctx.Logger().Debug("executeTx: in halt, rejecting all transactions")
-		return nil, nil, fmt.Errorf("halt mode, rejecting all transactions")
+		return nil, fmt.Errorf("halt mode, rejecting all transactions")
 	}
 
 	params := mux.state.ConsensusParameters()
@@ -510,32 +523,60 @@ func (mux *abciMux) decodeTx(ctx *api.Context, rawTx []byte) (*transaction.Trans
 		ctx.Logger().Error("received oversized transaction",
 			"tx_size", len(rawTx),
 		)
-		return nil, nil, consensus.ErrOversizedTx
+		return nil, consensus.ErrOversizedTx
 	}
 
 	// Unmarshal envelope and verify transaction.
-	var sigTx transaction.SignedTransaction
-	if err := cbor.Unmarshal(rawTx, &sigTx); err != nil {
+	var (
+		tx      transaction.Transaction
+		sigTx   transaction.SignedTransaction
+		multiTx staking.MultiSignedTransaction
+	)
+	err := cbor.Unmarshal(rawTx, &sigTx)
+	switch {
+	case err == nil:
+		if err = sigTx.Open(&tx); err != nil {
+			ctx.Logger().Error("failed to verify transaction signature",
+				"tx", base64.StdEncoding.EncodeToString(rawTx),
+			)
+			return nil, err
+		}
+
+		// Set authenticated transaction signer.
+		ctx.SetTxSigner(sigTx.Signature.PublicKey)
+	case cbor.Unmarshal(rawTx, &multiTx) == nil:
+		var mtx staking.MultiSigTransaction
+		if err = multiTx.Open(&mtx); err != nil {
+			ctx.Logger().Error("failed to verify multi-signed transaction signatures",
+				"tx", base64.StdEncoding.EncodeToString(rawTx),
+			)
+			return nil, err
+		}
+		tx = mtx.Transaction
+
+		// Multi-signed transactions are authorized against the account's multi-signature
+		// descriptor by the transaction authentication handler, which is skipped for critical
+		// methods.
+		if mux.state.txAuthHandler == nil || tx.Method.IsCritical() {
+			return nil, fmt.Errorf("mux: multi-signed transactions not allowed for method: %s", tx.Method)
+		}
+
+		// Set authenticated transaction signers.
+		ctx.SetTxMultiSigners(mtx.Account, multiTx.Signers())
+	default:
 		ctx.Logger().Error("failed to unmarshal signed transaction",
 			"tx", base64.StdEncoding.EncodeToString(rawTx),
 		)
-		return nil, nil, err
-	}
-	var tx transaction.Transaction
-	if err := sigTx.Open(&tx); err != nil {
-		ctx.Logger().Error("failed to verify transaction signature",
-			"tx", base64.StdEncoding.EncodeToString(rawTx),
-		)
-		return nil, nil, err
+		return nil, err
 	}
-	if err := tx.SanityCheck(); err != nil {
+	if err = tx.SanityCheck(); err != nil {
 		ctx.Logger().Error("bad transaction",
 			"tx", base64.StdEncoding.EncodeToString(rawTx),
 		)
-		return nil, nil, err
+		return nil, err
 	}
 
-	return &tx, &sigTx, nil
+	return &tx, nil
 }
 
 func (mux *abciMux) processTx(ctx *api.Context, tx *transaction.Transaction, txSize int) error {
@@ -598,14 +639,11 @@ func (mux *abciMux) processTx(ctx *api.Context, tx *transaction.Transaction, txS
 }
 
 func (mux *abciMux) executeTx(ctx *api.Context, rawTx []byte) error {
-	tx, sigTx, err := mux.decodeTx(ctx, rawTx)
+	tx, err := mux.decodeTx(ctx, rawTx)
 	if err != nil {
 		return err
 	}
 
-	// Set authenticated transaction signer.
-	ctx.SetTxSigner(sigTx.Signature.PublicKey)
-
 	// If we are in CheckTx mode and there is a pending upgrade in this block, make sure to reject
 	// any transactions before processing as they may potentially query incompatible state.
 	if upgrader := mux.state.Upgrader(); upgrader != nil && ctx.IsCheckOnly() {
@@ -785,6 +823,19 @@ func (mux *abciMux) EndBlock(req types.RequestEndBlock) types.ResponseEndBlock {
 		if err != nil {
 			panic(fmt.Errorf("mux: error while trying to perform consensus upgrade: %w", err))
 		}
+
+		// Run any pending application state migrations at the upgrade height.
+		hasUpgrade, err := upgrader.HasPendingUpgradeAt(ctx, ctx.BlockHeight())
+		if err != nil {
+			panic(fmt.Errorf("mux: failed to check for pending upgrades: %w", err))
+		}
+		if hasUpgrade {
+			for _, app := range mux.appsByLexOrder {
+				if err = abciState.RunMigrations(ctx, app.Name()); err != nil {
+					panic(fmt.Errorf("mux: failed to migrate state of application '%s': %w", app.Name(), err))
+				}
+			}
+		}
 	}
 
 	// Update tags.
@@ -0,0 +1,191 @@
+package abci
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/abci/types"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	"github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	genesis "github.com/oasisprotocol/oasis-core/go/genesis/api"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+	storageDB "github.com/oasisprotocol/oasis-core/go/storage/database"
+	"github.com/oasisprotocol/oasis-core/go/upgrade"
+)
+
+var testMuxMethod = transaction.NewMethodName("testmux", "Method", nil)
+
+type testTxCall struct {
+	method       transaction.MethodName
+	caller       staking.Address
+	txSigner     signature.PublicKey
+	multiSigners []signature.PublicKey
+}
+
+// testMuxApp is an application which records all executed transactions.
+type testMuxApp struct {
+	calls []testTxCall
+}
+
+func (app *testMuxApp) Name() string {
+	return "testmux"
+}
+
+func (app *testMuxApp) ID() uint8 {
+	return 0x7f
+}
+
+func (app *testMuxApp) Methods() []transaction.MethodName {
+	return []transaction.MethodName{testMuxMethod}
+}
+
+func (app *testMuxApp) Blessed() bool {
+	return false
+}
+
+func (app *testMuxApp) Dependencies() []string {
+	return nil
+}
+
+func (app *testMuxApp) QueryFactory() interface{} {
+	return nil
+}
+
+func (app *testMuxApp) OnRegister(state api.ApplicationState, md api.MessageDispatcher) {
+}
+
+func (app *testMuxApp) OnCleanup() {
+}
+
+func (app *testMuxApp) ExecuteMessage(ctx *api.Context, kind, msg interface{}) error {
+	return nil
+}
+
+func (app *testMuxApp) ExecuteTx(ctx *api.Context, tx *transaction.Transaction) error {
+	app.calls = append(app.calls, testTxCall{
+		method:       tx.Method,
+		caller:       ctx.CallerAddress(),
+		txSigner:     ctx.TxSigner(),
+		multiSigners: ctx.TxMultiSigners(),
+	})
+	return nil
+}
+
+func (app *testMuxApp) InitChain(ctx *api.Context, req types.RequestInitChain, doc *genesis.Document) error {
+	return nil
+}
+
+func (app *testMuxApp) BeginBlock(ctx *api.Context, req types.RequestBeginBlock) error {
+	return nil
+}
+
+func (app *testMuxApp) EndBlock(ctx *api.Context, req types.RequestEndBlock) (types.ResponseEndBlock, error) {
+	return types.ResponseEndBlock{}, nil
+}
+
+// testAuthHandler is a transaction auth handler which counts authenticated transactions.
+type testAuthHandler struct {
+	authenticated int
+}
+
+func (h *testAuthHandler) GetSignerNonce(ctx context.Context, req *consensus.GetSignerNonceRequest) (uint64, error) {
+	return 0, nil
+}
+
+func (h *testAuthHandler) AuthenticateTx(ctx *api.Context, tx *transaction.Transaction) error {
+	h.authenticated++
+	return nil
+}
+
+func (h *testAuthHandler) PostExecuteTx(ctx *api.Context, tx *transaction.Transaction) error {
+	return nil
+}
+
+func TestMultiSignedTx(t *testing.T) {
+	require := require.New(t)
+
+	signature.SetChainContext("test: oasis-core tests")
+
+	dir, err := ioutil.TempDir("", "abci-mux.test")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dir)
+
+	mux, err := NewMockMux(context.Background(), upgrade.NewDummyUpgradeManager(), &ApplicationConfig{
+		DataDir:             dir,
+		StorageBackend:      storageDB.BackendNameBadgerDB,
+		MemoryOnlyStorage:   true,
+		DisableCheckpointer: true,
+		InitialHeight:       1,
+		Pruning: PruneConfig{
+			PruneInterval: time.Hour,
+		},
+	})
+	require.NoError(err, "NewMockMux")
+	defer mux.MockClose()
+
+	app := &testMuxApp{}
+	err = mux.MockRegisterApp(app)
+	require.NoError(err, "MockRegisterApp")
+	err = mux.finishInitialization()
+	require.NoError(err, "finishInitialization")
+
+	doc := &genesis.Document{
+		Height:  1,
+		Time:    time.Unix(1580461674, 0),
+		ChainID: "abci-mux-test",
+	}
+	rawDoc, err := json.Marshal(doc)
+	require.NoError(err, "json.Marshal")
+	mux.InitChain(types.RequestInitChain{
+		AppStateBytes: rawDoc,
+		InitialHeight: 1,
+	})
+
+	signers := []signature.Signer{
+		memorySigner.NewTestSigner("abci mux test signer 1"),
+		memorySigner.NewTestSigner("abci mux test signer 2"),
+	}
+	account := staking.NewAddress(memorySigner.NewTestSigner("abci mux test account").Public())
+	tx := transaction.NewTransaction(0, nil, testMuxMethod, nil)
+	multiTx, err := staking.SignMultiSigTransaction(signers, account, tx)
+	require.NoError(err, "SignMultiSigTransaction")
+	rawTx := cbor.Marshal(multiTx)
+
+	// Multi-signed transactions must be rejected without a transaction auth handler.
+	checkRsp := mux.CheckTx(types.RequestCheckTx{Tx: rawTx, Type: types.CheckTxType_New})
+	require.False(checkRsp.IsOK(), "CheckTx should fail without a transaction auth handler")
+	require.Empty(app.calls, "transaction should not be executed")
+
+	authHandler := &testAuthHandler{}
+	mux.MockSetTransactionAuthHandler(authHandler)
+
+	checkRsp = mux.CheckTx(types.RequestCheckTx{Tx: rawTx, Type: types.CheckTxType_New})
+	require.True(checkRsp.IsOK(), "CheckTx: %s", checkRsp.Log)
+	deliverRsp := mux.DeliverTx(types.RequestDeliverTx{Tx: rawTx})
+	require.True(deliverRsp.IsOK(), "DeliverTx: %s", deliverRsp.Log)
+
+	require.Equal(2, authHandler.authenticated, "transaction should be authenticated")
+	require.Len(app.calls, 2, "transaction should be executed")
+	for _, call := range app.calls {
+		require.Equal(testMuxMethod, call.method, "executed method")
+		require.Equal(account, call.caller, "caller should be the multi-signature account")
+		require.Equal(signature.PublicKey{}, call.txSigner, "transaction signer should not be set")
+		require.Equal(multiTx.Signers(), call.multiSigners, "multi-signers should be set")
+	}
+
+	// Transactions with invalid signatures must be rejected.
+	multiTx.Signatures[1].Signature[0] ^= 0xff
+	checkRsp = mux.CheckTx(types.RequestCheckTx{Tx: cbor.Marshal(multiTx), Type: types.CheckTxType_New})
+	require.False(checkRsp.IsOK(), "CheckTx should fail with an invalid signature")
+	require.Len(app.calls, 2, "transaction should not be executed")
+}
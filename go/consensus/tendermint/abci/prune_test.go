@@ -27,9 +27,9 @@ func TestPruneKeepN(t *testing.T) {
 
 	// Create a Badger-backed Node DB.
 	ndb, err := mkvsBadgerDB.New(&mkvsDB.Config{
-		DB:           dir,
-		NoFsync:      true,
-		MaxCacheSize: 16 * 1024 * 1024,
+		DB:             dir,
+		NoFsync:        true,
+		BlockCacheSize: 16 * 1024 * 1024,
 	})
 	require.NoError(err, "New")
 	tree := mkvs.New(nil, ndb, mkvsNode.RootTypeState)
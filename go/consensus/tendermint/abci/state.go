@@ -478,7 +478,7 @@ func InitStateStorage(ctx context.Context, cfg *ApplicationConfig) (storage.Loca
 	db, err := storageDB.New(&storage.Config{
 		Backend:          cfg.StorageBackend,
 		DB:               filepath.Join(baseDir, storageDB.DefaultFileName(cfg.StorageBackend)),
-		MaxCacheSize:     64 * 1024 * 1024, // TODO: Make this configurable.
+		BlockCacheSize:   64 * 1024 * 1024, // TODO: Make this configurable.
 		DiscardWriteLogs: true,
 		NoFsync:          true, // This is safe as Tendermint will replay on crash.
 		MemoryOnly:       cfg.MemoryOnlyStorage,
@@ -0,0 +1,126 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/keyformat"
+	"github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+)
+
+// schemaVersionKeyFmt is the key format used for per-application state schema versions.
+//
+// Key format is: 0xF2 <application name ([]byte)>
+// Value is CBOR-serialized uint64.
+var schemaVersionKeyFmt = keyformat.New(0xF2, []byte{})
+
+var registeredMigrations sync.Map
+
+// Migration is an application state migration.
+type Migration struct {
+	// FromVersion is the state schema version the migration applies to. After the migration
+	// completes, the state schema version is FromVersion+1.
+	FromVersion uint64
+
+	// Migrate performs the migration. It is called with an EndBlock context.
+	Migrate func(ctx *api.Context) error
+}
+
+// RegisterMigrations registers the state migrations of the given application.
+//
+// Migrations must be ordered by their FromVersion, starting at version zero, without any gaps.
+// The latest state schema version of the application is equal to the number of migrations.
+func RegisterMigrations(app string, migrations ...Migration) {
+	for i, m := range migrations {
+		if m.FromVersion != uint64(i) {
+			panic(fmt.Errorf("state: migration %d of application '%s' has unexpected from version %d", i, app, m.FromVersion))
+		}
+		if m.Migrate == nil {
+			panic(fmt.Errorf("state: migration %d of application '%s' has no migrate function", i, app))
+		}
+	}
+	if _, isRegistered := registeredMigrations.LoadOrStore(app, migrations); isRegistered {
+		panic(fmt.Errorf("state: migrations already registered for application '%s'", app))
+	}
+}
+
+func getMigrations(app string) []Migration {
+	migrations, ok := registeredMigrations.Load(app)
+	if !ok {
+		return nil
+	}
+	return migrations.([]Migration)
+}
+
+// LatestSchemaVersion returns the latest state schema version of the given application.
+func LatestSchemaVersion(app string) uint64 {
+	return uint64(len(getMigrations(app)))
+}
+
+// SchemaVersion returns the state schema version of the given application.
+//
+// In case no version has been recorded, the state is assumed to predate the introduction of
+// migrations and zero is returned.
+func (s *ImmutableState) SchemaVersion(ctx context.Context, app string) (uint64, error) {
+	raw, err := s.is.Get(ctx, schemaVersionKeyFmt.Encode([]byte(app)))
+	if err != nil {
+		return 0, api.UnavailableStateError(err)
+	}
+	if raw == nil {
+		return 0, nil
+	}
+
+	var version uint64
+	if err = cbor.Unmarshal(raw, &version); err != nil {
+		return 0, api.UnavailableStateError(err)
+	}
+	return version, nil
+}
+
+// SetSchemaVersion sets the state schema version of the given application.
+//
+// NOTE: This method must only be called from InitChain/EndBlock contexts.
+func (s *MutableState) SetSchemaVersion(ctx context.Context, app string, version uint64) error {
+	if err := s.is.CheckContextMode(ctx, []api.ContextMode{api.ContextInitChain, api.ContextEndBlock}); err != nil {
+		return err
+	}
+	err := s.ms.Insert(ctx, schemaVersionKeyFmt.Encode([]byte(app)), cbor.Marshal(version))
+	return api.UnavailableStateError(err)
+}
+
+// RunMigrations runs all registered state migrations of the given application that have not yet
+// been applied, in order, and records the resulting state schema version.
+//
+// NOTE: This method must only be called from EndBlock contexts.
+func RunMigrations(ctx *api.Context, app string) error {
+	if ctx.Mode() != api.ContextEndBlock {
+		return fmt.Errorf("state: migrations can only be run in EndBlock, not in %s", ctx.Mode())
+	}
+
+	state := NewMutableState(ctx.State())
+	version, err := state.SchemaVersion(ctx, app)
+	if err != nil {
+		return fmt.Errorf("state: failed to get schema version of application '%s': %w", app, err)
+	}
+	migrations := getMigrations(app)
+	if latest := uint64(len(migrations)); version > latest {
+		return fmt.Errorf("state: schema version %d of application '%s' is newer than latest version %d", version, app, latest)
+	}
+
+	for _, m := range migrations[version:] {
+		ctx.Logger().Info("running state migration",
+			"app", app,
+			"from_version", m.FromVersion,
+		)
+
+		if err = m.Migrate(ctx); err != nil {
+			return fmt.Errorf("state: migration of application '%s' from version %d failed: %w", app, m.FromVersion, err)
+		}
+		if err = state.SetSchemaVersion(ctx, app, m.FromVersion+1); err != nil {
+			return fmt.Errorf("state: failed to set schema version of application '%s': %w", app, err)
+		}
+	}
+	return nil
+}
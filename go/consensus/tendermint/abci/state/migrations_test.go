@@ -0,0 +1,86 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+)
+
+func TestMigrations(t *testing.T) {
+	require := require.New(t)
+
+	const app = "test_migrations"
+	errMigration := errors.New("migration failed")
+
+	var (
+		applied []uint64
+		fail    bool
+	)
+	migrate := func(version uint64) func(*api.Context) error {
+		return func(ctx *api.Context) error {
+			if fail && version == 1 {
+				return errMigration
+			}
+			applied = append(applied, version)
+			return nil
+		}
+	}
+
+	require.Panics(func() {
+		RegisterMigrations("test_migrations_unordered", Migration{FromVersion: 1, Migrate: migrate(1)})
+	}, "migrations with gaps should be rejected")
+	RegisterMigrations(app,
+		Migration{FromVersion: 0, Migrate: migrate(0)},
+		Migration{FromVersion: 1, Migrate: migrate(1)},
+	)
+	require.Panics(func() {
+		RegisterMigrations(app)
+	}, "migrations should only be registered once")
+	require.EqualValues(2, LatestSchemaVersion(app), "LatestSchemaVersion")
+	require.EqualValues(0, LatestSchemaVersion("test_migrations_none"), "LatestSchemaVersion")
+
+	now := time.Unix(1580461674, 0)
+	appState := api.NewMockApplicationState(&api.MockApplicationStateConfig{})
+
+	// Migrations can only run in EndBlock.
+	ctx := appState.NewContext(api.ContextBeginBlock, now)
+	err := RunMigrations(ctx, app)
+	require.Error(err, "RunMigrations should fail outside of EndBlock")
+	ctx.Close()
+
+	ctx = appState.NewContext(api.ContextEndBlock, now)
+	defer ctx.Close()
+	state := NewMutableState(ctx.State())
+
+	// A failing migration should not update the schema version.
+	fail = true
+	err = RunMigrations(ctx, app)
+	require.ErrorIs(err, errMigration, "RunMigrations should propagate migration errors")
+	version, err := state.SchemaVersion(ctx, app)
+	require.NoError(err, "SchemaVersion")
+	require.EqualValues(1, version, "schema version should only include completed migrations")
+
+	// Retrying should only run the remaining migrations.
+	fail = false
+	err = RunMigrations(ctx, app)
+	require.NoError(err, "RunMigrations")
+	version, err = state.SchemaVersion(ctx, app)
+	require.NoError(err, "SchemaVersion")
+	require.EqualValues(2, version, "schema version should be the latest version")
+	require.Equal([]uint64{0, 1}, applied, "each migration should run exactly once")
+
+	// Running migrations again should be a no-op.
+	err = RunMigrations(ctx, app)
+	require.NoError(err, "RunMigrations")
+	require.Equal([]uint64{0, 1}, applied, "migrations should not run again")
+
+	// State from a newer schema version should be rejected.
+	err = state.SetSchemaVersion(ctx, app, 3)
+	require.NoError(err, "SetSchemaVersion")
+	err = RunMigrations(ctx, app)
+	require.Error(err, "RunMigrations should fail for newer schema versions")
+}
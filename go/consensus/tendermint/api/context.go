@@ -70,8 +70,9 @@ type Context struct { // nolint: maligned
 	events        []types.Event
 	gasAccountant GasAccountant
 
-	txSigner      signature.PublicKey
-	callerAddress staking.Address
+	txSigner       signature.PublicKey
+	txMultiSigners []signature.PublicKey
+	callerAddress  staking.Address
 
 	appState      ApplicationState
 	state         mkvs.Tree
@@ -186,6 +187,7 @@ func (c *Context) SetTxSigner(txSigner signature.PublicKey) {
 	switch c.mode {
 	case ContextCheckTx, ContextDeliverTx, ContextSimulateTx:
 		c.txSigner = txSigner
+		c.txMultiSigners = nil
 		// By default, the caller is the transaction signer.
 		c.callerAddress = staking.NewAddress(txSigner)
 	default:
@@ -193,6 +195,40 @@ func (c *Context) SetTxSigner(txSigner signature.PublicKey) {
 	}
 }
 
+// TxMultiSigners returns the authenticated signers of a multi-signed transaction or nil in case
+// the transaction is not multi-signed.
+//
+// In case the method is called on a non-transaction context, this method
+// will panic.
+func (c *Context) TxMultiSigners() []signature.PublicKey {
+	switch c.mode {
+	case ContextCheckTx, ContextDeliverTx, ContextSimulateTx:
+		return c.txMultiSigners
+	default:
+		panic("context: only available in transaction context")
+	}
+}
+
+// SetTxMultiSigners sets the authenticated signers of a multi-signed transaction submitted on
+// behalf of the given account.
+//
+// This must only be done after verifying the transaction signatures. The transaction signer is
+// left unset as there is no single signer, so only methods that authorize the caller by its
+// address can be used.
+//
+// In case the method is called on a non-transaction context, this method
+// will panic.
+func (c *Context) SetTxMultiSigners(account staking.Address, signers []signature.PublicKey) {
+	switch c.mode {
+	case ContextCheckTx, ContextDeliverTx, ContextSimulateTx:
+		c.txSigner = signature.PublicKey{}
+		c.txMultiSigners = signers
+		c.callerAddress = account
+	default:
+		panic("context: only available in transaction context")
+	}
+}
+
 // CallerAddress returns the authenticated address representing the caller.
 func (c *Context) CallerAddress() staking.Address {
 	return c.callerAddress
@@ -207,6 +243,7 @@ func (c *Context) NewChild() *Context {
 		isMessageExecution: c.isMessageExecution,
 		gasAccountant:      c.gasAccountant,
 		txSigner:           c.txSigner,
+		txMultiSigners:     c.txMultiSigners,
 		callerAddress:      c.callerAddress,
 		appState:           c.appState,
 		state:              c.state,
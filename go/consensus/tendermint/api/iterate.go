@@ -0,0 +1,111 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/common/keyformat"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+)
+
+// KeyFormatIterateFunc is the callback invoked for each key visited by IterateKeyFormat with the
+// values decoded from the key and the raw value stored under the key.
+//
+// Returning false stops the iteration.
+type KeyFormatIterateFunc func(values []interface{}, value []byte) bool
+
+// IterateKeyFormat visits all keys in the given tree which were encoded using the given key format
+// and start with the key encoded from the given prefix values. Keys are visited in key order.
+//
+// The prefix may contain fewer values than the key format's layout. For each key, newValues is
+// called to obtain the pointers the key should be decoded into (as accepted by KeyFormat.Decode);
+// it may be nil in case the keys don't need to be decoded. Keys which match the prefix but cannot
+// be decoded are skipped.
+//
+// Returns the number of skipped keys.
+func IterateKeyFormat(
+	ctx context.Context,
+	tree mkvs.ImmutableKeyValueTree,
+	kf *keyformat.KeyFormat,
+	prefix []interface{},
+	newValues func() []interface{},
+	fn KeyFormatIterateFunc,
+) (int, error) {
+	_, skipped, err := iterateKeyFormat(ctx, tree, kf, kf.Encode(prefix...), nil, 0, newValues, fn)
+	return skipped, err
+}
+
+// IterateKeyFormatPage is like IterateKeyFormat, but visits at most limit keys, starting at the
+// given continuation key, or at the first matching key in case the continuation key is nil.
+//
+// Returns the continuation key for the next page, which is nil when there are no more keys or
+// the iteration was stopped by the callback. Skipped keys do not count towards the limit.
+func IterateKeyFormatPage(
+	ctx context.Context,
+	tree mkvs.ImmutableKeyValueTree,
+	kf *keyformat.KeyFormat,
+	prefix []interface{},
+	newValues func() []interface{},
+	start []byte,
+	limit int,
+	fn KeyFormatIterateFunc,
+) ([]byte, int, error) {
+	if limit <= 0 {
+		return nil, 0, fmt.Errorf("abci: invalid page limit: %d", limit)
+	}
+	prefixKey := kf.Encode(prefix...)
+	if start != nil && !bytes.HasPrefix(start, prefixKey) {
+		return nil, 0, fmt.Errorf("abci: continuation key outside of the iterated range")
+	}
+	return iterateKeyFormat(ctx, tree, kf, prefixKey, start, limit, newValues, fn)
+}
+
+func iterateKeyFormat(
+	ctx context.Context,
+	tree mkvs.ImmutableKeyValueTree,
+	kf *keyformat.KeyFormat,
+	prefixKey []byte,
+	start []byte,
+	limit int,
+	newValues func() []interface{},
+	fn KeyFormatIterateFunc,
+) ([]byte, int, error) {
+	it := tree.NewIterator(ctx)
+	defer it.Close()
+
+	seekKey := start
+	if seekKey == nil {
+		seekKey = prefixKey
+	}
+
+	var visited, skipped int
+	for it.Seek(seekKey); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefixKey) {
+			break
+		}
+		if limit > 0 && visited >= limit {
+			return key, skipped, nil
+		}
+
+		// Make sure not to decode keys that are too short as that would panic.
+		var values []interface{}
+		if newValues != nil {
+			values = newValues()
+		}
+		if len(key) < kf.Size() || !kf.Decode(key, values...) {
+			skipped++
+			continue
+		}
+		visited++
+
+		if !fn(values, it.Value()) {
+			break
+		}
+	}
+	if it.Err() != nil {
+		return nil, skipped, UnavailableStateError(it.Err())
+	}
+	return nil, skipped, nil
+}
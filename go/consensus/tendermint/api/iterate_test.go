@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/keyformat"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// testKeyElement is a key element that fails to decode when its first byte is 0xff.
+type testKeyElement [2]byte
+
+func (e *testKeyElement) MarshalBinary() ([]byte, error) {
+	return e[:], nil
+}
+
+func (e *testKeyElement) UnmarshalBinary(data []byte) error {
+	if data[0] == 0xff {
+		return errors.New("invalid element")
+	}
+	copy(e[:], data)
+	return nil
+}
+
+var testIterateKeyFmt = keyformat.New(0x01, uint64(0), &testKeyElement{})
+
+type testIterateEntry struct {
+	group uint64
+	elem  testKeyElement
+}
+
+func newTestIterateValues() []interface{} {
+	return []interface{}{new(uint64), &testKeyElement{}}
+}
+
+// collectTestIterateEntries returns an iteration callback that collects all visited entries.
+func collectTestIterateEntries(entries *[]testIterateEntry) KeyFormatIterateFunc {
+	return func(values []interface{}, value []byte) bool {
+		entry := testIterateEntry{
+			group: *values[0].(*uint64),
+			elem:  *values[1].(*testKeyElement),
+		}
+		*entries = append(*entries, entry)
+		return true
+	}
+}
+
+func newTestIterateTree(t *testing.T) (mkvs.Tree, []testIterateEntry) {
+	ctx := context.Background()
+	tree := mkvs.New(nil, nil, node.RootTypeState)
+
+	var entries []testIterateEntry
+	for group := uint64(1); group <= 3; group++ {
+		for i := byte(0); i < 3; i++ {
+			entry := testIterateEntry{group: group, elem: testKeyElement{i, i}}
+			err := tree.Insert(ctx, testIterateKeyFmt.Encode(group, &entry.elem), []byte{i})
+			require.NoError(t, err, "Insert")
+			entries = append(entries, entry)
+		}
+	}
+
+	for _, key := range [][]byte{
+		// Keys under other prefixes.
+		{0x00, 0x01},
+		{0x02},
+		// Key that is too short.
+		{0x01, 0x00, 0x00},
+		// Keys that fail to decode.
+		testIterateKeyFmt.Encode(uint64(2), &testKeyElement{0xff, 0x00}),
+		testIterateKeyFmt.Encode(uint64(3), &testKeyElement{0xff, 0x00}),
+	} {
+		err := tree.Insert(ctx, key, []byte("malformed"))
+		require.NoError(t, err, "Insert")
+	}
+
+	return tree, entries
+}
+
+func TestIterateKeyFormat(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	tree, entries := newTestIterateTree(t)
+	defer tree.Close()
+
+	// Iterate over all keys.
+	var visited []testIterateEntry
+	skipped, err := IterateKeyFormat(ctx, tree, testIterateKeyFmt, nil, newTestIterateValues, collectTestIterateEntries(&visited))
+	require.NoError(err, "IterateKeyFormat")
+	require.Equal(entries, visited, "all entries should be visited in order")
+	require.Equal(3, skipped, "malformed keys should be skipped")
+
+	// Iterate over keys with a prefix.
+	visited = nil
+	skipped, err = IterateKeyFormat(ctx, tree, testIterateKeyFmt, []interface{}{uint64(2)}, newTestIterateValues, collectTestIterateEntries(&visited))
+	require.NoError(err, "IterateKeyFormat")
+	require.Equal(entries[3:6], visited, "entries with the prefix should be visited")
+	require.Equal(1, skipped, "malformed keys with the prefix should be skipped")
+
+	// Stop early.
+	var count int
+	_, err = IterateKeyFormat(ctx, tree, testIterateKeyFmt, nil, newTestIterateValues, func(values []interface{}, value []byte) bool {
+		count++
+		return count < 4
+	})
+	require.NoError(err, "IterateKeyFormat")
+	require.Equal(4, count, "iteration should stop when the callback returns false")
+
+	// Iterate without decoding.
+	count = 0
+	skipped, err = IterateKeyFormat(ctx, tree, testIterateKeyFmt, nil, nil, func(values []interface{}, value []byte) bool {
+		require.Empty(values, "values should not be decoded")
+		count++
+		return true
+	})
+	require.NoError(err, "IterateKeyFormat")
+	require.Equal(len(entries)+2, count, "keys that are not decoded can't fail decoding")
+	require.Equal(1, skipped, "keys that are too short should be skipped")
+}
+
+func TestIterateKeyFormatPage(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	tree, entries := newTestIterateTree(t)
+	defer tree.Close()
+
+	for _, limit := range []int{1, 2, 3, 4, len(entries), len(entries) + 1} {
+		var (
+			visited      []testIterateEntry
+			start        []byte
+			pages        int
+			totalSkipped int
+		)
+		for {
+			var pageVisited []testIterateEntry
+			next, skipped, err := IterateKeyFormatPage(ctx, tree, testIterateKeyFmt, nil, newTestIterateValues, start, limit, collectTestIterateEntries(&pageVisited))
+			require.NoError(err, "IterateKeyFormatPage")
+			require.LessOrEqual(len(pageVisited), limit, "pages should not exceed the limit")
+			visited = append(visited, pageVisited...)
+			totalSkipped += skipped
+			pages++
+
+			if next == nil {
+				break
+			}
+			require.Len(pageVisited, limit, "only the last page may be partial")
+			start = next
+		}
+		require.Equal(entries, visited, "all entries should be visited in order (limit %d)", limit)
+		require.Equal(3, totalSkipped, "each malformed key should be skipped once (limit %d)", limit)
+		require.LessOrEqual(pages, (len(entries)+limit-1)/limit+1, "number of pages (limit %d)", limit)
+	}
+
+	// Pages should respect the prefix.
+	var visited []testIterateEntry
+	next, _, err := IterateKeyFormatPage(ctx, tree, testIterateKeyFmt, []interface{}{uint64(1)}, newTestIterateValues, nil, 3, collectTestIterateEntries(&visited))
+	require.NoError(err, "IterateKeyFormatPage")
+	require.Equal(entries[:3], visited, "entries with the prefix should be visited")
+	require.Nil(next, "there should be no more entries with the prefix")
+
+	// Invalid arguments.
+	_, _, err = IterateKeyFormatPage(ctx, tree, testIterateKeyFmt, nil, newTestIterateValues, nil, 0, collectTestIterateEntries(&visited))
+	require.Error(err, "IterateKeyFormatPage should fail with an invalid limit")
+	_, _, err = IterateKeyFormatPage(ctx, tree, testIterateKeyFmt, []interface{}{uint64(1)}, newTestIterateValues, testIterateKeyFmt.Encode(uint64(2)), 1, collectTestIterateEntries(&visited))
+	require.Error(err, "IterateKeyFormatPage should fail with a continuation key outside of the range")
+}
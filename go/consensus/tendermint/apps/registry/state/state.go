@@ -6,6 +6,7 @@ import (
 
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	"github.com/oasisprotocol/oasis-core/go/common/entity"
 	"github.com/oasisprotocol/oasis-core/go/common/keyformat"
@@ -69,6 +70,12 @@ var (
 	//
 	// Value is empty.
 	runtimeByEntityKeyFmt = keyformat.New(0x19, keyformat.H(&signature.PublicKey{}), keyformat.H(&common.Namespace{}))
+	// pinnedRuntimeKeyFmt is the key format used for runtime descriptors pinned by other
+	// applications, so that they remain available after the runtime is updated.
+	//
+	// Key format is: 0x1b <H(runtime-id) (hash.Hash)> <descriptor-hash (hash.Hash)>
+	// Value is CBOR-serialized runtime.
+	pinnedRuntimeKeyFmt = keyformat.New(0x1b, keyformat.H(&common.Namespace{}), &hash.Hash{})
 )
 
 // ImmutableState is the immutable registry state wrapper.
@@ -300,6 +307,24 @@ func (s *ImmutableState) AnyRuntime(ctx context.Context, id common.Namespace) (r
 	return
 }
 
+// PinnedRuntime looks up a runtime descriptor with the given hash, previously pinned using
+// PinRuntime, and returns it.
+func (s *ImmutableState) PinnedRuntime(ctx context.Context, id common.Namespace, h hash.Hash) (*registry.Runtime, error) {
+	raw, err := s.is.Get(ctx, pinnedRuntimeKeyFmt.Encode(&id, &h))
+	if err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	if raw == nil {
+		return nil, registry.ErrNoSuchRuntime
+	}
+
+	var runtime registry.Runtime
+	if err := cbor.Unmarshal(raw, &runtime); err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	return &runtime, nil
+}
+
 func (s *ImmutableState) iterateRuntimes(
 	ctx context.Context,
 	keyFmt *keyformat.KeyFormat,
@@ -686,6 +711,34 @@ func (s *MutableState) ResumeRuntime(ctx context.Context, id common.Namespace) e
 	return abciAPI.UnavailableStateError(err)
 }
 
+// PinRuntime pins the given runtime descriptor, so that it remains available via PinnedRuntime
+// even after the runtime is updated. Any previously pinned descriptors of the same runtime are
+// unpinned.
+func (s *MutableState) PinRuntime(ctx context.Context, rt *registry.Runtime) error {
+	var toDelete [][]byte
+	_, err := abciAPI.IterateKeyFormat(ctx, s.is, pinnedRuntimeKeyFmt, []interface{}{&rt.ID},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, &hash.Hash{}} },
+		func(values []interface{}, value []byte) bool {
+			hRuntimeID, h := values[0].(*keyformat.PreHashed), values[1].(*hash.Hash)
+			toDelete = append(toDelete, pinnedRuntimeKeyFmt.Encode(hRuntimeID, h))
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range toDelete {
+		if err = s.ms.Remove(ctx, key); err != nil {
+			return abciAPI.UnavailableStateError(err)
+		}
+	}
+
+	h := hash.NewFrom(rt)
+	err = s.ms.Insert(ctx, pinnedRuntimeKeyFmt.Encode(&rt.ID, &h), cbor.Marshal(rt))
+	return abciAPI.UnavailableStateError(err)
+}
+
 // SetNodeStatus sets a status for a registered node.
 func (s *MutableState) SetNodeStatus(ctx context.Context, id signature.PublicKey, status *registry.NodeStatus) error {
 	err := s.ms.Insert(ctx, nodeStatusKeyFmt.Encode(&id), cbor.Marshal(status))
@@ -6,7 +6,9 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
@@ -160,3 +162,42 @@ func TestNodeUpdate(t *testing.T) {
 	require.Error(err, "TLS mapping should be gone")
 	require.Equal(registry.ErrNoSuchNode, err, "TLS mapping should be gone")
 }
+
+func TestPinnedRuntime(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+
+	var rt1, rt2 registry.Runtime
+	rt1.ID = common.NewTestNamespaceFromSeed([]byte("consensus/tendermint/apps/registry/state: runtime 1"), 0)
+	rt2.ID = common.NewTestNamespaceFromSeed([]byte("consensus/tendermint/apps/registry/state: runtime 2"), 0)
+	rt1Updated := rt1
+	rt1Updated.Executor.MaxMessages = 10
+
+	_, err := s.PinnedRuntime(ctx, rt1.ID, hash.NewFrom(&rt1))
+	require.ErrorIs(err, registry.ErrNoSuchRuntime, "PinnedRuntime should fail for descriptors that are not pinned")
+
+	for _, rt := range []*registry.Runtime{&rt1, &rt2} {
+		err = s.PinRuntime(ctx, rt)
+		require.NoError(err, "PinRuntime")
+		pinned, err := s.PinnedRuntime(ctx, rt.ID, hash.NewFrom(rt))
+		require.NoError(err, "PinnedRuntime")
+		require.EqualValues(rt, pinned, "pinned descriptor should be returned")
+	}
+
+	// Pinning a new descriptor should only unpin the previous descriptor of the same runtime.
+	err = s.PinRuntime(ctx, &rt1Updated)
+	require.NoError(err, "PinRuntime")
+	pinned, err := s.PinnedRuntime(ctx, rt1.ID, hash.NewFrom(&rt1Updated))
+	require.NoError(err, "PinnedRuntime")
+	require.EqualValues(&rt1Updated, pinned, "new descriptor should be pinned")
+	_, err = s.PinnedRuntime(ctx, rt1.ID, hash.NewFrom(&rt1))
+	require.ErrorIs(err, registry.ErrNoSuchRuntime, "previous descriptor should be unpinned")
+	_, err = s.PinnedRuntime(ctx, rt2.ID, hash.NewFrom(&rt2))
+	require.NoError(err, "descriptors of other runtimes should remain pinned")
+}
@@ -54,18 +54,15 @@ func (app *rootHashApplication) InitChain(ctx *abciAPI.Context, request types.Re
 }
 
 func (rq *rootHashQuerier) Genesis(ctx context.Context) (*roothashAPI.Genesis, error) {
-	runtimes, err := rq.state.Runtimes(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch runtimes: %w", err)
-	}
-
 	// Get per-runtime states.
+	var rtErr error
 	rtStates := make(map[common.Namespace]*roothashAPI.GenesisRuntimeState)
-	for _, rt := range runtimes {
+	err := rq.state.IterateRuntimes(ctx, func(rt *roothashAPI.RuntimeState) bool {
 		var lastRoundResults *roothashAPI.RoundResults
-		lastRoundResults, err = rq.LastRoundResults(ctx, rt.Runtime.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch last round results for runtime '%s': %w", rt.Runtime.ID, err)
+		lastRoundResults, rtErr = rq.LastRoundResults(ctx, rt.Runtime.ID)
+		if rtErr != nil {
+			rtErr = fmt.Errorf("failed to fetch last round results for runtime '%s': %w", rt.Runtime.ID, rtErr)
+			return false
 		}
 
 		rtState := roothashAPI.GenesisRuntimeState{
@@ -77,6 +74,13 @@ func (rq *rootHashQuerier) Genesis(ctx context.Context) (*roothashAPI.Genesis, e
 		}
 
 		rtStates[rt.Runtime.ID] = &rtState
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch runtimes: %w", err)
+	}
+	if rtErr != nil {
+		return nil, rtErr
 	}
 
 	params, err := rq.state.ConsensusParameters(ctx)
@@ -15,7 +15,9 @@ type Query interface {
 	LatestBlock(context.Context, common.Namespace) (*block.Block, error)
 	GenesisBlock(context.Context, common.Namespace) (*block.Block, error)
 	RuntimeState(context.Context, common.Namespace) (*roothash.RuntimeState, error)
+	RuntimeStateWithProof(context.Context, common.Namespace) (*roothashState.RuntimeStateProof, error)
 	LastRoundResults(context.Context, common.Namespace) (*roothash.RoundResults, error)
+	LatestRoots(context.Context, common.Namespace) (*roothash.RoundRoots, error)
 	Genesis(context.Context) (*roothash.Genesis, error)
 	ConsensusParameters(context.Context) (*roothash.ConsensusParameters, error)
 }
@@ -58,10 +60,18 @@ func (rq *rootHashQuerier) RuntimeState(ctx context.Context, id common.Namespace
 	return rq.state.RuntimeState(ctx, id)
 }
 
+func (rq *rootHashQuerier) RuntimeStateWithProof(ctx context.Context, id common.Namespace) (*roothashState.RuntimeStateProof, error) {
+	return rq.state.RuntimeStateWithProof(ctx, id)
+}
+
 func (rq *rootHashQuerier) LastRoundResults(ctx context.Context, id common.Namespace) (*roothash.RoundResults, error) {
 	return rq.state.LastRoundResults(ctx, id)
 }
 
+func (rq *rootHashQuerier) LatestRoots(ctx context.Context, id common.Namespace) (*roothash.RoundRoots, error) {
+	return rq.state.LatestRoots(ctx, id)
+}
+
 func (rq *rootHashQuerier) ConsensusParameters(ctx context.Context) (*roothash.ConsensusParameters, error) {
 	return rq.state.ConsensusParameters(ctx)
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
 	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	abciState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/abci/state"
 	tmapi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
 	registryApi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/registry/api"
 	registryState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/registry/state"
@@ -130,9 +131,17 @@ func (app *rootHashApplication) onCommitteeChanged(ctx *tmapi.Context, state *ro
 				if err = state.RemoveExpiredEvidence(ctx, rt.ID, round-params.MaxEvidenceAge); err != nil {
 					return fmt.Errorf("failed to remove expired runtime evidence: %s %w", rt.ID, err)
 				}
+				if err = state.RemoveExpiredMissedCommitments(ctx, rt.ID, round-params.MaxEvidenceAge); err != nil {
+					return fmt.Errorf("failed to remove expired missed commitments: %s %w", rt.ID, err)
+				}
 			}
 		}
 
+		// Liveness statistics are tracked per epoch.
+		if err = state.ResetLivenessStatistics(ctx, rt.ID); err != nil {
+			return fmt.Errorf("failed to reset liveness statistics: %s %w", rt.ID, err)
+		}
+
 		// Since the runtime is in the list of active runtimes in the registry we
 		// can safely clear the suspended flag.
 		rtState.Suspended = false
@@ -199,8 +208,12 @@ func (app *rootHashApplication) onCommitteeChanged(ctx *tmapi.Context, state *ro
 			rtState.ExecutorPool.Round = rtState.CurrentBlock.Header.Round
 		}
 
-		// Update the runtime descriptor to the latest per-epoch value.
+		// Update the runtime descriptor to the latest per-epoch value. As only a reference to the
+		// descriptor is stored, the executor pool always uses the same descriptor.
 		rtState.Runtime = rt
+		if rtState.ExecutorPool != nil {
+			rtState.ExecutorPool.Runtime = rt
+		}
 
 		if err = state.SetRuntimeState(ctx, rtState); err != nil {
 			return fmt.Errorf("failed to set runtime state: %w", err)
@@ -655,6 +668,13 @@ func (app *rootHashApplication) tryFinalizeExecutorCommits(
 			return fmt.Errorf("failed to set last round results: %w", err)
 		}
 
+		if err = updateLivenessStatistics(ctx, state, rtState, commitments); err != nil {
+			return err
+		}
+		if err = recordMissedCommitments(ctx, state, rtState, commitments, round); err != nil {
+			return err
+		}
+
 		tagV := ValueFinalized{
 			ID: rtState.Runtime.ID,
 			Event: roothash.FinalizedEvent{
@@ -688,6 +708,16 @@ func (app *rootHashApplication) tryFinalizeExecutorCommits(
 		logging.LogEvent, roothash.LogEventRoundFailed,
 	)
 
+	// Failed and timed out rounds count towards liveness as well, as otherwise primary workers
+	// which never commit would not be penalized.
+	state := roothashState.NewMutableState(ctx.State())
+	if err := updateLivenessStatistics(ctx, state, rtState, pool.ExecuteCommitments); err != nil {
+		return err
+	}
+	if err := recordMissedCommitments(ctx, state, rtState, pool.ExecuteCommitments, round); err != nil {
+		return err
+	}
+
 	if err := app.emitEmptyBlock(ctx, rtState, block.RoundFailed); err != nil {
 		return fmt.Errorf("failed to emit empty block: %w", err)
 	}
@@ -695,6 +725,81 @@ func (app *rootHashApplication) tryFinalizeExecutorCommits(
 	return nil
 }
 
+// updateLivenessStatistics updates the liveness statistics of the executor committee members
+// based on the given commitments. Primary workers are expected to commit in every round while
+// backup workers are only credited when they actually did.
+func updateLivenessStatistics(
+	ctx *tmapi.Context,
+	state *roothashState.MutableState,
+	rtState *roothash.RuntimeState,
+	commitments map[signature.PublicKey]*commitment.ExecutorCommitment,
+) error {
+	pool := rtState.ExecutorPool
+	if pool == nil || pool.Committee == nil {
+		return nil
+	}
+
+	var participated, missed []signature.PublicKey
+	seen := make(map[signature.PublicKey]bool)
+	for _, n := range pool.Committee.Members {
+		if seen[n.PublicKey] {
+			continue
+		}
+		if _, ok := commitments[n.PublicKey]; ok {
+			seen[n.PublicKey] = true
+			participated = append(participated, n.PublicKey)
+			continue
+		}
+		if n.Role == scheduler.RoleWorker {
+			seen[n.PublicKey] = true
+			missed = append(missed, n.PublicKey)
+		}
+	}
+	if err := state.IncrementLivenessStatistics(ctx, rtState.Runtime.ID, participated, missed); err != nil {
+		return fmt.Errorf("failed to update liveness statistics: %w", err)
+	}
+	return nil
+}
+
+// recordMissedCommitments records the primary workers of the executor committee that did not
+// submit any of the given commitments in the given round.
+func recordMissedCommitments(
+	ctx *tmapi.Context,
+	state *roothashState.MutableState,
+	rtState *roothash.RuntimeState,
+	commitments map[signature.PublicKey]*commitment.ExecutorCommitment,
+	round uint64,
+) error {
+	pool := rtState.ExecutorPool
+	if pool == nil || pool.Committee == nil {
+		return nil
+	}
+
+	// Nodes may be members of the committee in multiple roles, so make sure to only include them
+	// once and to consider them as missing in case any of their roles is a primary worker.
+	var (
+		members []signature.PublicKey
+		missed  []signature.PublicKey
+	)
+	workers := make(map[signature.PublicKey]bool)
+	for _, n := range pool.Committee.Members {
+		if _, ok := workers[n.PublicKey]; !ok {
+			members = append(members, n.PublicKey)
+		}
+		workers[n.PublicKey] = workers[n.PublicKey] || n.Role == scheduler.RoleWorker
+	}
+	for _, member := range members {
+		if _, ok := commitments[member]; !ok && workers[member] {
+			missed = append(missed, member)
+		}
+	}
+
+	if err := state.SetMissedCommitments(ctx, rtState.Runtime.ID, round, pool.Committee.ValidFor, members, missed); err != nil {
+		return fmt.Errorf("failed to record missed commitments: %w", err)
+	}
+	return nil
+}
+
 func (app *rootHashApplication) tryFinalizeBlock(
 	ctx *tmapi.Context,
 	rtState *roothash.RuntimeState,
@@ -743,3 +848,7 @@ func (app *rootHashApplication) tryFinalizeBlock(
 func New() tmapi.Application {
 	return &rootHashApplication{}
 }
+
+func init() {
+	abciState.RegisterMigrations(AppName, roothashState.Migrations...)
+}
@@ -0,0 +1,134 @@
+package roothash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	roothashState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/roothash/state"
+	registry "github.com/oasisprotocol/oasis-core/go/registry/api"
+	roothash "github.com/oasisprotocol/oasis-core/go/roothash/api"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/block"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/commitment"
+	scheduler "github.com/oasisprotocol/oasis-core/go/scheduler/api"
+)
+
+func TestRecordMissedCommitments(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer ctx.Close()
+
+	state := roothashState.NewMutableState(ctx.State())
+
+	runtimeID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/roothash_test: runtime"), 0)
+	worker1 := memorySigner.NewTestSigner("apps/roothash/roothash_test: worker1").Public()
+	worker2 := memorySigner.NewTestSigner("apps/roothash/roothash_test: worker2").Public()
+	backup := memorySigner.NewTestSigner("apps/roothash/roothash_test: backup").Public()
+	both := memorySigner.NewTestSigner("apps/roothash/roothash_test: both").Public()
+
+	rtState := &roothash.RuntimeState{
+		Runtime: &registry.Runtime{ID: runtimeID},
+		ExecutorPool: &commitment.Pool{
+			Committee: &scheduler.Committee{
+				Kind: scheduler.KindComputeExecutor,
+				Members: []*scheduler.CommitteeNode{
+					{Role: scheduler.RoleWorker, PublicKey: worker1},
+					{Role: scheduler.RoleWorker, PublicKey: worker2},
+					{Role: scheduler.RoleBackupWorker, PublicKey: both},
+					{Role: scheduler.RoleWorker, PublicKey: both},
+					{Role: scheduler.RoleBackupWorker, PublicKey: backup},
+				},
+				RuntimeID: runtimeID,
+				ValidFor:  1,
+			},
+		},
+	}
+
+	// Only primary workers without a commitment should be recorded as missing, while backup
+	// workers are not expected to commit.
+	err := recordMissedCommitments(ctx, state, rtState, map[signature.PublicKey]*commitment.ExecutorCommitment{
+		worker1: {},
+	}, 5)
+	require.NoError(err, "recordMissedCommitments")
+
+	missed, err := state.MissedCommitments(ctx, runtimeID, 5)
+	require.NoError(err, "MissedCommitments")
+	require.EqualValues(map[signature.PublicKey]bool{
+		worker1: false,
+		worker2: true,
+		both:    true,
+		backup:  false,
+	}, missed)
+
+	// Runtimes without an executor committee should be ignored.
+	rtState.ExecutorPool = nil
+	err = recordMissedCommitments(ctx, state, rtState, nil, 6)
+	require.NoError(err, "recordMissedCommitments")
+	missed, err = state.MissedCommitments(ctx, runtimeID, 6)
+	require.NoError(err, "MissedCommitments")
+	require.Nil(missed, "no missed commitments should be recorded without a committee")
+}
+
+func TestLivenessStatisticsRoundTimeout(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer ctx.Close()
+
+	state := roothashState.NewMutableState(ctx.State())
+	app := &rootHashApplication{state: appState}
+
+	runtimeID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/roothash_test: runtime"), 0)
+	worker1 := memorySigner.NewTestSigner("apps/roothash/roothash_test: worker1").Public()
+	worker2 := memorySigner.NewTestSigner("apps/roothash/roothash_test: worker2").Public()
+	backup := memorySigner.NewTestSigner("apps/roothash/roothash_test: backup").Public()
+
+	runtime := &registry.Runtime{
+		ID: runtimeID,
+		Executor: registry.ExecutorParameters{
+			RoundTimeout: 10,
+		},
+	}
+	rtState := &roothash.RuntimeState{
+		Runtime:      runtime,
+		CurrentBlock: block.NewGenesisBlock(runtimeID, 0),
+		ExecutorPool: &commitment.Pool{
+			Runtime: runtime,
+			Committee: &scheduler.Committee{
+				Kind: scheduler.KindComputeExecutor,
+				Members: []*scheduler.CommitteeNode{
+					{Role: scheduler.RoleWorker, PublicKey: worker1},
+					{Role: scheduler.RoleWorker, PublicKey: worker2},
+					{Role: scheduler.RoleBackupWorker, PublicKey: backup},
+				},
+				RuntimeID: runtimeID,
+				ValidFor:  1,
+			},
+			Round:       1,
+			NextTimeout: commitment.TimeoutNever,
+		},
+	}
+
+	// A round timeout without any commitments should fail the round and count it as missed for
+	// all primary workers.
+	err := app.tryFinalizeBlock(ctx, rtState, true)
+	require.NoError(err, "tryFinalizeBlock")
+	require.EqualValues(block.RoundFailed, rtState.CurrentBlock.Header.HeaderType, "round should fail")
+
+	stats, err := state.LivenessStatistics(ctx, runtimeID)
+	require.NoError(err, "LivenessStatistics")
+	require.EqualValues(map[signature.PublicKey]*roothash.NodeLivenessStatistics{
+		worker1: {RoundsMissed: 1},
+		worker2: {RoundsMissed: 1},
+	}, stats)
+}
@@ -0,0 +1,235 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	registry "github.com/oasisprotocol/oasis-core/go/registry/api"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/block"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/commitment"
+	scheduler "github.com/oasisprotocol/oasis-core/go/scheduler/api"
+)
+
+// encodingTestVector is a golden test vector for the encoding of a value stored in the roothash
+// consensus state.
+type encodingTestVector struct {
+	Name  string `json:"name"`
+	Key   []byte `json:"key,omitempty"`
+	Value []byte `json:"value"`
+}
+
+// encodingTestVectors are the golden test vectors for the roothash consensus state encoding.
+type encodingTestVectors struct {
+	RuntimeStates       []encodingTestVector `json:"runtime_states"`
+	ConsensusParameters []encodingTestVector `json:"consensus_parameters"`
+}
+
+func loadEncodingTestVectors(t *testing.T) *encodingTestVectors {
+	data, err := os.ReadFile(filepath.Join("testdata", "encoding_vectors.json"))
+	require.NoError(t, err, "failed to read test vectors")
+
+	var vectors encodingTestVectors
+	err = json.Unmarshal(data, &vectors)
+	require.NoError(t, err, "failed to unmarshal test vectors")
+	return &vectors
+}
+
+// encodingTestRuntimeStates returns the runtime states corresponding to the golden test vectors.
+//
+// The runtime descriptors are part of the runtime states but are not stored.
+func encodingTestRuntimeStates() map[string]*api.RuntimeState {
+	runtimeID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state: encoding vectors"), 0)
+	nodeSigner := memorySigner.NewTestSigner("apps/roothash/state: encoding vectors node")
+	nodeID := nodeSigner.Public()
+
+	var runtime registry.Runtime
+	runtime.ID = runtimeID
+	runtime.Kind = registry.KindCompute
+	runtime.Executor.GroupSize = 1
+	runtime.Executor.RoundTimeout = 5
+	runtime.Executor.MaxMessages = 10
+
+	genesisBlock := block.NewGenesisBlock(runtimeID, 1580461674)
+	currentBlock := block.NewEmptyBlock(genesisBlock, 1580461680, block.Normal)
+	currentBlock.Header.StateRoot = hash.NewFromBytes([]byte("state root"))
+	currentBlock.Header.IORoot = hash.NewFromBytes([]byte("io root"))
+
+	committee := &scheduler.Committee{
+		Kind: scheduler.KindComputeExecutor,
+		Members: []*scheduler.CommitteeNode{
+			{Role: scheduler.RoleWorker, PublicKey: nodeID},
+		},
+		RuntimeID: runtimeID,
+		ValidFor:  42,
+	}
+
+	stateRoot := hash.NewFromBytes([]byte("next state root"))
+	ioRoot := hash.NewFromBytes([]byte("next io root"))
+	messagesHash := hash.NewFromBytes([]byte("messages"))
+	commit := &commitment.ExecutorCommitment{
+		NodeID: nodeID,
+		Header: commitment.ExecutorCommitmentHeader{
+			ComputeResultsHeader: commitment.ComputeResultsHeader{
+				Round:        currentBlock.Header.Round + 1,
+				PreviousHash: currentBlock.Header.EncodedHash(),
+				IORoot:       &ioRoot,
+				StateRoot:    &stateRoot,
+				MessagesHash: &messagesHash,
+			},
+		},
+	}
+	// The signature is never verified when decoding state, so it only needs to be well-formed.
+	copy(commit.Signature[:], []byte("not a real executor commitment signature"))
+
+	return map[string]*api.RuntimeState{
+		// Runtime state without any blocks or executor pool.
+		"Minimal": {
+			RuntimeID:      runtimeID,
+			DescriptorHash: hash.NewFromBytes([]byte("descriptor")),
+		},
+		// Runtime state as set up at genesis, before any rounds.
+		"NilExecutorPool": {
+			Runtime:            &runtime,
+			GenesisBlock:       genesisBlock,
+			CurrentBlock:       genesisBlock,
+			CurrentBlockHeight: 1,
+		},
+		// Runtime state with an executor pool without a round or a scheduled timeout.
+		"IdleExecutorPool": {
+			Runtime:            &runtime,
+			GenesisBlock:       genesisBlock,
+			CurrentBlock:       currentBlock,
+			CurrentBlockHeight: 10,
+			LastNormalRound:    currentBlock.Header.Round,
+			LastNormalHeight:   10,
+			ExecutorPool: &commitment.Pool{
+				Runtime: &runtime,
+			},
+		},
+		// Runtime state with an executor pool collecting commitments for a round with a
+		// scheduled timeout.
+		"ActiveExecutorPool": {
+			Runtime:            &runtime,
+			GenesisBlock:       genesisBlock,
+			CurrentBlock:       currentBlock,
+			CurrentBlockHeight: 10,
+			LastNormalRound:    currentBlock.Header.Round,
+			LastNormalHeight:   10,
+			ExecutorPool: &commitment.Pool{
+				Runtime:   &runtime,
+				Committee: committee,
+				Round:     currentBlock.Header.Round + 1,
+				ExecuteCommitments: map[signature.PublicKey]*commitment.ExecutorCommitment{
+					nodeID: commit,
+				},
+				Discrepancy: true,
+				NextTimeout: 15,
+			},
+		},
+		// Suspended runtime state.
+		"Suspended": {
+			Runtime:            &runtime,
+			Suspended:          true,
+			GenesisBlock:       genesisBlock,
+			CurrentBlock:       currentBlock,
+			CurrentBlockHeight: 20,
+			LastNormalRound:    currentBlock.Header.Round,
+			LastNormalHeight:   10,
+			ExecutorPool: &commitment.Pool{
+				Runtime:   &runtime,
+				Committee: committee,
+				Round:     currentBlock.Header.Round + 1,
+			},
+		},
+	}
+}
+
+// encodingTestConsensusParameters returns the consensus parameters corresponding to the golden
+// test vectors.
+func encodingTestConsensusParameters() map[string]*api.ConsensusParameters {
+	return map[string]*api.ConsensusParameters{
+		"Empty": {},
+		"Default": {
+			GasCosts:                   api.DefaultGasCosts,
+			MaxRuntimeMessages:         256,
+			MaxRuntimeMessageQueueSize: 1024,
+			MaxEvidenceAge:             100,
+		},
+		"Debug": {
+			GasCosts: transaction.Costs{
+				api.GasOpComputeCommit: 1,
+			},
+			DebugDoNotSuspendRuntimes: true,
+			DebugBypassStake:          true,
+			MaxRuntimeMessages:        1,
+		},
+	}
+}
+
+func TestRuntimeStateEncodingVectors(t *testing.T) {
+	vectors := loadEncodingTestVectors(t)
+	states := encodingTestRuntimeStates()
+	require.Len(t, vectors.RuntimeStates, len(states), "all runtime states should have test vectors")
+
+	for _, v := range vectors.RuntimeStates {
+		t.Run(v.Name, func(t *testing.T) {
+			require := require.New(t)
+
+			state, ok := states[v.Name]
+			require.True(ok, "runtime state should exist")
+
+			// The runtime state encoding is consensus-critical as it is part of the consensus
+			// state. If this fails, the encoding has changed in an incompatible way and the test
+			// vectors need to be explicitly updated as part of a consensus-breaking change.
+			key, value := RuntimeStateKeyValue(state)
+			require.Equal(v.Key, key, "runtime state key MUST NOT change")
+			require.Equal(v.Value, value, "runtime state encoding MUST NOT change")
+
+			var decoded api.RuntimeState
+			err := cbor.Unmarshal(v.Value, &decoded)
+			require.NoError(err, "Unmarshal")
+			require.Equal(v.Value, cbor.Marshal(&decoded), "re-encoding should be byte-identical")
+
+			// Re-encoding the decoded state should result in the same key and value.
+			key, value = RuntimeStateKeyValue(&decoded)
+			require.Equal(v.Key, key, "re-encoded runtime state key should be the same")
+			require.Equal(v.Value, value, "re-encoded runtime state should be the same")
+		})
+	}
+}
+
+func TestConsensusParametersEncodingVectors(t *testing.T) {
+	vectors := loadEncodingTestVectors(t)
+	params := encodingTestConsensusParameters()
+	require.Len(t, vectors.ConsensusParameters, len(params), "all consensus parameters should have test vectors")
+
+	for _, v := range vectors.ConsensusParameters {
+		t.Run(v.Name, func(t *testing.T) {
+			require := require.New(t)
+
+			p, ok := params[v.Name]
+			require.True(ok, "consensus parameters should exist")
+
+			// The consensus parameters encoding is consensus-critical as they are part of the
+			// consensus state.
+			require.Equal(v.Value, cbor.Marshal(p), "consensus parameters encoding MUST NOT change")
+
+			var decoded api.ConsensusParameters
+			err := cbor.Unmarshal(v.Value, &decoded)
+			require.NoError(err, "Unmarshal")
+			require.Equal(v.Value, cbor.Marshal(&decoded), "re-encoding should be byte-identical")
+			require.EqualValues(p, &decoded, "decoded consensus parameters should be equal")
+		})
+	}
+}
@@ -1,22 +1,34 @@
 package state
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	"github.com/oasisprotocol/oasis-core/go/common/keyformat"
+	abciState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/abci/state"
 	"github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	registryState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/registry/state"
+	registry "github.com/oasisprotocol/oasis-core/go/registry/api"
 	roothash "github.com/oasisprotocol/oasis-core/go/roothash/api"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/message"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
 )
 
 var (
+	_ DescriptorResolver = (*registryState.ImmutableState)(nil)
+
 	// runtimeKeyFmt is the key format used for per-runtime roothash state.
 	//
-	// Value is CBOR-serialized roothash.RuntimeState.
+	// Value is CBOR-serialized roothash.RuntimeState, without the runtime descriptor.
 	runtimeKeyFmt = keyformat.New(0x20, keyformat.H(&common.Namespace{}))
 	// parametersKeyFmt is the key format used for consensus parameters.
 	//
@@ -42,11 +54,74 @@ var (
 	//
 	// Value is CBOR-serialized roothash.RoundResults.
 	lastRoundResultsKeyFmt = keyformat.New(0x27, keyformat.H(&common.Namespace{}))
+	// livenessKeyFmt is the key format used for per-node liveness statistics of runtime
+	// committee members.
+	//
+	// Key format is: 0x28 <H(runtime-id) (hash.Hash)> <node-id (signature.PublicKey)>
+	// Value is CBOR-serialized roothash.NodeLivenessStatistics.
+	livenessKeyFmt = keyformat.New(0x28, keyformat.H(&common.Namespace{}), &signature.PublicKey{})
+	// messageQueueKeyFmt is the key format used for per-runtime message queues.
+	//
+	// Key format is: 0x29 <H(runtime-id) (hash.Hash)> <sequence (uint64)>
+	// Value is CBOR-serialized message.Message.
+	messageQueueKeyFmt = keyformat.New(0x29, keyformat.H(&common.Namespace{}), uint64(0))
+	// messageQueueMetaKeyFmt is the key format used for per-runtime message queue metadata.
+	//
+	// Value is CBOR-serialized messageQueueMeta.
+	messageQueueMetaKeyFmt = keyformat.New(0x2a, keyformat.H(&common.Namespace{}))
+	// missedCommitmentsKeyFmt is the key format used for per-round records of executor committee
+	// members that failed to commit.
+	//
+	// Key format is: 0x2b <H(runtime-id) (hash.Hash)> <round (uint64)>
+	// Value is CBOR-serialized missedCommitments.
+	missedCommitmentsKeyFmt = keyformat.New(0x2b, keyformat.H(&common.Namespace{}), uint64(0))
+	// committeeMembersKeyFmt is the key format used for the executor committee membership that
+	// missed commitment records refer to.
+	//
+	// Key format is: 0x2c <H(runtime-id) (hash.Hash)> <epoch (beacon.EpochTime)>
+	// Value is CBOR-serialized list of committee member public keys.
+	committeeMembersKeyFmt = keyformat.New(0x2c, keyformat.H(&common.Namespace{}), uint64(0))
 )
 
+// messageQueueMeta is the per-runtime message queue metadata.
+type messageQueueMeta struct {
+	// Size is the number of messages currently in the queue.
+	Size uint32 `json:"size"`
+	// NextSequence is the sequence number assigned to the next enqueued message.
+	NextSequence uint64 `json:"next_sequence"`
+}
+
+// missedCommitments is the per-round record of executor committee members that failed to commit.
+type missedCommitments struct {
+	// Epoch is the epoch of the committee membership the bitmap refers to.
+	Epoch beacon.EpochTime `json:"epoch"`
+	// Bitmap has bit i%64 of word i/64 set iff the i-th committee member failed to commit.
+	Bitmap []uint64 `json:"bitmap"`
+}
+
+func newMissedCommitmentsBitmap(members int) []uint64 {
+	return make([]uint64, (members+63)/64)
+}
+
+func setMissedCommitment(bitmap []uint64, idx int) {
+	bitmap[idx/64] |= 1 << (idx % 64)
+}
+
+func isMissedCommitment(bitmap []uint64, idx int) bool {
+	return bitmap[idx/64]&(1<<(idx%64)) != 0
+}
+
+// DescriptorResolver resolves the registry runtime descriptors referenced by runtime states.
+type DescriptorResolver interface {
+	// PinnedRuntime returns the runtime descriptor with the given hash.
+	PinnedRuntime(ctx context.Context, id common.Namespace, h hash.Hash) (*registry.Runtime, error)
+}
+
 // ImmutableState is the immutable roothash state wrapper.
 type ImmutableState struct {
 	is *api.ImmutableState
+
+	resolver DescriptorResolver
 }
 
 func NewImmutableState(ctx context.Context, state api.ApplicationQueryState, version int64) (*ImmutableState, error) {
@@ -54,38 +129,67 @@ func NewImmutableState(ctx context.Context, state api.ApplicationQueryState, ver
 	if err != nil {
 		return nil, err
 	}
+	regState, err := registryState.NewImmutableState(ctx, state, version)
+	if err != nil {
+		return nil, err
+	}
 
-	return &ImmutableState{is}, nil
+	return &ImmutableState{is, regState}, nil
 }
 
-func (s *ImmutableState) runtimesWithRoundTimeouts(ctx context.Context, height *int64) ([]common.Namespace, []int64, error) {
-	it := s.is.NewIterator(ctx)
-	defer it.Close()
-
-	var startKey []byte
-	if height == nil {
-		startKey = roundTimeoutQueueKeyFmt.Encode()
-	} else {
-		startKey = roundTimeoutQueueKeyFmt.Encode(height)
-	}
-
-	var runtimeIDs []common.Namespace
-	var heights []int64
-	for it.Seek(startKey); it.Valid(); it.Next() {
-		var decHeight int64
-		if !roundTimeoutQueueKeyFmt.Decode(it.Key(), &decHeight) || (height != nil && decHeight != *height) {
-			break
+// resolveRuntime resolves the runtime descriptor referenced by the given runtime state.
+func (s *ImmutableState) resolveRuntime(ctx context.Context, state *roothash.RuntimeState) error {
+	// Runtime states stored before descriptors were stored by reference embed the descriptor.
+	if state.Runtime == nil {
+		rt, err := s.resolver.PinnedRuntime(ctx, state.RuntimeID, state.DescriptorHash)
+		switch {
+		case err == nil:
+		case errors.Is(err, registry.ErrNoSuchRuntime):
+			return fmt.Errorf("%w: runtime %s, descriptor %s",
+				roothash.ErrRuntimeDescriptorNotFound, state.RuntimeID, state.DescriptorHash,
+			)
+		default:
+			return err
 		}
+		state.Runtime = rt
+	}
+	if state.ExecutorPool != nil {
+		state.ExecutorPool.Runtime = state.Runtime
+	}
+	return nil
+}
 
-		var runtimeID common.Namespace
-		if err := runtimeID.UnmarshalBinary(it.Value()); err != nil {
-			return nil, nil, api.UnavailableStateError(err)
-		}
+func (s *ImmutableState) runtimesWithRoundTimeouts(ctx context.Context, height *int64) ([]common.Namespace, []int64, error) {
+	var prefix []interface{}
+	if height != nil {
+		prefix = []interface{}{height}
+	}
 
-		runtimeIDs = append(runtimeIDs, runtimeID)
-		if height == nil {
-			heights = append(heights, decHeight)
-		}
+	var (
+		runtimeIDs []common.Namespace
+		heights    []int64
+		err        error
+	)
+	_, iterErr := api.IterateKeyFormat(ctx, s.is, roundTimeoutQueueKeyFmt, prefix,
+		func() []interface{} { return []interface{}{new(int64)} },
+		func(values []interface{}, value []byte) bool {
+			var runtimeID common.Namespace
+			if err = runtimeID.UnmarshalBinary(value); err != nil {
+				return false
+			}
+
+			runtimeIDs = append(runtimeIDs, runtimeID)
+			if height == nil {
+				heights = append(heights, *values[0].(*int64))
+			}
+			return true
+		},
+	)
+	if iterErr != nil {
+		return nil, nil, iterErr
+	}
+	if err != nil {
+		return nil, nil, api.UnavailableStateError(err)
 	}
 	return runtimeIDs, heights, nil
 }
@@ -104,6 +208,9 @@ func (s *ImmutableState) RuntimesWithRoundTimeoutsAny(ctx context.Context) ([]co
 }
 
 // RuntimeState returns the roothash runtime state for a specific runtime.
+//
+// In case the referenced runtime descriptor no longer exists, an error wrapping
+// roothash.ErrRuntimeDescriptorNotFound is returned.
 func (s *ImmutableState) RuntimeState(ctx context.Context, id common.Namespace) (*roothash.RuntimeState, error) {
 	raw, err := s.is.Get(ctx, runtimeKeyFmt.Encode(&id))
 	if err != nil {
@@ -117,6 +224,73 @@ func (s *ImmutableState) RuntimeState(ctx context.Context, id common.Namespace)
 	if err = cbor.Unmarshal(raw, &state); err != nil {
 		return nil, api.UnavailableStateError(err)
 	}
+	if err = s.resolveRuntime(ctx, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// RuntimeStateProof is a roothash runtime state together with a proof of its inclusion in the
+// consensus state.
+type RuntimeStateProof struct {
+	// RawState is the CBOR-serialized runtime state as stored in the consensus state.
+	RawState []byte `json:"raw_state"`
+	// Proof is the proof of inclusion anchored at the consensus state root.
+	Proof syncer.Proof `json:"proof"`
+}
+
+// runtimeStateRange returns the key range containing exactly the runtime state key of the given
+// runtime.
+func runtimeStateRange(id common.Namespace) ([]byte, []byte) {
+	key := runtimeKeyFmt.Encode(&id)
+	return key, append(key[:len(key):len(key)], 0x00)
+}
+
+// RuntimeStateWithProof returns the roothash runtime state for a specific runtime together with
+// a proof of its inclusion in the consensus state, which can be checked against the state root
+// using VerifyRuntimeStateProof.
+func (s *ImmutableState) RuntimeStateWithProof(ctx context.Context, id common.Namespace) (*RuntimeStateProof, error) {
+	tree, ok := s.is.ImmutableKeyValueTree.(mkvs.Tree)
+	if !ok {
+		return nil, fmt.Errorf("roothash: state does not support proofs")
+	}
+
+	startKey, endKey := runtimeStateRange(id)
+	kvs, proof, err := tree.GetRangeWithProof(ctx, startKey, endKey, 1)
+	if err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	if len(kvs) == 0 {
+		return nil, roothash.ErrInvalidRuntime
+	}
+
+	return &RuntimeStateProof{
+		RawState: kvs[0].Value,
+		Proof:    *proof,
+	}, nil
+}
+
+// VerifyRuntimeStateProof verifies that the given proven runtime state is the roothash runtime
+// state of the given runtime in the consensus state with the given state root and returns the
+// decoded runtime state.
+//
+// The runtime descriptor of the returned runtime state is not resolved.
+func VerifyRuntimeStateProof(
+	ctx context.Context,
+	stateRoot hash.Hash,
+	id common.Namespace,
+	p *RuntimeStateProof,
+) (*roothash.RuntimeState, error) {
+	startKey, endKey := runtimeStateRange(id)
+	kvs := []mkvs.KeyValue{{Key: startKey, Value: p.RawState}}
+	if err := mkvs.VerifyRangeProof(ctx, node.Root{Hash: stateRoot}, startKey, endKey, kvs, &p.Proof); err != nil {
+		return nil, fmt.Errorf("roothash: bad runtime state proof: %w", err)
+	}
+
+	var state roothash.RuntimeState
+	if err := cbor.Unmarshal(p.RawState, &state); err != nil {
+		return nil, fmt.Errorf("roothash: malformed runtime state: %w", err)
+	}
 	return &state, nil
 }
 
@@ -137,6 +311,31 @@ func (s *ImmutableState) LastRoundResults(ctx context.Context, id common.Namespa
 	return &results, nil
 }
 
+// LivenessStatistics returns the liveness statistics of all committee members of a specific
+// runtime in the current epoch.
+func (s *ImmutableState) LivenessStatistics(ctx context.Context, id common.Namespace) (map[signature.PublicKey]*roothash.NodeLivenessStatistics, error) {
+	var err error
+	stats := make(map[signature.PublicKey]*roothash.NodeLivenessStatistics)
+	_, iterErr := api.IterateKeyFormat(ctx, s.is, livenessKeyFmt, []interface{}{&id},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, &signature.PublicKey{}} },
+		func(values []interface{}, value []byte) bool {
+			var nodeStats roothash.NodeLivenessStatistics
+			if err = cbor.Unmarshal(value, &nodeStats); err != nil {
+				return false
+			}
+			stats[*values[1].(*signature.PublicKey)] = &nodeStats
+			return true
+		},
+	)
+	if iterErr != nil {
+		return nil, iterErr
+	}
+	if err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	return stats, nil
+}
+
 func (s *ImmutableState) getRoot(ctx context.Context, id common.Namespace, kf *keyformat.KeyFormat) (hash.Hash, error) {
 	raw, err := s.is.Get(ctx, kf.Encode(&id))
 	if err != nil {
@@ -158,33 +357,87 @@ func (s *ImmutableState) StateRoot(ctx context.Context, id common.Namespace) (ha
 	return s.getRoot(ctx, id, stateRootKeyFmt)
 }
 
-// IORoot returns the state root for a specific runtime.
+// IORoot returns the I/O root for a specific runtime.
 func (s *ImmutableState) IORoot(ctx context.Context, id common.Namespace) (hash.Hash, error) {
 	return s.getRoot(ctx, id, ioRootKeyFmt)
 }
 
+// LatestRoots returns the state and I/O roots of the latest round for a specific runtime.
+//
+// This is equivalent to reading the roots from the header of the current block, but avoids
+// decoding the full runtime state.
+func (s *ImmutableState) LatestRoots(ctx context.Context, id common.Namespace) (*roothash.RoundRoots, error) {
+	stateRoot, err := s.StateRoot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ioRoot, err := s.IORoot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &roothash.RoundRoots{
+		StateRoot: stateRoot,
+		IORoot:    ioRoot,
+	}, nil
+}
+
 // Runtimes returns the list of all roothash runtime states.
 func (s *ImmutableState) Runtimes(ctx context.Context) ([]*roothash.RuntimeState, error) {
-	it := s.is.NewIterator(ctx)
-	defer it.Close()
-
 	var runtimes []*roothash.RuntimeState
-	for it.Seek(runtimeKeyFmt.Encode()); it.Valid(); it.Next() {
-		if !runtimeKeyFmt.Decode(it.Key()) {
-			break
-		}
-
-		var state roothash.RuntimeState
-		if err := cbor.Unmarshal(it.Value(), &state); err != nil {
-			return nil, api.UnavailableStateError(err)
-		}
+	if err := s.IterateRuntimes(ctx, func(state *roothash.RuntimeState) bool {
+		runtimes = append(runtimes, state)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return runtimes, nil
+}
 
-		runtimes = append(runtimes, &state)
+// IterateRuntimes calls fn for the roothash runtime state of each runtime, in the same order as
+// returned by Runtimes. States are decoded one at a time, so only the states retained by fn are
+// kept in memory.
+//
+// Returning false from fn stops the iteration.
+func (s *ImmutableState) IterateRuntimes(ctx context.Context, fn func(*roothash.RuntimeState) bool) error {
+	var (
+		err        error
+		resolveErr error
+	)
+	_, iterErr := api.IterateKeyFormat(ctx, s.is, runtimeKeyFmt, nil, nil,
+		func(values []interface{}, value []byte) bool {
+			var state roothash.RuntimeState
+			if err = cbor.Unmarshal(value, &state); err != nil {
+				return false
+			}
+			if resolveErr = s.resolveRuntime(ctx, &state); resolveErr != nil {
+				return false
+			}
+			return fn(&state)
+		},
+	)
+	if iterErr != nil {
+		return iterErr
+	}
+	if err != nil {
+		return api.UnavailableStateError(err)
 	}
-	if it.Err() != nil {
-		return nil, api.UnavailableStateError(it.Err())
+	return resolveErr
+}
+
+// RuntimeCount returns the number of runtimes with roothash runtime state, without decoding any
+// of the states.
+func (s *ImmutableState) RuntimeCount(ctx context.Context) (int, error) {
+	var count int
+	_, err := api.IterateKeyFormat(ctx, s.is, runtimeKeyFmt, nil, nil,
+		func(values []interface{}, value []byte) bool {
+			count++
+			return true
+		},
+	)
+	if err != nil {
+		return 0, err
 	}
-	return runtimes, nil
+	return count, nil
 }
 
 // ConsensusParameters returns the roothash consensus parameters.
@@ -210,42 +463,200 @@ func (s *ImmutableState) EvidenceHashExists(ctx context.Context, runtimeID commo
 	return data != nil, api.UnavailableStateError(err)
 }
 
+func (s *ImmutableState) messageQueueMeta(ctx context.Context, runtimeID common.Namespace) (*messageQueueMeta, error) {
+	raw, err := s.is.Get(ctx, messageQueueMetaKeyFmt.Encode(&runtimeID))
+	if err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+
+	var meta messageQueueMeta
+	if raw == nil {
+		return &meta, nil
+	}
+	if err = cbor.Unmarshal(raw, &meta); err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	return &meta, nil
+}
+
+// MessageQueueSize returns the number of messages in the message queue of a specific runtime.
+func (s *ImmutableState) MessageQueueSize(ctx context.Context, runtimeID common.Namespace) (uint32, error) {
+	meta, err := s.messageQueueMeta(ctx, runtimeID)
+	if err != nil {
+		return 0, err
+	}
+	return meta.Size, nil
+}
+
+// MissedCommitments returns the executor committee members of a specific runtime in the given
+// round, mapped to whether they failed to commit.
+//
+// In case there is no record for the round (e.g., because it has already expired), nil is
+// returned.
+func (s *ImmutableState) MissedCommitments(ctx context.Context, runtimeID common.Namespace, round uint64) (map[signature.PublicKey]bool, error) {
+	raw, err := s.is.Get(ctx, missedCommitmentsKeyFmt.Encode(&runtimeID, round))
+	if err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var mc missedCommitments
+	if err = cbor.Unmarshal(raw, &mc); err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	members, err := s.committeeMembers(ctx, runtimeID, mc.Epoch)
+	if err != nil {
+		return nil, err
+	}
+	if len(mc.Bitmap) != len(newMissedCommitmentsBitmap(len(members))) {
+		return nil, api.UnavailableStateError(fmt.Errorf("missed commitments bitmap does not match committee of %d members", len(members)))
+	}
+
+	missed := make(map[signature.PublicKey]bool, len(members))
+	for idx, member := range members {
+		missed[member] = isMissedCommitment(mc.Bitmap, idx)
+	}
+	return missed, nil
+}
+
+func (s *ImmutableState) committeeMembers(ctx context.Context, runtimeID common.Namespace, epoch beacon.EpochTime) ([]signature.PublicKey, error) {
+	raw, err := s.is.Get(ctx, committeeMembersKeyFmt.Encode(&runtimeID, uint64(epoch)))
+	if err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	if raw == nil {
+		return nil, api.UnavailableStateError(fmt.Errorf("missing committee members for epoch %d", epoch))
+	}
+
+	var members []signature.PublicKey
+	if err = cbor.Unmarshal(raw, &members); err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	return members, nil
+}
+
 // MutableState is the mutable roothash state wrapper.
 type MutableState struct {
 	*ImmutableState
 
-	ms mkvs.KeyValueTree
+	ms       mkvs.KeyValueTree
+	regState *registryState.MutableState
 }
 
 func NewMutableState(tree mkvs.KeyValueTree) *MutableState {
+	regState := registryState.NewMutableState(tree)
 	return &MutableState{
 		ImmutableState: &ImmutableState{
 			&api.ImmutableState{ImmutableKeyValueTree: tree},
+			regState,
 		},
-		ms: tree,
+		ms:       tree,
+		regState: regState,
+	}
+}
+
+// RuntimeStateKeyValue returns the consensus state key and the CBOR-serialized value under which
+// the given runtime state is stored.
+//
+// As only a reference to the runtime descriptor is stored, the descriptor (if any) is used to
+// derive the runtime identifier and the descriptor hash, but is not part of the value. This
+// makes it possible to deterministically compare runtime state across upgrades.
+func RuntimeStateKeyValue(state *roothash.RuntimeState) ([]byte, []byte) {
+	stored := *state
+	stored.Runtime = nil
+	if state.Runtime != nil {
+		stored.RuntimeID = state.Runtime.ID
+		stored.DescriptorHash = hash.NewFrom(state.Runtime)
+	}
+	if state.ExecutorPool != nil {
+		pool := *state.ExecutorPool
+		pool.Runtime = nil
+		stored.ExecutorPool = &pool
 	}
+	return runtimeKeyFmt.Encode(&stored.RuntimeID), cbor.Marshal(&stored)
 }
 
 // SetRuntimeState sets a runtime's roothash state.
+//
+// Only a reference to the runtime descriptor is stored. Whenever the referenced descriptor
+// changes, it is pinned in the registry so that it can still be resolved after the runtime is
+// updated in the registry.
 func (s *MutableState) SetRuntimeState(ctx context.Context, state *roothash.RuntimeState) error {
-	if err := s.ms.Insert(ctx, runtimeKeyFmt.Encode(&state.Runtime.ID), cbor.Marshal(state)); err != nil {
+	if state.Runtime != nil {
+		descriptorHash := hash.NewFrom(state.Runtime)
+		if !state.RuntimeID.Equal(&state.Runtime.ID) || !state.DescriptorHash.Equal(&descriptorHash) {
+			if err := s.regState.PinRuntime(ctx, state.Runtime); err != nil {
+				return fmt.Errorf("failed to pin runtime descriptor: %w", err)
+			}
+			state.RuntimeID = state.Runtime.ID
+			state.DescriptorHash = descriptorHash
+		}
+	}
+
+	key, value := RuntimeStateKeyValue(state)
+	if err := s.ms.Insert(ctx, key, value); err != nil {
 		return api.UnavailableStateError(err)
 	}
 
 	// Store the current state and I/O roots separately to make them easier to retrieve when
-	// constructing proofs of runtime state.
+	// constructing proofs of runtime state. As this is the only place where the runtime state is
+	// updated, the roots always match the header of the current block.
 	stateRoot, _ := state.CurrentBlock.Header.StateRoot.MarshalBinary()
 	ioRoot, _ := state.CurrentBlock.Header.IORoot.MarshalBinary()
 
-	if err := s.ms.Insert(ctx, stateRootKeyFmt.Encode(&state.Runtime.ID), stateRoot); err != nil {
+	if err := s.ms.Insert(ctx, stateRootKeyFmt.Encode(&state.RuntimeID), stateRoot); err != nil {
 		return api.UnavailableStateError(err)
 	}
-	if err := s.ms.Insert(ctx, ioRootKeyFmt.Encode(&state.Runtime.ID), ioRoot); err != nil {
+	if err := s.ms.Insert(ctx, ioRootKeyFmt.Encode(&state.RuntimeID), ioRoot); err != nil {
 		return api.UnavailableStateError(err)
 	}
 	return nil
 }
 
+// Migrations are the roothash state schema migrations, in order.
+var Migrations = []abciState.Migration{
+	// Version 0 stored the state and I/O roots only as part of the runtime state.
+	{FromVersion: 0, Migrate: migrateSplitRuntimeRoots},
+	// Version 1 embedded the registry runtime descriptor in the runtime state.
+	{FromVersion: 1, Migrate: migrateRuntimeDescriptorReferences},
+}
+
+// migrateSplitRuntimeRoots stores the state and I/O roots of all runtimes separately from the
+// runtime state.
+func migrateSplitRuntimeRoots(ctx *api.Context) error {
+	state := NewMutableState(ctx.State())
+	runtimes, err := state.Runtimes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get runtimes: %w", err)
+	}
+	for _, rt := range runtimes {
+		if err = state.SetRuntimeState(ctx, rt); err != nil {
+			return fmt.Errorf("failed to set runtime state of %s: %w", rt.Runtime.ID, err)
+		}
+	}
+	return nil
+}
+
+// migrateRuntimeDescriptorReferences replaces the runtime descriptors embedded in the runtime
+// states of all runtimes with references to descriptors pinned in the registry.
+func migrateRuntimeDescriptorReferences(ctx *api.Context) error {
+	state := NewMutableState(ctx.State())
+	runtimes, err := state.Runtimes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get runtimes: %w", err)
+	}
+	for _, rt := range runtimes {
+		// Runtime states with an embedded descriptor have no descriptor hash, so the descriptor
+		// will get pinned.
+		if err = state.SetRuntimeState(ctx, rt); err != nil {
+			return fmt.Errorf("failed to set runtime state of %s: %w", rt.Runtime.ID, err)
+		}
+	}
+	return nil
+}
+
 // SetLastRoundResults sets a runtime's last normal round results.
 func (s *MutableState) SetLastRoundResults(ctx context.Context, runtimeID common.Namespace, results *roothash.RoundResults) error {
 	err := s.ms.Insert(ctx, lastRoundResultsKeyFmt.Encode(&runtimeID), cbor.Marshal(results))
@@ -263,6 +674,68 @@ func (s *MutableState) SetConsensusParameters(ctx context.Context, params *rooth
 	return api.UnavailableStateError(err)
 }
 
+// IncrementLivenessStatistics updates the liveness statistics of runtime committee members after
+// a round has been finalized.
+func (s *MutableState) IncrementLivenessStatistics(
+	ctx context.Context,
+	runtimeID common.Namespace,
+	participated []signature.PublicKey,
+	missed []signature.PublicKey,
+) error {
+	for _, v := range []struct {
+		nodes []signature.PublicKey
+		fn    func(*roothash.NodeLivenessStatistics)
+	}{
+		{participated, func(ns *roothash.NodeLivenessStatistics) { ns.RoundsParticipated++ }},
+		{missed, func(ns *roothash.NodeLivenessStatistics) { ns.RoundsMissed++ }},
+	} {
+		for _, nodeID := range v.nodes {
+			key := livenessKeyFmt.Encode(&runtimeID, &nodeID)
+			raw, err := s.ms.Get(ctx, key)
+			if err != nil {
+				return api.UnavailableStateError(err)
+			}
+
+			var nodeStats roothash.NodeLivenessStatistics
+			if raw != nil {
+				if err = cbor.Unmarshal(raw, &nodeStats); err != nil {
+					return api.UnavailableStateError(err)
+				}
+			}
+			v.fn(&nodeStats)
+
+			if err = s.ms.Insert(ctx, key, cbor.Marshal(&nodeStats)); err != nil {
+				return api.UnavailableStateError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// ResetLivenessStatistics removes the liveness statistics of all committee members of a specific
+// runtime (e.g., on epoch transitions).
+func (s *MutableState) ResetLivenessStatistics(ctx context.Context, runtimeID common.Namespace) error {
+	var toDelete [][]byte
+	_, err := api.IterateKeyFormat(ctx, s.is, livenessKeyFmt, []interface{}{&runtimeID},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, &signature.PublicKey{}} },
+		func(values []interface{}, value []byte) bool {
+			hRuntimeID, nodeID := values[0].(*keyformat.PreHashed), values[1].(*signature.PublicKey)
+			toDelete = append(toDelete, livenessKeyFmt.Encode(hRuntimeID, nodeID))
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range toDelete {
+		if err := s.ms.Remove(ctx, key); err != nil {
+			return api.UnavailableStateError(err)
+		}
+	}
+	return nil
+}
+
 // ScheduleRoundTimeout schedules a new runtime round timeout at a given height.
 func (s *MutableState) ScheduleRoundTimeout(ctx context.Context, runtimeID common.Namespace, height int64) error {
 	encodedID, _ := runtimeID.MarshalBinary()
@@ -284,21 +757,20 @@ func (s *MutableState) SetEvidenceHash(ctx context.Context, runtimeID common.Nam
 
 // RemoveExpiredEvidence removes expired evidence.
 func (s *MutableState) RemoveExpiredEvidence(ctx context.Context, runtimeID common.Namespace, minRound uint64) error {
-	it := s.is.NewIterator(ctx)
-	defer it.Close()
-
 	var toDelete [][]byte
-	for it.Seek(evidenceKeyFmt.Encode(&runtimeID)); it.Valid(); it.Next() {
-		var runtimeID keyformat.PreHashed
-		var round uint64
-		var hash hash.Hash
-		if !evidenceKeyFmt.Decode(it.Key(), &runtimeID, &round, &hash) {
-			break
-		}
-		if round > minRound {
-			break
-		}
-		toDelete = append(toDelete, it.Key())
+	_, err := api.IterateKeyFormat(ctx, s.is, evidenceKeyFmt, []interface{}{&runtimeID},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, new(uint64), &hash.Hash{}} },
+		func(values []interface{}, value []byte) bool {
+			hRuntimeID, round, evHash := values[0].(*keyformat.PreHashed), values[1].(*uint64), values[2].(*hash.Hash)
+			if *round > minRound {
+				return false
+			}
+			toDelete = append(toDelete, evidenceKeyFmt.Encode(hRuntimeID, *round, evHash))
+			return true
+		},
+	)
+	if err != nil {
+		return err
 	}
 
 	for _, key := range toDelete {
@@ -309,3 +781,192 @@ func (s *MutableState) RemoveExpiredEvidence(ctx context.Context, runtimeID comm
 
 	return nil
 }
+
+// SetMissedCommitments records the executor committee members of a specific runtime that failed
+// to commit in the given round.
+//
+// The members must be the distinct public keys of the committee valid for the given epoch, in a
+// deterministic order. The membership is only stored once per epoch, so each round only needs to
+// store a bitmap, and must be the same for all rounds of an epoch.
+func (s *MutableState) SetMissedCommitments(
+	ctx context.Context,
+	runtimeID common.Namespace,
+	round uint64,
+	epoch beacon.EpochTime,
+	members []signature.PublicKey,
+	missed []signature.PublicKey,
+) error {
+	indices := make(map[signature.PublicKey]int, len(members))
+	for idx, member := range members {
+		if _, ok := indices[member]; ok {
+			return fmt.Errorf("roothash: duplicate committee member %s", member)
+		}
+		indices[member] = idx
+	}
+
+	mc := missedCommitments{
+		Epoch:  epoch,
+		Bitmap: newMissedCommitmentsBitmap(len(members)),
+	}
+	for _, nodeID := range missed {
+		idx, ok := indices[nodeID]
+		if !ok {
+			return fmt.Errorf("roothash: node %s is not a committee member", nodeID)
+		}
+		setMissedCommitment(mc.Bitmap, idx)
+	}
+
+	membersKey := committeeMembersKeyFmt.Encode(&runtimeID, uint64(epoch))
+	rawMembers := cbor.Marshal(members)
+	raw, err := s.ms.Get(ctx, membersKey)
+	switch {
+	case err != nil:
+		return api.UnavailableStateError(err)
+	case raw == nil:
+		if err = s.ms.Insert(ctx, membersKey, rawMembers); err != nil {
+			return api.UnavailableStateError(err)
+		}
+	case !bytes.Equal(raw, rawMembers):
+		return fmt.Errorf("roothash: committee members do not match committee of epoch %d", epoch)
+	}
+
+	err = s.ms.Insert(ctx, missedCommitmentsKeyFmt.Encode(&runtimeID, round), cbor.Marshal(&mc))
+	return api.UnavailableStateError(err)
+}
+
+// RemoveExpiredMissedCommitments removes missed commitment records of a specific runtime for all
+// rounds up to and including minRound, together with any committee membership that is no longer
+// referenced by the remaining records.
+func (s *MutableState) RemoveExpiredMissedCommitments(ctx context.Context, runtimeID common.Namespace, minRound uint64) error {
+	var (
+		toDelete [][]byte
+		// In case no records remain, no committee membership is needed anymore.
+		minEpoch = beacon.EpochInvalid
+		err      error
+	)
+	_, iterErr := api.IterateKeyFormat(ctx, s.is, missedCommitmentsKeyFmt, []interface{}{&runtimeID},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, new(uint64)} },
+		func(values []interface{}, value []byte) bool {
+			hRuntimeID, round := values[0].(*keyformat.PreHashed), values[1].(*uint64)
+			if *round > minRound {
+				// Rounds are ordered, so the first remaining record refers to the oldest
+				// committee that is still needed.
+				var mc missedCommitments
+				if err = cbor.Unmarshal(value, &mc); err != nil {
+					return false
+				}
+				minEpoch = mc.Epoch
+				return false
+			}
+			toDelete = append(toDelete, missedCommitmentsKeyFmt.Encode(hRuntimeID, *round))
+			return true
+		},
+	)
+	if iterErr != nil {
+		return iterErr
+	}
+	if err != nil {
+		return api.UnavailableStateError(err)
+	}
+
+	_, iterErr = api.IterateKeyFormat(ctx, s.is, committeeMembersKeyFmt, []interface{}{&runtimeID},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, new(uint64)} },
+		func(values []interface{}, value []byte) bool {
+			hRuntimeID, epoch := values[0].(*keyformat.PreHashed), values[1].(*uint64)
+			if beacon.EpochTime(*epoch) >= minEpoch {
+				return false
+			}
+			toDelete = append(toDelete, committeeMembersKeyFmt.Encode(hRuntimeID, *epoch))
+			return true
+		},
+	)
+	if iterErr != nil {
+		return iterErr
+	}
+
+	for _, key := range toDelete {
+		if err = s.ms.Remove(ctx, key); err != nil {
+			return api.UnavailableStateError(err)
+		}
+	}
+	return nil
+}
+
+// EnqueueMessage appends a message to the end of the message queue of a specific runtime.
+//
+// In case the queue already holds MaxRuntimeMessageQueueSize messages, roothash.ErrMessageQueueFull
+// is returned.
+func (s *MutableState) EnqueueMessage(ctx context.Context, runtimeID common.Namespace, msg *message.Message) error {
+	params, err := s.ConsensusParameters(ctx)
+	if err != nil {
+		return err
+	}
+	meta, err := s.messageQueueMeta(ctx, runtimeID)
+	if err != nil {
+		return err
+	}
+	if meta.Size >= params.MaxRuntimeMessageQueueSize {
+		return roothash.ErrMessageQueueFull
+	}
+
+	if err = s.ms.Insert(ctx, messageQueueKeyFmt.Encode(&runtimeID, meta.NextSequence), cbor.Marshal(msg)); err != nil {
+		return api.UnavailableStateError(err)
+	}
+	meta.Size++
+	meta.NextSequence++
+	err = s.ms.Insert(ctx, messageQueueMetaKeyFmt.Encode(&runtimeID), cbor.Marshal(meta))
+	return api.UnavailableStateError(err)
+}
+
+// DequeueMessages removes up to limit messages from the front of the message queue of a specific
+// runtime and returns them in the order in which they were enqueued.
+func (s *MutableState) DequeueMessages(ctx context.Context, runtimeID common.Namespace, limit uint32) ([]message.Message, error) {
+	if limit == 0 {
+		return nil, nil
+	}
+
+	var (
+		msgs     []message.Message
+		toDelete [][]byte
+		err      error
+	)
+	_, iterErr := api.IterateKeyFormat(ctx, s.is, messageQueueKeyFmt, []interface{}{&runtimeID},
+		func() []interface{} { return []interface{}{&keyformat.PreHashed{}, new(uint64)} },
+		func(values []interface{}, value []byte) bool {
+			var msg message.Message
+			if err = cbor.Unmarshal(value, &msg); err != nil {
+				return false
+			}
+			msgs = append(msgs, msg)
+
+			hRuntimeID, seq := values[0].(*keyformat.PreHashed), values[1].(*uint64)
+			toDelete = append(toDelete, messageQueueKeyFmt.Encode(hRuntimeID, *seq))
+			return uint32(len(msgs)) < limit
+		},
+	)
+	if iterErr != nil {
+		return nil, iterErr
+	}
+	if err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	for _, key := range toDelete {
+		if err = s.ms.Remove(ctx, key); err != nil {
+			return nil, api.UnavailableStateError(err)
+		}
+	}
+
+	meta, err := s.messageQueueMeta(ctx, runtimeID)
+	if err != nil {
+		return nil, err
+	}
+	meta.Size -= uint32(len(msgs))
+	if err = s.ms.Insert(ctx, messageQueueMetaKeyFmt.Encode(&runtimeID), cbor.Marshal(meta)); err != nil {
+		return nil, api.UnavailableStateError(err)
+	}
+	return msgs, nil
+}
@@ -1,16 +1,31 @@
 package state
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	abciState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/abci/state"
 	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	registryState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/registry/state"
 	registry "github.com/oasisprotocol/oasis-core/go/registry/api"
 	"github.com/oasisprotocol/oasis-core/go/roothash/api"
 	"github.com/oasisprotocol/oasis-core/go/roothash/api/block"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/commitment"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/message"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
 )
 
 func TestEvidence(t *testing.T) {
@@ -151,3 +166,732 @@ func TestSeparateRuntimeRoots(t *testing.T) {
 	require.NoError(err, "IORoot")
 	require.EqualValues(blk.Header.IORoot, ioRoot)
 }
+
+// requireLatestRootsConsistent checks that the separately stored latest roots of the given runtime
+// match the header of its current block.
+func requireLatestRootsConsistent(require *require.Assertions, ctx context.Context, st *MutableState, id common.Namespace) {
+	rtState, err := st.RuntimeState(ctx, id)
+	require.NoError(err, "RuntimeState")
+	roots, err := st.LatestRoots(ctx, id)
+	require.NoError(err, "LatestRoots")
+	require.EqualValues(rtState.CurrentBlock.Header.StateRoot, roots.StateRoot, "state root should match current block")
+	require.EqualValues(rtState.CurrentBlock.Header.IORoot, roots.IORoot, "I/O root should match current block")
+}
+
+func TestLatestRoots(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	st := NewMutableState(ctx.State())
+
+	var runtime registry.Runtime
+	runtime.ID = common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: latest roots"), 0)
+
+	_, err := st.LatestRoots(ctx, runtime.ID)
+	require.ErrorIs(err, api.ErrInvalidRuntime, "LatestRoots should fail for unknown runtimes")
+
+	genesisBlock := block.NewGenesisBlock(runtime.ID, 0)
+	rtState := &api.RuntimeState{
+		Runtime:            &runtime,
+		GenesisBlock:       genesisBlock,
+		CurrentBlock:       genesisBlock,
+		CurrentBlockHeight: 1,
+	}
+	err = st.SetRuntimeState(ctx, rtState)
+	require.NoError(err, "SetRuntimeState")
+	requireLatestRootsConsistent(require, ctx, st, runtime.ID)
+
+	// Simulate several rounds, including ones that do not change the roots.
+	for round := uint64(1); round <= 5; round++ {
+		var blk *block.Block
+		switch round % 2 {
+		case 0:
+			blk = block.NewEmptyBlock(rtState.CurrentBlock, round, block.RoundFailed)
+		default:
+			blk = block.NewEmptyBlock(rtState.CurrentBlock, round, block.Normal)
+			blk.Header.StateRoot = hash.NewFromBytes([]byte("state"), []byte{byte(round)})
+			blk.Header.IORoot = hash.NewFromBytes([]byte("io"), []byte{byte(round)})
+		}
+
+		rtState.CurrentBlock = blk
+		rtState.CurrentBlockHeight = int64(round) + 1
+		err = st.SetRuntimeState(ctx, rtState)
+		require.NoError(err, "SetRuntimeState")
+		requireLatestRootsConsistent(require, ctx, st, runtime.ID)
+	}
+
+	roots, err := st.LatestRoots(ctx, runtime.ID)
+	require.NoError(err, "LatestRoots")
+	require.EqualValues(hash.NewFromBytes([]byte("state"), []byte{5}), roots.StateRoot, "state root of the latest round")
+	require.EqualValues(hash.NewFromBytes([]byte("io"), []byte{5}), roots.IORoot, "I/O root of the latest round")
+}
+
+func TestMigrateSplitRuntimeRoots(t *testing.T) {
+	require := require.New(t)
+
+	const app = "roothash_state_test"
+	abciState.RegisterMigrations(app, Migrations...)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	st := NewMutableState(ctx.State())
+
+	// Build state in the old format, where the roots are only stored as part of the runtime state.
+	var runtimeIDs []common.Namespace
+	for i := byte(0); i < 3; i++ {
+		var runtime registry.Runtime
+		runtime.ID = common.NewTestNamespaceFromSeed(append([]byte("apps/roothash/state_test: migration "), i), 0)
+		runtimeIDs = append(runtimeIDs, runtime.ID)
+
+		blk := block.NewGenesisBlock(runtime.ID, 0)
+		blk.Header.StateRoot = hash.NewFromBytes([]byte("state"), []byte{i})
+		blk.Header.IORoot = hash.NewFromBytes([]byte("io"), []byte{i})
+		rtState := &api.RuntimeState{
+			Runtime:            &runtime,
+			GenesisBlock:       blk,
+			CurrentBlock:       blk,
+			CurrentBlockHeight: 1,
+		}
+		err := ctx.State().Insert(ctx, runtimeKeyFmt.Encode(&runtime.ID), cbor.Marshal(rtState))
+		require.NoError(err, "Insert")
+
+		_, err = st.LatestRoots(ctx, runtime.ID)
+		require.ErrorIs(err, api.ErrInvalidRuntime, "LatestRoots should fail before migration")
+	}
+
+	version, err := abciState.NewMutableState(ctx.State()).SchemaVersion(ctx, app)
+	require.NoError(err, "SchemaVersion")
+	require.EqualValues(0, version, "schema version before migration")
+
+	err = abciState.RunMigrations(ctx, app)
+	require.NoError(err, "RunMigrations")
+
+	for _, id := range runtimeIDs {
+		requireLatestRootsConsistent(require, ctx, st, id)
+	}
+	version, err = abciState.NewMutableState(ctx.State()).SchemaVersion(ctx, app)
+	require.NoError(err, "SchemaVersion")
+	require.EqualValues(len(Migrations), version, "schema version after migration")
+	require.EqualValues(abciState.LatestSchemaVersion(app), version, "schema version should be the latest")
+}
+
+func TestMigrateRuntimeDescriptorReferences(t *testing.T) {
+	require := require.New(t)
+
+	const app = "roothash_state_test_descriptors"
+	abciState.RegisterMigrations(app, Migrations...)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	st := NewMutableState(ctx.State())
+	regState := registryState.NewMutableState(ctx.State())
+
+	// Build state in the old format, where the runtime descriptor is embedded in the runtime state.
+	var runtime registry.Runtime
+	runtime.ID = common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: descriptor migration"), 0)
+	runtime.Executor.MaxMessages = 10
+	blk := block.NewGenesisBlock(runtime.ID, 0)
+	err := ctx.State().Insert(ctx, runtimeKeyFmt.Encode(&runtime.ID), cbor.Marshal(&api.RuntimeState{
+		Runtime:            &runtime,
+		GenesisBlock:       blk,
+		CurrentBlock:       blk,
+		CurrentBlockHeight: 1,
+	}))
+	require.NoError(err, "Insert")
+	err = abciState.NewMutableState(ctx.State()).SetSchemaVersion(ctx, app, 1)
+	require.NoError(err, "SetSchemaVersion")
+
+	// The registry already has a newer descriptor.
+	updated := runtime
+	updated.Executor.MaxMessages = 20
+	err = regState.SetRuntime(ctx, &updated, false)
+	require.NoError(err, "SetRuntime")
+
+	// Runtime states in the old format should still be readable.
+	rtState, err := st.RuntimeState(ctx, runtime.ID)
+	require.NoError(err, "RuntimeState")
+	require.EqualValues(&runtime, rtState.Runtime, "embedded descriptor should be used")
+
+	err = abciState.RunMigrations(ctx, app)
+	require.NoError(err, "RunMigrations")
+
+	raw, err := ctx.State().Get(ctx, runtimeKeyFmt.Encode(&runtime.ID))
+	require.NoError(err, "Get")
+	var stored api.RuntimeState
+	err = cbor.Unmarshal(raw, &stored)
+	require.NoError(err, "Unmarshal")
+	require.Nil(stored.Runtime, "migrated runtime state should not embed the descriptor")
+	require.EqualValues(runtime.ID, stored.RuntimeID, "migrated runtime state should reference the runtime")
+	require.EqualValues(hash.NewFrom(&runtime), stored.DescriptorHash, "migrated runtime state should reference the embedded descriptor")
+
+	rtState, err = st.RuntimeState(ctx, runtime.ID)
+	require.NoError(err, "RuntimeState")
+	require.EqualValues(&runtime, rtState.Runtime, "referenced descriptor should be resolved")
+}
+
+func TestRuntimeDescriptorReferences(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	st := NewMutableState(ctx.State())
+	regState := registryState.NewMutableState(ctx.State())
+
+	var runtime registry.Runtime
+	runtime.ID = common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: descriptor references"), 0)
+	runtime.Executor.MaxMessages = 10
+	err := regState.SetRuntime(ctx, &runtime, false)
+	require.NoError(err, "SetRuntime")
+
+	blk := block.NewGenesisBlock(runtime.ID, 0)
+	err = st.SetRuntimeState(ctx, &api.RuntimeState{
+		Runtime:            &runtime,
+		GenesisBlock:       blk,
+		CurrentBlock:       blk,
+		CurrentBlockHeight: 1,
+		ExecutorPool:       &commitment.Pool{Runtime: &runtime},
+	})
+	require.NoError(err, "SetRuntimeState")
+
+	rtState, err := st.RuntimeState(ctx, runtime.ID)
+	require.NoError(err, "RuntimeState")
+	require.EqualValues(&runtime, rtState.Runtime, "descriptor should be resolved")
+	require.EqualValues(&runtime, rtState.ExecutorPool.Runtime, "executor pool descriptor should be resolved")
+	require.EqualValues(hash.NewFrom(&runtime), rtState.DescriptorHash, "descriptor hash")
+
+	// Updating the runtime in the registry should not affect the referenced descriptor.
+	updated := runtime
+	updated.Executor.MaxMessages = 20
+	err = regState.SetRuntime(ctx, &updated, false)
+	require.NoError(err, "SetRuntime")
+	rtState, err = st.RuntimeState(ctx, runtime.ID)
+	require.NoError(err, "RuntimeState")
+	require.EqualValues(&runtime, rtState.Runtime, "referenced descriptor should be resolved after update")
+
+	// Referencing the new descriptor should make it resolvable.
+	rtState.Runtime = &updated
+	err = st.SetRuntimeState(ctx, rtState)
+	require.NoError(err, "SetRuntimeState")
+	rtStates, err := st.Runtimes(ctx)
+	require.NoError(err, "Runtimes")
+	require.Len(rtStates, 1, "there should be a single runtime")
+	require.EqualValues(&updated, rtStates[0].Runtime, "new descriptor should be resolved")
+	require.EqualValues(&updated, rtStates[0].ExecutorPool.Runtime, "executor pool should use the new descriptor")
+
+	// Missing descriptors should be reported.
+	err = ctx.State().Insert(ctx, runtimeKeyFmt.Encode(&runtime.ID), cbor.Marshal(&api.RuntimeState{
+		RuntimeID:      runtime.ID,
+		DescriptorHash: hash.NewFrom(&runtime),
+		GenesisBlock:   blk,
+		CurrentBlock:   blk,
+	}))
+	require.NoError(err, "Insert")
+	_, err = st.RuntimeState(ctx, runtime.ID)
+	require.ErrorIs(err, api.ErrRuntimeDescriptorNotFound, "RuntimeState should fail for missing descriptors")
+	_, err = st.Runtimes(ctx)
+	require.ErrorIs(err, api.ErrRuntimeDescriptorNotFound, "Runtimes should fail for missing descriptors")
+}
+
+// setRuntimeStates registers n runtimes and sets their roothash runtime states.
+func setRuntimeStates(ctx *abciAPI.Context, n int) error {
+	st := NewMutableState(ctx.State())
+	regState := registryState.NewMutableState(ctx.State())
+	for i := 0; i < n; i++ {
+		var runtime registry.Runtime
+		runtime.ID = common.NewTestNamespaceFromSeed([]byte(fmt.Sprintf("apps/roothash/state_test: runtime %d", i)), 0)
+		if err := regState.SetRuntime(ctx, &runtime, false); err != nil {
+			return err
+		}
+
+		blk := block.NewGenesisBlock(runtime.ID, 0)
+		if err := st.SetRuntimeState(ctx, &api.RuntimeState{
+			Runtime:            &runtime,
+			GenesisBlock:       blk,
+			CurrentBlock:       blk,
+			CurrentBlockHeight: 1,
+			ExecutorPool:       &commitment.Pool{Runtime: &runtime},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestIterateRuntimes(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	st := NewMutableState(ctx.State())
+	count, err := st.RuntimeCount(ctx)
+	require.NoError(err, "RuntimeCount")
+	require.Zero(count, "there should be no runtimes")
+
+	const numRuntimes = 20
+	err = setRuntimeStates(ctx, numRuntimes)
+	require.NoError(err, "setRuntimeStates")
+
+	count, err = st.RuntimeCount(ctx)
+	require.NoError(err, "RuntimeCount")
+	require.Equal(numRuntimes, count, "RuntimeCount should count all runtimes")
+
+	rtStates, err := st.Runtimes(ctx)
+	require.NoError(err, "Runtimes")
+	require.Len(rtStates, numRuntimes)
+
+	// Iteration order should match the list of runtimes.
+	var iterated []*api.RuntimeState
+	err = st.IterateRuntimes(ctx, func(rtState *api.RuntimeState) bool {
+		iterated = append(iterated, rtState)
+		return true
+	})
+	require.NoError(err, "IterateRuntimes")
+	require.EqualValues(rtStates, iterated, "IterateRuntimes should visit runtimes in order")
+	for _, rtState := range iterated {
+		require.NotNil(rtState.Runtime, "descriptor should be resolved")
+		require.Equal(rtState.Runtime, rtState.ExecutorPool.Runtime, "executor pool descriptor should be resolved")
+	}
+
+	// Returning false should stop the iteration.
+	var visited []common.Namespace
+	err = st.IterateRuntimes(ctx, func(rtState *api.RuntimeState) bool {
+		visited = append(visited, rtState.Runtime.ID)
+		return len(visited) < 5
+	})
+	require.NoError(err, "IterateRuntimes")
+	require.Len(visited, 5, "IterateRuntimes should stop early")
+	for i, id := range visited {
+		require.Equal(rtStates[i].Runtime.ID, id)
+	}
+
+	// Missing descriptors should be reported.
+	blk := block.NewGenesisBlock(rtStates[10].Runtime.ID, 0)
+	err = ctx.State().Insert(ctx, runtimeKeyFmt.Encode(&rtStates[10].Runtime.ID), cbor.Marshal(&api.RuntimeState{
+		RuntimeID:      rtStates[10].Runtime.ID,
+		DescriptorHash: hash.NewFromBytes([]byte("missing descriptor")),
+		GenesisBlock:   blk,
+		CurrentBlock:   blk,
+	}))
+	require.NoError(err, "Insert")
+	visited = nil
+	err = st.IterateRuntimes(ctx, func(rtState *api.RuntimeState) bool {
+		visited = append(visited, rtState.Runtime.ID)
+		return true
+	})
+	require.ErrorIs(err, api.ErrRuntimeDescriptorNotFound, "IterateRuntimes should fail for missing descriptors")
+	require.Len(visited, 10, "IterateRuntimes should stop at the failing runtime")
+}
+
+func benchmarkRuntimes(b *testing.B, fn func(ctx *abciAPI.Context, st *ImmutableState) error) {
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	if err := setRuntimeStates(ctx, 1000); err != nil {
+		b.Fatalf("failed to set runtime states: %s", err)
+	}
+	st := NewMutableState(ctx.State())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fn(ctx, st.ImmutableState); err != nil {
+			b.Fatalf("failed to iterate runtimes: %s", err)
+		}
+	}
+}
+
+func BenchmarkRuntimes(b *testing.B) {
+	benchmarkRuntimes(b, func(ctx *abciAPI.Context, st *ImmutableState) error {
+		rtStates, err := st.Runtimes(ctx)
+		for _, rtState := range rtStates {
+			_ = rtState.CurrentBlock.Header.Round
+		}
+		return err
+	})
+}
+
+func BenchmarkIterateRuntimes(b *testing.B) {
+	benchmarkRuntimes(b, func(ctx *abciAPI.Context, st *ImmutableState) error {
+		return st.IterateRuntimes(ctx, func(rtState *api.RuntimeState) bool {
+			_ = rtState.CurrentBlock.Header.Round
+			return true
+		})
+	})
+}
+
+func BenchmarkRuntimeCount(b *testing.B) {
+	benchmarkRuntimes(b, func(ctx *abciAPI.Context, st *ImmutableState) error {
+		_, err := st.RuntimeCount(ctx)
+		return err
+	})
+}
+
+func TestRuntimeStateProof(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	st := NewMutableState(ctx.State())
+
+	var rtStates []*api.RuntimeState
+	for _, seed := range []string{"runtime1", "runtime2"} {
+		var runtime registry.Runtime
+		runtime.ID = common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: proof "+seed), 0)
+
+		blk := block.NewGenesisBlock(runtime.ID, 0)
+		blk.Header.StateRoot = hash.NewFromBytes([]byte(seed))
+		rtState := &api.RuntimeState{
+			Runtime:            &runtime,
+			GenesisBlock:       blk,
+			CurrentBlock:       blk,
+			CurrentBlockHeight: 1,
+		}
+		err := st.SetRuntimeState(ctx, rtState)
+		require.NoError(err, "SetRuntimeState")
+		rtStates = append(rtStates, rtState)
+	}
+	rt1ID, rt2ID := rtStates[0].Runtime.ID, rtStates[1].Runtime.ID
+	unknownID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: proof unknown"), 0)
+
+	_, stateRoot, err := ctx.State().(mkvs.Tree).Commit(ctx, common.Namespace{}, 1)
+	require.NoError(err, "Commit")
+
+	is, err := NewImmutableState(ctx, appState, ctx.BlockHeight()+1)
+	require.NoError(err, "NewImmutableState")
+
+	_, err = is.RuntimeStateWithProof(ctx, unknownID)
+	require.ErrorIs(err, api.ErrInvalidRuntime, "RuntimeStateWithProof should fail for unknown runtimes")
+
+	for _, rtState := range rtStates {
+		p, err := is.RuntimeStateWithProof(ctx, rtState.Runtime.ID)
+		require.NoError(err, "RuntimeStateWithProof")
+
+		// Proofs should survive serialization.
+		var decoded RuntimeStateProof
+		err = cbor.Unmarshal(cbor.Marshal(p), &decoded)
+		require.NoError(err, "Unmarshal")
+
+		verified, err := VerifyRuntimeStateProof(ctx, stateRoot, rtState.Runtime.ID, &decoded)
+		require.NoError(err, "VerifyRuntimeStateProof")
+		require.Nil(verified.Runtime, "verified runtime state should only reference the descriptor")
+		verified.Runtime = rtState.Runtime
+		require.EqualValues(cbor.Marshal(rtState), cbor.Marshal(verified), "verified runtime state should be correct")
+		require.EqualValues(rtState.CurrentBlock.Header, verified.CurrentBlock.Header, "verified current block should be correct")
+	}
+
+	p, err := is.RuntimeStateWithProof(ctx, rt1ID)
+	require.NoError(err, "RuntimeStateWithProof")
+
+	// Proofs should not verify against other roots.
+	_, err = VerifyRuntimeStateProof(ctx, hash.NewFromBytes([]byte("bad root")), rt1ID, p)
+	require.Error(err, "VerifyRuntimeStateProof should fail for a different root")
+
+	// Proofs should not verify for other runtimes.
+	_, err = VerifyRuntimeStateProof(ctx, stateRoot, rt2ID, p)
+	require.Error(err, "VerifyRuntimeStateProof should fail for a different runtime")
+	_, err = VerifyRuntimeStateProof(ctx, stateRoot, unknownID, p)
+	require.Error(err, "VerifyRuntimeStateProof should fail for an unknown runtime")
+
+	// Proofs should not verify a different state.
+	tampered := *p
+	tampered.RawState = cbor.Marshal(rtStates[1])
+	_, err = VerifyRuntimeStateProof(ctx, stateRoot, rt1ID, &tampered)
+	require.Error(err, "VerifyRuntimeStateProof should fail for a tampered state")
+}
+
+func TestLivenessStatistics(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+
+	rt1ID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: runtime1"), 0)
+	rt2ID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: runtime2"), 0)
+
+	node1 := memorySigner.NewTestSigner("apps/roothash/state_test: node1").Public()
+	node2 := memorySigner.NewTestSigner("apps/roothash/state_test: node2").Public()
+	node3 := memorySigner.NewTestSigner("apps/roothash/state_test: node3").Public()
+
+	stats, err := s.LivenessStatistics(ctx, rt1ID)
+	require.NoError(err, "LivenessStatistics")
+	require.Empty(stats, "there should be no liveness statistics initially")
+
+	// Simulate several rounds with node3 absent.
+	for round := 0; round < 5; round++ {
+		err = s.IncrementLivenessStatistics(ctx, rt1ID, []signature.PublicKey{node1, node2}, []signature.PublicKey{node3})
+		require.NoError(err, "IncrementLivenessStatistics")
+	}
+	// A round on a different runtime should not affect the first one.
+	err = s.IncrementLivenessStatistics(ctx, rt2ID, []signature.PublicKey{node3}, nil)
+	require.NoError(err, "IncrementLivenessStatistics")
+
+	stats, err = s.LivenessStatistics(ctx, rt1ID)
+	require.NoError(err, "LivenessStatistics")
+	require.EqualValues(map[signature.PublicKey]*api.NodeLivenessStatistics{
+		node1: {RoundsParticipated: 5},
+		node2: {RoundsParticipated: 5},
+		node3: {RoundsMissed: 5},
+	}, stats)
+
+	stats, err = s.LivenessStatistics(ctx, rt2ID)
+	require.NoError(err, "LivenessStatistics")
+	require.EqualValues(map[signature.PublicKey]*api.NodeLivenessStatistics{
+		node3: {RoundsParticipated: 1},
+	}, stats)
+
+	// Epoch transition should reset the statistics of the given runtime only.
+	err = s.ResetLivenessStatistics(ctx, rt1ID)
+	require.NoError(err, "ResetLivenessStatistics")
+
+	stats, err = s.LivenessStatistics(ctx, rt1ID)
+	require.NoError(err, "LivenessStatistics")
+	require.Empty(stats, "liveness statistics should be reset")
+
+	stats, err = s.LivenessStatistics(ctx, rt2ID)
+	require.NoError(err, "LivenessStatistics")
+	require.Len(stats, 1, "liveness statistics of other runtimes should be kept")
+
+	// Counting should start from scratch in the new epoch.
+	err = s.IncrementLivenessStatistics(ctx, rt1ID, []signature.PublicKey{node3}, []signature.PublicKey{node1})
+	require.NoError(err, "IncrementLivenessStatistics")
+
+	stats, err = s.LivenessStatistics(ctx, rt1ID)
+	require.NoError(err, "LivenessStatistics")
+	require.EqualValues(map[signature.PublicKey]*api.NodeLivenessStatistics{
+		node1: {RoundsMissed: 1},
+		node3: {RoundsParticipated: 1},
+	}, stats)
+}
+
+func newTestMessage(seq uint64) message.Message {
+	return message.Message{
+		Staking: &message.StakingMessage{
+			Transfer: &staking.Transfer{Amount: *quantity.NewFromUint64(seq)},
+		},
+	}
+}
+
+func requireMessages(require *require.Assertions, msgs []message.Message, first, last uint64) {
+	require.Len(msgs, int(last-first+1), "number of dequeued messages")
+	for i, msg := range msgs {
+		expected := newTestMessage(first + uint64(i))
+		require.Equal(expected, msg, "messages should be dequeued in FIFO order")
+	}
+}
+
+func TestMissedCommitments(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextBeginBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+
+	rt1ID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: runtime1"), 0)
+	rt2ID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: runtime2"), 0)
+
+	var nodes []signature.PublicKey
+	for i := 0; i < 130; i++ {
+		nodes = append(nodes, memorySigner.NewTestSigner(fmt.Sprintf("apps/roothash/state_test: node%d", i)).Public())
+	}
+
+	missed, err := s.MissedCommitments(ctx, rt1ID, 1)
+	require.NoError(err, "MissedCommitments")
+	require.Nil(missed, "there should be no missed commitments initially")
+
+	// Simulate committees of varying sizes, including ones crossing word boundaries. The committee
+	// of the last epoch stays the same for multiple rounds.
+	rng := rand.New(rand.NewSource(42))
+	expected := make(map[uint64]map[signature.PublicKey]bool)
+	for round, size := range []int{1, 2, 63, 64, 65, 127, 128, 129, 130, 130, 130} {
+		epoch := beacon.EpochTime(round)
+		if epoch > 8 {
+			epoch = 8
+		}
+		members := nodes[:size]
+		if size == 130 {
+			// Committee in a different order.
+			members = append([]signature.PublicKey{}, nodes[1:]...)
+			members = append(members, nodes[0])
+		}
+
+		var roundMissed []signature.PublicKey
+		expected[uint64(round)] = make(map[signature.PublicKey]bool)
+		for idx, member := range members {
+			// Make sure to cover the first and last member in each round.
+			isMissed := idx == 0 || idx == size-1 || rng.Intn(2) == 0
+			if isMissed {
+				roundMissed = append(roundMissed, member)
+			}
+			expected[uint64(round)][member] = isMissed
+		}
+
+		err = s.SetMissedCommitments(ctx, rt1ID, uint64(round), epoch, members, roundMissed)
+		require.NoError(err, "SetMissedCommitments")
+	}
+	// A different runtime should not affect the first one.
+	err = s.SetMissedCommitments(ctx, rt2ID, 0, 0, nodes[:2], nil)
+	require.NoError(err, "SetMissedCommitments")
+
+	for round, exp := range expected {
+		missed, err = s.MissedCommitments(ctx, rt1ID, round)
+		require.NoError(err, "MissedCommitments")
+		require.EqualValues(exp, missed, "missed commitments should be restored (round %d)", round)
+	}
+	missed, err = s.MissedCommitments(ctx, rt2ID, 0)
+	require.NoError(err, "MissedCommitments")
+	require.EqualValues(map[signature.PublicKey]bool{nodes[0]: false, nodes[1]: false}, missed)
+
+	// Invalid membership should be rejected.
+	err = s.SetMissedCommitments(ctx, rt1ID, 100, 9, []signature.PublicKey{nodes[0], nodes[0]}, nil)
+	require.Error(err, "SetMissedCommitments should fail with duplicate members")
+	err = s.SetMissedCommitments(ctx, rt1ID, 100, 9, nodes[:2], nodes[2:3])
+	require.Error(err, "SetMissedCommitments should fail with non-members")
+	err = s.SetMissedCommitments(ctx, rt1ID, 100, 8, nodes[:2], nil)
+	require.Error(err, "SetMissedCommitments should fail with a different committee in the same epoch")
+
+	// Expire records of the first few rounds.
+	err = s.RemoveExpiredMissedCommitments(ctx, rt1ID, 4)
+	require.NoError(err, "RemoveExpiredMissedCommitments")
+	for round, exp := range expected {
+		missed, err = s.MissedCommitments(ctx, rt1ID, round)
+		require.NoError(err, "MissedCommitments")
+		switch {
+		case round <= 4:
+			require.Nil(missed, "expired records should be removed (round %d)", round)
+		default:
+			require.EqualValues(exp, missed, "remaining records should be kept (round %d)", round)
+		}
+	}
+	missed, err = s.MissedCommitments(ctx, rt2ID, 0)
+	require.NoError(err, "MissedCommitments")
+	require.NotNil(missed, "records of other runtimes should be kept")
+
+	// Only committees referenced by remaining records should be kept.
+	for epoch := uint64(0); epoch <= 9; epoch++ {
+		raw, err := s.ms.Get(ctx, committeeMembersKeyFmt.Encode(&rt1ID, epoch))
+		require.NoError(err, "Get")
+		require.Equal(epoch > 4 && epoch <= 8, raw != nil, "committee membership for epoch %d", epoch)
+	}
+
+	// Expiring all records should also remove all committees.
+	err = s.RemoveExpiredMissedCommitments(ctx, rt1ID, 100)
+	require.NoError(err, "RemoveExpiredMissedCommitments")
+	for epoch := uint64(0); epoch <= 9; epoch++ {
+		raw, err := s.ms.Get(ctx, committeeMembersKeyFmt.Encode(&rt1ID, epoch))
+		require.NoError(err, "Get")
+		require.Nil(raw, "committee membership for epoch %d should be removed", epoch)
+	}
+}
+
+func TestMessageQueue(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+	err := s.SetConsensusParameters(ctx, &api.ConsensusParameters{
+		MaxRuntimeMessageQueueSize: 5,
+	})
+	require.NoError(err, "SetConsensusParameters")
+
+	rt1ID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: runtime1"), 0)
+	rt2ID := common.NewTestNamespaceFromSeed([]byte("apps/roothash/state_test: runtime2"), 0)
+
+	size, err := s.MessageQueueSize(ctx, rt1ID)
+	require.NoError(err, "MessageQueueSize")
+	require.EqualValues(0, size, "queue should be empty initially")
+	msgs, err := s.DequeueMessages(ctx, rt1ID, 10)
+	require.NoError(err, "DequeueMessages")
+	require.Empty(msgs, "dequeuing from an empty queue should return nothing")
+
+	// Fill the queue past the limit.
+	for seq := uint64(0); seq < 5; seq++ {
+		msg := newTestMessage(seq)
+		err = s.EnqueueMessage(ctx, rt1ID, &msg)
+		require.NoError(err, "EnqueueMessage")
+	}
+	msg := newTestMessage(5)
+	err = s.EnqueueMessage(ctx, rt1ID, &msg)
+	require.ErrorIs(err, api.ErrMessageQueueFull, "EnqueueMessage should fail when the queue is full")
+
+	// Queues of other runtimes should not be affected.
+	err = s.EnqueueMessage(ctx, rt2ID, &msg)
+	require.NoError(err, "EnqueueMessage")
+
+	// Reload state and dequeue a batch.
+	s = NewMutableState(ctx.State())
+	size, err = s.MessageQueueSize(ctx, rt1ID)
+	require.NoError(err, "MessageQueueSize")
+	require.EqualValues(5, size, "queue size should be preserved")
+	msgs, err = s.DequeueMessages(ctx, rt1ID, 2)
+	require.NoError(err, "DequeueMessages")
+	requireMessages(require, msgs, 0, 1)
+
+	size, err = s.MessageQueueSize(ctx, rt1ID)
+	require.NoError(err, "MessageQueueSize")
+	require.EqualValues(3, size, "queue size should be decremented after dequeuing")
+
+	// Space freed by dequeuing should be reusable.
+	for seq := uint64(5); seq < 7; seq++ {
+		msg = newTestMessage(seq)
+		err = s.EnqueueMessage(ctx, rt1ID, &msg)
+		require.NoError(err, "EnqueueMessage")
+	}
+	msg = newTestMessage(7)
+	err = s.EnqueueMessage(ctx, rt1ID, &msg)
+	require.ErrorIs(err, api.ErrMessageQueueFull, "EnqueueMessage should fail when the queue is full")
+
+	// Reload state and drain the queue.
+	s = NewMutableState(ctx.State())
+	msgs, err = s.DequeueMessages(ctx, rt1ID, 0)
+	require.NoError(err, "DequeueMessages")
+	require.Empty(msgs, "dequeuing with a zero limit should return nothing")
+	msgs, err = s.DequeueMessages(ctx, rt1ID, 10)
+	require.NoError(err, "DequeueMessages")
+	requireMessages(require, msgs, 2, 6)
+
+	size, err = s.MessageQueueSize(ctx, rt1ID)
+	require.NoError(err, "MessageQueueSize")
+	require.EqualValues(0, size, "queue should be empty after draining")
+	msgs, err = s.DequeueMessages(ctx, rt1ID, 10)
+	require.NoError(err, "DequeueMessages")
+	require.Empty(msgs, "dequeuing from a drained queue should return nothing")
+
+	size, err = s.MessageQueueSize(ctx, rt2ID)
+	require.NoError(err, "MessageQueueSize")
+	require.EqualValues(1, size, "queues of other runtimes should not be affected")
+	msgs, err = s.DequeueMessages(ctx, rt2ID, 10)
+	require.NoError(err, "DequeueMessages")
+	requireMessages(require, msgs, 5, 5)
+}
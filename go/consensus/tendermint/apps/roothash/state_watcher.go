@@ -0,0 +1,139 @@
+package roothash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	roothash "github.com/oasisprotocol/oasis-core/go/roothash/api"
+)
+
+// RuntimeStateQueryFunc returns the committed roothash state of the given runtime at the given
+// consensus height.
+type RuntimeStateQueryFunc func(ctx context.Context, runtimeID common.Namespace, height int64) (*roothash.RuntimeState, error)
+
+// RuntimeStateWatcher emits runtime state updates for watched runtimes.
+type RuntimeStateWatcher struct {
+	sync.Mutex
+
+	query     RuntimeStateQueryFunc
+	notifiers map[common.Namespace]*runtimeStateNotifier
+}
+
+type runtimeStateNotifier struct {
+	broker      *pubsub.Broker
+	last        *roothash.RuntimeStateUpdate
+	subscribers int
+}
+
+func (n *runtimeStateNotifier) update(state *roothash.RuntimeState) {
+	upd := roothash.NewRuntimeStateUpdate(state)
+
+	// Only emit changed runtime states and make sure that updates are never emitted out of order
+	// (e.g., when the initial state was queried at a later height than the delivered block).
+	if n.last != nil && upd.Height <= n.last.Height {
+		return
+	}
+	n.last = upd
+	n.broker.Broadcast(upd)
+}
+
+// runtimeStateSubscription is a runtime state subscription which stops watching the runtime once
+// its last subscription is closed.
+type runtimeStateSubscription struct {
+	w         *RuntimeStateWatcher
+	runtimeID common.Namespace
+	n         *runtimeStateNotifier
+	sub       *pubsub.Subscription
+	once      sync.Once
+}
+
+// Close unsubscribes the subscription.
+func (s *runtimeStateSubscription) Close() {
+	s.once.Do(func() {
+		s.sub.Close()
+
+		s.w.Lock()
+		defer s.w.Unlock()
+
+		s.n.subscribers--
+		if s.n.subscribers == 0 && s.w.notifiers[s.runtimeID] == s.n {
+			delete(s.w.notifiers, s.runtimeID)
+		}
+	})
+}
+
+// Watch subscribes to runtime state updates of the given runtime.
+//
+// The latest runtime state is always replayed to new subscribers so late subscribers never miss
+// it. Subsequent updates are emitted in order. The runtime is no longer watched once all of its
+// subscriptions have been closed.
+func (w *RuntimeStateWatcher) Watch(ctx context.Context, runtimeID common.Namespace) (<-chan *roothash.RuntimeStateUpdate, pubsub.ClosableSubscription, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	n := w.notifiers[runtimeID]
+	if n == nil {
+		n = &runtimeStateNotifier{
+			broker: pubsub.NewBroker(true),
+		}
+	}
+	if n.last == nil {
+		// Nothing has been emitted yet, start with the latest runtime state.
+		state, err := w.query(ctx, runtimeID, consensus.HeightLatest)
+		switch {
+		case err == nil:
+			n.update(state)
+		case errors.Is(err, roothash.ErrInvalidRuntime):
+			// Runtime does not exist yet, it will be emitted once it does.
+		default:
+			return nil, nil, fmt.Errorf("roothash: failed to query runtime state: %w", err)
+		}
+	}
+
+	w.notifiers[runtimeID] = n
+	n.subscribers++
+
+	sub := n.broker.Subscribe()
+	ch := make(chan *roothash.RuntimeStateUpdate)
+	sub.Unwrap(ch)
+
+	return ch, &runtimeStateSubscription{w: w, runtimeID: runtimeID, n: n, sub: sub}, nil
+}
+
+// DeliverBlock emits updates for all watched runtimes the state of which changed as of the given
+// consensus height.
+//
+// Blocks must be delivered in order.
+func (w *RuntimeStateWatcher) DeliverBlock(ctx context.Context, height int64) error {
+	w.Lock()
+	defer w.Unlock()
+
+	var result error
+	for runtimeID, n := range w.notifiers {
+		state, err := w.query(ctx, runtimeID, height)
+		switch {
+		case err == nil:
+			n.update(state)
+		case errors.Is(err, roothash.ErrInvalidRuntime):
+		default:
+			result = multierror.Append(result, fmt.Errorf("roothash: failed to query runtime %s state: %w", runtimeID, err))
+		}
+	}
+	return result
+}
+
+// NewRuntimeStateWatcher creates a new runtime state watcher using the given function to query
+// committed runtime state.
+func NewRuntimeStateWatcher(query RuntimeStateQueryFunc) *RuntimeStateWatcher {
+	return &RuntimeStateWatcher{
+		query:     query,
+		notifiers: make(map[common.Namespace]*runtimeStateNotifier),
+	}
+}
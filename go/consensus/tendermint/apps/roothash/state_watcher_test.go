@@ -0,0 +1,148 @@
+package roothash
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	roothashState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/roothash/state"
+	registry "github.com/oasisprotocol/oasis-core/go/registry/api"
+	roothash "github.com/oasisprotocol/oasis-core/go/roothash/api"
+	"github.com/oasisprotocol/oasis-core/go/roothash/api/block"
+)
+
+const recvTimeout = 5 * time.Second
+
+func TestRuntimeStateWatcher(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	state := roothashState.NewMutableState(ctx.State())
+	runtimeID := common.NewTestNamespaceFromSeed([]byte("roothash state watcher test"), 0)
+
+	watcher := NewRuntimeStateWatcher(func(_ context.Context, id common.Namespace, _ int64) (*roothash.RuntimeState, error) {
+		return state.RuntimeState(ctx, id)
+	})
+
+	setRuntimeState := func(height int64, round uint64) *roothash.RuntimeStateUpdate {
+		blk := block.NewGenesisBlock(runtimeID, 0)
+		blk.Header.Round = round
+		blk.Header.StateRoot = hash.NewFromBytes([]byte(fmt.Sprintf("state root %d", round)))
+
+		rs := &roothash.RuntimeState{
+			Runtime:            &registry.Runtime{ID: runtimeID},
+			CurrentBlock:       blk,
+			CurrentBlockHeight: height,
+		}
+		err := state.SetRuntimeState(ctx, rs)
+		require.NoError(err, "SetRuntimeState")
+
+		err = watcher.DeliverBlock(ctx, height)
+		require.NoError(err, "DeliverBlock")
+
+		return roothash.NewRuntimeStateUpdate(rs)
+	}
+	recvUpdate := func(ch <-chan *roothash.RuntimeStateUpdate) *roothash.RuntimeStateUpdate {
+		select {
+		case upd := <-ch:
+			return upd
+		case <-time.After(recvTimeout):
+			require.FailNow("failed to receive runtime state update")
+			return nil
+		}
+	}
+	requireNoUpdate := func(ch <-chan *roothash.RuntimeStateUpdate) {
+		select {
+		case upd := <-ch:
+			require.FailNow("received unexpected runtime state update", "update: %+v", upd)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// Watching a runtime that does not exist yet should succeed.
+	earlyCh, earlySub, err := watcher.Watch(ctx, runtimeID)
+	require.NoError(err, "Watch")
+	defer earlySub.Close()
+	requireNoUpdate(earlyCh)
+
+	var updates []*roothash.RuntimeStateUpdate
+	updates = append(updates, setRuntimeState(10, 1))
+	updates = append(updates, setRuntimeState(11, 2))
+	// Blocks without runtime state changes should not emit updates.
+	err = watcher.DeliverBlock(ctx, 12)
+	require.NoError(err, "DeliverBlock")
+	updates = append(updates, setRuntimeState(13, 3))
+
+	for _, expected := range updates {
+		require.Equal(expected, recvUpdate(earlyCh), "updates should be received in order")
+	}
+	requireNoUpdate(earlyCh)
+
+	// Late subscribers should receive the latest runtime state first.
+	lateCh, lateSub, err := watcher.Watch(ctx, runtimeID)
+	require.NoError(err, "Watch")
+	defer lateSub.Close()
+	require.Equal(updates[2], recvUpdate(lateCh), "late subscriber should receive the latest state")
+
+	updates = append(updates, setRuntimeState(14, 4))
+	require.Equal(updates[3], recvUpdate(earlyCh), "early subscriber should receive the update")
+	require.Equal(updates[3], recvUpdate(lateCh), "late subscriber should receive the update")
+	requireNoUpdate(lateCh)
+
+	// A subscriber of a new watcher should receive the latest state as an initial snapshot.
+	snapshotWatcher := NewRuntimeStateWatcher(func(_ context.Context, id common.Namespace, _ int64) (*roothash.RuntimeState, error) {
+		return state.RuntimeState(ctx, id)
+	})
+	snapshotCh, snapshotSub, err := snapshotWatcher.Watch(ctx, runtimeID)
+	require.NoError(err, "Watch")
+	defer snapshotSub.Close()
+	require.Equal(updates[3], recvUpdate(snapshotCh), "subscriber should receive an initial snapshot")
+}
+
+func TestRuntimeStateWatcherClose(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	runtimeID := common.NewTestNamespaceFromSeed([]byte("roothash state watcher close test"), 0)
+
+	var queries int
+	watcher := NewRuntimeStateWatcher(func(_ context.Context, _ common.Namespace, _ int64) (*roothash.RuntimeState, error) {
+		queries++
+		return nil, roothash.ErrInvalidRuntime
+	})
+
+	_, sub1, err := watcher.Watch(ctx, runtimeID)
+	require.NoError(err, "Watch")
+	_, sub2, err := watcher.Watch(ctx, runtimeID)
+	require.NoError(err, "Watch")
+
+	queries = 0
+	err = watcher.DeliverBlock(ctx, 10)
+	require.NoError(err, "DeliverBlock")
+	require.Equal(1, queries, "watched runtime should be queried")
+
+	// The runtime should be watched as long as any subscription remains.
+	sub1.Close()
+	sub1.Close()
+	queries = 0
+	err = watcher.DeliverBlock(ctx, 11)
+	require.NoError(err, "DeliverBlock")
+	require.Equal(1, queries, "runtime should be queried while subscribed")
+
+	sub2.Close()
+	queries = 0
+	err = watcher.DeliverBlock(ctx, 12)
+	require.NoError(err, "DeliverBlock")
+	require.Equal(0, queries, "runtime should not be queried after all subscriptions are closed")
+	require.Empty(watcher.notifiers, "notifier should be removed")
+}
@@ -0,0 +1,53 @@
+// Package api defines the staking application API for other applications.
+package api
+
+import (
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+type messageKind uint8
+
+var (
+	// MessageBalanceChanged is the message kind for general balance changes. The message is a
+	// *BalanceChange describing the change of an account's general balance.
+	MessageBalanceChanged = messageKind(0)
+
+	// MessageEscrowChanged is the message kind for active escrow balance changes. The message is a
+	// *BalanceChange describing the change of an account's active escrow balance.
+	MessageEscrowChanged = messageKind(1)
+
+	// MessageThresholdCrossed is the message kind for active escrow balances crossing a staking
+	// threshold. The message is a *ThresholdCrossing.
+	MessageThresholdCrossed = messageKind(2)
+)
+
+// NOTE: Messages are only emitted when executing transactions (or runtime messages) that may
+//       change balances. For each affected account, in the order of the accounts in the
+//       transaction, the balance change is emitted first, followed by the escrow change and any
+//       threshold crossings in the order of staking.ThresholdKinds.
+//
+//       Any errors returned from the handlers abort the transaction and roll back all of its
+//       state changes. As handlers are invoked while a state checkpoint is open, they must not
+//       start their own checkpoints.
+
+// BalanceChange is a change of an account balance.
+type BalanceChange struct {
+	// Account is the address of the account.
+	Account staking.Address
+	// Before is the balance before the change.
+	Before quantity.Quantity
+	// After is the balance after the change.
+	After quantity.Quantity
+}
+
+// ThresholdCrossing is a staking threshold being crossed by an account's active escrow balance.
+type ThresholdCrossing struct {
+	// Kind is the kind of the crossed threshold.
+	Kind staking.ThresholdKind
+	// Account is the address of the account.
+	Account staking.Address
+	// Above is true in case the escrow balance went from below the threshold to at or above it
+	// and false in case it dropped below the threshold.
+	Above bool
+}
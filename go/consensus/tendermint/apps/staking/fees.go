@@ -90,7 +90,7 @@ func (app *stakingApplication) disburseFeesP(
 		if err != nil {
 			return fmt.Errorf("CommonPool: %w", err)
 		}
-		if err = quantity.Move(commonPool, totalFees, remaining); err != nil {
+		if commonPool, err = commonPool.AddQ(remaining); err != nil {
 			return fmt.Errorf("move remaining: %w", err)
 		}
 		if err = stakeState.SetCommonPool(ctx, commonPool); err != nil {
@@ -228,7 +228,7 @@ func (app *stakingApplication) disburseFeesVQ(
 		if err != nil {
 			return fmt.Errorf("failed to query common pool: %w", err)
 		}
-		if err = quantity.Move(commonPool, lastBlockFees, remaining); err != nil {
+		if commonPool, err = commonPool.AddQ(remaining); err != nil {
 			return fmt.Errorf("move remaining: %w", err)
 		}
 		if err = stakeState.SetCommonPool(ctx, commonPool); err != nil {
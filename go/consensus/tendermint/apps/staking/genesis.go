@@ -56,10 +56,12 @@ func (app *stakingApplication) initLastBlockFees(ctx *abciAPI.Context, st *staki
 		"last_block_fees", st.LastBlockFees,
 		"common_pool", st.CommonPool,
 	)
-	if err := st.CommonPool.Add(&st.LastBlockFees); err != nil {
+	commonPool, err := st.CommonPool.AddQ(&st.LastBlockFees)
+	if err != nil {
 		return fmt.Errorf("tendermint/staking: failed to add block fees to common pool")
 	}
-	st.LastBlockFees = *quantity.NewQuantity()
+	st.CommonPool.Set(commonPool)
+	st.LastBlockFees.Set(quantity.NewQuantity())
 	return nil
 }
 
@@ -147,6 +149,18 @@ func (app *stakingApplication) initLedger(
 			return fmt.Errorf("tendermint/staking: failed to set account %s: %w", addr, err)
 		}
 	}
+
+	for addr, nonce := range st.ReapedAccounts {
+		if !addr.IsValid() {
+			return fmt.Errorf("tendermint/staking: genesis reaped account %s: address is invalid", addr)
+		}
+		if st.Ledger[addr] != nil {
+			return fmt.Errorf("tendermint/staking: genesis reaped account %s is in the ledger", addr)
+		}
+		if err := state.SetReapedAccount(ctx, addr, nonce); err != nil {
+			return fmt.Errorf("tendermint/staking: failed to set reaped account %s: %w", addr, err)
+		}
+	}
 	return nil
 }
 
@@ -289,6 +303,12 @@ func (app *stakingApplication) initDebondingDelegations(ctx *abciAPI.Context, st
 func (app *stakingApplication) InitChain(ctx *abciAPI.Context, request types.RequestInitChain, doc *genesis.Document) error {
 	st := &doc.Staking
 
+	// Reject a malformed genesis state upfront so that startup fails deterministically with all
+	// violations listed, instead of failing on the first one encountered (or not at all).
+	if err := st.SanityCheck(doc.Beacon.Base); err != nil {
+		return fmt.Errorf("tendermint/staking: invalid genesis state: %w", err)
+	}
+
 	var (
 		state       = stakingState.NewMutableState(ctx.State())
 		totalSupply quantity.Quantity
@@ -373,6 +393,11 @@ func (sq *stakingQuerier) Genesis(ctx context.Context) (*staking.Genesis, error)
 		ledger[addr] = acct
 	}
 
+	reapedAccounts, err := sq.state.ReapedAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	delegations, err := sq.state.Delegations(ctx)
 	if err != nil {
 		return nil, err
@@ -396,6 +421,7 @@ func (sq *stakingQuerier) Genesis(ctx context.Context) (*staking.Genesis, error)
 		Ledger:               ledger,
 		Delegations:          delegations,
 		DebondingDelegations: debondingDelegations,
+		ReapedAccounts:       reapedAccounts,
 	}
 	return &gen, nil
 }
@@ -0,0 +1,133 @@
+package staking
+
+import (
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	stakingApi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking/api"
+	stakingState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking/state"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// withBalanceHooks executes fn and then notifies other applications about any balance changes
+// of the given accounts, rolling back all changes in case any of them returns an error.
+func (app *stakingApplication) withBalanceHooks(
+	ctx *api.Context,
+	addrs []staking.Address,
+	fn func(state *stakingState.MutableState) error,
+) error {
+	if ctx.IsCheckOnly() || ctx.IsSimulation() {
+		return fn(stakingState.NewMutableState(ctx.State()))
+	}
+
+	// Create a new state checkpoint and rollback in case we fail.
+	sc := ctx.StartCheckpoint()
+	defer sc.Close()
+	state := stakingState.NewMutableState(ctx.State())
+
+	// Snapshot accounts before the change.
+	var (
+		accounts []staking.Address
+		before   []*staking.Account
+	)
+	seen := make(map[staking.Address]bool)
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		acct, err := state.Account(ctx, addr)
+		if err != nil {
+			return fmt.Errorf("failed to fetch account: %w", err)
+		}
+		accounts = append(accounts, addr)
+		before = append(before, acct)
+	}
+
+	if err := fn(state); err != nil {
+		return err
+	}
+
+	params, err := state.ConsensusParameters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch consensus parameters: %w", err)
+	}
+	for i, addr := range accounts {
+		after, err := state.Account(ctx, addr)
+		if err != nil {
+			return fmt.Errorf("failed to fetch account: %w", err)
+		}
+		if err = app.publishBalanceChanges(ctx, params, addr, before[i], after); err != nil {
+			return err
+		}
+	}
+
+	sc.Commit()
+
+	return nil
+}
+
+func (app *stakingApplication) publishBalanceChanges(
+	ctx *api.Context,
+	params *staking.ConsensusParameters,
+	addr staking.Address,
+	before *staking.Account,
+	after *staking.Account,
+) error {
+	if before.General.Balance.Cmp(&after.General.Balance) != 0 {
+		if err := app.publish(ctx, stakingApi.MessageBalanceChanged, &stakingApi.BalanceChange{
+			Account: addr,
+			Before:  before.General.Balance,
+			After:   after.General.Balance,
+		}); err != nil {
+			return err
+		}
+	}
+
+	escrowBefore, escrowAfter := &before.Escrow.Active.Balance, &after.Escrow.Active.Balance
+	if escrowBefore.Cmp(escrowAfter) == 0 {
+		return nil
+	}
+	if err := app.publish(ctx, stakingApi.MessageEscrowChanged, &stakingApi.BalanceChange{
+		Account: addr,
+		Before:  *escrowBefore,
+		After:   *escrowAfter,
+	}); err != nil {
+		return err
+	}
+
+	for _, kind := range staking.ThresholdKinds {
+		threshold, ok := params.Thresholds[kind]
+		if !ok {
+			continue
+		}
+		// An escrow balance equal to the threshold satisfies it.
+		wasAbove := escrowBefore.Cmp(&threshold) >= 0
+		isAbove := escrowAfter.Cmp(&threshold) >= 0
+		if wasAbove == isAbove {
+			continue
+		}
+		if err := app.publish(ctx, stakingApi.MessageThresholdCrossed, &stakingApi.ThresholdCrossing{
+			Kind:    kind,
+			Account: addr,
+			Above:   isAbove,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *stakingApplication) publish(ctx *api.Context, kind, msg interface{}) error {
+	switch err := app.md.Publish(ctx, kind, msg); err {
+	case nil, api.ErrNoSubscribers:
+		return nil
+	default:
+		ctx.Logger().Debug("balance change rejected by subscriber",
+			"err", err,
+			"kind", kind,
+		)
+		return err
+	}
+}
@@ -0,0 +1,202 @@
+package staking
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	stakingApi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking/api"
+	stakingState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking/state"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+var errHookVeto = errors.New("test: vetoed by hook")
+
+// testMessageDispatcher is a message dispatcher which dispatches messages to subscribers in
+// subscription order.
+type testMessageDispatcher struct {
+	subscriptions map[interface{}][]abciAPI.MessageSubscriber
+}
+
+func (md *testMessageDispatcher) Subscribe(kind interface{}, ms abciAPI.MessageSubscriber) {
+	if md.subscriptions == nil {
+		md.subscriptions = make(map[interface{}][]abciAPI.MessageSubscriber)
+	}
+	md.subscriptions[kind] = append(md.subscriptions[kind], ms)
+}
+
+func (md *testMessageDispatcher) Publish(ctx *abciAPI.Context, kind, msg interface{}) error {
+	if len(md.subscriptions[kind]) == 0 {
+		return abciAPI.ErrNoSubscribers
+	}
+	for _, ms := range md.subscriptions[kind] {
+		if err := ms.ExecuteMessage(ctx, kind, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testHookApp is an application which records all balance changes it is notified about.
+type testHookApp struct {
+	balanceChanges     []*stakingApi.BalanceChange
+	escrowChanges      []*stakingApi.BalanceChange
+	thresholdCrossings []*stakingApi.ThresholdCrossing
+
+	// veto is the threshold crossing which should be rejected.
+	veto *stakingApi.ThresholdCrossing
+}
+
+func (app *testHookApp) register(md abciAPI.MessageDispatcher) {
+	md.Subscribe(stakingApi.MessageBalanceChanged, app)
+	md.Subscribe(stakingApi.MessageEscrowChanged, app)
+	md.Subscribe(stakingApi.MessageThresholdCrossed, app)
+}
+
+func (app *testHookApp) reset() {
+	app.balanceChanges = nil
+	app.escrowChanges = nil
+	app.thresholdCrossings = nil
+}
+
+func (app *testHookApp) ExecuteMessage(ctx *abciAPI.Context, kind, msg interface{}) error {
+	switch kind {
+	case stakingApi.MessageBalanceChanged:
+		app.balanceChanges = append(app.balanceChanges, msg.(*stakingApi.BalanceChange))
+	case stakingApi.MessageEscrowChanged:
+		app.escrowChanges = append(app.escrowChanges, msg.(*stakingApi.BalanceChange))
+	case stakingApi.MessageThresholdCrossed:
+		tc := msg.(*stakingApi.ThresholdCrossing)
+		if app.veto != nil && *app.veto == *tc {
+			return errHookVeto
+		}
+		app.thresholdCrossings = append(app.thresholdCrossings, tc)
+	}
+	return nil
+}
+
+func TestBalanceHooks(t *testing.T) {
+	require := require.New(t)
+	var err error
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	stakeState := stakingState.NewMutableState(ctx.State())
+	err = stakeState.SetConsensusParameters(ctx, &staking.ConsensusParameters{
+		DebondingInterval: 1,
+		Thresholds: map[staking.ThresholdKind]quantity.Quantity{
+			staking.KindEntity:        *quantity.NewFromUint64(100),
+			staking.KindNodeValidator: *quantity.NewFromUint64(200),
+		},
+	})
+	require.NoError(err, "SetConsensusParameters")
+
+	pk1 := signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr1 := staking.NewAddress(pk1)
+	pk2 := signature.NewPublicKey("bbbfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr2 := staking.NewAddress(pk2)
+
+	err = stakeState.SetAccount(ctx, addr1, &staking.Account{
+		General: staking.GeneralAccount{
+			Balance: *quantity.NewFromUint64(1000),
+		},
+	})
+	require.NoError(err, "SetAccount")
+
+	md := &testMessageDispatcher{}
+	app := &stakingApplication{}
+	app.OnRegister(appState, md)
+	hooks := &testHookApp{}
+	hooks.register(md)
+
+	execute := func(signer signature.PublicKey, method transaction.MethodName, body interface{}) error {
+		hooks.reset()
+
+		txCtx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+		defer txCtx.Close()
+		txCtx.SetTxSigner(signer)
+
+		return app.ExecuteTx(txCtx, transaction.NewTransaction(0, nil, method, body))
+	}
+	escrowBalance := func(addr staking.Address) *quantity.Quantity {
+		acct, aerr := stakeState.Account(ctx, addr)
+		require.NoError(aerr, "Account")
+		return &acct.Escrow.Active.Balance
+	}
+	crossing := func(kind staking.ThresholdKind, above bool) *stakingApi.ThresholdCrossing {
+		return &stakingApi.ThresholdCrossing{Kind: kind, Account: addr1, Above: above}
+	}
+
+	// Transfers only change general balances, in the order of accounts in the transaction.
+	err = execute(pk1, staking.MethodTransfer, &staking.Transfer{To: addr2, Amount: *quantity.NewFromUint64(10)})
+	require.NoError(err, "Transfer")
+	require.Equal([]*stakingApi.BalanceChange{
+		{Account: addr1, Before: *quantity.NewFromUint64(1000), After: *quantity.NewFromUint64(990)},
+		{Account: addr2, Before: *quantity.NewFromUint64(0), After: *quantity.NewFromUint64(10)},
+	}, hooks.balanceChanges, "balance changes")
+	require.Empty(hooks.escrowChanges, "transfers should not change escrow")
+	require.Empty(hooks.thresholdCrossings, "transfers should not cross thresholds")
+
+	for _, step := range []struct {
+		msg       string
+		method    transaction.MethodName
+		amount    uint64
+		escrow    uint64
+		crossings []*stakingApi.ThresholdCrossing
+	}{
+		{"escrow just below the entity threshold", staking.MethodAddEscrow, 99, 99, nil},
+		{"escrow exactly at the entity threshold", staking.MethodAddEscrow, 1, 100, []*stakingApi.ThresholdCrossing{
+			crossing(staking.KindEntity, true),
+		}},
+		{"escrow above the entity threshold", staking.MethodAddEscrow, 99, 199, nil},
+		{"escrow exactly at the validator threshold", staking.MethodAddEscrow, 1, 200, []*stakingApi.ThresholdCrossing{
+			crossing(staking.KindNodeValidator, true),
+		}},
+		{"escrow just below the validator threshold", staking.MethodReclaimEscrow, 1, 199, []*stakingApi.ThresholdCrossing{
+			crossing(staking.KindNodeValidator, false),
+		}},
+		{"escrow exactly at the entity threshold again", staking.MethodReclaimEscrow, 99, 100, nil},
+		{"escrow above both thresholds", staking.MethodAddEscrow, 150, 250, []*stakingApi.ThresholdCrossing{
+			crossing(staking.KindNodeValidator, true),
+		}},
+		{"escrow below both thresholds", staking.MethodReclaimEscrow, 151, 99, []*stakingApi.ThresholdCrossing{
+			crossing(staking.KindEntity, false),
+			crossing(staking.KindNodeValidator, false),
+		}},
+	} {
+		before := escrowBalance(addr1).Clone()
+		switch step.method {
+		case staking.MethodAddEscrow:
+			err = execute(pk1, step.method, &staking.Escrow{Account: addr1, Amount: *quantity.NewFromUint64(step.amount)})
+		case staking.MethodReclaimEscrow:
+			// Shares are 1:1 with base units as there is no slashing or rewards.
+			err = execute(pk1, step.method, &staking.ReclaimEscrow{Account: addr1, Shares: *quantity.NewFromUint64(step.amount)})
+		}
+		require.NoError(err, step.msg)
+		require.Equal(quantity.NewFromUint64(step.escrow), escrowBalance(addr1), step.msg)
+		require.Equal([]*stakingApi.BalanceChange{
+			{Account: addr1, Before: *before, After: *quantity.NewFromUint64(step.escrow)},
+		}, hooks.escrowChanges, step.msg)
+		require.Equal(step.crossings, hooks.thresholdCrossings, step.msg)
+	}
+
+	// Vetoed changes should abort the transaction without changing state.
+	hooks.veto = crossing(staking.KindEntity, true)
+	err = execute(pk1, staking.MethodAddEscrow, &staking.Escrow{Account: addr1, Amount: *quantity.NewFromUint64(1)})
+	require.ErrorIs(err, errHookVeto, "vetoed transaction should fail")
+	require.Equal(quantity.NewFromUint64(99), escrowBalance(addr1), "vetoed transaction should not change state")
+
+	hooks.veto = nil
+	err = execute(pk1, staking.MethodAddEscrow, &staking.Escrow{Account: addr1, Amount: *quantity.NewFromUint64(1)})
+	require.NoError(err, "AddEscrow")
+	require.Equal(quantity.NewFromUint64(100), escrowBalance(addr1), "escrow should be added")
+}
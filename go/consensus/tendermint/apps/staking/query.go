@@ -1,7 +1,10 @@
 package staking
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"sort"
 
 	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
@@ -20,12 +23,17 @@ type Query interface {
 	DebondingInterval(context.Context) (beacon.EpochTime, error)
 	Addresses(context.Context) ([]staking.Address, error)
 	Account(context.Context, staking.Address) (*staking.Account, error)
+	Allowance(context.Context, staking.Address, staking.Address) (*staking.Allowance, error)
+	Allowances(context.Context, staking.Address) (map[staking.Address]*staking.Allowance, error)
+	AccountMetadata(context.Context, staking.Address) ([]byte, error)
+	CommissionSchedule(context.Context, staking.Address) (*staking.CommissionSchedule, error)
 	DelegationsFor(context.Context, staking.Address) (map[staking.Address]*staking.Delegation, error)
 	DelegationInfosFor(context.Context, staking.Address) (map[staking.Address]*staking.DelegationInfo, error)
 	DelegationsTo(context.Context, staking.Address) (map[staking.Address]*staking.Delegation, error)
 	DebondingDelegationsFor(context.Context, staking.Address) (map[staking.Address][]*staking.DebondingDelegation, error)
 	DebondingDelegationInfosFor(context.Context, staking.Address) (map[staking.Address][]*staking.DebondingDelegationInfo, error)
 	DebondingDelegationsTo(context.Context, staking.Address) (map[staking.Address][]*staking.DebondingDelegation, error)
+	EscrowSnapshot(context.Context, beacon.EpochTime) (*staking.EscrowSnapshot, error)
 	Genesis(context.Context) (*staking.Genesis, error)
 	ConsensusParameters(context.Context) (*staking.ConsensusParameters, error)
 }
@@ -41,11 +49,19 @@ func (sf *QueryFactory) QueryAt(ctx context.Context, height int64) (Query, error
 	if err != nil {
 		return nil, err
 	}
-	return &stakingQuerier{state}, nil
+
+	// Resolve the height the state corresponds to as it is needed to determine allowance expiry.
+	if abciCtx := abciAPI.FromCtx(ctx); abciCtx == nil || height != abciCtx.BlockHeight()+1 {
+		if blockHeight := sf.state.BlockHeight(); height <= 0 || height > blockHeight {
+			height = blockHeight
+		}
+	}
+	return &stakingQuerier{state, height}, nil
 }
 
 type stakingQuerier struct {
-	state *stakingState.ImmutableState
+	state  *stakingState.ImmutableState
+	height int64
 }
 
 func (sq *stakingQuerier) TotalSupply(ctx context.Context) (*quantity.Quantity, error) {
@@ -53,15 +69,29 @@ func (sq *stakingQuerier) TotalSupply(ctx context.Context) (*quantity.Quantity,
 }
 
 func (sq *stakingQuerier) CommonPool(ctx context.Context) (*quantity.Quantity, error) {
-	return sq.state.CommonPool(ctx)
+	return sq.reservedBalance(ctx, staking.CommonPoolAddress)
 }
 
 func (sq *stakingQuerier) LastBlockFees(ctx context.Context) (*quantity.Quantity, error) {
-	return sq.state.LastBlockFees(ctx)
+	return sq.reservedBalance(ctx, staking.FeeAccumulatorAddress)
 }
 
 func (sq *stakingQuerier) GovernanceDeposits(ctx context.Context) (*quantity.Quantity, error) {
-	return sq.state.GovernanceDeposits(ctx)
+	return sq.reservedBalance(ctx, staking.GovernanceDepositsAddress)
+}
+
+// reservedBalance returns the balance of the given reserved module account.
+func (sq *stakingQuerier) reservedBalance(ctx context.Context, addr staking.Address) (*quantity.Quantity, error) {
+	switch {
+	case addr.Equal(staking.CommonPoolAddress):
+		return sq.state.CommonPool(ctx)
+	case addr.Equal(staking.FeeAccumulatorAddress):
+		return sq.state.LastBlockFees(ctx)
+	case addr.Equal(staking.GovernanceDepositsAddress):
+		return sq.state.GovernanceDeposits(ctx)
+	default:
+		return nil, fmt.Errorf("staking: not a reserved account: %s", addr)
+	}
 }
 
 func (sq *stakingQuerier) Threshold(ctx context.Context, kind staking.ThresholdKind) (*quantity.Quantity, error) {
@@ -82,47 +112,87 @@ func (sq *stakingQuerier) DebondingInterval(ctx context.Context) (beacon.EpochTi
 }
 
 func (sq *stakingQuerier) Addresses(ctx context.Context) ([]staking.Address, error) {
-	return sq.state.Addresses(ctx)
-}
+	addrs, err := sq.state.Addresses(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-func (sq *stakingQuerier) Account(ctx context.Context, addr staking.Address) (*staking.Account, error) {
-	switch {
-	case addr.Equal(staking.CommonPoolAddress):
-		cp, err := sq.state.CommonPool(ctx)
+	// Include reserved module accounts with a non-zero balance.
+	var withReserved bool
+	for _, addr := range staking.ReservedAccountAddresses {
+		balance, err := sq.reservedBalance(ctx, addr)
 		if err != nil {
 			return nil, err
 		}
-		return &staking.Account{
-			General: staking.GeneralAccount{
-				Balance: *cp,
-			},
-		}, nil
-	case addr.Equal(staking.FeeAccumulatorAddress):
-		fa, err := sq.state.LastBlockFees(ctx)
-		if err != nil {
-			return nil, err
+		if balance.IsZero() {
+			continue
 		}
-		return &staking.Account{
-			General: staking.GeneralAccount{
-				Balance: *fa,
-			},
-		}, nil
-	case addr.Equal(staking.GovernanceDepositsAddress):
-		gd, err := sq.state.GovernanceDeposits(ctx)
+		addrs = append(addrs, addr)
+		withReserved = true
+	}
+	if withReserved {
+		sort.Slice(addrs, func(i, j int) bool {
+			return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+		})
+	}
+	return addrs, nil
+}
+
+func (sq *stakingQuerier) Account(ctx context.Context, addr staking.Address) (*staking.Account, error) {
+	switch {
+	case addr.Equal(staking.CommonPoolAddress),
+		addr.Equal(staking.FeeAccumulatorAddress),
+		addr.Equal(staking.GovernanceDepositsAddress):
+		balance, err := sq.reservedBalance(ctx, addr)
 		if err != nil {
 			return nil, err
 		}
 		return &staking.Account{
 			General: staking.GeneralAccount{
-				Balance: *gd,
+				Balance: *balance,
 			},
 		}, nil
+	case addr.Equal(staking.BurnAddress):
+		// The burn address never holds any balance.
+		return &staking.Account{}, nil
 
 	default:
 		return sq.state.Account(ctx, addr)
 	}
 }
 
+func (sq *stakingQuerier) Allowance(ctx context.Context, owner, beneficiary staking.Address) (*staking.Allowance, error) {
+	acct, err := sq.state.Account(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	return acct.General.GetAllowance(beneficiary, sq.height), nil
+}
+
+func (sq *stakingQuerier) Allowances(ctx context.Context, owner staking.Address) (map[staking.Address]*staking.Allowance, error) {
+	acct, err := sq.state.Account(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	return acct.General.GetAllowances(sq.height), nil
+}
+
+func (sq *stakingQuerier) AccountMetadata(ctx context.Context, addr staking.Address) ([]byte, error) {
+	acct, err := sq.state.Account(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return acct.General.Metadata, nil
+}
+
+func (sq *stakingQuerier) CommissionSchedule(ctx context.Context, addr staking.Address) (*staking.CommissionSchedule, error) {
+	acct, err := sq.state.Account(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &acct.Escrow.CommissionSchedule, nil
+}
+
 func (sq *stakingQuerier) DelegationsFor(ctx context.Context, addr staking.Address) (map[staking.Address]*staking.Delegation, error) {
 	return sq.state.DelegationsFor(ctx, addr)
 }
@@ -181,6 +251,10 @@ func (sq *stakingQuerier) DebondingDelegationsTo(ctx context.Context, addr staki
 	return sq.state.DebondingDelegationsTo(ctx, addr)
 }
 
+func (sq *stakingQuerier) EscrowSnapshot(ctx context.Context, epoch beacon.EpochTime) (*staking.EscrowSnapshot, error) {
+	return sq.state.EscrowSnapshot(ctx, epoch)
+}
+
 func (sq *stakingQuerier) ConsensusParameters(ctx context.Context) (*staking.ConsensusParameters, error) {
 	return sq.state.ConsensusParameters(ctx)
 }
@@ -0,0 +1,77 @@
+package staking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	stakingState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking/state"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+func TestQueryReservedAccounts(t *testing.T) {
+	require := require.New(t)
+	var err error
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	stakeState := stakingState.NewMutableState(ctx.State())
+	err = stakeState.SetConsensusParameters(ctx, &staking.ConsensusParameters{})
+	require.NoError(err, "SetConsensusParameters")
+
+	addr := staking.NewAddress(signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"))
+	err = stakeState.SetAccount(ctx, addr, &staking.Account{
+		General: staking.GeneralAccount{
+			Balance: *quantity.NewFromUint64(1000),
+		},
+	})
+	require.NoError(err, "SetAccount")
+	err = stakeState.SetCommonPool(ctx, quantity.NewFromUint64(100))
+	require.NoError(err, "SetCommonPool")
+	err = stakeState.SetLastBlockFees(ctx, quantity.NewQuantity())
+	require.NoError(err, "SetLastBlockFees")
+	err = stakeState.SetGovernanceDeposits(ctx, quantity.NewFromUint64(10))
+	require.NoError(err, "SetGovernanceDeposits")
+	err = stakeState.SetTotalSupply(ctx, quantity.NewFromUint64(1110))
+	require.NoError(err, "SetTotalSupply")
+
+	sq := &stakingQuerier{stakeState.ImmutableState, 1}
+
+	// Reserved accounts with a non-zero balance should be addressable.
+	addrs, err := sq.Addresses(ctx)
+	require.NoError(err, "Addresses")
+	require.ElementsMatch([]staking.Address{addr, staking.CommonPoolAddress, staking.GovernanceDepositsAddress}, addrs,
+		"Addresses should include reserved accounts with a non-zero balance")
+	require.NotContains(addrs, staking.FeeAccumulatorAddress, "Addresses should not include empty reserved accounts")
+
+	var sum quantity.Quantity
+	for _, a := range addrs {
+		var acct *staking.Account
+		acct, err = sq.Account(ctx, a)
+		require.NoError(err, "Account")
+		require.NoError(sum.Add(&acct.General.Balance))
+	}
+	totalSupply, err := sq.TotalSupply(ctx)
+	require.NoError(err, "TotalSupply")
+	require.Equal(*totalSupply, sum, "balances of all addresses should add up to the total supply")
+
+	commonPool, err := sq.CommonPool(ctx)
+	require.NoError(err, "CommonPool")
+	cpAcct, err := sq.Account(ctx, staking.CommonPoolAddress)
+	require.NoError(err, "Account - common pool")
+	require.Equal(*commonPool, cpAcct.General.Balance, "CommonPool should match the common pool account")
+
+	// Genesis export should keep reserved balances out of the ledger.
+	gen, err := sq.Genesis(ctx)
+	require.NoError(err, "Genesis")
+	require.Len(gen.Ledger, 1, "exported ledger should not contain reserved accounts")
+	require.Equal(*quantity.NewFromUint64(100), gen.CommonPool, "exported common pool")
+	require.Equal(*quantity.NewFromUint64(10), gen.GovernanceDeposits, "exported governance deposits")
+}
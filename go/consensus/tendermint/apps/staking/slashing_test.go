@@ -124,7 +124,7 @@ func TestOnEvidenceByzantineConsensus(t *testing.T) {
 	require.NoError(err, "SetAccount")
 
 	// Should slash.
-	err = onEvidenceByzantineConsensus(ctx, staking.SlashConsensusEquivocation, validatorAddress, 1, now, 1)
+	err = onEvidenceByzantineConsensus(ctx, staking.SlashConsensusEquivocation, validatorAddress, 2, now, 1)
 	require.NoError(err, "slashing should succeed")
 
 	// Entity stake should be slashed.
@@ -139,6 +139,22 @@ func TestOnEvidenceByzantineConsensus(t *testing.T) {
 	require.True(status.IsFrozen(), "node should be frozen after slashing")
 	require.EqualValues(registry.FreezeForever, status.FreezeEndTime, "node should be frozen forever")
 
+	// The offense should be recorded.
+	history, err := stakeState.SlashingHistory(ctx, addr)
+	require.NoError(err, "SlashingHistory")
+	require.Len(history, 2, "offenses should be recorded")
+	require.EqualValues(2, history[1].EvidenceHeight, "offense should be recorded")
+	require.EqualValues(slashAmount, history[1].Amount, "slashed amount should be recorded")
+
+	// Should not slash the same offense again.
+	err = regState.SetNodeStatus(ctx, nod.ID, &registry.NodeStatus{FreezeEndTime: 0})
+	require.NoError(err, "SetNodeStatus")
+	err = onEvidenceByzantineConsensus(ctx, staking.SlashConsensusEquivocation, validatorAddress, 2, now, 1)
+	require.NoError(err, "slashing should not fail")
+	acct, err = stakeState.Account(ctx, addr)
+	require.NoError(err, "Account")
+	require.EqualValues(balance, acct.Escrow.Active.Balance, "entity stake should not be slashed twice")
+
 	// Should not fail in case the slashing penalty is not configured.
 	err = onEvidenceByzantineConsensus(ctx, staking.SlashConsensusLightClientAttack, validatorAddress, 1, now, 1)
 	require.NoError(err, "slashing should not fail")
@@ -22,6 +22,7 @@ var _ api.Application = (*stakingApplication)(nil)
 
 type stakingApplication struct {
 	state api.ApplicationState
+	md    api.MessageDispatcher
 }
 
 func (app *stakingApplication) Name() string {
@@ -46,6 +47,7 @@ func (app *stakingApplication) Dependencies() []string {
 
 func (app *stakingApplication) OnRegister(state api.ApplicationState, md api.MessageDispatcher) {
 	app.state = state
+	app.md = md
 
 	// Subscribe to messages emitted by other apps.
 	md.Subscribe(roothashApi.RuntimeMessageStaking, app)
@@ -116,20 +118,26 @@ func (app *stakingApplication) BeginBlock(ctx *api.Context, request types.Reques
 }
 
 func (app *stakingApplication) ExecuteMessage(ctx *api.Context, kind, msg interface{}) error {
-	state := stakingState.NewMutableState(ctx.State())
-
 	switch kind {
 	case roothashApi.RuntimeMessageStaking:
 		m := msg.(*message.StakingMessage)
 		switch {
 		case m.Transfer != nil:
-			return app.transfer(ctx, state, m.Transfer)
+			return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress(), m.Transfer.To}, func(state *stakingState.MutableState) error {
+				return app.transfer(ctx, state, m.Transfer)
+			})
 		case m.Withdraw != nil:
-			return app.withdraw(ctx, state, m.Withdraw)
+			return app.withBalanceHooks(ctx, []staking.Address{m.Withdraw.From, ctx.CallerAddress()}, func(state *stakingState.MutableState) error {
+				return app.withdraw(ctx, state, m.Withdraw)
+			})
 		case m.AddEscrow != nil:
-			return app.addEscrow(ctx, state, m.AddEscrow)
+			return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress(), m.AddEscrow.Account}, func(state *stakingState.MutableState) error {
+				return app.addEscrow(ctx, state, m.AddEscrow)
+			})
 		case m.ReclaimEscrow != nil:
-			return app.reclaimEscrow(ctx, state, m.ReclaimEscrow)
+			return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress(), m.ReclaimEscrow.Account}, func(state *stakingState.MutableState) error {
+				return app.reclaimEscrow(ctx, state, m.ReclaimEscrow)
+			})
 		default:
 			return staking.ErrInvalidArgument
 		}
@@ -148,28 +156,36 @@ func (app *stakingApplication) ExecuteTx(ctx *api.Context, tx *transaction.Trans
 			return err
 		}
 
-		return app.transfer(ctx, state, &xfer)
+		return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress(), xfer.To}, func(state *stakingState.MutableState) error {
+			return app.transfer(ctx, state, &xfer)
+		})
 	case staking.MethodBurn:
 		var burn staking.Burn
 		if err := cbor.Unmarshal(tx.Body, &burn); err != nil {
 			return err
 		}
 
-		return app.burn(ctx, state, &burn)
+		return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress()}, func(state *stakingState.MutableState) error {
+			return app.burn(ctx, state, &burn)
+		})
 	case staking.MethodAddEscrow:
 		var escrow staking.Escrow
 		if err := cbor.Unmarshal(tx.Body, &escrow); err != nil {
 			return err
 		}
 
-		return app.addEscrow(ctx, state, &escrow)
+		return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress(), escrow.Account}, func(state *stakingState.MutableState) error {
+			return app.addEscrow(ctx, state, &escrow)
+		})
 	case staking.MethodReclaimEscrow:
 		var reclaim staking.ReclaimEscrow
 		if err := cbor.Unmarshal(tx.Body, &reclaim); err != nil {
 			return err
 		}
 
-		return app.reclaimEscrow(ctx, state, &reclaim)
+		return app.withBalanceHooks(ctx, []staking.Address{ctx.CallerAddress(), reclaim.Account}, func(state *stakingState.MutableState) error {
+			return app.reclaimEscrow(ctx, state, &reclaim)
+		})
 	case staking.MethodAmendCommissionSchedule:
 		var amend staking.AmendCommissionSchedule
 		if err := cbor.Unmarshal(tx.Body, &amend); err != nil {
@@ -190,7 +206,30 @@ func (app *stakingApplication) ExecuteTx(ctx *api.Context, tx *transaction.Trans
 			return err
 		}
 
-		return app.withdraw(ctx, state, &withdraw)
+		return app.withBalanceHooks(ctx, []staking.Address{withdraw.From, ctx.CallerAddress()}, func(state *stakingState.MutableState) error {
+			return app.withdraw(ctx, state, &withdraw)
+		})
+	case staking.MethodAccountUpdate:
+		var update staking.AccountUpdate
+		if err := cbor.Unmarshal(tx.Body, &update); err != nil {
+			return err
+		}
+
+		return app.accountUpdate(ctx, state, &update)
+	case staking.MethodSetMetadata:
+		var sm staking.SetMetadata
+		if err := cbor.Unmarshal(tx.Body, &sm); err != nil {
+			return err
+		}
+
+		return app.setMetadata(ctx, state, &sm)
+	case staking.MethodSetTransferLimit:
+		var stl staking.SetTransferLimit
+		if err := cbor.Unmarshal(tx.Body, &stl); err != nil {
+			return err
+		}
+
+		return app.setTransferLimit(ctx, state, &stl)
 	default:
 		return staking.ErrInvalidArgument
 	}
@@ -282,10 +321,11 @@ func (app *stakingApplication) onEpochChange(ctx *api.Context, epoch beacon.Epoc
 		)
 
 		ctx.EmitEvent(api.NewEventBuilder(app.Name()).TypedAttribute(&staking.ReclaimEscrowEvent{
-			Owner:  e.DelegatorAddr,
-			Escrow: e.EscrowAddr,
-			Amount: *stakeAmount,
-			Shares: *shareAmount,
+			Owner:    e.DelegatorAddr,
+			Escrow:   e.EscrowAddr,
+			Amount:   *stakeAmount,
+			Shares:   *shareAmount,
+			Balances: staking.NewEscrowBalances(delegator, escrow),
 		}))
 	}
 
@@ -297,6 +337,15 @@ func (app *stakingApplication) onEpochChange(ctx *api.Context, epoch beacon.Epoc
 		return fmt.Errorf("staking/tendermint: failed to add signing rewards: %w", err)
 	}
 
+	// Snapshot escrow balances for the new epoch.
+	params, err := state.ConsensusParameters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load staking consensus parameters: %w", err)
+	}
+	if err = state.SnapshotEscrow(ctx, epoch, params.EscrowSnapshotRetention); err != nil {
+		return fmt.Errorf("staking/tendermint: failed to snapshot escrow: %w", err)
+	}
+
 	return nil
 }
 
@@ -112,6 +112,11 @@ func NewStakeAccumulatorCache(ctx *abciAPI.Context) (*StakeAccumulatorCache, err
 	if err != nil {
 		return nil, fmt.Errorf("staking/tendermint: failed to query thresholds: %w", err)
 	}
+	// The thresholds are shared between operations, make sure they are not mutated in place.
+	for kind, q := range thresholds {
+		q.MarkStateOwned()
+		thresholds[kind] = q
+	}
 
 	return &StakeAccumulatorCache{
 		ctx:        ctx,
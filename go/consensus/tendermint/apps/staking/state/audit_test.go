@@ -0,0 +1,47 @@
+//go:build quantityaudit
+// +build quantityaudit
+
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+func TestAuditSharedQuantities(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	// Mutating the per-block fee accumulator through aliases should panic.
+	feeAcc := ctx.BlockContext().Get(feeAccumulatorKey{}).(*feeAccumulator)
+	require.Panics(func() { _ = feeAcc.balance.Add(quantity.NewFromUint64(1)) }, "mutating the fee accumulator")
+
+	// Block fees are returned as a copy which can be mutated.
+	fees := BlockFees(ctx)
+	require.NotPanics(func() { _ = fees.Add(quantity.NewFromUint64(1)) }, "mutating a copy of the block fees")
+	require.True(feeAcc.balance.IsZero(), "block fees should be unchanged")
+
+	// Mutating the cached thresholds through aliases should panic.
+	stakeState := NewMutableState(ctx.State())
+	err := stakeState.SetConsensusParameters(ctx, &staking.ConsensusParameters{
+		Thresholds: map[staking.ThresholdKind]quantity.Quantity{
+			staking.KindEntity: *quantity.NewFromUint64(1_000),
+		},
+	})
+	require.NoError(err, "SetConsensusParameters")
+
+	acc, err := NewStakeAccumulatorCache(ctx)
+	require.NoError(err, "NewStakeAccumulatorCache")
+	threshold := acc.thresholds[staking.KindEntity]
+	require.Panics(func() { _ = threshold.Sub(quantity.NewFromUint64(1)) }, "mutating a cached threshold")
+}
@@ -15,26 +15,29 @@ import (
 type feeAccumulatorKey struct{}
 
 func (fak feeAccumulatorKey) NewDefault() interface{} {
-	return &feeAccumulator{}
+	var feeAcc feeAccumulator
+	feeAcc.balance.MarkStateOwned()
+	return &feeAcc
 }
 
 // feeAccumulator is the per-block fee accumulator that gets all fees paid
 // in a block.
+//
+// The balance is shared by all transactions in a block, so it is marked as
+// state-owned and must only be updated via quantity.Quantity.Set.
 type feeAccumulator struct {
 	balance quantity.Quantity
 }
 
-// AuthenticateAndPayFees authenticates the message signer and makes sure that
-// any gas fees are paid.
+// AuthenticateAndPayFees authenticates the transaction caller and makes sure
+// that any gas fees are paid.
+//
+// The transaction signer(s) must be allowed to act on behalf of the caller's
+// account, see staking.Account.AuthenticateSigners.
 //
 // This method transfers the fees to the per-block fee accumulator which is
 // persisted at the end of the block.
-func AuthenticateAndPayFees(
-	ctx *abciAPI.Context,
-	signer signature.PublicKey,
-	nonce uint64,
-	fee *transaction.Fee,
-) error {
+func AuthenticateAndPayFees(ctx *abciAPI.Context, tx *transaction.Transaction) error {
 	state := NewMutableState(ctx.State())
 
 	if ctx.IsSimulation() {
@@ -45,17 +48,25 @@ func AuthenticateAndPayFees(
 		return nil
 	}
 
-	// Convert signer's public key to account address.
-	addr := staking.NewAddress(signer)
+	addr := ctx.CallerAddress()
 	if addr.IsReserved() {
 		return fmt.Errorf("using reserved account address %s is prohibited", addr)
 	}
 
-	// Fetch account and make sure the nonce is correct.
+	// Fetch account and make sure the signers are authorized and the nonce is correct.
 	account, err := state.Account(ctx, addr)
 	if err != nil {
 		return fmt.Errorf("failed to fetch account state: %w", err)
 	}
+	if err = account.AuthenticateSigners(tx.Method, ctx.TxMultiSigners()); err != nil {
+		logger.Debug("unauthorized transaction signers",
+			"account_addr", addr,
+			"method", tx.Method,
+			"err", err,
+		)
+		return err
+	}
+	nonce := tx.Nonce
 	if account.General.Nonce != nonce {
 		logger.Error("invalid account nonce",
 			"account_addr", addr,
@@ -65,6 +76,7 @@ func AuthenticateAndPayFees(
 		return transaction.ErrInvalidNonce
 	}
 
+	fee := tx.Fee
 	if fee == nil {
 		fee = &transaction.Fee{}
 	}
@@ -94,9 +106,14 @@ func AuthenticateAndPayFees(
 
 	// Transfer fee to per-block fee accumulator.
 	feeAcc := ctx.BlockContext().Get(feeAccumulatorKey{}).(*feeAccumulator)
-	if err := quantity.Move(&feeAcc.balance, &account.General.Balance, &fee.Amount); err != nil {
+	if err = account.General.Balance.Sub(&fee.Amount); err != nil {
+		return fmt.Errorf("staking: failed to pay fees: %w", err)
+	}
+	balance, err := feeAcc.balance.AddQ(&fee.Amount)
+	if err != nil {
 		return fmt.Errorf("staking: failed to pay fees: %w", err)
 	}
+	feeAcc.balance.Set(balance)
 
 	account.General.Nonce++
 	if err := state.SetAccount(ctx, addr, account); err != nil {
@@ -121,10 +138,10 @@ func AuthenticateAndPayFees(
 	return nil
 }
 
-// BlockFees returns the accumulated fee balance for the current block.
+// BlockFees returns a copy of the accumulated fee balance for the current block.
 func BlockFees(ctx *abciAPI.Context) quantity.Quantity {
 	// Fetch accumulated fees in the current block.
-	return ctx.BlockContext().Get(feeAccumulatorKey{}).(*feeAccumulator).balance
+	return *ctx.BlockContext().Get(feeAccumulatorKey{}).(*feeAccumulator).balance.Clone()
 }
 
 // proposerKey is the block context key.
@@ -65,6 +65,20 @@ var (
 	//
 	// Value is a CBOR-serialized quantity.
 	governanceDepositsKeyFmt = keyformat.New(0x59)
+	// escrowSnapshotKeyFmt is the key format used for escrow snapshots (epoch).
+	//
+	// Value is CBOR-serialized staking.EscrowSnapshot.
+	escrowSnapshotKeyFmt = keyformat.New(0x5a, uint64(0))
+	// reapedAccountKeyFmt is the key format used for the retained nonces of reaped accounts
+	// (account address).
+	//
+	// Value is a CBOR-serialized nonce.
+	reapedAccountKeyFmt = keyformat.New(0x5b, &staking.Address{})
+	// slashingHistoryKeyFmt is the key format used for the slashing history of escrow accounts
+	// (account address, slash reason, evidence height).
+	//
+	// Value is CBOR-serialized staking.SlashRecord.
+	slashingHistoryKeyFmt = keyformat.New(0x5c, &staking.Address{}, uint8(0), int64(0))
 
 	logger = logging.GetLogger("tendermint/staking")
 )
@@ -185,7 +199,12 @@ func (s *ImmutableState) Account(ctx context.Context, address staking.Address) (
 		return nil, abciAPI.UnavailableStateError(err)
 	}
 	if value == nil {
-		return &staking.Account{}, nil
+		// Reaped accounts retain their nonce.
+		var nonce uint64
+		if nonce, err = s.reapedAccountNonce(ctx, address); err != nil {
+			return nil, err
+		}
+		return staking.NewReapedAccount(nonce), nil
 	}
 
 	var ent staking.Account
@@ -195,6 +214,46 @@ func (s *ImmutableState) Account(ctx context.Context, address staking.Address) (
 	return &ent, nil
 }
 
+func (s *ImmutableState) reapedAccountNonce(ctx context.Context, address staking.Address) (uint64, error) {
+	value, err := s.is.Get(ctx, reapedAccountKeyFmt.Encode(&address))
+	if err != nil {
+		return 0, abciAPI.UnavailableStateError(err)
+	}
+	if value == nil {
+		return 0, nil
+	}
+
+	var nonce uint64
+	if err = cbor.Unmarshal(value, &nonce); err != nil {
+		return 0, abciAPI.UnavailableStateError(err)
+	}
+	return nonce, nil
+}
+
+// ReapedAccounts returns the retained nonces of all reaped accounts that have not been re-created.
+func (s *ImmutableState) ReapedAccounts(ctx context.Context) (map[staking.Address]uint64, error) {
+	it := s.is.NewIterator(ctx)
+	defer it.Close()
+
+	reaped := make(map[staking.Address]uint64)
+	for it.Seek(reapedAccountKeyFmt.Encode()); it.Valid(); it.Next() {
+		var addr staking.Address
+		if !reapedAccountKeyFmt.Decode(it.Key(), &addr) {
+			break
+		}
+
+		var nonce uint64
+		if err := cbor.Unmarshal(it.Value(), &nonce); err != nil {
+			return nil, abciAPI.UnavailableStateError(err)
+		}
+		reaped[addr] = nonce
+	}
+	if it.Err() != nil {
+		return nil, abciAPI.UnavailableStateError(it.Err())
+	}
+	return reaped, nil
+}
+
 // EscrowBalance returns the escrow balance for the given account address.
 func (s *ImmutableState) EscrowBalance(ctx context.Context, address staking.Address) (*quantity.Quantity, error) {
 	account, err := s.Account(ctx, address)
@@ -478,6 +537,55 @@ func (s *ImmutableState) Slashing(ctx context.Context) (map[staking.SlashReason]
 	return params.Slashing, nil
 }
 
+// SlashRecord returns the record of the given offense of the given escrow account or nil in case
+// the account has not been slashed for the offense.
+func (s *ImmutableState) SlashRecord(
+	ctx context.Context,
+	addr staking.Address,
+	reason staking.SlashReason,
+	evidenceHeight int64,
+) (*staking.SlashRecord, error) {
+	value, err := s.is.Get(ctx, slashingHistoryKeyFmt.Encode(&addr, uint8(reason), evidenceHeight))
+	if err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	var record staking.SlashRecord
+	if err = cbor.Unmarshal(value, &record); err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	return &record, nil
+}
+
+// SlashingHistory returns the records of all offenses the given escrow account has been slashed
+// for, ordered by slash reason and evidence height.
+func (s *ImmutableState) SlashingHistory(ctx context.Context, addr staking.Address) ([]*staking.SlashRecord, error) {
+	var (
+		records []*staking.SlashRecord
+		decErr  error
+	)
+	_, err := abciAPI.IterateKeyFormat(ctx, s.is, slashingHistoryKeyFmt, []interface{}{&addr}, nil,
+		func(_ []interface{}, value []byte) bool {
+			var record staking.SlashRecord
+			if decErr = cbor.Unmarshal(value, &record); decErr != nil {
+				return false
+			}
+			records = append(records, &record)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	if decErr != nil {
+		return nil, abciAPI.UnavailableStateError(decErr)
+	}
+	return records, nil
+}
+
 // LastBlockFees returns the last block fees balance.
 func (s *ImmutableState) LastBlockFees(ctx context.Context) (*quantity.Quantity, error) {
 	return s.loadStoredBalance(ctx, lastBlockFeesKeyFmt)
@@ -488,6 +596,42 @@ func (s *ImmutableState) GovernanceDeposits(ctx context.Context) (*quantity.Quan
 	return s.loadStoredBalance(ctx, governanceDepositsKeyFmt)
 }
 
+// EscrowSnapshot returns the escrow snapshot taken at the transition to the given epoch.
+func (s *ImmutableState) EscrowSnapshot(ctx context.Context, epoch beacon.EpochTime) (*staking.EscrowSnapshot, error) {
+	raw, err := s.is.Get(ctx, escrowSnapshotKeyFmt.Encode(uint64(epoch)))
+	if err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	if raw == nil {
+		return nil, staking.ErrEscrowSnapshotNotFound
+	}
+
+	var snapshot staking.EscrowSnapshot
+	if err = cbor.Unmarshal(raw, &snapshot); err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+	return &snapshot, nil
+}
+
+// escrowSnapshotEpochs returns the epochs of all stored escrow snapshots in ascending order.
+func (s *ImmutableState) escrowSnapshotEpochs(ctx context.Context) ([]beacon.EpochTime, error) {
+	it := s.is.NewIterator(ctx)
+	defer it.Close()
+
+	var epochs []beacon.EpochTime
+	for it.Seek(escrowSnapshotKeyFmt.Encode()); it.Valid(); it.Next() {
+		var epoch uint64
+		if !escrowSnapshotKeyFmt.Decode(it.Key(), &epoch) {
+			break
+		}
+		epochs = append(epochs, beacon.EpochTime(epoch))
+	}
+	if it.Err() != nil {
+		return nil, abciAPI.UnavailableStateError(it.Err())
+	}
+	return epochs, nil
+}
+
 type EpochSigning struct {
 	Total    uint64
 	ByEntity map[signature.PublicKey]uint64
@@ -567,8 +711,77 @@ type MutableState struct {
 	ms mkvs.KeyValueTree
 }
 
+// SetAccount sets the given account in the ledger.
+//
+// In case the account does not yet exist in the ledger, its creation height is set to the current
+// block height (unless already set, e.g., in the genesis document), any retained nonce of a
+// previously reaped account is cleared and an AccountCreatedEvent is emitted.
 func (s *MutableState) SetAccount(ctx context.Context, addr staking.Address, account *staking.Account) error {
-	err := s.ms.Insert(ctx, accountKeyFmt.Encode(&addr), cbor.Marshal(account))
+	key := accountKeyFmt.Encode(&addr)
+	existing, err := s.ms.Get(ctx, key)
+	if err != nil {
+		return abciAPI.UnavailableStateError(err)
+	}
+	if existing == nil {
+		if err = s.createAccount(ctx, addr, account); err != nil {
+			return err
+		}
+	}
+
+	err = s.ms.Insert(ctx, key, cbor.Marshal(account))
+	return abciAPI.UnavailableStateError(err)
+}
+
+func (s *MutableState) createAccount(ctx context.Context, addr staking.Address, account *staking.Account) error {
+	abciCtx := abciAPI.FromCtx(ctx)
+	if account.General.CreatedAt == 0 && abciCtx != nil {
+		// The current height is one more than the last committed height.
+		account.General.CreatedAt = abciCtx.BlockHeight() + 1
+		if initialHeight := abciCtx.InitialHeight(); account.General.CreatedAt < initialHeight {
+			account.General.CreatedAt = initialHeight
+		}
+	}
+	if err := s.ms.Remove(ctx, reapedAccountKeyFmt.Encode(&addr)); err != nil {
+		return abciAPI.UnavailableStateError(err)
+	}
+
+	if abciCtx != nil {
+		abciCtx.EmitEvent(abciAPI.NewEventBuilder(AppName).TypedAttribute(&staking.AccountCreatedEvent{
+			Account: addr,
+			Nonce:   account.General.Nonce,
+		}))
+	}
+	return nil
+}
+
+// RemoveAccount reaps the given account from the ledger.
+//
+// The account nonce is retained so that it is continued from in case the account is re-created
+// and an AccountReapedEvent is emitted.
+func (s *MutableState) RemoveAccount(ctx context.Context, addr staking.Address) error {
+	account, err := s.Account(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if err = s.ms.Remove(ctx, accountKeyFmt.Encode(&addr)); err != nil {
+		return abciAPI.UnavailableStateError(err)
+	}
+	if err = s.SetReapedAccount(ctx, addr, account.General.Nonce); err != nil {
+		return err
+	}
+
+	if abciCtx := abciAPI.FromCtx(ctx); abciCtx != nil {
+		abciCtx.EmitEvent(abciAPI.NewEventBuilder(AppName).TypedAttribute(&staking.AccountReapedEvent{
+			Account: addr,
+			Nonce:   account.General.Nonce,
+		}))
+	}
+	return nil
+}
+
+// SetReapedAccount sets the retained nonce of the given reaped account.
+func (s *MutableState) SetReapedAccount(ctx context.Context, addr staking.Address, nonce uint64) error {
+	err := s.ms.Insert(ctx, reapedAccountKeyFmt.Encode(&addr), cbor.Marshal(nonce))
 	return abciAPI.UnavailableStateError(err)
 }
 
@@ -692,6 +905,63 @@ func (s *MutableState) SetGovernanceDeposits(ctx context.Context, q *quantity.Qu
 	return abciAPI.UnavailableStateError(err)
 }
 
+// SnapshotEscrow stores a snapshot of the active escrow pools of all accounts for the given epoch
+// and removes all snapshots that fall outside of the retention window of the given number of
+// most recent epochs. A zero retention removes all snapshots and does not store a new one.
+//
+// NOTE: This method must only be called from EndBlock contexts at epoch transitions.
+func (s *MutableState) SnapshotEscrow(ctx context.Context, epoch beacon.EpochTime, retention uint64) error {
+	if err := s.is.CheckContextMode(ctx, []abciAPI.ContextMode{abciAPI.ContextEndBlock}); err != nil {
+		return err
+	}
+
+	// Remove snapshots outside of the retention window.
+	epochs, err := s.escrowSnapshotEpochs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range epochs {
+		if retention > 0 && uint64(e)+retention > uint64(epoch) {
+			break
+		}
+		if err = s.ms.Remove(ctx, escrowSnapshotKeyFmt.Encode(uint64(e))); err != nil {
+			return abciAPI.UnavailableStateError(err)
+		}
+	}
+	if retention == 0 {
+		return nil
+	}
+
+	snapshot := staking.EscrowSnapshot{
+		Epoch:  epoch,
+		Escrow: make(map[staking.Address]staking.SharePool),
+	}
+	it := s.is.NewIterator(ctx)
+	defer it.Close()
+
+	for it.Seek(accountKeyFmt.Encode()); it.Valid(); it.Next() {
+		var addr staking.Address
+		if !accountKeyFmt.Decode(it.Key(), &addr) {
+			break
+		}
+
+		var acct staking.Account
+		if err = cbor.Unmarshal(it.Value(), &acct); err != nil {
+			return abciAPI.UnavailableStateError(err)
+		}
+		if acct.Escrow.Active.Balance.IsZero() {
+			continue
+		}
+		snapshot.Escrow[addr] = acct.Escrow.Active
+	}
+	if it.Err() != nil {
+		return abciAPI.UnavailableStateError(it.Err())
+	}
+
+	err = s.ms.Insert(ctx, escrowSnapshotKeyFmt.Encode(uint64(epoch)), cbor.Marshal(&snapshot))
+	return abciAPI.UnavailableStateError(err)
+}
+
 func slashPool(dst *quantity.Quantity, p *staking.SharePool, amount, total *quantity.Quantity) error {
 	if total.IsZero() {
 		// Nothing to slash.
@@ -753,9 +1023,7 @@ func (s *MutableState) SlashEscrow(
 		return &slashed, nil
 	}
 
-	totalSlashed := slashed.Clone()
-
-	if err = quantity.Move(commonPool, &slashed, totalSlashed); err != nil {
+	if commonPool, err = commonPool.AddQ(&slashed); err != nil {
 		return nil, fmt.Errorf("tendermint/staking: failed moving stake to common pool: %w", err)
 	}
 
@@ -769,11 +1037,86 @@ func (s *MutableState) SlashEscrow(
 	if !ctx.IsCheckOnly() {
 		ctx.EmitEvent(abciAPI.NewEventBuilder(AppName).TypedAttribute(&staking.TakeEscrowEvent{
 			Owner:  fromAddr,
-			Amount: *totalSlashed,
+			Amount: slashed,
 		}))
 	}
 
-	return totalSlashed, nil
+	return &slashed, nil
+}
+
+// Slash slashes the escrow account for the given offense as configured in the slashing
+// consensus parameters, transferring the penalty to the global common pool and returning the
+// amount actually slashed. The offense is recorded in the slashing history of the account and
+// a SlashEvent is emitted.
+//
+// An offense is identified by the account, the slash reason and the evidence height, and is only
+// slashed once. Repeated offenses are ignored and nothing is slashed. Offenses with reasons that
+// have no configured penalty are ignored as well.
+//
+// WARNING: This is an internal routine to be used to implement staking policy,
+// and MUST NOT be exposed outside of backend implementations.
+func (s *MutableState) Slash(
+	ctx *abciAPI.Context,
+	addr staking.Address,
+	reason staking.SlashReason,
+	evidenceHeight int64,
+) (*quantity.Quantity, error) {
+	record, err := s.SlashRecord(ctx, addr, reason, evidenceHeight)
+	if err != nil {
+		return nil, fmt.Errorf("tendermint/staking: failed to query slashing history: %w", err)
+	}
+	if record != nil {
+		// Already slashed for this offense.
+		return &quantity.Quantity{}, nil
+	}
+
+	st, err := s.Slashing(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tendermint/staking: failed to query slashing table: %w", err)
+	}
+	penalty, ok := st[reason]
+	if !ok {
+		return &quantity.Quantity{}, nil
+	}
+
+	acct, err := s.Account(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("tendermint/staking: failed to query account %s: %w", addr, err)
+	}
+	escrow := acct.Escrow.Active.Balance.Clone()
+	if err = escrow.Add(&acct.Escrow.Debonding.Balance); err != nil {
+		return nil, fmt.Errorf("tendermint/staking: account total balance: %w", err)
+	}
+	amount, err := penalty.Penalty(escrow)
+	if err != nil {
+		return nil, fmt.Errorf("tendermint/staking: failed to compute penalty for %s: %w", reason, err)
+	}
+
+	slashed, err := s.SlashEscrow(ctx, addr, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	record = &staking.SlashRecord{
+		Reason:         reason,
+		EvidenceHeight: evidenceHeight,
+		Height:         ctx.BlockHeight(),
+		Amount:         *slashed.Clone(),
+	}
+	if err = s.ms.Insert(ctx, slashingHistoryKeyFmt.Encode(&addr, uint8(reason), evidenceHeight), cbor.Marshal(record)); err != nil {
+		return nil, abciAPI.UnavailableStateError(err)
+	}
+
+	if !ctx.IsCheckOnly() {
+		ctx.EmitEvent(abciAPI.NewEventBuilder(AppName).TypedAttribute(&staking.SlashEvent{
+			Owner:          addr,
+			Reason:         reason,
+			EvidenceHeight: evidenceHeight,
+			Amount:         *slashed.Clone(),
+		}))
+	}
+
+	return slashed, nil
 }
 
 // TransferFromCommon transfers up to the amount from the global common pool
@@ -933,7 +1276,10 @@ func (s *MutableState) TransferToGovernanceDeposits(
 		return fmt.Errorf("tendermint/staking: failed to query governance deposit for deposit %w", err)
 	}
 
-	if err = quantity.Move(deposits, &from.General.Balance, amount); err != nil {
+	if err = from.General.Balance.Sub(amount); err != nil {
+		return fmt.Errorf("tendermint/staking: failed to transfer to governance deposits, from: %s: %w", fromAddr, err)
+	}
+	if deposits, err = deposits.AddQ(amount); err != nil {
 		return fmt.Errorf("tendermint/staking: failed to transfer to governance deposits, from: %s: %w", fromAddr, err)
 	}
 
@@ -972,7 +1318,10 @@ func (s *MutableState) TransferFromGovernanceDeposits(
 		return fmt.Errorf("tendermint/staking: failed to query governance deposit %w", err)
 	}
 
-	if err = quantity.Move(&to.General.Balance, deposits, amount); err != nil {
+	if deposits, err = deposits.SubQ(amount); err != nil {
+		return fmt.Errorf("tendermint/staking: failed to transfer from governance deposits, to: %s: %w", toAddr, err)
+	}
+	if err = to.General.Balance.Add(amount); err != nil {
 		return fmt.Errorf("tendermint/staking: failed to transfer from governance deposits, to: %s: %w", toAddr, err)
 	}
 
@@ -1010,7 +1359,10 @@ func (s *MutableState) DiscardGovernanceDeposit(
 		return fmt.Errorf("tendermint/staking: failed to query governance deposit %w", err)
 	}
 
-	if err = quantity.Move(commonPool, deposits, amount); err != nil {
+	if deposits, err = deposits.SubQ(amount); err != nil {
+		return fmt.Errorf("tendermint/staking: failed to transfer from governance deposits, to common pool: %w", err)
+	}
+	if commonPool, err = commonPool.AddQ(amount); err != nil {
 		return fmt.Errorf("tendermint/staking: failed to transfer from governance deposits, to common pool: %w", err)
 	}
 
@@ -2,6 +2,7 @@ package state
 
 import (
 	"crypto/rand"
+	"fmt"
 	"math/big"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
 	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
 	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
 )
@@ -274,6 +276,10 @@ func TestRewardAndSlash(t *testing.T) {
 	err = s.SetDebondingDelegation(ctx, delegatorAddr, escrowAddr, 1, &deb)
 	require.NoError(err, "SetDebondingDelegation")
 
+	// Use a fresh context so that only events emitted by adding rewards are collected.
+	ctx = appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
 	// Epoch 10 is during the first step.
 	require.NoError(s.AddRewards(ctx, 10, mustInitQuantityP(t, 100_000), escrowAddrAsList), "add rewards epoch 10")
 
@@ -396,6 +402,111 @@ func TestRewardAndSlash(t *testing.T) {
 	require.Equal(mustInitQuantityP(t, 9827), commonPool, "reward attenuated - common pool")
 }
 
+func TestAddRewardsCommission(t *testing.T) {
+	require := require.New(t)
+
+	rules := staking.CommissionScheduleRules{
+		RateChangeInterval: 10,
+		RateBoundLead:      30,
+		MaxRateSteps:       4,
+		MaxBoundSteps:      12,
+	}
+
+	escrowAddr := staking.NewAddress(memorySigner.NewTestSigner("staking/state_test: commission escrow").Public())
+	escrowAccount := &staking.Account{}
+	escrowAccount.Escrow.CommissionSchedule = staking.CommissionSchedule{
+		Rates: []staking.CommissionRateStep{
+			{Start: 0, Rate: mustInitQuantity(t, 12_345)}, // 12.345%
+		},
+		Bounds: []staking.CommissionRateBoundStep{
+			{Start: 0, RateMin: mustInitQuantity(t, 0), RateMax: mustInitQuantity(t, 50_000)},
+		},
+	}
+	err := escrowAccount.Escrow.CommissionSchedule.PruneAndValidateForGenesis(&rules, 0)
+	require.NoError(err, "commission schedule")
+
+	// Two delegators with 100 and 300 base units in escrow.
+	var delegatorAddrs []staking.Address
+	var delegations []*staking.Delegation
+	for i, amount := range []int64{100, 300} {
+		addr := staking.NewAddress(memorySigner.NewTestSigner(fmt.Sprintf("staking/state_test: commission delegator %d", i)).Public())
+		delegatorAddrs = append(delegatorAddrs, addr)
+
+		src := mustInitQuantity(t, amount)
+		del := &staking.Delegation{}
+		_, err = escrowAccount.Escrow.Active.Deposit(&del.Shares, &src, mustInitQuantityP(t, amount))
+		require.NoError(err, "active escrow deposit")
+		delegations = append(delegations, del)
+	}
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+	err = s.SetConsensusParameters(ctx, &staking.ConsensusParameters{
+		RewardSchedule: []staking.RewardStep{
+			{Until: 30, Scale: mustInitQuantity(t, 1000)},
+		},
+		CommissionScheduleRules: rules,
+	})
+	require.NoError(err, "SetConsensusParameters")
+	err = s.SetCommonPool(ctx, mustInitQuantityP(t, 10000))
+	require.NoError(err, "SetCommonPool")
+	err = s.SetAccount(ctx, escrowAddr, escrowAccount)
+	require.NoError(err, "SetAccount")
+	for i, addr := range delegatorAddrs {
+		err = s.SetDelegation(ctx, addr, escrowAddr, delegations[i])
+		require.NoError(err, "SetDelegation")
+	}
+
+	// The reward is 400 base units, of which 49 (12.345%, rounded down) are commission. The
+	// remaining 351 are added to the pool first, so the commission buys 49 * 400 / 751 = 26
+	// shares.
+	err = s.AddRewards(ctx, 10, mustInitQuantityP(t, 100_000), []staking.Address{escrowAddr})
+	require.NoError(err, "AddRewards")
+
+	escrowAccount, err = s.Account(ctx, escrowAddr)
+	require.NoError(err, "Account")
+	require.Equal(mustInitQuantity(t, 800), escrowAccount.Escrow.Active.Balance, "escrow active balance")
+	require.Equal(mustInitQuantity(t, 426), escrowAccount.Escrow.Active.TotalShares, "escrow active total shares")
+	commonPool, err := s.CommonPool(ctx)
+	require.NoError(err, "CommonPool")
+	require.Equal(mustInitQuantityP(t, 9600), commonPool, "common pool")
+
+	selfDel, err := s.Delegation(ctx, escrowAddr, escrowAddr)
+	require.NoError(err, "Delegation")
+	require.Equal(mustInitQuantity(t, 26), selfDel.Shares, "commission should be credited to the self-delegation")
+
+	for i, expected := range []struct {
+		shares, stake int64
+	}{
+		{26, 48},
+		{100, 187},
+		{300, 563},
+	} {
+		owner := escrowAddr
+		if i > 0 {
+			owner = delegatorAddrs[i-1]
+		}
+		del, grr := s.Delegation(ctx, owner, escrowAddr)
+		require.NoError(grr, "Delegation")
+		require.Equal(mustInitQuantity(t, expected.shares), del.Shares, "delegation shares")
+		stake, grr := escrowAccount.Escrow.Active.StakeForShares(&del.Shares)
+		require.NoError(grr, "StakeForShares")
+		require.Equal(mustInitQuantityP(t, expected.stake), stake, "delegation stake")
+	}
+
+	// Amendments setting a rate outside of the bounds should be rejected.
+	err = escrowAccount.Escrow.CommissionSchedule.AmendAndPruneAndValidate(&staking.CommissionSchedule{
+		Rates: []staking.CommissionRateStep{
+			{Start: 20, Rate: mustInitQuantity(t, 60_000)},
+		},
+	}, &rules, 10)
+	require.ErrorIs(err, staking.ErrCommissionRateOutOfBounds, "AmendAndPruneAndValidate with rate out of bounds")
+}
+
 func TestEpochSigning(t *testing.T) {
 	require := require.New(t)
 
@@ -648,3 +759,273 @@ func TestTransferFromCommon(t *testing.T) {
 	require.EqualValues(*quantity.NewFromUint64(100), acc1.General.Balance, "amount should be unchanged")
 	require.EqualValues(*quantity.NewFromUint64(0), acc1.Escrow.Active.Balance, "escrow amount should be unchanged")
 }
+
+func TestEscrowSnapshot(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+	addr1 := staking.NewAddress(signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"))
+	addr2 := staking.NewAddress(signature.NewPublicKey("bbbfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"))
+
+	acc1 := &staking.Account{}
+	acc1.Escrow.Active.Balance = mustInitQuantity(t, 100)
+	acc1.Escrow.Active.TotalShares = mustInitQuantity(t, 10)
+	err := s.SetAccount(ctx, addr1, acc1)
+	require.NoError(err, "SetAccount")
+	acc2 := &staking.Account{}
+	acc2.General.Balance = mustInitQuantity(t, 100)
+	err = s.SetAccount(ctx, addr2, acc2)
+	require.NoError(err, "SetAccount")
+
+	_, err = s.EscrowSnapshot(ctx, 1)
+	require.ErrorIs(err, staking.ErrEscrowSnapshotNotFound, "EscrowSnapshot should fail for missing snapshots")
+
+	err = s.SnapshotEscrow(ctx, 1, 2)
+	require.NoError(err, "SnapshotEscrow")
+	snapshot, err := s.EscrowSnapshot(ctx, 1)
+	require.NoError(err, "EscrowSnapshot")
+	require.EqualValues(1, snapshot.Epoch, "snapshot epoch")
+	require.Len(snapshot.Escrow, 1, "only accounts with active escrow should be included")
+	require.Equal(acc1.Escrow.Active, snapshot.Escrow[addr1], "snapshot should contain the active escrow pool")
+
+	// Changing balances after the snapshot should not affect it.
+	acc1.Escrow.Active.Balance = mustInitQuantity(t, 200)
+	err = s.SetAccount(ctx, addr1, acc1)
+	require.NoError(err, "SetAccount")
+	snapshot, err = s.EscrowSnapshot(ctx, 1)
+	require.NoError(err, "EscrowSnapshot")
+	require.Equal(mustInitQuantity(t, 100), snapshot.Escrow[addr1].Balance, "snapshot should be unaffected by later changes")
+
+	err = s.SnapshotEscrow(ctx, 2, 2)
+	require.NoError(err, "SnapshotEscrow")
+	snapshot, err = s.EscrowSnapshot(ctx, 2)
+	require.NoError(err, "EscrowSnapshot")
+	require.Equal(mustInitQuantity(t, 200), snapshot.Escrow[addr1].Balance, "new snapshot should reflect the changes")
+	_, err = s.EscrowSnapshot(ctx, 1)
+	require.NoError(err, "snapshots within the retention window should be kept")
+
+	// Snapshots outside of the retention window should be pruned.
+	err = s.SnapshotEscrow(ctx, 3, 2)
+	require.NoError(err, "SnapshotEscrow")
+	_, err = s.EscrowSnapshot(ctx, 1)
+	require.ErrorIs(err, staking.ErrEscrowSnapshotNotFound, "snapshots outside of the retention window should be pruned")
+	_, err = s.EscrowSnapshot(ctx, 2)
+	require.NoError(err, "EscrowSnapshot")
+
+	// Disabling snapshots should remove all of them.
+	err = s.SnapshotEscrow(ctx, 4, 0)
+	require.NoError(err, "SnapshotEscrow")
+	for _, epoch := range []beacon.EpochTime{2, 3, 4} {
+		_, err = s.EscrowSnapshot(ctx, epoch)
+		require.ErrorIs(err, staking.ErrEscrowSnapshotNotFound, "all snapshots should be removed when disabled")
+	}
+}
+
+func TestAccountLifecycle(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{BlockHeight: 41})
+	ctx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+
+	signer := memorySigner.NewTestSigner("consensus/tendermint/apps/staking/state: lifecycle")
+	addr := staking.NewAddress(signer.Public())
+
+	requireEvent := func(ev interface{}, kind string, msg string) {
+		evs := ctx.GetEvents()
+		require.NotEmpty(evs, msg)
+		last := evs[len(evs)-1]
+		require.Equal(kind, string(last.Attributes[0].Key), msg)
+		require.NoError(cbor.Unmarshal(last.Attributes[0].Value, ev), msg)
+	}
+
+	// The first credit should create the account at the current height.
+	acct, err := s.Account(ctx, addr)
+	require.NoError(err, "Account")
+	acct.General.Balance = mustInitQuantity(t, 100)
+	err = s.SetAccount(ctx, addr, acct)
+	require.NoError(err, "SetAccount")
+	acct, err = s.Account(ctx, addr)
+	require.NoError(err, "Account")
+	require.EqualValues(42, acct.General.CreatedAt, "creation height should be recorded")
+	var created staking.AccountCreatedEvent
+	requireEvent(&created, "account_created", "creating an account should emit an event")
+	require.Equal(staking.AccountCreatedEvent{Account: addr}, created)
+
+	// Updating an existing account should keep its creation height and emit no events.
+	numEvents := len(ctx.GetEvents())
+	acct.General.Nonce = 7
+	err = s.SetAccount(ctx, addr, acct)
+	require.NoError(err, "SetAccount")
+	require.Len(ctx.GetEvents(), numEvents, "updating an account should not emit events")
+
+	// Reaping should retain the nonce.
+	err = s.RemoveAccount(ctx, addr)
+	require.NoError(err, "RemoveAccount")
+	var reaped staking.AccountReapedEvent
+	requireEvent(&reaped, "account_reaped", "reaping an account should emit an event")
+	require.Equal(staking.AccountReapedEvent{Account: addr, Nonce: 7}, reaped)
+	acct, err = s.Account(ctx, addr)
+	require.NoError(err, "Account")
+	require.Equal(staking.NewReapedAccount(7), acct, "reaped account should only retain its nonce")
+	addresses, err := s.Addresses(ctx)
+	require.NoError(err, "Addresses")
+	require.NotContains(addresses, addr, "reaped account should be removed from the ledger")
+	reapedAccounts, err := s.ReapedAccounts(ctx)
+	require.NoError(err, "ReapedAccounts")
+	require.Equal(map[staking.Address]uint64{addr: 7}, reapedAccounts)
+
+	// Transactions signed before the account was reaped should not be replayable.
+	ctx.SetTxSigner(signer.Public())
+	for _, nonce := range []uint64{0, 6} {
+		err = AuthenticateAndPayFees(ctx, &transaction.Transaction{Nonce: nonce, Method: staking.MethodTransfer})
+		require.ErrorIs(err, transaction.ErrInvalidNonce, "replayed transaction with nonce %d should be rejected", nonce)
+	}
+
+	// Re-creating the account should continue from the retained nonce with a fresh creation
+	// height.
+	appState.UpdateMockApplicationStateConfig(&abciAPI.MockApplicationStateConfig{BlockHeight: 99})
+	ctx = appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer ctx.Close()
+	acct.General.Balance = mustInitQuantity(t, 50)
+	err = s.SetAccount(ctx, addr, acct)
+	require.NoError(err, "SetAccount")
+	acct, err = s.Account(ctx, addr)
+	require.NoError(err, "Account")
+	require.EqualValues(7, acct.General.Nonce, "re-created account should continue from the retained nonce")
+	require.EqualValues(100, acct.General.CreatedAt, "re-created account should get a fresh creation height")
+	requireEvent(&created, "account_created", "re-creating an account should emit an event")
+	require.Equal(staking.AccountCreatedEvent{Account: addr, Nonce: 7}, created)
+	reapedAccounts, err = s.ReapedAccounts(ctx)
+	require.NoError(err, "ReapedAccounts")
+	require.Empty(reapedAccounts, "re-created account should no longer be tracked as reaped")
+}
+
+func TestSlash(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{BlockHeight: 41})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	s := NewMutableState(ctx.State())
+
+	err := s.SetConsensusParameters(ctx, &staking.ConsensusParameters{
+		Slashing: map[staking.SlashReason]staking.Slash{
+			staking.SlashConsensusEquivocation: {
+				Share: &staking.SlashShare{
+					Numerator:   mustInitQuantity(t, 1),
+					Denominator: mustInitQuantity(t, 5),
+				},
+			},
+			staking.SlashRuntimeIncorrectResults: {
+				Amount: mustInitQuantity(t, 16),
+			},
+		},
+	})
+	require.NoError(err, "SetConsensusParameters")
+
+	signer := memorySigner.NewTestSigner("consensus/tendermint/apps/staking/state: slash")
+	addr := staking.NewAddress(signer.Public())
+	err = s.SetAccount(ctx, addr, &staking.Account{
+		Escrow: staking.EscrowAccount{
+			Active: staking.SharePool{
+				Balance:     mustInitQuantity(t, 300),
+				TotalShares: mustInitQuantity(t, 300),
+			},
+			Debonding: staking.SharePool{
+				Balance:     mustInitQuantity(t, 100),
+				TotalShares: mustInitQuantity(t, 100),
+			},
+		},
+	})
+	require.NoError(err, "SetAccount")
+
+	requireEscrow := func(active, debonding, commonPool int64, msg string) {
+		acct, err := s.Account(ctx, addr)
+		require.NoError(err, "Account")
+		require.Equal(mustInitQuantity(t, active), acct.Escrow.Active.Balance, msg+" - active escrow")
+		require.Equal(mustInitQuantity(t, debonding), acct.Escrow.Debonding.Balance, msg+" - debonding escrow")
+		pool, err := s.CommonPool(ctx)
+		require.NoError(err, "CommonPool")
+		require.Equal(mustInitQuantityP(t, commonPool), pool, msg+" - common pool")
+	}
+
+	history, err := s.SlashingHistory(ctx, addr)
+	require.NoError(err, "SlashingHistory")
+	require.Empty(history, "slashing history should be empty")
+
+	// A fifth of the total escrow balance should be slashed from both pools proportionally.
+	slashed, err := s.Slash(ctx, addr, staking.SlashConsensusEquivocation, 10)
+	require.NoError(err, "Slash")
+	require.Equal(mustInitQuantityP(t, 80), slashed, "slashed amount")
+	requireEscrow(240, 80, 80, "slash")
+
+	evs := ctx.GetEvents()
+	require.NotEmpty(evs, "slashing should emit events")
+	last := evs[len(evs)-1]
+	require.Equal("slash", string(last.Attributes[0].Key), "last event should be a slash event")
+	var ev staking.SlashEvent
+	err = cbor.Unmarshal(last.Attributes[0].Value, &ev)
+	require.NoError(err, "malformed slash event")
+	require.Equal(staking.SlashEvent{
+		Owner:          addr,
+		Reason:         staking.SlashConsensusEquivocation,
+		EvidenceHeight: 10,
+		Amount:         mustInitQuantity(t, 80),
+	}, ev, "slash event")
+
+	// The same offense should only be slashed once.
+	numEvents := len(ctx.GetEvents())
+	slashed, err = s.Slash(ctx, addr, staking.SlashConsensusEquivocation, 10)
+	require.NoError(err, "Slash")
+	require.True(slashed.IsZero(), "repeated offense should not be slashed")
+	requireEscrow(240, 80, 80, "repeated slash")
+	require.Len(ctx.GetEvents(), numEvents, "repeated offense should not emit events")
+
+	// Offenses at other heights or for other reasons should be slashed.
+	slashed, err = s.Slash(ctx, addr, staking.SlashConsensusEquivocation, 11)
+	require.NoError(err, "Slash")
+	require.Equal(mustInitQuantityP(t, 64), slashed, "slashed amount")
+	requireEscrow(192, 64, 144, "slash at another height")
+
+	slashed, err = s.Slash(ctx, addr, staking.SlashRuntimeIncorrectResults, 10)
+	require.NoError(err, "Slash")
+	require.Equal(mustInitQuantityP(t, 16), slashed, "slashed amount")
+	requireEscrow(180, 60, 160, "slash for another reason")
+
+	// Offenses without a configured penalty should be ignored.
+	slashed, err = s.Slash(ctx, addr, staking.SlashConsensusLightClientAttack, 10)
+	require.NoError(err, "Slash")
+	require.True(slashed.IsZero(), "offense without a penalty should not be slashed")
+
+	history, err = s.SlashingHistory(ctx, addr)
+	require.NoError(err, "SlashingHistory")
+	require.Equal([]*staking.SlashRecord{
+		{Reason: staking.SlashConsensusEquivocation, EvidenceHeight: 10, Height: 41, Amount: mustInitQuantity(t, 80)},
+		{Reason: staking.SlashConsensusEquivocation, EvidenceHeight: 11, Height: 41, Amount: mustInitQuantity(t, 64)},
+		{Reason: staking.SlashRuntimeIncorrectResults, EvidenceHeight: 10, Height: 41, Amount: mustInitQuantity(t, 16)},
+	}, history, "slashing history")
+
+	record, err := s.SlashRecord(ctx, addr, staking.SlashConsensusEquivocation, 11)
+	require.NoError(err, "SlashRecord")
+	require.Equal(history[1], record, "slash record")
+	record, err = s.SlashRecord(ctx, addr, staking.SlashConsensusLightClientAttack, 10)
+	require.NoError(err, "SlashRecord")
+	require.Nil(record, "offense without a penalty should not be recorded")
+
+	// Other accounts should have no history.
+	other := staking.NewAddress(memorySigner.NewTestSigner("consensus/tendermint/apps/staking/state: slash other").Public())
+	history, err = s.SlashingHistory(ctx, other)
+	require.NoError(err, "SlashingHistory")
+	require.Empty(history, "slashing history of other accounts should be empty")
+}
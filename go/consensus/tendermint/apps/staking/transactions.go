@@ -20,6 +20,33 @@ func isTransferPermitted(params *staking.ConsensusParameters, fromAddr staking.A
 	return
 }
 
+// consumeTransferLimit accounts for the given amount leaving the general balance of the given
+// account, failing in case this would exceed the account's transfer limit in the current epoch.
+func (app *stakingApplication) consumeTransferLimit(
+	ctx *api.Context,
+	addr staking.Address,
+	acct *staking.Account,
+	amount *quantity.Quantity,
+) error {
+	if acct.General.TransferLimit == nil {
+		return nil
+	}
+
+	epoch, err := app.state.GetEpoch(ctx, ctx.BlockHeight()+1)
+	if err != nil {
+		return fmt.Errorf("failed to get current epoch: %w", err)
+	}
+	if err = acct.General.ConsumeTransferLimit(amount, epoch); err != nil {
+		ctx.Logger().Debug("transfer limit exceeded",
+			"err", err,
+			"account", addr,
+			"amount", amount,
+		)
+		return err
+	}
+	return nil
+}
+
 func (app *stakingApplication) transfer(ctx *api.Context, state *stakingState.MutableState, xfer *staking.Transfer) error {
 	if ctx.IsCheckOnly() {
 		return nil
@@ -40,16 +67,33 @@ func (app *stakingApplication) transfer(ctx *api.Context, state *stakingState.Mu
 	}
 
 	fromAddr := ctx.CallerAddress()
-	if fromAddr.IsReserved() || !isTransferPermitted(params, fromAddr) {
+	if fromAddr.IsReserved() {
+		return staking.ErrForbidden
+	}
+	// Reserved module accounts can only be credited internally, except for the burn address.
+	if xfer.To.IsReserved() && !xfer.To.Equal(staking.BurnAddress) {
 		return staking.ErrForbidden
 	}
+	if !isTransferPermitted(params, fromAddr) {
+		return staking.ErrTransfersDisabled
+	}
 
 	from, err := state.Account(ctx, fromAddr)
 	if err != nil {
 		return fmt.Errorf("failed to fetch account: %w", err)
 	}
+	if !fromAddr.Equal(xfer.To) {
+		if err = app.consumeTransferLimit(ctx, fromAddr, from, &xfer.Amount); err != nil {
+			return err
+		}
+	}
 
-	if fromAddr.Equal(xfer.To) {
+	var (
+		dust   *quantity.Quantity
+		burned bool
+	)
+	switch {
+	case fromAddr.Equal(xfer.To):
 		// Handle transfer to self as just a balance check.
 		if from.General.Balance.Cmp(&xfer.Amount) < 0 {
 			err = staking.ErrInsufficientBalance
@@ -61,7 +105,33 @@ func (app *stakingApplication) transfer(ctx *api.Context, state *stakingState.Mu
 			)
 			return err
 		}
-	} else {
+	case xfer.To.Equal(staking.BurnAddress):
+		// Handle transfer to the burn address as a burn. The burn address never has a ledger
+		// entry, the amount is removed from the total supply instead.
+		if err = from.General.Balance.Sub(&xfer.Amount); err != nil {
+			ctx.Logger().Error("Transfer: failed to burn balance",
+				"err", err,
+				"from", fromAddr,
+				"amount", xfer.Amount,
+			)
+			return err
+		}
+		if dust, err = params.CheckMinAccountBalance(from); err != nil {
+			return err
+		}
+
+		var totalSupply *quantity.Quantity
+		if totalSupply, err = state.TotalSupply(ctx); err != nil {
+			return fmt.Errorf("failed to fetch total supply: %w", err)
+		}
+		if totalSupply, err = totalSupply.SubQ(&xfer.Amount); err != nil {
+			return fmt.Errorf("failed to reduce total supply: %w", err)
+		}
+		if err = state.SetTotalSupply(ctx, totalSupply); err != nil {
+			return fmt.Errorf("failed to set total supply: %w", err)
+		}
+		burned = true
+	default:
 		// Source and destination MUST be separate accounts with how
 		// quantity.Move is implemented.
 		var to *staking.Account
@@ -78,6 +148,9 @@ func (app *stakingApplication) transfer(ctx *api.Context, state *stakingState.Mu
 			)
 			return err
 		}
+		if dust, err = params.CheckMinAccountBalance(from); err != nil {
+			return err
+		}
 
 		if err = state.SetAccount(ctx, xfer.To, to); err != nil {
 			return fmt.Errorf("failed to set account: %w", err)
@@ -92,12 +165,71 @@ func (app *stakingApplication) transfer(ctx *api.Context, state *stakingState.Mu
 		"from", fromAddr,
 		"to", xfer.To,
 		"amount", xfer.Amount,
+		"burned", burned,
+	)
+
+	if burned {
+		ctx.EmitEvent(api.NewEventBuilder(app.Name()).TypedAttribute(&staking.BurnEvent{
+			Owner:  fromAddr,
+			Amount: xfer.Amount,
+		}))
+	} else {
+		ctx.EmitEvent(api.NewEventBuilder(app.Name()).TypedAttribute(&staking.TransferEvent{
+			From:   fromAddr,
+			To:     xfer.To,
+			Amount: xfer.Amount,
+		}))
+	}
+
+	if dust != nil {
+		return app.reapDust(ctx, state, fromAddr, from, dust)
+	}
+	return nil
+}
+
+// reapDust sweeps the given dust from the general balance of the given account into the common
+// pool and removes the account from the ledger in case nothing else is left in it.
+func (app *stakingApplication) reapDust(
+	ctx *api.Context,
+	state *stakingState.MutableState,
+	addr staking.Address,
+	acct *staking.Account,
+	dust *quantity.Quantity,
+) error {
+	commonPool, err := state.CommonPool(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query common pool: %w", err)
+	}
+	if err = acct.General.Balance.Sub(dust); err != nil {
+		return fmt.Errorf("failed to move dust to common pool: %w", err)
+	}
+	if commonPool, err = commonPool.AddQ(dust); err != nil {
+		return fmt.Errorf("failed to move dust to common pool: %w", err)
+	}
+	if err = state.SetCommonPool(ctx, commonPool); err != nil {
+		return fmt.Errorf("failed to set common pool: %w", err)
+	}
+
+	removed := acct.IsReapable()
+	if removed {
+		err = state.RemoveAccount(ctx, addr)
+	} else {
+		err = state.SetAccount(ctx, addr, acct)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set account: %w", err)
+	}
+
+	ctx.Logger().Debug("reaped dust account",
+		"account", addr,
+		"amount", dust,
+		"removed", removed,
 	)
 
 	ctx.EmitEvent(api.NewEventBuilder(app.Name()).TypedAttribute(&staking.TransferEvent{
-		From:   fromAddr,
-		To:     xfer.To,
-		Amount: xfer.Amount,
+		From:   addr,
+		To:     staking.CommonPoolAddress,
+		Amount: *dust,
 	}))
 
 	return nil
@@ -146,7 +278,9 @@ func (app *stakingApplication) burn(ctx *api.Context, state *stakingState.Mutabl
 		return fmt.Errorf("failed to fetch total supply: %w", err)
 	}
 
-	_ = totalSupply.Sub(&burn.Amount)
+	if totalSupply, err = totalSupply.SubQ(&burn.Amount); err != nil {
+		return fmt.Errorf("failed to reduce total supply: %w", err)
+	}
 
 	if err = state.SetAccount(ctx, fromAddr, from); err != nil {
 		return fmt.Errorf("failed to set account: %w", err)
@@ -206,6 +340,9 @@ func (app *stakingApplication) addEscrow(ctx *api.Context, state *stakingState.M
 	if err != nil {
 		return fmt.Errorf("failed to fetch account: %w", err)
 	}
+	if err = app.consumeTransferLimit(ctx, fromAddr, from, &escrow.Amount); err != nil {
+		return err
+	}
 
 	// Fetch escrow account.
 	//
@@ -267,6 +404,7 @@ func (app *stakingApplication) addEscrow(ctx *api.Context, state *stakingState.M
 		Escrow:    escrow.Account,
 		Amount:    escrow.Amount,
 		NewShares: *obtainedShares,
+		Balances:  staking.NewEscrowBalances(from, to),
 	}))
 
 	return nil
@@ -496,8 +634,8 @@ func (app *stakingApplication) allow(
 		return nil
 	}
 
-	// Allowances are disabled in case either max allowances is zero or if transfers are disabled.
-	if params.DisableTransfers || params.MaxAllowances == 0 {
+	// Allowances are disabled in case max allowances is zero.
+	if params.MaxAllowances == 0 {
 		return staking.ErrForbidden
 	}
 
@@ -506,18 +644,27 @@ func (app *stakingApplication) allow(
 	if addr.IsReserved() || allow.Beneficiary.IsReserved() {
 		return staking.ErrForbidden
 	}
+	if !isTransferPermitted(params, addr) {
+		return staking.ErrTransfersDisabled
+	}
 	if addr.Equal(allow.Beneficiary) {
 		return staking.ErrInvalidArgument
 	}
 
+	// Current height is ctx.BlockHeight() + 1.
+	height := ctx.BlockHeight() + 1
+	if allow.Expiry > 0 && allow.Expiry < height {
+		return staking.ErrInvalidArgument
+	}
+
 	acct, err := state.Account(ctx, addr)
 	if err != nil {
 		return fmt.Errorf("failed to fetch account: %w", err)
 	}
 
-	if acct.General.Allowances == nil {
-		acct.General.Allowances = make(map[staking.Address]quantity.Quantity)
-	}
+	// Garbage collect any expired allowances.
+	acct.General.PruneExpiredAllowances(height)
+
 	allowance := acct.General.Allowances[allow.Beneficiary]
 	var amountChange *quantity.Quantity
 	switch allow.Negative {
@@ -533,13 +680,20 @@ func (app *stakingApplication) allow(
 			return fmt.Errorf("failed to subtract allowance: %w", err)
 		}
 	}
-	if allowance.IsZero() {
-		// In case the new allowance is equal to zero, remove it.
-		delete(acct.General.Allowances, allow.Beneficiary)
-	} else {
-		// Otherwise update the allowance.
-		acct.General.Allowances[allow.Beneficiary] = allowance
-	}
+	// Keep the previously configured expiry unless a new one is given. A negative expiry removes
+	// the previously configured expiry.
+	var expiry int64
+	switch {
+	case allow.Expiry > 0:
+		expiry = allow.Expiry
+	case allow.Expiry == 0:
+		expiry = acct.General.AllowanceExpiries[allow.Beneficiary]
+	}
+	// In case the new allowance is equal to zero, this removes it.
+	acct.General.SetAllowance(allow.Beneficiary, &staking.Allowance{
+		Amount: allowance,
+		Expiry: expiry,
+	})
 
 	// If updating allowances would go past the maximum number of allowances, fail.
 	if uint32(len(acct.General.Allowances)) > params.MaxAllowances {
@@ -556,6 +710,7 @@ func (app *stakingApplication) allow(
 		Allowance:    allowance,
 		Negative:     allow.Negative,
 		AmountChange: *amountChange,
+		Expiry:       acct.General.AllowanceExpiries[allow.Beneficiary],
 	}))
 
 	return nil
@@ -584,8 +739,8 @@ func (app *stakingApplication) withdraw(
 		return nil
 	}
 
-	// Allowances are disabled in case either max allowances is zero or if transfers are disabled.
-	if params.DisableTransfers || params.MaxAllowances == 0 {
+	// Allowances are disabled in case max allowances is zero.
+	if params.MaxAllowances == 0 {
 		return staking.ErrForbidden
 	}
 
@@ -594,6 +749,9 @@ func (app *stakingApplication) withdraw(
 	if toAddr.IsReserved() || withdraw.From.IsReserved() {
 		return staking.ErrForbidden
 	}
+	if !isTransferPermitted(params, withdraw.From) {
+		return staking.ErrTransfersDisabled
+	}
 	if toAddr.Equal(withdraw.From) {
 		return staking.ErrInvalidArgument
 	}
@@ -602,6 +760,8 @@ func (app *stakingApplication) withdraw(
 	if err != nil {
 		return fmt.Errorf("failed to fetch account: %w", err)
 	}
+	// Current height is ctx.BlockHeight() + 1.
+	height := ctx.BlockHeight() + 1
 	var (
 		allowance quantity.Quantity
 		ok        bool
@@ -610,16 +770,23 @@ func (app *stakingApplication) withdraw(
 		// Fail early in case there is no allowance configured.
 		return staking.ErrForbidden
 	}
+	if from.General.IsAllowanceExpired(toAddr, height) {
+		return staking.ErrAllowanceExpired
+	}
 	if err = allowance.Sub(&withdraw.Amount); err != nil {
 		return staking.ErrForbidden
 	}
-	if allowance.IsZero() {
-		// In case the new allowance is equal to zero, remove it.
-		delete(from.General.Allowances, toAddr)
-	} else {
-		// Otherwise update the allowance.
-		from.General.Allowances[toAddr] = allowance
+	if err = app.consumeTransferLimit(ctx, withdraw.From, from, &withdraw.Amount); err != nil {
+		return err
 	}
+	// In case the new allowance is equal to zero, this removes it.
+	expiry := from.General.AllowanceExpiries[toAddr]
+	from.General.SetAllowance(toAddr, &staking.Allowance{
+		Amount: allowance,
+		Expiry: expiry,
+	})
+	// Garbage collect any other expired allowances.
+	from.General.PruneExpiredAllowances(height)
 
 	// NOTE: Accounts cannot be the same as we fail above if this were the case.
 	to, err := state.Account(ctx, toAddr)
@@ -630,6 +797,10 @@ func (app *stakingApplication) withdraw(
 	if err = quantity.Move(&to.General.Balance, &from.General.Balance, &withdraw.Amount); err != nil {
 		return staking.ErrInsufficientBalance
 	}
+	dust, err := params.CheckMinAccountBalance(from)
+	if err != nil {
+		return err
+	}
 
 	if err = state.SetAccount(ctx, toAddr, to); err != nil {
 		return fmt.Errorf("failed to set account: %w", err)
@@ -650,7 +821,176 @@ func (app *stakingApplication) withdraw(
 		Allowance:    allowance,
 		Negative:     true,
 		AmountChange: withdraw.Amount,
+		Expiry:       expiry,
 	}))
 
+	if dust != nil {
+		return app.reapDust(ctx, state, withdraw.From, from, dust)
+	}
+	return nil
+}
+
+func (app *stakingApplication) accountUpdate(
+	ctx *api.Context,
+	state *stakingState.MutableState,
+	update *staking.AccountUpdate,
+) error {
+	if err := update.SanityCheck(); err != nil {
+		ctx.Logger().Debug("AccountUpdate: invalid update",
+			"err", err,
+		)
+		return staking.ErrInvalidArgument
+	}
+
+	if ctx.IsCheckOnly() {
+		return nil
+	}
+
+	// Charge gas for this transaction.
+	params, err := state.ConsensusParameters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch consensus parameters: %w", err)
+	}
+	if err = ctx.Gas().UseGas(1, staking.GasOpAccountUpdate, params.GasCosts); err != nil {
+		return err
+	}
+
+	// Return early for simulation as we only need gas accounting.
+	if ctx.IsSimulation() {
+		return nil
+	}
+
+	addr := ctx.CallerAddress()
+	if addr.IsReserved() {
+		return staking.ErrForbidden
+	}
+
+	acct, err := state.Account(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to fetch account: %w", err)
+	}
+	acct.General.MultiSig = update.MultiSig
+
+	if err = state.SetAccount(ctx, addr, acct); err != nil {
+		return fmt.Errorf("failed to set account: %w", err)
+	}
+
+	return nil
+}
+
+func (app *stakingApplication) setMetadata(
+	ctx *api.Context,
+	state *stakingState.MutableState,
+	sm *staking.SetMetadata,
+) error {
+	if err := sm.SanityCheck(); err != nil {
+		ctx.Logger().Debug("SetMetadata: invalid metadata",
+			"err", err,
+		)
+		return err
+	}
+
+	if ctx.IsCheckOnly() {
+		return nil
+	}
+
+	// Charge gas for this transaction, including a per-byte charge to discourage spam.
+	params, err := state.ConsensusParameters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch consensus parameters: %w", err)
+	}
+	if err = ctx.Gas().UseGas(1, staking.GasOpSetMetadata, params.GasCosts); err != nil {
+		return err
+	}
+	if err = ctx.Gas().UseGas(len(sm.Metadata), staking.GasOpSetMetadataByte, params.GasCosts); err != nil {
+		return err
+	}
+
+	// Return early for simulation as we only need gas accounting.
+	if ctx.IsSimulation() {
+		return nil
+	}
+
+	addr := ctx.CallerAddress()
+	if addr.IsReserved() {
+		return staking.ErrForbidden
+	}
+
+	acct, err := state.Account(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to fetch account: %w", err)
+	}
+	if err = params.CanSetMetadata(acct, sm); err != nil {
+		ctx.Logger().Debug("SetMetadata: not allowed to set metadata",
+			"err", err,
+			"account", addr,
+		)
+		return err
+	}
+	acct.General.Metadata = nil
+	if len(sm.Metadata) > 0 {
+		acct.General.Metadata = sm.Metadata
+	}
+
+	if err = state.SetAccount(ctx, addr, acct); err != nil {
+		return fmt.Errorf("failed to set account: %w", err)
+	}
+
+	ctx.EmitEvent(api.NewEventBuilder(app.Name()).TypedAttribute(&staking.MetadataUpdatedEvent{
+		Owner:    addr,
+		Metadata: acct.General.Metadata,
+	}))
+
+	return nil
+}
+
+func (app *stakingApplication) setTransferLimit(
+	ctx *api.Context,
+	state *stakingState.MutableState,
+	stl *staking.SetTransferLimit,
+) error {
+	if ctx.IsCheckOnly() {
+		return nil
+	}
+
+	// Charge gas for this transaction.
+	params, err := state.ConsensusParameters(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch consensus parameters: %w", err)
+	}
+	if err = ctx.Gas().UseGas(1, staking.GasOpSetTransferLimit, params.GasCosts); err != nil {
+		return err
+	}
+
+	// Return early for simulation as we only need gas accounting.
+	if ctx.IsSimulation() {
+		return nil
+	}
+
+	addr := ctx.CallerAddress()
+	if addr.IsReserved() {
+		return staking.ErrForbidden
+	}
+
+	acct, err := state.Account(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to fetch account: %w", err)
+	}
+	epoch, err := app.state.GetEpoch(ctx, ctx.BlockHeight()+1)
+	if err != nil {
+		return fmt.Errorf("failed to get current epoch: %w", err)
+	}
+	if err = acct.General.SetTransferLimit(stl, epoch, params.TransferLimitRemovalDelay); err != nil {
+		ctx.Logger().Debug("SetTransferLimit: failed to set transfer limit",
+			"err", err,
+			"account", addr,
+		)
+		return err
+	}
+
+	if err = state.SetAccount(ctx, addr, acct); err != nil {
+		return fmt.Errorf("failed to set account: %w", err)
+	}
+
 	return nil
 }
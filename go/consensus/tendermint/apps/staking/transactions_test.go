@@ -8,6 +8,7 @@ import (
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
 	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
 	stakingState "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking/state"
 	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
@@ -115,6 +116,23 @@ func TestReservedAddresses(t *testing.T) {
 
 	err = app.withdraw(txCtx, stakeState, &staking.Withdraw{})
 	require.EqualError(err, "staking: forbidden by policy", "withdraw for reserved address should error")
+
+	// The burn address must never be usable as a signer.
+	require.True(staking.BurnAddress.IsReserved(), "burn address should be reserved")
+
+	// Reserved module accounts must never be usable as signers or transfer destinations.
+	for _, addr := range staking.ReservedAccountAddresses {
+		require.True(addr.IsReserved(), "reserved account address should be reserved")
+		require.False(addr.IsValid(), "reserved account address should not be valid for regular use")
+	}
+
+	xferCtx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer xferCtx.Close()
+	xferCtx.SetTxSigner(signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"))
+	for _, addr := range staking.ReservedAccountAddresses {
+		err = app.transfer(xferCtx, stakeState, &staking.Transfer{To: addr, Amount: *q.Clone()})
+		require.ErrorIs(err, staking.ErrForbidden, "transfer to reserved account %s should error", addr)
+	}
 }
 
 func TestAllow(t *testing.T) {
@@ -161,7 +179,7 @@ func TestAllow(t *testing.T) {
 				Beneficiary:  addr2,
 				AmountChange: *quantity.NewFromUint64(10),
 			},
-			staking.ErrForbidden,
+			staking.ErrTransfersDisabled,
 			0,
 		},
 		{
@@ -256,6 +274,23 @@ func TestAllow(t *testing.T) {
 			nil,
 			15,
 		},
+		{
+			"should succeed with disabled transfers if the signer is exempt",
+			&staking.ConsensusParameters{
+				DisableTransfers: true,
+				UndisableTransfersFrom: map[staking.Address]bool{
+					addr1: true,
+				},
+				MaxAllowances: 1,
+			},
+			pk1,
+			&staking.Allow{
+				Beneficiary:  addr2,
+				AmountChange: *quantity.NewFromUint64(5),
+			},
+			nil,
+			20,
+		},
 		{
 			"should fail if too many allowances",
 			&staking.ConsensusParameters{
@@ -352,7 +387,23 @@ func TestWithdraw(t *testing.T) {
 				From:   addr1,
 				Amount: *quantity.NewFromUint64(10),
 			},
-			staking.ErrForbidden,
+			staking.ErrTransfersDisabled,
+		},
+		{
+			"should fail with disabled transfers if only the signer is exempt",
+			&staking.ConsensusParameters{
+				DisableTransfers: true,
+				UndisableTransfersFrom: map[staking.Address]bool{
+					addr2: true,
+				},
+				MaxAllowances: 42,
+			},
+			pk2,
+			&staking.Withdraw{
+				From:   addr1,
+				Amount: *quantity.NewFromUint64(10),
+			},
+			staking.ErrTransfersDisabled,
 		},
 		{
 			"should fail with zero max allowances",
@@ -438,6 +489,22 @@ func TestWithdraw(t *testing.T) {
 			},
 			staking.ErrInsufficientBalance,
 		},
+		{
+			"should succeed with disabled transfers if the source is exempt",
+			&staking.ConsensusParameters{
+				DisableTransfers: true,
+				UndisableTransfersFrom: map[staking.Address]bool{
+					addr1: true,
+				},
+				MaxAllowances: 1,
+			},
+			pk2,
+			&staking.Withdraw{
+				From:   addr1,
+				Amount: *quantity.NewFromUint64(10),
+			},
+			nil,
+		},
 		{
 			"should succeed",
 			&staking.ConsensusParameters{
@@ -446,7 +513,7 @@ func TestWithdraw(t *testing.T) {
 			pk2,
 			&staking.Withdraw{
 				From:   addr1,
-				Amount: *quantity.NewFromUint64(25),
+				Amount: *quantity.NewFromUint64(15),
 			},
 			nil,
 		},
@@ -688,3 +755,314 @@ func TestAllowEscrowMessages(t *testing.T) {
 	err = app.reclaimEscrow(txCtx, stakeState, &staking.ReclaimEscrow{Account: addr1, Shares: *quantity.NewFromUint64(1)})
 	require.NoError(err, "reclaim escrow message should work")
 }
+
+func TestAllowanceExpiry(t *testing.T) {
+	require := require.New(t)
+	var err error
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{
+		BlockHeight: 10,
+	})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	stakeState := stakingState.NewMutableState(ctx.State())
+
+	app := &stakingApplication{
+		state: appState,
+	}
+
+	pk1 := signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr1 := staking.NewAddress(pk1)
+	pk2 := signature.NewPublicKey("bbbfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr2 := staking.NewAddress(pk2)
+	pk3 := signature.NewPublicKey("cccfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr3 := staking.NewAddress(pk3)
+
+	err = stakeState.SetConsensusParameters(ctx, &staking.ConsensusParameters{
+		MaxAllowances: 2,
+	})
+	require.NoError(err, "SetConsensusParameters")
+
+	// Configure an allowance for addr2 that expired at the previous height and one for addr3
+	// that expires at the current height (ctx.BlockHeight() + 1).
+	err = stakeState.SetAccount(ctx, addr1, &staking.Account{
+		General: staking.GeneralAccount{
+			Balance: *quantity.NewFromUint64(100),
+			Allowances: map[staking.Address]quantity.Quantity{
+				addr2: *quantity.NewFromUint64(50),
+				addr3: *quantity.NewFromUint64(50),
+			},
+			AllowanceExpiries: map[staking.Address]int64{
+				addr2: 10,
+				addr3: 11,
+			},
+		},
+	})
+	require.NoError(err, "SetAccount")
+
+	txCtx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer txCtx.Close()
+
+	// Withdrawal using the expired allowance should fail.
+	txCtx.SetTxSigner(pk2)
+	err = app.withdraw(txCtx, stakeState, &staking.Withdraw{
+		From:   addr1,
+		Amount: *quantity.NewFromUint64(10),
+	})
+	require.ErrorIs(err, staking.ErrAllowanceExpired, "withdraw should fail with expired allowance")
+
+	// Withdrawal using the allowance at its expiry height should succeed and garbage collect
+	// the expired allowance.
+	txCtx.SetTxSigner(pk3)
+	err = app.withdraw(txCtx, stakeState, &staking.Withdraw{
+		From:   addr1,
+		Amount: *quantity.NewFromUint64(10),
+	})
+	require.NoError(err, "withdraw should succeed at the expiry height")
+
+	acct, err := stakeState.Account(ctx, addr1)
+	require.NoError(err, "Account")
+	require.Equal(map[staking.Address]quantity.Quantity{
+		addr3: *quantity.NewFromUint64(40),
+	}, acct.General.Allowances, "expired allowance should be garbage collected")
+	require.Equal(map[staking.Address]int64{
+		addr3: 11,
+	}, acct.General.AllowanceExpiries, "allowance expiry should be kept")
+
+	// Expiry in the past should be rejected.
+	txCtx.SetTxSigner(pk1)
+	err = app.allow(txCtx, stakeState, &staking.Allow{
+		Beneficiary:  addr2,
+		AmountChange: *quantity.NewFromUint64(10),
+		Expiry:       10,
+	})
+	require.ErrorIs(err, staking.ErrInvalidArgument, "allow should fail with expiry in the past")
+
+	// Allowing without expiry should keep the existing expiry.
+	err = app.allow(txCtx, stakeState, &staking.Allow{
+		Beneficiary:  addr3,
+		AmountChange: *quantity.NewFromUint64(10),
+	})
+	require.NoError(err, "allow")
+
+	acct, err = stakeState.Account(ctx, addr1)
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(50), acct.General.Allowances[addr3], "allowance amount")
+	require.Equal(map[staking.Address]int64{
+		addr3: 11,
+	}, acct.General.AllowanceExpiries, "allowance expiry should be kept")
+
+	// Allowing with an expiry should replace the existing expiry.
+	err = app.allow(txCtx, stakeState, &staking.Allow{
+		Beneficiary:  addr3,
+		AmountChange: *quantity.NewFromUint64(10),
+		Expiry:       20,
+	})
+	require.NoError(err, "allow")
+
+	acct, err = stakeState.Account(ctx, addr1)
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(60), acct.General.Allowances[addr3], "allowance amount")
+	require.Equal(map[staking.Address]int64{
+		addr3: 20,
+	}, acct.General.AllowanceExpiries, "allowance expiry should be replaced")
+
+	// Allowing without expiry should not add an expiry.
+	err = app.allow(txCtx, stakeState, &staking.Allow{
+		Beneficiary:  addr2,
+		AmountChange: *quantity.NewFromUint64(10),
+	})
+	require.NoError(err, "allow")
+
+	acct, err = stakeState.Account(ctx, addr1)
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(10), acct.General.Allowances[addr2], "allowance amount")
+	require.NotContains(acct.General.AllowanceExpiries, addr2, "allowance should not expire")
+
+	// Allowing with a negative expiry should remove the existing expiry.
+	err = app.allow(txCtx, stakeState, &staking.Allow{
+		Beneficiary:  addr3,
+		AmountChange: *quantity.NewFromUint64(10),
+		Expiry:       -1,
+	})
+	require.NoError(err, "allow")
+
+	acct, err = stakeState.Account(ctx, addr1)
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(70), acct.General.Allowances[addr3], "allowance amount")
+	require.Empty(acct.General.AllowanceExpiries, "allowance expiry should be removed")
+}
+
+func TestMinAccountBalance(t *testing.T) {
+	require := require.New(t)
+	var err error
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	stakeState := stakingState.NewMutableState(ctx.State())
+
+	app := &stakingApplication{
+		state: appState,
+	}
+
+	pk1 := signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr1 := staking.NewAddress(pk1)
+	pk2 := signature.NewPublicKey("bbbfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr2 := staking.NewAddress(pk2)
+	pk3 := signature.NewPublicKey("cccfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr3 := staking.NewAddress(pk3)
+
+	params := &staking.ConsensusParameters{
+		MinAccountBalance: *quantity.NewFromUint64(10),
+	}
+	err = stakeState.SetConsensusParameters(ctx, params)
+	require.NoError(err, "SetConsensusParameters")
+
+	err = stakeState.SetAccount(ctx, addr1, &staking.Account{
+		General: staking.GeneralAccount{
+			Balance: *quantity.NewFromUint64(100),
+			Nonce:   5,
+		},
+	})
+	require.NoError(err, "SetAccount")
+	err = stakeState.SetAccount(ctx, addr2, &staking.Account{
+		General: staking.GeneralAccount{
+			Balance: *quantity.NewFromUint64(100),
+		},
+		Escrow: staking.EscrowAccount{
+			Active: staking.SharePool{
+				Balance:     *quantity.NewFromUint64(100),
+				TotalShares: *quantity.NewFromUint64(100),
+			},
+		},
+	})
+	require.NoError(err, "SetAccount")
+
+	txCtx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer txCtx.Close()
+
+	// In strict mode, transfers leaving dust should fail.
+	txCtx.SetTxSigner(pk1)
+	err = app.transfer(txCtx, stakeState, &staking.Transfer{
+		To:     addr3,
+		Amount: *quantity.NewFromUint64(95),
+	})
+	require.ErrorIs(err, staking.ErrBalanceTooLow, "transfer leaving dust should fail in strict mode")
+
+	// In reap mode, transfers leaving dust should sweep the dust and remove the account.
+	params.ReapDustAccounts = true
+	err = stakeState.SetConsensusParameters(ctx, params)
+	require.NoError(err, "SetConsensusParameters")
+
+	err = app.transfer(txCtx, stakeState, &staking.Transfer{
+		To:     addr3,
+		Amount: *quantity.NewFromUint64(95),
+	})
+	require.NoError(err, "transfer leaving dust should succeed in reap mode")
+
+	acct, err := stakeState.Account(ctx, addr1)
+	require.NoError(err, "Account")
+	require.Equal(staking.NewReapedAccount(5), acct, "reaped account should only retain its nonce")
+	addresses, err := stakeState.Addresses(ctx)
+	require.NoError(err, "Addresses")
+	require.NotContains(addresses, addr1, "reaped account should be removed")
+
+	commonPool, err := stakeState.CommonPool(ctx)
+	require.NoError(err, "CommonPool")
+	require.Equal(quantity.NewFromUint64(5), commonPool, "dust should be swept into the common pool")
+
+	// Accounts with escrow should only have their general balance swept.
+	txCtx.SetTxSigner(pk2)
+	err = app.transfer(txCtx, stakeState, &staking.Transfer{
+		To:     addr3,
+		Amount: *quantity.NewFromUint64(91),
+	})
+	require.NoError(err, "transfer leaving dust should succeed in reap mode")
+
+	acct, err = stakeState.Account(ctx, addr2)
+	require.NoError(err, "Account")
+	require.True(acct.General.Balance.IsZero(), "dust should be swept")
+	require.Equal(*quantity.NewFromUint64(100), acct.Escrow.Active.Balance, "escrow should be kept")
+
+	commonPool, err = stakeState.CommonPool(ctx)
+	require.NoError(err, "CommonPool")
+	require.Equal(quantity.NewFromUint64(14), commonPool, "dust should be swept into the common pool")
+
+	acct, err = stakeState.Account(ctx, addr3)
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(186), acct.General.Balance, "destination should receive the amount")
+}
+
+func TestAccountUpdate(t *testing.T) {
+	require := require.New(t)
+	var err error
+
+	now := time.Unix(1580461674, 0)
+	appState := abciAPI.NewMockApplicationState(&abciAPI.MockApplicationStateConfig{})
+	ctx := appState.NewContext(abciAPI.ContextEndBlock, now)
+	defer ctx.Close()
+
+	stakeState := stakingState.NewMutableState(ctx.State())
+	err = stakeState.SetConsensusParameters(ctx, &staking.ConsensusParameters{})
+	require.NoError(err, "setting staking consensus parameters should not error")
+
+	app := &stakingApplication{
+		state: appState,
+	}
+
+	pk1 := signature.NewPublicKey("aaafffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	addr1 := staking.NewAddress(pk1)
+	pk2 := signature.NewPublicKey("bbbfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	pk3 := signature.NewPublicKey("cccfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	pk4 := signature.NewPublicKey("dddfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+	descriptor := &staking.MultiSigDescriptor{
+		Signers:   []signature.PublicKey{pk2, pk3, pk4},
+		Threshold: 2,
+	}
+	transferTx := staking.NewTransferTx(0, nil, &staking.Transfer{})
+
+	txCtx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+	defer txCtx.Close()
+	txCtx.SetTxSigner(pk1)
+
+	// Invalid descriptors should be rejected.
+	err = app.accountUpdate(txCtx, stakeState, &staking.AccountUpdate{
+		MultiSig: &staking.MultiSigDescriptor{Signers: descriptor.Signers, Threshold: 4},
+	})
+	require.Equal(staking.ErrInvalidArgument, err, "AccountUpdate with invalid descriptor should fail")
+
+	err = app.accountUpdate(txCtx, stakeState, &staking.AccountUpdate{MultiSig: descriptor})
+	require.NoError(err, "AccountUpdate should succeed")
+	acct, err := stakeState.Account(txCtx, addr1)
+	require.NoError(err, "reading account state should not error")
+	require.Equal(descriptor, acct.General.MultiSig, "multi-signature descriptor should be set")
+
+	// The account key alone should no longer be able to authorize transactions.
+	err = stakingState.AuthenticateAndPayFees(txCtx, transferTx)
+	require.Equal(staking.ErrInvalidMultiSig, err, "single-signed transaction should fail")
+
+	for _, tc := range []struct {
+		msg     string
+		signers []signature.PublicKey
+		tx      *transaction.Transaction
+		err     error
+	}{
+		{"below threshold", []signature.PublicKey{pk2}, transferTx, staking.ErrInvalidMultiSig},
+		{"non-member signer", []signature.PublicKey{pk1, pk2}, transferTx, staking.ErrInvalidMultiSig},
+		{"unsupported method", []signature.PublicKey{pk2, pk3}, staking.NewWithdrawTx(0, nil, &staking.Withdraw{}), staking.ErrForbidden},
+		{"threshold signers", []signature.PublicKey{pk2, pk3}, transferTx, nil},
+	} {
+		mtxCtx := appState.NewContext(abciAPI.ContextDeliverTx, now)
+		defer mtxCtx.Close()
+		mtxCtx.SetTxMultiSigners(addr1, tc.signers)
+
+		err = stakingState.AuthenticateAndPayFees(mtxCtx, tc.tx)
+		require.Equal(tc.err, err, tc.msg)
+	}
+}
@@ -79,16 +79,15 @@ func checkRootHash(ctx *abciAPI.Context, now beacon.EpochTime) error {
 	st := roothashState.NewMutableState(ctx.State())
 
 	// Check blocks.
-	runtimes, err := st.Runtimes(ctx)
-	if err != nil {
-		return fmt.Errorf("Runtimes(): %w", err)
-	}
-
 	blocks := make(map[common.Namespace]*block.Block)
 	runtimesByID := make(map[common.Namespace]*roothash.RuntimeState)
-	for _, rt := range runtimes {
+	err := st.IterateRuntimes(ctx, func(rt *roothash.RuntimeState) bool {
 		blocks[rt.Runtime.ID] = rt.CurrentBlock
 		runtimesByID[rt.Runtime.ID] = rt
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("IterateRuntimes(): %w", err)
 	}
 	err = roothash.SanityCheckBlocks(blocks)
 	if err != nil {
@@ -113,6 +113,10 @@ const (
 	// CfgSupplementarySanityInterval configures the supplementary sanity check interval.
 	CfgSupplementarySanityInterval = "consensus.tendermint.supplementarysanity.interval"
 
+	// CfgStakingTxIndexRetention configures the number of most recent blocks for which staking
+	// transaction results are indexed. The index is disabled by default.
+	CfgStakingTxIndexRetention = "consensus.tendermint.staking.tx_index_retention"
+
 	// CfgConsensusStateSyncEnabled enabled consensus state sync.
 	CfgConsensusStateSyncEnabled = "consensus.tendermint.state_sync.enabled"
 	// CfgConsensusStateSyncConsensusNode specifies nodes exposing public consensus services which
@@ -445,8 +449,15 @@ func (t *fullService) RegisterHaltHook(hook consensusAPI.HaltHook) {
 }
 
 func (t *fullService) SubmitTx(ctx context.Context, tx *transaction.SignedTransaction) error {
+	return t.submitTxRaw(ctx, cbor.Marshal(tx))
+}
+
+func (t *fullService) SubmitMultiSignedTx(ctx context.Context, tx *stakingAPI.MultiSignedTransaction) error {
+	return t.submitTxRaw(ctx, cbor.Marshal(tx))
+}
+
+func (t *fullService) submitTxRaw(ctx context.Context, data []byte) error {
 	// Subscribe to the transaction being included in a block.
-	data := cbor.Marshal(tx)
 	query := tmtypes.EventQueryTxFor(data)
 	subID := t.newSubscriberID()
 	txSub, err := t.subscribe(subID, query)
@@ -994,7 +1005,7 @@ func (t *fullService) initialize() error {
 	t.svcMgr.RegisterCleanupOnly(t.registry, "registry backend")
 
 	var scStaking tmstaking.ServiceClient
-	if scStaking, err = tmstaking.New(t.ctx, t); err != nil {
+	if scStaking, err = tmstaking.New(t.ctx, t, viper.GetUint64(CfgStakingTxIndexRetention)); err != nil {
 		t.Logger.Error("staking: failed to initialize staking backend",
 			"err", err,
 		)
@@ -1594,6 +1605,8 @@ func init() {
 	Flags.Bool(CfgSupplementarySanityEnabled, false, "enable supplementary sanity checks (slows down consensus)")
 	Flags.Uint64(CfgSupplementarySanityInterval, 10, "supplementary sanity check interval (in blocks)")
 
+	Flags.Uint64(CfgStakingTxIndexRetention, 0, "number of recent blocks with indexed staking transaction results (0 disables)")
+
 	// State sync.
 	Flags.Bool(CfgConsensusStateSyncEnabled, false, "enable state sync")
 	Flags.StringSlice(CfgConsensusStateSyncConsensusNode, []string{}, "state sync: consensus node to use for syncing the light client")
@@ -77,6 +77,7 @@ type serviceClient struct {
 	cmdCh          chan interface{}
 	trackedRuntime map[common.Namespace]*trackedRuntime
 
+	stateWatcher *app.RuntimeStateWatcher
 	pruneHandler *pruneHandler
 }
 
@@ -216,6 +217,11 @@ func (sc *serviceClient) WatchEvents(ctx context.Context, id common.Namespace) (
 	return ch, sub, nil
 }
 
+// Implements api.Backend.
+func (sc *serviceClient) WatchRuntimeState(ctx context.Context, id common.Namespace) (<-chan *api.RuntimeStateUpdate, pubsub.ClosableSubscription, error) {
+	return sc.stateWatcher.Watch(ctx, id)
+}
+
 // Implements api.Backend.
 func (sc *serviceClient) TrackRuntime(ctx context.Context, history api.BlockHistory) error {
 	sc.pruneHandler.trackRuntime(history)
@@ -454,6 +460,11 @@ func (sc *serviceClient) ServiceDescriptor() tmapi.ServiceDescriptor {
 	return tmapi.NewServiceDescriptor(api.ModuleName, app.EventType, sc.queryCh, sc.cmdCh)
 }
 
+// Implements api.ServiceClient.
+func (sc *serviceClient) DeliverBlock(ctx context.Context, height int64) error {
+	return sc.stateWatcher.DeliverBlock(ctx, height)
+}
+
 // Implements api.ServiceClient.
 func (sc *serviceClient) DeliverCommand(ctx context.Context, height int64, cmd interface{}) error {
 	switch c := cmd.(type) {
@@ -773,7 +784,7 @@ func New(
 	}
 	backend.Pruner().RegisterHandler(ph)
 
-	return &serviceClient{
+	sc := &serviceClient{
 		ctx:              ctx,
 		logger:           logging.GetLogger("roothash/tendermint"),
 		backend:          backend,
@@ -785,7 +796,15 @@ func New(
 		cmdCh:            make(chan interface{}, runtimeRegistry.MaxRuntimeCount),
 		trackedRuntime:   make(map[common.Namespace]*trackedRuntime),
 		pruneHandler:     ph,
-	}, nil
+	}
+	sc.stateWatcher = app.NewRuntimeStateWatcher(func(ctx context.Context, runtimeID common.Namespace, height int64) (*api.RuntimeState, error) {
+		return sc.GetRuntimeState(ctx, &api.RuntimeRequest{
+			RuntimeID: runtimeID,
+			Height:    height,
+		})
+	})
+
+	return sc, nil
 }
 
 func init() {
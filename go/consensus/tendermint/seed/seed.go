@@ -194,6 +194,11 @@ func (srv *seedService) SubmitTx(ctx context.Context, tx *transaction.SignedTran
 	return consensus.ErrUnsupported
 }
 
+// Implements Backend.
+func (srv *seedService) SubmitMultiSignedTx(ctx context.Context, tx *staking.MultiSignedTransaction) error {
+	return consensus.ErrUnsupported
+}
+
 // Implements Backend.
 func (srv *seedService) StateToGenesis(ctx context.Context, height int64) (*genesis.Document, error) {
 	return nil, consensus.ErrUnsupported
@@ -0,0 +1,56 @@
+package staking
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+var _ api.DebugController = (*serviceClient)(nil)
+
+// debugTimeSource returns the beacon backend used to control epoch transitions, which is only
+// available when the mock beacon backend is enabled.
+func (sc *serviceClient) debugTimeSource(ctx context.Context) (beacon.SetableBackend, error) {
+	params, err := sc.backend.Beacon().ConsensusParameters(ctx, consensus.HeightLatest)
+	if err != nil {
+		return nil, err
+	}
+	if !params.DebugMockBackend {
+		return nil, fmt.Errorf("%w: mock beacon backend not enabled", api.ErrDebugControllerDisabled)
+	}
+	timeSource, ok := sc.backend.Beacon().(beacon.SetableBackend)
+	if !ok {
+		return nil, fmt.Errorf("%w: beacon backend does not support setting the epoch", api.ErrDebugControllerDisabled)
+	}
+	return timeSource, nil
+}
+
+// Implements api.DebugController.
+func (sc *serviceClient) AdvanceEpoch(ctx context.Context, n uint64) (beacon.EpochTime, error) {
+	timeSource, err := sc.debugTimeSource(ctx)
+	if err != nil {
+		return beacon.EpochInvalid, err
+	}
+
+	epoch, err := timeSource.GetEpoch(ctx, consensus.HeightLatest)
+	if err != nil {
+		return beacon.EpochInvalid, err
+	}
+	for i := uint64(0); i < n; i++ {
+		epoch++
+		if err = timeSource.SetEpoch(ctx, epoch); err != nil {
+			return beacon.EpochInvalid, err
+		}
+	}
+	return epoch, nil
+}
+
+// Implements api.DebugController.
+func (sc *serviceClient) SetBlockTime(t time.Time) error {
+	// Block timestamps are determined by the consensus layer.
+	return fmt.Errorf("%w: block time cannot be set", api.ErrDebugControllerDisabled)
+}
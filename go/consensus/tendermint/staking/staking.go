@@ -4,6 +4,7 @@ package staking
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/hashicorp/go-multierror"
 	tmabcitypes "github.com/tendermint/tendermint/abci/types"
@@ -11,11 +12,14 @@ import (
 	tmrpctypes "github.com/tendermint/tendermint/rpc/core/types"
 	tmtypes "github.com/tendermint/tendermint/types"
 
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
 	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
 	tmapi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
 	app "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking"
 	"github.com/oasisprotocol/oasis-core/go/staking/api"
@@ -36,6 +40,11 @@ type serviceClient struct {
 	querier *app.QueryFactory
 
 	eventNotifier *pubsub.Broker
+	txIndex       *txIndex
+
+	statusLock sync.RWMutex
+	// latestHeight is the height of the last block delivered by the event dispatcher.
+	latestHeight int64
 }
 
 func (sc *serviceClient) TokenSymbol(ctx context.Context) (string, error) {
@@ -173,17 +182,66 @@ func (sc *serviceClient) DebondingDelegationsTo(ctx context.Context, query *api.
 	return q.DebondingDelegationsTo(ctx, query.Owner)
 }
 
-func (sc *serviceClient) Allowance(ctx context.Context, query *api.AllowanceQuery) (*quantity.Quantity, error) {
-	acct, err := sc.Account(ctx, &api.OwnerQuery{
-		Height: query.Height,
-		Owner:  query.Owner,
-	})
+func (sc *serviceClient) Allowance(ctx context.Context, query *api.AllowanceQuery) (*api.Allowance, error) {
+	q, err := sc.querier.QueryAt(ctx, query.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Allowance(ctx, query.Owner, query.Beneficiary)
+}
+
+func (sc *serviceClient) Allowances(ctx context.Context, query *api.OwnerQuery) (map[api.Address]*api.Allowance, error) {
+	q, err := sc.querier.QueryAt(ctx, query.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Allowances(ctx, query.Owner)
+}
+
+func (sc *serviceClient) AccountMetadata(ctx context.Context, query *api.OwnerQuery) ([]byte, error) {
+	q, err := sc.querier.QueryAt(ctx, query.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.AccountMetadata(ctx, query.Owner)
+}
+
+func (sc *serviceClient) CommissionSchedule(ctx context.Context, query *api.OwnerQuery) (*api.CommissionSchedule, error) {
+	q, err := sc.querier.QueryAt(ctx, query.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.CommissionSchedule(ctx, query.Owner)
+}
+
+func (sc *serviceClient) SharesToTokens(ctx context.Context, query *api.EscrowExchangeQuery) (*quantity.Quantity, error) {
+	q, err := sc.querier.QueryAt(ctx, query.Height)
 	if err != nil {
 		return nil, err
 	}
 
-	allowance := acct.General.Allowances[query.Beneficiary]
-	return &allowance, nil
+	acct, err := q.Account(ctx, query.Escrow)
+	if err != nil {
+		return nil, err
+	}
+	return acct.Escrow.Active.StakeForShares(&query.Amount)
+}
+
+func (sc *serviceClient) TokensToShares(ctx context.Context, query *api.EscrowExchangeQuery) (*quantity.Quantity, error) {
+	q, err := sc.querier.QueryAt(ctx, query.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	acct, err := q.Account(ctx, query.Escrow)
+	if err != nil {
+		return nil, err
+	}
+	return acct.Escrow.Active.SharesForStake(&query.Amount)
 }
 
 func (sc *serviceClient) StateToGenesis(ctx context.Context, height int64) (*api.Genesis, error) {
@@ -261,6 +319,75 @@ func (sc *serviceClient) GetEvents(ctx context.Context, height int64) ([]*api.Ev
 	return events, nil
 }
 
+func (sc *serviceClient) GetTransaction(ctx context.Context, txHash hash.Hash) (*api.TransactionResult, error) {
+	if result, ok := sc.txIndex.get(txHash); ok {
+		return result, nil
+	}
+
+	pending, err := sc.isPending(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, api.ErrTransactionPending
+	}
+	return nil, api.ErrTransactionNotFound
+}
+
+func (sc *serviceClient) GetStatus(ctx context.Context) (*api.Status, error) {
+	genesis, err := sc.backend.GetGenesisDocument(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &api.Status{
+		GenesisHash: hash.NewFrom(&genesis.Staking),
+	}
+
+	sc.statusLock.RLock()
+	height := sc.latestHeight
+	sc.statusLock.RUnlock()
+
+	if height == 0 {
+		// No blocks have been processed yet, report the genesis state.
+		status.NumAccounts = uint64(len(genesis.Staking.Ledger))
+		// Reserved module accounts with a balance are also reported as accounts. Any last block
+		// fees are moved into the common pool during genesis.
+		if !genesis.Staking.CommonPool.IsZero() || !genesis.Staking.LastBlockFees.IsZero() {
+			status.NumAccounts++
+		}
+		if !genesis.Staking.GovernanceDeposits.IsZero() {
+			status.NumAccounts++
+		}
+		status.TotalSupply = *genesis.Staking.TotalSupply.Clone()
+		return status, nil
+	}
+
+	blk, err := sc.backend.GetBlock(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	q, err := sc.querier.QueryAt(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := q.Addresses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	totalSupply, err := q.TotalSupply(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status.LatestHeight = height
+	status.LatestTime = blk.Time
+	status.NumAccounts = uint64(len(addresses))
+	status.TotalSupply = *totalSupply
+	// Blocks are only delivered once the event dispatcher is running.
+	status.EventsLive = true
+	return status, nil
+}
+
 func (sc *serviceClient) WatchEvents(ctx context.Context) (<-chan *api.Event, pubsub.ClosableSubscription, error) {
 	typedCh := make(chan *api.Event)
 	sub := sc.eventNotifier.Subscribe()
@@ -269,6 +396,32 @@ func (sc *serviceClient) WatchEvents(ctx context.Context) (<-chan *api.Event, pu
 	return typedCh, sub, nil
 }
 
+func (sc *serviceClient) QueryEvents(ctx context.Context, query *api.EventsQuery) (*api.EventsPage, error) {
+	return api.QueryEventsFromSource(ctx, sc, query)
+}
+
+func (sc *serviceClient) WatchEventsFrom(ctx context.Context, query *api.EventsWatchQuery) (<-chan *api.Event, *api.EventsSubscription, error) {
+	return api.WatchEventsFromSource(ctx, sc, query)
+}
+
+// Implements api.EventSource.
+func (sc *serviceClient) LatestHeight(ctx context.Context) (int64, error) {
+	blk, err := sc.backend.GetBlock(ctx, consensus.HeightLatest)
+	if err != nil {
+		return 0, err
+	}
+	return blk.Height, nil
+}
+
+func (sc *serviceClient) EscrowSnapshot(ctx context.Context, epoch beacon.EpochTime) (*api.EscrowSnapshot, error) {
+	q, err := sc.querier.QueryAt(ctx, consensus.HeightLatest)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.EscrowSnapshot(ctx, epoch)
+}
+
 func (sc *serviceClient) ConsensusParameters(ctx context.Context, height int64) (*api.ConsensusParameters, error) {
 	q, err := sc.querier.QueryAt(ctx, height)
 	if err != nil {
@@ -286,6 +439,17 @@ func (sc *serviceClient) ServiceDescriptor() tmapi.ServiceDescriptor {
 	return tmapi.NewStaticServiceDescriptor(api.ModuleName, app.EventType, []tmpubsub.Query{app.QueryApp})
 }
 
+// Implements api.ServiceClient.
+func (sc *serviceClient) DeliverBlock(ctx context.Context, height int64) error {
+	sc.statusLock.Lock()
+	if height > sc.latestHeight {
+		sc.latestHeight = height
+	}
+	sc.statusLock.Unlock()
+
+	return sc.indexBlock(ctx, height)
+}
+
 // Implements api.ServiceClient.
 func (sc *serviceClient) DeliverEvent(ctx context.Context, height int64, tx tmtypes.Tx, ev *tmabcitypes.Event) error {
 	events, err := EventsFromTendermint(tx, height, []tmabcitypes.Event{*ev})
@@ -307,12 +471,16 @@ func EventsFromTendermint(
 	height int64,
 	tmEvents []tmabcitypes.Event,
 ) ([]*api.Event, error) {
-	var txHash hash.Hash
+	var (
+		txHash hash.Hash
+		signer *api.Address
+	)
 	switch tx {
 	case nil:
 		txHash.Empty()
 	default:
 		txHash = hash.NewFromBytes(tx)
+		signer = txSigner(tx)
 	}
 
 	var events []*api.Event
@@ -323,6 +491,9 @@ func EventsFromTendermint(
 			continue
 		}
 
+		// NOTE: Events are emitted by the consensus layer itself so they are decoded as trusted
+		//       inputs. This also makes sure that any fields added to events in the future (e.g.,
+		//       the resulting escrow balances) are ignored instead of making decoding fail.
 		for _, pair := range tmEv.GetAttributes() {
 			key := pair.GetKey()
 			val := pair.GetValue()
@@ -331,72 +502,112 @@ func EventsFromTendermint(
 			case tmapi.IsAttributeKind(key, &api.TakeEscrowEvent{}):
 				// Take escrow event.
 				var e api.TakeEscrowEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt TakeEscrow event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, Escrow: &api.EscrowEvent{Take: &e}}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Escrow: &api.EscrowEvent{Take: &e}}
+				events = append(events, evt)
+			case tmapi.IsAttributeKind(key, &api.SlashEvent{}):
+				// Slash event.
+				var e api.SlashEvent
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt Slash event: %w", err))
+					continue
+				}
+
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Escrow: &api.EscrowEvent{Slash: &e}}
 				events = append(events, evt)
 			case tmapi.IsAttributeKind(key, &api.TransferEvent{}):
 				// Transfer event.
 				var e api.TransferEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt Transfer event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, Transfer: &e}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Transfer: &e}
 				events = append(events, evt)
 			case tmapi.IsAttributeKind(key, &api.ReclaimEscrowEvent{}):
 				// Reclaim escrow event.
 				var e api.ReclaimEscrowEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt ReclaimEscrow event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, Escrow: &api.EscrowEvent{Reclaim: &e}}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Escrow: &api.EscrowEvent{Reclaim: &e}}
 				events = append(events, evt)
 			case tmapi.IsAttributeKind(key, &api.AddEscrowEvent{}):
 				// Add escrow event.
 				var e api.AddEscrowEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt AddEscrow event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, Escrow: &api.EscrowEvent{Add: &e}}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Escrow: &api.EscrowEvent{Add: &e}}
 				events = append(events, evt)
 			case tmapi.IsAttributeKind(key, &api.DebondingStartEscrowEvent{}):
 				// Debonding start escrow event.
 				var e api.DebondingStartEscrowEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt DebondingStart escrow event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, Escrow: &api.EscrowEvent{DebondingStart: &e}}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Escrow: &api.EscrowEvent{DebondingStart: &e}}
 				events = append(events, evt)
 			case tmapi.IsAttributeKind(key, &api.BurnEvent{}):
 				// Burn event.
 				var e api.BurnEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt Burn event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, Burn: &e}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, Burn: &e}
 				events = append(events, evt)
 			case tmapi.IsAttributeKind(key, &api.AllowanceChangeEvent{}):
 				// Allowance change event.
 				var e api.AllowanceChangeEvent
-				if err := cbor.Unmarshal(val, &e); err != nil {
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
 					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt AllowanceChange event: %w", err))
 					continue
 				}
 
-				evt := &api.Event{Height: height, TxHash: txHash, AllowanceChange: &e}
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, AllowanceChange: &e}
+				events = append(events, evt)
+			case tmapi.IsAttributeKind(key, &api.MetadataUpdatedEvent{}):
+				// Metadata updated event.
+				var e api.MetadataUpdatedEvent
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt MetadataUpdated event: %w", err))
+					continue
+				}
+
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, MetadataUpdated: &e}
+				events = append(events, evt)
+			case tmapi.IsAttributeKind(key, &api.AccountCreatedEvent{}):
+				// Account created event.
+				var e api.AccountCreatedEvent
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt AccountCreated event: %w", err))
+					continue
+				}
+
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, AccountCreated: &e}
+				events = append(events, evt)
+			case tmapi.IsAttributeKind(key, &api.AccountReapedEvent{}):
+				// Account reaped event.
+				var e api.AccountReapedEvent
+				if err := cbor.UnmarshalTrusted(val, &e); err != nil {
+					errs = multierror.Append(errs, fmt.Errorf("staking: corrupt AccountReaped event: %w", err))
+					continue
+				}
+
+				evt := &api.Event{Height: height, TxHash: txHash, Signer: signer, AccountReaped: &e}
 				events = append(events, evt)
 			default:
 				errs = multierror.Append(errs, fmt.Errorf("staking: unknown event type: key: %s, val: %s", key, val))
@@ -408,7 +619,10 @@ func EventsFromTendermint(
 }
 
 // New constructs a new tendermint backed staking Backend instance.
-func New(ctx context.Context, backend tmapi.Backend) (ServiceClient, error) {
+//
+// Results of transactions included in the most recent txIndexRetention blocks are indexed so that
+// they can be queried via GetTransaction. A retention of zero disables the transaction index.
+func New(ctx context.Context, backend tmapi.Backend, txIndexRetention uint64) (ServiceClient, error) {
 	// Initialize and register the tendermint service component.
 	a := app.New()
 	if err := backend.RegisterApplication(a); err != nil {
@@ -425,5 +639,31 @@ func New(ctx context.Context, backend tmapi.Backend) (ServiceClient, error) {
 		backend:       backend,
 		querier:       a.QueryFactory().(*app.QueryFactory),
 		eventNotifier: pubsub.NewBroker(false),
+		txIndex:       newTxIndex(txIndexRetention),
 	}, nil
 }
+
+// txSigner returns the address of the account on whose behalf the given transaction was executed
+// or nil in case the transaction cannot be decoded.
+//
+// Only transactions that have already been executed are decoded here, so the signatures are not
+// verified again.
+func txSigner(tx tmtypes.Tx) *api.Address {
+	var sigTx transaction.SignedTransaction
+	if err := cbor.Unmarshal(tx, &sigTx); err == nil {
+		addr := api.NewAddress(sigTx.Signature.PublicKey)
+		return &addr
+	}
+
+	var (
+		multiTx api.MultiSignedTransaction
+		mtx     api.MultiSigTransaction
+	)
+	if err := cbor.Unmarshal(tx, &multiTx); err != nil {
+		return nil
+	}
+	if err := cbor.Unmarshal(multiTx.Blob, &mtx); err != nil {
+		return nil
+	}
+	return &mtx.Account
+}
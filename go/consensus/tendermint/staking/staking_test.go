@@ -0,0 +1,62 @@
+package staking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tmabcitypes "github.com/tendermint/tendermint/abci/types"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	tmapi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	app "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/apps/staking"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+func TestEventsFromTendermintSigner(t *testing.T) {
+	require := require.New(t)
+
+	signature.SetChainContext("test: oasis-core tests")
+
+	signer := memorySigner.NewTestSigner("consensus/tendermint/staking: event signer")
+	signerAddr := api.NewAddress(signer.Public())
+	multiSigAddr := api.NewAddress(memorySigner.NewTestSigner("consensus/tendermint/staking: multisig account").Public())
+
+	xfer := api.TransferEvent{
+		From:   signerAddr,
+		To:     multiSigAddr,
+		Amount: *quantity.NewFromUint64(100),
+	}
+	tmEvents := []tmabcitypes.Event{tmapi.NewEventBuilder(app.AppName).TypedAttribute(&xfer).Event()}
+
+	tx := api.NewTransferTx(0, nil, &api.Transfer{To: multiSigAddr, Amount: xfer.Amount})
+	sigTx, err := transaction.Sign(signer, tx)
+	require.NoError(err, "Sign")
+	multiTx, err := api.SignMultiSigTransaction([]signature.Signer{signer}, multiSigAddr, tx)
+	require.NoError(err, "SignMultiSigTransaction")
+
+	for _, tc := range []struct {
+		name   string
+		rawTx  []byte
+		signer *api.Address
+	}{
+		{"Block", nil, nil},
+		{"Signed", cbor.Marshal(sigTx), &signerAddr},
+		{"MultiSigned", cbor.Marshal(multiTx), &multiSigAddr},
+		{"Malformed", []byte("not a transaction"), nil},
+	} {
+		events, err := EventsFromTendermint(tc.rawTx, 42, tmEvents)
+		require.NoError(err, "EventsFromTendermint(%s)", tc.name)
+		require.Len(events, 1, "EventsFromTendermint(%s)", tc.name)
+		require.EqualValues(42, events[0].Height, "%s: event height", tc.name)
+		require.Equal(&xfer, events[0].Transfer, "%s: transfer event", tc.name)
+		require.Equal(tc.signer, events[0].Signer, "%s: event signer", tc.name)
+	}
+
+	events, err := EventsFromTendermint(cbor.Marshal(sigTx), 42, tmEvents)
+	require.NoError(err, "EventsFromTendermint")
+	require.Equal(sigTx.Hash(), events[0].TxHash, "event txn hash should match the signed transaction")
+}
@@ -0,0 +1,198 @@
+package staking
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// txIndexHeight is the set of transactions indexed at a given height.
+type txIndexHeight struct {
+	height int64
+	hashes []hash.Hash
+}
+
+// txIndex is an in-memory index of transaction results, keyed by transaction hash.
+//
+// Only results for the most recent blocks (as configured by the retention window) are kept. The
+// index is a best-effort cache that is not persisted. It is rebuilt from the retained blocks when
+// the first block is indexed after startup, so results of blocks that have already been pruned
+// are no longer available.
+type txIndex struct {
+	sync.RWMutex
+
+	retention  uint64
+	results    map[hash.Hash]*api.TransactionResult
+	heights    []txIndexHeight
+	lastHeight int64
+}
+
+func (idx *txIndex) get(txHash hash.Hash) (*api.TransactionResult, bool) {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	result, ok := idx.results[txHash]
+	return result, ok
+}
+
+func (idx *txIndex) add(height int64, results map[hash.Hash]*api.TransactionResult) {
+	idx.Lock()
+	defer idx.Unlock()
+
+	if idx.retention == 0 {
+		return
+	}
+
+	hashes := make([]hash.Hash, 0, len(results))
+	for txHash, result := range results {
+		idx.results[txHash] = result
+		hashes = append(hashes, txHash)
+	}
+	idx.heights = append(idx.heights, txIndexHeight{height: height, hashes: hashes})
+	idx.lastHeight = height
+
+	// Prune results that fall outside of the retention window.
+	var pruned int
+	for _, h := range idx.heights {
+		if uint64(height-h.height) < idx.retention {
+			break
+		}
+		for _, txHash := range h.hashes {
+			// The same transaction could have been included again at a later height.
+			if result, ok := idx.results[txHash]; ok && result.Height == h.height {
+				delete(idx.results, txHash)
+			}
+		}
+		pruned++
+	}
+	idx.heights = idx.heights[pruned:]
+}
+
+// last returns the last indexed height or zero in case nothing has been indexed yet.
+func (idx *txIndex) last() int64 {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	return idx.lastHeight
+}
+
+func newTxIndex(retention uint64) *txIndex {
+	return &txIndex{
+		retention: retention,
+		results:   make(map[hash.Hash]*api.TransactionResult),
+	}
+}
+
+// indexBlock adds the results of all transactions included in the block at the given height to
+// the transaction index.
+//
+// As the index is not persisted, the first indexed block after startup also triggers a rebuild
+// of the index from all retained blocks within the retention window. The rebuild delays delivery
+// of the block's events until it completes.
+func (sc *serviceClient) indexBlock(ctx context.Context, height int64) error {
+	if sc.txIndex.retention == 0 {
+		return nil
+	}
+
+	if sc.txIndex.last() == 0 {
+		if err := sc.reindexBlocks(ctx, height); err != nil {
+			// The index is best-effort, so only results of earlier blocks are missing.
+			sc.logger.Error("failed to rebuild transaction index",
+				"err", err,
+				"height", height,
+			)
+		}
+	}
+	return sc.indexHeight(ctx, height)
+}
+
+// reindexBlocks indexes all retained blocks within the retention window preceding the given
+// height.
+func (sc *serviceClient) reindexBlocks(ctx context.Context, height int64) error {
+	startHeight := height - int64(sc.txIndex.retention) + 1
+
+	// Take prune strategy into account.
+	lastRetainedHeight, err := sc.backend.GetLastRetainedVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("staking: failed to get last retained height: %w", err)
+	}
+	if startHeight < lastRetainedHeight {
+		startHeight = lastRetainedHeight
+	}
+
+	// Take initial genesis height into account.
+	genesisDoc, err := sc.backend.GetGenesisDocument(ctx)
+	if err != nil {
+		return fmt.Errorf("staking: failed to get genesis document: %w", err)
+	}
+	if startHeight < genesisDoc.Height {
+		startHeight = genesisDoc.Height
+	}
+
+	for h := startHeight; h < height; h++ {
+		if err = sc.indexHeight(ctx, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexHeight adds the results of all transactions included in the block at the given height to
+// the transaction index.
+func (sc *serviceClient) indexHeight(ctx context.Context, height int64) error {
+	blk, err := sc.backend.GetTendermintBlock(ctx, height)
+	if err != nil {
+		return fmt.Errorf("staking: failed to get tendermint block: %w", err)
+	}
+	if blk == nil {
+		return nil
+	}
+	res, err := sc.backend.GetBlockResults(ctx, height)
+	if err != nil {
+		return fmt.Errorf("staking: failed to get tendermint block results: %w", err)
+	}
+	if len(res.TxsResults) != len(blk.Data.Txs) {
+		return fmt.Errorf("staking: mismatched number of transactions and results (%d != %d)",
+			len(blk.Data.Txs), len(res.TxsResults),
+		)
+	}
+
+	results := make(map[hash.Hash]*api.TransactionResult, len(blk.Data.Txs))
+	for txIdx, tx := range blk.Data.Txs {
+		rs := res.TxsResults[txIdx]
+		events, err := EventsFromTendermint(tx, height, rs.Events)
+		if err != nil {
+			return fmt.Errorf("staking: failed to process tendermint events: %w", err)
+		}
+
+		results[hash.NewFromBytes(tx)] = &api.TransactionResult{
+			Height: height,
+			Error: api.TransactionError{
+				Module:  rs.GetCodespace(),
+				Code:    rs.GetCode(),
+				Message: rs.GetLog(),
+			},
+			Events: events,
+		}
+	}
+	sc.txIndex.add(height, results)
+
+	return nil
+}
+
+// isPending returns true iff the transaction with the given hash is in the local mempool.
+func (sc *serviceClient) isPending(ctx context.Context, txHash hash.Hash) (bool, error) {
+	txs, err := sc.backend.GetUnconfirmedTransactions(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, tx := range txs {
+		if h := hash.NewFromBytes(tx); h.Equal(&txHash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
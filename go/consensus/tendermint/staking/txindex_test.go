@@ -0,0 +1,138 @@
+package staking
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tmabcitypes "github.com/tendermint/tendermint/abci/types"
+	tmrpctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	tmapi "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	genesis "github.com/oasisprotocol/oasis-core/go/genesis/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// txIndexBackend is a tendermint backend serving blocks with a single transaction each.
+type txIndexBackend struct {
+	tmapi.Backend
+
+	genesisHeight      int64
+	lastRetainedHeight int64
+}
+
+func (b *txIndexBackend) tx(height int64) tmtypes.Tx {
+	return tmtypes.Tx(fmt.Sprintf("tx at height %d", height))
+}
+
+func (b *txIndexBackend) GetTendermintBlock(ctx context.Context, height int64) (*tmtypes.Block, error) {
+	if height < b.lastRetainedHeight {
+		return nil, fmt.Errorf("block %d has been pruned", height)
+	}
+	return &tmtypes.Block{Data: tmtypes.Data{Txs: tmtypes.Txs{b.tx(height)}}}, nil
+}
+
+func (b *txIndexBackend) GetBlockResults(ctx context.Context, height int64) (*tmrpctypes.ResultBlockResults, error) {
+	if height < b.lastRetainedHeight {
+		return nil, fmt.Errorf("block results %d have been pruned", height)
+	}
+	return &tmrpctypes.ResultBlockResults{
+		Height:     height,
+		TxsResults: []*tmabcitypes.ResponseDeliverTx{{}},
+	}, nil
+}
+
+func (b *txIndexBackend) GetLastRetainedVersion(ctx context.Context) (int64, error) {
+	return b.lastRetainedHeight, nil
+}
+
+func (b *txIndexBackend) GetUnconfirmedTransactions(ctx context.Context) ([][]byte, error) {
+	return nil, nil
+}
+
+func (b *txIndexBackend) GetGenesisDocument(ctx context.Context) (*genesis.Document, error) {
+	return &genesis.Document{Height: b.genesisHeight}, nil
+}
+
+func TestTxIndexRetention(t *testing.T) {
+	require := require.New(t)
+
+	txHash := func(height int64) hash.Hash {
+		var h hash.Hash
+		h.FromBytes([]byte{byte(height)})
+		return h
+	}
+	add := func(idx *txIndex, height int64, txHeight int64) {
+		idx.add(height, map[hash.Hash]*api.TransactionResult{
+			txHash(txHeight): {Height: height},
+		})
+	}
+
+	idx := newTxIndex(3)
+	for height := int64(1); height <= 5; height++ {
+		add(idx, height, height)
+	}
+	for height := int64(1); height <= 5; height++ {
+		result, ok := idx.get(txHash(height))
+		if height <= 2 {
+			require.False(ok, "results outside of the retention window should be pruned")
+			continue
+		}
+		require.True(ok, "results within the retention window should be kept")
+		require.EqualValues(height, result.Height, "result height")
+	}
+
+	// A transaction included again should not be pruned with the earlier inclusion.
+	add(idx, 6, 4)
+	add(idx, 7, 7)
+	result, ok := idx.get(txHash(4))
+	require.True(ok, "re-included result should be kept")
+	require.EqualValues(6, result.Height, "result height")
+	_, ok = idx.get(txHash(3))
+	require.False(ok, "results outside of the retention window should be pruned")
+
+	// A retention of zero disables the index.
+	idx = newTxIndex(0)
+	add(idx, 1, 1)
+	_, ok = idx.get(txHash(1))
+	require.False(ok, "disabled index should not keep results")
+}
+
+func TestTxIndexRebuild(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := &txIndexBackend{genesisHeight: 1, lastRetainedHeight: 5}
+	sc := &serviceClient{
+		logger:  logging.GetLogger("staking/txindex/test"),
+		backend: backend,
+		txIndex: newTxIndex(10),
+	}
+
+	// The first indexed block should rebuild the index from retained blocks.
+	err := sc.DeliverBlock(ctx, 12)
+	require.NoError(err, "DeliverBlock")
+	for height := int64(1); height <= 12; height++ {
+		result, err := sc.GetTransaction(ctx, hash.NewFromBytes(backend.tx(height)))
+		if height < 5 {
+			require.ErrorIs(err, api.ErrTransactionNotFound, "pruned blocks should not be indexed")
+			continue
+		}
+		require.NoError(err, "GetTransaction")
+		require.EqualValues(height, result.Height, "result height")
+	}
+
+	// The rebuild should respect the retention window.
+	sc.txIndex = newTxIndex(3)
+	err = sc.DeliverBlock(ctx, 12)
+	require.NoError(err, "DeliverBlock")
+	_, err = sc.GetTransaction(ctx, hash.NewFromBytes(backend.tx(9)))
+	require.ErrorIs(err, api.ErrTransactionNotFound, "blocks outside of the retention window should not be indexed")
+	result, err := sc.GetTransaction(ctx, hash.NewFromBytes(backend.tx(10)))
+	require.NoError(err, "GetTransaction")
+	require.EqualValues(10, result.Height, "result height")
+}
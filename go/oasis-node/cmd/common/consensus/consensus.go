@@ -2,7 +2,10 @@
 package consensus
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -21,6 +24,7 @@ import (
 	cmdCommon "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common"
 	cmdFlags "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/flags"
 	cmdSigner "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/signer"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
 )
 
 const (
@@ -38,12 +42,22 @@ const (
 
 	// CfgTxUnsigned makes SaveTx save an unsigned transaction.
 	CfgTxUnsigned = "transaction.unsigned"
+
+	// CfgTxMultiSigAccount configures the multi-signature account on whose behalf a transaction
+	// is signed.
+	CfgTxMultiSigAccount = "transaction.multisig.account"
+
+	// CfgTxMultiSigFile configures the filename for the multi-signed transaction.
+	CfgTxMultiSigFile = "transaction.multisig.file"
 )
 
 var (
 	TxFlags     = flag.NewFlagSet("", flag.ContinueOnError)
 	TxFileFlags = flag.NewFlagSet("", flag.ContinueOnError)
 
+	// MultiSigTxFlags has the flags used for signing multi-signed transactions.
+	MultiSigTxFlags = flag.NewFlagSet("", flag.ContinueOnError)
+
 	logger = logging.GetLogger("cmd/common/consensus")
 )
 
@@ -156,6 +170,98 @@ func SignAndSaveTx(ctx context.Context, tx *transaction.Transaction, signer sign
 	}
 }
 
+// SignAndSaveMultiSigTx signs the transaction on behalf of the configured multi-signature
+// account and saves the multi-signed transaction.
+//
+// In case the multi-signed transaction file already contains the same transaction signed by
+// other signers, the signature is added to the existing signatures.
+func SignAndSaveMultiSigTx(ctx context.Context, tx *transaction.Transaction) {
+	var account staking.Address
+	if err := account.UnmarshalText([]byte(viper.GetString(CfgTxMultiSigAccount))); err != nil {
+		logger.Error("failed to parse multi-signature account address",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	_, signer, err := cmdCommon.LoadEntitySigner()
+	if err != nil {
+		logger.Error("failed to load signer",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+	defer signer.Reset()
+
+	fmt.Printf("You are about to sign the following transaction on behalf of %s:\n", account)
+	tx.PrettyPrint(ctx, "  ", os.Stdout)
+
+	switch cmdSigner.Backend() {
+	case signerFile.SignerName:
+		if !cmdFlags.AssumeYes() {
+			if !cmdCommon.GetUserConfirmation("\nAre you sure you want to continue? (y)es/(n)o: ") {
+				os.Exit(1)
+			}
+		}
+	case signerPlugin.SignerName:
+		if cmdCommon.Isatty(os.Stdin.Fd()) {
+			fmt.Println("\nYou may need to review the transaction on your device if you use a hardware-based signer plugin...")
+		}
+	}
+
+	sigTx, err := staking.SignMultiSigTransaction([]signature.Signer{signer}, account, tx)
+	if err != nil {
+		logger.Error("failed to sign transaction",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	fn := viper.GetString(CfgTxMultiSigFile)
+	rawExisting, err := ioutil.ReadFile(fn)
+	switch {
+	case err == nil:
+		var existing staking.MultiSignedTransaction
+		if err = json.Unmarshal(rawExisting, &existing); err != nil {
+			logger.Error("failed to parse existing multi-signed transaction",
+				"err", err,
+			)
+			os.Exit(1)
+		}
+		if !bytes.Equal(existing.Blob, sigTx.Blob) {
+			logger.Error("existing multi-signed transaction is for a different transaction")
+			os.Exit(1)
+		}
+		for _, sig := range existing.Signatures {
+			if sig.PublicKey.Equal(signer.Public()) {
+				logger.Error("existing multi-signed transaction is already signed by signer")
+				os.Exit(1)
+			}
+		}
+		sigTx.Signatures = append(existing.Signatures, sigTx.Signatures...)
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		logger.Error("failed to read existing multi-signed transaction",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	prettySigTx, err := cmdCommon.PrettyJSONMarshal(sigTx)
+	if err != nil {
+		logger.Error("failed to get pretty JSON of multi-signed transaction",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+	if err = ioutil.WriteFile(fn, prettySigTx, 0o600); err != nil {
+		logger.Error("failed to save multi-signed transaction",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+}
+
 func init() {
 	TxFileFlags.String(CfgTxFile, "", "path to the transaction")
 	_ = viper.BindPFlags(TxFileFlags)
@@ -170,4 +276,13 @@ func init() {
 	TxFlags.AddFlagSet(cmdSigner.Flags)
 	TxFlags.AddFlagSet(cmdSigner.CLIFlags)
 	TxFlags.AddFlagSet(cmdFlags.GenesisFileFlags)
+
+	MultiSigTxFlags.String(CfgTxMultiSigAccount, "", "address of the multi-signature account")
+	MultiSigTxFlags.String(CfgTxMultiSigFile, "", "path to the multi-signed transaction")
+	_ = viper.BindPFlags(MultiSigTxFlags)
+	MultiSigTxFlags.AddFlagSet(TxFileFlags)
+	MultiSigTxFlags.AddFlagSet(cmdFlags.DebugTestEntityFlags)
+	MultiSigTxFlags.AddFlagSet(cmdSigner.Flags)
+	MultiSigTxFlags.AddFlagSet(cmdSigner.CLIFlags)
+	MultiSigTxFlags.AddFlagSet(cmdFlags.GenesisFileFlags)
 }
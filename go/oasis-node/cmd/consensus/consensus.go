@@ -21,6 +21,7 @@ import (
 	cmdConsensus "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/consensus"
 	cmdFlags "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/flags"
 	cmdGrpc "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/grpc"
+	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
 )
 
 const (
@@ -38,16 +39,22 @@ var (
 
 	submitTxCmd = &cobra.Command{
 		Use:   "submit_tx",
-		Short: "Submit a pre-signed transaction",
+		Short: "Submit a pre-signed (or multi-signed) transaction",
 		Run:   doSubmitTx,
 	}
 
 	showTxCmd = &cobra.Command{
 		Use:   "show_tx",
-		Short: "Show the content a pre-signed transaction",
+		Short: "Show the content a pre-signed (or multi-signed) transaction",
 		Run:   doShowTx,
 	}
 
+	signMultiSigTxCmd = &cobra.Command{
+		Use:   "sign_multisig_tx",
+		Short: "Add a signature to a transaction on behalf of a multi-signature account",
+		Run:   doSignMultiSigTx,
+	}
+
 	estimateGasCmd = &cobra.Command{
 		Use:   "estimate_gas",
 		Short: "Estimate how much gas a transactionw will use",
@@ -75,7 +82,9 @@ func doConnect(cmd *cobra.Command) (*grpc.ClientConn, consensus.ClientBackend) {
 	return conn, client
 }
 
-func loadTx() *transaction.SignedTransaction {
+// loadTx loads a signed transaction, returning either a *transaction.SignedTransaction or a
+// *staking.MultiSignedTransaction depending on the kind of the saved transaction.
+func loadTx() prettyprint.PrettyPrinter {
 	rawTx, err := ioutil.ReadFile(viper.GetString(cmdConsensus.CfgTxFile))
 	if err != nil {
 		logger.Error("failed to read raw serialized transaction",
@@ -84,15 +93,32 @@ func loadTx() *transaction.SignedTransaction {
 		os.Exit(1)
 	}
 
-	var tx transaction.SignedTransaction
-	if err = json.Unmarshal(rawTx, &tx); err != nil {
+	// Multi-signed transactions carry a list of signatures instead of a single one.
+	var probe struct {
+		Signatures json.RawMessage `json:"signatures"`
+	}
+	if err = json.Unmarshal(rawTx, &probe); err != nil {
 		logger.Error("failed to parse serialized transaction",
 			"err", err,
 		)
 		os.Exit(1)
 	}
 
-	return &tx
+	var tx prettyprint.PrettyPrinter
+	switch probe.Signatures {
+	case nil:
+		tx = &transaction.SignedTransaction{}
+	default:
+		tx = &staking.MultiSignedTransaction{}
+	}
+	if err = json.Unmarshal(rawTx, tx); err != nil {
+		logger.Error("failed to parse serialized transaction",
+			"err", err,
+		)
+		os.Exit(1)
+	}
+
+	return tx
 }
 
 func loadUnsignedTx() *transaction.Transaction {
@@ -123,9 +149,14 @@ func doSubmitTx(cmd *cobra.Command, args []string) {
 	conn, client := doConnect(cmd)
 	defer conn.Close()
 
-	tx := loadTx()
-
-	if err := client.SubmitTx(context.Background(), tx); err != nil {
+	var err error
+	switch tx := loadTx().(type) {
+	case *transaction.SignedTransaction:
+		err = client.SubmitTx(context.Background(), tx)
+	case *staking.MultiSignedTransaction:
+		err = client.SubmitMultiSignedTx(context.Background(), tx)
+	}
+	if err != nil {
 		logger.Error("failed to submit transaction",
 			"err", err,
 		)
@@ -149,6 +180,21 @@ func doShowTx(cmd *cobra.Command, args []string) {
 	sigTx.PrettyPrint(ctx, "", os.Stdout)
 }
 
+func doSignMultiSigTx(cmd *cobra.Command, args []string) {
+	if err := cmdCommon.Init(); err != nil {
+		cmdCommon.EarlyLogAndExit(err)
+	}
+
+	genesis := cmdConsensus.InitGenesis()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, prettyprint.ContextKeyTokenSymbol, genesis.Staking.TokenSymbol)
+	ctx = context.WithValue(ctx, prettyprint.ContextKeyTokenValueExponent, genesis.Staking.TokenValueExponent)
+	ctx = context.WithValue(ctx, prettyprint.ContextKeyGenesisHash, genesis.Hash())
+
+	cmdConsensus.SignAndSaveMultiSigTx(ctx, loadUnsignedTx())
+}
+
 func doEstimateGas(cmd *cobra.Command, args []string) {
 	if err := cmdCommon.Init(); err != nil {
 		cmdCommon.EarlyLogAndExit(err)
@@ -208,6 +254,7 @@ func Register(parentCmd *cobra.Command) {
 	for _, v := range []*cobra.Command{
 		submitTxCmd,
 		showTxCmd,
+		signMultiSigTxCmd,
 		estimateGasCmd,
 		nextBlockStateCmd,
 	} {
@@ -220,6 +267,8 @@ func Register(parentCmd *cobra.Command) {
 	showTxCmd.Flags().AddFlagSet(cmdConsensus.TxFileFlags)
 	showTxCmd.Flags().AddFlagSet(cmdFlags.GenesisFileFlags)
 
+	signMultiSigTxCmd.Flags().AddFlagSet(cmdConsensus.MultiSigTxFlags)
+
 	estimateGasCmd.Flags().StringVar(&signerPub, CfgSignerPub, "", "public key of the signer, in base64")
 	estimateGasCmd.Flags().AddFlagSet(cmdConsensus.TxFileFlags)
 	estimateGasCmd.Flags().AddFlagSet(cmdGrpc.ClientFlags)
@@ -47,10 +47,10 @@ func newStorageNode(namespace common.Namespace, datadir string) (*storageWorker,
 	defer close(initCh)
 
 	cfg := &storage.Config{
-		Backend:      database.BackendNameBadgerDB,
-		DB:           filepath.Join(datadir, database.DefaultFileName(database.BackendNameBadgerDB)),
-		Namespace:    namespace,
-		MaxCacheSize: 64 * 1024 * 1024,
+		Backend:        database.BackendNameBadgerDB,
+		DB:             filepath.Join(datadir, database.DefaultFileName(database.BackendNameBadgerDB)),
+		Namespace:      namespace,
+		BlockCacheSize: 64 * 1024 * 1024,
 	}
 	impl, err := database.New(cfg)
 	if err != nil {
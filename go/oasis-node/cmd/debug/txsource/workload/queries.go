@@ -515,8 +515,9 @@ func (q *queries) doStakingQueries(ctx context.Context, rng *rand.Rand, height i
 		return fmt.Errorf("staking.Addresses: %w", err)
 	}
 
-	// Make sure total supply matches sum of all balances and fees.
-	var accSum, totalSum quantity.Quantity
+	// Make sure total supply matches sum of all balances, including the reserved module accounts
+	// (common pool, fee accumulator and governance deposits).
+	var accSum quantity.Quantity
 	for _, addr := range addresses {
 		acc, err := q.staking.Account(ctx, &staking.OwnerQuery{Owner: addr, Height: height})
 		if err != nil {
@@ -531,7 +532,7 @@ func (q *queries) doStakingQueries(ctx context.Context, rng *rand.Rand, height i
 		_ = accSum.Add(&acc.Escrow.Active.Balance)
 		_ = accSum.Add(&acc.Escrow.Debonding.Balance)
 
-		for beneficiary, allowance := range acc.General.Allowances {
+		for beneficiary := range acc.General.Allowances {
 			aw, err := q.staking.Allowance(ctx, &staking.AllowanceQuery{
 				Height:      height,
 				Owner:       addr,
@@ -547,7 +548,8 @@ func (q *queries) doStakingQueries(ctx context.Context, rng *rand.Rand, height i
 				return fmt.Errorf("staking.Allowance: %w", err)
 			}
 
-			if allowance.Cmp(aw) != 0 {
+			allowance := acc.General.GetAllowance(beneficiary, height)
+			if allowance.Amount.Cmp(&aw.Amount) != 0 || allowance.Expiry != aw.Expiry {
 				q.logger.Error("allowance mismatch",
 					"height", height,
 					"owner", addr,
@@ -559,19 +561,13 @@ func (q *queries) doStakingQueries(ctx context.Context, rng *rand.Rand, height i
 			}
 		}
 	}
-	_ = totalSum.Add(commonPool)
-	_ = totalSum.Add(governanceDeposits)
-	_ = totalSum.Add(lastBlockFees)
-	_ = totalSum.Add(&accSum)
-
-	if total.Cmp(&totalSum) != 0 {
+	if total.Cmp(&accSum) != 0 {
 		q.logger.Error("staking total supply mismatch",
 			"height", height,
 			"common_pool", commonPool,
 			"governance_deposits", governanceDeposits,
 			"last_block_fees", lastBlockFees,
 			"accounts_sum", accSum,
-			"total_sum", totalSum,
 			"total", total,
 			"n_addresses", len(addresses),
 		)
@@ -92,6 +92,7 @@ const (
 	cfgRoothashDebugDoNotSuspendRuntimes = "roothash.debug.do_not_suspend_runtimes"
 	cfgRoothashDebugBypassStake          = "roothash.debug.bypass_stake" // nolint: gosec
 	cfgRoothashMaxRuntimeMessages        = "roothash.max_runtime_messages"
+	cfgRoothashMaxRuntimeMessageQueue    = "roothash.max_runtime_message_queue_size"
 
 	// Staking config flags.
 	CfgStakingTokenSymbol        = "staking.token_symbol"
@@ -539,9 +540,10 @@ func AppendRootHashState(doc *genesis.Document, exports []string, l *logging.Log
 		RuntimeStates: make(map[common.Namespace]*roothash.GenesisRuntimeState),
 
 		Parameters: roothash.ConsensusParameters{
-			DebugDoNotSuspendRuntimes: viper.GetBool(cfgRoothashDebugDoNotSuspendRuntimes),
-			DebugBypassStake:          viper.GetBool(cfgRoothashDebugBypassStake),
-			MaxRuntimeMessages:        viper.GetUint32(cfgRoothashMaxRuntimeMessages),
+			DebugDoNotSuspendRuntimes:  viper.GetBool(cfgRoothashDebugDoNotSuspendRuntimes),
+			DebugBypassStake:           viper.GetBool(cfgRoothashDebugBypassStake),
+			MaxRuntimeMessages:         viper.GetUint32(cfgRoothashMaxRuntimeMessages),
+			MaxRuntimeMessageQueueSize: viper.GetUint32(cfgRoothashMaxRuntimeMessageQueue),
 			// TODO: Make these configurable.
 			GasCosts: roothash.DefaultGasCosts,
 		},
@@ -851,6 +853,7 @@ func init() {
 	initGenesisFlags.Bool(cfgRoothashDebugDoNotSuspendRuntimes, false, "do not suspend runtimes (UNSAFE)")
 	initGenesisFlags.Bool(cfgRoothashDebugBypassStake, false, "bypass all roothash stake checks and operations (UNSAFE)")
 	initGenesisFlags.Uint32(cfgRoothashMaxRuntimeMessages, 128, "maximum number of runtime messages submitted in a round")
+	initGenesisFlags.Uint32(cfgRoothashMaxRuntimeMessageQueue, 0, "maximum number of queued messages per runtime (0 disables)")
 	_ = initGenesisFlags.MarkHidden(cfgRoothashDebugDoNotSuspendRuntimes)
 	_ = initGenesisFlags.MarkHidden(cfgRoothashDebugBypassStake)
 
@@ -47,6 +47,9 @@ const (
 	// CfgAllowAmountChange configures the allowance change.
 	CfgAllowAmountChange = "stake.allow.amount_change"
 
+	// CfgAllowExpiry configures the allowance expiry height.
+	CfgAllowExpiry = "stake.allow.expiry"
+
 	// CfgWithdrawSource configures the withdrawal source address.
 	CfgWithdrawSource = "stake.withdraw.source"
 )
@@ -452,6 +455,7 @@ func doAccountAllow(cmd *cobra.Command, args []string) {
 		)
 		os.Exit(1)
 	}
+	allow.Expiry = viper.GetInt64(CfgAllowExpiry)
 
 	nonce, fee := cmdConsensus.GetTxNonceAndFee()
 	tx := api.NewAllowTx(nonce, fee, &allow)
@@ -561,6 +565,7 @@ func init() {
 
 	accountAllowFlags.String(CfgAllowBeneficiary, "", "allowance beneficiary address")
 	accountAllowFlags.String(CfgAllowAmountChange, "0", "allowance change amount (in base units)")
+	accountAllowFlags.Int64(CfgAllowExpiry, 0, "last block height at which the allowance can be used (0 keeps the current expiry, negative removes it)")
 	_ = viper.BindPFlags(accountAllowFlags)
 	accountAllowFlags.AddFlagSet(cmdConsensus.TxFlags)
 	accountAllowFlags.AddFlagSet(cmdFlags.AssumeYesFlag)
@@ -78,6 +78,7 @@ var (
 		{tendermintCommon.CfgCoreListenAddress, "tcp://0.0.0.0:27565"},
 		{tendermintFull.CfgSupplementarySanityEnabled, true},
 		{tendermintFull.CfgSupplementarySanityInterval, 1},
+		{tendermintFull.CfgStakingTxIndexRetention, 3600},
 		{cmdCommon.CfgDebugAllowTestKeys, true},
 	}
 
@@ -258,6 +259,7 @@ func TestNode(t *testing.T) {
 		// Staking requires a registered node that is a validator.
 		{"Staking", testStaking},
 		{"StakingClient", testStakingClient},
+		{"StakingConformance", testStakingConformance},
 
 		// TestStorageClientWithNode runs storage tests against a storage client
 		// connected to this node.
@@ -375,10 +377,18 @@ func testStakingClient(t *testing.T, node *testNode) {
 	require.NoError(t, err, "Dial")
 	defer conn.Close()
 
-	client := staking.NewStakingClient(conn)
+	// The debug controller is not exposed over gRPC, so time is controlled via the local node.
+	client := struct {
+		staking.Backend
+		staking.DebugController
+	}{staking.NewStakingClient(conn), node.Consensus.Staking().(staking.DebugController)}
 	stakingTests.StakingClientImplementationTests(t, client, node.Consensus)
 }
 
+func testStakingConformance(t *testing.T, node *testNode) {
+	stakingTests.StakingConformanceTests(t, node.Consensus.Staking(), node.Consensus, 42)
+}
+
 func testRootHash(t *testing.T, node *testNode) {
 	// Directly.
 	t.Run("Direct", func(t *testing.T) {
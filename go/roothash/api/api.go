@@ -73,6 +73,14 @@ var (
 	// ErrInvalidEvidence is the error return when an invalid evidence is submitted.
 	ErrInvalidEvidence = errors.New(ModuleName, 10, "roothash: invalid evidence")
 
+	// ErrMessageQueueFull is the error returned when a message is enqueued into a runtime message
+	// queue that already holds MaxRuntimeMessageQueueSize messages.
+	ErrMessageQueueFull = errors.New(ModuleName, 11, "roothash: runtime message queue is full")
+
+	// ErrRuntimeDescriptorNotFound is the error returned when the registry runtime descriptor
+	// referenced by a runtime state no longer exists.
+	ErrRuntimeDescriptorNotFound = errors.New(ModuleName, 12, "roothash: referenced runtime descriptor not found")
+
 	// MethodExecutorCommit is the method name for executor commit submission.
 	MethodExecutorCommit = transaction.NewMethodName(ModuleName, "ExecutorCommit", ExecutorCommit{})
 
@@ -118,6 +126,12 @@ type Backend interface {
 	// WatchEvents returns a stream of protocol events.
 	WatchEvents(ctx context.Context, runtimeID common.Namespace) (<-chan *Event, pubsub.ClosableSubscription, error)
 
+	// WatchRuntimeState returns a channel that produces a stream of runtime state updates.
+	//
+	// The latest runtime state will get pushed to the stream immediately. Subsequent updates
+	// will be pushed into the stream in order as the runtime state changes are committed.
+	WatchRuntimeState(ctx context.Context, runtimeID common.Namespace) (<-chan *RuntimeStateUpdate, pubsub.ClosableSubscription, error)
+
 	// TrackRuntime adds a runtime the history of which should be tracked.
 	TrackRuntime(ctx context.Context, history BlockHistory) error
 
@@ -321,7 +335,16 @@ func NewEvidenceTx(nonce uint64, fee *transaction.Fee, evidence *Evidence) *tran
 
 // RuntimeState is the per-runtime state.
 type RuntimeState struct {
-	Runtime   *registry.Runtime `json:"runtime"`
+	// RuntimeID is the runtime identifier.
+	RuntimeID common.Namespace `json:"runtime_id"`
+	// DescriptorHash is the hash of the registry runtime descriptor in effect for the runtime.
+	DescriptorHash hash.Hash `json:"descriptor_hash"`
+
+	// Runtime is the registry runtime descriptor referenced by DescriptorHash.
+	//
+	// The descriptor is owned by the registry and is not stored as part of the roothash state,
+	// instead it is resolved from the registry whenever the runtime state is loaded.
+	Runtime   *registry.Runtime `json:"runtime,omitempty"`
 	Suspended bool              `json:"suspended,omitempty"`
 
 	GenesisBlock *block.Block `json:"genesis_block"`
@@ -338,6 +361,28 @@ type RuntimeState struct {
 	ExecutorPool *commitment.Pool `json:"executor_pool"`
 }
 
+// RuntimeStateUpdate is a runtime state change notification.
+type RuntimeStateUpdate struct {
+	// Height is the consensus block height at which the runtime's current block was produced.
+	Height int64 `json:"height"`
+	// Round is the round of the runtime's current block.
+	Round uint64 `json:"round"`
+	// BlockHash is the hash of the runtime's current block header.
+	BlockHash hash.Hash `json:"block_hash"`
+	// StateRoot is the state root of the runtime's current block.
+	StateRoot hash.Hash `json:"state_root"`
+}
+
+// NewRuntimeStateUpdate creates a new runtime state update from the given runtime state.
+func NewRuntimeStateUpdate(state *RuntimeState) *RuntimeStateUpdate {
+	return &RuntimeStateUpdate{
+		Height:    state.CurrentBlockHeight,
+		Round:     state.CurrentBlock.Header.Round,
+		BlockHash: state.CurrentBlock.Header.EncodedHash(),
+		StateRoot: state.CurrentBlock.Header.StateRoot,
+	}
+}
+
 // AnnotatedBlock is an annotated roothash block.
 type AnnotatedBlock struct {
 	// Height is the underlying roothash backend's block height that
@@ -435,6 +480,11 @@ type ConsensusParameters struct {
 	// in a single round.
 	MaxRuntimeMessages uint32 `json:"max_runtime_messages"`
 
+	// MaxRuntimeMessageQueueSize is the maximum number of messages that can be queued for
+	// processing by the consensus layer in each runtime's message queue. Zero disables message
+	// queueing.
+	MaxRuntimeMessageQueueSize uint32 `json:"max_runtime_message_queue_size,omitempty"`
+
 	// MaxEvidenceAge is the maximum age of submitted evidence in the number of rounds.
 	MaxEvidenceAge uint64 `json:"max_evidence_age"`
 }
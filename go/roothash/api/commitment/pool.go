@@ -82,8 +82,11 @@ type Pool struct {
 	ExecuteCommitments map[signature.PublicKey]*ExecutorCommitment `json:"execute_commitments,omitempty"`
 	// Discrepancy is a flag signalling that a discrepancy has been detected.
 	Discrepancy bool `json:"discrepancy"`
-	// NextTimeout is the time when the next call to TryFinalize(true) should
-	// be scheduled to be executed. Zero means that no timeout is to be scheduled.
+	// NextTimeout is the consensus block height at which the next call to TryFinalize(true)
+	// should be scheduled to be executed. Zero means that no timeout is to be scheduled.
+	//
+	// The timeout is expressed purely in consensus time so it is deterministic across all
+	// validators and is serialized as a plain integer.
 	NextTimeout int64 `json:"next_timeout"`
 
 	// memberSet is a cached committee member set. It will be automatically
@@ -596,7 +599,8 @@ func (p *Pool) TryFinalize(
 	}
 }
 
-// IsTimeout returns true if the time is up for pool's TryFinalize to be called.
+// IsTimeout returns true if the given consensus block height is at or after the scheduled
+// timeout, meaning that pool's TryFinalize should be called.
 func (p *Pool) IsTimeout(height int64) bool {
 	return p.NextTimeout != TimeoutNever && height >= p.NextTimeout
 }
@@ -3,6 +3,7 @@ package commitment
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"testing"
 
@@ -758,6 +759,29 @@ func TestPoolSerialization(t *testing.T) {
 	require.EqualValues(t, &ec, ddEc, "DD should return the correct commitment")
 }
 
+func TestPoolTimeoutSerialization(t *testing.T) {
+	require := require.New(t)
+
+	// The round timeout is part of the consensus state, so its encoding must never change.
+	for _, tc := range []struct {
+		pool           Pool
+		expectedBase64 string
+	}{
+		{Pool{}, "pWVyb3VuZABncnVudGltZfZpY29tbWl0dGVl9mtkaXNjcmVwYW5jefRsbmV4dF90aW1lb3V0AA=="},
+		{Pool{Round: 3, NextTimeout: 42}, "pWVyb3VuZANncnVudGltZfZpY29tbWl0dGVl9mtkaXNjcmVwYW5jefRsbmV4dF90aW1lb3V0GCo="},
+		{Pool{Round: 3, Discrepancy: true, NextTimeout: 1 << 40}, "pWVyb3VuZANncnVudGltZfZpY29tbWl0dGVl9mtkaXNjcmVwYW5jefVsbmV4dF90aW1lb3V0GwAAAQAAAAAA"},
+	} {
+		enc := cbor.Marshal(tc.pool)
+		require.Equal(tc.expectedBase64, base64.StdEncoding.EncodeToString(enc), "serialization should match")
+
+		var dec Pool
+		err := cbor.Unmarshal(enc, &dec)
+		require.NoError(err, "Unmarshal")
+		require.EqualValues(tc.pool, dec, "Pool serialization should round-trip")
+		require.Equal(tc.pool.NextTimeout, dec.NextTimeout, "timeout height should round-trip")
+	}
+}
+
 func TestTryFinalize(t *testing.T) {
 	genesisTestHelpers.SetTestChainContext()
 
@@ -34,6 +34,8 @@ var (
 	methodWatchBlocks = serviceName.NewMethod("WatchBlocks", common.Namespace{})
 	// methodWatchEvents is the WatchEvents method.
 	methodWatchEvents = serviceName.NewMethod("WatchEvents", common.Namespace{})
+	// methodWatchRuntimeState is the WatchRuntimeState method.
+	methodWatchRuntimeState = serviceName.NewMethod("WatchRuntimeState", common.Namespace{})
 
 	// serviceDesc is the gRPC service descriptor.
 	serviceDesc = grpc.ServiceDesc{
@@ -80,6 +82,11 @@ var (
 				Handler:       handlerWatchEvents,
 				ServerStreams: true,
 			},
+			{
+				StreamName:    methodWatchRuntimeState.ShortName(),
+				Handler:       handlerWatchRuntimeState,
+				ServerStreams: true,
+			},
 		},
 	}
 )
@@ -303,6 +310,35 @@ func handlerWatchEvents(srv interface{}, stream grpc.ServerStream) error {
 	}
 }
 
+func handlerWatchRuntimeState(srv interface{}, stream grpc.ServerStream) error {
+	var runtimeID common.Namespace
+	if err := stream.RecvMsg(&runtimeID); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	ch, sub, err := srv.(Backend).WatchRuntimeState(ctx, runtimeID)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case upd, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			if err := stream.SendMsg(upd); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // RegisterService registers a new roothash service with the given gRPC server.
 func RegisterService(server *grpc.Server, service Backend) {
 	server.RegisterService(&serviceDesc, service)
@@ -445,6 +481,41 @@ func (c *roothashClient) WatchEvents(ctx context.Context, runtimeID common.Names
 	return ch, sub, nil
 }
 
+func (c *roothashClient) WatchRuntimeState(ctx context.Context, runtimeID common.Namespace) (<-chan *RuntimeStateUpdate, pubsub.ClosableSubscription, error) {
+	ctx, sub := pubsub.NewContextSubscription(ctx)
+
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[2], methodWatchRuntimeState.FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = stream.SendMsg(runtimeID); err != nil {
+		return nil, nil, err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *RuntimeStateUpdate)
+	go func() {
+		defer close(ch)
+
+		for {
+			var upd RuntimeStateUpdate
+			if serr := stream.RecvMsg(&upd); serr != nil {
+				return
+			}
+
+			select {
+			case ch <- &upd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, sub, nil
+}
+
 // NewRootHashClient creates a new gRPC roothash client service.
 func NewRootHashClient(c *grpc.ClientConn) Backend {
 	return &roothashClient{
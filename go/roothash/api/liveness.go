@@ -0,0 +1,12 @@
+package api
+
+// NodeLivenessStatistics are the liveness statistics of a runtime committee member in the current
+// epoch.
+type NodeLivenessStatistics struct {
+	// RoundsParticipated is the number of rounds (including failed ones) in which the node
+	// submitted a commitment.
+	RoundsParticipated uint64 `json:"rounds_participated"`
+	// RoundsMissed is the number of rounds (including failed and timed out ones) in which the
+	// node was expected to submit a commitment, but did not.
+	RoundsMissed uint64 `json:"rounds_missed"`
+}
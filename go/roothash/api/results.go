@@ -1,6 +1,9 @@
 package api
 
-import "github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+import (
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+)
 
 // RoundResults contains information about how a particular round was executed by the consensus
 // layer.
@@ -15,3 +18,11 @@ type RoundResults struct {
 	// negatively contributed to the round by causing discrepancies.
 	BadComputeEntities []signature.PublicKey `json:"bad_compute_entities,omitempty"`
 }
+
+// RoundRoots contains the storage roots of a particular round.
+type RoundRoots struct {
+	// StateRoot is the state root.
+	StateRoot hash.Hash `json:"state_root"`
+	// IORoot is the I/O root.
+	IORoot hash.Hash `json:"io_root"`
+}
@@ -2,9 +2,13 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
 	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
@@ -46,6 +50,24 @@ var (
 		signature.NewPublicKey("1abe11eddeaccfffffffffffffffffffffffffffffffffffffffffffffffffff"),
 	)
 
+	// BurnAddress is the burn address.
+	// Any tokens transferred to this address are burned and removed from the total supply.
+	// The address is reserved to prevent it from being accidentally used in the actual ledger.
+	BurnAddress = NewReservedAddress(
+		signature.NewPublicKey("0000000000000000000000000000000000000000000000000000000000000000"),
+	)
+
+	// ReservedAccountAddresses are the addresses of the reserved module accounts which hold
+	// balances outside of the ledger.
+	//
+	// These accounts are addressable like regular accounts (via Account and Addresses), but can
+	// never sign transactions or be used as transfer destinations.
+	ReservedAccountAddresses = []Address{
+		CommonPoolAddress,
+		FeeAccumulatorAddress,
+		GovernanceDepositsAddress,
+	}
+
 	// ErrInvalidArgument is the error returned on malformed arguments.
 	ErrInvalidArgument = errors.New(ModuleName, 1, "staking: invalid argument")
 
@@ -77,6 +99,58 @@ var (
 	// consensus parameters.
 	ErrUnderMinDelegationAmount = errors.New(ModuleName, 8, "staking: amount is lower than the minimum delegation amount")
 
+	// ErrAllowanceExpired is the error returned when withdrawing using an allowance that has
+	// already expired.
+	ErrAllowanceExpired = errors.New(ModuleName, 9, "staking: allowance expired")
+
+	// ErrBalanceTooLow is the error returned when an operation would leave the general balance of
+	// an account below the minimum account balance.
+	ErrBalanceTooLow = errors.New(ModuleName, 10, "staking: balance below minimum account balance")
+
+	// ErrTransactionNotFound is the error returned when a transaction with the given hash is not
+	// known, either because it was never submitted or because it is outside of the retention window
+	// of the transaction index.
+	ErrTransactionNotFound = errors.New(ModuleName, 11, "staking: transaction not found")
+
+	// ErrTransactionPending is the error returned when a transaction with the given hash has been
+	// submitted but has not yet been included in a block.
+	ErrTransactionPending = errors.New(ModuleName, 12, "staking: transaction not yet included")
+
+	// ErrEscrowSnapshotNotFound is the error returned when no escrow snapshot is available for the
+	// given epoch, either because snapshots are disabled, the epoch has not been reached yet or the
+	// snapshot is outside of the retention window.
+	ErrEscrowSnapshotNotFound = errors.New(ModuleName, 13, "staking: escrow snapshot not found")
+
+	// ErrInvalidMultiSig is the error returned when the signers of a transaction are not allowed
+	// to act on behalf of the account, e.g., because they do not satisfy the account's
+	// multi-signature descriptor.
+	ErrInvalidMultiSig = errors.New(ModuleName, 14, "staking: invalid multi-signature")
+
+	// ErrMetadataTooLarge is the error returned when account metadata exceeds the maximum
+	// allowed size.
+	ErrMetadataTooLarge = errors.New(ModuleName, 15, "staking: account metadata too large")
+
+	// ErrTransferLimitExceeded is the error returned when an operation would exceed the
+	// per-epoch transfer limit of the source account. See TransferLimitExceededError.
+	ErrTransferLimitExceeded = errors.New(ModuleName, 16, "staking: transfer limit exceeded")
+
+	// ErrCommissionRateOutOfBounds is the error returned when a commission schedule would set a
+	// commission rate outside of the commission rate bounds in effect at the same time.
+	ErrCommissionRateOutOfBounds = errors.New(ModuleName, 17, "staking: commission rate out of bounds")
+
+	// ErrCommissionChangeTooEarly is the error returned when a commission schedule amendment
+	// would change rates or rate bounds without the required notice period.
+	ErrCommissionChangeTooEarly = errors.New(ModuleName, 18, "staking: commission schedule change too early")
+
+	// ErrTransfersDisabled is the error returned when an operation would move tokens out of the
+	// general balance of an account while transfers are disabled and the account is not exempt.
+	ErrTransfersDisabled = errors.New(ModuleName, 19, "staking: transfers disabled")
+
+	// ErrDebugControllerDisabled is the error returned by DebugController methods when the
+	// backend has not been configured to allow controlling the passage of time, or does not
+	// support the requested operation.
+	ErrDebugControllerDisabled = errors.New(ModuleName, 20, "staking: debug controller disabled")
+
 	// MethodTransfer is the method name for transfers.
 	MethodTransfer = transaction.NewMethodName(ModuleName, "Transfer", Transfer{})
 	// MethodBurn is the method name for burns.
@@ -91,6 +165,12 @@ var (
 	MethodAllow = transaction.NewMethodName(ModuleName, "Allow", Allow{})
 	// MethodWithdraw is the method name for
 	MethodWithdraw = transaction.NewMethodName(ModuleName, "Withdraw", Withdraw{})
+	// MethodAccountUpdate is the method name for account configuration updates.
+	MethodAccountUpdate = transaction.NewMethodName(ModuleName, "AccountUpdate", AccountUpdate{})
+	// MethodSetMetadata is the method name for setting account metadata.
+	MethodSetMetadata = transaction.NewMethodName(ModuleName, "SetMetadata", SetMetadata{})
+	// MethodSetTransferLimit is the method name for configuring account transfer limits.
+	MethodSetTransferLimit = transaction.NewMethodName(ModuleName, "SetTransferLimit", SetTransferLimit{})
 
 	// Methods is the list of all methods supported by the staking backend.
 	Methods = []transaction.MethodName{
@@ -101,6 +181,9 @@ var (
 		MethodAmendCommissionSchedule,
 		MethodAllow,
 		MethodWithdraw,
+		MethodAccountUpdate,
+		MethodSetMetadata,
+		MethodSetTransferLimit,
 	}
 
 	_ prettyprint.PrettyPrinter = (*Transfer)(nil)
@@ -131,6 +214,8 @@ type Backend interface {
 	TotalSupply(ctx context.Context, height int64) (*quantity.Quantity, error)
 
 	// CommonPool returns the common pool balance.
+	//
+	// This is a shorthand for the general balance of the CommonPoolAddress account.
 	CommonPool(ctx context.Context, height int64) (*quantity.Quantity, error)
 
 	// LastBlockFees returns the collected fees for previous block.
@@ -143,7 +228,8 @@ type Backend interface {
 	Threshold(ctx context.Context, query *ThresholdQuery) (*quantity.Quantity, error)
 
 	// Addresses returns the addresses of all accounts with a non-zero general
-	// or escrow balance.
+	// or escrow balance, including any reserved module accounts (see
+	// ReservedAccountAddresses) with a non-zero balance.
 	Addresses(ctx context.Context, height int64) ([]Address, error)
 
 	// Account returns the account descriptor for the given account.
@@ -174,7 +260,35 @@ type Backend interface {
 	DebondingDelegationsTo(ctx context.Context, query *OwnerQuery) (map[Address][]*DebondingDelegation, error)
 
 	// Allowance looks up the allowance for the given owner/beneficiary combination.
-	Allowance(ctx context.Context, query *AllowanceQuery) (*quantity.Quantity, error)
+	//
+	// Allowances that have expired at the given height are reported as zero.
+	Allowance(ctx context.Context, query *AllowanceQuery) (*Allowance, error)
+
+	// Allowances returns all allowances configured by the given owner, keyed by beneficiary.
+	//
+	// Allowances that have expired at the given height are omitted.
+	Allowances(ctx context.Context, query *OwnerQuery) (map[Address]*Allowance, error)
+
+	// AccountMetadata returns the metadata attached to the given account, if any.
+	AccountMetadata(ctx context.Context, query *OwnerQuery) ([]byte, error)
+
+	// CommissionSchedule returns the commission schedule of the given escrow account.
+	CommissionSchedule(ctx context.Context, query *OwnerQuery) (*CommissionSchedule, error)
+
+	// SharesToTokens converts the given amount of active escrow shares of the given escrow
+	// account to base units, rounding down.
+	SharesToTokens(ctx context.Context, query *EscrowExchangeQuery) (*quantity.Quantity, error)
+
+	// TokensToShares converts the given amount of base units to the amount of active escrow
+	// shares of the given escrow account that a deposit of that amount would obtain, rounding
+	// down.
+	TokensToShares(ctx context.Context, query *EscrowExchangeQuery) (*quantity.Quantity, error)
+
+	// EscrowSnapshot returns the snapshot of active escrow pools taken at the transition to the
+	// given epoch.
+	//
+	// In case no snapshot is available for the given epoch, ErrEscrowSnapshotNotFound is returned.
+	EscrowSnapshot(ctx context.Context, epoch beacon.EpochTime) (*EscrowSnapshot, error)
 
 	// StateToGenesis returns the genesis state at specified block height.
 	StateToGenesis(ctx context.Context, height int64) (*Genesis, error)
@@ -185,13 +299,57 @@ type Backend interface {
 	// GetEvents returns the events at specified block height.
 	GetEvents(ctx context.Context, height int64) ([]*Event, error)
 
+	// GetTransaction returns the result of executing the transaction with the given hash.
+	//
+	// In case the transaction is not known, ErrTransactionNotFound is returned. In case the
+	// transaction has been submitted but not yet included in a block, ErrTransactionPending is
+	// returned. Results are only retained for a limited number of recent blocks, so results of
+	// older transactions may no longer be available. Backends may also not index transaction
+	// results at all (e.g., the tendermint backend unless the transaction index is enabled), in
+	// which case ErrTransactionNotFound is returned for all included transactions.
+	GetTransaction(ctx context.Context, txHash hash.Hash) (*TransactionResult, error)
+
+	// GetStatus returns the status of the backend, which can be used to determine whether it has
+	// caught up with the chain or is still initializing from genesis.
+	GetStatus(ctx context.Context) (*Status, error)
+
 	// WatchEvents returns a channel that produces a stream of Events.
 	WatchEvents(ctx context.Context) (<-chan *Event, pubsub.ClosableSubscription, error)
 
+	// QueryEvents returns a page of events matching the given query.
+	QueryEvents(ctx context.Context, query *EventsQuery) (*EventsPage, error)
+
+	// WatchEventsFrom returns a channel that produces the events matching the given query,
+	// starting with the events at the given height, followed by new events as they are emitted.
+	//
+	// In case the events can no longer be retrieved, the channel is closed and the error is
+	// reported by the returned subscription.
+	WatchEventsFrom(ctx context.Context, query *EventsWatchQuery) (<-chan *Event, *EventsSubscription, error)
+
 	// Cleanup cleans up the backend.
 	Cleanup()
 }
 
+// Status is the status of a staking backend.
+type Status struct {
+	// LatestHeight is the height of the last block processed by the backend. It is zero in case
+	// the backend has not processed any blocks yet and is still initializing from genesis.
+	LatestHeight int64 `json:"latest_height"`
+	// LatestTime is the timestamp of the last block processed by the backend.
+	LatestTime time.Time `json:"latest_time"`
+	// GenesisHash is the hash of the staking genesis state the backend was initialized from.
+	GenesisHash hash.Hash `json:"genesis_hash"`
+	// NumAccounts is the number of accounts (as returned by Addresses) at the latest height, or in
+	// the genesis state in case no blocks have been processed yet.
+	NumAccounts uint64 `json:"num_accounts"`
+	// TotalSupply is the total supply at the latest height, or in the genesis state in case no
+	// blocks have been processed yet.
+	TotalSupply quantity.Quantity `json:"total_supply"`
+	// EventsLive is true iff events are being delivered to watch subscriptions as blocks are
+	// processed.
+	EventsLive bool `json:"events_live"`
+}
+
 // ThresholdQuery is a threshold query.
 type ThresholdQuery struct {
 	Height int64         `json:"height"`
@@ -211,6 +369,32 @@ type AllowanceQuery struct {
 	Beneficiary Address `json:"beneficiary"`
 }
 
+// EscrowExchangeQuery is a query for converting between base units and active escrow shares of
+// an escrow account.
+type EscrowExchangeQuery struct {
+	Height int64             `json:"height"`
+	Escrow Address           `json:"escrow"`
+	Amount quantity.Quantity `json:"amount"`
+}
+
+// EscrowSnapshot is a snapshot of the active escrow pools of all accounts, taken at an epoch
+// transition.
+type EscrowSnapshot struct {
+	// Epoch is the epoch that the snapshot was taken at the transition to.
+	Epoch beacon.EpochTime `json:"epoch"`
+	// Escrow are the active escrow pools of all accounts with a non-zero active escrow balance.
+	Escrow map[Address]SharePool `json:"escrow,omitempty"`
+}
+
+// Allowance is a beneficiary allowance.
+type Allowance struct {
+	// Amount is the amount the beneficiary is still allowed to withdraw.
+	Amount quantity.Quantity `json:"amount"`
+	// Expiry is the last block height at which the allowance can be used. Zero means that the
+	// allowance does not expire.
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
 // TransferEvent is the event emitted when stake is transferred, either by a
 // call to Transfer or Withdraw.
 type TransferEvent struct {
@@ -241,17 +425,138 @@ type EscrowEvent struct {
 	Take           *TakeEscrowEvent           `json:"take,omitempty"`
 	DebondingStart *DebondingStartEscrowEvent `json:"debonding_start,omitempty"`
 	Reclaim        *ReclaimEscrowEvent        `json:"reclaim,omitempty"`
+	Slash          *SlashEvent                `json:"slash,omitempty"`
+}
+
+// TransactionError is a transaction execution error.
+type TransactionError struct {
+	Module  string `json:"module,omitempty"`
+	Code    uint32 `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewTransactionError creates a new transaction execution error from the given error.
+func NewTransactionError(err error) TransactionError {
+	if err == nil {
+		return TransactionError{}
+	}
+
+	module, code := errors.Code(err)
+	return TransactionError{
+		Module:  module,
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
+// IsSuccess returns true if transaction execution was successful.
+func (e *TransactionError) IsSuccess() bool {
+	return e.Code == errors.CodeNoError
+}
+
+// Err returns the transaction execution error or nil if transaction execution was successful.
+//
+// In case the error is registered, the returned error can be compared against it using
+// errors.Is.
+func (e *TransactionError) Err() error {
+	if e.IsSuccess() {
+		return nil
+	}
+	return errors.FromCode(e.Module, e.Code, e.Message)
+}
+
+// TransactionResult is the result of executing a transaction, returned via GetTransaction.
+type TransactionResult struct {
+	// Height is the height of the block in which the transaction was included.
+	Height int64 `json:"height"`
+	// Error is the transaction execution error, if any.
+	Error TransactionError `json:"error"`
+	// Events are the staking events emitted during transaction execution.
+	Events []*Event `json:"events,omitempty"`
+}
+
+// IsSuccess returns true if transaction execution was successful.
+func (r *TransactionResult) IsSuccess() bool {
+	return r.Error.IsSuccess()
 }
 
 // Event signifies a staking event, returned via GetEvents.
 type Event struct {
 	Height int64     `json:"height,omitempty"`
 	TxHash hash.Hash `json:"tx_hash,omitempty"`
+	// Signer is the address of the account on whose behalf the transaction that caused the event
+	// was executed. It is nil for events not caused by a transaction (e.g., epoch rewards).
+	Signer *Address `json:"signer,omitempty"`
 
 	Transfer        *TransferEvent        `json:"transfer,omitempty"`
 	Burn            *BurnEvent            `json:"burn,omitempty"`
 	Escrow          *EscrowEvent          `json:"escrow,omitempty"`
 	AllowanceChange *AllowanceChangeEvent `json:"allowance_change,omitempty"`
+	MetadataUpdated *MetadataUpdatedEvent `json:"metadata_updated,omitempty"`
+	AccountCreated  *AccountCreatedEvent  `json:"account_created,omitempty"`
+	AccountReaped   *AccountReapedEvent   `json:"account_reaped,omitempty"`
+}
+
+// Kind returns a string representation of the kind of the contained event or
+// an empty string in case the event is empty.
+//
+// This makes it possible to dispatch on events received via WatchEvents, where
+// all events are delivered in order over a single channel.
+func (e *Event) Kind() string {
+	switch {
+	case e.Transfer != nil:
+		return e.Transfer.EventKind()
+	case e.Burn != nil:
+		return e.Burn.EventKind()
+	case e.Escrow != nil:
+		switch {
+		case e.Escrow.Add != nil:
+			return e.Escrow.Add.EventKind()
+		case e.Escrow.Take != nil:
+			return e.Escrow.Take.EventKind()
+		case e.Escrow.DebondingStart != nil:
+			return e.Escrow.DebondingStart.EventKind()
+		case e.Escrow.Reclaim != nil:
+			return e.Escrow.Reclaim.EventKind()
+		case e.Escrow.Slash != nil:
+			return e.Escrow.Slash.EventKind()
+		}
+	case e.AllowanceChange != nil:
+		return e.AllowanceChange.EventKind()
+	case e.MetadataUpdated != nil:
+		return e.MetadataUpdated.EventKind()
+	case e.AccountCreated != nil:
+		return e.AccountCreated.EventKind()
+	case e.AccountReaped != nil:
+		return e.AccountReaped.EventKind()
+	}
+	return ""
+}
+
+// EscrowBalances are the balances of the accounts involved in an escrow operation, as they were
+// right after the operation was executed.
+type EscrowBalances struct {
+	// OwnerGeneralBalance is the general balance of the owner account.
+	OwnerGeneralBalance quantity.Quantity `json:"owner_general_balance"`
+	// EscrowActive is the active escrow pool of the escrow account.
+	EscrowActive SharePool `json:"escrow_active"`
+	// EscrowDebonding is the debonding escrow pool of the escrow account.
+	EscrowDebonding SharePool `json:"escrow_debonding"`
+}
+
+// NewEscrowBalances returns the escrow balances of the given owner and escrow accounts.
+func NewEscrowBalances(owner, escrow *Account) *EscrowBalances {
+	return &EscrowBalances{
+		OwnerGeneralBalance: *owner.General.Balance.Clone(),
+		EscrowActive: SharePool{
+			Balance:     *escrow.Escrow.Active.Balance.Clone(),
+			TotalShares: *escrow.Escrow.Active.TotalShares.Clone(),
+		},
+		EscrowDebonding: SharePool{
+			Balance:     *escrow.Escrow.Debonding.Balance.Clone(),
+			TotalShares: *escrow.Escrow.Debonding.TotalShares.Clone(),
+		},
+	}
 }
 
 // AddEscrowEvent is the event emitted when stake is transferred into an escrow
@@ -261,6 +566,10 @@ type AddEscrowEvent struct {
 	Escrow    Address           `json:"escrow"`
 	Amount    quantity.Quantity `json:"amount"`
 	NewShares quantity.Quantity `json:"new_shares"`
+
+	// Balances are the resulting balances after stake has been escrowed. They are only present
+	// for events emitted by escrow transactions.
+	Balances *EscrowBalances `json:"balances,omitempty"`
 }
 
 // EventKind returns a string representation of this event's kind.
@@ -307,6 +616,9 @@ type ReclaimEscrowEvent struct {
 	Escrow Address           `json:"escrow"`
 	Amount quantity.Quantity `json:"amount"`
 	Shares quantity.Quantity `json:"shares"`
+
+	// Balances are the resulting balances after stake has been reclaimed.
+	Balances *EscrowBalances `json:"balances,omitempty"`
 }
 
 // EventKind returns a string representation of this event's kind.
@@ -321,6 +633,7 @@ type AllowanceChangeEvent struct { // nolint: maligned
 	Allowance    quantity.Quantity `json:"allowance"`
 	Negative     bool              `json:"negative,omitempty"`
 	AmountChange quantity.Quantity `json:"amount_change"`
+	Expiry       int64             `json:"expiry,omitempty"`
 }
 
 // EventKind returns a string representation of this event's kind.
@@ -459,6 +772,13 @@ type Allow struct {
 	Beneficiary  Address           `json:"beneficiary"`
 	Negative     bool              `json:"negative,omitempty"`
 	AmountChange quantity.Quantity `json:"amount_change"`
+
+	// Expiry is the last block height at which the resulting allowance can be used. If positive,
+	// the expiry replaces any previously configured expiry of the allowance. Zero keeps the
+	// previously configured expiry (if any), so an allowance without an expiry does not expire.
+	// A negative value removes the previously configured expiry, making the allowance
+	// non-expiring.
+	Expiry int64 `json:"expiry,omitempty"`
 }
 
 // PrettyPrint writes a pretty-printed representation of Allow to the given writer.
@@ -473,6 +793,13 @@ func (aw Allow) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
 	fmt.Fprintf(w, "%sAmount change: ", prefix)
 	token.PrettyPrintAmount(ctx, aw.AmountChange, w)
 	fmt.Fprintln(w)
+
+	switch {
+	case aw.Expiry > 0:
+		fmt.Fprintf(w, "%sExpiry:        %d\n", prefix, aw.Expiry)
+	case aw.Expiry < 0:
+		fmt.Fprintf(w, "%sExpiry:        none\n", prefix)
+	}
 }
 
 // PrettyType returns a representation of Allow that can be used for pretty printing.
@@ -533,8 +860,10 @@ func (p SharePool) PrettyType() (interface{}, error) {
 	return p, nil
 }
 
-// sharesForStake computes the amount of shares for the given amount of base units.
-func (p *SharePool) sharesForStake(amount *quantity.Quantity) (*quantity.Quantity, error) {
+// SharesForStake computes the amount of shares for the given amount of base units.
+//
+// The result is rounded down, so depositing never dilutes existing shares.
+func (p *SharePool) SharesForStake(amount *quantity.Quantity) (*quantity.Quantity, error) {
 	if p.TotalShares.IsZero() {
 		// No existing shares, exchange rate is 1:1.
 		return amount.Clone(), nil
@@ -568,7 +897,7 @@ func (p *SharePool) sharesForStake(amount *quantity.Quantity) (*quantity.Quantit
 //
 // If an error occurs, the pool and affected accounts are left in an invalid state.
 func (p *SharePool) Deposit(shareDst, stakeSrc, baseUnitsAmount *quantity.Quantity) (*quantity.Quantity, error) {
-	shares, err := p.sharesForStake(baseUnitsAmount)
+	shares, err := p.SharesForStake(baseUnitsAmount)
 	if err != nil {
 		return nil, err
 	}
@@ -589,6 +918,8 @@ func (p *SharePool) Deposit(shareDst, stakeSrc, baseUnitsAmount *quantity.Quanti
 }
 
 // StakeForShares computes the amount of base units for the given amount of shares.
+//
+// The result is rounded down, so the sum of base units of all shares never exceeds the balance.
 func (p *SharePool) StakeForShares(amount *quantity.Quantity) (*quantity.Quantity, error) {
 	if amount.IsZero() || p.Balance.IsZero() || p.TotalShares.IsZero() {
 		// No existing shares or no balance means no base units.
@@ -878,6 +1209,96 @@ type GeneralAccount struct {
 	Nonce   uint64            `json:"nonce,omitempty"`
 
 	Allowances map[Address]quantity.Quantity `json:"allowances,omitempty"`
+	// AllowanceExpiries are the last block heights at which the corresponding allowances can be
+	// used. Allowances without an entry do not expire.
+	AllowanceExpiries map[Address]int64 `json:"allowance_expiries,omitempty"`
+
+	// MultiSig is the multi-signature descriptor of the account. If set, transactions on behalf
+	// of the account must be multi-signed by signers satisfying the descriptor.
+	MultiSig *MultiSigDescriptor `json:"multisig,omitempty"`
+
+	// Metadata is opaque metadata attached to the account by its owner, see SetMetadata.
+	Metadata []byte `json:"metadata,omitempty"`
+
+	// TransferLimit is the per-epoch limit on outgoing transfers, see SetTransferLimit.
+	TransferLimit *TransferLimit `json:"transfer_limit,omitempty"`
+
+	// CreatedAt is the block height at which the account was created. It is zero for accounts
+	// created before creation heights were recorded.
+	CreatedAt int64 `json:"created_at,omitempty"`
+}
+
+// IsAllowanceExpired returns true iff the allowance for the given beneficiary has expired at the
+// given block height.
+func (ga *GeneralAccount) IsAllowanceExpired(beneficiary Address, height int64) bool {
+	expiry, ok := ga.AllowanceExpiries[beneficiary]
+	return ok && height > expiry
+}
+
+// GetAllowance returns the allowance for the given beneficiary at the given block height.
+//
+// Expired allowances are reported as zero.
+func (ga *GeneralAccount) GetAllowance(beneficiary Address, height int64) *Allowance {
+	if ga.IsAllowanceExpired(beneficiary, height) {
+		return &Allowance{}
+	}
+	return &Allowance{
+		Amount: ga.Allowances[beneficiary],
+		Expiry: ga.AllowanceExpiries[beneficiary],
+	}
+}
+
+// GetAllowances returns all allowances that have not expired at the given block height, keyed by
+// beneficiary.
+func (ga *GeneralAccount) GetAllowances(height int64) map[Address]*Allowance {
+	allowances := make(map[Address]*Allowance, len(ga.Allowances))
+	for beneficiary := range ga.Allowances {
+		if ga.IsAllowanceExpired(beneficiary, height) {
+			continue
+		}
+		allowances[beneficiary] = ga.GetAllowance(beneficiary, height)
+	}
+	return allowances
+}
+
+// SetAllowance sets the allowance for the given beneficiary, removing it in case the amount is
+// zero.
+func (ga *GeneralAccount) SetAllowance(beneficiary Address, allowance *Allowance) {
+	if allowance.Amount.IsZero() {
+		delete(ga.Allowances, beneficiary)
+		delete(ga.AllowanceExpiries, beneficiary)
+		return
+	}
+
+	if ga.Allowances == nil {
+		ga.Allowances = make(map[Address]quantity.Quantity)
+	}
+	ga.Allowances[beneficiary] = allowance.Amount
+
+	switch allowance.Expiry {
+	case 0:
+		delete(ga.AllowanceExpiries, beneficiary)
+	default:
+		if ga.AllowanceExpiries == nil {
+			ga.AllowanceExpiries = make(map[Address]int64)
+		}
+		ga.AllowanceExpiries[beneficiary] = allowance.Expiry
+	}
+}
+
+// PruneExpiredAllowances removes all allowances that have expired at the given block height.
+func (ga *GeneralAccount) PruneExpiredAllowances(height int64) {
+	for beneficiary := range ga.AllowanceExpiries {
+		if ga.IsAllowanceExpired(beneficiary, height) {
+			ga.SetAllowance(beneficiary, &Allowance{})
+		}
+	}
+	if len(ga.Allowances) == 0 {
+		ga.Allowances = nil
+	}
+	if len(ga.AllowanceExpiries) == 0 {
+		ga.AllowanceExpiries = nil
+	}
 }
 
 // PrettyPrint writes a pretty-printed representation of GeneralAccount to the
@@ -896,9 +1317,30 @@ func (ga GeneralAccount) PrettyPrint(ctx context.Context, prefix string, w io.Wr
 		for beneficiary, allowance := range ga.Allowances {
 			fmt.Fprintf(w, "%s%s%s: ", prefix, prefix, beneficiary)
 			token.PrettyPrintAmount(ctx, allowance, w)
+			if expiry, ok := ga.AllowanceExpiries[beneficiary]; ok {
+				fmt.Fprintf(w, " (expires after height %d)", expiry)
+			}
 			fmt.Fprintln(w)
 		}
 	}
+
+	if ga.MultiSig != nil {
+		fmt.Fprintf(w, "%sMulti-signature:\n", prefix)
+		ga.MultiSig.PrettyPrint(ctx, prefix+"  ", w)
+	}
+
+	if len(ga.Metadata) > 0 {
+		fmt.Fprintf(w, "%sMetadata: %s\n", prefix, hex.EncodeToString(ga.Metadata))
+	}
+
+	if ga.TransferLimit != nil {
+		fmt.Fprintf(w, "%sTransfer limit:\n", prefix)
+		ga.TransferLimit.PrettyPrint(ctx, prefix+"  ", w)
+	}
+
+	if ga.CreatedAt != 0 {
+		fmt.Fprintf(w, "%sCreated at height: %d\n", prefix, ga.CreatedAt)
+	}
 }
 
 // PrettyType returns a representation of GeneralAccount that can be used for
@@ -1013,6 +1455,41 @@ func (a Account) PrettyType() (interface{}, error) {
 	return a, nil
 }
 
+// IsReapable returns true iff the account holds no balances, no escrow shares, no commission
+// schedule, no stake claims, no multi-signature descriptor, no transfer limit and no metadata, so
+// that removing it from the ledger loses no state other than its allowances and creation height.
+// The nonce of a reaped account is retained, see AccountReapedEvent.
+func (a *Account) IsReapable() bool {
+	return a.General.MultiSig == nil &&
+		a.General.TransferLimit == nil &&
+		len(a.General.Metadata) == 0 &&
+		a.General.Balance.IsZero() &&
+		a.Escrow.Active.Balance.IsZero() &&
+		a.Escrow.Active.TotalShares.IsZero() &&
+		a.Escrow.Debonding.Balance.IsZero() &&
+		a.Escrow.Debonding.TotalShares.IsZero() &&
+		len(a.Escrow.CommissionSchedule.Rates) == 0 &&
+		len(a.Escrow.CommissionSchedule.Bounds) == 0 &&
+		len(a.Escrow.StakeAccumulator.Claims) == 0
+}
+
+// CheckMinAccountBalance checks whether the general balance of the given account, after it has
+// been decreased by an operation, satisfies the minimum account balance.
+//
+// In case the balance is below the minimum and dust accounts are reaped, the remaining general
+// balance that must be swept into the common pool is returned. In case dust accounts are not
+// reaped, ErrBalanceTooLow is returned. Otherwise nil is returned.
+func (p *ConsensusParameters) CheckMinAccountBalance(acct *Account) (*quantity.Quantity, error) {
+	balance := &acct.General.Balance
+	if p.MinAccountBalance.IsZero() || balance.IsZero() || balance.Cmp(&p.MinAccountBalance) >= 0 {
+		return nil, nil
+	}
+	if !p.ReapDustAccounts {
+		return nil, ErrBalanceTooLow
+	}
+	return balance.Clone(), nil
+}
+
 // Delegation is a delegation descriptor.
 type Delegation struct {
 	Shares quantity.Quantity `json:"shares"`
@@ -1084,6 +1561,86 @@ type Genesis struct {
 	// DebondingDelegations is a nested map of staking delegations of the form:
 	// DEBONDING-DELEGATEE-ACCOUNT-ADDRESS: DEBONDING-DELEGATOR-ACCOUNT-ADDRESS: list of DEBONDING-DELEGATIONs.
 	DebondingDelegations map[Address]map[Address][]*DebondingDelegation `json:"debonding_delegations,omitempty"`
+
+	// ReapedAccounts is a map of the retained nonces of reaped accounts that have not been
+	// re-created since.
+	ReapedAccounts map[Address]uint64 `json:"reaped_accounts,omitempty"`
+
+	// duplicateLedgerKeys are the ledger keys that decoded to an address already present in the
+	// ledger. They are only tracked so that they can be reported by SanityCheck.
+	duplicateLedgerKeys []string
+}
+
+// UnmarshalJSON decodes a JSON marshaled genesis state.
+//
+// Ledger keys that decode to the same address (e.g., when given in different case) would
+// otherwise silently overwrite each other, so they are recorded and reported by SanityCheck.
+func (g *Genesis) UnmarshalJSON(data []byte) error {
+	type genesis Genesis
+	var decGenesis genesis
+	if err := json.Unmarshal(data, &decGenesis); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Ledger json.RawMessage `json:"ledger"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	duplicates, err := findDuplicateLedgerKeys(raw.Ledger)
+	if err != nil {
+		return err
+	}
+
+	*g = Genesis(decGenesis)
+	g.duplicateLedgerKeys = duplicates
+	return nil
+}
+
+// findDuplicateLedgerKeys returns all keys of the given raw JSON ledger object that decode to an
+// address that an earlier key already decoded to.
+func findDuplicateLedgerKeys(rawLedger json.RawMessage) ([]string, error) {
+	if len(rawLedger) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rawLedger))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		// Ledger is null.
+		return nil, nil
+	}
+
+	var duplicates []string
+	seen := make(map[Address]bool)
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("staking: malformed ledger key: %v", tok)
+		}
+		var addr Address
+		if err = addr.UnmarshalText([]byte(key)); err != nil {
+			return nil, err
+		}
+		if seen[addr] {
+			duplicates = append(duplicates, key)
+		}
+		seen[addr] = true
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+	}
+	return duplicates, nil
 }
 
 // ConsensusParameters are the staking consensus parameters.
@@ -1098,8 +1655,11 @@ type ConsensusParameters struct { // nolint: maligned
 	GasCosts                          transaction.Costs                   `json:"gas_costs,omitempty"`
 	MinDelegationAmount               quantity.Quantity                   `json:"min_delegation"`
 
-	DisableTransfers       bool             `json:"disable_transfers,omitempty"`
-	DisableDelegation      bool             `json:"disable_delegation,omitempty"`
+	// DisableTransfers disables transfers, allowances and withdrawals for all accounts not in
+	// UndisableTransfersFrom. Escrow operations are not affected.
+	DisableTransfers  bool `json:"disable_transfers,omitempty"`
+	DisableDelegation bool `json:"disable_delegation,omitempty"`
+	// UndisableTransfersFrom is the set of accounts which are exempt from DisableTransfers.
 	UndisableTransfersFrom map[Address]bool `json:"undisable_transfers_from,omitempty"`
 
 	// AllowEscrowMessages can be used to allow runtimes to perform AddEscrow
@@ -1109,6 +1669,32 @@ type ConsensusParameters struct { // nolint: maligned
 	// MaxAllowances is the maximum number of allowances an account can have. Zero means disabled.
 	MaxAllowances uint32 `json:"max_allowances,omitempty"`
 
+	// MinAccountBalance is the minimum non-zero general balance of an account. Transfers and
+	// withdrawals that would leave the source account with a non-zero general balance below this
+	// amount are handled as configured by ReapDustAccounts. Zero means disabled.
+	MinAccountBalance quantity.Quantity `json:"min_account_balance,omitempty"`
+
+	// ReapDustAccounts configures how operations that would leave an account with a general
+	// balance below MinAccountBalance are handled. If false, such operations fail with
+	// ErrBalanceTooLow. If true, the remaining general balance is swept into the common pool and
+	// the account is removed from the ledger in case it has no escrow.
+	//
+	// NOTE: Removing an account resets its nonce to zero. Transactions previously signed by the
+	// account can therefore be replayed once the account is funded again.
+	ReapDustAccounts bool `json:"reap_dust_accounts,omitempty"`
+
+	// EscrowSnapshotRetention is the number of most recent epochs for which a snapshot of the
+	// active escrow pools taken at the epoch transition is retained. Zero means disabled.
+	EscrowSnapshotRetention uint64 `json:"escrow_snapshot_retention,omitempty"`
+
+	// MinMetadataBalance is the minimum general balance an account must hold in order to set
+	// non-empty account metadata. Zero means no minimum.
+	MinMetadataBalance quantity.Quantity `json:"min_metadata_balance,omitempty"`
+
+	// TransferLimitRemovalDelay is the number of epochs after which a requested removal of an
+	// account's transfer limit takes effect. Zero means that removal is immediate.
+	TransferLimitRemovalDelay beacon.EpochTime `json:"transfer_limit_removal_delay,omitempty"`
+
 	// FeeSplitWeightPropose is the proportion of block fee portions that go to the proposer.
 	FeeSplitWeightPropose quantity.Quantity `json:"fee_split_weight_propose"`
 	// FeeSplitWeightVote is the proportion of block fee portions that go to the validator that votes.
@@ -1139,4 +1725,12 @@ const (
 	GasOpAllow transaction.Op = "allow"
 	// GasOpWithdraw is the gas operation identifier for withdraw.
 	GasOpWithdraw transaction.Op = "withdraw"
+	// GasOpAccountUpdate is the gas operation identifier for account update.
+	GasOpAccountUpdate transaction.Op = "account_update"
+	// GasOpSetMetadata is the gas operation identifier for set metadata.
+	GasOpSetMetadata transaction.Op = "set_metadata"
+	// GasOpSetMetadataByte is the gas operation identifier for each byte of metadata set.
+	GasOpSetMetadataByte transaction.Op = "set_metadata_byte"
+	// GasOpSetTransferLimit is the gas operation identifier for set transfer limit.
+	GasOpSetTransferLimit transaction.Op = "set_transfer_limit"
 )
@@ -8,6 +8,7 @@ import (
 
 	"github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
 )
 
@@ -259,6 +260,20 @@ func TestDebondingDelegationMerge(t *testing.T) {
 	}
 }
 
+func TestAccountIsReapable(t *testing.T) {
+	require := require.New(t)
+
+	var acct Account
+	require.True(acct.IsReapable(), "empty account should be reapable")
+
+	acct.General.Metadata = []byte("metadata")
+	require.False(acct.IsReapable(), "account with metadata should not be reapable")
+
+	acct.General.Metadata = nil
+	acct.General.Balance = mustInitQuantity(t, 1)
+	require.False(acct.IsReapable(), "account with a balance should not be reapable")
+}
+
 func TestAccountsSerialization(t *testing.T) {
 	require := require.New(t)
 
@@ -281,6 +296,31 @@ func TestAccountsSerialization(t *testing.T) {
 				},
 			},
 		}, "oWdnZW5lcmFsoWphbGxvd2FuY2VzolUAdU/0RxQ6XsX0cbMPhna5TVaxV1BBIVUA98Te1iET4sKC6oZyI6VE7VXWum5BZA=="},
+		{Account{
+			General: GeneralAccount{
+				Balance: mustInitQuantity(t, 10),
+				Allowances: map[Address]quantity.Quantity{
+					CommonPoolAddress: mustInitQuantity(t, 100),
+				},
+				AllowanceExpiries: map[Address]int64{
+					CommonPoolAddress: 42,
+				},
+				MultiSig: &MultiSigDescriptor{
+					Signers: []signature.PublicKey{
+						signature.NewPublicKey("badadd1e55ffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+					},
+					Threshold: 1,
+				},
+				Metadata: []byte("metadata"),
+				TransferLimit: &TransferLimit{
+					Amount:       mustInitQuantity(t, 1000),
+					Epoch:        3,
+					Spent:        mustInitQuantity(t, 7),
+					RemovalEpoch: 5,
+				},
+				CreatedAt: 11,
+			},
+		}, "oWdnZW5lcmFsp2diYWxhbmNlQQpobWV0YWRhdGFIbWV0YWRhdGFobXVsdGlzaWeiZ3NpZ25lcnOBWCC62t0eVf///////////////////////////////////2l0aHJlc2hvbGQBamFsbG93YW5jZXOhVQD3xN7WIRPiwoLqhnIjpUTtVda6bkFkamNyZWF0ZWRfYXQLbnRyYW5zZmVyX2xpbWl0pGVlcG9jaANlc3BlbnRBB2ZhbW91bnRCA+htcmVtb3ZhbF9lcG9jaAVyYWxsb3dhbmNlX2V4cGlyaWVzoVUA98Te1iET4sKC6oZyI6VE7VXWum4YKg=="},
 		{Account{
 			Escrow: EscrowAccount{
 				Active: SharePool{
@@ -368,3 +408,24 @@ func TestDebondingDelegationSerialization(t *testing.T) {
 		require.EqualValues(tc.rr, dec, "DebondingDelegation serialization should round-trip")
 	}
 }
+
+func TestEventKind(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		ev   Event
+		kind string
+	}{
+		{Event{}, ""},
+		{Event{Transfer: &TransferEvent{}}, "transfer"},
+		{Event{Burn: &BurnEvent{}}, "burn"},
+		{Event{Escrow: &EscrowEvent{Add: &AddEscrowEvent{}}}, "add_escrow"},
+		{Event{Escrow: &EscrowEvent{Take: &TakeEscrowEvent{}}}, "take_escrow"},
+		{Event{Escrow: &EscrowEvent{DebondingStart: &DebondingStartEscrowEvent{}}}, "debonding_start"},
+		{Event{Escrow: &EscrowEvent{Reclaim: &ReclaimEscrowEvent{}}}, "reclaim_escrow"},
+		{Event{AllowanceChange: &AllowanceChangeEvent{}}, "allowance_change"},
+		{Event{MetadataUpdated: &MetadataUpdatedEvent{}}, "metadata_updated"},
+	} {
+		require.Equal(tc.kind, tc.ev.Kind(), "Kind")
+	}
+}
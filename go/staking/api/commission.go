@@ -180,7 +180,7 @@ func (cs *CommissionSchedule) validateNondegenerate(rules *CommissionScheduleRul
 func (cs *CommissionSchedule) validateAmendmentAcceptable(rules *CommissionScheduleRules, now beacon.EpochTime, initialSchedule bool) error {
 	if len(cs.Rates) != 0 {
 		if cs.Rates[0].Start <= now {
-			return fmt.Errorf("rate schedule with start epoch %d must not alter rate on or before %d", cs.Rates[0].Start, now)
+			return fmt.Errorf("%w: rate schedule with start epoch %d must not alter rate on or before %d", ErrCommissionChangeTooEarly, cs.Rates[0].Start, now)
 		}
 	}
 
@@ -191,7 +191,7 @@ func (cs *CommissionSchedule) validateAmendmentAcceptable(rules *CommissionSched
 			earliestAllowedChange += rules.RateBoundLead
 		}
 		if cs.Bounds[0].Start < earliestAllowedChange {
-			return fmt.Errorf("bound schedule with start epoch %d must not alter before %d", cs.Bounds[0].Start, earliestAllowedChange)
+			return fmt.Errorf("%w: bound schedule with start epoch %d must not alter before %d", ErrCommissionChangeTooEarly, cs.Bounds[0].Start, earliestAllowedChange)
 		}
 	}
 
@@ -277,15 +277,15 @@ func (cs *CommissionSchedule) validateWithinBound(now beacon.EpochTime) error {
 
 	for {
 		if currentRate.Rate.Cmp(&currentBound.RateMin) < 0 {
-			return fmt.Errorf("rate %v/%v from rate step %d less than minimum rate %v/%v from bound step %d at epoch %d",
-				currentRate.Rate, CommissionRateDenominator, currentRateIndex,
+			return fmt.Errorf("%w: rate %v/%v from rate step %d less than minimum rate %v/%v from bound step %d at epoch %d",
+				ErrCommissionRateOutOfBounds, currentRate.Rate, CommissionRateDenominator, currentRateIndex,
 				currentBound.RateMin, CommissionRateDenominator, currentBoundIndex,
 				diagnosticTime,
 			)
 		}
 		if currentRate.Rate.Cmp(&currentBound.RateMax) > 0 {
-			return fmt.Errorf("rate %v/%v from rate step %d greater than maximum rate %v/%v from bound step %d at epoch %d",
-				currentRate.Rate, CommissionRateDenominator, currentRateIndex,
+			return fmt.Errorf("%w: rate %v/%v from rate step %d greater than maximum rate %v/%v from bound step %d at epoch %d",
+				ErrCommissionRateOutOfBounds, currentRate.Rate, CommissionRateDenominator, currentRateIndex,
 				currentBound.RateMax, CommissionRateDenominator, currentBoundIndex,
 				diagnosticTime,
 			)
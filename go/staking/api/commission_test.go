@@ -128,7 +128,7 @@ func TestCommissionSchedule(t *testing.T) {
 		Bounds: nil,
 	}, &rules, 10), "amend unaligned")
 
-	requireErrorShowDiagnostic(t, cs.AmendAndPruneAndValidate(&CommissionSchedule{
+	err := cs.AmendAndPruneAndValidate(&CommissionSchedule{
 		Rates: []CommissionRateStep{
 			{
 				Start: 10,
@@ -136,9 +136,11 @@ func TestCommissionSchedule(t *testing.T) {
 			},
 		},
 		Bounds: nil,
-	}, &rules, 10), "amend rate start too early")
+	}, &rules, 10)
+	requireErrorShowDiagnostic(t, err, "amend rate start too early")
+	require.ErrorIs(t, err, ErrCommissionChangeTooEarly, "amend rate start too early")
 
-	requireErrorShowDiagnostic(t, cs.AmendAndPruneAndValidate(&CommissionSchedule{
+	err = cs.AmendAndPruneAndValidate(&CommissionSchedule{
 		Rates: nil,
 		Bounds: []CommissionRateBoundStep{
 			{
@@ -147,7 +149,9 @@ func TestCommissionSchedule(t *testing.T) {
 				RateMax: mustInitQuantity(t, 100_000),
 			},
 		},
-	}, &rules, 10), "amend bound start too early")
+	}, &rules, 10)
+	requireErrorShowDiagnostic(t, err, "amend bound start too early")
+	require.ErrorIs(t, err, ErrCommissionChangeTooEarly, "amend bound start too early")
 
 	require.NoError(t, cs.AmendAndPruneAndValidate(&CommissionSchedule{
 		Rates: []CommissionRateStep{
@@ -224,7 +228,7 @@ func TestCommissionSchedule(t *testing.T) {
 			},
 		},
 	}
-	requireErrorShowDiagnostic(t, cs.AmendAndPruneAndValidate(&CommissionSchedule{
+	err = cs.AmendAndPruneAndValidate(&CommissionSchedule{
 		Rates: []CommissionRateStep{
 			{
 				Start: 20,
@@ -232,7 +236,9 @@ func TestCommissionSchedule(t *testing.T) {
 			},
 		},
 		Bounds: nil,
-	}, &rules, 10), "amend out of bound")
+	}, &rules, 10)
+	requireErrorShowDiagnostic(t, err, "amend out of bound")
+	require.ErrorIs(t, err, ErrCommissionRateOutOfBounds, "amend out of bound")
 
 	cs = CommissionSchedule{
 		Rates: make([]CommissionRateStep, 5),
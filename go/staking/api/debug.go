@@ -0,0 +1,23 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+)
+
+// DebugController is an optional interface implemented by staking backends which allow tests to
+// control the passage of time deterministically.
+//
+// Backends only enable the controller behind a debug flag, methods of a disabled controller fail
+// with ErrDebugControllerDisabled. It must never be relied upon outside of tests.
+type DebugController interface {
+	// AdvanceEpoch performs n epoch transitions, processing each of them (e.g., releasing expired
+	// debonding delegations), and returns the resulting epoch. Advancing by zero epochs returns
+	// the current epoch and can be used to check whether the controller is enabled.
+	AdvanceEpoch(ctx context.Context, n uint64) (beacon.EpochTime, error)
+
+	// SetBlockTime sets the timestamp of subsequent blocks.
+	SetBlockTime(t time.Time) error
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+)
+
+const (
+	// MaxEventsPageSize is the maximum number of events returned in a single page of an events
+	// query.
+	MaxEventsPageSize = 1000
+
+	// MaxEventsPageHeights is the maximum number of heights scanned for a single page of an events
+	// query. Pages of sparse event ranges may therefore contain fewer events than requested (or
+	// none at all) even when there are more matching events in the range.
+	MaxEventsPageHeights = 1000
+)
+
+// EventFilter is a filter of staking events.
+type EventFilter struct {
+	// Kinds are the kinds of events to include, as returned by Event.Kind. In case no kinds are
+	// given, events of all kinds are included.
+	Kinds []string `json:"kinds,omitempty"`
+	// Account is the address of the account that included events must involve, if set.
+	Account *Address `json:"account,omitempty"`
+}
+
+// Matches returns true iff the given event passes the filter.
+func (f *EventFilter) Matches(ev *Event) bool {
+	if len(f.Kinds) > 0 {
+		kind := ev.Kind()
+		var found bool
+		for _, k := range f.Kinds {
+			if k == kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Account != nil {
+		for _, addr := range ev.Accounts() {
+			if addr.Equal(*f.Account) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Accounts returns the addresses of all accounts involved in the event.
+func (e *Event) Accounts() []Address {
+	switch {
+	case e.Transfer != nil:
+		return []Address{e.Transfer.From, e.Transfer.To}
+	case e.Burn != nil:
+		return []Address{e.Burn.Owner}
+	case e.Escrow != nil:
+		switch {
+		case e.Escrow.Add != nil:
+			return []Address{e.Escrow.Add.Owner, e.Escrow.Add.Escrow}
+		case e.Escrow.Take != nil:
+			return []Address{e.Escrow.Take.Owner}
+		case e.Escrow.DebondingStart != nil:
+			return []Address{e.Escrow.DebondingStart.Owner, e.Escrow.DebondingStart.Escrow}
+		case e.Escrow.Reclaim != nil:
+			return []Address{e.Escrow.Reclaim.Owner, e.Escrow.Reclaim.Escrow}
+		case e.Escrow.Slash != nil:
+			return []Address{e.Escrow.Slash.Owner}
+		}
+	case e.AllowanceChange != nil:
+		return []Address{e.AllowanceChange.Owner, e.AllowanceChange.Beneficiary}
+	case e.MetadataUpdated != nil:
+		return []Address{e.MetadataUpdated.Owner}
+	case e.AccountCreated != nil:
+		return []Address{e.AccountCreated.Account}
+	case e.AccountReaped != nil:
+		return []Address{e.AccountReaped.Account}
+	}
+	return nil
+}
+
+// EventsCursor is the position of an event in a range of heights.
+type EventsCursor struct {
+	// Height is the height of the event.
+	Height int64 `json:"height"`
+	// Index is the index of the event among all events at the height, as returned by GetEvents.
+	Index int `json:"index,omitempty"`
+}
+
+// EventsQuery is a query for staking events in a range of heights.
+type EventsQuery struct {
+	EventFilter
+
+	// FromHeight is the first height of the range.
+	FromHeight int64 `json:"from_height"`
+	// ToHeight is the last height of the range. Zero means the latest height at the time of the
+	// query, so clients paging through a range ending at the latest height should use the ToHeight
+	// returned in the first page for subsequent pages.
+	ToHeight int64 `json:"to_height,omitempty"`
+	// Cursor is the position to continue at, as returned in the previous page. In case it is not
+	// set, the query starts at FromHeight.
+	Cursor *EventsCursor `json:"cursor,omitempty"`
+	// Limit is the maximum number of events in the page. Zero means MaxEventsPageSize and larger
+	// limits are capped to MaxEventsPageSize.
+	Limit int `json:"limit,omitempty"`
+}
+
+// EventsPage is a page of events matching an events query.
+type EventsPage struct {
+	// Events are the events matching the query, in the order in which they were emitted.
+	Events []*Event `json:"events,omitempty"`
+	// ToHeight is the last height of the queried range.
+	ToHeight int64 `json:"to_height"`
+	// Next is the cursor of the next page or nil in case there are no more events in the range.
+	Next *EventsCursor `json:"next,omitempty"`
+}
+
+// EventsWatchQuery is a query for watching staking events.
+type EventsWatchQuery struct {
+	EventFilter
+
+	// FromHeight is the height of the first events to return. Events at heights which are already
+	// available are returned first, followed by new events as they are emitted.
+	FromHeight int64 `json:"from_height"`
+}
+
+// EventsSubscription is a subscription to staking events returned by WatchEventsFrom.
+type EventsSubscription struct {
+	pubsub.ClosableSubscription
+
+	err error
+}
+
+// Err returns the error which caused the events channel to be closed or nil in case the channel
+// was closed because the subscription was closed. It must only be called after the events channel
+// has been closed.
+func (s *EventsSubscription) Err() error {
+	return s.err
+}
+
+// EventSource is a source of staking events which can be used to implement events queries via
+// QueryEventsFromSource and WatchEventsFromSource.
+type EventSource interface {
+	// GetEvents returns the events at specified block height.
+	GetEvents(ctx context.Context, height int64) ([]*Event, error)
+
+	// WatchEvents returns a channel that produces a stream of Events.
+	WatchEvents(ctx context.Context) (<-chan *Event, pubsub.ClosableSubscription, error)
+
+	// LatestHeight returns the latest height for which events are available via GetEvents.
+	LatestHeight(ctx context.Context) (int64, error)
+}
+
+// QueryEventsFromSource returns a page of events from the given event source matching the given
+// query.
+func QueryEventsFromSource(ctx context.Context, src EventSource, query *EventsQuery) (*EventsPage, error) {
+	if query.FromHeight <= 0 {
+		return nil, fmt.Errorf("%w: invalid from height: %d", ErrInvalidArgument, query.FromHeight)
+	}
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("%w: invalid limit: %d", ErrInvalidArgument, query.Limit)
+	}
+	limit := query.Limit
+	if limit == 0 || limit > MaxEventsPageSize {
+		limit = MaxEventsPageSize
+	}
+
+	toHeight := query.ToHeight
+	switch {
+	case toHeight == 0:
+		latest, err := src.LatestHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		toHeight = latest
+	case toHeight < query.FromHeight:
+		return nil, fmt.Errorf("%w: invalid height range: %d-%d", ErrInvalidArgument, query.FromHeight, toHeight)
+	}
+
+	pos := EventsCursor{Height: query.FromHeight}
+	if cursor := query.Cursor; cursor != nil {
+		if cursor.Height < query.FromHeight || cursor.Height > toHeight || cursor.Index < 0 {
+			return nil, fmt.Errorf("%w: cursor outside of the queried range", ErrInvalidArgument)
+		}
+		pos = *cursor
+	}
+
+	page := &EventsPage{ToHeight: toHeight}
+	for scanned := 0; pos.Height <= toHeight; scanned++ {
+		if scanned >= MaxEventsPageHeights {
+			page.Next = &EventsCursor{Height: pos.Height}
+			return page, nil
+		}
+
+		evs, err := src.GetEvents(ctx, pos.Height)
+		if err != nil {
+			return nil, err
+		}
+		for ; pos.Index < len(evs); pos.Index++ {
+			if !query.Matches(evs[pos.Index]) {
+				continue
+			}
+			if len(page.Events) >= limit {
+				page.Next = &EventsCursor{Height: pos.Height, Index: pos.Index}
+				return page, nil
+			}
+			page.Events = append(page.Events, evs[pos.Index])
+		}
+		pos = EventsCursor{Height: pos.Height + 1}
+	}
+	return page, nil
+}
+
+// WatchEventsFromSource returns a channel that produces the events from the given event source
+// matching the given query. Events at heights which are already available are returned first,
+// followed by new events as they are emitted, without any gaps or duplicates.
+//
+// In case the historic events cannot be retrieved, the channel is closed and the error is
+// reported via the Err method of the returned subscription.
+func WatchEventsFromSource(
+	ctx context.Context,
+	src EventSource,
+	query *EventsWatchQuery,
+) (<-chan *Event, *EventsSubscription, error) {
+	if query.FromHeight <= 0 {
+		return nil, nil, fmt.Errorf("%w: invalid from height: %d", ErrInvalidArgument, query.FromHeight)
+	}
+	filter := query.EventFilter
+	fromHeight := query.FromHeight
+
+	// Subscribe to new events before determining the latest height, so that all events at heights
+	// after the latest height (the watermark) are delivered via the subscription. Events at or
+	// below the watermark are retrieved via GetEvents instead.
+	ctx, sub := pubsub.NewContextSubscription(ctx)
+	liveCh, liveSub, err := src.WatchEvents(ctx)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+	watermark, err := src.LatestHeight(ctx)
+	if err != nil {
+		liveSub.Close()
+		sub.Close()
+		return nil, nil, err
+	}
+
+	// Retrieve the first batch of historic events immediately to report unavailable heights.
+	var evs []*Event
+	if fromHeight <= watermark {
+		if evs, err = src.GetEvents(ctx, fromHeight); err != nil {
+			liveSub.Close()
+			sub.Close()
+			return nil, nil, err
+		}
+	}
+
+	ch := make(chan *Event)
+	evSub := &EventsSubscription{ClosableSubscription: sub}
+	go func() {
+		defer close(ch)
+		defer liveSub.Close()
+
+		var err error
+
+		send := func(ev *Event) bool {
+			if !filter.Matches(ev) {
+				return true
+			}
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// Historic events.
+		for height := fromHeight; height <= watermark; height++ {
+			if height > fromHeight {
+				if evs, err = src.GetEvents(ctx, height); err != nil {
+					if ctx.Err() == nil {
+						evSub.err = fmt.Errorf("staking: failed to get events at height %d: %w", height, err)
+					}
+					return
+				}
+			}
+			for _, ev := range evs {
+				if !send(ev) {
+					return
+				}
+			}
+		}
+
+		// New events.
+		for {
+			select {
+			case ev, ok := <-liveCh:
+				if !ok {
+					return
+				}
+				if ev.Height <= watermark || ev.Height < fromHeight {
+					// Already returned or not requested.
+					continue
+				}
+				if !send(ev) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, evSub, nil
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+)
+
+var (
+	eventsTestAddr1 = NewAddress(signature.NewPublicKey("7777777777777777777777777777777777777777777777777777777777777777"))
+	eventsTestAddr2 = NewAddress(signature.NewPublicKey("8888888888888888888888888888888888888888888888888888888888888888"))
+	eventsTestAddr3 = NewAddress(signature.NewPublicKey("9999999999999999999999999999999999999999999999999999999999999999"))
+)
+
+// testEventSource is an in-memory event source with hooks that make it possible to emit events
+// while an events query is in progress.
+type testEventSource struct {
+	sync.Mutex
+
+	notifier *pubsub.Broker
+
+	height int64
+	pruned int64
+	events map[int64][]*Event
+
+	onGetEvents    func(height int64)
+	onLatestHeight func()
+}
+
+func newTestEventSource() *testEventSource {
+	return &testEventSource{
+		notifier: pubsub.NewBroker(false),
+		events:   make(map[int64][]*Event),
+	}
+}
+
+// commit emits the given events at a new height.
+func (s *testEventSource) commit(evs ...*Event) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.height++
+	for _, ev := range evs {
+		ev.Height = s.height
+		s.notifier.Broadcast(ev)
+	}
+	s.events[s.height] = evs
+}
+
+func (s *testEventSource) GetEvents(ctx context.Context, height int64) ([]*Event, error) {
+	if s.onGetEvents != nil {
+		s.onGetEvents(height)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if height <= s.pruned || height > s.height {
+		return nil, fmt.Errorf("height %d not available", height)
+	}
+	return s.events[height], nil
+}
+
+func (s *testEventSource) WatchEvents(ctx context.Context) (<-chan *Event, pubsub.ClosableSubscription, error) {
+	typedCh := make(chan *Event)
+	sub := s.notifier.Subscribe()
+	sub.Unwrap(typedCh)
+
+	return typedCh, sub, nil
+}
+
+func (s *testEventSource) LatestHeight(ctx context.Context) (int64, error) {
+	if s.onLatestHeight != nil {
+		s.onLatestHeight()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.height, nil
+}
+
+func newTestTransferEvent(from, to Address) *Event {
+	return &Event{Transfer: &TransferEvent{From: from, To: to, Amount: *quantity.NewFromUint64(1)}}
+}
+
+func newTestBurnEvent(owner Address) *Event {
+	return &Event{Burn: &BurnEvent{Owner: owner, Amount: *quantity.NewFromUint64(1)}}
+}
+
+func TestEventFilter(t *testing.T) {
+	require := require.New(t)
+
+	transfer := newTestTransferEvent(eventsTestAddr1, eventsTestAddr2)
+	burn := newTestBurnEvent(eventsTestAddr2)
+	escrow := &Event{Escrow: &EscrowEvent{Add: &AddEscrowEvent{Owner: eventsTestAddr3, Escrow: eventsTestAddr1}}}
+
+	require.EqualValues([]Address{eventsTestAddr1, eventsTestAddr2}, transfer.Accounts())
+	require.EqualValues([]Address{eventsTestAddr2}, burn.Accounts())
+	require.EqualValues([]Address{eventsTestAddr3, eventsTestAddr1}, escrow.Accounts())
+	require.Empty((&Event{}).Accounts())
+
+	for _, tc := range []struct {
+		filter EventFilter
+		ev     *Event
+		match  bool
+	}{
+		{EventFilter{}, transfer, true},
+		{EventFilter{}, &Event{}, true},
+		{EventFilter{Kinds: []string{(&TransferEvent{}).EventKind()}}, transfer, true},
+		{EventFilter{Kinds: []string{(&TransferEvent{}).EventKind()}}, burn, false},
+		{EventFilter{Kinds: []string{(&BurnEvent{}).EventKind(), (&AddEscrowEvent{}).EventKind()}}, escrow, true},
+		{EventFilter{Account: &eventsTestAddr1}, transfer, true},
+		{EventFilter{Account: &eventsTestAddr1}, burn, false},
+		{EventFilter{Account: &eventsTestAddr1}, escrow, true},
+		{EventFilter{Kinds: []string{(&BurnEvent{}).EventKind()}, Account: &eventsTestAddr2}, transfer, false},
+		{EventFilter{Kinds: []string{(&BurnEvent{}).EventKind()}, Account: &eventsTestAddr2}, burn, true},
+	} {
+		require.Equal(tc.match, tc.filter.Matches(tc.ev), "Matches(%+v, %s)", tc.filter, tc.ev.Kind())
+	}
+}
+
+// queryAllEvents pages through all events matching the given query.
+func queryAllEvents(t *testing.T, src EventSource, query EventsQuery) ([]*Event, int) {
+	var (
+		events []*Event
+		pages  int
+	)
+	for {
+		page, err := QueryEventsFromSource(context.Background(), src, &query)
+		require.NoError(t, err, "QueryEventsFromSource")
+		pages++
+
+		events = append(events, page.Events...)
+		if page.Next == nil {
+			return events, pages
+		}
+		require.True(t, page.Next.Height <= page.ToHeight, "next cursor should be within the range")
+		query.ToHeight = page.ToHeight
+		query.Cursor = page.Next
+	}
+}
+
+func TestQueryEventsFromSource(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	src := newTestEventSource()
+	var all []*Event
+	for i := 0; i < 5; i++ {
+		evs := []*Event{
+			newTestTransferEvent(eventsTestAddr1, eventsTestAddr2),
+			newTestBurnEvent(eventsTestAddr2),
+		}
+		src.commit(evs...)
+		all = append(all, evs...)
+	}
+
+	// Single page.
+	page, err := QueryEventsFromSource(ctx, src, &EventsQuery{FromHeight: 1})
+	require.NoError(err, "QueryEventsFromSource")
+	require.EqualValues(all, page.Events)
+	require.EqualValues(5, page.ToHeight, "ToHeight should default to the latest height")
+	require.Nil(page.Next)
+
+	// Paging.
+	page, err = QueryEventsFromSource(ctx, src, &EventsQuery{FromHeight: 1, Limit: 3})
+	require.NoError(err, "QueryEventsFromSource")
+	require.EqualValues(all[:3], page.Events)
+	require.EqualValues(&EventsCursor{Height: 2, Index: 1}, page.Next)
+
+	for _, limit := range []int{1, 2, 3, 4} {
+		events, pages := queryAllEvents(t, src, EventsQuery{FromHeight: 1, Limit: limit})
+		require.EqualValues(all, events, "all events should be returned with limit %d", limit)
+		require.Equal((len(all)+limit-1)/limit, pages, "no empty trailing page with limit %d", limit)
+	}
+
+	// Height range.
+	events, _ := queryAllEvents(t, src, EventsQuery{FromHeight: 2, ToHeight: 3, Limit: 1})
+	require.EqualValues(all[2:6], events)
+
+	// Filters.
+	events, _ = queryAllEvents(t, src, EventsQuery{
+		EventFilter: EventFilter{Account: &eventsTestAddr1},
+		FromHeight:  1,
+		Limit:       2,
+	})
+	require.Len(events, 5)
+	for _, ev := range events {
+		require.NotNil(ev.Transfer, "only transfers should involve the account")
+	}
+	events, _ = queryAllEvents(t, src, EventsQuery{
+		EventFilter: EventFilter{Kinds: []string{(&BurnEvent{}).EventKind()}},
+		FromHeight:  4,
+	})
+	require.EqualValues([]*Event{all[7], all[9]}, events)
+
+	// Invalid queries.
+	for _, query := range []*EventsQuery{
+		{FromHeight: 0},
+		{FromHeight: 1, Limit: -1},
+		{FromHeight: 3, ToHeight: 2},
+		{FromHeight: 2, ToHeight: 3, Cursor: &EventsCursor{Height: 1}},
+		{FromHeight: 2, ToHeight: 3, Cursor: &EventsCursor{Height: 4}},
+		{FromHeight: 2, ToHeight: 3, Cursor: &EventsCursor{Height: 2, Index: -1}},
+	} {
+		_, err = QueryEventsFromSource(ctx, src, query)
+		require.ErrorIs(err, ErrInvalidArgument, "invalid query %+v should fail", query)
+	}
+
+	// Unavailable heights.
+	_, err = QueryEventsFromSource(ctx, src, &EventsQuery{FromHeight: 1, ToHeight: 6})
+	require.Error(err, "querying unavailable heights should fail")
+}
+
+func TestQueryEventsFromSourceCaps(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// Page size cap.
+	src := newTestEventSource()
+	var evs []*Event
+	for i := 0; i < MaxEventsPageSize+10; i++ {
+		evs = append(evs, newTestBurnEvent(eventsTestAddr1))
+	}
+	src.commit(evs...)
+
+	page, err := QueryEventsFromSource(ctx, src, &EventsQuery{FromHeight: 1, Limit: 10 * MaxEventsPageSize})
+	require.NoError(err, "QueryEventsFromSource")
+	require.Len(page.Events, MaxEventsPageSize, "page size should be capped")
+	require.EqualValues(&EventsCursor{Height: 1, Index: MaxEventsPageSize}, page.Next)
+
+	// Height scan cap.
+	src = newTestEventSource()
+	for i := 0; i < MaxEventsPageHeights+10; i++ {
+		src.commit()
+	}
+	ev := newTestBurnEvent(eventsTestAddr1)
+	src.commit(ev)
+
+	page, err = QueryEventsFromSource(ctx, src, &EventsQuery{FromHeight: 1})
+	require.NoError(err, "QueryEventsFromSource")
+	require.Empty(page.Events, "no events should be found in the first scanned heights")
+	require.EqualValues(&EventsCursor{Height: MaxEventsPageHeights + 1}, page.Next)
+
+	events, pages := queryAllEvents(t, src, EventsQuery{FromHeight: 1})
+	require.EqualValues([]*Event{ev}, events)
+	require.Equal(2, pages)
+}
+
+// receiveEvents receives the given number of events from the given channel.
+func receiveEvents(t *testing.T, ch <-chan *Event, n int) []*Event {
+	var events []*Event
+	for len(events) < n {
+		select {
+		case ev, ok := <-ch:
+			require.True(t, ok, "channel should not be closed")
+			events = append(events, ev)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for events", "received %d of %d events", len(events), n)
+		}
+	}
+	return events
+}
+
+func TestWatchEventsFromSource(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	src := newTestEventSource()
+	var all []*Event
+	commit := func() {
+		evs := []*Event{
+			newTestTransferEvent(eventsTestAddr1, eventsTestAddr2),
+			newTestBurnEvent(eventsTestAddr2),
+		}
+		src.commit(evs...)
+		all = append(all, evs...)
+	}
+	for i := 0; i < 3; i++ {
+		commit()
+	}
+
+	// Emit a block after subscribing to new events but before the watermark is determined, so
+	// that its events are both backfilled and delivered via the subscription.
+	var latestHeightCalls int
+	src.onLatestHeight = func() {
+		latestHeightCalls++
+		if latestHeightCalls == 1 {
+			commit()
+		}
+	}
+	// Emit blocks while the historic events are being retrieved, so that their events are only
+	// delivered via the subscription.
+	src.onGetEvents = func(height int64) {
+		if height == 3 {
+			commit()
+			commit()
+		}
+	}
+
+	ch, sub, err := WatchEventsFromSource(ctx, src, &EventsWatchQuery{FromHeight: 2})
+	require.NoError(err, "WatchEventsFromSource")
+	defer sub.Close()
+
+	// Heights 2-4 are backfilled, heights 5-6 are delivered via the subscription.
+	events := receiveEvents(t, ch, 10)
+	require.EqualValues(all[2:12], events, "events should be delivered once and in order")
+
+	src.onGetEvents = nil
+	commit()
+	events = receiveEvents(t, ch, 2)
+	require.EqualValues(all[12:14], events, "new events should be delivered")
+
+	select {
+	case ev := <-ch:
+		require.FailNow("unexpected event", "event: %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Filtered watch, starting at a height that is not available yet.
+	ch, sub, err = WatchEventsFromSource(ctx, src, &EventsWatchQuery{
+		EventFilter: EventFilter{Kinds: []string{(&BurnEvent{}).EventKind()}},
+		FromHeight:  9,
+	})
+	require.NoError(err, "WatchEventsFromSource")
+	defer sub.Close()
+
+	commit()
+	commit()
+	events = receiveEvents(t, ch, 1)
+	require.EqualValues([]*Event{all[17]}, events, "only matching events at requested heights should be delivered")
+
+	// Invalid and unavailable heights.
+	_, _, err = WatchEventsFromSource(ctx, src, &EventsWatchQuery{FromHeight: 0})
+	require.ErrorIs(err, ErrInvalidArgument)
+
+	src.pruned = 1
+	_, _, err = WatchEventsFromSource(ctx, src, &EventsWatchQuery{FromHeight: 1})
+	require.Error(err, "watching from unavailable heights should fail")
+
+	// Heights becoming unavailable during the backfill should be reported via the subscription.
+	src.onGetEvents = func(height int64) {
+		if height == 3 {
+			src.pruned = 3
+		}
+	}
+	ch, sub, err = WatchEventsFromSource(ctx, src, &EventsWatchQuery{FromHeight: 2})
+	require.NoError(err, "WatchEventsFromSource")
+	defer sub.Close()
+
+	events = receiveEvents(t, ch, 2)
+	require.EqualValues(all[2:4], events, "events before the failure should be delivered")
+	select {
+	case ev, ok := <-ch:
+		require.False(ok, "channel should be closed", "event: %+v", ev)
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for the channel to be closed")
+	}
+	require.Error(sub.Err(), "backfill failure should be reported")
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// jsonField is a field of a JSON object.
+type jsonField struct {
+	key   string
+	value json.RawMessage
+}
+
+// CanonicalJSON returns the canonical JSON form of the staking genesis state.
+//
+// This is a pretty-printed JSON document with 2-space indents and a newline at the end, like the
+// canonical form of genesis documents. Unlike the Go encoding/json package, which orders map keys
+// by their text form, all maps keyed by account addresses (e.g., the ledger) are ordered by the
+// raw address and stake thresholds are ordered by kind. Quantities are emitted as decimal strings.
+func (g *Genesis) CanonicalJSON() ([]byte, error) {
+	raw, err := json.Marshal(g)
+	if err != nil {
+		return nil, fmt.Errorf("staking: failed to marshal genesis state: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err = canonicalizeJSON(&buf, raw, nil); err != nil {
+		return nil, fmt.Errorf("staking: failed to canonicalize genesis state: %w", err)
+	}
+	var canonJSON bytes.Buffer
+	if err = json.Indent(&canonJSON, buf.Bytes(), "", "  "); err != nil {
+		return nil, fmt.Errorf("staking: failed to canonicalize genesis state: %w", err)
+	}
+	canonJSON.WriteByte('\n')
+	return canonJSON.Bytes(), nil
+}
+
+// UnmarshalCanonicalJSON strictly decodes a JSON marshaled staking genesis state.
+//
+// Unlike UnmarshalJSON, decoding fails in case the document contains unknown fields or duplicate
+// keys, including ledger keys that decode to the same address.
+func (g *Genesis) UnmarshalCanonicalJSON(data []byte) error {
+	// Check for duplicate keys as the Go encoding/json package silently uses the last one.
+	if err := canonicalizeJSON(ioutil.Discard, bytes.TrimSpace(data), nil); err != nil {
+		return fmt.Errorf("staking: malformed genesis state: %w", err)
+	}
+
+	type genesis Genesis
+	var decGenesis genesis
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&decGenesis); err != nil {
+		return fmt.Errorf("staking: malformed genesis state: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("staking: malformed genesis state: trailing data")
+	}
+
+	*g = Genesis(decGenesis)
+	return nil
+}
+
+// canonicalizeJSON writes the given compact JSON value to w with the fields of all objects in
+// canonical order. The path is the list of object keys leading to the value.
+func canonicalizeJSON(w io.Writer, raw json.RawMessage, path []string) error {
+	if len(raw) == 0 {
+		return fmt.Errorf("empty value")
+	}
+
+	switch raw[0] {
+	case '{':
+		fields, err := decodeJSONObject(raw)
+		if err != nil {
+			return err
+		}
+		if err = sortJSONObject(fields, path); err != nil {
+			return err
+		}
+
+		if _, err = io.WriteString(w, "{"); err != nil {
+			return err
+		}
+		for i, f := range fields {
+			if i > 0 {
+				if _, err = io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			key, _ := json.Marshal(f.key)
+			if _, err = w.Write(append(key, ':')); err != nil {
+				return err
+			}
+			if err = canonicalizeJSON(w, f.value, append(path[:len(path):len(path)], f.key)); err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "}")
+		return err
+	case '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		for i, elem := range elems {
+			if i > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			if err := canonicalizeJSON(w, elem, path); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "]")
+		return err
+	default:
+		_, err := w.Write(raw)
+		return err
+	}
+}
+
+// decodeJSONObject decodes the fields of the given JSON object in order, failing in case any of
+// the keys is duplicated.
+func decodeJSONObject(raw json.RawMessage) ([]jsonField, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var fields []jsonField
+	seen := make(map[string]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("malformed object key: %v", tok)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate key: %s", key)
+		}
+		seen[key] = true
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		fields = append(fields, jsonField{key: key, value: value})
+	}
+	return fields, nil
+}
+
+// sortJSONObject sorts the fields of a JSON object at the given path in canonical order.
+//
+// Stake thresholds are ordered by kind and objects whose keys are all account addresses are
+// ordered by the raw address. The order of all other objects is retained.
+func sortJSONObject(fields []jsonField, path []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if len(path) == 2 && path[0] == "params" && path[1] == "thresholds" {
+		kinds := make(map[string]ThresholdKind, len(fields))
+		for _, f := range fields {
+			var kind ThresholdKind
+			if err := kind.UnmarshalText([]byte(f.key)); err != nil {
+				return err
+			}
+			kinds[f.key] = kind
+		}
+		sort.SliceStable(fields, func(i, j int) bool {
+			return kinds[fields[i].key] < kinds[fields[j].key]
+		})
+		return nil
+	}
+
+	addrs := make(map[string]Address, len(fields))
+	seen := make(map[Address]string, len(fields))
+	for _, f := range fields {
+		var addr Address
+		if err := addr.UnmarshalText([]byte(f.key)); err != nil {
+			// Not an object keyed by account addresses.
+			return nil
+		}
+		if key, ok := seen[addr]; ok {
+			return fmt.Errorf("duplicate address: %s and %s", key, f.key)
+		}
+		seen[addr] = f.key
+		addrs[f.key] = addr
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		ai, aj := addrs[fields[i].key], addrs[fields[j].key]
+		return bytes.Compare(ai[:], aj[:]) < 0
+	})
+	return nil
+}
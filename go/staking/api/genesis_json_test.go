@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+)
+
+func newCanonicalJSONTestGenesis(t *testing.T) (*Genesis, []Address) {
+	var addrs []Address
+	for i := 0; i < 16; i++ {
+		addrs = append(addrs, NewRuntimeAddress(common.NewTestNamespaceFromSeed([]byte(fmt.Sprintf("canonical json %d", i)), 0)))
+	}
+
+	g := &Genesis{
+		Parameters: ConsensusParameters{
+			DebondingInterval: 1,
+			Thresholds: map[ThresholdKind]quantity.Quantity{
+				KindEntity:            mustInitQuantity(t, 1),
+				KindNodeValidator:     mustInitQuantity(t, 2),
+				KindNodeCompute:       mustInitQuantity(t, 3),
+				KindNodeKeyManager:    mustInitQuantity(t, 5),
+				KindRuntimeCompute:    mustInitQuantity(t, 6),
+				KindRuntimeKeyManager: mustInitQuantity(t, 7),
+			},
+		},
+		TokenSymbol: "TEST",
+		TotalSupply: mustInitQuantity(t, 1_000_000_000_000),
+		Ledger:      make(map[Address]*Account),
+		Delegations: map[Address]map[Address]*Delegation{
+			addrs[0]: make(map[Address]*Delegation),
+		},
+		ReapedAccounts: map[Address]uint64{
+			addrs[15]: 3,
+		},
+	}
+	for i, addr := range addrs[:15] {
+		g.Ledger[addr] = &Account{
+			General: GeneralAccount{
+				Balance: mustInitQuantity(t, int64(i)*1_000_000_000),
+				Allowances: map[Address]quantity.Quantity{
+					addrs[(i+1)%15]: mustInitQuantity(t, 10),
+					addrs[(i+7)%15]: mustInitQuantity(t, 20),
+				},
+			},
+		}
+		g.Delegations[addrs[0]][addr] = &Delegation{Shares: mustInitQuantity(t, int64(i))}
+	}
+	return g, addrs
+}
+
+func TestGenesisCanonicalJSON(t *testing.T) {
+	require := require.New(t)
+
+	g, addrs := newCanonicalJSONTestGenesis(t)
+	canonJSON, err := g.CanonicalJSON()
+	require.NoError(err, "CanonicalJSON")
+	require.True(bytes.HasSuffix(canonJSON, []byte("}\n")), "canonical form should end with a newline")
+
+	// Marshalling should be deterministic.
+	for i := 0; i < 10; i++ {
+		again, err := g.CanonicalJSON()
+		require.NoError(err, "CanonicalJSON")
+		require.Equal(canonJSON, again, "canonical form should be deterministic")
+	}
+
+	// The canonical form should round-trip.
+	var dec Genesis
+	err = dec.UnmarshalCanonicalJSON(canonJSON)
+	require.NoError(err, "UnmarshalCanonicalJSON")
+	require.EqualValues(g, &dec, "genesis state should round-trip")
+	again, err := dec.CanonicalJSON()
+	require.NoError(err, "CanonicalJSON")
+	require.Equal(canonJSON, again, "canonical form of the decoded genesis state should match")
+
+	var raw struct {
+		Parameters struct {
+			Thresholds orderedJSONObject `json:"thresholds"`
+		} `json:"params"`
+		TotalSupply string                       `json:"total_supply"`
+		Ledger      orderedJSONObject            `json:"ledger"`
+		Delegations map[string]orderedJSONObject `json:"delegations"`
+	}
+	err = json.Unmarshal(canonJSON, &raw)
+	require.NoError(err, "Unmarshal")
+
+	// Quantities should be decimal strings.
+	require.Equal("1000000000000", raw.TotalSupply, "quantities should be decimal strings")
+
+	// Thresholds should be ordered by kind.
+	var kinds []string
+	for _, kind := range ThresholdKinds {
+		kinds = append(kinds, kind.String())
+	}
+	require.Equal(kinds, []string(raw.Parameters.Thresholds), "thresholds should be ordered by kind")
+
+	// Maps keyed by addresses should be ordered by the raw address.
+	requireAddressOrder := func(keys []string, msg string) {
+		require.Len(keys, 15, msg)
+		for i := 1; i < len(keys); i++ {
+			var prev, cur Address
+			require.NoError(prev.UnmarshalText([]byte(keys[i-1])))
+			require.NoError(cur.UnmarshalText([]byte(keys[i])))
+			require.Negative(bytes.Compare(prev[:], cur[:]), msg)
+		}
+	}
+	requireAddressOrder(raw.Ledger, "ledger should be ordered by address")
+	requireAddressOrder(raw.Delegations[addrs[0].String()], "delegations should be ordered by address")
+}
+
+func TestGenesisUnmarshalCanonicalJSON(t *testing.T) {
+	require := require.New(t)
+
+	g, addrs := newCanonicalJSONTestGenesis(t)
+	canonJSON, err := g.CanonicalJSON()
+	require.NoError(err, "CanonicalJSON")
+
+	// Non-canonical but otherwise valid documents should be accepted.
+	nonCanonJSON, err := json.Marshal(g)
+	require.NoError(err, "Marshal")
+	var dec Genesis
+	err = dec.UnmarshalCanonicalJSON(nonCanonJSON)
+	require.NoError(err, "UnmarshalCanonicalJSON should accept non-canonical documents")
+	require.EqualValues(g, &dec)
+
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{"UnknownField", strings.Replace(string(canonJSON), `"token_symbol"`, `"unknown": 1, "token_symbol"`, 1)},
+		{"UnknownNestedField", strings.Replace(string(canonJSON), `"debonding_interval"`, `"unknown": 1, "debonding_interval"`, 1)},
+		{"DuplicateField", strings.Replace(string(canonJSON), `"token_symbol"`, `"token_symbol": "DUP", "token_symbol"`, 1)},
+		{"DuplicateThreshold", strings.Replace(string(canonJSON), `"entity"`, `"entity": "10", "entity"`, 1)},
+		{"DuplicateLedgerKey", strings.Replace(string(canonJSON), `"ledger": {`, fmt.Sprintf(`"ledger": {"%s": {},`, addrs[3]), 1)},
+		{"DuplicateLedgerAddress", strings.Replace(string(canonJSON), `"ledger": {`, fmt.Sprintf(`"ledger": {"%s": {},`, strings.ToUpper(addrs[3].String())), 1)},
+		{"TrailingData", string(canonJSON) + "{}"},
+	} {
+		require.NotEqual(string(canonJSON), tc.data, "test case %s should modify the document", tc.name)
+		err = dec.UnmarshalCanonicalJSON([]byte(tc.data))
+		require.Error(err, "UnmarshalCanonicalJSON should fail (%s)", tc.name)
+
+		// The regular decoder is more lenient.
+		if tc.name != "TrailingData" {
+			var lenient Genesis
+			require.NoError(json.Unmarshal([]byte(tc.data), &lenient), "Unmarshal should succeed (%s)", tc.name)
+		}
+	}
+}
+
+// orderedJSONObject is the list of keys of a JSON object in order.
+type orderedJSONObject []string
+
+func (o *orderedJSONObject) UnmarshalJSON(data []byte) error {
+	fields, err := decodeJSONObject(data)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		*o = append(*o, f.key)
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"io"
 
 	"google.golang.org/grpc"
 
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	cmnGrpc "github.com/oasisprotocol/oasis-core/go/common/grpc"
 	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
@@ -46,6 +49,18 @@ var (
 	methodDebondingDelegationsTo = serviceName.NewMethod("DebondingDelegationsTo", OwnerQuery{})
 	// methodAllowance is the Allowance method.
 	methodAllowance = serviceName.NewMethod("Allowance", AllowanceQuery{})
+	// methodAllowances is the Allowances method.
+	methodAllowances = serviceName.NewMethod("Allowances", OwnerQuery{})
+	// methodAccountMetadata is the AccountMetadata method.
+	methodAccountMetadata = serviceName.NewMethod("AccountMetadata", OwnerQuery{})
+	// methodCommissionSchedule is the CommissionSchedule method.
+	methodCommissionSchedule = serviceName.NewMethod("CommissionSchedule", OwnerQuery{})
+	// methodSharesToTokens is the SharesToTokens method.
+	methodSharesToTokens = serviceName.NewMethod("SharesToTokens", EscrowExchangeQuery{})
+	// methodTokensToShares is the TokensToShares method.
+	methodTokensToShares = serviceName.NewMethod("TokensToShares", EscrowExchangeQuery{})
+	// methodEscrowSnapshot is the EscrowSnapshot method.
+	methodEscrowSnapshot = serviceName.NewMethod("EscrowSnapshot", beacon.EpochTime(0))
 	// methodStateToGenesis is the StateToGenesis method.
 	methodStateToGenesis = serviceName.NewMethod("StateToGenesis", int64(0))
 	// methodConsensusParameters is the ConsensusParameters method.
@@ -53,8 +68,19 @@ var (
 	// methodGetEvents is the GetEvents method.
 	methodGetEvents = serviceName.NewMethod("GetEvents", int64(0))
 
+	// methodGetTransaction is the GetTransaction method.
+	methodGetTransaction = serviceName.NewMethod("GetTransaction", hash.Hash{})
+
+	// methodGetStatus is the GetStatus method.
+	methodGetStatus = serviceName.NewMethod("GetStatus", nil)
+
+	// methodQueryEvents is the QueryEvents method.
+	methodQueryEvents = serviceName.NewMethod("QueryEvents", EventsQuery{})
+
 	// methodWatchEvents is the WatchEvents method.
 	methodWatchEvents = serviceName.NewMethod("WatchEvents", nil)
+	// methodWatchEventsFrom is the WatchEventsFrom method.
+	methodWatchEventsFrom = serviceName.NewMethod("WatchEventsFrom", EventsWatchQuery{})
 
 	// serviceDesc is the gRPC service descriptor.
 	serviceDesc = grpc.ServiceDesc{
@@ -125,6 +151,30 @@ var (
 				MethodName: methodAllowance.ShortName(),
 				Handler:    handlerAllowance,
 			},
+			{
+				MethodName: methodAllowances.ShortName(),
+				Handler:    handlerAllowances,
+			},
+			{
+				MethodName: methodAccountMetadata.ShortName(),
+				Handler:    handlerAccountMetadata,
+			},
+			{
+				MethodName: methodCommissionSchedule.ShortName(),
+				Handler:    handlerCommissionSchedule,
+			},
+			{
+				MethodName: methodSharesToTokens.ShortName(),
+				Handler:    handlerSharesToTokens,
+			},
+			{
+				MethodName: methodTokensToShares.ShortName(),
+				Handler:    handlerTokensToShares,
+			},
+			{
+				MethodName: methodEscrowSnapshot.ShortName(),
+				Handler:    handlerEscrowSnapshot,
+			},
 			{
 				MethodName: methodStateToGenesis.ShortName(),
 				Handler:    handlerStateToGenesis,
@@ -137,6 +187,18 @@ var (
 				MethodName: methodGetEvents.ShortName(),
 				Handler:    handlerGetEvents,
 			},
+			{
+				MethodName: methodGetTransaction.ShortName(),
+				Handler:    handlerGetTransaction,
+			},
+			{
+				MethodName: methodGetStatus.ShortName(),
+				Handler:    handlerGetStatus,
+			},
+			{
+				MethodName: methodQueryEvents.ShortName(),
+				Handler:    handlerQueryEvents,
+			},
 		},
 		Streams: []grpc.StreamDesc{
 			{
@@ -144,6 +206,11 @@ var (
 				Handler:       handlerWatchEvents,
 				ServerStreams: true,
 			},
+			{
+				StreamName:    methodWatchEventsFrom.ShortName(),
+				Handler:       handlerWatchEventsFrom,
+				ServerStreams: true,
+			},
 		},
 	}
 )
@@ -508,6 +575,144 @@ func handlerAllowance( // nolint: golint
 	return interceptor(ctx, &query, info, handler)
 }
 
+func handlerAllowances( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var query OwnerQuery
+	if err := dec(&query); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).Allowances(ctx, &query)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodAllowances.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).Allowances(ctx, req.(*OwnerQuery))
+	}
+	return interceptor(ctx, &query, info, handler)
+}
+
+func handlerAccountMetadata( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var query OwnerQuery
+	if err := dec(&query); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).AccountMetadata(ctx, &query)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodAccountMetadata.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).AccountMetadata(ctx, req.(*OwnerQuery))
+	}
+	return interceptor(ctx, &query, info, handler)
+}
+
+func handlerCommissionSchedule( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var query OwnerQuery
+	if err := dec(&query); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).CommissionSchedule(ctx, &query)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodCommissionSchedule.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).CommissionSchedule(ctx, req.(*OwnerQuery))
+	}
+	return interceptor(ctx, &query, info, handler)
+}
+
+func handlerSharesToTokens( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var query EscrowExchangeQuery
+	if err := dec(&query); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).SharesToTokens(ctx, &query)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodSharesToTokens.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).SharesToTokens(ctx, req.(*EscrowExchangeQuery))
+	}
+	return interceptor(ctx, &query, info, handler)
+}
+
+func handlerTokensToShares( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var query EscrowExchangeQuery
+	if err := dec(&query); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).TokensToShares(ctx, &query)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodTokensToShares.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).TokensToShares(ctx, req.(*EscrowExchangeQuery))
+	}
+	return interceptor(ctx, &query, info, handler)
+}
+
+func handlerEscrowSnapshot( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var epoch beacon.EpochTime
+	if err := dec(&epoch); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).EscrowSnapshot(ctx, epoch)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodEscrowSnapshot.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).EscrowSnapshot(ctx, req.(beacon.EpochTime))
+	}
+	return interceptor(ctx, epoch, info, handler)
+}
+
 func handlerStateToGenesis( // nolint: golint
 	srv interface{},
 	ctx context.Context,
@@ -577,6 +782,71 @@ func handlerGetEvents( // nolint: golint
 	return interceptor(ctx, height, info, handler)
 }
 
+func handlerGetTransaction( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var txHash hash.Hash
+	if err := dec(&txHash); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).GetTransaction(ctx, txHash)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodGetTransaction.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).GetTransaction(ctx, req.(hash.Hash))
+	}
+	return interceptor(ctx, txHash, info, handler)
+}
+
+func handlerGetStatus( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	if interceptor == nil {
+		return srv.(Backend).GetStatus(ctx)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodGetStatus.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).GetStatus(ctx)
+	}
+	return interceptor(ctx, nil, info, handler)
+}
+
+func handlerQueryEvents( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var query EventsQuery
+	if err := dec(&query); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Backend).QueryEvents(ctx, &query)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodQueryEvents.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).QueryEvents(ctx, req.(*EventsQuery))
+	}
+	return interceptor(ctx, &query, info, handler)
+}
+
 func handlerWatchEvents(srv interface{}, stream grpc.ServerStream) error {
 	if err := stream.RecvMsg(nil); err != nil {
 		return err
@@ -605,6 +875,35 @@ func handlerWatchEvents(srv interface{}, stream grpc.ServerStream) error {
 	}
 }
 
+func handlerWatchEventsFrom(srv interface{}, stream grpc.ServerStream) error {
+	var query EventsWatchQuery
+	if err := stream.RecvMsg(&query); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	ch, sub, err := srv.(Backend).WatchEventsFrom(ctx, &query)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return sub.Err()
+			}
+
+			if err := stream.SendMsg(ev); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // RegisterService registers a new staking backend service with the given gRPC server.
 func RegisterService(server *grpc.Server, service Backend) {
 	server.RegisterService(&serviceDesc, service)
@@ -734,14 +1033,62 @@ func (c *stakingClient) DebondingDelegationsTo(ctx context.Context, query *Owner
 	return rsp, nil
 }
 
-func (c *stakingClient) Allowance(ctx context.Context, query *AllowanceQuery) (*quantity.Quantity, error) {
-	var rsp quantity.Quantity
+func (c *stakingClient) Allowance(ctx context.Context, query *AllowanceQuery) (*Allowance, error) {
+	var rsp Allowance
 	if err := c.conn.Invoke(ctx, methodAllowance.FullName(), query, &rsp); err != nil {
 		return nil, err
 	}
 	return &rsp, nil
 }
 
+func (c *stakingClient) Allowances(ctx context.Context, query *OwnerQuery) (map[Address]*Allowance, error) {
+	var rsp map[Address]*Allowance
+	if err := c.conn.Invoke(ctx, methodAllowances.FullName(), query, &rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func (c *stakingClient) AccountMetadata(ctx context.Context, query *OwnerQuery) ([]byte, error) {
+	var rsp []byte
+	if err := c.conn.Invoke(ctx, methodAccountMetadata.FullName(), query, &rsp); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func (c *stakingClient) CommissionSchedule(ctx context.Context, query *OwnerQuery) (*CommissionSchedule, error) {
+	var rsp CommissionSchedule
+	if err := c.conn.Invoke(ctx, methodCommissionSchedule.FullName(), query, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *stakingClient) SharesToTokens(ctx context.Context, query *EscrowExchangeQuery) (*quantity.Quantity, error) {
+	var rsp quantity.Quantity
+	if err := c.conn.Invoke(ctx, methodSharesToTokens.FullName(), query, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *stakingClient) TokensToShares(ctx context.Context, query *EscrowExchangeQuery) (*quantity.Quantity, error) {
+	var rsp quantity.Quantity
+	if err := c.conn.Invoke(ctx, methodTokensToShares.FullName(), query, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *stakingClient) EscrowSnapshot(ctx context.Context, epoch beacon.EpochTime) (*EscrowSnapshot, error) {
+	var rsp EscrowSnapshot
+	if err := c.conn.Invoke(ctx, methodEscrowSnapshot.FullName(), epoch, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
 func (c *stakingClient) StateToGenesis(ctx context.Context, height int64) (*Genesis, error) {
 	var rsp Genesis
 	if err := c.conn.Invoke(ctx, methodStateToGenesis.FullName(), height, &rsp); err != nil {
@@ -766,6 +1113,22 @@ func (c *stakingClient) GetEvents(ctx context.Context, height int64) ([]*Event,
 	return rsp, nil
 }
 
+func (c *stakingClient) GetTransaction(ctx context.Context, txHash hash.Hash) (*TransactionResult, error) {
+	var rsp TransactionResult
+	if err := c.conn.Invoke(ctx, methodGetTransaction.FullName(), txHash, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *stakingClient) GetStatus(ctx context.Context) (*Status, error) {
+	var rsp Status
+	if err := c.conn.Invoke(ctx, methodGetStatus.FullName(), nil, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
 func (c *stakingClient) WatchEvents(ctx context.Context) (<-chan *Event, pubsub.ClosableSubscription, error) {
 	ctx, sub := pubsub.NewContextSubscription(ctx)
 
@@ -801,6 +1164,53 @@ func (c *stakingClient) WatchEvents(ctx context.Context) (<-chan *Event, pubsub.
 	return ch, sub, nil
 }
 
+func (c *stakingClient) QueryEvents(ctx context.Context, query *EventsQuery) (*EventsPage, error) {
+	var rsp EventsPage
+	if err := c.conn.Invoke(ctx, methodQueryEvents.FullName(), query, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *stakingClient) WatchEventsFrom(ctx context.Context, query *EventsWatchQuery) (<-chan *Event, *EventsSubscription, error) {
+	ctx, cancelSub := pubsub.NewContextSubscription(ctx)
+	sub := &EventsSubscription{ClosableSubscription: cancelSub}
+
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[1], methodWatchEventsFrom.FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = stream.SendMsg(query); err != nil {
+		return nil, nil, err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *Event)
+	go func() {
+		defer close(ch)
+
+		for {
+			var ev Event
+			if serr := stream.RecvMsg(&ev); serr != nil {
+				if serr != io.EOF && ctx.Err() == nil {
+					sub.err = serr
+				}
+				return
+			}
+
+			select {
+			case ch <- &ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, sub, nil
+}
+
 func (c *stakingClient) Cleanup() {
 }
 
@@ -0,0 +1,42 @@
+package api
+
+// AccountCreatedEvent is the event emitted when an account is created in the ledger, which usually
+// happens when it is first credited. The creation height is recorded in GeneralAccount.CreatedAt.
+type AccountCreatedEvent struct {
+	Account Address `json:"account"`
+	// Nonce is the nonce the account starts with, which is non-zero in case the account was
+	// previously reaped.
+	Nonce uint64 `json:"nonce,omitempty"`
+}
+
+// EventKind returns a string representation of this event's kind.
+func (e *AccountCreatedEvent) EventKind() string {
+	return "account_created"
+}
+
+// AccountReapedEvent is the event emitted when a dust account is reaped from the ledger.
+//
+// As transactions are only bound to an account via its nonce, the nonce of a reaped account is
+// retained so that transactions signed before the account was reaped cannot be replayed. Querying
+// a reaped account returns an otherwise empty account with the retained nonce and once the account
+// is re-created, it continues from the retained nonce while getting a fresh creation height.
+type AccountReapedEvent struct {
+	Account Address `json:"account"`
+	// Nonce is the retained nonce of the reaped account.
+	Nonce uint64 `json:"nonce,omitempty"`
+}
+
+// EventKind returns a string representation of this event's kind.
+func (e *AccountReapedEvent) EventKind() string {
+	return "account_reaped"
+}
+
+// NewReapedAccount returns the account as it is reported after it has been reaped with the given
+// retained nonce.
+func NewReapedAccount(nonce uint64) *Account {
+	return &Account{
+		General: GeneralAccount{
+			Nonce: nonce,
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/oasisprotocol/oasis-core/go/common/prettyprint"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+)
+
+// MaxAccountMetadataSize is the maximum size (in bytes) of the metadata attached to an account.
+const MaxAccountMetadataSize = 1024
+
+var _ prettyprint.PrettyPrinter = (*SetMetadata)(nil)
+
+// SetMetadata is a request to set the metadata of the caller's account.
+//
+// Metadata is opaque to the staking backend and can be used by account holders to publish small
+// self-describing information about themselves (e.g., a name or a hash of a website). Empty
+// metadata clears any previously set metadata.
+type SetMetadata struct {
+	Metadata []byte `json:"metadata,omitempty"`
+}
+
+// SanityCheck performs a sanity check on the set metadata request.
+func (sm *SetMetadata) SanityCheck() error {
+	if len(sm.Metadata) > MaxAccountMetadataSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrMetadataTooLarge, len(sm.Metadata), MaxAccountMetadataSize)
+	}
+	return nil
+}
+
+// PrettyPrint writes a pretty-printed representation of SetMetadata to the given writer.
+func (sm SetMetadata) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
+	if len(sm.Metadata) == 0 {
+		fmt.Fprintf(w, "%sMetadata: none\n", prefix)
+		return
+	}
+	fmt.Fprintf(w, "%sMetadata: %s\n", prefix, hex.EncodeToString(sm.Metadata))
+}
+
+// PrettyType returns a representation of SetMetadata that can be used for pretty printing.
+func (sm SetMetadata) PrettyType() (interface{}, error) {
+	return sm, nil
+}
+
+// NewSetMetadataTx creates a new set metadata transaction.
+func NewSetMetadataTx(nonce uint64, fee *transaction.Fee, setMetadata *SetMetadata) *transaction.Transaction {
+	return transaction.NewTransaction(nonce, fee, MethodSetMetadata, setMetadata)
+}
+
+// SetMetadataGas returns the amount of gas needed to set metadata of the given size.
+func (p *ConsensusParameters) SetMetadataGas(size int) transaction.Gas {
+	return p.GasCosts[GasOpSetMetadata] + transaction.Gas(size)*p.GasCosts[GasOpSetMetadataByte]
+}
+
+// CanSetMetadata checks whether the given account is allowed to set the given metadata.
+//
+// Setting non-empty metadata requires the account's general balance to be at least the configured
+// MinMetadataBalance, which discourages using account metadata for spam.
+func (p *ConsensusParameters) CanSetMetadata(acct *Account, sm *SetMetadata) error {
+	if err := sm.SanityCheck(); err != nil {
+		return err
+	}
+	if len(sm.Metadata) > 0 && acct.General.Balance.Cmp(&p.MinMetadataBalance) < 0 {
+		return ErrInsufficientBalance
+	}
+	return nil
+}
+
+// MetadataUpdatedEvent is the event emitted when the metadata of an account is updated.
+type MetadataUpdatedEvent struct {
+	Owner    Address `json:"owner"`
+	Metadata []byte  `json:"metadata,omitempty"`
+}
+
+// EventKind returns a string representation of this event's kind.
+func (e *MetadataUpdatedEvent) EventKind() string {
+	return "metadata_updated"
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	"github.com/oasisprotocol/oasis-core/go/common/prettyprint"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+)
+
+// MaxMultiSigSigners is the maximum number of signers of a multi-signature descriptor.
+const MaxMultiSigSigners = 16
+
+var (
+	// MultiSigSignatureContext is the context used for signing multi-signed transactions.
+	MultiSigSignatureContext = signature.NewContext("oasis-core/consensus: multisig tx", signature.WithChainSeparation())
+
+	// MultiSigMethods are the methods that can be authorized by multi-signed transactions.
+	MultiSigMethods = map[transaction.MethodName]bool{
+		MethodTransfer:         true,
+		MethodBurn:             true,
+		MethodAddEscrow:        true,
+		MethodReclaimEscrow:    true,
+		MethodAllow:            true,
+		MethodAccountUpdate:    true,
+		MethodSetMetadata:      true,
+		MethodSetTransferLimit: true,
+	}
+
+	_ prettyprint.PrettyPrinter = (*MultiSigDescriptor)(nil)
+	_ prettyprint.PrettyPrinter = (*AccountUpdate)(nil)
+	_ prettyprint.PrettyPrinter = (*MultiSignedTransaction)(nil)
+)
+
+func init() {
+	// Diagnose transactions signed under the multi-signature context by mistake.
+	transaction.RegisterKnownSignatureContext(MultiSigSignatureContext)
+}
+
+// MultiSigDescriptor is a multi-signature account descriptor.
+//
+// Transactions on behalf of an account with a multi-signature descriptor must be signed by at
+// least Threshold distinct signers from the descriptor.
+type MultiSigDescriptor struct {
+	// Signers are the public keys of the signers.
+	Signers []signature.PublicKey `json:"signers"`
+	// Threshold is the number of signatures required to authorize a transaction.
+	Threshold uint16 `json:"threshold"`
+}
+
+// SanityCheck performs a sanity check on the multi-signature descriptor.
+func (d *MultiSigDescriptor) SanityCheck() error {
+	if len(d.Signers) == 0 || len(d.Signers) > MaxMultiSigSigners {
+		return fmt.Errorf("multisig: number of signers must be between 1 and %d", MaxMultiSigSigners)
+	}
+	if d.Threshold == 0 || int(d.Threshold) > len(d.Signers) {
+		return fmt.Errorf("multisig: threshold must be between 1 and the number of signers")
+	}
+	seen := make(map[signature.PublicKey]bool)
+	for _, pk := range d.Signers {
+		if !pk.IsValid() {
+			return fmt.Errorf("multisig: invalid signer %s", pk)
+		}
+		if seen[pk] {
+			return fmt.Errorf("multisig: duplicate signer %s", pk)
+		}
+		seen[pk] = true
+	}
+	return nil
+}
+
+// Verify checks that the given (already authenticated) signers satisfy the descriptor.
+//
+// All signers must be distinct members of the descriptor and there must be at least as many of
+// them as the descriptor threshold.
+func (d *MultiSigDescriptor) Verify(signers []signature.PublicKey) error {
+	members := make(map[signature.PublicKey]bool)
+	for _, pk := range d.Signers {
+		members[pk] = true
+	}
+	seen := make(map[signature.PublicKey]bool)
+	for _, pk := range signers {
+		if !members[pk] {
+			return ErrInvalidMultiSig
+		}
+		if seen[pk] {
+			return ErrInvalidMultiSig
+		}
+		seen[pk] = true
+	}
+	if len(seen) < int(d.Threshold) {
+		return ErrInvalidMultiSig
+	}
+	return nil
+}
+
+// PrettyPrint writes a pretty-printed representation of MultiSigDescriptor to the given writer.
+func (d MultiSigDescriptor) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
+	fmt.Fprintf(w, "%sThreshold: %d\n", prefix, d.Threshold)
+	fmt.Fprintf(w, "%sSigners:\n", prefix)
+	for _, pk := range d.Signers {
+		fmt.Fprintf(w, "%s  %s\n", prefix, pk)
+	}
+}
+
+// PrettyType returns a representation of MultiSigDescriptor that can be used for pretty printing.
+func (d MultiSigDescriptor) PrettyType() (interface{}, error) {
+	return d, nil
+}
+
+// AccountUpdate is an account configuration update.
+type AccountUpdate struct {
+	// MultiSig is the multi-signature descriptor of the account. If not set, the account is
+	// controlled by the single key the account address is derived from.
+	MultiSig *MultiSigDescriptor `json:"multisig,omitempty"`
+}
+
+// SanityCheck performs a sanity check on the account update.
+func (au *AccountUpdate) SanityCheck() error {
+	if au.MultiSig != nil {
+		return au.MultiSig.SanityCheck()
+	}
+	return nil
+}
+
+// PrettyPrint writes a pretty-printed representation of AccountUpdate to the given writer.
+func (au AccountUpdate) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
+	if au.MultiSig == nil {
+		fmt.Fprintf(w, "%sMulti-signature: none\n", prefix)
+		return
+	}
+	fmt.Fprintf(w, "%sMulti-signature:\n", prefix)
+	au.MultiSig.PrettyPrint(ctx, prefix+"  ", w)
+}
+
+// PrettyType returns a representation of AccountUpdate that can be used for pretty printing.
+func (au AccountUpdate) PrettyType() (interface{}, error) {
+	return au, nil
+}
+
+// NewAccountUpdateTx creates a new account update transaction.
+func NewAccountUpdateTx(nonce uint64, fee *transaction.Fee, update *AccountUpdate) *transaction.Transaction {
+	return transaction.NewTransaction(nonce, fee, MethodAccountUpdate, update)
+}
+
+// AuthenticateSigners checks that the signers of a transaction for the given method are allowed
+// to act on behalf of the account.
+//
+// Signers must be nil for regular single-signed transactions, which are only allowed for accounts
+// without a multi-signature descriptor. Multi-signed transactions are only allowed for accounts
+// with a multi-signature descriptor which the signers satisfy, and only for MultiSigMethods.
+func (a *Account) AuthenticateSigners(method transaction.MethodName, signers []signature.PublicKey) error {
+	switch {
+	case signers == nil && a.General.MultiSig == nil:
+		return nil
+	case signers == nil || a.General.MultiSig == nil:
+		return ErrInvalidMultiSig
+	case !MultiSigMethods[method]:
+		return ErrForbidden
+	default:
+		return a.General.MultiSig.Verify(signers)
+	}
+}
+
+// MultiSigTransaction is a transaction submitted on behalf of a multi-signature account.
+type MultiSigTransaction struct {
+	// Account is the address of the account on whose behalf the transaction is submitted.
+	//
+	// The account is part of the signed payload so that the signatures cannot be replayed on
+	// behalf of a different account controlled by the same signers.
+	Account Address `json:"account"`
+
+	// Transaction is the submitted transaction.
+	Transaction transaction.Transaction `json:"tx"`
+}
+
+// MultiSignedTransaction is a transaction signed by multiple signers on behalf of a
+// multi-signature account.
+type MultiSignedTransaction struct {
+	signature.MultiSigned
+}
+
+// Hash returns the cryptographic hash of the encoded transaction.
+func (s *MultiSignedTransaction) Hash() hash.Hash {
+	return hash.NewFrom(s)
+}
+
+// Signers returns the public keys of all transaction signers.
+//
+// Note: This does not verify the signatures.
+func (s *MultiSignedTransaction) Signers() []signature.PublicKey {
+	signers := make([]signature.PublicKey, 0, len(s.Signatures))
+	for _, sig := range s.Signatures {
+		signers = append(signers, sig.PublicKey)
+	}
+	return signers
+}
+
+// PrettyPrint writes a pretty-printed representation of the type
+// to the given writer.
+func (s MultiSignedTransaction) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
+	fmt.Fprintf(w, "%sHash: %s\n", prefix, s.Hash())
+
+	fmt.Fprintf(w, "%sSigners:\n", prefix)
+	for _, sig := range s.Signatures {
+		fmt.Fprintf(w, "%s  %s\n", prefix, sig.PublicKey)
+		fmt.Fprintf(w, "%s    (signature: %s)\n", prefix, sig.Signature)
+	}
+
+	// Check if signatures are valid.
+	if !signature.VerifyManyToOne(MultiSigSignatureContext, s.Blob, s.Signatures) {
+		fmt.Fprintf(w, "%s  [INVALID SIGNATURES]\n", prefix)
+	}
+
+	var mtx MultiSigTransaction
+	fmt.Fprintf(w, "%sContent:\n", prefix)
+	if err := cbor.Unmarshal(s.Blob, &mtx); err != nil {
+		fmt.Fprintf(w, "%s  <error: %s>\n", prefix, err)
+		return
+	}
+
+	fmt.Fprintf(w, "%s  Account: %s\n", prefix, mtx.Account)
+	mtx.Transaction.PrettyPrint(ctx, prefix+"  ", w)
+}
+
+// PrettyType returns a representation of the type that can be used for pretty printing.
+func (s MultiSignedTransaction) PrettyType() (interface{}, error) {
+	var mtx MultiSigTransaction
+	if err := cbor.Unmarshal(s.Blob, &mtx); err != nil {
+		return nil, fmt.Errorf("malformed signed blob: %w", err)
+	}
+	return signature.NewPrettyMultiSigned(s.MultiSigned, mtx)
+}
+
+// Open first verifies the blob signatures and then unmarshals the blob.
+//
+// In case any of the signatures has been made under another known signature context, the
+// returned error is a *signature.ContextMismatchError.
+func (s *MultiSignedTransaction) Open(mtx *MultiSigTransaction) error { // nolint: interfacer
+	if len(s.Signatures) == 0 {
+		return signature.ErrVerifyFailed
+	}
+	if !signature.VerifyManyToOne(MultiSigSignatureContext, s.Blob, s.Signatures) {
+		for i := range s.Signatures {
+			if !s.Signatures[i].Verify(MultiSigSignatureContext, s.Blob) {
+				return s.Signatures[i].DiagnoseContext(MultiSigSignatureContext, transaction.KnownSignatureContexts(), s.Blob)
+			}
+		}
+		return signature.ErrVerifyFailed
+	}
+	return cbor.Unmarshal(s.Blob, mtx)
+}
+
+// SignMultiSigTransaction signs a transaction on behalf of the given account with all of the
+// given signers.
+func SignMultiSigTransaction(signers []signature.Signer, account Address, tx *transaction.Transaction) (*MultiSignedTransaction, error) {
+	signed, err := signature.SignMultiSigned(signers, MultiSigSignatureContext, &MultiSigTransaction{
+		Account:     account,
+		Transaction: *tx,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultiSignedTransaction{MultiSigned: *signed}, nil
+}
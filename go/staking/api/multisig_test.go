@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+)
+
+func TestMultiSigDescriptor(t *testing.T) {
+	require := require.New(t)
+
+	var pks []signature.PublicKey
+	for _, seed := range []string{"multisig 1", "multisig 2", "multisig 3"} {
+		pks = append(pks, memorySigner.NewTestSigner(seed).Public())
+	}
+	outsider := memorySigner.NewTestSigner("multisig outsider").Public()
+
+	for _, tc := range []struct {
+		msg   string
+		desc  MultiSigDescriptor
+		valid bool
+	}{
+		{"no signers", MultiSigDescriptor{Threshold: 1}, false},
+		{"zero threshold", MultiSigDescriptor{Signers: pks}, false},
+		{"threshold above signers", MultiSigDescriptor{Signers: pks, Threshold: 4}, false},
+		{"duplicate signers", MultiSigDescriptor{Signers: []signature.PublicKey{pks[0], pks[0]}, Threshold: 1}, false},
+		{"invalid signer", MultiSigDescriptor{Signers: []signature.PublicKey{{}}, Threshold: 1}, false},
+		{"too many signers", MultiSigDescriptor{Signers: make([]signature.PublicKey, MaxMultiSigSigners+1), Threshold: 1}, false},
+		{"1-of-1", MultiSigDescriptor{Signers: pks[:1], Threshold: 1}, true},
+		{"2-of-3", MultiSigDescriptor{Signers: pks, Threshold: 2}, true},
+		{"3-of-3", MultiSigDescriptor{Signers: pks, Threshold: 3}, true},
+	} {
+		err := tc.desc.SanityCheck()
+		if tc.valid {
+			require.NoError(err, tc.msg)
+		} else {
+			require.Error(err, tc.msg)
+		}
+	}
+
+	desc := MultiSigDescriptor{Signers: pks, Threshold: 2}
+	require.NoError(desc.Verify(pks[:2]), "Verify with threshold signers")
+	require.NoError(desc.Verify(pks), "Verify with all signers")
+	require.ErrorIs(desc.Verify(pks[:1]), ErrInvalidMultiSig, "Verify below threshold")
+	require.ErrorIs(desc.Verify([]signature.PublicKey{pks[0], pks[0]}), ErrInvalidMultiSig, "Verify with duplicate signers")
+	require.ErrorIs(desc.Verify([]signature.PublicKey{pks[0], pks[1], outsider}), ErrInvalidMultiSig, "Verify with non-member signer")
+
+	var acct Account
+	require.NoError(acct.AuthenticateSigners(MethodTransfer, nil), "single-signed tx for single-key account")
+	require.ErrorIs(acct.AuthenticateSigners(MethodTransfer, pks[:2]), ErrInvalidMultiSig, "multi-signed tx for single-key account")
+	acct.General.MultiSig = &desc
+	require.ErrorIs(acct.AuthenticateSigners(MethodTransfer, nil), ErrInvalidMultiSig, "single-signed tx for multi-signature account")
+	require.NoError(acct.AuthenticateSigners(MethodTransfer, pks[:2]), "multi-signed tx for multi-signature account")
+	require.ErrorIs(acct.AuthenticateSigners(MethodWithdraw, pks[:2]), ErrForbidden, "multi-signed tx for unsupported method")
+	require.False(acct.IsReapable(), "multi-signature accounts should not be reapable")
+}
+
+func TestSignatureContextMismatch(t *testing.T) {
+	require := require.New(t)
+
+	signature.SetChainContext("test: oasis-core tests")
+
+	signer := memorySigner.NewTestSigner("signature context mismatch")
+	tx := NewTransferTx(0, nil, &Transfer{
+		To:     NewAddress(memorySigner.NewTestSigner("signature context mismatch to").Public()),
+		Amount: *quantity.NewFromUint64(100),
+	})
+
+	// A transfer signed under the multi-signature context should be diagnosed.
+	signed, err := signature.SignSigned(signer, MultiSigSignatureContext, tx)
+	require.NoError(err, "SignSigned")
+	sigTx := transaction.SignedTransaction{Signed: *signed}
+	var opened transaction.Transaction
+	err = sigTx.Open(&opened)
+	require.ErrorIs(err, signature.ErrVerifyFailed, "transaction should be rejected")
+	var mismatchErr *signature.ContextMismatchError
+	require.True(errors.As(err, &mismatchErr), "error should be a context mismatch error")
+	require.Equal(MultiSigSignatureContext, mismatchErr.Actual, "actual context should be reported")
+	require.Equal(transaction.SignatureContext, mismatchErr.Expected, "expected context should be reported")
+	require.Equal(
+		"signed: signature verification failed: signed under context 'oasis-core/consensus: multisig tx' but expected 'oasis-core/consensus: tx'",
+		err.Error(),
+	)
+
+	// A multi-signed transfer signed under the transaction context should be diagnosed.
+	multiSigned, err := signature.SignMultiSigned([]signature.Signer{signer}, transaction.SignatureContext, &MultiSigTransaction{
+		Account:     NewAddress(signer.Public()),
+		Transaction: *tx,
+	})
+	require.NoError(err, "SignMultiSigned")
+	multiTx := MultiSignedTransaction{MultiSigned: *multiSigned}
+	var openedMulti MultiSigTransaction
+	err = multiTx.Open(&openedMulti)
+	require.ErrorIs(err, signature.ErrVerifyFailed, "multi-signed transaction should be rejected")
+	require.True(errors.As(err, &mismatchErr), "error should be a context mismatch error")
+	require.Equal(transaction.SignatureContext, mismatchErr.Actual, "actual context should be reported")
+	require.Equal(MultiSigSignatureContext, mismatchErr.Expected, "expected context should be reported")
+
+	// Signatures which are not valid under any known context should not be diagnosed.
+	sigTx.Blob = append([]byte{}, sigTx.Blob...)
+	sigTx.Blob[0] ^= 0xff
+	err = sigTx.Open(&opened)
+	require.Equal(signature.ErrVerifyFailed, err, "corrupted transaction should fail verification")
+
+	// Correctly signed transactions should be accepted.
+	correct, err := transaction.Sign(signer, tx)
+	require.NoError(err, "Sign")
+	require.NoError(correct.Open(&opened), "Open")
+	require.Equal(tx.Method, opened.Method)
+}
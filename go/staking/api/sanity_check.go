@@ -2,46 +2,88 @@
 package api
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
 
 	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
 	"github.com/oasisprotocol/oasis-core/go/staking/api/token"
 )
 
+// formatViolations formats a list of sanity check violations. A single violation is formatted
+// as-is so that the error message is the same as if it were not a multi-error.
+func formatViolations(errs []error) string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+
+	points := make([]string, len(errs))
+	for i, err := range errs {
+		points[i] = "* " + err.Error()
+	}
+	return fmt.Sprintf("%d violations:\n\t%s", len(errs), strings.Join(points, "\n\t"))
+}
+
+// violations returns the given accumulated violations (if any) as an error.
+func violations(errs error) error {
+	if merr, ok := errs.(*multierror.Error); ok {
+		merr.ErrorFormat = formatViolations
+	}
+	return errs
+}
+
 // SanityCheck performs a sanity check on the consensus parameters.
+//
+// All violations are reported in the returned error.
 func (p *ConsensusParameters) SanityCheck() error {
+	var errs error
+
 	// Thresholds.
 	for _, kind := range ThresholdKinds {
 		val, ok := p.Thresholds[kind]
 		if !ok {
-			return fmt.Errorf("threshold for kind '%s' not defined", kind)
+			errs = multierror.Append(errs, fmt.Errorf("threshold for kind '%s' not defined", kind))
+			continue
 		}
 		if !val.IsValid() {
-			return fmt.Errorf("threshold '%s' has invalid value", kind)
+			errs = multierror.Append(errs, fmt.Errorf("threshold '%s' has invalid value", kind))
 		}
 	}
 
 	// Fee splits.
 	if !p.FeeSplitWeightPropose.IsValid() {
-		return fmt.Errorf("fee split weight propose has invalid value")
+		errs = multierror.Append(errs, fmt.Errorf("fee split weight propose has invalid value"))
 	}
 	if !p.FeeSplitWeightVote.IsValid() {
-		return fmt.Errorf("fee split weight vote has invalid value")
+		errs = multierror.Append(errs, fmt.Errorf("fee split weight vote has invalid value"))
 	}
 	if !p.FeeSplitWeightNextPropose.IsValid() {
-		return fmt.Errorf("fee split weight next propose has invalid value")
+		errs = multierror.Append(errs, fmt.Errorf("fee split weight next propose has invalid value"))
 	}
 	if p.FeeSplitWeightPropose.IsZero() && p.FeeSplitWeightVote.IsZero() && p.FeeSplitWeightNextPropose.IsZero() {
-		return fmt.Errorf("fee split proportions are all zero")
+		errs = multierror.Append(errs, fmt.Errorf("fee split proportions are all zero"))
 	}
 
-	return nil
+	// Slashing.
+	for reason, slash := range p.Slashing {
+		if err := slash.SanityCheck(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("slashing for reason '%s' is invalid: %w", reason, err))
+		}
+	}
+
+	return violations(errs)
 }
 
 // SanityCheckAccount examines an account's balances.
 // Adds the balances to a running total `total`.
+//
+// All violations are reported in the returned error.
 func SanityCheckAccount(
 	total *quantity.Quantity,
 	parameters *ConsensusParameters,
@@ -52,21 +94,53 @@ func SanityCheckAccount(
 	if !addr.IsValid() {
 		return fmt.Errorf("staking: sanity check failed: account has invalid address: %s", addr)
 	}
+
+	var errs error
+	if acct.General.CreatedAt < 0 {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"staking: sanity check failed: creation height is invalid for account %s", addr,
+		))
+	}
 	if !acct.General.Balance.IsValid() {
-		return fmt.Errorf(
+		errs = multierror.Append(errs, fmt.Errorf(
 			"staking: sanity check failed: general balance is invalid for account %s", addr,
-		)
+		))
 	}
 	if !acct.Escrow.Active.Balance.IsValid() {
-		return fmt.Errorf(
+		errs = multierror.Append(errs, fmt.Errorf(
 			"staking: sanity check failed: escrow active balance is invalid for account %s", addr,
-		)
+		))
 	}
 	if !acct.Escrow.Debonding.Balance.IsValid() {
-		return fmt.Errorf(
+		errs = multierror.Append(errs, fmt.Errorf(
 			"staking: sanity check failed: escrow debonding balance is invalid for account %s",
 			addr,
-		)
+		))
+	}
+	if !acct.Escrow.Active.TotalShares.IsValid() {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"staking: sanity check failed: escrow active total shares are invalid for account %s", addr,
+		))
+	}
+	if !acct.Escrow.Debonding.TotalShares.IsValid() {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"staking: sanity check failed: escrow debonding total shares are invalid for account %s", addr,
+		))
+	}
+
+	if acct.General.MultiSig != nil {
+		if err := acct.General.MultiSig.SanityCheck(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"staking: sanity check failed: multi-signature descriptor for account %s is invalid: %w",
+				addr, err,
+			))
+		}
+	}
+	if len(acct.General.Metadata) > MaxAccountMetadataSize {
+		errs = multierror.Append(errs, fmt.Errorf(
+			"staking: sanity check failed: metadata for account %s is too large: %w",
+			addr, ErrMetadataTooLarge,
+		))
 	}
 
 	_ = total.Add(&acct.General.Balance)
@@ -75,22 +149,42 @@ func SanityCheckAccount(
 
 	commissionScheduleShallowCopy := acct.Escrow.CommissionSchedule
 	if err := commissionScheduleShallowCopy.PruneAndValidateForGenesis(&parameters.CommissionScheduleRules, now); err != nil {
-		return fmt.Errorf(
+		errs = multierror.Append(errs, fmt.Errorf(
 			"staking: sanity check failed: commission schedule for account %s is invalid: %+v",
 			addr, err,
-		)
+		))
 	}
 
-	for beneficiary, allowance := range acct.General.Allowances {
+	beneficiaries := make([]Address, 0, len(acct.General.Allowances))
+	for beneficiary := range acct.General.Allowances {
+		beneficiaries = append(beneficiaries, beneficiary)
+	}
+	sortAddresses(beneficiaries)
+	for _, beneficiary := range beneficiaries {
+		allowance := acct.General.Allowances[beneficiary]
 		if !beneficiary.IsValid() {
-			return fmt.Errorf("staking: sanity check failed: account %s allowance has invalid beneficiary address %s", addr, beneficiary)
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: account %s allowance has invalid beneficiary address %s", addr, beneficiary))
 		}
 		if !allowance.IsValid() {
-			return fmt.Errorf("staking: sanity check failed: account %s allowance is invalid for beneficiary %s", addr, beneficiary)
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: account %s allowance is invalid for beneficiary %s", addr, beneficiary))
+		}
+	}
+	beneficiaries = make([]Address, 0, len(acct.General.AllowanceExpiries))
+	for beneficiary := range acct.General.AllowanceExpiries {
+		beneficiaries = append(beneficiaries, beneficiary)
+	}
+	sortAddresses(beneficiaries)
+	for _, beneficiary := range beneficiaries {
+		expiry := acct.General.AllowanceExpiries[beneficiary]
+		if _, ok := acct.General.Allowances[beneficiary]; !ok {
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: account %s has allowance expiry without allowance for beneficiary %s", addr, beneficiary))
+		}
+		if expiry <= 0 {
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: account %s allowance expiry is invalid for beneficiary %s", addr, beneficiary))
 		}
 	}
 
-	return nil
+	return violations(errs)
 }
 
 // SanityCheckDelegations examines an account's delegations.
@@ -233,99 +327,179 @@ func SanityCheckAccountShares(
 	return nil
 }
 
+// sortAddresses sorts the given addresses in place so that violations are reported in a
+// deterministic order.
+func sortAddresses(addrs []Address) {
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+}
+
 // SanityCheck does basic sanity checking on the genesis state.
+//
+// Instead of stopping at the first violation, all violations are collected and reported in the
+// returned error, each referring to the offending account or field.
 func (g *Genesis) SanityCheck(now beacon.EpochTime) error { // nolint: gocyclo
+	var errs error
+
 	if err := g.Parameters.SanityCheck(); err != nil {
-		return fmt.Errorf("staking: sanity check failed: %w", err)
+		var merr *multierror.Error
+		if errors.As(err, &merr) {
+			for _, err := range merr.Errors {
+				errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: %w", err))
+			}
+		} else {
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: %w", err))
+		}
 	}
 
 	tokenSymbolLength := len(g.TokenSymbol)
-	if tokenSymbolLength == 0 {
-		return fmt.Errorf("staking: sanity check failed: token symbol is empty")
-	}
-	if tokenSymbolLength > token.TokenSymbolMaxLength {
-		return fmt.Errorf("staking: sanity check failed: token symbol exceeds maximum length")
-	}
-	match := regexp.MustCompile(token.TokenSymbolRegexp).FindString(g.TokenSymbol)
-	if match == "" {
-		return fmt.Errorf("staking: sanity check failed: token symbol should match '%s'", token.TokenSymbolRegexp)
+	switch {
+	case tokenSymbolLength == 0:
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: token symbol is empty"))
+	case tokenSymbolLength > token.TokenSymbolMaxLength:
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: token symbol exceeds maximum length"))
+	default:
+		match := regexp.MustCompile(token.TokenSymbolRegexp).FindString(g.TokenSymbol)
+		if match == "" {
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: token symbol should match '%s'", token.TokenSymbolRegexp))
+		}
 	}
 
 	if g.TokenValueExponent > token.TokenValueExponentMaxValue {
-		return fmt.Errorf("staking: sanity check failed: token value exponent is invalid")
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: token value exponent is invalid"))
 	}
 
 	if !g.TotalSupply.IsValid() {
-		return fmt.Errorf("staking: sanity check failed: total supply is invalid")
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: total supply is invalid"))
 	}
 
 	if !g.CommonPool.IsValid() {
-		return fmt.Errorf("staking: sanity check failed: common pool is invalid")
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: common pool is invalid"))
 	}
 
 	if !g.LastBlockFees.IsValid() {
-		return fmt.Errorf("staking: sanity check failed: last block fees is invalid")
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: last block fees is invalid"))
+	}
+
+	if !g.GovernanceDeposits.IsValid() {
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: governance deposits is invalid"))
+	}
+
+	for _, key := range g.duplicateLedgerKeys {
+		errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: duplicate ledger entry for account %s", key))
+	}
+
+	addrs := make([]Address, 0, len(g.Ledger))
+	for addr := range g.Ledger {
+		addrs = append(addrs, addr)
 	}
+	sortAddresses(addrs)
 
 	// Check if the total supply adds up:
 	// common pool + last block fees + all balances in the ledger.
 	// Check all commission schedules.
 	var total quantity.Quantity
-	for addr, acct := range g.Ledger {
-		err := SanityCheckAccount(&total, &g.Parameters, now, addr, acct)
-		if err != nil {
-			return err
+	for _, addr := range addrs {
+		acct := g.Ledger[addr]
+		if err := SanityCheckAccount(&total, &g.Parameters, now, addr, acct); err != nil {
+			errs = multierror.Append(errs, err)
 		}
 
 		// Make sure that the stake accumulator is empty as otherwise it could be inconsistent with
 		// what is registered in the genesis block.
 		if len(acct.Escrow.StakeAccumulator.Claims) > 0 {
-			return fmt.Errorf("staking: non-empty stake accumulator in genesis")
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: non-empty stake accumulator in genesis for account %s", addr))
 		}
 	}
+	// Reaped accounts must not be in the ledger as re-creating them removes the retained nonce.
+	reapedAddrs := make([]Address, 0, len(g.ReapedAccounts))
+	for addr := range g.ReapedAccounts {
+		reapedAddrs = append(reapedAddrs, addr)
+	}
+	sortAddresses(reapedAddrs)
+	for _, addr := range reapedAddrs {
+		switch {
+		case !addr.IsValid():
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: reaped account has invalid address: %s", addr))
+		case g.Ledger[addr] != nil:
+			errs = multierror.Append(errs, fmt.Errorf("staking: sanity check failed: reaped account %s is in the ledger", addr))
+		}
+	}
+
 	_ = total.Add(&g.GovernanceDeposits)
 	_ = total.Add(&g.CommonPool)
 	_ = total.Add(&g.LastBlockFees)
-	if total.Cmp(&g.TotalSupply) != 0 {
-		return fmt.Errorf(
+	switch total.Cmp(&g.TotalSupply) {
+	case 1:
+		errs = multierror.Append(errs, fmt.Errorf(
+			"staking: sanity check failed: balances in accounts, plus governance deposits, plus common pool, plus last block fees (%s), exceed total supply (%s)",
+			total.String(), g.TotalSupply.String(),
+		))
+	case -1:
+		errs = multierror.Append(errs, fmt.Errorf(
 			"staking: sanity check failed: balances in accounts, plus governance deposits, plus common pool, plus last block fees (%s), does not add up to total supply (%s)",
 			total.String(), g.TotalSupply.String(),
-		)
+		))
 	}
 
 	// All shares of all delegations for a given account must add up to account's Escrow.Active.TotalShares.
-	for addr, delegations := range g.Delegations {
+	escrowAddrs := make([]Address, 0, len(g.Delegations))
+	for addr := range g.Delegations {
+		escrowAddrs = append(escrowAddrs, addr)
+	}
+	sortAddresses(escrowAddrs)
+	for _, addr := range escrowAddrs {
 		acct := g.Ledger[addr]
 		if acct == nil {
-			return fmt.Errorf(
+			errs = multierror.Append(errs, fmt.Errorf(
 				"staking: sanity check failed: delegation specified for a nonexisting account: %v",
 				addr,
-			)
+			))
+			continue
 		}
-		if err := SanityCheckDelegations(addr, acct, delegations); err != nil {
-			return err
+		if err := SanityCheckDelegations(addr, acct, g.Delegations[addr]); err != nil {
+			errs = multierror.Append(errs, err)
 		}
 	}
 
 	// All shares of all debonding delegations for a given account must add up to account's Escrow.Debonding.TotalShares.
-	for addr, delegations := range g.DebondingDelegations {
+	escrowAddrs = make([]Address, 0, len(g.DebondingDelegations))
+	for addr := range g.DebondingDelegations {
+		escrowAddrs = append(escrowAddrs, addr)
+	}
+	sortAddresses(escrowAddrs)
+	for _, addr := range escrowAddrs {
 		acct := g.Ledger[addr]
 		if acct == nil {
-			return fmt.Errorf(
+			errs = multierror.Append(errs, fmt.Errorf(
 				"staking: sanity check failed: debonding delegation specified for a nonexisting account: %v", addr,
-			)
+			))
+			continue
 		}
-		if err := SanityCheckDebondingDelegations(addr, acct, delegations); err != nil {
-			return err
+		if err := SanityCheckDebondingDelegations(addr, acct, g.DebondingDelegations[addr]); err != nil {
+			errs = multierror.Append(errs, err)
 		}
 	}
 
-	// Check the above two invariants for each account as well.
-	for addr, acct := range g.Ledger {
-		if err := SanityCheckAccountShares(addr, acct, g.Delegations[addr], g.DebondingDelegations[addr]); err != nil {
-			return err
+	// Check the above two invariants for accounts without (debonding) delegations as well.
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			// Already reported above.
+			continue
+		}
+		acct := g.Ledger[addr]
+		if _, ok := g.Delegations[addr]; !ok {
+			if err := SanityCheckDelegations(addr, acct, nil); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+		if _, ok := g.DebondingDelegations[addr]; !ok {
+			if err := SanityCheckDebondingDelegations(addr, acct, nil); err != nil {
+				errs = multierror.Append(errs, err)
+			}
 		}
 	}
 
-	return nil
+	return violations(errs)
 }
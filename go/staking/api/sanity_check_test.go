@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+)
+
+var (
+	sanityCheckAddr1 = NewAddress(signature.NewPublicKey("5555555555555555555555555555555555555555555555555555555555555555"))
+	sanityCheckAddr2 = NewAddress(signature.NewPublicKey("6666666666666666666666666666666666666666666666666666666666666666"))
+)
+
+func newSanityCheckGenesis(t *testing.T) *Genesis {
+	return &Genesis{
+		Parameters: ConsensusParameters{
+			Thresholds: map[ThresholdKind]quantity.Quantity{
+				KindEntity:            mustInitQuantity(t, 1),
+				KindNodeValidator:     mustInitQuantity(t, 2),
+				KindNodeCompute:       mustInitQuantity(t, 3),
+				KindNodeKeyManager:    mustInitQuantity(t, 4),
+				KindRuntimeCompute:    mustInitQuantity(t, 5),
+				KindRuntimeKeyManager: mustInitQuantity(t, 6),
+			},
+			FeeSplitWeightVote: mustInitQuantity(t, 1),
+		},
+		TokenSymbol: "TEST",
+		TotalSupply: mustInitQuantity(t, 1000),
+		CommonPool:  mustInitQuantity(t, 400),
+		Ledger: map[Address]*Account{
+			sanityCheckAddr1: {
+				General: GeneralAccount{
+					Balance: mustInitQuantity(t, 500),
+				},
+			},
+			sanityCheckAddr2: {
+				General: GeneralAccount{
+					Balance: mustInitQuantity(t, 100),
+				},
+			},
+		},
+	}
+}
+
+func TestGenesisSanityCheck(t *testing.T) {
+	require := require.New(t)
+
+	g := newSanityCheckGenesis(t)
+	require.NoError(g.SanityCheck(0), "valid genesis state should pass")
+
+	// Ledger sum exceeding total supply.
+	g = newSanityCheckGenesis(t)
+	g.Ledger[sanityCheckAddr2].General.Balance = mustInitQuantity(t, 200)
+	err := g.SanityCheck(0)
+	require.EqualError(err,
+		"staking: sanity check failed: balances in accounts, plus governance deposits, plus common pool, plus last block fees (1100), exceed total supply (1000)",
+		"ledger sum exceeding total supply should be rejected",
+	)
+
+	// Ledger sum falling short of total supply.
+	g = newSanityCheckGenesis(t)
+	g.CommonPool = mustInitQuantity(t, 300)
+	err = g.SanityCheck(0)
+	require.EqualError(err,
+		"staking: sanity check failed: balances in accounts, plus governance deposits, plus common pool, plus last block fees (900), does not add up to total supply (1000)",
+		"ledger sum below total supply should be rejected",
+	)
+
+	// Thresholds missing kinds.
+	g = newSanityCheckGenesis(t)
+	delete(g.Parameters.Thresholds, KindNodeCompute)
+	delete(g.Parameters.Thresholds, KindRuntimeKeyManager)
+	err = g.SanityCheck(0)
+	require.Error(err, "thresholds missing kinds should be rejected")
+	require.Contains(err.Error(), "staking: sanity check failed: threshold for kind 'node-compute' not defined")
+	require.Contains(err.Error(), "staking: sanity check failed: threshold for kind 'runtime-keymanager' not defined")
+
+	// NOTE: There is currently no way to construct negative quantities.
+
+	// Delegation shares not matching the account's share pool.
+	g = newSanityCheckGenesis(t)
+	g.Ledger[sanityCheckAddr1].Escrow.Active.TotalShares = mustInitQuantity(t, 10)
+	err = g.SanityCheck(0)
+	require.EqualError(err,
+		fmt.Sprintf("staking: sanity check failed: all shares of all delegations (0) for account %s don't add up to account's total active shares in escrow (10)", sanityCheckAddr1),
+		"share pool mismatch should be rejected",
+	)
+
+	// Oversized account metadata.
+	g = newSanityCheckGenesis(t)
+	g.Ledger[sanityCheckAddr1].General.Metadata = make([]byte, MaxAccountMetadataSize)
+	require.NoError(g.SanityCheck(0), "metadata of the maximum size should be accepted")
+	g.Ledger[sanityCheckAddr1].General.Metadata = make([]byte, MaxAccountMetadataSize+1)
+	err = g.SanityCheck(0)
+	require.ErrorIs(err, ErrMetadataTooLarge, "oversized metadata should be rejected")
+
+	// Reaped accounts that are in the ledger.
+	g = newSanityCheckGenesis(t)
+	g.ReapedAccounts = map[Address]uint64{sanityCheckAddr1: 5}
+	err = g.SanityCheck(0)
+	require.EqualError(err,
+		fmt.Sprintf("staking: sanity check failed: reaped account %s is in the ledger", sanityCheckAddr1),
+		"reaped account in the ledger should be rejected",
+	)
+	delete(g.Ledger, sanityCheckAddr2)
+	g.CommonPool = mustInitQuantity(t, 500)
+	g.ReapedAccounts = map[Address]uint64{sanityCheckAddr2: 5}
+	require.NoError(g.SanityCheck(0), "reaped account not in the ledger should be accepted")
+
+	// Multiple violations should all be reported.
+	g = newSanityCheckGenesis(t)
+	g.TokenSymbol = ""
+	delete(g.Parameters.Thresholds, KindEntity)
+	g.Ledger[sanityCheckAddr1].Escrow.Debonding.Balance = mustInitQuantity(t, 100)
+	g.Delegations = map[Address]map[Address]*Delegation{
+		sanityCheckAddr2: {
+			sanityCheckAddr1: {Shares: mustInitQuantity(t, 1)},
+		},
+	}
+	err = g.SanityCheck(0)
+	require.Error(err, "genesis state with multiple violations should be rejected")
+	var merr *multierror.Error
+	require.ErrorAs(err, &merr, "error should list all violations")
+	require.Len(merr.Errors, 5, "all violations should be reported")
+	require.True(strings.HasPrefix(err.Error(), "5 violations:"), "error should state the number of violations")
+	for _, msg := range []string{
+		"staking: sanity check failed: threshold for kind 'entity' not defined",
+		"staking: sanity check failed: token symbol is empty",
+		"staking: sanity check failed: balances in accounts, plus governance deposits, plus common pool, plus last block fees (1100), exceed total supply (1000)",
+		fmt.Sprintf("staking: sanity check failed: all shares of all delegations (1) for account %s don't add up to account's total active shares in escrow (0)", sanityCheckAddr2),
+		fmt.Sprintf("staking: sanity check failed: account %s has no debonding delegations, but non-zero debonding escrow balance", sanityCheckAddr1),
+	} {
+		require.Contains(err.Error(), msg)
+	}
+	require.Equal(err.Error(), g.SanityCheck(0).Error(), "violations should be reported in a deterministic order")
+}
+
+func TestGenesisDuplicateLedgerKeys(t *testing.T) {
+	require := require.New(t)
+
+	g := newSanityCheckGenesis(t)
+	raw, err := json.Marshal(g)
+	require.NoError(err, "json.Marshal")
+
+	var dec Genesis
+	err = json.Unmarshal(raw, &dec)
+	require.NoError(err, "json.Unmarshal")
+	require.NoError(dec.SanityCheck(0), "decoded genesis state should pass")
+
+	// Add an upper case copy of an existing ledger entry, which decodes to the same address.
+	addr := sanityCheckAddr2.String()
+	entry := fmt.Sprintf(`"%s":`, addr)
+	require.Contains(string(raw), entry)
+	dupEntry := fmt.Sprintf(`"%s":{"general":{"balance":"100"},"escrow":{"active":{"balance":"0","total_shares":"0"},"debonding":{"balance":"0","total_shares":"0"},"commission_schedule":{},"stake_accumulator":{}}},`, strings.ToUpper(addr))
+	raw = []byte(strings.Replace(string(raw), `"ledger":{`, `"ledger":{`+dupEntry, 1))
+
+	dec = Genesis{}
+	err = json.Unmarshal(raw, &dec)
+	require.NoError(err, "json.Unmarshal")
+	require.Len(dec.Ledger, 2, "duplicate ledger entries should collapse into one")
+	err = dec.SanityCheck(0)
+	require.EqualError(err,
+		fmt.Sprintf("staking: sanity check failed: duplicate ledger entry for account %s", addr),
+		"duplicate ledger keys should be rejected",
+	)
+}
@@ -87,8 +87,91 @@ func (s *SlashReason) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// SlashShare is a fraction of an escrow balance.
+type SlashShare struct {
+	Numerator   quantity.Quantity `json:"numerator"`
+	Denominator quantity.Quantity `json:"denominator"`
+}
+
+// SanityCheck performs a sanity check on the slash share.
+func (s *SlashShare) SanityCheck() error {
+	if !s.Numerator.IsValid() || !s.Denominator.IsValid() {
+		return fmt.Errorf("invalid slash share")
+	}
+	if s.Denominator.IsZero() {
+		return fmt.Errorf("slash share denominator is zero")
+	}
+	if s.Numerator.Cmp(&s.Denominator) > 0 {
+		return fmt.Errorf("slash share is greater than one")
+	}
+	return nil
+}
+
 // Slash is the per-reason slashing configuration.
 type Slash struct {
+	// Amount is the fixed amount slashed from the escrow account. It is only used in case Share is
+	// not set.
+	Amount quantity.Quantity `json:"amount"`
+	// Share is the fraction of the escrow balance (including stake undergoing debonding) which is
+	// slashed.
+	Share *SlashShare `json:"share,omitempty"`
+	// FreezeInterval is the number of epochs for which the offending node is frozen.
+	FreezeInterval beacon.EpochTime `json:"freeze_interval"`
+}
+
+// SanityCheck performs a sanity check on the slashing configuration.
+func (s *Slash) SanityCheck() error {
+	if !s.Amount.IsValid() {
+		return fmt.Errorf("invalid slash amount")
+	}
+	if s.Share != nil {
+		return s.Share.SanityCheck()
+	}
+	return nil
+}
+
+// Penalty returns the amount to slash from an escrow account with the given escrow balance
+// (including stake undergoing debonding).
+func (s *Slash) Penalty(escrow *quantity.Quantity) (*quantity.Quantity, error) {
+	if s.Share == nil {
+		return s.Amount.Clone(), nil
+	}
+	if err := s.Share.SanityCheck(); err != nil {
+		return nil, err
+	}
+
+	// penalty = escrow * numerator / denominator
+	penalty := escrow.Clone()
+	if err := penalty.Mul(&s.Share.Numerator); err != nil {
+		return nil, fmt.Errorf("failed to multiply by slash share numerator: %w", err)
+	}
+	if err := penalty.Quo(&s.Share.Denominator); err != nil {
+		return nil, fmt.Errorf("failed to divide by slash share denominator: %w", err)
+	}
+	return penalty, nil
+}
+
+// SlashRecord is a record of an offense for which an escrow account has been slashed.
+type SlashRecord struct {
+	// Reason is the reason for slashing.
+	Reason SlashReason `json:"reason"`
+	// EvidenceHeight is the height at which the offense occurred.
+	EvidenceHeight int64 `json:"evidence_height"`
+	// Height is the height at which the escrow account was slashed.
+	Height int64 `json:"height"`
+	// Amount is the amount actually slashed.
+	Amount quantity.Quantity `json:"amount"`
+}
+
+// SlashEvent is the event emitted when an escrow account is slashed for an offense.
+type SlashEvent struct {
+	Owner          Address           `json:"owner"`
+	Reason         SlashReason       `json:"reason"`
+	EvidenceHeight int64             `json:"evidence_height"`
 	Amount         quantity.Quantity `json:"amount"`
-	FreezeInterval beacon.EpochTime  `json:"freeze_interval"`
+}
+
+// EventKind returns a string representation of this event's kind.
+func (e *SlashEvent) EventKind() string {
+	return "slash"
 }
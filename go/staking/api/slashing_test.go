@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
 )
 
 func TestSlashReason(t *testing.T) {
@@ -35,3 +37,58 @@ func TestSlashReason(t *testing.T) {
 	err = sr.UnmarshalText([]byte("invalid slash reason"))
 	require.Error(err, "UnmarshalText on invalid slash reason should error")
 }
+
+func TestSlashPenalty(t *testing.T) {
+	require := require.New(t)
+
+	q := func(n uint64) quantity.Quantity {
+		return *quantity.NewFromUint64(n)
+	}
+	escrow := q(1000)
+
+	// Fixed amounts should be slashed as-is.
+	slash := Slash{Amount: q(100)}
+	require.NoError(slash.SanityCheck(), "SanityCheck")
+	penalty, err := slash.Penalty(&escrow)
+	require.NoError(err, "Penalty")
+	require.Equal(q(100), *penalty, "fixed penalty")
+
+	// Shares should take precedence over fixed amounts and be proportional to the escrow.
+	for _, tc := range []struct {
+		numerator   uint64
+		denominator uint64
+		escrow      uint64
+		penalty     uint64
+	}{
+		{1, 4, 1000, 250},
+		{1, 3, 1000, 333},
+		{0, 1, 1000, 0},
+		{1, 1, 1000, 1000},
+		{1, 10, 0, 0},
+	} {
+		slash = Slash{
+			Amount: q(100),
+			Share: &SlashShare{
+				Numerator:   q(tc.numerator),
+				Denominator: q(tc.denominator),
+			},
+		}
+		require.NoError(slash.SanityCheck(), "SanityCheck")
+		escrow = q(tc.escrow)
+		penalty, err = slash.Penalty(&escrow)
+		require.NoError(err, "Penalty")
+		require.Zero(penalty.Cmp(quantity.NewFromUint64(tc.penalty)), "proportional penalty of %d/%d of %d", tc.numerator, tc.denominator, tc.escrow)
+		require.Equal(q(tc.escrow), escrow, "escrow should not be modified")
+	}
+
+	// Invalid shares should be rejected.
+	for _, share := range []*SlashShare{
+		{Numerator: q(1), Denominator: q(0)},
+		{Numerator: q(2), Denominator: q(1)},
+	} {
+		slash = Slash{Share: share}
+		require.Error(slash.SanityCheck(), "SanityCheck should fail on invalid share")
+		_, err = slash.Penalty(&escrow)
+		require.Error(err, "Penalty should fail on invalid share")
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	"github.com/oasisprotocol/oasis-core/go/common/prettyprint"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	"github.com/oasisprotocol/oasis-core/go/staking/api/token"
+)
+
+var (
+	_ prettyprint.PrettyPrinter = (*SetTransferLimit)(nil)
+	_ prettyprint.PrettyPrinter = (*TransferLimit)(nil)
+)
+
+// TransferLimit is a per-epoch limit on the amount of base units that can leave the general
+// balance of an account via transfers, withdrawals and escrow.
+type TransferLimit struct {
+	// Amount is the maximum amount of base units that can leave the account in a single epoch.
+	Amount quantity.Quantity `json:"amount"`
+
+	// Epoch is the epoch in which Spent was accumulated.
+	Epoch beacon.EpochTime `json:"epoch,omitempty"`
+	// Spent is the amount of base units that left the account in Epoch.
+	Spent quantity.Quantity `json:"spent,omitempty"`
+
+	// RemovalEpoch is the epoch starting with which the limit is no longer in effect, in case
+	// removal of the limit has been requested. Zero means that no removal is pending.
+	RemovalEpoch beacon.EpochTime `json:"removal_epoch,omitempty"`
+}
+
+// IsRemoved returns true iff the limit is no longer in effect at the given epoch.
+func (tl *TransferLimit) IsRemoved(epoch beacon.EpochTime) bool {
+	return tl.RemovalEpoch != 0 && epoch >= tl.RemovalEpoch
+}
+
+// Remaining returns the amount of base units that can still leave the account in the given
+// epoch.
+func (tl *TransferLimit) Remaining(epoch beacon.EpochTime) *quantity.Quantity {
+	remaining := tl.Amount.Clone()
+	if tl.Epoch == epoch {
+		if _, err := remaining.SubUpTo(&tl.Spent); err != nil {
+			return quantity.NewQuantity()
+		}
+	}
+	return remaining
+}
+
+// PrettyPrint writes a pretty-printed representation of TransferLimit to the given writer.
+func (tl TransferLimit) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
+	fmt.Fprintf(w, "%sAmount per epoch: ", prefix)
+	token.PrettyPrintAmount(ctx, tl.Amount, w)
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%sSpent in epoch %d: ", prefix, tl.Epoch)
+	token.PrettyPrintAmount(ctx, tl.Spent, w)
+	fmt.Fprintln(w)
+
+	if tl.RemovalEpoch != 0 {
+		fmt.Fprintf(w, "%sRemoved in epoch: %d\n", prefix, tl.RemovalEpoch)
+	}
+}
+
+// PrettyType returns a representation of TransferLimit that can be used for pretty printing.
+func (tl TransferLimit) PrettyType() (interface{}, error) {
+	return tl, nil
+}
+
+// TransferLimitExceededError is the error returned when an operation would move more base units
+// out of an account than its transfer limit allows in the current epoch.
+type TransferLimitExceededError struct {
+	// Remaining is the amount of base units that can still leave the account in the current
+	// epoch.
+	Remaining quantity.Quantity
+}
+
+func (e *TransferLimitExceededError) Error() string {
+	return fmt.Sprintf("%s: %s remaining in current epoch", ErrTransferLimitExceeded, e.Remaining)
+}
+
+func (e *TransferLimitExceededError) Unwrap() error {
+	return ErrTransferLimitExceeded
+}
+
+// activeTransferLimit returns the transfer limit in effect at the given epoch, if any, removing a
+// limit whose removal has taken effect.
+func (ga *GeneralAccount) activeTransferLimit(epoch beacon.EpochTime) *TransferLimit {
+	if ga.TransferLimit != nil && ga.TransferLimit.IsRemoved(epoch) {
+		ga.TransferLimit = nil
+	}
+	return ga.TransferLimit
+}
+
+// RemainingTransferLimit returns the amount of base units that can still leave the account in the
+// given epoch. In case the account has no transfer limit in effect, nil is returned.
+func (ga *GeneralAccount) RemainingTransferLimit(epoch beacon.EpochTime) *quantity.Quantity {
+	if ga.TransferLimit == nil || ga.TransferLimit.IsRemoved(epoch) {
+		return nil
+	}
+	return ga.TransferLimit.Remaining(epoch)
+}
+
+// ConsumeTransferLimit accounts for the given amount of base units leaving the account in the
+// given epoch. In case this would exceed the account's transfer limit, a
+// TransferLimitExceededError is returned.
+//
+// The amount spent is reset in case the given epoch differs from the epoch in which it was
+// accumulated.
+func (ga *GeneralAccount) ConsumeTransferLimit(amount *quantity.Quantity, epoch beacon.EpochTime) error {
+	limit := ga.activeTransferLimit(epoch)
+	if limit == nil {
+		return nil
+	}
+
+	remaining := limit.Remaining(epoch)
+	if remaining.Cmp(amount) < 0 {
+		return &TransferLimitExceededError{Remaining: *remaining}
+	}
+	if limit.Epoch != epoch {
+		limit.Epoch = epoch
+		limit.Spent = *quantity.NewQuantity()
+	}
+	return limit.Spent.Add(amount)
+}
+
+// SetTransferLimit is a request to configure the transfer limit of the caller's account.
+//
+// Setting a limit takes effect immediately, but an existing limit can only be lowered. Raising or
+// removing a limit requires removal to be requested first, which takes effect after the
+// TransferLimitRemovalDelay consensus parameter. This protects the account in case its key is
+// stolen, as the thief cannot lift the limit before the owner notices. Setting a limit while
+// removal is pending cancels the removal.
+type SetTransferLimit struct {
+	// Amount is the maximum amount of base units that can leave the account in a single epoch.
+	Amount quantity.Quantity `json:"amount"`
+	// Remove requests removal of the existing limit, in which case Amount is ignored.
+	Remove bool `json:"remove,omitempty"`
+}
+
+// PrettyPrint writes a pretty-printed representation of SetTransferLimit to the given writer.
+func (stl SetTransferLimit) PrettyPrint(ctx context.Context, prefix string, w io.Writer) {
+	if stl.Remove {
+		fmt.Fprintf(w, "%sRemove transfer limit\n", prefix)
+		return
+	}
+	fmt.Fprintf(w, "%sAmount per epoch: ", prefix)
+	token.PrettyPrintAmount(ctx, stl.Amount, w)
+	fmt.Fprintln(w)
+}
+
+// PrettyType returns a representation of SetTransferLimit that can be used for pretty printing.
+func (stl SetTransferLimit) PrettyType() (interface{}, error) {
+	return stl, nil
+}
+
+// NewSetTransferLimitTx creates a new set transfer limit transaction.
+func NewSetTransferLimitTx(nonce uint64, fee *transaction.Fee, setTransferLimit *SetTransferLimit) *transaction.Transaction {
+	return transaction.NewTransaction(nonce, fee, MethodSetTransferLimit, setTransferLimit)
+}
+
+// SetTransferLimit applies the given set transfer limit request to the account at the given
+// epoch.
+func (ga *GeneralAccount) SetTransferLimit(stl *SetTransferLimit, epoch, removalDelay beacon.EpochTime) error {
+	limit := ga.activeTransferLimit(epoch)
+	switch {
+	case stl.Remove:
+		if limit == nil {
+			return ErrInvalidArgument
+		}
+		if removalDelay == 0 {
+			ga.TransferLimit = nil
+			return nil
+		}
+		if limit.RemovalEpoch == 0 {
+			limit.RemovalEpoch = epoch + removalDelay
+		}
+	case limit == nil:
+		ga.TransferLimit = &TransferLimit{Amount: stl.Amount}
+	default:
+		if stl.Amount.Cmp(&limit.Amount) > 0 {
+			return ErrForbidden
+		}
+		limit.Amount = stl.Amount
+		limit.RemovalEpoch = 0
+	}
+	return nil
+}
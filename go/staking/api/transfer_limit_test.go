@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+)
+
+func TestTransferLimit(t *testing.T) {
+	require := require.New(t)
+
+	var ga GeneralAccount
+	require.Nil(ga.RemainingTransferLimit(1), "accounts without a limit should be unlimited")
+	require.NoError(ga.ConsumeTransferLimit(quantity.NewFromUint64(1000), 1), "ConsumeTransferLimit without a limit")
+
+	err := ga.SetTransferLimit(&SetTransferLimit{Amount: *quantity.NewFromUint64(100)}, 1, 2)
+	require.NoError(err, "SetTransferLimit")
+	require.EqualValues(quantity.NewFromUint64(100), ga.RemainingTransferLimit(1))
+
+	require.NoError(ga.ConsumeTransferLimit(quantity.NewFromUint64(70), 1), "ConsumeTransferLimit")
+	require.EqualValues(quantity.NewFromUint64(30), ga.RemainingTransferLimit(1))
+	err = ga.ConsumeTransferLimit(quantity.NewFromUint64(31), 1)
+	require.ErrorIs(err, ErrTransferLimitExceeded, "ConsumeTransferLimit above limit")
+	var tlErr *TransferLimitExceededError
+	require.ErrorAs(err, &tlErr)
+	require.EqualValues(*quantity.NewFromUint64(30), tlErr.Remaining, "error should include the remaining amount")
+	require.EqualValues(quantity.NewFromUint64(30), ga.RemainingTransferLimit(1), "failed consumption should not be accounted")
+
+	// The amount spent resets in the next epoch.
+	require.EqualValues(quantity.NewFromUint64(100), ga.RemainingTransferLimit(2))
+	require.NoError(ga.ConsumeTransferLimit(quantity.NewFromUint64(100), 2), "ConsumeTransferLimit in next epoch")
+	require.True(ga.RemainingTransferLimit(2).IsZero())
+
+	// Limits can only be lowered directly.
+	err = ga.SetTransferLimit(&SetTransferLimit{Amount: *quantity.NewFromUint64(101)}, 2, 2)
+	require.ErrorIs(err, ErrForbidden, "SetTransferLimit should not allow raising the limit")
+	err = ga.SetTransferLimit(&SetTransferLimit{Amount: *quantity.NewFromUint64(50)}, 2, 2)
+	require.NoError(err, "SetTransferLimit should allow lowering the limit")
+
+	// Removal only takes effect after the delay and can be cancelled by setting a limit.
+	err = ga.SetTransferLimit(&SetTransferLimit{Remove: true}, 2, 2)
+	require.NoError(err, "SetTransferLimit - remove")
+	require.EqualValues(4, ga.TransferLimit.RemovalEpoch)
+	err = ga.SetTransferLimit(&SetTransferLimit{Remove: true}, 3, 2)
+	require.NoError(err, "SetTransferLimit - repeated remove")
+	require.EqualValues(4, ga.TransferLimit.RemovalEpoch, "repeated removal should not extend the delay")
+	require.NotNil(ga.RemainingTransferLimit(3), "limit should be in effect before the removal epoch")
+	require.Nil(ga.RemainingTransferLimit(4), "limit should not be in effect at the removal epoch")
+
+	err = ga.SetTransferLimit(&SetTransferLimit{Amount: *quantity.NewFromUint64(50)}, 3, 2)
+	require.NoError(err, "SetTransferLimit - cancel removal")
+	require.NotNil(ga.RemainingTransferLimit(4), "cancelled removal should not take effect")
+
+	err = ga.SetTransferLimit(&SetTransferLimit{Remove: true}, 4, 2)
+	require.NoError(err, "SetTransferLimit - remove")
+	require.NoError(ga.ConsumeTransferLimit(quantity.NewFromUint64(1000), 6), "ConsumeTransferLimit after removal")
+	require.Nil(ga.TransferLimit, "removed limit should be cleared")
+
+	// Removing a non-existent limit is invalid, while a zero delay removes the limit immediately.
+	err = ga.SetTransferLimit(&SetTransferLimit{Remove: true}, 6, 2)
+	require.ErrorIs(err, ErrInvalidArgument, "SetTransferLimit - remove non-existent")
+	err = ga.SetTransferLimit(&SetTransferLimit{}, 6, 0)
+	require.NoError(err, "SetTransferLimit - zero limit")
+	require.Error(ga.ConsumeTransferLimit(quantity.NewFromUint64(1), 6), "zero limit should block all transfers")
+	err = ga.SetTransferLimit(&SetTransferLimit{Remove: true}, 6, 0)
+	require.NoError(err, "SetTransferLimit - remove without delay")
+	require.Nil(ga.TransferLimit, "limit should be removed immediately without a delay")
+}
@@ -0,0 +1,42 @@
+//go:build quantityaudit
+// +build quantityaudit
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	consensusAPI "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+	stakingTests "github.com/oasisprotocol/oasis-core/go/staking/tests"
+)
+
+func TestAuditCommittedState(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	addr := stakingTests.Accounts.GetAddress(2)
+	err := backend.Credit(ctx, addr, quantity.NewFromUint64(1000))
+	require.NoError(err, "Credit")
+
+	// Mutating quantities of committed states through aliases should panic.
+	st, err := backend.stateAt(consensusAPI.HeightLatest)
+	require.NoError(err, "stateAt")
+	require.Panics(func() { _ = st.TotalSupply.Add(quantity.NewFromUint64(1)) }, "mutating the total supply")
+	balance := &st.Ledger[addr].General.Balance
+	require.Panics(func() { _ = balance.Sub(quantity.NewFromUint64(1)) }, "mutating an account balance")
+
+	// Accounts returned by queries are copies and can be mutated.
+	acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.NotPanics(func() { _ = acct.General.Balance.Sub(quantity.NewFromUint64(1)) }, "mutating a copy")
+
+	acct, err = backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(1000), acct.General.Balance, "committed balance should be unchanged")
+}
@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// EnableDebugController enables the api.DebugController methods of the backend.
+func (b *Backend) EnableDebugController() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.debug = true
+}
+
+// BlockTime returns the timestamp of subsequent blocks as set via SetBlockTime.
+//
+// The in-memory backend does not have any time-dependent behavior, the timestamp is only recorded
+// for dependent tests.
+func (b *Backend) BlockTime() time.Time {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.blockTime
+}
+
+// Implements api.DebugController.
+func (b *Backend) AdvanceEpoch(ctx context.Context, n uint64) (beacon.EpochTime, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.debug {
+		return beacon.EpochInvalid, api.ErrDebugControllerDisabled
+	}
+	for i := uint64(0); i < n; i++ {
+		if err := b.setEpochLocked(b.epoch + 1); err != nil {
+			return beacon.EpochInvalid, err
+		}
+	}
+	return b.epoch, nil
+}
+
+// Implements api.DebugController.
+func (b *Backend) SetBlockTime(t time.Time) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.debug {
+		return api.ErrDebugControllerDisabled
+	}
+	b.blockTime = t
+	return nil
+}
@@ -0,0 +1,264 @@
+package memory
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	cmnGrpc "github.com/oasisprotocol/oasis-core/go/common/grpc"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	consensusAPI "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+	stakingTests "github.com/oasisprotocol/oasis-core/go/staking/tests"
+)
+
+const bufconnSize = 1024 * 1024
+
+// watchSync tracks event subscriptions requested by a client and established by the server.
+//
+// As the in-memory backend delivers transactions immediately, transactions submitted right after
+// subscribing could otherwise be delivered before the server has subscribed on behalf of the
+// client.
+type watchSync struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	requested   int
+	established int
+}
+
+func newWatchSync() *watchSync {
+	ws := &watchSync{}
+	ws.cond = sync.NewCond(&ws.Mutex)
+	return ws
+}
+
+func (ws *watchSync) request() {
+	ws.Lock()
+	defer ws.Unlock()
+	ws.requested++
+}
+
+func (ws *watchSync) establish() {
+	ws.Lock()
+	defer ws.Unlock()
+	ws.established++
+	ws.cond.Broadcast()
+}
+
+// wait waits until all requested subscriptions have been established.
+func (ws *watchSync) wait() {
+	ws.Lock()
+	defer ws.Unlock()
+	for ws.established < ws.requested {
+		ws.cond.Wait()
+	}
+}
+
+// watchServerBackend is the backend served over gRPC, which reports established subscriptions.
+type watchServerBackend struct {
+	*Backend
+
+	ws *watchSync
+}
+
+func (b *watchServerBackend) WatchEvents(ctx context.Context) (<-chan *api.Event, pubsub.ClosableSubscription, error) {
+	ch, sub, err := b.Backend.WatchEvents(ctx)
+	b.ws.establish()
+	return ch, sub, err
+}
+
+func (b *watchServerBackend) WatchEventsFrom(ctx context.Context, query *api.EventsWatchQuery) (<-chan *api.Event, *api.EventsSubscription, error) {
+	ch, sub, err := b.Backend.WatchEventsFrom(ctx, query)
+	b.ws.establish()
+	return ch, sub, err
+}
+
+// watchClientBackend is the gRPC client, which reports requested subscriptions. As the debug
+// controller is not exposed over gRPC, it controls the served backend directly.
+type watchClientBackend struct {
+	api.Backend
+	api.DebugController
+
+	ws *watchSync
+}
+
+func (b *watchClientBackend) WatchEvents(ctx context.Context) (<-chan *api.Event, pubsub.ClosableSubscription, error) {
+	b.ws.request()
+	return b.Backend.WatchEvents(ctx)
+}
+
+func (b *watchClientBackend) WatchEventsFrom(ctx context.Context, query *api.EventsWatchQuery) (<-chan *api.Event, *api.EventsSubscription, error) {
+	b.ws.request()
+	return b.Backend.WatchEventsFrom(ctx, query)
+}
+
+// newGrpcClient serves the given backend over an in-memory gRPC transport and returns a staking
+// client connected to it together with a test consensus backend delivering transactions to the
+// given backend.
+func newGrpcClient(t *testing.T, backend *Backend) (api.Backend, *testConsensus) {
+	require := require.New(t)
+
+	ws := newWatchSync()
+
+	grpcServer, err := cmnGrpc.NewServer(&cmnGrpc.ServerConfig{
+		Name: "staking-test",
+	})
+	require.NoError(err, "NewServer")
+	api.RegisterService(grpcServer.Server(), &watchServerBackend{backend, ws})
+
+	listener := bufconn.Listen(bufconnSize)
+	go func() {
+		_ = grpcServer.Server().Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := cmnGrpc.Dial(
+		"bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(err, "Dial")
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	client := &watchClientBackend{api.NewStakingClient(conn), backend, ws}
+	consensus := &testConsensus{backend: backend, beforeSubmit: ws.wait}
+	return client, consensus
+}
+
+func TestStakingImplementationGrpc(t *testing.T) {
+	backend := newTestBackend(t)
+	client, consensus := newGrpcClient(t, backend)
+
+	// Transactions are still delivered directly as the staking service only exposes queries.
+	stakingTests.StakingImplementationTests(t, client, consensus, nil, nil, nil, common.Namespace{})
+}
+
+func TestStakingConformanceGrpc(t *testing.T) {
+	backend := newTestBackend(t)
+	client, consensus := newGrpcClient(t, backend)
+
+	stakingTests.StakingConformanceTests(t, client, consensus, 42)
+}
+
+func TestGrpcErrors(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	client, _ := newGrpcClient(t, backend)
+
+	_, err := client.Threshold(ctx, &api.ThresholdQuery{Kind: api.ThresholdKind(-1), Height: consensusAPI.HeightLatest})
+	require.ErrorIs(err, api.ErrInvalidThreshold, "staking errors should be mapped")
+
+	_, err = client.Account(ctx, &api.OwnerQuery{Owner: stakingTests.Accounts.GetAddress(1), Height: backend.Height() + 1})
+	require.ErrorIs(err, consensusAPI.ErrVersionNotFound, "consensus errors should be mapped")
+}
+
+func TestGrpcWatchEvents(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := newTestBackend(t)
+	client, consensus := newGrpcClient(t, backend)
+	signer := stakingTests.Accounts.GetSigner(1)
+	to := stakingTests.Accounts.GetAddress(2)
+
+	ch, sub, err := client.WatchEvents(ctx)
+	require.NoError(err, "WatchEvents")
+	defer sub.Close()
+
+	xfer := &api.Transfer{
+		To:     to,
+		Amount: *quantity.NewFromUint64(10),
+	}
+	err = consensusAPI.SignAndSubmitTx(ctx, consensus, signer, api.NewTransferTx(0, nil, xfer))
+	require.NoError(err, "SignAndSubmitTx(Transfer)")
+
+	ev := <-ch
+	require.Equal((&api.TransferEvent{}).EventKind(), ev.Kind(), "event should be a transfer")
+	require.Equal(to, ev.Transfer.To, "transfer event should have the correct destination")
+	require.Equal(xfer.Amount, ev.Transfer.Amount, "transfer event should have the correct amount")
+	require.Equal(backend.Height(), ev.Height, "event should have the correct height")
+}
+
+func TestGrpcEventsQueries(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := newTestBackend(t)
+	client, consensus := newGrpcClient(t, backend)
+	signer := stakingTests.Accounts.GetSigner(1)
+	to := stakingTests.Accounts.GetAddress(2)
+
+	transfer := func(nonce uint64) {
+		xfer := &api.Transfer{
+			To:     to,
+			Amount: *quantity.NewFromUint64(10),
+		}
+		err := consensusAPI.SignAndSubmitTx(ctx, consensus, signer, api.NewTransferTx(nonce, nil, xfer))
+		require.NoError(err, "SignAndSubmitTx(Transfer)")
+	}
+	filter := api.EventFilter{
+		Kinds:   []string{(&api.TransferEvent{}).EventKind()},
+		Account: &to,
+	}
+
+	fromHeight := backend.Height() + 1
+	transfer(0)
+	transfer(1)
+
+	page, err := client.QueryEvents(ctx, &api.EventsQuery{
+		EventFilter: filter,
+		FromHeight:  fromHeight,
+		Limit:       1,
+	})
+	require.NoError(err, "QueryEvents")
+	require.Len(page.Events, 1, "page should be limited")
+	require.Equal(fromHeight, page.Events[0].Height, "first transfer should be returned")
+	require.Equal(backend.Height(), page.ToHeight, "range should end at the latest height")
+	require.NotNil(page.Next, "there should be a next page")
+
+	page, err = client.QueryEvents(ctx, &api.EventsQuery{
+		EventFilter: filter,
+		FromHeight:  fromHeight,
+		ToHeight:    page.ToHeight,
+		Cursor:      page.Next,
+		Limit:       1,
+	})
+	require.NoError(err, "QueryEvents")
+	require.Len(page.Events, 1, "page should be limited")
+	require.Equal(fromHeight+1, page.Events[0].Height, "second transfer should be returned")
+	require.Nil(page.Next, "there should be no next page")
+
+	_, err = client.QueryEvents(ctx, &api.EventsQuery{FromHeight: 0})
+	require.ErrorIs(err, api.ErrInvalidArgument, "invalid queries should fail")
+
+	ch, sub, err := client.WatchEventsFrom(ctx, &api.EventsWatchQuery{
+		EventFilter: filter,
+		FromHeight:  fromHeight,
+	})
+	require.NoError(err, "WatchEventsFrom")
+	defer sub.Close()
+
+	transfer(2)
+	for i := int64(0); i < 3; i++ {
+		ev := <-ch
+		require.Equal((&api.TransferEvent{}).EventKind(), ev.Kind(), "event should be a transfer")
+		require.Equal(fromHeight+i, ev.Height, "events should be delivered in order")
+	}
+}
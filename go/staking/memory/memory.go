@@ -0,0 +1,728 @@
+// Package memory implements an in-memory staking backend.
+//
+// The backend is intended for unit tests of components that depend on the
+// staking backend and do not want to spin up a full consensus node. Every
+// state transition (transaction, epoch transition, test credit) results in a
+// new height with its own state snapshot and list of events.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// initialHeight is the height of the genesis state.
+const initialHeight = int64(1)
+
+var (
+	_ api.Backend         = (*Backend)(nil)
+	_ api.EventSource     = (*Backend)(nil)
+	_ api.DebugController = (*Backend)(nil)
+)
+
+// Backend is an in-memory staking backend.
+type Backend struct {
+	sync.RWMutex
+
+	logger *logging.Logger
+
+	height      int64
+	epoch       beacon.EpochTime
+	minGasPrice quantity.Quantity
+	states      map[int64]*api.Genesis
+	events      map[int64][]*api.Event
+	txResults   map[hash.Hash]*api.TransactionResult
+	snapshots   map[beacon.EpochTime]*api.EscrowSnapshot
+
+	genesisHash hash.Hash
+
+	debug     bool
+	blockTime time.Time
+
+	eventNotifier *pubsub.Broker
+}
+
+// cloneState returns a deep copy of the given staking state.
+func cloneState(st *api.Genesis) *api.Genesis {
+	var clone api.Genesis
+	cbor.MustUnmarshal(cbor.Marshal(st), &clone)
+	if clone.Ledger == nil {
+		clone.Ledger = make(map[api.Address]*api.Account)
+	}
+	if clone.Delegations == nil {
+		clone.Delegations = make(map[api.Address]map[api.Address]*api.Delegation)
+	}
+	if clone.DebondingDelegations == nil {
+		clone.DebondingDelegations = make(map[api.Address]map[api.Address][]*api.DebondingDelegation)
+	}
+	return &clone
+}
+
+// sortAddresses sorts the given addresses in ascending byte order.
+func sortAddresses(addrs []api.Address) {
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+}
+
+func (b *Backend) stateAt(height int64) (*api.Genesis, error) {
+	if height == consensus.HeightLatest {
+		height = b.height
+	}
+	st, ok := b.states[height]
+	if !ok {
+		return nil, consensus.ErrVersionNotFound
+	}
+	return st, nil
+}
+
+// Height returns the latest height.
+func (b *Backend) Height() int64 {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.height
+}
+
+// Epoch returns the current epoch.
+func (b *Backend) Epoch() beacon.EpochTime {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.epoch
+}
+
+// commitLocked stores the given state and events as a new height and notifies
+// subscribers of the events in the order in which they were emitted.
+//
+// Accounts created by the state changes are recorded as created at the new
+// height. Committed states must never be modified.
+func (b *Backend) commitLocked(st *api.Genesis, events []*api.Event) {
+	events = append(events, recordCreatedAccounts(b.states[b.height], st, b.height+1)...)
+	markStateOwned(st)
+	b.height++
+	for _, ev := range events {
+		ev.Height = b.height
+	}
+	b.states[b.height] = st
+	b.events[b.height] = events
+
+	for _, ev := range events {
+		b.eventNotifier.Broadcast(ev)
+	}
+}
+
+// Implements api.Backend.
+func (b *Backend) TokenSymbol(ctx context.Context) (string, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.states[initialHeight].TokenSymbol, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) TokenValueExponent(ctx context.Context) (uint8, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.states[initialHeight].TokenValueExponent, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) TotalSupply(ctx context.Context, height int64) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return st.TotalSupply.Clone(), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) CommonPool(ctx context.Context, height int64) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	acct, _ := getReservedAccount(st, api.CommonPoolAddress)
+	return &acct.General.Balance, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) LastBlockFees(ctx context.Context, height int64) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	acct, _ := getReservedAccount(st, api.FeeAccumulatorAddress)
+	return &acct.General.Balance, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) GovernanceDeposits(ctx context.Context, height int64) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	acct, _ := getReservedAccount(st, api.GovernanceDepositsAddress)
+	return &acct.General.Balance, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) Threshold(ctx context.Context, query *api.ThresholdQuery) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	threshold, ok := st.Parameters.Thresholds[query.Kind]
+	if !ok {
+		return nil, api.ErrInvalidThreshold
+	}
+	return threshold.Clone(), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) Addresses(ctx context.Context, height int64) ([]api.Address, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return getAddresses(st), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) Account(ctx context.Context, query *api.OwnerQuery) (*api.Account, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	if acct, ok := getReservedAccount(st, query.Owner); ok {
+		return acct, nil
+	}
+	if query.Owner.Equal(api.BurnAddress) {
+		return &api.Account{}, nil
+	}
+	return getAccount(st, query.Owner), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) DelegationsFor(ctx context.Context, query *api.OwnerQuery) (map[api.Address]*api.Delegation, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	return delegationsFor(st, query.Owner), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) DelegationInfosFor(ctx context.Context, query *api.OwnerQuery) (map[api.Address]*api.DelegationInfo, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	delegations := delegationsFor(st, query.Owner)
+	infos := make(map[api.Address]*api.DelegationInfo, len(delegations))
+	for escrowAddr, del := range delegations {
+		infos[escrowAddr] = &api.DelegationInfo{
+			Delegation: *del,
+			Pool:       getAccount(st, escrowAddr).Escrow.Active,
+		}
+	}
+	return infos, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) DelegationsTo(ctx context.Context, query *api.OwnerQuery) (map[api.Address]*api.Delegation, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	delegations := make(map[api.Address]*api.Delegation)
+	for delegatorAddr, del := range st.Delegations[query.Owner] {
+		delegations[delegatorAddr] = &api.Delegation{Shares: *del.Shares.Clone()}
+	}
+	return delegations, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) DebondingDelegationsFor(ctx context.Context, query *api.OwnerQuery) (map[api.Address][]*api.DebondingDelegation, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	return debondingDelegationsFor(st, query.Owner), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) DebondingDelegationInfosFor(ctx context.Context, query *api.OwnerQuery) (map[api.Address][]*api.DebondingDelegationInfo, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	delegations := debondingDelegationsFor(st, query.Owner)
+	infos := make(map[api.Address][]*api.DebondingDelegationInfo, len(delegations))
+	for escrowAddr, debs := range delegations {
+		pool := getAccount(st, escrowAddr).Escrow.Debonding
+		for _, deb := range debs {
+			infos[escrowAddr] = append(infos[escrowAddr], &api.DebondingDelegationInfo{
+				DebondingDelegation: *deb,
+				Pool:                pool,
+			})
+		}
+	}
+	return infos, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) DebondingDelegationsTo(ctx context.Context, query *api.OwnerQuery) (map[api.Address][]*api.DebondingDelegation, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	delegations := make(map[api.Address][]*api.DebondingDelegation)
+	for delegatorAddr, debs := range st.DebondingDelegations[query.Owner] {
+		for _, deb := range debs {
+			delegations[delegatorAddr] = append(delegations[delegatorAddr], &api.DebondingDelegation{
+				Shares:        *deb.Shares.Clone(),
+				DebondEndTime: deb.DebondEndTime,
+			})
+		}
+	}
+	return delegations, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) Allowance(ctx context.Context, query *api.AllowanceQuery) (*api.Allowance, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	height := query.Height
+	if height == consensus.HeightLatest {
+		height = b.height
+	}
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return getAccount(st, query.Owner).General.GetAllowance(query.Beneficiary, height), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) Allowances(ctx context.Context, query *api.OwnerQuery) (map[api.Address]*api.Allowance, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	height := query.Height
+	if height == consensus.HeightLatest {
+		height = b.height
+	}
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return getAccount(st, query.Owner).General.GetAllowances(height), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) AccountMetadata(ctx context.Context, query *api.OwnerQuery) ([]byte, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	return getAccount(st, query.Owner).General.Metadata, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) CommissionSchedule(ctx context.Context, query *api.OwnerQuery) (*api.CommissionSchedule, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	return &getAccount(st, query.Owner).Escrow.CommissionSchedule, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) SharesToTokens(ctx context.Context, query *api.EscrowExchangeQuery) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	return getAccount(st, query.Escrow).Escrow.Active.StakeForShares(&query.Amount)
+}
+
+// Implements api.Backend.
+func (b *Backend) TokensToShares(ctx context.Context, query *api.EscrowExchangeQuery) (*quantity.Quantity, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(query.Height)
+	if err != nil {
+		return nil, err
+	}
+	return getAccount(st, query.Escrow).Escrow.Active.SharesForStake(&query.Amount)
+}
+
+// Implements api.Backend.
+func (b *Backend) EscrowSnapshot(ctx context.Context, epoch beacon.EpochTime) (*api.EscrowSnapshot, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	snapshot, ok := b.snapshots[epoch]
+	if !ok {
+		return nil, api.ErrEscrowSnapshotNotFound
+	}
+	var clone api.EscrowSnapshot
+	cbor.MustUnmarshal(cbor.Marshal(snapshot), &clone)
+	return &clone, nil
+}
+
+func (b *Backend) StateToGenesis(ctx context.Context, height int64) (*api.Genesis, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	return cloneState(st), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) ConsensusParameters(ctx context.Context, height int64) (*api.ConsensusParameters, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st, err := b.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	params := cloneState(st).Parameters
+	return &params, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) GetEvents(ctx context.Context, height int64) ([]*api.Event, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	if height == consensus.HeightLatest {
+		height = b.height
+	}
+	if _, ok := b.states[height]; !ok {
+		return nil, consensus.ErrVersionNotFound
+	}
+	events := make([]*api.Event, len(b.events[height]))
+	copy(events, b.events[height])
+	return events, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) GetTransaction(ctx context.Context, txHash hash.Hash) (*api.TransactionResult, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	// Transactions are executed immediately, so they are never pending.
+	result, ok := b.txResults[txHash]
+	if !ok {
+		return nil, api.ErrTransactionNotFound
+	}
+	events := make([]*api.Event, len(result.Events))
+	copy(events, result.Events)
+	return &api.TransactionResult{
+		Height: result.Height,
+		Error:  result.Error,
+		Events: events,
+	}, nil
+}
+
+// Implements api.Backend.
+//
+// As every state transition results in a new height, the genesis state is always processed and
+// events are always delivered to subscribers. The latest time is the timestamp set via
+// SetBlockTime.
+func (b *Backend) GetStatus(ctx context.Context) (*api.Status, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	st := b.states[b.height]
+	return &api.Status{
+		LatestHeight: b.height,
+		LatestTime:   b.blockTime,
+		GenesisHash:  b.genesisHash,
+		NumAccounts:  uint64(len(getAddresses(st))),
+		TotalSupply:  *st.TotalSupply.Clone(),
+		EventsLive:   true,
+	}, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) WatchEvents(ctx context.Context) (<-chan *api.Event, pubsub.ClosableSubscription, error) {
+	typedCh := make(chan *api.Event)
+	sub := b.eventNotifier.Subscribe()
+	sub.Unwrap(typedCh)
+
+	return typedCh, sub, nil
+}
+
+// Implements api.Backend.
+func (b *Backend) QueryEvents(ctx context.Context, query *api.EventsQuery) (*api.EventsPage, error) {
+	return api.QueryEventsFromSource(ctx, b, query)
+}
+
+// Implements api.Backend.
+func (b *Backend) WatchEventsFrom(ctx context.Context, query *api.EventsWatchQuery) (<-chan *api.Event, *api.EventsSubscription, error) {
+	return api.WatchEventsFromSource(ctx, b, query)
+}
+
+// Implements api.EventSource.
+func (b *Backend) LatestHeight(ctx context.Context) (int64, error) {
+	return b.Height(), nil
+}
+
+// Implements api.Backend.
+func (b *Backend) Cleanup() {
+}
+
+// AdvanceHeight commits empty blocks until the latest height reaches the given height.
+//
+// This is a test helper which allows dependent tests to exercise height-dependent behavior
+// (e.g., allowance expiry).
+func (b *Backend) AdvanceHeight(ctx context.Context, height int64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if height < b.height {
+		return fmt.Errorf("staking/memory: height %d is before the latest height %d", height, b.height)
+	}
+	for b.height < height {
+		b.commitLocked(cloneState(b.states[b.height]), nil)
+	}
+	return nil
+}
+
+// SetMinGasPrice sets the minimum gas price of transactions delivered via
+// DeliverTx.
+//
+// Like the node-local minimum gas price of consensus backends, transactions
+// with a lower gas price are rejected without any state changes.
+func (b *Backend) SetMinGasPrice(price *quantity.Quantity) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.minGasPrice = *price.Clone()
+}
+
+// Credit mints the given amount of base units and credits them to the general
+// balance of the given account, increasing the total supply.
+//
+// This is a test helper which allows dependent tests to set up balances
+// without signing transfers. No events other than an AccountCreatedEvent for
+// new accounts are emitted.
+func (b *Backend) Credit(ctx context.Context, addr api.Address, amount *quantity.Quantity) error {
+	if addr.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	st := cloneState(b.states[b.height])
+	acct := getAccount(st, addr)
+	if err := acct.General.Balance.Add(amount); err != nil {
+		return fmt.Errorf("staking/memory: failed to credit account: %w", err)
+	}
+	totalSupply, err := st.TotalSupply.AddQ(amount)
+	if err != nil {
+		return fmt.Errorf("staking/memory: failed to increase total supply: %w", err)
+	}
+	st.TotalSupply.Set(totalSupply)
+	setAccount(st, addr, acct)
+
+	b.commitLocked(st, nil)
+	return nil
+}
+
+// CreditEscrow mints the given amount of base units and self-delegates them
+// to the active escrow of the given account, increasing the total supply.
+//
+// This is a test helper which allows dependent tests to set up escrow balances
+// without signing transactions. No events other than an AccountCreatedEvent
+// for new accounts are emitted.
+func (b *Backend) CreditEscrow(ctx context.Context, addr api.Address, amount *quantity.Quantity) error {
+	if addr.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	st := cloneState(b.states[b.height])
+	acct := getAccount(st, addr)
+	delegation := getDelegation(st, addr, addr)
+	src := amount.Clone()
+	if _, err := acct.Escrow.Active.Deposit(&delegation.Shares, src, amount); err != nil {
+		return fmt.Errorf("staking/memory: failed to credit escrow: %w", err)
+	}
+	totalSupply, err := st.TotalSupply.AddQ(amount)
+	if err != nil {
+		return fmt.Errorf("staking/memory: failed to increase total supply: %w", err)
+	}
+	st.TotalSupply.Set(totalSupply)
+	setAccount(st, addr, acct)
+	setDelegation(st, addr, addr, delegation)
+
+	b.commitLocked(st, nil)
+	return nil
+}
+
+// TakeEscrow slashes up to the given amount of base units from the active and
+// debonding escrow of the given account, moving them to the common pool. The
+// amount is split between the pools based on their relative balances, the
+// same as when slashing in the consensus backend. Shares are left intact, so
+// the value of each share drops.
+//
+// This is a test helper which allows dependent tests to exercise slashing
+// without a consensus backend. A TakeEscrowEvent is emitted.
+func (b *Backend) TakeEscrow(ctx context.Context, addr api.Address, amount *quantity.Quantity) (*quantity.Quantity, error) {
+	if addr.IsReserved() {
+		return nil, api.ErrForbidden
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	st := cloneState(b.states[b.height])
+	acct := getAccount(st, addr)
+
+	total := acct.Escrow.Active.Balance.Clone()
+	if err := total.Add(&acct.Escrow.Debonding.Balance); err != nil {
+		return nil, fmt.Errorf("staking/memory: failed to compute escrow balance: %w", err)
+	}
+	var slashed quantity.Quantity
+	for _, pool := range []*api.SharePool{&acct.Escrow.Active, &acct.Escrow.Debonding} {
+		if err := slashPool(&slashed, pool, amount, total); err != nil {
+			return nil, fmt.Errorf("staking/memory: failed to slash escrow: %w", err)
+		}
+	}
+	commonPool, err := st.CommonPool.AddQ(&slashed)
+	if err != nil {
+		return nil, fmt.Errorf("staking/memory: failed to move slashed stake: %w", err)
+	}
+	st.CommonPool.Set(commonPool)
+	totalSlashed := &slashed
+	setAccount(st, addr, acct)
+
+	var events []*api.Event
+	if !totalSlashed.IsZero() {
+		events = append(events, &api.Event{Escrow: &api.EscrowEvent{Take: &api.TakeEscrowEvent{
+			Owner:  addr,
+			Amount: *totalSlashed,
+		}}})
+	}
+
+	b.commitLocked(st, events)
+	return totalSlashed, nil
+}
+
+// New creates a new in-memory staking backend populated from the given
+// genesis state.
+//
+// The genesis state is stored at height 1 and the current epoch is set to
+// the given base epoch.
+func New(genesis *api.Genesis, baseEpoch beacon.EpochTime) (*Backend, error) {
+	if err := genesis.SanityCheck(baseEpoch); err != nil {
+		return nil, fmt.Errorf("staking/memory: invalid genesis state: %w", err)
+	}
+
+	st := cloneState(genesis)
+	// Move any last block fees into the common pool, as there is no previous block.
+	commonPool, err := st.CommonPool.AddQ(&st.LastBlockFees)
+	if err != nil {
+		return nil, fmt.Errorf("staking/memory: failed to add block fees to common pool: %w", err)
+	}
+	st.CommonPool.Set(commonPool)
+	st.LastBlockFees.Set(quantity.NewQuantity())
+	for _, acct := range st.Ledger {
+		if acct.General.CreatedAt == 0 {
+			acct.General.CreatedAt = initialHeight
+		}
+	}
+	markStateOwned(st)
+
+	return &Backend{
+		logger: logging.GetLogger("staking/memory"),
+		height: initialHeight,
+		epoch:  baseEpoch,
+		states: map[int64]*api.Genesis{
+			initialHeight: st,
+		},
+		events: map[int64][]*api.Event{
+			initialHeight: nil,
+		},
+		txResults:     make(map[hash.Hash]*api.TransactionResult),
+		snapshots:     make(map[beacon.EpochTime]*api.EscrowSnapshot),
+		genesisHash:   hash.NewFrom(genesis),
+		eventNotifier: pubsub.NewBroker(false),
+	}, nil
+}
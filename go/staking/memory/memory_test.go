@@ -0,0 +1,858 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	memorySigner "github.com/oasisprotocol/oasis-core/go/common/crypto/signature/signers/memory"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	consensusAPI "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+	stakingTests "github.com/oasisprotocol/oasis-core/go/staking/tests"
+)
+
+// testConsensus is a minimal consensus backend that delivers staking
+// transactions directly to the in-memory staking backend.
+type testConsensus struct {
+	// Embedded so that the type satisfies the interface, unused methods panic.
+	consensusAPI.Backend
+
+	backend *Backend
+
+	// beforeSubmit is an optional hook called before each transaction is delivered.
+	beforeSubmit func()
+}
+
+func (c *testConsensus) SubmissionManager() consensusAPI.SubmissionManager {
+	return &testSubmissionManager{c.backend, c.beforeSubmit}
+}
+
+func (c *testConsensus) EstimateGas(ctx context.Context, req *consensusAPI.EstimateGasRequest) (transaction.Gas, error) {
+	return c.backend.EstimateGas(ctx, req.Transaction)
+}
+
+func (c *testConsensus) SubmitTx(ctx context.Context, tx *transaction.SignedTransaction) error {
+	if c.beforeSubmit != nil {
+		c.beforeSubmit()
+	}
+	return c.backend.DeliverSignedTx(ctx, tx)
+}
+
+type testSubmissionManager struct {
+	backend      *Backend
+	beforeSubmit func()
+}
+
+func (m *testSubmissionManager) PriceDiscovery() consensusAPI.PriceDiscovery {
+	return nil
+}
+
+func (m *testSubmissionManager) EstimateGasAndSetFee(ctx context.Context, signer signature.Signer, tx *transaction.Transaction) error {
+	gas, err := m.backend.EstimateGas(ctx, tx)
+	if err != nil {
+		return err
+	}
+	tx.Fee = &transaction.Fee{Gas: gas}
+	return nil
+}
+
+func (m *testSubmissionManager) SignAndSubmitTx(ctx context.Context, signer signature.Signer, tx *transaction.Transaction) error {
+	if m.beforeSubmit != nil {
+		m.beforeSubmit()
+	}
+
+	acct, err := m.backend.Account(ctx, &api.OwnerQuery{
+		Owner:  api.NewAddress(signer.Public()),
+		Height: consensusAPI.HeightLatest,
+	})
+	if err != nil {
+		return err
+	}
+	tx.Nonce = acct.General.Nonce
+	if tx.Fee == nil {
+		if err = m.EstimateGasAndSetFee(ctx, signer, tx); err != nil {
+			return err
+		}
+	}
+
+	sigTx, err := transaction.Sign(signer, tx)
+	if err != nil {
+		return err
+	}
+	return m.backend.DeliverSignedTx(ctx, sigTx)
+}
+
+func newTestBackend(t *testing.T) *Backend {
+	genesis := stakingTests.GenesisState()
+	return newTestBackendWithGenesis(t, &genesis)
+}
+
+func newTestBackendWithGenesis(t *testing.T, genesis *api.Genesis) *Backend {
+	// Transactions submitted via the test consensus backend are signed.
+	signature.SetChainContext("test: oasis-core tests")
+
+	backend, err := New(genesis, 0)
+	require.NoError(t, err, "New")
+	backend.EnableDebugController()
+	return backend
+}
+
+func TestGenesisStateSanityCheck(t *testing.T) {
+	genesis := stakingTests.GenesisState()
+	require.NoError(t, genesis.SanityCheck(0), "debug genesis state should be valid")
+}
+
+func TestStakingImplementation(t *testing.T) {
+	// Make transfers cost gas so that the fee tests also cover running out of gas.
+	genesis := stakingTests.GenesisState()
+	genesis.Parameters.GasCosts = transaction.Costs{
+		api.GasOpTransfer: 10,
+	}
+	backend := newTestBackendWithGenesis(t, &genesis)
+	stakingTests.StakingImplementationTests(t, backend, &testConsensus{backend: backend}, nil, nil, nil, common.Namespace{})
+}
+
+func TestMinGasPrice(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	backend.SetMinGasPrice(quantity.NewFromUint64(1))
+
+	signer := stakingTests.Accounts.GetSigner(1)
+	srcAddr := stakingTests.Accounts.GetAddress(1)
+	xfer := &api.Transfer{
+		To:     stakingTests.Accounts.GetAddress(2),
+		Amount: *quantity.NewFromUint64(100),
+	}
+
+	// Gas price below the minimum should be rejected without any state changes.
+	acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: srcAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	height := backend.Height()
+	err = backend.DeliverTx(ctx, signer.Public(), api.NewTransferTx(0, &transaction.Fee{
+		Amount: *quantity.NewFromUint64(5),
+		Gas:    10,
+	}, xfer))
+	require.ErrorIs(err, transaction.ErrGasPriceTooLow, "DeliverTx with gas price too low")
+	require.Equal(height, backend.Height(), "rejected transaction should not be included")
+	newAcct, err := backend.Account(ctx, &api.OwnerQuery{Owner: srcAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(acct, newAcct, "rejected transaction should not change the account")
+
+	// Gas price at the minimum should be accepted.
+	err = backend.DeliverTx(ctx, signer.Public(), api.NewTransferTx(0, &transaction.Fee{
+		Amount: *quantity.NewFromUint64(10),
+		Gas:    10,
+	}, xfer))
+	require.NoError(err, "DeliverTx")
+}
+
+func TestStakingConformance(t *testing.T) {
+	backend := newTestBackend(t)
+	stakingTests.StakingConformanceTests(t, backend, &testConsensus{backend: backend}, 42)
+}
+
+func TestMinAccountBalance(t *testing.T) {
+	for _, reap := range []bool{false, true} {
+		genesis := stakingTests.GenesisState()
+		genesis.Parameters.MinAccountBalance = *quantity.NewFromUint64(100)
+		genesis.Parameters.ReapDustAccounts = reap
+		backend, err := New(&genesis, 0)
+		require.NoError(t, err, "New")
+
+		stakingTests.StakingMinAccountBalanceTests(t, backend, &testConsensus{backend: backend})
+	}
+}
+
+func TestDisableTransfers(t *testing.T) {
+	// Transactions submitted via the test consensus backend are signed.
+	signature.SetChainContext("test: oasis-core tests")
+
+	genesis := stakingTests.GenesisState()
+	genesis.Parameters.DisableTransfers = true
+	genesis.Parameters.UndisableTransfersFrom = map[api.Address]bool{
+		stakingTests.Accounts.GetAddress(1): true,
+	}
+	backend, err := New(&genesis, 0)
+	require.NoError(t, err, "New")
+
+	stakingTests.StakingDisableTransfersTests(t, backend, &testConsensus{backend: backend})
+}
+
+func TestCredit(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	addr := stakingTests.Accounts.GetAddress(2)
+	amount := quantity.NewFromUint64(1000)
+
+	totalSupply, err := backend.TotalSupply(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "TotalSupply")
+	height := backend.Height()
+
+	err = backend.Credit(ctx, addr, amount)
+	require.NoError(err, "Credit")
+	err = backend.CreditEscrow(ctx, addr, amount)
+	require.NoError(err, "CreditEscrow")
+	err = backend.Credit(ctx, api.CommonPoolAddress, amount)
+	require.ErrorIs(err, api.ErrForbidden, "Credit should fail for reserved addresses")
+
+	acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(*amount, acct.General.Balance, "general balance should be credited")
+	require.Equal(*amount, acct.Escrow.Active.Balance, "escrow balance should be credited")
+
+	dels, err := backend.DelegationsTo(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "DelegationsTo")
+	require.Len(dels, 1, "escrow credit should be self-delegated")
+	require.Equal(acct.Escrow.Active.TotalShares, dels[addr].Shares, "self-delegation should hold all shares")
+
+	newTotalSupply, err := backend.TotalSupply(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "TotalSupply")
+	require.NoError(totalSupply.Add(amount))
+	require.NoError(totalSupply.Add(amount))
+	require.Equal(totalSupply, newTotalSupply, "total supply should increase")
+
+	// Historic state should remain unchanged.
+	acct, err = backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: height})
+	require.NoError(err, "Account")
+	require.True(acct.General.Balance.IsZero(), "historic general balance should be unchanged")
+
+	_, err = backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: backend.Height() + 1})
+	require.ErrorIs(err, consensusAPI.ErrVersionNotFound, "future heights should not be available")
+
+	// Genesis export should be consistent.
+	genesis, err := backend.StateToGenesis(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "StateToGenesis")
+	require.NoError(genesis.SanityCheck(backend.Epoch()), "exported genesis should be valid")
+}
+
+func TestReservedAccountsGenesis(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// Move some of the common pool balance into the other reserved accounts.
+	genesis := stakingTests.GenesisState()
+	require.NoError(quantity.Move(&genesis.LastBlockFees, &genesis.CommonPool, quantity.NewFromUint64(100)))
+	require.NoError(quantity.Move(&genesis.GovernanceDeposits, &genesis.CommonPool, quantity.NewFromUint64(10)))
+	require.NoError(genesis.SanityCheck(0), "genesis with reserved balances should be valid")
+	backend, err := New(&genesis, 0)
+	require.NoError(err, "New")
+
+	// Reserved balances should be imported into the reserved accounts. Last block fees are moved
+	// into the common pool as there is no previous block.
+	expectedCommonPool, err := genesis.CommonPool.AddQ(&genesis.LastBlockFees)
+	require.NoError(err, "AddQ")
+	addrs, err := backend.Addresses(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "Addresses")
+	require.Len(addrs, len(genesis.Ledger)+2, "Addresses should include non-empty reserved accounts")
+	require.NotContains(addrs, api.FeeAccumulatorAddress, "Addresses should not include empty reserved accounts")
+	for addr, expected := range map[api.Address]*quantity.Quantity{
+		api.CommonPoolAddress:         expectedCommonPool,
+		api.FeeAccumulatorAddress:     quantity.NewQuantity(),
+		api.GovernanceDepositsAddress: &genesis.GovernanceDeposits,
+	} {
+		acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+		require.Equal(*expected, acct.General.Balance, "reserved account %s balance", addr)
+	}
+	commonPool, err := backend.CommonPool(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "CommonPool")
+	require.Equal(expectedCommonPool, commonPool, "CommonPool should match the common pool account")
+
+	status, err := backend.GetStatus(ctx)
+	require.NoError(err, "GetStatus")
+	require.EqualValues(len(addrs), status.NumAccounts, "GetStatus - number of accounts")
+
+	// Reserved balances should be exported outside of the ledger and survive a round-trip.
+	exported, err := backend.StateToGenesis(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "StateToGenesis")
+	require.NoError(exported.SanityCheck(0), "exported genesis should be valid")
+	for _, addr := range api.ReservedAccountAddresses {
+		require.NotContains(exported.Ledger, addr, "exported ledger should not contain reserved account %s", addr)
+	}
+	require.Equal(*expectedCommonPool, exported.CommonPool, "exported common pool")
+	require.True(exported.LastBlockFees.IsZero(), "exported last block fees")
+	require.Equal(genesis.GovernanceDeposits, exported.GovernanceDeposits, "exported governance deposits")
+
+	reimported, err := New(exported, 0)
+	require.NoError(err, "New - exported genesis")
+	reimportedAddrs, err := reimported.Addresses(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "Addresses - reimported")
+	require.Equal(addrs, reimportedAddrs, "reimported addresses should match")
+}
+
+func TestEscrowShares(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	escrowAddr := stakingTests.Accounts.GetAddress(2)
+	delegator1 := stakingTests.Accounts.GetSigner(1)
+	delegator1Addr := stakingTests.Accounts.GetAddress(1)
+	delegator2 := stakingTests.Accounts.GetSigner(3)
+	delegator2Addr := stakingTests.Accounts.GetAddress(3)
+
+	exchange := func(fn func(context.Context, *api.EscrowExchangeQuery) (*quantity.Quantity, error), amount uint64) *quantity.Quantity {
+		q, err := fn(ctx, &api.EscrowExchangeQuery{
+			Height: consensusAPI.HeightLatest,
+			Escrow: escrowAddr,
+			Amount: *quantity.NewFromUint64(amount),
+		})
+		require.NoError(err, "exchange query")
+		return q
+	}
+	generalBalance := func(addr api.Address) quantity.Quantity {
+		acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+		return acct.General.Balance
+	}
+
+	// Without any shares, the exchange rate is 1:1.
+	require.Equal(quantity.NewFromUint64(1000), exchange(backend.TokensToShares, 1000), "TokensToShares on empty pool")
+
+	// Two delegators escrow 1000 and 500 base units, obtaining shares at a 1:1 rate.
+	err := backend.DeliverTx(ctx, delegator1.Public(), api.NewAddEscrowTx(0, nil, &api.Escrow{
+		Account: escrowAddr,
+		Amount:  *quantity.NewFromUint64(1000),
+	}))
+	require.NoError(err, "DeliverTx(AddEscrow)")
+	err = backend.DeliverTx(ctx, delegator2.Public(), api.NewAddEscrowTx(0, nil, &api.Escrow{
+		Account: escrowAddr,
+		Amount:  *quantity.NewFromUint64(500),
+	}))
+	require.NoError(err, "DeliverTx(AddEscrow)")
+	evs, err := backend.GetEvents(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "GetEvents")
+	require.Len(evs, 1, "AddEscrow should emit a single event")
+	require.Equal(*quantity.NewFromUint64(500), evs[0].Escrow.Add.Amount, "AddEscrowEvent amount")
+	require.Equal(*quantity.NewFromUint64(500), evs[0].Escrow.Add.NewShares, "AddEscrowEvent shares")
+
+	// Slashing reduces the balance of the pool, but not the shares.
+	slashed, err := backend.TakeEscrow(ctx, escrowAddr, quantity.NewFromUint64(301))
+	require.NoError(err, "TakeEscrow")
+	require.Equal(quantity.NewFromUint64(301), slashed, "TakeEscrow should slash the full amount")
+	evs, err = backend.GetEvents(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "GetEvents")
+	require.Len(evs, 1, "TakeEscrow should emit a single event")
+	require.Equal(&api.TakeEscrowEvent{Owner: escrowAddr, Amount: *slashed}, evs[0].Escrow.Take, "TakeEscrowEvent")
+
+	acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: escrowAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(1199), acct.Escrow.Active.Balance, "active balance after slashing")
+	require.Equal(*quantity.NewFromUint64(1500), acct.Escrow.Active.TotalShares, "total shares after slashing")
+
+	// Conversions round down: 1000 * 1199 / 1500 = 799.33, 500 * 1199 / 1500 = 399.67 and
+	// 100 * 1500 / 1199 = 125.10.
+	require.Equal(quantity.NewFromUint64(799), exchange(backend.SharesToTokens, 1000), "SharesToTokens after slashing")
+	require.Equal(quantity.NewFromUint64(399), exchange(backend.SharesToTokens, 500), "SharesToTokens after slashing")
+	require.Equal(quantity.NewFromUint64(125), exchange(backend.TokensToShares, 100), "TokensToShares after slashing")
+
+	// Reclaims receive the rounded down amounts, so the last reclaim gets what remains.
+	err = backend.DeliverTx(ctx, delegator2.Public(), api.NewReclaimEscrowTx(1, nil, &api.ReclaimEscrow{
+		Account: escrowAddr,
+		Shares:  *quantity.NewFromUint64(500),
+	}))
+	require.NoError(err, "DeliverTx(ReclaimEscrow)")
+	evs, err = backend.GetEvents(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "GetEvents")
+	require.Equal(*quantity.NewFromUint64(399), evs[0].Escrow.DebondingStart.Amount, "DebondingStartEscrowEvent amount")
+	require.Equal(*quantity.NewFromUint64(500), evs[0].Escrow.DebondingStart.ActiveShares, "DebondingStartEscrowEvent active shares")
+
+	require.Equal(quantity.NewFromUint64(800), exchange(backend.SharesToTokens, 1000), "SharesToTokens after reclaim")
+	err = backend.DeliverTx(ctx, delegator1.Public(), api.NewReclaimEscrowTx(1, nil, &api.ReclaimEscrow{
+		Account: escrowAddr,
+		Shares:  *quantity.NewFromUint64(1000),
+	}))
+	require.NoError(err, "DeliverTx(ReclaimEscrow)")
+
+	acct, err = backend.Account(ctx, &api.OwnerQuery{Owner: escrowAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.True(acct.Escrow.Active.Balance.IsZero(), "active balance should be fully reclaimed")
+	require.True(acct.Escrow.Active.TotalShares.IsZero(), "active shares should be fully reclaimed")
+	require.Equal(*quantity.NewFromUint64(1199), acct.Escrow.Debonding.Balance, "debonding balance")
+
+	// Once debonding completes, delegators receive exactly the debonded amounts.
+	balance1, balance2 := generalBalance(delegator1Addr), generalBalance(delegator2Addr)
+	err = backend.SetEpoch(ctx, backend.Epoch()+1)
+	require.NoError(err, "SetEpoch")
+	evs, err = backend.GetEvents(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "GetEvents")
+	reclaimed := make(map[api.Address]*api.ReclaimEscrowEvent)
+	for _, ev := range evs {
+		if ev.Escrow != nil && ev.Escrow.Reclaim != nil {
+			reclaimed[ev.Escrow.Reclaim.Owner] = ev.Escrow.Reclaim
+		}
+	}
+	require.Len(reclaimed, 2, "both delegators should reclaim")
+
+	for _, tc := range []struct {
+		addr    api.Address
+		before  quantity.Quantity
+		amount  uint64
+		shares  uint64
+		message string
+	}{
+		// Debonding shares are obtained 1:1 as the debonding pool was not slashed.
+		{delegator1Addr, balance1, 800, 800, "first delegator"},
+		{delegator2Addr, balance2, 399, 399, "second delegator"},
+	} {
+		require.Equal(*quantity.NewFromUint64(tc.amount), reclaimed[tc.addr].Amount, "%s: reclaimed amount", tc.message)
+		require.Equal(*quantity.NewFromUint64(tc.shares), reclaimed[tc.addr].Shares, "%s: reclaimed shares", tc.message)
+		require.NoError(tc.before.Add(quantity.NewFromUint64(tc.amount)))
+		require.Equal(tc.before, generalBalance(tc.addr), "%s: general balance", tc.message)
+	}
+}
+
+func TestDeliverTxEventOrdering(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	signer := stakingTests.Accounts.GetSigner(1)
+
+	ch, sub, err := backend.WatchEvents(ctx)
+	require.NoError(err, "WatchEvents")
+	defer sub.Close()
+
+	var expected []api.Address
+	for i := 2; i <= stakingTests.NumAccounts; i++ {
+		to := stakingTests.Accounts.GetAddress(i)
+		tx := api.NewTransferTx(uint64(i-2), &transaction.Fee{Amount: *quantity.NewFromUint64(1)}, &api.Transfer{
+			To:     to,
+			Amount: *quantity.NewFromUint64(10),
+		})
+		err = backend.DeliverTx(ctx, signer.Public(), tx)
+		require.NoError(err, "DeliverTx")
+		expected = append(expected, api.FeeAccumulatorAddress, to, api.CommonPoolAddress)
+	}
+
+	// Invalid nonce.
+	tx := api.NewTransferTx(0, nil, &api.Transfer{To: stakingTests.Accounts.GetAddress(2)})
+	err = backend.DeliverTx(ctx, signer.Public(), tx)
+	require.ErrorIs(err, transaction.ErrInvalidNonce, "DeliverTx with invalid nonce")
+
+	var lastHeight int64
+	for _, to := range expected {
+		ev := <-ch
+		if ev.AccountCreated != nil {
+			// Each destination account is created by the transfer into it.
+			require.Equal(api.CommonPoolAddress, to, "account creation should precede the fee disbursement")
+			require.True(ev.Height >= lastHeight, "event heights should be non-decreasing")
+			ev = <-ch
+		}
+		require.NotNil(ev.Transfer, "event should be a transfer event")
+		require.Equal(to, ev.Transfer.To, "events should be received in order")
+		require.True(ev.Height >= lastHeight, "event heights should be non-decreasing")
+		if !ev.Transfer.From.Equal(api.FeeAccumulatorAddress) {
+			require.False(ev.TxHash.IsEmpty(), "event should include the transaction hash")
+		}
+		lastHeight = ev.Height
+	}
+
+	evs, err := backend.GetEvents(ctx, lastHeight)
+	require.NoError(err, "GetEvents")
+	require.Len(evs, 3, "GetEvents should return the fee, transfer and fee disbursement events")
+}
+
+func TestWatchEventsOrdering(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	signer := stakingTests.Accounts.GetSigner(1)
+	to := stakingTests.Accounts.GetAddress(2)
+
+	ch, sub, err := backend.WatchEvents(ctx)
+	require.NoError(err, "WatchEvents")
+	defer sub.Close()
+
+	err = backend.DeliverTx(ctx, signer.Public(), api.NewTransferTx(0, nil, &api.Transfer{
+		To:     to,
+		Amount: *quantity.NewFromUint64(10),
+	}))
+	require.NoError(err, "DeliverTx(Transfer)")
+	err = backend.DeliverTx(ctx, signer.Public(), api.NewBurnTx(1, nil, &api.Burn{
+		Amount: *quantity.NewFromUint64(5),
+	}))
+	require.NoError(err, "DeliverTx(Burn)")
+
+	ev := <-ch
+	require.Equal((&api.TransferEvent{}).EventKind(), ev.Kind(), "first event should be a transfer")
+	require.Equal(to, ev.Transfer.To, "transfer event should have the correct destination")
+	transferHeight := ev.Height
+
+	ev = <-ch
+	require.Equal((&api.AccountCreatedEvent{}).EventKind(), ev.Kind(), "second event should be the account creation")
+	require.Equal(to, ev.AccountCreated.Account, "created account should be the transfer destination")
+
+	ev = <-ch
+	require.Equal((&api.BurnEvent{}).EventKind(), ev.Kind(), "third event should be a burn")
+	require.Equal(*quantity.NewFromUint64(5), ev.Burn.Amount, "burn event should have the correct amount")
+	require.True(ev.Height > transferHeight, "burn should be delivered after the transfer")
+}
+
+func TestAllowanceExpiry(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	owner := stakingTests.Accounts.GetSigner(1)
+	ownerAddr := stakingTests.Accounts.GetAddress(1)
+	beneficiary := stakingTests.Accounts.GetSigner(2)
+	beneficiaryAddr := stakingTests.Accounts.GetAddress(2)
+
+	// Expiry must not be in the past.
+	err := backend.DeliverTx(ctx, owner.Public(), api.NewAllowTx(0, nil, &api.Allow{
+		Beneficiary:  beneficiaryAddr,
+		AmountChange: *quantity.NewFromUint64(100),
+		Expiry:       backend.Height(),
+	}))
+	require.ErrorIs(err, api.ErrInvalidArgument, "DeliverTx(Allow) with expiry in the past")
+
+	expiry := backend.Height() + 5
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAllowTx(1, nil, &api.Allow{
+		Beneficiary:  beneficiaryAddr,
+		AmountChange: *quantity.NewFromUint64(100),
+		Expiry:       expiry,
+	}))
+	require.NoError(err, "DeliverTx(Allow)")
+
+	query := &api.AllowanceQuery{
+		Owner:       ownerAddr,
+		Beneficiary: beneficiaryAddr,
+		Height:      consensusAPI.HeightLatest,
+	}
+	allowance, err := backend.Allowance(ctx, query)
+	require.NoError(err, "Allowance")
+	require.Equal(*quantity.NewFromUint64(100), allowance.Amount, "allowance amount")
+	require.Equal(expiry, allowance.Expiry, "allowance expiry")
+
+	// Changing the allowance without an expiry should keep the existing expiry.
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAllowTx(2, nil, &api.Allow{
+		Beneficiary:  beneficiaryAddr,
+		Negative:     true,
+		AmountChange: *quantity.NewFromUint64(50),
+	}))
+	require.NoError(err, "DeliverTx(Allow) without expiry")
+
+	allowance, err = backend.Allowance(ctx, query)
+	require.NoError(err, "Allowance")
+	require.Equal(*quantity.NewFromUint64(50), allowance.Amount, "allowance amount")
+	require.Equal(expiry, allowance.Expiry, "allowance expiry should be kept")
+
+	// A negative expiry should remove the existing expiry, which can then be set again.
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAllowTx(3, nil, &api.Allow{
+		Beneficiary: beneficiaryAddr,
+		Expiry:      -1,
+	}))
+	require.NoError(err, "DeliverTx(Allow) with negative expiry")
+
+	allowance, err = backend.Allowance(ctx, query)
+	require.NoError(err, "Allowance")
+	require.Equal(*quantity.NewFromUint64(50), allowance.Amount, "allowance amount")
+	require.Zero(allowance.Expiry, "allowance expiry should be removed")
+
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAllowTx(4, nil, &api.Allow{
+		Beneficiary: beneficiaryAddr,
+		Expiry:      expiry,
+	}))
+	require.NoError(err, "DeliverTx(Allow) with expiry")
+
+	// Withdrawal at the expiry height should still succeed.
+	err = backend.AdvanceHeight(ctx, expiry-1)
+	require.NoError(err, "AdvanceHeight")
+	err = backend.DeliverTx(ctx, beneficiary.Public(), api.NewWithdrawTx(0, nil, &api.Withdraw{
+		From:   ownerAddr,
+		Amount: *quantity.NewFromUint64(10),
+	}))
+	require.NoError(err, "DeliverTx(Withdraw) at expiry height")
+	require.Equal(expiry, backend.Height(), "withdrawal should be included at the expiry height")
+
+	allowance, err = backend.Allowance(ctx, query)
+	require.NoError(err, "Allowance")
+	require.Equal(*quantity.NewFromUint64(40), allowance.Amount, "allowance amount after withdrawal")
+	require.Equal(expiry, allowance.Expiry, "withdrawal should not change the allowance expiry")
+
+	// Withdrawal past the expiry height should fail.
+	err = backend.AdvanceHeight(ctx, expiry+1)
+	require.NoError(err, "AdvanceHeight")
+	err = backend.DeliverTx(ctx, beneficiary.Public(), api.NewWithdrawTx(1, nil, &api.Withdraw{
+		From:   ownerAddr,
+		Amount: *quantity.NewFromUint64(10),
+	}))
+	require.ErrorIs(err, api.ErrAllowanceExpired, "DeliverTx(Withdraw) past expiry height")
+
+	allowance, err = backend.Allowance(ctx, query)
+	require.NoError(err, "Allowance")
+	require.True(allowance.Amount.IsZero(), "expired allowance should read as zero")
+	require.Zero(allowance.Expiry, "expired allowance should have no expiry")
+
+	allowance, err = backend.Allowance(ctx, &api.AllowanceQuery{
+		Owner:       ownerAddr,
+		Beneficiary: beneficiaryAddr,
+		Height:      expiry,
+	})
+	require.NoError(err, "Allowance")
+	require.Equal(*quantity.NewFromUint64(40), allowance.Amount, "historic allowance should be unchanged")
+
+	// Expired allowances should be garbage collected when the owner's allowances are updated.
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAllowTx(5, nil, &api.Allow{
+		Beneficiary:  stakingTests.Accounts.GetAddress(3),
+		AmountChange: *quantity.NewFromUint64(100),
+	}))
+	require.NoError(err, "DeliverTx(Allow)")
+
+	acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: ownerAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.NotContains(acct.General.Allowances, beneficiaryAddr, "expired allowance should be removed")
+	require.Empty(acct.General.AllowanceExpiries, "expired allowance expiry should be removed")
+	require.Len(acct.General.Allowances, 1, "other allowances should be kept")
+}
+
+func TestEscrowSnapshot(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	genesis := stakingTests.GenesisState()
+	genesis.Parameters.EscrowSnapshotRetention = 2
+	backend, err := New(&genesis, 0)
+	require.NoError(err, "New")
+	addr := stakingTests.Accounts.GetAddress(2)
+
+	_, err = backend.EscrowSnapshot(ctx, 1)
+	require.ErrorIs(err, api.ErrEscrowSnapshotNotFound, "EscrowSnapshot should fail for missing snapshots")
+
+	err = backend.CreditEscrow(ctx, addr, quantity.NewFromUint64(1000))
+	require.NoError(err, "CreditEscrow")
+	err = backend.SetEpoch(ctx, 1)
+	require.NoError(err, "SetEpoch")
+
+	snapshot, err := backend.EscrowSnapshot(ctx, 1)
+	require.NoError(err, "EscrowSnapshot")
+	require.EqualValues(1, snapshot.Epoch, "snapshot epoch")
+	require.Equal(*quantity.NewFromUint64(1000), snapshot.Escrow[addr].Balance, "snapshot should contain the active escrow balance")
+
+	// Changing balances after the snapshot should not affect it.
+	err = backend.CreditEscrow(ctx, addr, quantity.NewFromUint64(1000))
+	require.NoError(err, "CreditEscrow")
+	snapshot, err = backend.EscrowSnapshot(ctx, 1)
+	require.NoError(err, "EscrowSnapshot")
+	require.Equal(*quantity.NewFromUint64(1000), snapshot.Escrow[addr].Balance, "snapshot should be unaffected by later changes")
+
+	err = backend.SetEpoch(ctx, 2)
+	require.NoError(err, "SetEpoch")
+	snapshot, err = backend.EscrowSnapshot(ctx, 2)
+	require.NoError(err, "EscrowSnapshot")
+	require.Equal(*quantity.NewFromUint64(2000), snapshot.Escrow[addr].Balance, "new snapshot should reflect the changes")
+
+	// Snapshots outside of the retention window should be pruned.
+	err = backend.SetEpoch(ctx, 3)
+	require.NoError(err, "SetEpoch")
+	_, err = backend.EscrowSnapshot(ctx, 1)
+	require.ErrorIs(err, api.ErrEscrowSnapshotNotFound, "snapshots outside of the retention window should be pruned")
+	_, err = backend.EscrowSnapshot(ctx, 2)
+	require.NoError(err, "EscrowSnapshot")
+}
+
+func TestDebugController(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	genesis := stakingTests.GenesisState()
+	backend, err := New(&genesis, 0)
+	require.NoError(err, "New")
+
+	_, err = backend.AdvanceEpoch(ctx, 1)
+	require.ErrorIs(err, api.ErrDebugControllerDisabled, "AdvanceEpoch should fail unless enabled")
+	err = backend.SetBlockTime(time.Unix(1000, 0))
+	require.ErrorIs(err, api.ErrDebugControllerDisabled, "SetBlockTime should fail unless enabled")
+	require.EqualValues(0, backend.Epoch(), "epoch should be unchanged")
+
+	backend.EnableDebugController()
+	height := backend.Height()
+	epoch, err := backend.AdvanceEpoch(ctx, 0)
+	require.NoError(err, "AdvanceEpoch")
+	require.EqualValues(0, epoch, "advancing by zero epochs should return the current epoch")
+	require.Equal(height, backend.Height(), "advancing by zero epochs should not commit a block")
+
+	epoch, err = backend.AdvanceEpoch(ctx, 3)
+	require.NoError(err, "AdvanceEpoch")
+	require.EqualValues(3, epoch, "epoch after advancing")
+	require.EqualValues(3, backend.Epoch(), "epoch after advancing")
+	require.Equal(height+3, backend.Height(), "each epoch transition should commit a block")
+
+	err = backend.SetBlockTime(time.Unix(1000, 0))
+	require.NoError(err, "SetBlockTime")
+	require.True(backend.BlockTime().Equal(time.Unix(1000, 0)), "block time should be set")
+}
+
+func TestMultiSig(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	backend := newTestBackend(t)
+	owner := stakingTests.Accounts.GetSigner(1)
+	ownerAddr := stakingTests.Accounts.GetAddress(1)
+	dstAddr := stakingTests.Accounts.GetAddress(2)
+
+	var members []signature.Signer
+	for _, seed := range []string{"multisig member 1", "multisig member 2", "multisig member 3"} {
+		members = append(members, memorySigner.NewTestSigner(seed))
+	}
+	outsider := memorySigner.NewTestSigner("multisig outsider")
+	descriptor := &api.MultiSigDescriptor{
+		Threshold: 2,
+	}
+	for _, m := range members {
+		descriptor.Signers = append(descriptor.Signers, m.Public())
+	}
+
+	// Multi-signed transactions are rejected for single-key accounts.
+	xfer := &api.Transfer{To: dstAddr, Amount: *quantity.NewFromUint64(10)}
+	sigTx, err := api.SignMultiSigTransaction(members[:2], ownerAddr, api.NewTransferTx(0, nil, xfer))
+	require.NoError(err, "SignMultiSigTransaction")
+	err = backend.DeliverMultiSignedTx(ctx, sigTx)
+	require.ErrorIs(err, api.ErrInvalidMultiSig, "DeliverMultiSignedTx for a single-key account")
+
+	// Invalid descriptors are rejected.
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAccountUpdateTx(0, nil, &api.AccountUpdate{
+		MultiSig: &api.MultiSigDescriptor{Signers: descriptor.Signers, Threshold: 4},
+	}))
+	require.ErrorIs(err, api.ErrInvalidArgument, "DeliverTx(AccountUpdate) with an invalid descriptor")
+
+	// Convert the account into a 2-of-3 multi-signature account.
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewAccountUpdateTx(1, nil, &api.AccountUpdate{
+		MultiSig: descriptor,
+	}))
+	require.NoError(err, "DeliverTx(AccountUpdate)")
+	acct, err := backend.Account(ctx, &api.OwnerQuery{Owner: ownerAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(descriptor, acct.General.MultiSig, "account should have the multi-signature descriptor")
+
+	// The original key alone can no longer act on behalf of the account.
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewTransferTx(2, nil, xfer))
+	require.ErrorIs(err, api.ErrInvalidMultiSig, "DeliverTx for a multi-signature account")
+
+	for _, tc := range []struct {
+		msg     string
+		signers []signature.Signer
+		err     error
+	}{
+		{"one signature", members[:1], api.ErrInvalidMultiSig},
+		{"non-member signature", []signature.Signer{members[0], outsider}, api.ErrInvalidMultiSig},
+		{"duplicate signatures", []signature.Signer{members[0], members[0]}, api.ErrInvalidMultiSig},
+		{"two signatures", members[:2], nil},
+	} {
+		sigTx, err = api.SignMultiSigTransaction(tc.signers, ownerAddr, api.NewTransferTx(2, nil, xfer))
+		require.NoError(err, "SignMultiSigTransaction")
+		err = backend.DeliverMultiSignedTx(ctx, sigTx)
+		if tc.err != nil {
+			require.ErrorIs(err, tc.err, "DeliverMultiSignedTx with %s", tc.msg)
+			continue
+		}
+		require.NoError(err, "DeliverMultiSignedTx with %s", tc.msg)
+	}
+
+	acct, err = backend.Account(ctx, &api.OwnerQuery{Owner: dstAddr, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(*quantity.NewFromUint64(10), acct.General.Balance, "transfer should be executed once")
+
+	// Signatures are bound to the account.
+	sigTx, err = api.SignMultiSigTransaction(members, ownerAddr, api.NewTransferTx(3, nil, xfer))
+	require.NoError(err, "SignMultiSigTransaction")
+	sigTx.Blob = cbor.Marshal(&api.MultiSigTransaction{Account: dstAddr, Transaction: *api.NewTransferTx(3, nil, xfer)})
+	err = backend.DeliverMultiSignedTx(ctx, sigTx)
+	require.ErrorIs(err, api.ErrInvalidSignature, "DeliverMultiSignedTx with signatures for a different account")
+
+	// Methods not supported for multi-signature accounts are rejected.
+	sigTx, err = api.SignMultiSigTransaction(members, ownerAddr, api.NewWithdrawTx(3, nil, &api.Withdraw{
+		From:   dstAddr,
+		Amount: *quantity.NewFromUint64(1),
+	}))
+	require.NoError(err, "SignMultiSigTransaction")
+	err = backend.DeliverMultiSignedTx(ctx, sigTx)
+	require.ErrorIs(err, api.ErrForbidden, "DeliverMultiSignedTx(Withdraw)")
+
+	// Restore single-key control.
+	sigTx, err = api.SignMultiSigTransaction(members[1:], ownerAddr, api.NewAccountUpdateTx(3, nil, &api.AccountUpdate{}))
+	require.NoError(err, "SignMultiSigTransaction")
+	err = backend.DeliverMultiSignedTx(ctx, sigTx)
+	require.NoError(err, "DeliverMultiSignedTx(AccountUpdate)")
+	err = backend.DeliverTx(ctx, owner.Public(), api.NewTransferTx(4, nil, xfer))
+	require.NoError(err, "DeliverTx after restoring single-key control")
+}
+
+func TestCommissionSchedule(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	genesis := stakingTests.GenesisState()
+	genesis.Parameters.CommissionScheduleRules = api.CommissionScheduleRules{
+		RateChangeInterval: 10,
+		RateBoundLead:      30,
+		MaxRateSteps:       4,
+		MaxBoundSteps:      4,
+	}
+	backend, err := New(&genesis, 0)
+	require.NoError(err, "New")
+
+	owner := stakingTests.Accounts.GetSigner(1)
+	query := &api.OwnerQuery{Owner: stakingTests.Accounts.GetAddress(1), Height: consensusAPI.HeightLatest}
+	amend := func(amendment api.CommissionSchedule) error {
+		acct, grr := backend.Account(ctx, query)
+		require.NoError(grr, "Account")
+		return backend.DeliverTx(ctx, owner.Public(), api.NewAmendCommissionScheduleTx(acct.General.Nonce, nil, &api.AmendCommissionSchedule{
+			Amendment: amendment,
+		}))
+	}
+
+	cs, err := backend.CommissionSchedule(ctx, query)
+	require.NoError(err, "CommissionSchedule")
+	require.Empty(cs.Rates, "there should be no commission rates initially")
+
+	schedule := api.CommissionSchedule{
+		Rates: []api.CommissionRateStep{
+			{Start: 10, Rate: *quantity.NewFromUint64(12_345)},
+		},
+		Bounds: []api.CommissionRateBoundStep{
+			{Start: 10, RateMin: *quantity.NewFromUint64(0), RateMax: *quantity.NewFromUint64(50_000)},
+		},
+	}
+	err = amend(schedule)
+	require.NoError(err, "DeliverTx(AmendCommissionSchedule)")
+
+	cs, err = backend.CommissionSchedule(ctx, query)
+	require.NoError(err, "CommissionSchedule")
+	require.Equal(&schedule, cs, "CommissionSchedule should return the amended schedule")
+	require.Equal(quantity.NewFromUint64(12_345), cs.CurrentRate(10), "commission rate should be in effect")
+
+	// Rates outside of the bounds should be rejected.
+	err = amend(api.CommissionSchedule{
+		Rates: []api.CommissionRateStep{
+			{Start: 20, Rate: *quantity.NewFromUint64(60_000)},
+		},
+	})
+	require.ErrorIs(err, api.ErrCommissionRateOutOfBounds, "DeliverTx(AmendCommissionSchedule) with rate out of bounds")
+
+	// Bound changes without the required notice should be rejected.
+	err = amend(api.CommissionSchedule{
+		Bounds: []api.CommissionRateBoundStep{
+			{Start: 20, RateMin: *quantity.NewFromUint64(0), RateMax: *quantity.NewFromUint64(100_000)},
+		},
+	})
+	require.ErrorIs(err, api.ErrCommissionChangeTooEarly, "DeliverTx(AmendCommissionSchedule) with bound change too early")
+
+	cs, err = backend.CommissionSchedule(ctx, query)
+	require.NoError(err, "CommissionSchedule")
+	require.Equal(&schedule, cs, "rejected amendments should not change the schedule")
+}
@@ -0,0 +1,270 @@
+package memory
+
+import (
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// markStateOwned marks all quantities in the given state as owned by the state, so that mutating
+// them other than through quantity.Quantity.Set panics when the quantity audit mode is enabled.
+func markStateOwned(st *api.Genesis) {
+	for _, q := range []*quantity.Quantity{&st.TotalSupply, &st.CommonPool, &st.LastBlockFees, &st.GovernanceDeposits} {
+		q.MarkStateOwned()
+	}
+	for _, acct := range st.Ledger {
+		markAccountStateOwned(acct)
+	}
+	for _, dels := range st.Delegations {
+		for _, del := range dels {
+			del.Shares.MarkStateOwned()
+		}
+	}
+	for _, delegators := range st.DebondingDelegations {
+		for _, debs := range delegators {
+			for _, deb := range debs {
+				deb.Shares.MarkStateOwned()
+			}
+		}
+	}
+}
+
+func markAccountStateOwned(acct *api.Account) {
+	acct.General.Balance.MarkStateOwned()
+	for _, pool := range []*api.SharePool{&acct.Escrow.Active, &acct.Escrow.Debonding} {
+		pool.Balance.MarkStateOwned()
+		pool.TotalShares.MarkStateOwned()
+	}
+}
+
+// getAccount returns a copy of the given account from the state, or an empty
+// account (retaining the nonce in case the account was reaped) if it doesn't
+// exist.
+func getAccount(st *api.Genesis, addr api.Address) *api.Account {
+	acct, ok := st.Ledger[addr]
+	if !ok {
+		return api.NewReapedAccount(st.ReapedAccounts[addr])
+	}
+	var clone api.Account
+	cbor.MustUnmarshal(cbor.Marshal(acct), &clone)
+	return &clone
+}
+
+// getReservedAccount returns the account of the given reserved module account,
+// holding its balance, or false if the address is not a reserved account.
+func getReservedAccount(st *api.Genesis, addr api.Address) (*api.Account, bool) {
+	var balance *quantity.Quantity
+	switch {
+	case addr.Equal(api.CommonPoolAddress):
+		balance = &st.CommonPool
+	case addr.Equal(api.FeeAccumulatorAddress):
+		balance = &st.LastBlockFees
+	case addr.Equal(api.GovernanceDepositsAddress):
+		balance = &st.GovernanceDeposits
+	default:
+		return nil, false
+	}
+	return &api.Account{General: api.GeneralAccount{Balance: *balance.Clone()}}, true
+}
+
+// getAddresses returns the addresses of all accounts in the ledger and of all
+// reserved module accounts with a non-zero balance, in address order.
+func getAddresses(st *api.Genesis) []api.Address {
+	addrs := make([]api.Address, 0, len(st.Ledger)+len(api.ReservedAccountAddresses))
+	for addr := range st.Ledger {
+		addrs = append(addrs, addr)
+	}
+	for _, addr := range api.ReservedAccountAddresses {
+		if acct, _ := getReservedAccount(st, addr); !acct.General.Balance.IsZero() {
+			addrs = append(addrs, addr)
+		}
+	}
+	sortAddresses(addrs)
+	return addrs
+}
+
+// setAccount stores the given account into the state.
+func setAccount(st *api.Genesis, addr api.Address, acct *api.Account) {
+	markAccountStateOwned(acct)
+	st.Ledger[addr] = acct
+}
+
+// removeAccount reaps the given account from the state, retaining its nonce.
+func removeAccount(st *api.Genesis, addr api.Address, acct *api.Account) {
+	delete(st.Ledger, addr)
+	if st.ReapedAccounts == nil {
+		st.ReapedAccounts = make(map[api.Address]uint64)
+	}
+	st.ReapedAccounts[addr] = acct.General.Nonce
+}
+
+// recordCreatedAccounts sets the creation height of the accounts that are in
+// the ledger of the given state but not in the ledger of the previous state,
+// unless already set, and returns the corresponding events in address order.
+func recordCreatedAccounts(prev, st *api.Genesis, height int64) []*api.Event {
+	var created []api.Address
+	for addr, acct := range st.Ledger {
+		if _, ok := prev.Ledger[addr]; !ok && acct.General.CreatedAt == 0 {
+			created = append(created, addr)
+		}
+	}
+	sortAddresses(created)
+
+	var events []*api.Event
+	for _, addr := range created {
+		acct := st.Ledger[addr]
+		acct.General.CreatedAt = height
+		delete(st.ReapedAccounts, addr)
+
+		events = append(events, &api.Event{AccountCreated: &api.AccountCreatedEvent{
+			Account: addr,
+			Nonce:   acct.General.Nonce,
+		}})
+	}
+	return events
+}
+
+// getDelegation returns a copy of the delegation from the given delegator to
+// the given escrow account, or an empty delegation if it doesn't exist.
+// slashPool moves the pool's share of the slashed amount (proportional to
+// the pool's part of the total balance) into dst.
+func slashPool(dst *quantity.Quantity, p *api.SharePool, amount, total *quantity.Quantity) error {
+	if total.IsZero() {
+		return nil
+	}
+	// slashAmount = amount * p.Balance / total
+	slashAmount := p.Balance.Clone()
+	if err := slashAmount.Mul(amount); err != nil {
+		return err
+	}
+	if err := slashAmount.Quo(total); err != nil {
+		return err
+	}
+	_, err := quantity.MoveUpTo(dst, &p.Balance, slashAmount)
+	return err
+}
+
+func getDelegation(st *api.Genesis, delegatorAddr, escrowAddr api.Address) *api.Delegation {
+	del, ok := st.Delegations[escrowAddr][delegatorAddr]
+	if !ok {
+		return &api.Delegation{}
+	}
+	return &api.Delegation{Shares: *del.Shares.Clone()}
+}
+
+// setDelegation stores the given delegation into the state, removing it in
+// case there are no more shares in it.
+func setDelegation(st *api.Genesis, delegatorAddr, escrowAddr api.Address, del *api.Delegation) {
+	if del.Shares.IsZero() {
+		delete(st.Delegations[escrowAddr], delegatorAddr)
+		if len(st.Delegations[escrowAddr]) == 0 {
+			delete(st.Delegations, escrowAddr)
+		}
+		return
+	}
+
+	if st.Delegations[escrowAddr] == nil {
+		st.Delegations[escrowAddr] = make(map[api.Address]*api.Delegation)
+	}
+	del.Shares.MarkStateOwned()
+	st.Delegations[escrowAddr][delegatorAddr] = del
+}
+
+// delegationsFor returns copies of all (outgoing) delegations of the given
+// delegator.
+func delegationsFor(st *api.Genesis, delegatorAddr api.Address) map[api.Address]*api.Delegation {
+	delegations := make(map[api.Address]*api.Delegation)
+	for escrowAddr, dels := range st.Delegations {
+		if del, ok := dels[delegatorAddr]; ok {
+			delegations[escrowAddr] = &api.Delegation{Shares: *del.Shares.Clone()}
+		}
+	}
+	return delegations
+}
+
+// debondingDelegationsFor returns copies of all (outgoing) debonding
+// delegations of the given delegator.
+func debondingDelegationsFor(st *api.Genesis, delegatorAddr api.Address) map[api.Address][]*api.DebondingDelegation {
+	delegations := make(map[api.Address][]*api.DebondingDelegation)
+	for escrowAddr, delegators := range st.DebondingDelegations {
+		for _, deb := range delegators[delegatorAddr] {
+			delegations[escrowAddr] = append(delegations[escrowAddr], &api.DebondingDelegation{
+				Shares:        *deb.Shares.Clone(),
+				DebondEndTime: deb.DebondEndTime,
+			})
+		}
+	}
+	return delegations
+}
+
+// addDebondingDelegation adds the given debonding delegation into the state.
+//
+// If a debonding delegation for the same accounts and end time already exists,
+// the debonding delegations are merged.
+func addDebondingDelegation(st *api.Genesis, delegatorAddr, escrowAddr api.Address, deb *api.DebondingDelegation) error {
+	if st.DebondingDelegations[escrowAddr] == nil {
+		st.DebondingDelegations[escrowAddr] = make(map[api.Address][]*api.DebondingDelegation)
+	}
+	debs := st.DebondingDelegations[escrowAddr][delegatorAddr]
+	for i, existing := range debs {
+		if existing.DebondEndTime == deb.DebondEndTime {
+			// Merge into a copy as the existing debonding delegation is owned by the state.
+			merged := &api.DebondingDelegation{
+				Shares:        *existing.Shares.Clone(),
+				DebondEndTime: existing.DebondEndTime,
+			}
+			if err := merged.Merge(*deb); err != nil {
+				return err
+			}
+			merged.Shares.MarkStateOwned()
+			debs[i] = merged
+			return nil
+		}
+	}
+	added := &api.DebondingDelegation{
+		Shares:        *deb.Shares.Clone(),
+		DebondEndTime: deb.DebondEndTime,
+	}
+	added.Shares.MarkStateOwned()
+	st.DebondingDelegations[escrowAddr][delegatorAddr] = append(debs, added)
+	return nil
+}
+
+// removeDebondingDelegation removes the debonding delegation with the given
+// end time from the state.
+func removeDebondingDelegation(st *api.Genesis, delegatorAddr, escrowAddr api.Address, deb *api.DebondingDelegation) {
+	debs := st.DebondingDelegations[escrowAddr][delegatorAddr]
+	for i, existing := range debs {
+		if existing.DebondEndTime == deb.DebondEndTime {
+			debs = append(debs[:i], debs[i+1:]...)
+			break
+		}
+	}
+
+	switch len(debs) {
+	case 0:
+		delete(st.DebondingDelegations[escrowAddr], delegatorAddr)
+		if len(st.DebondingDelegations[escrowAddr]) == 0 {
+			delete(st.DebondingDelegations, escrowAddr)
+		}
+	default:
+		st.DebondingDelegations[escrowAddr][delegatorAddr] = debs
+	}
+}
+
+// escrowSnapshot returns a snapshot of the active escrow pools of all accounts
+// with a non-zero active escrow balance.
+func escrowSnapshot(st *api.Genesis, epoch beacon.EpochTime) *api.EscrowSnapshot {
+	snapshot := &api.EscrowSnapshot{
+		Epoch:  epoch,
+		Escrow: make(map[api.Address]api.SharePool),
+	}
+	for addr, acct := range st.Ledger {
+		if acct.Escrow.Active.Balance.IsZero() {
+			continue
+		}
+		snapshot.Escrow[addr] = getAccount(st, addr).Escrow.Active
+	}
+	return snapshot
+}
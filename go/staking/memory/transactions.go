@@ -0,0 +1,836 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	abciAPI "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// txContext is the context of a transaction being executed.
+type txContext struct {
+	st     *api.Genesis
+	height int64
+	epoch  beacon.EpochTime
+	caller api.Address
+	txHash hash.Hash
+	events []*api.Event
+}
+
+func (ctx *txContext) emit(ev *api.Event) {
+	ctx.events = append(ctx.events, ctx.attribute(ev))
+}
+
+// attribute attributes the given event to the transaction being executed.
+func (ctx *txContext) attribute(ev *api.Event) *api.Event {
+	signer := ctx.caller
+	ev.TxHash = ctx.txHash
+	ev.Signer = &signer
+	return ev
+}
+
+// DeliverTx executes the given staking transaction as if it was signed by the
+// given signer and included in a new block.
+//
+// The transaction nonce must match the signer's account nonce and the gas price
+// must not be lower than the configured minimum gas price. The fee is paid into
+// the per-block fee accumulator, which is disbursed into the common pool at the
+// end of the block as there is no block proposer. The fee's gas limit must
+// cover the gas cost of the transaction's operation. Failed transactions still
+// increment the nonce and pay the fee, but have no other effects and emit no
+// other events.
+//
+// Transactions on behalf of accounts with a multi-signature descriptor must be
+// delivered via DeliverMultiSignedTx instead.
+func (b *Backend) DeliverTx(ctx context.Context, signer signature.PublicKey, tx *transaction.Transaction) error {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.deliverTxLocked(api.NewAddress(signer), nil, tx, hash.NewFrom(tx))
+}
+
+// DeliverSignedTx verifies the signature of the given signed transaction and
+// executes it on behalf of its signer.
+//
+// Unlike with DeliverTx, the transaction hash reported in events and used to
+// query the transaction result is the hash of the signed transaction, as with
+// transactions submitted to the consensus layer. Otherwise the semantics are
+// the same as for DeliverTx.
+func (b *Backend) DeliverSignedTx(ctx context.Context, sigTx *transaction.SignedTransaction) error {
+	var tx transaction.Transaction
+	if err := sigTx.Open(&tx); err != nil {
+		return fmt.Errorf("%w: %s", api.ErrInvalidSignature, err)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	return b.deliverTxLocked(api.NewAddress(sigTx.Signature.PublicKey), nil, &tx, sigTx.Hash())
+}
+
+// DeliverMultiSignedTx verifies the signatures of the given multi-signed
+// transaction and executes it on behalf of the account it was signed for.
+//
+// The signers must satisfy the account's multi-signature descriptor. Otherwise
+// the semantics are the same as for DeliverTx.
+func (b *Backend) DeliverMultiSignedTx(ctx context.Context, sigTx *api.MultiSignedTransaction) error {
+	var mtx api.MultiSigTransaction
+	if err := sigTx.Open(&mtx); err != nil {
+		return fmt.Errorf("%w: %s", api.ErrInvalidSignature, err)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	return b.deliverTxLocked(mtx.Account, sigTx.Signers(), &mtx.Transaction, sigTx.Hash())
+}
+
+// deliverTxLocked executes the given transaction with the given hash on behalf
+// of the caller, authorized by the given multi-signature signers (nil for
+// single-signed transactions).
+func (b *Backend) deliverTxLocked(caller api.Address, signers []signature.PublicKey, tx *transaction.Transaction, txHash hash.Hash) error {
+	tc := &txContext{
+		st:     cloneState(b.states[b.height]),
+		height: b.height + 1,
+		epoch:  b.epoch,
+		caller: caller,
+		txHash: txHash,
+	}
+
+	fee := tx.Fee
+	if fee == nil {
+		fee = &transaction.Fee{}
+	}
+	if fee.Gas > 0 && fee.GasPrice().Cmp(&b.minGasPrice) < 0 {
+		return transaction.ErrGasPriceTooLow
+	}
+
+	// Authenticate the transaction and pay fees.
+	acct := getAccount(tc.st, tc.caller)
+	if err := acct.AuthenticateSigners(tx.Method, signers); err != nil {
+		return err
+	}
+	if tx.Nonce != acct.General.Nonce {
+		return transaction.ErrInvalidNonce
+	}
+	acct.General.Nonce++
+	var blockFees quantity.Quantity
+	if err := quantity.Move(&blockFees, &acct.General.Balance, &fee.Amount); err != nil {
+		return transaction.ErrInsufficientFeeBalance
+	}
+	if !fee.Amount.IsZero() {
+		tc.emit(&api.Event{Transfer: &api.TransferEvent{
+			From:   tc.caller,
+			To:     api.FeeAccumulatorAddress,
+			Amount: fee.Amount,
+		}})
+	}
+	setAccount(tc.st, tc.caller, acct)
+
+	// Snapshot the state after authentication so that it can be committed even
+	// in case the transaction itself fails.
+	authSt := cloneState(tc.st)
+	authEvents := tc.events
+
+	st, events := tc.st, tc.events
+	err := b.executeTx(tc, tx, fee.Gas)
+	if err != nil {
+		b.logger.Debug("failed to execute transaction",
+			"err", err,
+			"method", tx.Method,
+			"caller", tc.caller,
+		)
+		st, events = authSt, authEvents
+	} else {
+		events = tc.events
+	}
+
+	for _, ev := range recordCreatedAccounts(b.states[b.height], st, tc.height) {
+		events = append(events, tc.attribute(ev))
+	}
+	if ev := disburseFees(st, &blockFees); ev != nil {
+		events = append(events, ev)
+	}
+	b.commitLocked(st, events)
+
+	// Record the transaction result, which only includes events emitted by the transaction.
+	result := &api.TransactionResult{
+		Height: b.height,
+		Error:  api.NewTransactionError(err),
+	}
+	for _, ev := range events {
+		if ev.TxHash.Equal(&tc.txHash) {
+			result.Events = append(result.Events, ev)
+		}
+	}
+	b.txResults[tc.txHash] = result
+
+	return err
+}
+
+// disburseFees disburses the fees accumulated in a block into the common pool
+// and returns the corresponding event, if any.
+func disburseFees(st *api.Genesis, fees *quantity.Quantity) *api.Event {
+	if fees.IsZero() {
+		return nil
+	}
+	commonPool, _ := st.CommonPool.AddQ(fees)
+	st.CommonPool.Set(commonPool)
+
+	return &api.Event{Transfer: &api.TransferEvent{
+		From:   api.FeeAccumulatorAddress,
+		To:     api.CommonPoolAddress,
+		Amount: *fees,
+	}}
+}
+
+// gasOps are the gas operations of the supported methods.
+var gasOps = map[transaction.MethodName]transaction.Op{
+	api.MethodTransfer:                api.GasOpTransfer,
+	api.MethodBurn:                    api.GasOpBurn,
+	api.MethodAddEscrow:               api.GasOpAddEscrow,
+	api.MethodReclaimEscrow:           api.GasOpReclaimEscrow,
+	api.MethodAmendCommissionSchedule: api.GasOpAmendCommissionSchedule,
+	api.MethodAllow:                   api.GasOpAllow,
+	api.MethodWithdraw:                api.GasOpWithdraw,
+	api.MethodAccountUpdate:           api.GasOpAccountUpdate,
+	api.MethodSetMetadata:             api.GasOpSetMetadata,
+	api.MethodSetTransferLimit:        api.GasOpSetTransferLimit,
+}
+
+// EstimateGas returns the amount of gas needed to execute the given staking
+// transaction at the latest height.
+func (b *Backend) EstimateGas(ctx context.Context, tx *transaction.Transaction) (transaction.Gas, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	return gasCost(&b.states[b.height].Parameters, tx)
+}
+
+// gasCost returns the amount of gas needed to execute the given transaction.
+func gasCost(params *api.ConsensusParameters, tx *transaction.Transaction) (transaction.Gas, error) {
+	switch tx.Method {
+	case api.MethodSetMetadata:
+		// Setting metadata is additionally charged per metadata byte.
+		var sm api.SetMetadata
+		if err := cbor.Unmarshal(tx.Body, &sm); err != nil {
+			return 0, api.ErrInvalidArgument
+		}
+		return params.SetMetadataGas(len(sm.Metadata)), nil
+	default:
+		op, ok := gasOps[tx.Method]
+		if !ok {
+			return 0, fmt.Errorf("staking/memory: unsupported method: %s", tx.Method)
+		}
+		return params.GasCosts[op], nil
+	}
+}
+
+func (b *Backend) executeTx(tc *txContext, tx *transaction.Transaction, gasLimit transaction.Gas) error {
+	gas, err := gasCost(&tc.st.Parameters, tx)
+	if err != nil {
+		return err
+	}
+	if gas > gasLimit {
+		return fmt.Errorf("%w (limit: %d wanted: %d)", abciAPI.ErrOutOfGas, gasLimit, gas)
+	}
+
+	switch tx.Method {
+	case api.MethodTransfer:
+		var xfer api.Transfer
+		if err := cbor.Unmarshal(tx.Body, &xfer); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return transfer(tc, &xfer)
+	case api.MethodBurn:
+		var burnBody api.Burn
+		if err := cbor.Unmarshal(tx.Body, &burnBody); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return burn(tc, &burnBody)
+	case api.MethodAddEscrow:
+		var escrow api.Escrow
+		if err := cbor.Unmarshal(tx.Body, &escrow); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return addEscrow(tc, &escrow)
+	case api.MethodReclaimEscrow:
+		var reclaim api.ReclaimEscrow
+		if err := cbor.Unmarshal(tx.Body, &reclaim); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return reclaimEscrow(tc, &reclaim)
+	case api.MethodAmendCommissionSchedule:
+		var amend api.AmendCommissionSchedule
+		if err := cbor.Unmarshal(tx.Body, &amend); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return amendCommissionSchedule(tc, &amend)
+	case api.MethodAllow:
+		var allowBody api.Allow
+		if err := cbor.Unmarshal(tx.Body, &allowBody); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return allow(tc, &allowBody)
+	case api.MethodWithdraw:
+		var withdrawBody api.Withdraw
+		if err := cbor.Unmarshal(tx.Body, &withdrawBody); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return withdraw(tc, &withdrawBody)
+	case api.MethodAccountUpdate:
+		var update api.AccountUpdate
+		if err := cbor.Unmarshal(tx.Body, &update); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return accountUpdate(tc, &update)
+	case api.MethodSetMetadata:
+		var sm api.SetMetadata
+		if err := cbor.Unmarshal(tx.Body, &sm); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return setMetadata(tc, &sm)
+	case api.MethodSetTransferLimit:
+		var stl api.SetTransferLimit
+		if err := cbor.Unmarshal(tx.Body, &stl); err != nil {
+			return api.ErrInvalidArgument
+		}
+		return setTransferLimit(tc, &stl)
+	default:
+		return fmt.Errorf("staking/memory: unsupported method: %s", tx.Method)
+	}
+}
+
+func isTransferPermitted(params *api.ConsensusParameters, fromAddr api.Address) bool {
+	if !params.DisableTransfers {
+		return true
+	}
+	return params.UndisableTransfersFrom != nil && params.UndisableTransfersFrom[fromAddr]
+}
+
+func transfer(tc *txContext, xfer *api.Transfer) error {
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+	// Reserved module accounts can only be credited internally, except for the burn address.
+	if xfer.To.IsReserved() && !xfer.To.Equal(api.BurnAddress) {
+		return api.ErrForbidden
+	}
+	if !isTransferPermitted(&tc.st.Parameters, tc.caller) {
+		return api.ErrTransfersDisabled
+	}
+
+	from := getAccount(tc.st, tc.caller)
+	if !tc.caller.Equal(xfer.To) {
+		if err := from.General.ConsumeTransferLimit(&xfer.Amount, tc.epoch); err != nil {
+			return err
+		}
+	}
+	var (
+		dust   *quantity.Quantity
+		burned bool
+	)
+	switch {
+	case tc.caller.Equal(xfer.To):
+		// Handle transfer to self as just a balance check.
+		if from.General.Balance.Cmp(&xfer.Amount) < 0 {
+			return api.ErrInsufficientBalance
+		}
+	case xfer.To.Equal(api.BurnAddress):
+		// Handle transfer to the burn address as a burn.
+		if err := from.General.Balance.Sub(&xfer.Amount); err != nil {
+			return err
+		}
+		var err error
+		if dust, err = tc.st.Parameters.CheckMinAccountBalance(from); err != nil {
+			return err
+		}
+		totalSupply, _ := tc.st.TotalSupply.SubQ(&xfer.Amount)
+		tc.st.TotalSupply.Set(totalSupply)
+		burned = true
+	default:
+		to := getAccount(tc.st, xfer.To)
+		if err := quantity.Move(&to.General.Balance, &from.General.Balance, &xfer.Amount); err != nil {
+			return err
+		}
+		var err error
+		if dust, err = tc.st.Parameters.CheckMinAccountBalance(from); err != nil {
+			return err
+		}
+		setAccount(tc.st, xfer.To, to)
+	}
+	setAccount(tc.st, tc.caller, from)
+
+	if burned {
+		tc.emit(&api.Event{Burn: &api.BurnEvent{
+			Owner:  tc.caller,
+			Amount: xfer.Amount,
+		}})
+	} else {
+		tc.emit(&api.Event{Transfer: &api.TransferEvent{
+			From:   tc.caller,
+			To:     xfer.To,
+			Amount: xfer.Amount,
+		}})
+	}
+	if dust != nil {
+		reapDust(tc, tc.caller, dust)
+	}
+	return nil
+}
+
+// reapDust sweeps the given dust from the general balance of the given account
+// into the common pool and removes the account from the ledger in case nothing
+// else is left in it.
+func reapDust(tc *txContext, addr api.Address, dust *quantity.Quantity) {
+	acct := getAccount(tc.st, addr)
+	_ = acct.General.Balance.Sub(dust)
+	commonPool, _ := tc.st.CommonPool.AddQ(dust)
+	tc.st.CommonPool.Set(commonPool)
+	if acct.IsReapable() {
+		removeAccount(tc.st, addr, acct)
+		tc.emit(&api.Event{AccountReaped: &api.AccountReapedEvent{
+			Account: addr,
+			Nonce:   acct.General.Nonce,
+		}})
+	} else {
+		setAccount(tc.st, addr, acct)
+	}
+
+	tc.emit(&api.Event{Transfer: &api.TransferEvent{
+		From:   addr,
+		To:     api.CommonPoolAddress,
+		Amount: *dust,
+	}})
+}
+
+func burn(tc *txContext, burnBody *api.Burn) error {
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	from := getAccount(tc.st, tc.caller)
+	if err := from.General.Balance.Sub(&burnBody.Amount); err != nil {
+		return err
+	}
+	totalSupply, _ := tc.st.TotalSupply.SubQ(&burnBody.Amount)
+	tc.st.TotalSupply.Set(totalSupply)
+	setAccount(tc.st, tc.caller, from)
+
+	tc.emit(&api.Event{Burn: &api.BurnEvent{
+		Owner:  tc.caller,
+		Amount: burnBody.Amount,
+	}})
+	return nil
+}
+
+func addEscrow(tc *txContext, escrow *api.Escrow) error {
+	params := &tc.st.Parameters
+	if escrow.Amount.Cmp(&params.MinDelegationAmount) < 0 {
+		return api.ErrUnderMinDelegationAmount
+	}
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	from := getAccount(tc.st, tc.caller)
+	if err := from.General.ConsumeTransferLimit(&escrow.Amount, tc.epoch); err != nil {
+		return err
+	}
+	// NOTE: Could be the same account, so make sure to not have two duplicate
+	//       copies of it and overwrite it later.
+	to := from
+	if !tc.caller.Equal(escrow.Account) {
+		if params.DisableDelegation {
+			return api.ErrForbidden
+		}
+		to = getAccount(tc.st, escrow.Account)
+	}
+
+	delegation := getDelegation(tc.st, tc.caller, escrow.Account)
+	obtainedShares, err := to.Escrow.Active.Deposit(&delegation.Shares, &from.General.Balance, &escrow.Amount)
+	if err != nil {
+		return err
+	}
+
+	setAccount(tc.st, tc.caller, from)
+	setAccount(tc.st, escrow.Account, to)
+	setDelegation(tc.st, tc.caller, escrow.Account, delegation)
+
+	tc.emit(&api.Event{Escrow: &api.EscrowEvent{Add: &api.AddEscrowEvent{
+		Owner:     tc.caller,
+		Escrow:    escrow.Account,
+		Amount:    escrow.Amount,
+		NewShares: *obtainedShares,
+		Balances:  api.NewEscrowBalances(from, to),
+	}}})
+	return nil
+}
+
+func reclaimEscrow(tc *txContext, reclaim *api.ReclaimEscrow) error {
+	// No sense if there is nothing to reclaim.
+	if reclaim.Shares.IsZero() {
+		return api.ErrInvalidArgument
+	}
+	params := &tc.st.Parameters
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	to := getAccount(tc.st, tc.caller)
+	// NOTE: Could be the same account, so make sure to not have two duplicate
+	//       copies of it and overwrite it later.
+	from := to
+	if !tc.caller.Equal(reclaim.Account) {
+		if params.DisableDelegation {
+			return api.ErrForbidden
+		}
+		from = getAccount(tc.st, reclaim.Account)
+	}
+
+	delegation := getDelegation(tc.st, tc.caller, reclaim.Account)
+	deb := api.DebondingDelegation{
+		DebondEndTime: tc.epoch + params.DebondingInterval,
+	}
+
+	var baseUnits quantity.Quantity
+	if err := from.Escrow.Active.Withdraw(&baseUnits, &delegation.Shares, &reclaim.Shares); err != nil {
+		return err
+	}
+	stakeAmount := baseUnits.Clone()
+
+	debondingShares, err := from.Escrow.Debonding.Deposit(&deb.Shares, &baseUnits, stakeAmount)
+	if err != nil {
+		return err
+	}
+	if !baseUnits.IsZero() {
+		return api.ErrInvalidArgument
+	}
+
+	if err = addDebondingDelegation(tc.st, tc.caller, reclaim.Account, &deb); err != nil {
+		return fmt.Errorf("staking/memory: failed to add debonding delegation: %w", err)
+	}
+	setDelegation(tc.st, tc.caller, reclaim.Account, delegation)
+	setAccount(tc.st, tc.caller, to)
+	setAccount(tc.st, reclaim.Account, from)
+
+	tc.emit(&api.Event{Escrow: &api.EscrowEvent{DebondingStart: &api.DebondingStartEscrowEvent{
+		Owner:           tc.caller,
+		Escrow:          reclaim.Account,
+		Amount:          *stakeAmount,
+		ActiveShares:    reclaim.Shares,
+		DebondingShares: *debondingShares,
+	}}})
+	return nil
+}
+
+func amendCommissionSchedule(tc *txContext, amend *api.AmendCommissionSchedule) error {
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	from := getAccount(tc.st, tc.caller)
+	rules := &tc.st.Parameters.CommissionScheduleRules
+	if err := from.Escrow.CommissionSchedule.AmendAndPruneAndValidate(&amend.Amendment, rules, tc.epoch); err != nil {
+		return err
+	}
+	setAccount(tc.st, tc.caller, from)
+	return nil
+}
+
+func allow(tc *txContext, allowBody *api.Allow) error {
+	params := &tc.st.Parameters
+	// Allowances are disabled in case max allowances is zero.
+	if params.MaxAllowances == 0 {
+		return api.ErrForbidden
+	}
+	if tc.caller.IsReserved() || allowBody.Beneficiary.IsReserved() {
+		return api.ErrForbidden
+	}
+	if !isTransferPermitted(params, tc.caller) {
+		return api.ErrTransfersDisabled
+	}
+	if tc.caller.Equal(allowBody.Beneficiary) {
+		return api.ErrInvalidArgument
+	}
+
+	if allowBody.Expiry > 0 && allowBody.Expiry < tc.height {
+		return api.ErrInvalidArgument
+	}
+
+	acct := getAccount(tc.st, tc.caller)
+	acct.General.PruneExpiredAllowances(tc.height)
+	allowance := acct.General.Allowances[allowBody.Beneficiary]
+	var amountChange *quantity.Quantity
+	switch allowBody.Negative {
+	case false:
+		if err := allowance.Add(&allowBody.AmountChange); err != nil {
+			return fmt.Errorf("failed to add allowance: %w", err)
+		}
+		amountChange = allowBody.AmountChange.Clone()
+	case true:
+		var err error
+		if amountChange, err = allowance.SubUpTo(&allowBody.AmountChange); err != nil {
+			return fmt.Errorf("failed to subtract allowance: %w", err)
+		}
+	}
+	var expiry int64
+	switch {
+	case allowBody.Expiry > 0:
+		expiry = allowBody.Expiry
+	case allowBody.Expiry == 0:
+		expiry = acct.General.AllowanceExpiries[allowBody.Beneficiary]
+	}
+	acct.General.SetAllowance(allowBody.Beneficiary, &api.Allowance{
+		Amount: allowance,
+		Expiry: expiry,
+	})
+	if uint32(len(acct.General.Allowances)) > params.MaxAllowances {
+		return api.ErrTooManyAllowances
+	}
+	setAccount(tc.st, tc.caller, acct)
+
+	tc.emit(&api.Event{AllowanceChange: &api.AllowanceChangeEvent{
+		Owner:        tc.caller,
+		Beneficiary:  allowBody.Beneficiary,
+		Allowance:    allowance,
+		Negative:     allowBody.Negative,
+		AmountChange: *amountChange,
+		Expiry:       acct.General.AllowanceExpiries[allowBody.Beneficiary],
+	}})
+	return nil
+}
+
+func withdraw(tc *txContext, withdrawBody *api.Withdraw) error {
+	params := &tc.st.Parameters
+	// Allowances are disabled in case max allowances is zero.
+	if params.MaxAllowances == 0 {
+		return api.ErrForbidden
+	}
+	if tc.caller.IsReserved() || withdrawBody.From.IsReserved() {
+		return api.ErrForbidden
+	}
+	if !isTransferPermitted(params, withdrawBody.From) {
+		return api.ErrTransfersDisabled
+	}
+	if tc.caller.Equal(withdrawBody.From) {
+		return api.ErrInvalidArgument
+	}
+
+	from := getAccount(tc.st, withdrawBody.From)
+	allowance, ok := from.General.Allowances[tc.caller]
+	if !ok {
+		return api.ErrForbidden
+	}
+	if from.General.IsAllowanceExpired(tc.caller, tc.height) {
+		return api.ErrAllowanceExpired
+	}
+	if err := allowance.Sub(&withdrawBody.Amount); err != nil {
+		return api.ErrForbidden
+	}
+	if err := from.General.ConsumeTransferLimit(&withdrawBody.Amount, tc.epoch); err != nil {
+		return err
+	}
+	expiry := from.General.AllowanceExpiries[tc.caller]
+	from.General.SetAllowance(tc.caller, &api.Allowance{
+		Amount: allowance,
+		Expiry: expiry,
+	})
+	from.General.PruneExpiredAllowances(tc.height)
+
+	to := getAccount(tc.st, tc.caller)
+	if err := quantity.Move(&to.General.Balance, &from.General.Balance, &withdrawBody.Amount); err != nil {
+		return api.ErrInsufficientBalance
+	}
+	dust, err := params.CheckMinAccountBalance(from)
+	if err != nil {
+		return err
+	}
+	setAccount(tc.st, tc.caller, to)
+	setAccount(tc.st, withdrawBody.From, from)
+
+	tc.emit(&api.Event{Transfer: &api.TransferEvent{
+		From:   withdrawBody.From,
+		To:     tc.caller,
+		Amount: withdrawBody.Amount,
+	}})
+	tc.emit(&api.Event{AllowanceChange: &api.AllowanceChangeEvent{
+		Owner:        withdrawBody.From,
+		Beneficiary:  tc.caller,
+		Allowance:    allowance,
+		Negative:     true,
+		AmountChange: withdrawBody.Amount,
+		Expiry:       expiry,
+	}})
+	if dust != nil {
+		reapDust(tc, withdrawBody.From, dust)
+	}
+	return nil
+}
+
+func accountUpdate(tc *txContext, update *api.AccountUpdate) error {
+	if err := update.SanityCheck(); err != nil {
+		return api.ErrInvalidArgument
+	}
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	acct := getAccount(tc.st, tc.caller)
+	acct.General.MultiSig = update.MultiSig
+	setAccount(tc.st, tc.caller, acct)
+	return nil
+}
+
+func setMetadata(tc *txContext, sm *api.SetMetadata) error {
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	acct := getAccount(tc.st, tc.caller)
+	if err := tc.st.Parameters.CanSetMetadata(acct, sm); err != nil {
+		return err
+	}
+	acct.General.Metadata = nil
+	if len(sm.Metadata) > 0 {
+		acct.General.Metadata = sm.Metadata
+	}
+	setAccount(tc.st, tc.caller, acct)
+
+	tc.emit(&api.Event{MetadataUpdated: &api.MetadataUpdatedEvent{
+		Owner:    tc.caller,
+		Metadata: acct.General.Metadata,
+	}})
+	return nil
+}
+
+func setTransferLimit(tc *txContext, stl *api.SetTransferLimit) error {
+	if tc.caller.IsReserved() {
+		return api.ErrForbidden
+	}
+
+	acct := getAccount(tc.st, tc.caller)
+	if err := acct.General.SetTransferLimit(stl, tc.epoch, tc.st.Parameters.TransferLimitRemovalDelay); err != nil {
+		return err
+	}
+	setAccount(tc.st, tc.caller, acct)
+	return nil
+}
+
+// debondingQueueEntry is an expired debonding delegation.
+type debondingQueueEntry struct {
+	delegatorAddr api.Address
+	escrowAddr    api.Address
+	delegation    *api.DebondingDelegation
+}
+
+// expiredDebondingQueue returns all debonding delegations that expire at or
+// before the given epoch, ordered by end time, delegator and escrow address.
+func expiredDebondingQueue(st *api.Genesis, epoch beacon.EpochTime) []*debondingQueueEntry {
+	var entries []*debondingQueueEntry
+	for escrowAddr, delegators := range st.DebondingDelegations {
+		for delegatorAddr, debs := range delegators {
+			for _, deb := range debs {
+				if deb.DebondEndTime > epoch {
+					continue
+				}
+				entries = append(entries, &debondingQueueEntry{
+					delegatorAddr: delegatorAddr,
+					escrowAddr:    escrowAddr,
+					delegation:    deb,
+				})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.delegation.DebondEndTime != b.delegation.DebondEndTime {
+			return a.delegation.DebondEndTime < b.delegation.DebondEndTime
+		}
+		if cmp := bytes.Compare(a.delegatorAddr[:], b.delegatorAddr[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(a.escrowAddr[:], b.escrowAddr[:]) < 0
+	})
+	return entries
+}
+
+// SetEpoch transitions the backend to the given epoch in a new block,
+// releasing all debonding delegations that have expired.
+func (b *Backend) SetEpoch(ctx context.Context, epoch beacon.EpochTime) error {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.setEpochLocked(epoch)
+}
+
+func (b *Backend) setEpochLocked(epoch beacon.EpochTime) error {
+	if epoch < b.epoch {
+		return fmt.Errorf("staking/memory: epoch %d is before current epoch %d", epoch, b.epoch)
+	}
+
+	tc := &txContext{
+		st:    cloneState(b.states[b.height]),
+		epoch: epoch,
+	}
+	tc.txHash.Empty()
+
+	for _, e := range expiredDebondingQueue(tc.st, epoch) {
+		deb := e.delegation
+		shareAmount := deb.Shares.Clone()
+		delegator := getAccount(tc.st, e.delegatorAddr)
+		// NOTE: Could be the same account, so make sure to not have two duplicate
+		//       copies of it and overwrite it later.
+		escrow := delegator
+		if !e.delegatorAddr.Equal(e.escrowAddr) {
+			escrow = getAccount(tc.st, e.escrowAddr)
+		}
+
+		// The debonding delegation is owned by the state, so withdraw from a copy of its shares.
+		var baseUnits quantity.Quantity
+		if err := escrow.Escrow.Debonding.Withdraw(&baseUnits, deb.Shares.Clone(), shareAmount); err != nil {
+			return fmt.Errorf("staking/memory: failed to redeem debonding shares: %w", err)
+		}
+		stakeAmount := baseUnits.Clone()
+		if err := quantity.Move(&delegator.General.Balance, &baseUnits, stakeAmount); err != nil {
+			return fmt.Errorf("staking/memory: failed to move debonded stake: %w", err)
+		}
+
+		removeDebondingDelegation(tc.st, e.delegatorAddr, e.escrowAddr, deb)
+		setAccount(tc.st, e.escrowAddr, escrow)
+		setAccount(tc.st, e.delegatorAddr, delegator)
+
+		tc.emit(&api.Event{Escrow: &api.EscrowEvent{Reclaim: &api.ReclaimEscrowEvent{
+			Owner:    e.delegatorAddr,
+			Escrow:   e.escrowAddr,
+			Amount:   *stakeAmount,
+			Shares:   *shareAmount,
+			Balances: api.NewEscrowBalances(delegator, escrow),
+		}}})
+	}
+
+	// Snapshot escrow balances for the new epoch, removing snapshots outside of
+	// the retention window.
+	retention := tc.st.Parameters.EscrowSnapshotRetention
+	for e := range b.snapshots {
+		if retention == 0 || uint64(e)+retention <= uint64(epoch) {
+			delete(b.snapshots, e)
+		}
+	}
+	if retention > 0 {
+		b.snapshots[epoch] = escrowSnapshot(tc.st, epoch)
+	}
+
+	b.epoch = epoch
+	b.commitLocked(tc.st, tc.events)
+	return nil
+}
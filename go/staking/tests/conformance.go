@@ -0,0 +1,326 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	consensusAPI "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+const (
+	// conformanceWatchers is the number of simultaneous event subscribers.
+	conformanceWatchers = 3
+	// conformanceAccounts is the number of accounts performing randomized operations.
+	conformanceAccounts = 4
+	// conformanceOps is the number of randomized operations.
+	conformanceOps = 64
+	// conformanceBalance is the initial general balance of accounts performing operations.
+	conformanceBalance = 10_000
+)
+
+// StakingConformanceTests exercises behavior that all staking backends must agree on, also
+// when operations are submitted concurrently.
+//
+// Operations are performed by newly funded accounts and are randomized using the given seed.
+// The backend must not charge fees for submitted transactions, must not enforce a minimum
+// account balance and must have transfers enabled.
+func StakingConformanceTests(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, seed int64) {
+	params, err := backend.ConsensusParameters(context.Background(), consensusAPI.HeightLatest)
+	require.NoError(t, err, "ConsensusParameters")
+	require.True(t, params.MinAccountBalance.IsZero(), "minimum account balance must not be configured")
+	require.False(t, params.DisableTransfers, "transfers must be enabled")
+
+	t.Run("MultipleWatchers", func(t *testing.T) { testMultipleWatchers(t, backend, consensus) })
+	t.Run("NonceIsolation", func(t *testing.T) { testNonceIsolation(t, backend, consensus) })
+	t.Run("RandomizedModel", func(t *testing.T) { testRandomizedModel(t, params, backend, consensus, seed) })
+}
+
+// eventInvolves returns true iff the given event involves any of the given accounts.
+func eventInvolves(ev *api.Event, addrs map[api.Address]bool) bool {
+	switch {
+	case ev.Transfer != nil:
+		return addrs[ev.Transfer.From] || addrs[ev.Transfer.To]
+	case ev.Burn != nil:
+		return addrs[ev.Burn.Owner]
+	case ev.Escrow != nil && ev.Escrow.Add != nil:
+		return addrs[ev.Escrow.Add.Owner] || addrs[ev.Escrow.Add.Escrow]
+	case ev.AllowanceChange != nil:
+		return addrs[ev.AllowanceChange.Owner] || addrs[ev.AllowanceChange.Beneficiary]
+	case ev.AccountCreated != nil:
+		return addrs[ev.AccountCreated.Account]
+	default:
+		return false
+	}
+}
+
+func testMultipleWatchers(t *testing.T, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	signers := []account{newAccount(), newAccount()}
+	marker := newAccount()
+	addrs := map[api.Address]bool{marker.Address: true}
+	for _, acc := range signers {
+		addrs[acc.Address] = true
+	}
+
+	// Subscribe before funding so that all events involving the accounts are observed.
+	streams := make([][]*api.Event, conformanceWatchers)
+	var wg sync.WaitGroup
+	errCh := make(chan error, conformanceWatchers)
+	for i := range streams {
+		ch, sub, err := backend.WatchEvents(ctx)
+		require.NoError(err, "WatchEvents")
+		defer sub.Close()
+
+		wg.Add(1)
+		go func(i int, ch <-chan *api.Event) {
+			defer wg.Done()
+			for {
+				select {
+				case ev := <-ch:
+					if !eventInvolves(ev, addrs) {
+						continue
+					}
+					streams[i] = append(streams[i], ev)
+					if ev.Burn != nil && ev.Burn.Owner.Equal(marker.Address) {
+						return
+					}
+				case <-time.After(recvTimeout):
+					errCh <- fmt.Errorf("watcher %d: timed out waiting for events", i)
+					return
+				}
+			}
+		}(i, ch)
+	}
+
+	for _, acc := range append(signers, marker) {
+		err := submitTransfer(t, backend, consensus, Accounts.getAccount(1), acc.Address, quantity.NewFromUint64(conformanceBalance))
+		require.NoError(err, "Transfer - fund account")
+	}
+
+	// Submit interleaved operations from both signers concurrently.
+	var opsWg sync.WaitGroup
+	opsErrCh := make(chan error, len(signers))
+	for i, acc := range signers {
+		opsWg.Add(1)
+		go func(acc account, to api.Address) {
+			defer opsWg.Done()
+			for j := 0; j < 5; j++ {
+				txs := []*transaction.Transaction{
+					api.NewTransferTx(0, nil, &api.Transfer{To: to, Amount: *quantity.NewFromUint64(10)}),
+					api.NewBurnTx(0, nil, &api.Burn{Amount: *quantity.NewFromUint64(1)}),
+					api.NewAllowTx(0, nil, &api.Allow{Beneficiary: to, AmountChange: *quantity.NewFromUint64(1)}),
+				}
+				for _, tx := range txs {
+					if err := consensusAPI.SignAndSubmitTx(ctx, consensus, acc.Signer, tx); err != nil {
+						opsErrCh <- err
+						return
+					}
+				}
+			}
+		}(acc, signers[(i+1)%len(signers)].Address)
+	}
+	opsWg.Wait()
+	close(opsErrCh)
+	for err := range opsErrCh {
+		require.NoError(err, "concurrent operations")
+	}
+
+	err := consensusAPI.SignAndSubmitTx(ctx, consensus, marker.Signer, api.NewBurnTx(0, nil, &api.Burn{
+		Amount: *quantity.NewFromUint64(1),
+	}))
+	require.NoError(err, "Burn - marker")
+
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(err, "watcher")
+	}
+
+	// All watchers should observe identical event streams.
+	for i := 1; i < len(streams); i++ {
+		require.Equal(streams[0], streams[i], "watcher %d should observe the same events as watcher 0", i)
+	}
+
+	// Which should also match the events returned by GetEvents.
+	var expected []*api.Event
+	for height := streams[0][0].Height; height <= streams[0][len(streams[0])-1].Height; height++ {
+		evs, err := backend.GetEvents(ctx, height)
+		require.NoError(err, "GetEvents")
+		for _, ev := range evs {
+			if eventInvolves(ev, addrs) {
+				expected = append(expected, ev)
+			}
+		}
+	}
+	require.Equal(expected, streams[0], "watched events should match GetEvents")
+}
+
+func testNonceIsolation(t *testing.T, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	const numTxs = 10
+	signers := []account{
+		fundNewAccount(t, backend, consensus, quantity.NewFromUint64(conformanceBalance)),
+		fundNewAccount(t, backend, consensus, quantity.NewFromUint64(conformanceBalance)),
+	}
+	dst := newAccount()
+
+	// Submit transactions from both signers concurrently.
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(signers))
+	for _, acc := range signers {
+		wg.Add(1)
+		go func(acc account) {
+			defer wg.Done()
+			for i := 0; i < numTxs; i++ {
+				tx := api.NewTransferTx(0, nil, &api.Transfer{To: dst.Address, Amount: *quantity.NewFromUint64(1)})
+				if err := consensusAPI.SignAndSubmitTx(ctx, consensus, acc.Signer, tx); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(acc)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(err, "concurrent transfers")
+	}
+
+	nonce := func(acc account) uint64 {
+		stakingAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+		return stakingAcc.General.Nonce
+	}
+	for i, acc := range signers {
+		require.EqualValues(numTxs, nonce(acc), "signer %d: nonce should only count own transactions", i)
+	}
+
+	// Transactions with a stale nonce should be rejected without affecting other signers.
+	tx := api.NewTransferTx(0, nil, &api.Transfer{To: dst.Address, Amount: *quantity.NewFromUint64(1)})
+	sigTx, err := transaction.Sign(signers[0].Signer, tx)
+	require.NoError(err, "Sign")
+	err = consensus.SubmitTx(ctx, sigTx)
+	require.ErrorIs(err, transaction.ErrInvalidNonce, "SubmitTx - stale nonce")
+	for i, acc := range signers {
+		require.EqualValues(numTxs, nonce(acc), "signer %d: nonce should not change", i)
+	}
+
+	dstAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: dst.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "dst: Account")
+	require.Equal(*quantity.NewFromUint64(2 * numTxs), dstAcc.General.Balance, "dst: general balance")
+}
+
+func testRandomizedModel(
+	t *testing.T,
+	params *api.ConsensusParameters,
+	backend api.Backend,
+	consensus consensusAPI.Backend,
+	seed int64,
+) {
+	require := require.New(t)
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(seed)) // nolint: gosec
+
+	model := newLedgerModel(params)
+	accounts := make([]account, conformanceAccounts)
+	for i := range accounts {
+		accounts[i] = fundNewAccount(t, backend, consensus, quantity.NewFromUint64(conformanceBalance))
+		model.account(accounts[i].Address).General.Balance = *quantity.NewFromUint64(conformanceBalance)
+	}
+
+	// randomAmount returns a random amount which may exceed the given maximum.
+	randomAmount := func(max *quantity.Quantity) *quantity.Quantity {
+		limit := max.ToBigInt().Int64() * 5 / 4
+		return quantity.NewFromUint64(uint64(rng.Int63n(limit + 1)))
+	}
+	randomAccount := func() account {
+		return accounts[rng.Intn(len(accounts))]
+	}
+
+	for i := 0; i < conformanceOps; i++ {
+		caller, other := randomAccount(), randomAccount()
+		balance := &model.account(caller.Address).General.Balance
+
+		var (
+			tx       *transaction.Transaction
+			expectOk bool
+		)
+		switch op := rng.Intn(5); op {
+		case 0:
+			xfer := &api.Transfer{To: other.Address, Amount: *randomAmount(balance)}
+			tx = api.NewTransferTx(0, nil, xfer)
+			expectOk = model.transfer(caller.Address, xfer)
+		case 1:
+			burn := &api.Burn{Amount: *randomAmount(quantity.NewFromUint64(100))}
+			tx = api.NewBurnTx(0, nil, burn)
+			expectOk = model.burn(caller.Address, burn)
+		case 2:
+			if caller.Address.Equal(other.Address) {
+				continue
+			}
+			allow := &api.Allow{
+				Beneficiary:  other.Address,
+				Negative:     rng.Intn(4) == 0,
+				AmountChange: *randomAmount(balance),
+			}
+			tx = api.NewAllowTx(0, nil, allow)
+			expectOk = model.allow(caller.Address, allow)
+		case 3:
+			if caller.Address.Equal(other.Address) {
+				continue
+			}
+			allowance := model.account(other.Address).General.Allowances[caller.Address]
+			withdraw := &api.Withdraw{From: other.Address, Amount: *randomAmount(&allowance)}
+			tx = api.NewWithdrawTx(0, nil, withdraw)
+			expectOk = model.withdraw(caller.Address, withdraw)
+		case 4:
+			escrow := &api.Escrow{Account: other.Address, Amount: *randomAmount(balance)}
+			tx = api.NewAddEscrowTx(0, nil, escrow)
+			expectOk = model.addEscrow(caller.Address, escrow)
+		}
+
+		err := consensusAPI.SignAndSubmitTx(ctx, consensus, caller.Signer, tx)
+		switch expectOk {
+		case true:
+			require.NoError(err, "operation %d (%s) should succeed", i, tx.Method)
+		case false:
+			require.Error(err, "operation %d (%s) should fail", i, tx.Method)
+		}
+	}
+
+	// Compare the resulting ledger against the model.
+	for i, acc := range accounts {
+		expected := model.account(acc.Address)
+		actual, err := backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+
+		require.Equal(expected.General.Balance, actual.General.Balance, "account %d: general balance", i)
+		require.Equal(expected.General.Nonce, actual.General.Nonce, "account %d: nonce", i)
+		require.Equal(len(expected.General.Allowances), len(actual.General.Allowances), "account %d: allowances", i)
+		for beneficiary, allowance := range expected.General.Allowances {
+			require.Equal(allowance, actual.General.Allowances[beneficiary], "account %d: allowance", i)
+		}
+		require.Equal(expected.Escrow.Active, actual.Escrow.Active, "account %d: active escrow", i)
+
+		delegations, err := backend.DelegationsFor(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "DelegationsFor")
+		require.Equal(len(model.Delegations[acc.Address]), len(delegations), "account %d: delegations", i)
+		for escrow, delegation := range model.Delegations[acc.Address] {
+			require.Contains(delegations, escrow, "account %d: delegation", i)
+			require.Equal(delegation.Shares, delegations[escrow].Shares, "account %d: delegation shares", i)
+		}
+	}
+}
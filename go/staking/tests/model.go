@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/quantity"
+	"github.com/oasisprotocol/oasis-core/go/staking/api"
+)
+
+// ledgerModel is a reference model of the staking ledger, used to check the behavior of
+// staking backends.
+//
+// It only supports transfers, burns, allowances, withdrawals and escrow additions of
+// accounts without transfer limits, under consensus parameters without a minimum account
+// balance and with transfers enabled.
+type ledgerModel struct {
+	params *api.ConsensusParameters
+
+	Accounts    map[api.Address]*api.Account
+	Delegations map[api.Address]map[api.Address]*api.Delegation
+}
+
+// newLedgerModel returns a new empty ledger model.
+func newLedgerModel(params *api.ConsensusParameters) *ledgerModel {
+	return &ledgerModel{
+		params:      params,
+		Accounts:    make(map[api.Address]*api.Account),
+		Delegations: make(map[api.Address]map[api.Address]*api.Delegation),
+	}
+}
+
+// account returns the modeled account with the given address, creating it if needed.
+func (m *ledgerModel) account(addr api.Address) *api.Account {
+	acct, ok := m.Accounts[addr]
+	if !ok {
+		acct = &api.Account{}
+		m.Accounts[addr] = acct
+	}
+	return acct
+}
+
+// delegation returns the modeled delegation from the given delegator to the given escrow
+// account, creating it if needed.
+func (m *ledgerModel) delegation(delegator, escrow api.Address) *api.Delegation {
+	if m.Delegations[delegator] == nil {
+		m.Delegations[delegator] = make(map[api.Address]*api.Delegation)
+	}
+	d, ok := m.Delegations[delegator][escrow]
+	if !ok {
+		d = &api.Delegation{}
+		m.Delegations[delegator][escrow] = d
+	}
+	return d
+}
+
+// apply executes the given operation on behalf of the given caller and reports whether it
+// succeeded. Failed operations only increment the caller's nonce.
+func (m *ledgerModel) apply(caller api.Address, op func(*ledgerModel) bool) bool {
+	m.account(caller).General.Nonce++
+
+	var snapshot ledgerModel
+	if err := cbor.Unmarshal(cbor.Marshal(m), &snapshot); err != nil {
+		panic(err)
+	}
+	if op(m) {
+		return true
+	}
+	m.Accounts, m.Delegations = snapshot.Accounts, snapshot.Delegations
+	return false
+}
+
+func (m *ledgerModel) transfer(caller api.Address, xfer *api.Transfer) bool {
+	return m.apply(caller, func(m *ledgerModel) bool {
+		from := m.account(caller)
+		if caller.Equal(xfer.To) {
+			return from.General.Balance.Cmp(&xfer.Amount) >= 0
+		}
+		return quantity.Move(&m.account(xfer.To).General.Balance, &from.General.Balance, &xfer.Amount) == nil
+	})
+}
+
+func (m *ledgerModel) burn(caller api.Address, burn *api.Burn) bool {
+	return m.apply(caller, func(m *ledgerModel) bool {
+		return m.account(caller).General.Balance.Sub(&burn.Amount) == nil
+	})
+}
+
+func (m *ledgerModel) allow(caller api.Address, allow *api.Allow) bool {
+	return m.apply(caller, func(m *ledgerModel) bool {
+		if caller.Equal(allow.Beneficiary) {
+			return false
+		}
+
+		acct := m.account(caller)
+		allowance := acct.General.Allowances[allow.Beneficiary]
+		switch allow.Negative {
+		case false:
+			if allowance.Add(&allow.AmountChange) != nil {
+				return false
+			}
+		case true:
+			if _, err := allowance.SubUpTo(&allow.AmountChange); err != nil {
+				return false
+			}
+		}
+		acct.General.SetAllowance(allow.Beneficiary, &api.Allowance{Amount: allowance})
+		return uint32(len(acct.General.Allowances)) <= m.params.MaxAllowances
+	})
+}
+
+func (m *ledgerModel) withdraw(caller api.Address, withdraw *api.Withdraw) bool {
+	return m.apply(caller, func(m *ledgerModel) bool {
+		if caller.Equal(withdraw.From) || m.params.MaxAllowances == 0 {
+			return false
+		}
+
+		from := m.account(withdraw.From)
+		allowance, ok := from.General.Allowances[caller]
+		if !ok || allowance.Sub(&withdraw.Amount) != nil {
+			return false
+		}
+		from.General.SetAllowance(caller, &api.Allowance{Amount: allowance})
+		return quantity.Move(&m.account(caller).General.Balance, &from.General.Balance, &withdraw.Amount) == nil
+	})
+}
+
+func (m *ledgerModel) addEscrow(caller api.Address, escrow *api.Escrow) bool {
+	return m.apply(caller, func(m *ledgerModel) bool {
+		if escrow.Amount.Cmp(&m.params.MinDelegationAmount) < 0 {
+			return false
+		}
+		if !caller.Equal(escrow.Account) && m.params.DisableDelegation {
+			return false
+		}
+
+		from, to := m.account(caller), m.account(escrow.Account)
+		delegation := m.delegation(caller, escrow.Account)
+		_, err := to.Escrow.Active.Deposit(&delegation.Shares, &from.General.Balance, &escrow.Amount)
+		return err == nil
+	})
+}
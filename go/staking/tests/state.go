@@ -47,9 +47,13 @@ func GenesisState() api.Genesis {
 			},
 			MinDelegationAmount:     *quantity.NewFromUint64(10),
 			MaxAllowances:           32,
+			MinMetadataBalance:      *quantity.NewFromUint64(10),
 			FeeSplitWeightVote:      *quantity.NewFromUint64(1),
 			RewardFactorEpochSigned: *quantity.NewFromUint64(1),
 			// Zero RewardFactorBlockProposed is normal.
+
+			// Keep the removal delay short as advancing epochs is expensive in tests.
+			TransferLimitRemovalDelay: 1,
 		},
 		TokenSymbol: "TEST",
 		TotalSupply: *quantity.NewFromUint64(math.MaxInt64),
@@ -278,5 +282,15 @@ func GenesisState() api.Genesis {
 		state.Ledger[addr].Escrow.Debonding.TotalShares = *totalShares
 	}
 
-	return state
+	// Produce the state via its canonical form so that it is always identical and survives a
+	// strict round-trip.
+	canonJSON, err := state.CanonicalJSON()
+	if err != nil {
+		panic(err)
+	}
+	var canonState api.Genesis
+	if err = canonState.UnmarshalCanonicalJSON(canonJSON); err != nil {
+		panic(err)
+	}
+	return canonState
 }
@@ -3,6 +3,7 @@ package tests
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"testing"
@@ -10,14 +11,15 @@ import (
 
 	"github.com/stretchr/testify/require"
 
-	beacon "github.com/oasisprotocol/oasis-core/go/beacon/api"
-	beaconTests "github.com/oasisprotocol/oasis-core/go/beacon/tests"
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	"github.com/oasisprotocol/oasis-core/go/common/entity"
 	"github.com/oasisprotocol/oasis-core/go/common/identity"
 	"github.com/oasisprotocol/oasis-core/go/common/quantity"
 	consensusAPI "github.com/oasisprotocol/oasis-core/go/consensus/api"
+	"github.com/oasisprotocol/oasis-core/go/consensus/api/transaction"
 	tendermintTests "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/tests"
 	"github.com/oasisprotocol/oasis-core/go/roothash/api/block"
 	"github.com/oasisprotocol/oasis-core/go/staking/api"
@@ -138,6 +140,9 @@ var (
 
 // StakingImplementationTests exercises the basic functionality of a staking
 // backend.
+//
+// The consensus equivocation slashing test requires a Tendermint consensus
+// backend and is skipped in case no node identity is given.
 func StakingImplementationTests(
 	t *testing.T,
 	backend api.Backend,
@@ -147,6 +152,8 @@ func StakingImplementationTests(
 	entitySigner signature.Signer,
 	runtimeID common.Namespace,
 ) {
+	initialStatus := requireStatus(t, backend, nil)
+	status := initialStatus
 	for _, tc := range []struct {
 		n  string
 		fn func(*testing.T, *stakingTestsState, api.Backend, consensusAPI.Backend)
@@ -159,16 +166,28 @@ func StakingImplementationTests(
 		{"Transfer", testTransfer},
 		{"TransferSelf", testSelfTransfer},
 		{"Burn", testBurn},
+		{"TransferBurnAddress", testTransferBurnAddress},
+		{"TransferReservedAccount", testTransferReservedAccount},
 		{"Escrow", testEscrow},
 		{"EscrowSelf", testSelfEscrow},
 		{"Allowance", testAllowance},
+		{"AllowanceLimit", testAllowanceLimit},
+		{"AccountMetadata", testAccountMetadata},
+		{"TransferLimit", testTransferLimit},
+		{"Fees", testFees},
+		{"GetTransactionNotFound", testGetTransactionNotFound},
 	} {
 		state := newStakingTestsState(t, backend, consensus)
 		t.Run(tc.n, func(t *testing.T) { tc.fn(t, state, backend, consensus) })
+		status = requireStatus(t, backend, status)
 	}
+	require.Greater(t, status.LatestHeight, initialStatus.LatestHeight, "GetStatus - latest height should increase")
 
 	// Separate test as it requires some arguments that others don't.
 	t.Run("SlashConsensusEquivocation", func(t *testing.T) {
+		if identity == nil {
+			t.Skip("no node identity to slash")
+		}
 		state := newStakingTestsState(t, backend, consensus)
 		testSlashConsensusEquivocation(t, state, backend, consensus, identity, entity, entitySigner, runtimeID)
 	})
@@ -177,6 +196,8 @@ func StakingImplementationTests(
 // StakingClientImplementationTests exercises the basic functionality of a
 // staking client backend.
 func StakingClientImplementationTests(t *testing.T, backend api.Backend, consensus consensusAPI.Backend) {
+	initialStatus := requireStatus(t, backend, nil)
+	status := initialStatus
 	for _, tc := range []struct {
 		n  string
 		fn func(*testing.T, *stakingTestsState, api.Backend, consensusAPI.Backend)
@@ -187,13 +208,22 @@ func StakingClientImplementationTests(t *testing.T, backend api.Backend, consens
 		{"Transfer", testTransfer},
 		{"TransferSelf", testSelfTransfer},
 		{"Burn", testBurn},
+		{"TransferBurnAddress", testTransferBurnAddress},
+		{"TransferReservedAccount", testTransferReservedAccount},
 		{"Escrow", testEscrow},
 		{"EscrowSelf", testSelfEscrow},
 		{"Allowance", testAllowance},
+		{"AllowanceLimit", testAllowanceLimit},
+		{"AccountMetadata", testAccountMetadata},
+		{"TransferLimit", testTransferLimit},
+		{"Fees", testFees},
+		{"GetTransactionNotFound", testGetTransactionNotFound},
 	} {
 		state := newStakingTestsState(t, backend, consensus)
 		t.Run(tc.n, func(t *testing.T) { tc.fn(t, state, backend, consensus) })
+		status = requireStatus(t, backend, status)
 	}
+	require.Greater(t, status.LatestHeight, initialStatus.LatestHeight, "GetStatus - latest height should increase")
 }
 
 func testThresholds(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
@@ -488,8 +518,13 @@ func testTransferHelper(
 		Amount: *quantity.NewFromUint64(math.MaxUint8),
 	}
 	tx := api.NewTransferTx(srcAcc.General.Nonce, nil, xfer)
-	err = consensusAPI.SignAndSubmitTx(context.Background(), consensus, srcAccData.Signer, tx)
+	err = consensus.SubmissionManager().EstimateGasAndSetFee(context.Background(), srcAccData.Signer, tx)
+	require.NoError(err, "EstimateGasAndSetFee")
+	sigTx, err := transaction.Sign(srcAccData.Signer, tx)
+	require.NoError(err, "Sign")
+	err = consensus.SubmitTx(context.Background(), sigTx)
 	require.NoError(err, "Transfer")
+	txHash := sigTx.Hash()
 
 	var gotTransfer bool
 
@@ -512,6 +547,8 @@ TransferWaitLoop:
 			}
 
 			if !gotTransfer {
+				require.Equal(txHash, ev.TxHash, "Event: txn hash should match the submitted transaction")
+				require.Equal(&srcAccData.Address, ev.Signer, "Event: signer")
 				require.Equal(srcAccData.Address, te.From, "Event: from")
 				require.Equal(destAccData.Address, te.To, "Event: to")
 				require.Equal(xfer.Amount, te.Amount, "Event: amount")
@@ -523,7 +560,8 @@ TransferWaitLoop:
 					if evt.Transfer != nil {
 						if evt.Transfer.From.Equal(te.From) && evt.Transfer.To.Equal(te.To) && evt.Transfer.Amount.Cmp(&te.Amount) == 0 {
 							gotTransfer = true
-							require.True(!evt.TxHash.IsEmpty(), "GetEvents should return valid txn hash")
+							require.Equal(txHash, evt.TxHash, "GetEvents should return valid txn hash")
+							require.Equal(&srcAccData.Address, evt.Signer, "GetEvents should return valid signer")
 							break
 						}
 					}
@@ -539,6 +577,23 @@ TransferWaitLoop:
 		}
 	}
 
+	// Make sure that the transaction result can be queried by its hash.
+	result := waitForTransaction(t, backend, txHash)
+	require.True(result.IsSuccess(), "GetTransaction: transaction should succeed")
+	require.NoError(result.Error.Err(), "GetTransaction: error")
+	var gotResultTransfer bool
+	for _, evt := range result.Events {
+		require.Equal(result.Height, evt.Height, "GetTransaction: event height")
+		require.Equal(txHash, evt.TxHash, "GetTransaction: event txn hash")
+		require.Equal(&srcAccData.Address, evt.Signer, "GetTransaction: event signer")
+		if evt.Transfer != nil && evt.Transfer.To.Equal(destAccData.Address) {
+			require.Equal(srcAccData.Address, evt.Transfer.From, "GetTransaction: transfer from")
+			require.Equal(xfer.Amount, evt.Transfer.Amount, "GetTransaction: transfer amount")
+			gotResultTransfer = true
+		}
+	}
+	require.True(gotResultTransfer, "GetTransaction should return transfer event")
+
 	newSrcAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: consensusAPI.HeightLatest})
 	require.NoError(err, "src: Account - after")
 	require.Equal(tx.Nonce+1, newSrcAcc.General.Nonce, "src: nonce - after")
@@ -567,6 +622,183 @@ TransferWaitLoop:
 	require.Error(err, "Transfer - more than available balance")
 }
 
+func testFees(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	srcAccData := state.accounts.getAccount(1)
+	destAccData := state.accounts.getAccount(2)
+	xfer := &api.Transfer{
+		To:     destAccData.Address,
+		Amount: *quantity.NewFromUint64(100),
+	}
+
+	accounts := func() (*api.Account, *api.Account) {
+		src, err := backend.Account(ctx, &api.OwnerQuery{Owner: srcAccData.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "src: Account")
+		dst, err := backend.Account(ctx, &api.OwnerQuery{Owner: destAccData.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "dest: Account")
+		return src, dst
+	}
+	submitTransfer := func(fee *transaction.Fee) error {
+		src, _ := accounts()
+		sigTx, err := transaction.Sign(srcAccData.Signer, api.NewTransferTx(src.General.Nonce, fee, xfer))
+		require.NoError(err, "Sign")
+		return consensus.SubmitTx(ctx, sigTx)
+	}
+
+	gas, err := consensus.EstimateGas(ctx, &consensusAPI.EstimateGasRequest{
+		Signer:      srcAccData.Signer.Public(),
+		Transaction: api.NewTransferTx(0, &transaction.Fee{}, xfer),
+	})
+	require.NoError(err, "EstimateGas")
+
+	// Fees exceeding the general balance should be rejected without any state changes.
+	src, dst := accounts()
+	fee := &transaction.Fee{
+		Amount: *src.General.Balance.Clone(),
+		Gas:    gas,
+	}
+	require.NoError(fee.Amount.Add(&qtyOne))
+	err = submitTransfer(fee)
+	require.ErrorIs(err, transaction.ErrInsufficientFeeBalance, "Transfer - insufficient fee balance")
+	newSrc, newDst := accounts()
+	require.Equal(src.General.Nonce, newSrc.General.Nonce, "src: nonce - insufficient fee balance")
+	require.Equal(src.General.Balance, newSrc.General.Balance, "src: general balance - insufficient fee balance")
+	require.Equal(dst.General.Balance, newDst.General.Balance, "dest: general balance - insufficient fee balance")
+
+	// Gas limits below the gas needed by the transfer should not execute it.
+	if gas > 0 {
+		err = submitTransfer(&transaction.Fee{Gas: gas - 1})
+		require.Error(err, "Transfer - out of gas")
+		_, newDst = accounts()
+		require.Equal(dst.General.Balance, newDst.General.Balance, "dest: general balance - out of gas")
+	}
+
+	// Transfers with sufficient gas should pay the fee in addition to the transferred amount.
+	src, dst = accounts()
+	fee = &transaction.Fee{
+		Amount: *quantity.NewFromUint64(10),
+		Gas:    gas,
+	}
+	err = submitTransfer(fee)
+	require.NoError(err, "Transfer")
+	newSrc, newDst = accounts()
+	require.Equal(src.General.Nonce+1, newSrc.General.Nonce, "src: nonce - after")
+	require.NoError(src.General.Balance.Sub(&xfer.Amount))
+	require.NoError(src.General.Balance.Sub(&fee.Amount))
+	require.Equal(src.General.Balance, newSrc.General.Balance, "src: general balance - after")
+	require.NoError(dst.General.Balance.Add(&xfer.Amount))
+	require.Equal(dst.General.Balance, newDst.General.Balance, "dest: general balance - after")
+}
+
+// waitForTransaction waits for the result of the transaction with the given hash to become
+// available, as the backend may index transactions after their events have been delivered.
+func waitForTransaction(t *testing.T, backend api.Backend, txHash hash.Hash) *api.TransactionResult {
+	require := require.New(t)
+
+	deadline := time.After(recvTimeout)
+	for {
+		result, err := backend.GetTransaction(context.Background(), txHash)
+		switch {
+		case err == nil:
+			return result
+		case errors.Is(err, api.ErrTransactionNotFound), errors.Is(err, api.ErrTransactionPending):
+		default:
+			require.NoError(err, "GetTransaction")
+		}
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("failed to get transaction result: %s", err)
+		}
+	}
+}
+
+// requireStatus checks that the status reported by the backend is consistent with its state and
+// with the previously reported status (if any) and returns it.
+func requireStatus(t *testing.T, backend api.Backend, prev *api.Status) *api.Status {
+	require := require.New(t)
+	ctx := context.Background()
+
+	status, err := backend.GetStatus(ctx)
+	require.NoError(err, "GetStatus")
+	if prev != nil {
+		require.GreaterOrEqual(status.LatestHeight, prev.LatestHeight, "GetStatus - latest height should not decrease")
+		require.Equal(prev.GenesisHash, status.GenesisHash, "GetStatus - genesis hash should not change")
+	}
+	if status.LatestHeight == 0 {
+		require.False(status.EventsLive, "GetStatus - events should not be live before any blocks")
+		return status
+	}
+
+	addresses, err := backend.Addresses(ctx, status.LatestHeight)
+	require.NoError(err, "Addresses")
+	require.EqualValues(len(addresses), status.NumAccounts, "GetStatus - number of accounts")
+	totalSupply, err := backend.TotalSupply(ctx, status.LatestHeight)
+	require.NoError(err, "TotalSupply")
+	require.Equal(*totalSupply, status.TotalSupply, "GetStatus - total supply")
+
+	// The balances of all accounts, including the reserved module accounts, should add up to the
+	// total supply.
+	var sum quantity.Quantity
+	for _, addr := range addresses {
+		acc, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: status.LatestHeight})
+		require.NoError(err, "Account")
+		for _, balance := range []*quantity.Quantity{
+			&acc.General.Balance,
+			&acc.Escrow.Active.Balance,
+			&acc.Escrow.Debonding.Balance,
+		} {
+			require.NoError(sum.Add(balance), "Add")
+		}
+	}
+	require.Equal(*totalSupply, sum, "sum of all account balances should match total supply")
+	for _, addr := range api.ReservedAccountAddresses {
+		acc, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: status.LatestHeight})
+		require.NoError(err, "Account - reserved")
+		require.Equal(!acc.General.Balance.IsZero(), containsAddress(addresses, addr),
+			"Addresses - reserved account %s should be included iff its balance is non-zero", addr)
+	}
+	return status
+}
+
+func containsAddress(addrs []api.Address, addr api.Address) bool {
+	for _, a := range addrs {
+		if a.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustDebugController returns the debug controller of the given backend, skipping the test in case
+// the backend does not allow controlling the passage of time.
+//
+// Time-dependent tests must call this before making any state changes.
+func mustDebugController(t *testing.T, backend api.Backend) api.DebugController {
+	ctrl, ok := backend.(api.DebugController)
+	if !ok {
+		t.Skip("backend does not implement a debug controller")
+	}
+	_, err := ctrl.AdvanceEpoch(context.Background(), 0)
+	if errors.Is(err, api.ErrDebugControllerDisabled) {
+		t.Skipf("backend debug controller not enabled: %s", err)
+	}
+	require.NoError(t, err, "AdvanceEpoch")
+	return ctrl
+}
+
+func testGetTransactionNotFound(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+
+	var txHash hash.Hash
+	txHash.FromBytes([]byte("staking/tests: unknown transaction"))
+	_, err := backend.GetTransaction(context.Background(), txHash)
+	require.ErrorIs(err, api.ErrTransactionNotFound, "GetTransaction should fail for unknown transactions")
+}
+
 func testBurn(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
 	require := require.New(t)
 
@@ -630,10 +862,113 @@ func testBurn(t *testing.T, state *stakingTestsState, backend api.Backend, conse
 	require.EqualValues(tx.Nonce+1, newSrcAcc.General.Nonce, "src: nonce - after")
 }
 
+func testTransferBurnAddress(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	accData := state.accounts.getAccount(1)
+
+	totalSupply, err := backend.TotalSupply(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "TotalSupply - before")
+
+	acc, err := backend.Account(ctx, &api.OwnerQuery{Owner: accData.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "src: Account")
+
+	ch, sub, err := backend.WatchEvents(ctx)
+	require.NoError(err, "WatchEvents")
+	defer sub.Close()
+
+	xfer := &api.Transfer{
+		To:     api.BurnAddress,
+		Amount: *quantity.NewFromUint64(math.MaxUint8),
+	}
+	tx := api.NewTransferTx(acc.General.Nonce, nil, xfer)
+	err = consensusAPI.SignAndSubmitTx(ctx, consensus, accData.Signer, tx)
+	require.NoError(err, "Transfer")
+
+	select {
+	case ev := <-ch:
+		if ev.Burn == nil {
+			t.Fatalf("expected burn event, got: %+v", ev)
+		}
+		require.Equal(accData.Address, ev.Burn.Owner, "Event: owner")
+		require.Equal(xfer.Amount, ev.Burn.Amount, "Event: amount")
+	case <-time.After(recvTimeout):
+		t.Fatalf("failed to receive burn event")
+	}
+
+	_ = totalSupply.Sub(&xfer.Amount)
+	newTotalSupply, err := backend.TotalSupply(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "TotalSupply - after")
+	require.Equal(totalSupply, newTotalSupply, "totalSupply is reduced by transfer to burn address")
+
+	_ = acc.General.Balance.Sub(&xfer.Amount)
+	newSrcAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: accData.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "src: Account")
+	require.Equal(acc.General.Balance, newSrcAcc.General.Balance, "src: general balance - after")
+	require.EqualValues(tx.Nonce+1, newSrcAcc.General.Nonce, "src: nonce - after")
+
+	addresses, err := backend.Addresses(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "Addresses")
+	require.NotContains(addresses, api.BurnAddress, "burn address should not have a ledger entry")
+
+	burnAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: api.BurnAddress, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "burn: Account")
+	require.True(burnAcc.General.Balance.IsZero(), "burn: general balance should be zero")
+	require.True(burnAcc.Escrow.Active.Balance.IsZero(), "burn: active escrow balance should be zero")
+}
+
+func testTransferReservedAccount(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	src := Accounts.getAccount(1)
+	amount := quantity.NewFromUint64(math.MaxUint8)
+	for _, addr := range api.ReservedAccountAddresses {
+		before, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "reserved: Account - before")
+
+		err = submitTransfer(t, backend, consensus, src, addr, amount)
+		require.ErrorIs(err, api.ErrForbidden, "Transfer - reserved account %s", addr)
+
+		after, err := backend.Account(ctx, &api.OwnerQuery{Owner: addr, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "reserved: Account - after")
+		// The fee accumulator may be credited with fees of other transactions in the meantime.
+		if !addr.Equal(api.FeeAccumulatorAddress) {
+			require.Equal(before.General.Balance, after.General.Balance, "reserved: general balance should not change")
+		}
+	}
+
+	srcAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: src.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "src: Account")
+	require.Equal(state.accounts.getAccount(1).generalBalance, srcAcc.General.Balance,
+		"src: failed transfers should not change the balance")
+}
+
 func testEscrow(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
 	testEscrowHelper(t, state, backend, consensus, state.accounts.getAccount(1), state.accounts.getAccount(2))
 }
 
+// requireEscrowBalances checks that the balances embedded in an escrow event match the account
+// state at the height the event was emitted at.
+func requireEscrowBalances(
+	t *testing.T,
+	backend api.Backend,
+	height int64,
+	owner, escrow api.Address,
+	balances *api.EscrowBalances,
+) {
+	require := require.New(t)
+
+	require.NotNil(balances, "Event: balances")
+
+	ownerAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: owner, Height: height})
+	require.NoError(err, "owner: Account")
+	escrowAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: escrow, Height: height})
+	require.NoError(err, "escrow: Account")
+	require.Equal(api.NewEscrowBalances(ownerAcc, escrowAcc), balances, "Event: balances should match account state")
+}
+
 func testSelfEscrow(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
 	testEscrowHelper(t, state, backend, consensus, state.accounts.getAccount(1), state.accounts.getAccount(1))
 }
@@ -646,6 +981,7 @@ func testEscrowHelper( // nolint: gocyclo
 	srcAccData, destAccData accountData,
 ) {
 	require := require.New(t)
+	ctrl := mustDebugController(t, backend)
 
 	srcAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: consensusAPI.HeightLatest})
 	require.NoError(err, "src: Account - before")
@@ -670,6 +1006,10 @@ func testEscrowHelper( // nolint: gocyclo
 
 	totalEscrowed := dstAcc.Escrow.Active.Balance.Clone()
 
+	// Height of the most recently received escrow event, used to query account state that matches
+	// the balances embedded in the event.
+	var evHeight int64
+
 	// Escrow.
 	amount := srcAcc.General.Balance.Clone()
 	_ = amount.Quo(quantity.NewFromUint64(2))
@@ -693,6 +1033,8 @@ func testEscrowHelper( // nolint: gocyclo
 		require.Equal(srcAccData.Address, ev.Owner, "Event: owner")
 		require.Equal(destAccData.Address, ev.Escrow, "Event: escrow")
 		require.Equal(escrow.Amount, ev.Amount, "Event: amount")
+		evHeight = rawEv.Height
+		requireEscrowBalances(t, backend, evHeight, ev.Owner, ev.Escrow, ev.Balances)
 
 		// Make sure that GetEvents also returns the add escrow event.
 		evts, grr := backend.GetEvents(context.Background(), consensusAPI.HeightLatest)
@@ -716,7 +1058,7 @@ func testEscrowHelper( // nolint: gocyclo
 	newShares, err := dstAcc.Escrow.Active.Deposit(currentTotalShares, &srcAcc.General.Balance, &escrow.Amount)
 	require.NoError(err, "src: deposit")
 
-	newSrcAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: consensusAPI.HeightLatest})
+	newSrcAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: evHeight})
 	require.NoError(err, "src: Account - after")
 	require.Equal(srcAcc.General.Balance, newSrcAcc.General.Balance, "src: general balance - after")
 	if !srcAccData.Address.Equal(destAccData.Address) {
@@ -725,7 +1067,7 @@ func testEscrowHelper( // nolint: gocyclo
 	}
 	require.Equal(tx.Nonce+1, newSrcAcc.General.Nonce, "src: nonce - after")
 
-	newDstAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: destAccData.Address, Height: consensusAPI.HeightLatest})
+	newDstAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: destAccData.Address, Height: evHeight})
 	require.NoError(err, "dst: Account - after")
 	if !srcAccData.Address.Equal(destAccData.Address) {
 		require.Equal(dstAcc.General.Balance, newDstAcc.General.Balance, "dst: general balance - after")
@@ -770,6 +1112,8 @@ func testEscrowHelper( // nolint: gocyclo
 		require.Equal(srcAccData.Address, ev.Owner, "Event: owner")
 		require.Equal(destAccData.Address, ev.Escrow, "Event: escrow")
 		require.Equal(escrow.Amount, ev.Amount, "Event: amount")
+		evHeight = rawEv.Height
+		requireEscrowBalances(t, backend, evHeight, ev.Owner, ev.Escrow, ev.Balances)
 
 		// Make sure that GetEvents also returns the add escrow event.
 		evts, grr := backend.GetEvents(context.Background(), consensusAPI.HeightLatest)
@@ -793,7 +1137,7 @@ func testEscrowHelper( // nolint: gocyclo
 	newShares, err = dstAcc.Escrow.Active.Deposit(currentTotalShares, &srcAcc.General.Balance, &escrow.Amount)
 	require.NoError(err, "src: deposit - after 2nd")
 
-	newSrcAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: consensusAPI.HeightLatest})
+	newSrcAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: evHeight})
 	require.NoError(err, "src: Account - after 2nd")
 	require.Equal(srcAcc.General.Balance, newSrcAcc.General.Balance, "src: general balance - after 2nd")
 	if !srcAccData.Address.Equal(destAccData.Address) {
@@ -802,7 +1146,7 @@ func testEscrowHelper( // nolint: gocyclo
 	}
 	require.Equal(tx.Nonce+1, newSrcAcc.General.Nonce, "src: nonce - after 2nd")
 
-	newDstAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: destAccData.Address, Height: consensusAPI.HeightLatest})
+	newDstAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: destAccData.Address, Height: evHeight})
 	require.NoError(err, "dst: Account - after 2nd")
 	if !srcAccData.Address.Equal(destAccData.Address) {
 		require.Equal(dstAcc.General.Balance, newDstAcc.General.Balance, "dst: general balance - after 2nd")
@@ -876,8 +1220,8 @@ func testEscrowHelper( // nolint: gocyclo
 	require.Len(debs[destAccData.Address], 1, "one debonding delegation after reclaiming escrow")
 
 	// Advance epoch to trigger debonding.
-	timeSource := consensus.Beacon().(beacon.SetableBackend)
-	beaconTests.MustAdvanceEpoch(t, timeSource)
+	_, err = ctrl.AdvanceEpoch(context.Background(), 1)
+	require.NoError(err, "AdvanceEpoch")
 
 	// Wait for debonding period to pass.
 	select {
@@ -891,6 +1235,8 @@ func testEscrowHelper( // nolint: gocyclo
 		require.Equal(srcAccData.Address, ev.Owner, "Event: owner")
 		require.Equal(destAccData.Address, ev.Escrow, "Event: escrow")
 		require.Equal(totalEscrowed, &ev.Amount, "Event: amount")
+		evHeight = rawEv.Height
+		requireEscrowBalances(t, backend, evHeight, ev.Owner, ev.Escrow, ev.Balances)
 
 		// Make sure that GetEvents also returns the reclaim escrow event.
 		evts, grr := backend.GetEvents(context.Background(), consensusAPI.HeightLatest)
@@ -910,7 +1256,7 @@ func testEscrowHelper( // nolint: gocyclo
 	}
 
 	_ = srcAcc.General.Balance.Add(totalEscrowed)
-	newSrcAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: consensusAPI.HeightLatest})
+	newSrcAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: srcAccData.Address, Height: evHeight})
 	require.NoError(err, "src: Account - after debond")
 	require.Equal(srcAcc.General.Balance, newSrcAcc.General.Balance, "src: general balance - after debond")
 	if !srcAccData.Address.Equal(destAccData.Address) {
@@ -919,7 +1265,7 @@ func testEscrowHelper( // nolint: gocyclo
 	}
 	require.Equal(tx.Nonce+1, newSrcAcc.General.Nonce, "src: nonce - after debond")
 
-	newDstAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: destAccData.Address, Height: consensusAPI.HeightLatest})
+	newDstAcc, err = backend.Account(context.Background(), &api.OwnerQuery{Owner: destAccData.Address, Height: evHeight})
 	require.NoError(err, "dst: Account - after debond")
 	if !srcAccData.Address.Equal(destAccData.Address) {
 		require.Equal(dstAcc.General.Balance, newDstAcc.General.Balance, "dst: general balance - after debond")
@@ -1037,7 +1383,7 @@ AllowWaitLoop:
 		Height:      consensusAPI.HeightLatest,
 	})
 	require.NoError(err, "Allowance")
-	require.Equal(expectedNewAllowance, *newAllowance, "Allowance should return the correct value")
+	require.Equal(expectedNewAllowance, newAllowance.Amount, "Allowance should return the correct value")
 
 	// Withdraw half the amount.
 	withdraw := &api.Withdraw{
@@ -1100,7 +1446,278 @@ AllowWaitLoop:
 		Height:      consensusAPI.HeightLatest,
 	})
 	require.NoError(err, "Allowance")
-	require.Equal(expectedNewAllowance, *newAllowance, "Allowance should return the correct value")
+	require.Equal(expectedNewAllowance, newAllowance.Amount, "Allowance should return the correct value")
+}
+
+// submitAllow submits an allowance change from the given owner.
+func submitAllow(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, owner account, allow *api.Allow) error {
+	acc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: owner.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(t, err, "Account")
+
+	tx := api.NewAllowTx(acc.General.Nonce, nil, allow)
+	return consensusAPI.SignAndSubmitTx(context.Background(), consensus, owner.Signer, tx)
+}
+
+func testAllowanceLimit(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	params, err := backend.ConsensusParameters(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "ConsensusParameters")
+	require.NotZero(params.MaxAllowances, "allowances must be enabled")
+
+	owner := fundNewAccount(t, backend, consensus, quantity.NewFromUint64(1000))
+	allowances := func() map[api.Address]*api.Allowance {
+		list, grr := backend.Allowances(ctx, &api.OwnerQuery{Owner: owner.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(grr, "Allowances")
+		return list
+	}
+	require.Empty(allowances(), "Allowances should be empty for a new account")
+
+	// Configure the maximum number of allowances.
+	beneficiaries := make([]api.Address, 0, params.MaxAllowances)
+	for i := uint32(0); i < params.MaxAllowances; i++ {
+		beneficiary := newAccount().Address
+		err = submitAllow(t, backend, consensus, owner, &api.Allow{
+			Beneficiary:  beneficiary,
+			AmountChange: *quantity.NewFromUint64(uint64(i) + 1),
+		})
+		require.NoError(err, "Allow")
+		beneficiaries = append(beneficiaries, beneficiary)
+	}
+
+	list := allowances()
+	require.Len(list, int(params.MaxAllowances), "Allowances should return all allowances")
+	for i, beneficiary := range beneficiaries {
+		require.Contains(list, beneficiary, "Allowances should include each beneficiary")
+		require.EqualValues(*quantity.NewFromUint64(uint64(i) + 1), list[beneficiary].Amount, "Allowances should return the correct amount")
+	}
+
+	// Adding another allowance should fail.
+	extra := newAccount().Address
+	err = submitAllow(t, backend, consensus, owner, &api.Allow{
+		Beneficiary:  extra,
+		AmountChange: *qtyOne.Clone(),
+	})
+	require.ErrorIs(err, api.ErrTooManyAllowances, "Allow - over the limit")
+
+	// Changing an existing allowance should still succeed.
+	err = submitAllow(t, backend, consensus, owner, &api.Allow{
+		Beneficiary:  beneficiaries[1],
+		AmountChange: *qtyOne.Clone(),
+	})
+	require.NoError(err, "Allow - existing beneficiary")
+
+	// Reducing an allowance to zero should free a slot.
+	err = submitAllow(t, backend, consensus, owner, &api.Allow{
+		Beneficiary:  beneficiaries[0],
+		Negative:     true,
+		AmountChange: *quantity.NewFromUint64(1),
+	})
+	require.NoError(err, "Allow - reduce to zero")
+	list = allowances()
+	require.Len(list, int(params.MaxAllowances)-1, "zero allowances should be removed")
+	require.NotContains(list, beneficiaries[0], "zero allowances should be removed")
+
+	err = submitAllow(t, backend, consensus, owner, &api.Allow{
+		Beneficiary:  extra,
+		AmountChange: *qtyOne.Clone(),
+	})
+	require.NoError(err, "Allow - freed slot")
+	list = allowances()
+	require.Len(list, int(params.MaxAllowances), "Allowances should include the new allowance")
+	require.Contains(list, extra, "Allowances should include the new allowance")
+}
+
+// submitSetMetadata submits a metadata update from the given account.
+func submitSetMetadata(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, owner account, metadata []byte) error {
+	acc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: owner.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(t, err, "Account")
+
+	tx := api.NewSetMetadataTx(acc.General.Nonce, nil, &api.SetMetadata{Metadata: metadata})
+	return consensusAPI.SignAndSubmitTx(context.Background(), consensus, owner.Signer, tx)
+}
+
+func testAccountMetadata(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	params, err := backend.ConsensusParameters(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "ConsensusParameters")
+
+	owner := fundNewAccount(t, backend, consensus, quantity.NewFromUint64(1000))
+	metadata := func() []byte {
+		md, grr := backend.AccountMetadata(ctx, &api.OwnerQuery{Owner: owner.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(grr, "AccountMetadata")
+		return md
+	}
+	require.Empty(metadata(), "AccountMetadata should be empty for a new account")
+
+	ch, sub, err := backend.WatchEvents(ctx)
+	require.NoError(err, "WatchEvents")
+	defer sub.Close()
+
+	waitForMetadataUpdated := func(expected []byte) {
+		for {
+			select {
+			case ev := <-ch:
+				if ev.MetadataUpdated == nil || !ev.MetadataUpdated.Owner.Equal(owner.Address) {
+					continue
+				}
+				require.EqualValues(expected, ev.MetadataUpdated.Metadata, "Event: metadata")
+				return
+			case <-time.After(recvTimeout):
+				t.Fatalf("failed to receive metadata updated event")
+			}
+		}
+	}
+
+	// Set metadata.
+	md1 := []byte("name: test validator")
+	err = submitSetMetadata(t, backend, consensus, owner, md1)
+	require.NoError(err, "SetMetadata")
+	waitForMetadataUpdated(md1)
+	require.EqualValues(md1, metadata(), "AccountMetadata should return the set metadata")
+
+	// Overwrite metadata with metadata of the maximum size.
+	md2 := make([]byte, api.MaxAccountMetadataSize)
+	for i := range md2 {
+		md2[i] = byte(i)
+	}
+	err = submitSetMetadata(t, backend, consensus, owner, md2)
+	require.NoError(err, "SetMetadata - overwrite")
+	waitForMetadataUpdated(md2)
+	require.EqualValues(md2, metadata(), "AccountMetadata should return the overwritten metadata")
+
+	// Oversized metadata should be rejected and leave the existing metadata intact.
+	err = submitSetMetadata(t, backend, consensus, owner, make([]byte, api.MaxAccountMetadataSize+1))
+	require.ErrorIs(err, api.ErrMetadataTooLarge, "SetMetadata - oversized")
+	require.EqualValues(md2, metadata(), "oversized metadata should not be stored")
+
+	// Accounts below the minimum metadata balance should not be able to set metadata.
+	if !params.MinMetadataBalance.IsZero() {
+		poor := newAccount()
+		err = submitSetMetadata(t, backend, consensus, poor, md1)
+		require.ErrorIs(err, api.ErrInsufficientBalance, "SetMetadata - below minimum metadata balance")
+	}
+
+	// Metadata should be included in the genesis state and survive a round-trip.
+	genesis, err := backend.StateToGenesis(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "StateToGenesis")
+	require.Contains(genesis.Ledger, owner.Address, "genesis ledger should contain the account")
+	require.EqualValues(md2, genesis.Ledger[owner.Address].General.Metadata, "genesis should include metadata")
+
+	var decGenesis api.Genesis
+	err = cbor.Unmarshal(cbor.Marshal(genesis), &decGenesis)
+	require.NoError(err, "Unmarshal")
+	require.EqualValues(md2, decGenesis.Ledger[owner.Address].General.Metadata, "metadata should round-trip")
+
+	// Clear metadata.
+	err = submitSetMetadata(t, backend, consensus, owner, nil)
+	require.NoError(err, "SetMetadata - clear")
+	waitForMetadataUpdated(nil)
+	require.Empty(metadata(), "AccountMetadata should be empty after clearing")
+}
+
+// submitSetTransferLimit submits a transfer limit update from the given account.
+func submitSetTransferLimit(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, owner account, stl *api.SetTransferLimit) error {
+	acc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: owner.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(t, err, "Account")
+
+	tx := api.NewSetTransferLimitTx(acc.General.Nonce, nil, stl)
+	return consensusAPI.SignAndSubmitTx(context.Background(), consensus, owner.Signer, tx)
+}
+
+func testTransferLimit(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+	ctrl := mustDebugController(t, backend)
+
+	params, err := backend.ConsensusParameters(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "ConsensusParameters")
+	require.EqualValues(1, params.TransferLimitRemovalDelay, "test requires a removal delay of one epoch")
+
+	epoch, err := ctrl.AdvanceEpoch(ctx, 0)
+	require.NoError(err, "AdvanceEpoch")
+
+	dst := newAccount()
+	transferLimit := func(acct account) *api.TransferLimit {
+		acc, grr := backend.Account(ctx, &api.OwnerQuery{Owner: acct.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(grr, "Account")
+		return acc.General.TransferLimit
+	}
+	requireLimitExceeded := func(err error, remaining uint64, msg string) {
+		require.ErrorIs(err, api.ErrTransferLimitExceeded, msg)
+		require.Contains(err.Error(), fmt.Sprintf("%d remaining", remaining), msg+": error should include the remaining amount")
+	}
+
+	// Both accounts are limited to 100 base units per epoch, the second one requests removal of
+	// the limit so that a single epoch transition exercises both the reset and the removal.
+	limited := fundNewAccount(t, backend, consensus, quantity.NewFromUint64(1000))
+	removed := fundNewAccount(t, backend, consensus, quantity.NewFromUint64(1000))
+	for _, acct := range []account{limited, removed} {
+		err = submitSetTransferLimit(t, backend, consensus, acct, &api.SetTransferLimit{Amount: *quantity.NewFromUint64(100)})
+		require.NoError(err, "SetTransferLimit")
+	}
+
+	// Exhaust the limit across two transfers.
+	err = submitTransfer(t, backend, consensus, limited, dst.Address, quantity.NewFromUint64(60))
+	require.NoError(err, "Transfer - first")
+	err = submitTransfer(t, backend, consensus, limited, dst.Address, quantity.NewFromUint64(40))
+	require.NoError(err, "Transfer - second")
+	err = submitTransfer(t, backend, consensus, limited, dst.Address, quantity.NewFromUint64(1))
+	requireLimitExceeded(err, 0, "Transfer - third")
+
+	// Escrow is also subject to the limit.
+	escrowTx := func(acct account, amount uint64) error {
+		acc, grr := backend.Account(ctx, &api.OwnerQuery{Owner: acct.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(grr, "Account")
+		tx := api.NewAddEscrowTx(acc.General.Nonce, nil, &api.Escrow{Account: acct.Address, Amount: *quantity.NewFromUint64(amount)})
+		return consensusAPI.SignAndSubmitTx(ctx, consensus, acct.Signer, tx)
+	}
+	err = escrowTx(limited, 10)
+	requireLimitExceeded(err, 0, "AddEscrow")
+
+	// Transfers to self do not move any tokens out of the account.
+	err = submitTransfer(t, backend, consensus, limited, limited.Address, quantity.NewFromUint64(500))
+	require.NoError(err, "Transfer - self")
+
+	// Limits can be lowered, but not raised.
+	err = submitSetTransferLimit(t, backend, consensus, limited, &api.SetTransferLimit{Amount: *quantity.NewFromUint64(200)})
+	require.ErrorIs(err, api.ErrForbidden, "SetTransferLimit - raise")
+	err = submitSetTransferLimit(t, backend, consensus, limited, &api.SetTransferLimit{Amount: *quantity.NewFromUint64(80)})
+	require.NoError(err, "SetTransferLimit - lower")
+
+	// Request removal of the second account's limit, which should only take effect after the
+	// removal delay.
+	err = submitTransfer(t, backend, consensus, removed, dst.Address, quantity.NewFromUint64(70))
+	require.NoError(err, "Transfer - before removal")
+	err = submitSetTransferLimit(t, backend, consensus, removed, &api.SetTransferLimit{Remove: true})
+	require.NoError(err, "SetTransferLimit - remove")
+	limit := transferLimit(removed)
+	require.NotNil(limit, "limit should remain in effect until the removal delay passes")
+	require.EqualValues(epoch+params.TransferLimitRemovalDelay, limit.RemovalEpoch, "removal epoch")
+	err = submitTransfer(t, backend, consensus, removed, dst.Address, quantity.NewFromUint64(31))
+	requireLimitExceeded(err, 30, "Transfer - removal pending")
+
+	// Advance the epoch, which resets the first limit and removes the second one.
+	newEpoch, err := ctrl.AdvanceEpoch(ctx, 1)
+	require.NoError(err, "AdvanceEpoch")
+	require.EqualValues(limit.RemovalEpoch, newEpoch, "removal epoch should be reached")
+
+	err = submitTransfer(t, backend, consensus, limited, dst.Address, quantity.NewFromUint64(81))
+	requireLimitExceeded(err, 80, "Transfer - above limit after epoch transition")
+	err = submitTransfer(t, backend, consensus, limited, dst.Address, quantity.NewFromUint64(80))
+	require.NoError(err, "Transfer - limit should reset after epoch transition")
+	require.NotNil(transferLimit(limited), "limit should remain in effect")
+
+	err = submitTransfer(t, backend, consensus, removed, dst.Address, quantity.NewFromUint64(500))
+	require.NoError(err, "Transfer - limit should be removed after the removal delay")
+	require.Nil(transferLimit(removed), "removed limit should be cleared")
+
+	// Removing a non-existent limit is invalid.
+	err = submitSetTransferLimit(t, backend, consensus, removed, &api.SetTransferLimit{Remove: true})
+	require.ErrorIs(err, api.ErrInvalidArgument, "SetTransferLimit - remove non-existent")
 }
 
 func testSlashConsensusEquivocation(
@@ -1204,3 +1821,245 @@ WaitLoop:
 		t.Fatalf("failed to receive roothash block")
 	}
 }
+
+// StakingMinAccountBalanceTests exercises the minimum account balance handling
+// of a staking backend.
+//
+// The backend must be configured with a non-zero minimum account balance, the
+// tests performed depend on whether dust accounts are reaped.
+func StakingMinAccountBalanceTests(t *testing.T, backend api.Backend, consensus consensusAPI.Backend) {
+	params, err := backend.ConsensusParameters(context.Background(), consensusAPI.HeightLatest)
+	require.NoError(t, err, "ConsensusParameters")
+	require.False(t, params.MinAccountBalance.IsZero(), "minimum account balance must be configured")
+
+	if params.ReapDustAccounts {
+		t.Run("Reap", func(t *testing.T) { testMinAccountBalanceReap(t, params, backend, consensus) })
+	} else {
+		t.Run("Strict", func(t *testing.T) { testMinAccountBalanceStrict(t, params, backend, consensus) })
+	}
+}
+
+// StakingDisableTransfersTests exercises the handling of disabled transfers
+// of a staking backend.
+//
+// The backend must be configured with transfers disabled and only the first
+// test account exempt.
+func StakingDisableTransfersTests(t *testing.T, backend api.Backend, consensus consensusAPI.Backend) {
+	params, err := backend.ConsensusParameters(context.Background(), consensusAPI.HeightLatest)
+	require.NoError(t, err, "ConsensusParameters")
+	require.True(t, params.DisableTransfers, "transfers must be disabled")
+	require.Equal(t, map[api.Address]bool{Accounts.GetAddress(1): true}, params.UndisableTransfersFrom,
+		"only the first test account must be exempt")
+
+	for _, tc := range []struct {
+		n  string
+		fn func(*testing.T, *stakingTestsState, api.Backend, consensusAPI.Backend)
+	}{
+		{"Transfer", testTransfer},
+		{"Escrow", testEscrow},
+		{"EscrowSelf", testSelfEscrow},
+		{"TransferDisabled", testTransferDisabled},
+	} {
+		state := newStakingTestsState(t, backend, consensus)
+		t.Run(tc.n, func(t *testing.T) { tc.fn(t, state, backend, consensus) })
+	}
+}
+
+func testTransferDisabled(t *testing.T, state *stakingTestsState, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+
+	exempt := Accounts.getAccount(1)
+	src := Accounts.getAccount(2)
+	amount := quantity.NewFromUint64(10)
+
+	// Transfers from accounts which are not exempt should fail.
+	err := submitTransfer(t, backend, consensus, src, exempt.Address, amount)
+	require.ErrorIs(err, api.ErrTransfersDisabled, "Transfer - not exempt")
+
+	// So should allowances and withdrawals from them.
+	err = submitAllow(t, backend, consensus, src, &api.Allow{
+		Beneficiary:  exempt.Address,
+		AmountChange: *amount,
+	})
+	require.ErrorIs(err, api.ErrTransfersDisabled, "Allow - not exempt")
+
+	srcAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: src.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "src: Account")
+	require.Equal(state.accounts.getAccount(2).generalBalance, srcAcc.General.Balance,
+		"failed operations should not change the balance")
+
+	// Withdrawals from exempt accounts should succeed.
+	err = allowAndWithdraw(t, backend, consensus, exempt, amount, amount)
+	require.NoError(err, "Withdraw - exempt")
+}
+
+// fundNewAccount transfers the given amount from the first test account to a
+// newly generated account.
+func fundNewAccount(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, amount *quantity.Quantity) account {
+	require := require.New(t)
+
+	src := Accounts.getAccount(1)
+	srcAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: src.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "src: Account")
+
+	acc := newAccount()
+	tx := api.NewTransferTx(srcAcc.General.Nonce, nil, &api.Transfer{To: acc.Address, Amount: *amount})
+	err = consensusAPI.SignAndSubmitTx(context.Background(), consensus, src.Signer, tx)
+	require.NoError(err, "Transfer - fund new account")
+	return acc
+}
+
+// submitTransfer submits a transfer of the given amount from the given account.
+func submitTransfer(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, from account, to api.Address, amount *quantity.Quantity) error {
+	acc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: from.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(t, err, "Account")
+
+	tx := api.NewTransferTx(acc.General.Nonce, nil, &api.Transfer{To: to, Amount: *amount})
+	return consensusAPI.SignAndSubmitTx(context.Background(), consensus, from.Signer, tx)
+}
+
+// allowAndWithdraw configures an allowance from the given owner to the second
+// test account and withdraws the given amount from the owner.
+func allowAndWithdraw(t *testing.T, backend api.Backend, consensus consensusAPI.Backend, owner account, allowance, amount *quantity.Quantity) error {
+	require := require.New(t)
+
+	beneficiary := Accounts.getAccount(2)
+	ownerAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: owner.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "owner: Account")
+	tx := api.NewAllowTx(ownerAcc.General.Nonce, nil, &api.Allow{
+		Beneficiary:  beneficiary.Address,
+		AmountChange: *allowance,
+	})
+	err = consensusAPI.SignAndSubmitTx(context.Background(), consensus, owner.Signer, tx)
+	require.NoError(err, "Allow")
+
+	beneficiaryAcc, err := backend.Account(context.Background(), &api.OwnerQuery{Owner: beneficiary.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "beneficiary: Account")
+	tx = api.NewWithdrawTx(beneficiaryAcc.General.Nonce, nil, &api.Withdraw{
+		From:   owner.Address,
+		Amount: *amount,
+	})
+	return consensusAPI.SignAndSubmitTx(context.Background(), consensus, beneficiary.Signer, tx)
+}
+
+func testMinAccountBalanceStrict(t *testing.T, params *api.ConsensusParameters, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// Fund a new account with twice the minimum balance.
+	balance := params.MinAccountBalance.Clone()
+	require.NoError(balance.Add(&params.MinAccountBalance))
+	acc := fundNewAccount(t, backend, consensus, balance)
+	dst := Accounts.GetAddress(2)
+
+	// Transfers leaving less than the minimum balance should fail.
+	amount := params.MinAccountBalance.Clone()
+	require.NoError(amount.Add(&qtyOne))
+	err := submitTransfer(t, backend, consensus, acc, dst, amount)
+	require.ErrorIs(err, api.ErrBalanceTooLow, "Transfer - leaving dust")
+
+	// Withdrawals leaving less than the minimum balance should fail.
+	err = allowAndWithdraw(t, backend, consensus, acc, balance, amount)
+	require.ErrorIs(err, api.ErrBalanceTooLow, "Withdraw - leaving dust")
+
+	stakingAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.Equal(*balance, stakingAcc.General.Balance, "failed operations should not change the balance")
+
+	// Transfers leaving exactly the minimum balance should succeed.
+	err = submitTransfer(t, backend, consensus, acc, dst, &params.MinAccountBalance)
+	require.NoError(err, "Transfer - leaving minimum balance")
+
+	// Transfers leaving a zero balance should succeed and keep the account.
+	err = submitTransfer(t, backend, consensus, acc, dst, &params.MinAccountBalance)
+	require.NoError(err, "Transfer - leaving zero balance")
+
+	stakingAcc, err = backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+	require.NoError(err, "Account")
+	require.True(stakingAcc.General.Balance.IsZero(), "balance should be zero")
+	require.NotZero(stakingAcc.General.Nonce, "nonce should be kept")
+
+	addresses, err := backend.Addresses(ctx, consensusAPI.HeightLatest)
+	require.NoError(err, "Addresses")
+	require.Contains(addresses, acc.Address, "account should be kept")
+}
+
+func testMinAccountBalanceReap(t *testing.T, params *api.ConsensusParameters, backend api.Backend, consensus consensusAPI.Backend) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	balance := params.MinAccountBalance.Clone()
+	require.NoError(balance.Add(&params.MinAccountBalance))
+	amount := params.MinAccountBalance.Clone()
+	require.NoError(amount.Add(&qtyOne))
+	dust := balance.Clone()
+	require.NoError(dust.Sub(amount))
+
+	for _, tc := range []struct {
+		n  string
+		fn func(acc account) error
+	}{
+		{"Transfer", func(acc account) error {
+			return submitTransfer(t, backend, consensus, acc, Accounts.GetAddress(2), amount)
+		}},
+		{"Withdraw", func(acc account) error {
+			return allowAndWithdraw(t, backend, consensus, acc, balance, amount)
+		}},
+	} {
+		acc := fundNewAccount(t, backend, consensus, balance)
+
+		totalSupply, err := backend.TotalSupply(ctx, consensusAPI.HeightLatest)
+		require.NoError(err, "TotalSupply")
+		commonPool, err := backend.CommonPool(ctx, consensusAPI.HeightLatest)
+		require.NoError(err, "CommonPool")
+		dstAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: Accounts.GetAddress(2), Height: consensusAPI.HeightLatest})
+		require.NoError(err, "dst: Account")
+
+		createdAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+		require.NotZero(createdAcc.General.CreatedAt, "%s: creation height should be recorded", tc.n)
+
+		err = tc.fn(acc)
+		require.NoError(err, "%s - leaving dust", tc.n)
+
+		// The account should be removed, retaining only the nonce of the operation.
+		stakingAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+		require.Equal(api.NewReapedAccount(createdAcc.General.Nonce+1), stakingAcc, "%s: reaped account should only retain its nonce", tc.n)
+
+		addresses, err := backend.Addresses(ctx, consensusAPI.HeightLatest)
+		require.NoError(err, "Addresses")
+		require.NotContains(addresses, acc.Address, "%s: reaped account should be removed", tc.n)
+
+		// The dust should be swept into the common pool.
+		newCommonPool, err := backend.CommonPool(ctx, consensusAPI.HeightLatest)
+		require.NoError(err, "CommonPool")
+		require.NoError(commonPool.Add(dust))
+		require.Equal(commonPool, newCommonPool, "%s: dust should be swept into the common pool", tc.n)
+
+		newDstAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: Accounts.GetAddress(2), Height: consensusAPI.HeightLatest})
+		require.NoError(err, "dst: Account")
+		require.NoError(dstAcc.General.Balance.Add(amount))
+		require.Equal(dstAcc.General.Balance, newDstAcc.General.Balance, "%s: destination should receive the amount", tc.n)
+
+		newTotalSupply, err := backend.TotalSupply(ctx, consensusAPI.HeightLatest)
+		require.NoError(err, "TotalSupply")
+		require.Equal(totalSupply, newTotalSupply, "%s: total supply should be conserved", tc.n)
+
+		// Re-creating the account should continue from the retained nonce with a fresh creation
+		// height, so that transactions signed before the account was reaped cannot be replayed.
+		err = submitTransfer(t, backend, consensus, Accounts.getAccount(1), acc.Address, balance)
+		require.NoError(err, "%s: Transfer - re-create account", tc.n)
+		recreatedAcc, err := backend.Account(ctx, &api.OwnerQuery{Owner: acc.Address, Height: consensusAPI.HeightLatest})
+		require.NoError(err, "Account")
+		require.Equal(stakingAcc.General.Nonce, recreatedAcc.General.Nonce, "%s: re-created account should continue from the retained nonce", tc.n)
+		require.Greater(recreatedAcc.General.CreatedAt, createdAcc.General.CreatedAt, "%s: re-created account should get a fresh creation height", tc.n)
+
+		// Sign the transaction directly as the submission manager would use the current nonce.
+		tx := api.NewTransferTx(createdAcc.General.Nonce, nil, &api.Transfer{To: Accounts.GetAddress(2), Amount: *qtyOne.Clone()})
+		sigTx, err := transaction.Sign(acc.Signer, tx)
+		require.NoError(err, "Sign")
+		err = consensus.SubmitTx(ctx, sigTx)
+		require.ErrorIs(err, transaction.ErrInvalidNonce, "%s: replayed nonce should be rejected", tc.n)
+	}
+}
@@ -48,6 +48,12 @@ var (
 	// ErrWriteLogNotFound indicates that a write log for the specified storage hashes
 	// couldn't be found.
 	ErrWriteLogNotFound = nodedb.ErrWriteLogNotFound
+	// ErrWriteLogNotAvailable indicates that the root pair exists, but its write log has not been
+	// stored.
+	ErrWriteLogNotAvailable = nodedb.ErrWriteLogNotAvailable
+	// ErrWriteLogsPruned indicates that write logs for a requested version have already been
+	// pruned.
+	ErrWriteLogsPruned = nodedb.ErrWriteLogsPruned
 	// ErrNotFinalized indicates that the operation requires a version to be finalized
 	// but the version is not yet finalized.
 	ErrNotFinalized = nodedb.ErrNotFinalized
@@ -63,6 +69,8 @@ var (
 	ErrVersionWentBackwards = nodedb.ErrVersionWentBackwards
 	// ErrRootNotFound indicates that the given root cannot be found.
 	ErrRootNotFound = nodedb.ErrRootNotFound
+	// ErrRootTypeMismatch indicates that the given root exists, but with a different root type.
+	ErrRootTypeMismatch = nodedb.ErrRootTypeMismatch
 	// ErrRootMustFollowOld indicates that the passed new root does not follow old root.
 	ErrRootMustFollowOld = nodedb.ErrRootMustFollowOld
 	// ErrReadOnly indicates that the storage backend is read-only.
@@ -80,8 +88,11 @@ type Config struct { // nolint: maligned
 	// Namespace is the namespace contained within the database.
 	Namespace common.Namespace
 
-	// MaxCacheSize is the maximum in-memory cache size for the database.
-	MaxCacheSize int64
+	// BlockCacheSize is the maximum size of the in-memory block cache for the database.
+	BlockCacheSize int64
+
+	// IndexCacheSize is the maximum size of the in-memory index cache for the database.
+	IndexCacheSize int64
 
 	// DiscardWriteLogs will cause all write logs to be discarded.
 	DiscardWriteLogs bool
@@ -94,6 +105,23 @@ type Config struct { // nolint: maligned
 
 	// ReadOnly will make the storage read-only.
 	ReadOnly bool
+
+	// StrictOpen will cause opening the database to fail instead of automatically recovering
+	// when an inconsistency is detected (e.g., after an unclean shutdown).
+	StrictOpen bool
+
+	// MaxApplySizeDelta is the maximum estimated growth of the state (in bytes) that a single
+	// apply may cause. Zero means no limit.
+	MaxApplySizeDelta int64
+
+	// DivergenceReportSyncer is the read syncer used to fetch the expected tree (e.g., from a peer)
+	// in case an apply results in a root mismatch, so that the divergent keys can be reported via
+	// ExpectedRootMismatchError. If nil, no divergence reports are generated.
+	DivergenceReportSyncer syncer.ReadSyncer
+
+	// DivergenceReportMaxKeys is the maximum number of divergent keys in a divergence report.
+	// Zero means DefaultDivergenceReportMaxKeys.
+	DivergenceReportMaxKeys int
 }
 
 // ToNodeDB converts from a Config to a node DB Config.
@@ -101,11 +129,13 @@ func (cfg *Config) ToNodeDB() *nodedb.Config {
 	return &nodedb.Config{
 		DB:               cfg.DB,
 		Namespace:        cfg.Namespace,
-		MaxCacheSize:     cfg.MaxCacheSize,
+		BlockCacheSize:   cfg.BlockCacheSize,
+		IndexCacheSize:   cfg.IndexCacheSize,
 		NoFsync:          cfg.NoFsync,
 		MemoryOnly:       cfg.MemoryOnly,
 		ReadOnly:         cfg.ReadOnly,
 		DiscardWriteLogs: cfg.DiscardWriteLogs,
+		StrictOpen:       cfg.StrictOpen,
 	}
 }
 
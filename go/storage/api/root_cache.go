@@ -2,16 +2,79 @@ package api
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
 	nodedb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
 )
 
+const (
+	// DefaultDivergenceReportMaxKeys is the default maximum number of divergent keys in a
+	// divergence report.
+	DefaultDivergenceReportMaxKeys = 16
+)
+
+// ExpectedRootMismatchError is the error returned by applies with divergence reports enabled
+// when the expected root does not match the computed root.
+type ExpectedRootMismatchError struct {
+	// Report is the report of keys with divergent values, or nil in case it could not be
+	// generated.
+	Report *mkvs.DivergenceReport
+	// ReportErr is the error encountered while generating the report, if any.
+	ReportErr error
+}
+
+// Error returns the error message including the divergence report.
+func (e *ExpectedRootMismatchError) Error() string {
+	if e.Report == nil {
+		return fmt.Sprintf("%s (failed to generate divergence report: %s)", ErrExpectedRootMismatch, e.ReportErr)
+	}
+	return fmt.Sprintf("%s: %s", ErrExpectedRootMismatch, e.Report)
+}
+
+// Unwrap returns ErrExpectedRootMismatch.
+func (e *ExpectedRootMismatchError) Unwrap() error {
+	return ErrExpectedRootMismatch
+}
+
 // RootCache is a LRU based tree cache.
 type RootCache struct {
 	localDB nodedb.NodeDB
+
+	maxApplySizeDelta int64
+
+	divergenceSyncer  syncer.ReadSyncer
+	divergenceMaxKeys int
+}
+
+// EnableDivergenceReports enables reporting of divergent keys in case an apply results in a root
+// mismatch. The expected tree is fetched via the given read syncer and at most maxKeys divergent
+// keys are reported (zero means DefaultDivergenceReportMaxKeys).
+//
+// This is a debugging tool, reports require traversing the differing parts of both trees.
+func (rc *RootCache) EnableDivergenceReports(rs syncer.ReadSyncer, maxKeys int) {
+	if maxKeys <= 0 {
+		maxKeys = DefaultDivergenceReportMaxKeys
+	}
+	rc.divergenceSyncer = rs
+	rc.divergenceMaxKeys = maxKeys
+}
+
+// divergenceReport returns the error for a mismatch between the given tree and the expected root,
+// including a divergence report if enabled.
+func (rc *RootCache) divergenceReport(ctx context.Context, tree mkvs.Tree, expectedRoot Root) error {
+	if rc.divergenceSyncer == nil {
+		return ErrExpectedRootMismatch
+	}
+
+	expected := mkvs.NewWithRoot(rc.divergenceSyncer, nil, expectedRoot)
+	defer expected.Close()
+
+	report, err := mkvs.FindDivergentKeys(ctx, tree, expected, rc.divergenceMaxKeys)
+	return &ExpectedRootMismatchError{Report: report, ReportErr: err}
 }
 
 // GetTree gets a tree entry from the cache by the root iff present, or creates
@@ -35,12 +98,35 @@ func (rc *RootCache) Apply(
 
 	r := expectedNewRoot.Hash
 
-	// Check if we already have the expected new root in our local DB.
-	if !rc.localDB.HasRoot(expectedNewRoot) {
+	// Check if we already have the expected new root in our local DB, in which case this is a
+	// duplicate apply. Also make sure that the root node itself is present as the root could be
+	// recorded without its nodes, but keep the check cheap by not walking the tree.
+	exists := rc.localDB.HasRoot(expectedNewRoot)
+	if exists {
+		var err error
+		if exists, err = rc.localDB.HasSubtree(ctx, expectedNewRoot, 0); err != nil {
+			return nil, err
+		}
+	}
+	if !exists {
 		// We don't, apply operations.
 		tree := mkvs.NewWithRoot(nil, rc.localDB, root)
 		defer tree.Close()
 
+		// Reject applies that would grow the state beyond the configured quota before doing any
+		// modifications to the tree.
+		if rc.maxApplySizeDelta > 0 {
+			delta, err := mkvs.EstimateSizeDelta(ctx, tree, writelog.NewStaticIterator(writeLog))
+			if err != nil {
+				return nil, err
+			}
+			if delta > rc.maxApplySizeDelta {
+				return nil, fmt.Errorf("%w: estimated state growth of %d bytes exceeds quota of %d bytes",
+					ErrLimitReached, delta, rc.maxApplySizeDelta,
+				)
+			}
+		}
+
 		if err := tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(writeLog)); err != nil {
 			return nil, err
 		}
@@ -49,7 +135,7 @@ func (rc *RootCache) Apply(
 		switch err {
 		case nil:
 		case mkvs.ErrKnownRootMismatch:
-			return nil, ErrExpectedRootMismatch
+			return nil, rc.divergenceReport(ctx, tree, expectedNewRoot)
 		default:
 			return nil, err
 		}
@@ -62,8 +148,13 @@ func (rc *RootCache) HasRoot(root Root) bool {
 	return rc.localDB.HasRoot(root)
 }
 
-func NewRootCache(localDB nodedb.NodeDB) (*RootCache, error) {
+// NewRootCache creates a new root cache.
+//
+// If maxApplySizeDelta is non-zero, applies whose write logs are estimated to grow the state by
+// more than the given number of bytes are rejected with ErrLimitReached.
+func NewRootCache(localDB nodedb.NodeDB, maxApplySizeDelta int64) (*RootCache, error) {
 	return &RootCache{
-		localDB: localDB,
+		localDB:           localDB,
+		maxApplySizeDelta: maxApplySizeDelta,
 	}, nil
 }
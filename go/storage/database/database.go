@@ -63,11 +63,14 @@ func New(cfg *api.Config) (api.LocalBackend, error) {
 		return nil, fmt.Errorf("storage/database: failed to create node database: %w", err)
 	}
 
-	rootCache, err := api.NewRootCache(ndb)
+	rootCache, err := api.NewRootCache(ndb, cfg.MaxApplySizeDelta)
 	if err != nil {
 		ndb.Close()
 		return nil, fmt.Errorf("storage/database: failed to create root cache: %w", err)
 	}
+	if cfg.DivergenceReportSyncer != nil {
+		rootCache.EnableDivergenceReports(cfg.DivergenceReportSyncer, cfg.DivergenceReportMaxKeys)
+	}
 
 	// Satisfy the interface.
 	initCh := make(chan struct{})
@@ -1,6 +1,9 @@
 package database
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -9,8 +12,12 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	genesisTestHelpers "github.com/oasisprotocol/oasis-core/go/genesis/tests"
 	"github.com/oasisprotocol/oasis-core/go/storage/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
 	"github.com/oasisprotocol/oasis-core/go/storage/tests"
 )
 
@@ -31,10 +38,10 @@ func doTestImpl(t *testing.T, backend string) {
 
 	var (
 		cfg = api.Config{
-			Backend:      backend,
-			Namespace:    testNs,
-			MaxCacheSize: 16 * 1024 * 1024,
-			NoFsync:      true,
+			Backend:        backend,
+			Namespace:      testNs,
+			BlockCacheSize: 16 * 1024 * 1024,
+			NoFsync:        true,
 		}
 		err error
 	)
@@ -51,3 +58,139 @@ func doTestImpl(t *testing.T, backend string) {
 	genesisTestHelpers.SetTestChainContext()
 	tests.StorageImplementationTests(t, impl, impl, testNs, 0)
 }
+
+func TestApplySizeQuota(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	testNs := common.NewTestNamespaceFromSeed([]byte("database backend quota test ns"), 0)
+
+	var (
+		cfg = api.Config{
+			Backend:           BackendNameBadgerDB,
+			Namespace:         testNs,
+			NoFsync:           true,
+			MaxApplySizeDelta: 1024,
+		}
+		err error
+	)
+
+	cfg.DB, err = ioutil.TempDir("", "oasis-storage-database-test")
+	require.NoError(err, "TempDir()")
+	defer os.RemoveAll(cfg.DB)
+
+	impl, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer impl.Cleanup()
+
+	newApplyRequest := func(wl api.WriteLog) *api.ApplyRequest {
+		tree := mkvs.New(nil, nil, api.RootTypeState)
+		defer tree.Close()
+		for _, entry := range wl {
+			err = tree.Insert(ctx, entry.Key, entry.Value)
+			require.NoError(err, "Insert")
+		}
+		_, dstRoot, err := tree.Commit(ctx, testNs, 1)
+		require.NoError(err, "Commit")
+
+		var srcRoot hash.Hash
+		srcRoot.Empty()
+		return &api.ApplyRequest{
+			Namespace: testNs,
+			RootType:  api.RootTypeState,
+			SrcRound:  1,
+			SrcRoot:   srcRoot,
+			DstRound:  1,
+			DstRoot:   dstRoot,
+			WriteLog:  wl,
+		}
+	}
+
+	// Applies within the quota should succeed.
+	err = impl.Apply(ctx, newApplyRequest(api.WriteLog{
+		{Key: []byte("key"), Value: []byte("small value")},
+	}))
+	require.NoError(err, "Apply within quota")
+
+	// Applies exceeding the quota should be rejected.
+	err = impl.Apply(ctx, newApplyRequest(api.WriteLog{
+		{Key: []byte("key"), Value: make([]byte, 2048)},
+	}))
+	require.Error(err, "Apply exceeding quota")
+	require.True(errors.Is(err, api.ErrLimitReached), "Apply should fail with ErrLimitReached")
+}
+
+func TestApplyDivergenceReport(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	testNs := common.NewTestNamespaceFromSeed([]byte("database backend divergence test ns"), 0)
+
+	newBackend := func(rs syncer.ReadSyncer) api.LocalBackend {
+		dir, err := ioutil.TempDir("", "oasis-storage-database-test")
+		require.NoError(err, "TempDir()")
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		impl, err := New(&api.Config{
+			Backend:                BackendNameBadgerDB,
+			DB:                     dir,
+			Namespace:              testNs,
+			NoFsync:                true,
+			DivergenceReportSyncer: rs,
+		})
+		require.NoError(err, "New()")
+		t.Cleanup(impl.Cleanup)
+		return impl
+	}
+
+	var wl api.WriteLog
+	for i := 0; i < 100; i++ {
+		wl = append(wl, api.LogEntry{
+			Key:   []byte(fmt.Sprintf("key %d", i)),
+			Value: []byte(fmt.Sprintf("value %d", i)),
+		})
+	}
+	var srcRoot hash.Hash
+	srcRoot.Empty()
+	request := &api.ApplyRequest{
+		Namespace: testNs,
+		RootType:  api.RootTypeState,
+		SrcRound:  1,
+		SrcRoot:   srcRoot,
+		DstRound:  1,
+		WriteLog:  wl,
+	}
+
+	// The peer has the expected root.
+	tree := mkvs.New(nil, nil, api.RootTypeState)
+	defer tree.Close()
+	err := tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+	require.NoError(err, "ApplyWriteLog")
+	_, request.DstRoot, err = tree.Commit(ctx, testNs, 1)
+	require.NoError(err, "Commit")
+
+	peer := newBackend(nil)
+	err = peer.Apply(ctx, request)
+	require.NoError(err, "Apply")
+
+	// Applying a write log with a corrupted entry should report the corrupted key.
+	corrupted := *request
+	corrupted.WriteLog = append(api.WriteLog{}, wl...)
+	corrupted.WriteLog[42] = api.LogEntry{Key: wl[42].Key, Value: []byte("corrupted value")}
+
+	err = newBackend(nil).Apply(ctx, &corrupted)
+	require.ErrorIs(err, api.ErrExpectedRootMismatch, "Apply should fail with a root mismatch")
+	var mismatchErr *api.ExpectedRootMismatchError
+	require.False(errors.As(err, &mismatchErr), "Apply should not report divergent keys unless enabled")
+
+	err = newBackend(peer).Apply(ctx, &corrupted)
+	require.ErrorIs(err, api.ErrExpectedRootMismatch, "Apply should fail with a root mismatch")
+	require.True(errors.As(err, &mismatchErr), "Apply should report divergent keys")
+	require.NoError(mismatchErr.ReportErr, "divergence report should be generated")
+	report := mismatchErr.Report
+	require.Equal(request.DstRoot, report.ExpectedRoot, "expected root")
+	require.Len(report.Keys, 1, "report should contain a single key")
+	require.EqualValues(wl[42].Key, report.Keys[0].Key, "report should pinpoint the corrupted key")
+	require.Equal(hash.NewFromBytes([]byte("corrupted value")), *report.Keys[0].LocalValueHash, "local value hash")
+	require.Equal(hash.NewFromBytes(wl[42].Value), *report.Keys[0].ExpectedValueHash, "expected value hash")
+}
@@ -0,0 +1,448 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	badgerDb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/badger"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+var benchWorkloadSpecs = flag.String(
+	"mkvs.bench.workloads",
+	filepath.Join("testdata", "workloads", "*.json"),
+	"glob pattern of workload specs run by BenchmarkWorkload",
+)
+
+// benchWorkload is a seeded specification of a mixed read/write workload.
+//
+// All keys, values and operations are derived from the seed, so the same spec always results in
+// the same sequence of operations.
+type benchWorkload struct {
+	// Name is the name of the workload, derived from the spec file name.
+	Name string `json:"-"`
+
+	// Seed is the seed used to generate keys, values and operations.
+	Seed int64 `json:"seed"`
+	// WorkingSetSize is the number of distinct keys operated on.
+	WorkingSetSize int `json:"working_set_size"`
+	// KeyDistribution is the distribution of accessed keys (uniform or zipfian).
+	KeyDistribution string `json:"key_distribution"`
+	// ZipfS is the skew of the zipfian key distribution and must be greater than 1.
+	ZipfS float64 `json:"zipf_s,omitempty"`
+	// KeySize is the size of each key in bytes.
+	KeySize int `json:"key_size"`
+	// ValueSize is the range of value sizes in bytes, sizes are chosen uniformly.
+	ValueSize struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	} `json:"value_size"`
+	// Mix is the operation mix in percent and must add up to 100.
+	Mix struct {
+		Get       int `json:"get"`
+		Scan      int `json:"scan"`
+		Overwrite int `json:"overwrite"`
+		Delete    int `json:"delete"`
+	} `json:"mix"`
+	// ScanLength is the number of entries visited by each range scan.
+	ScanLength int `json:"scan_length"`
+	// OpsPerCommit is the number of operations after which the tree is committed.
+	OpsPerCommit int `json:"ops_per_commit"`
+	// Cache optionally overrides the default tree cache capacity.
+	Cache *struct {
+		NodeCapacity  uint64 `json:"node_capacity"`
+		ValueCapacity uint64 `json:"value_capacity"`
+	} `json:"cache,omitempty"`
+}
+
+func (w *benchWorkload) validate() error {
+	if w.WorkingSetSize < 2 {
+		return fmt.Errorf("working set size must be at least 2")
+	}
+	switch w.KeyDistribution {
+	case "uniform":
+	case "zipfian":
+		if w.ZipfS <= 1 {
+			return fmt.Errorf("zipfian skew must be greater than 1")
+		}
+	default:
+		return fmt.Errorf("unknown key distribution '%s'", w.KeyDistribution)
+	}
+	if w.KeySize < 1 {
+		return fmt.Errorf("key size must be positive")
+	}
+	if w.ValueSize.Min < 1 || w.ValueSize.Max < w.ValueSize.Min {
+		return fmt.Errorf("invalid value size range")
+	}
+	if w.Mix.Get < 0 || w.Mix.Scan < 0 || w.Mix.Overwrite < 0 || w.Mix.Delete < 0 {
+		return fmt.Errorf("operation mix must not be negative")
+	}
+	if total := w.Mix.Get + w.Mix.Scan + w.Mix.Overwrite + w.Mix.Delete; total != 100 {
+		return fmt.Errorf("operation mix adds up to %d%%, not 100%%", total)
+	}
+	if w.Mix.Scan > 0 && w.ScanLength < 1 {
+		return fmt.Errorf("scan length must be positive")
+	}
+	if w.OpsPerCommit < 1 {
+		return fmt.Errorf("operations per commit must be positive")
+	}
+	return nil
+}
+
+// treeOptions returns the tree options for the workload.
+func (w *benchWorkload) treeOptions() []Option {
+	if w.Cache == nil {
+		return nil
+	}
+	return []Option{Capacity(w.Cache.NodeCapacity, w.Cache.ValueCapacity)}
+}
+
+// loadBenchWorkloads loads and validates all workload specs matching the given glob pattern.
+func loadBenchWorkloads(pattern string) ([]*benchWorkload, error) {
+	fns, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("no workload specs match '%s'", pattern)
+	}
+	sort.Strings(fns)
+
+	var workloads []*benchWorkload
+	for _, fn := range fns {
+		raw, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		var w benchWorkload
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(&w); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		if err = w.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		w.Name = strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+		workloads = append(workloads, &w)
+	}
+	return workloads, nil
+}
+
+type benchOp uint8
+
+const (
+	benchOpGet benchOp = iota
+	benchOpScan
+	benchOpOverwrite
+	benchOpDelete
+)
+
+// benchGenerator deterministically generates the keys, values and operations of a workload.
+type benchGenerator struct {
+	w *benchWorkload
+
+	rng  *rand.Rand
+	zipf *rand.Zipf
+
+	keys     [][]byte
+	valueBuf []byte
+}
+
+func newBenchGenerator(w *benchWorkload) *benchGenerator {
+	rng := rand.New(rand.NewSource(w.Seed)) // nolint: gosec
+
+	keys := make([][]byte, w.WorkingSetSize)
+	for i := range keys {
+		keys[i] = make([]byte, w.KeySize)
+		_, _ = rng.Read(keys[i])
+	}
+	// Values are windows into a shared random buffer so that generating them does not allocate.
+	valueBuf := make([]byte, 2*w.ValueSize.Max)
+	_, _ = rng.Read(valueBuf)
+
+	g := &benchGenerator{
+		w:        w,
+		rng:      rng,
+		keys:     keys,
+		valueBuf: valueBuf,
+	}
+	if w.KeyDistribution == "zipfian" {
+		g.zipf = rand.NewZipf(rng, w.ZipfS, 1, uint64(w.WorkingSetSize-1))
+	}
+	return g
+}
+
+func (g *benchGenerator) key() []byte {
+	if g.zipf != nil {
+		return g.keys[g.zipf.Uint64()]
+	}
+	return g.keys[g.rng.Intn(len(g.keys))]
+}
+
+func (g *benchGenerator) value() []byte {
+	size := g.w.ValueSize.Min + g.rng.Intn(g.w.ValueSize.Max-g.w.ValueSize.Min+1)
+	offset := g.rng.Intn(len(g.valueBuf) - size + 1)
+	return g.valueBuf[offset : offset+size]
+}
+
+func (g *benchGenerator) op() benchOp {
+	p := g.rng.Intn(100)
+	switch {
+	case p < g.w.Mix.Get:
+		return benchOpGet
+	case p < g.w.Mix.Get+g.w.Mix.Scan:
+		return benchOpScan
+	case p < g.w.Mix.Get+g.w.Mix.Scan+g.w.Mix.Overwrite:
+		return benchOpOverwrite
+	default:
+		return benchOpDelete
+	}
+}
+
+// benchNodeDB wraps a node database and records all nodes persisted by commits.
+type benchNodeDB struct {
+	db.NodeDB
+
+	nodes []node.Node
+}
+
+func (d *benchNodeDB) NewBatch(oldRoot node.Root, version uint64, chunk bool) (db.Batch, error) {
+	batch, err := d.NodeDB.NewBatch(oldRoot, version, chunk)
+	if err != nil {
+		return nil, err
+	}
+	return &benchBatch{Batch: batch, db: d}, nil
+}
+
+// takeBytesWritten returns the serialized size of all nodes persisted since the last call.
+func (d *benchNodeDB) takeBytesWritten() (size uint64) {
+	for _, n := range d.nodes {
+		data, err := n.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		size += uint64(len(data))
+	}
+	d.nodes = d.nodes[:0]
+	return
+}
+
+type benchBatch struct {
+	db.Batch
+
+	db *benchNodeDB
+}
+
+func (b *benchBatch) MaybeStartSubtree(subtree db.Subtree, depth node.Depth, subtreeRoot *node.Pointer) db.Subtree {
+	inner := subtree
+	if s, ok := subtree.(*benchSubtree); ok {
+		inner = s.Subtree
+	}
+	newSubtree := b.Batch.MaybeStartSubtree(inner, depth, subtreeRoot)
+	if subtree != nil && newSubtree == inner {
+		// The commit process relies on subtree identity to know when to commit a subtree.
+		return subtree
+	}
+	return &benchSubtree{Subtree: newSubtree, db: b.db}
+}
+
+type benchSubtree struct {
+	db.Subtree
+
+	db *benchNodeDB
+}
+
+func (s *benchSubtree) PutNode(depth node.Depth, ptr *node.Pointer) error {
+	if err := s.Subtree.PutNode(depth, ptr); err != nil {
+		return err
+	}
+	s.db.nodes = append(s.db.nodes, ptr.Node)
+	return nil
+}
+
+type benchBackend struct {
+	name string
+	init func(b *testing.B) (db.NodeDB, func())
+}
+
+// benchBackends are the node database backends the workloads are run against.
+var benchBackends = []benchBackend{
+	{"Badger", initBenchBadgerBackend},
+}
+
+func initBenchBadgerBackend(b *testing.B) (db.NodeDB, func()) {
+	dir, err := ioutil.TempDir("", "mkvs.bench.badgerdb")
+	require.NoError(b, err, "TempDir")
+
+	ndb, err := badgerDb.New(&db.Config{
+		DB:             dir,
+		NoFsync:        true,
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
+	})
+	require.NoError(b, err, "New")
+
+	return ndb, func() {
+		ndb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// percentile returns the given percentile of the (unsorted) latencies.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+// BenchmarkWorkload runs the workload specs selected by -mkvs.bench.workloads (by default the
+// canonical presets in testdata/workloads) against all node database backends.
+//
+// Besides the standard metrics, each run reports the throughput (ops/s), the 99th percentile
+// latency of individual operations (p99-ns/op) and commits (p99-ns/commit) as well as the
+// number of node bytes written to the node database per operation (ndb-B/op).
+func BenchmarkWorkload(b *testing.B) {
+	workloads, err := loadBenchWorkloads(*benchWorkloadSpecs)
+	require.NoError(b, err, "loadBenchWorkloads")
+
+	for _, w := range workloads {
+		for _, be := range benchBackends {
+			w, be := w, be
+			b.Run(fmt.Sprintf("%s/%s", w.Name, be.name), func(b *testing.B) {
+				benchmarkWorkload(b, w, be)
+			})
+		}
+	}
+}
+
+func benchmarkWorkload(b *testing.B, w *benchWorkload, be benchBackend) {
+	ctx := context.Background()
+
+	ndb, cleanup := be.init(b)
+	defer cleanup()
+	bdb := &benchNodeDB{NodeDB: ndb}
+	gen := newBenchGenerator(w)
+	tree := New(nil, bdb, node.RootTypeState, w.treeOptions()...)
+	defer tree.Close()
+
+	var version uint64
+	commit := func() {
+		_, rootHash, err := tree.Commit(ctx, testNs, version)
+		require.NoError(b, err, "Commit")
+		err = ndb.Finalize(ctx, []node.Root{{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}})
+		require.NoError(b, err, "Finalize")
+		version++
+	}
+
+	// Populate the working set.
+	for _, key := range gen.keys {
+		err := tree.Insert(ctx, key, gen.value())
+		require.NoError(b, err, "Insert")
+	}
+	commit()
+	_ = bdb.takeBytesWritten()
+
+	var (
+		opLatencies     = make([]time.Duration, 0, b.N)
+		commitLatencies = make([]time.Duration, 0, b.N/w.OpsPerCommit+1)
+		total           time.Duration
+		bytesWritten    uint64
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		op, key := gen.op(), gen.key()
+		var value []byte
+		if op == benchOpOverwrite {
+			value = gen.value()
+		}
+
+		var err error
+		start := time.Now()
+		switch op {
+		case benchOpGet:
+			_, err = tree.Get(ctx, key)
+		case benchOpScan:
+			it := tree.NewIterator(ctx)
+			it.Seek(key)
+			for i := 0; i < w.ScanLength && it.Valid(); i++ {
+				it.Next()
+			}
+			err = it.Err()
+			it.Close()
+		case benchOpOverwrite:
+			err = tree.Insert(ctx, key, value)
+		case benchOpDelete:
+			err = tree.Remove(ctx, key)
+		}
+		latency := time.Since(start)
+		require.NoError(b, err, "operation")
+		opLatencies = append(opLatencies, latency)
+		total += latency
+
+		if (n+1)%w.OpsPerCommit == 0 {
+			start = time.Now()
+			commit()
+			latency = time.Since(start)
+			commitLatencies = append(commitLatencies, latency)
+			total += latency
+
+			b.StopTimer()
+			bytesWritten += bdb.takeBytesWritten()
+			b.StartTimer()
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N)/total.Seconds(), "ops/s")
+	b.ReportMetric(float64(percentile(opLatencies, 0.99).Nanoseconds()), "p99-ns/op")
+	if len(commitLatencies) > 0 {
+		b.ReportMetric(float64(percentile(commitLatencies, 0.99).Nanoseconds()), "p99-ns/commit")
+	}
+	b.ReportMetric(float64(bytesWritten)/float64(b.N), "ndb-B/op")
+}
+
+func TestBenchWorkloads(t *testing.T) {
+	require := require.New(t)
+
+	workloads, err := loadBenchWorkloads(filepath.Join("testdata", "workloads", "*.json"))
+	require.NoError(err, "loadBenchWorkloads")
+	require.NotEmpty(workloads, "canonical workload presets should exist")
+
+	for _, w := range workloads {
+		// The same seed must result in the same sequence of operations.
+		g1, g2 := newBenchGenerator(w), newBenchGenerator(w)
+		require.Equal(g1.keys, g2.keys, "%s: generated keys should be reproducible", w.Name)
+		for i := 0; i < 1000; i++ {
+			require.Equal(g1.op(), g2.op(), "%s: generated operations should be reproducible", w.Name)
+			require.Equal(g1.key(), g2.key(), "%s: generated keys should be reproducible", w.Name)
+			v1, v2 := g1.value(), g2.value()
+			require.Equal(v1, v2, "%s: generated values should be reproducible", w.Name)
+			require.True(len(v1) >= w.ValueSize.Min && len(v1) <= w.ValueSize.Max, "%s: value size should be in range", w.Name)
+		}
+	}
+
+	w := *workloads[0]
+	w.Mix.Get++
+	require.Error(w.validate(), "operation mix not adding up to 100% should be rejected")
+}
@@ -24,18 +24,35 @@ type cache struct {
 	db db.NodeDB
 	rs syncer.ReadSyncer
 
+	// sharedCache is the optional node cache shared with other trees.
+	sharedCache *SharedCache
+
 	// pendingRoot is the pending root which will become the new root if
 	// the currently cached contents is committed.
 	pendingRoot *node.Pointer
 	// syncRoot is the root at which all node database and syncer cache
 	// lookups will be done.
 	syncRoot node.Root
+	// syncVersion is the read syncer protocol version negotiated with the remote read syncer.
+	// Zero means that no version has been negotiated yet.
+	syncVersion uint16
+	// syncLegacy is true iff the remote read syncer predates version negotiation, so requests
+	// must not include a protocol version.
+	syncLegacy bool
 
 	// Current size of leaf values.
 	valueSize uint64
 	// Current number of internal nodes.
 	internalNodeCount uint64
 
+	// stats are the node lookup statistics.
+	stats CacheStats
+
+	// keyFilter is the key filter of the sync root in case the node database has one.
+	keyFilter *db.KeyFilter
+	// keyFilterLoaded is true iff the key filter of the sync root has been loaded.
+	keyFilterLoaded bool
+
 	// Maximum capacity of internal nodes.
 	nodeCapacity uint64
 	// Maximum capacity of leaf values.
@@ -94,6 +111,32 @@ func (c *cache) getSyncRoot() node.Root {
 
 func (c *cache) setSyncRoot(root node.Root) {
 	c.syncRoot = root
+	// Proofs fetched via the read syncer are for the sync root.
+	c.ProofVerifier.Domain = root.HashDomain()
+	// The key filter is loaded on first use.
+	c.keyFilter = nil
+	c.keyFilterLoaded = false
+}
+
+// mayContainKey returns false in case the key filter of the sync root shows that the given key
+// does not exist in the tree. The key filter is only consulted while the pending root is the
+// (unmodified) sync root, as local modifications are not reflected in it.
+func (c *cache) mayContainKey(ctx context.Context, key node.Key) bool {
+	if c.pendingRoot == nil || !c.pendingRoot.IsClean() || !c.pendingRoot.Hash.Equal(&c.syncRoot.Hash) {
+		return true
+	}
+	if !c.keyFilterLoaded {
+		c.keyFilterLoaded = true
+		// Roots without a usable key filter are traversed as usual.
+		if kf, err := c.db.GetKeyFilter(ctx, c.syncRoot); err == nil {
+			c.keyFilter = kf
+		}
+	}
+	if c.keyFilter == nil || c.keyFilter.MayContain(key) {
+		return true
+	}
+	c.stats.KeyFilterSkips++
+	return false
 }
 
 func (c *cache) setPendingRoot(ptr *node.Pointer) {
@@ -321,10 +364,14 @@ type readSyncFetcher func(context.Context, *node.Pointer, syncer.ReadSyncer) (*s
 // derefNodePtr dereferences an internal node pointer.
 //
 // This may result in node database accesses or remote syncing if the node
-// is not available locally.
+// is not available locally. The node is located at the given bit depth and
+// the first bitDepth bits of path are the key prefix traversed so far, which
+// is reported in case the node cannot be dereferenced.
 func (c *cache) derefNodePtr(
 	ctx context.Context,
 	ptr *node.Pointer,
+	bitDepth node.Depth,
+	path node.Key,
 	fetcher readSyncFetcher,
 ) (node.Node, error) {
 	if ptr == nil {
@@ -346,6 +393,7 @@ func (c *cache) derefNodePtr(
 		}
 
 		if !refetch {
+			c.stats.Hits++
 			return ptr.Node, nil
 		}
 	}
@@ -354,33 +402,57 @@ func (c *cache) derefNodePtr(
 		return nil, nil
 	}
 
-	// First, attempt to fetch from the local node database.
-	n, err := c.db.GetNode(c.syncRoot, ptr)
-	switch err {
+	switch err := c.fetchLocalNode(ptr); err {
 	case nil:
-		ptr.Node = n
-		// Commit node to cache.
-		c.commitNode(ptr)
 	case db.ErrNodeNotFound:
 		// Node not found in local node database, try the syncer if available.
 		if c.rs == syncer.NopReadSyncer {
-			return nil, err
+			return nil, newNodeError(bitDepth, path, ptr, false, err)
 		}
 
 		if err = c.remoteSync(ctx, ptr, fetcher); err != nil {
-			return nil, err
+			return nil, newNodeError(bitDepth, path, ptr, true, err)
 		}
 
 		if ptr.Node == nil {
-			return nil, fmt.Errorf("mkvs: received result did not contain node (or cache too small)")
+			err = fmt.Errorf("mkvs: received result did not contain node (or cache too small)")
+			return nil, newNodeError(bitDepth, path, ptr, true, err)
 		}
 	default:
-		return nil, err
+		return nil, newNodeError(bitDepth, path, ptr, false, err)
 	}
 
 	return ptr.Node, nil
 }
 
+// fetchLocalNode fetches the node the given clean pointer points to from the shared cache or
+// the local node database and commits it to the cache.
+func (c *cache) fetchLocalNode(ptr *node.Pointer) error {
+	// Check the shared cache first as it avoids a node database lookup.
+	if c.sharedCache != nil {
+		if n := c.sharedCache.get(ptr.Hash); n != nil {
+			c.stats.SharedCacheHits++
+			ptr.Node = n
+			c.commitNode(ptr)
+			return nil
+		}
+	}
+
+	// Then, attempt to fetch from the local node database.
+	c.stats.NodeDBReads++
+	n, err := c.db.GetNode(c.syncRoot, ptr)
+	if err != nil {
+		return err
+	}
+	ptr.Node = n
+	// Commit node to cache.
+	c.commitNode(ptr)
+	if c.sharedCache != nil {
+		c.sharedCache.put(n)
+	}
+	return nil
+}
+
 // remoteSync performs a remote sync with the configured remote syncer.
 func (c *cache) remoteSync(ctx context.Context, ptr *node.Pointer, fetcher readSyncFetcher) error {
 	proof, err := fetcher(ctx, ptr, c.rs)
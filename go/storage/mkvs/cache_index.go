@@ -0,0 +1,217 @@
+package mkvs
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+const (
+	// cacheIndexVersion is the version of the cache index format.
+	cacheIndexVersion = 1
+
+	// MaxCacheIndexEntries is the maximum number of node hashes in a cache index. When saving a
+	// cache index of a larger cache, only the most recently used nodes are included.
+	//
+	// This is the maximum CBOR array length accepted when decoding untrusted data.
+	MaxCacheIndexEntries = 1 << 17
+
+	// maxCacheIndexSize is the maximum size of a serialized cache index.
+	maxCacheIndexSize = 64 + MaxCacheIndexEntries*(hash.Size+2)
+)
+
+// ErrInvalidCacheIndex is the error returned when a cache index is malformed or uses an
+// unsupported version.
+var ErrInvalidCacheIndex = errors.New("mkvs: invalid cache index")
+
+// CacheStats are node lookup statistics of a tree.
+type CacheStats struct {
+	// Hits is the number of node lookups served from the tree's in-memory cache.
+	Hits uint64
+	// SharedCacheHits is the number of node lookups served from the shared cache.
+	SharedCacheHits uint64
+	// NodeDBReads is the number of node lookups performed against the node database.
+	NodeDBReads uint64
+	// KeyFilterSkips is the number of lookups of absent keys answered by the key filter of the
+	// root without any node lookups.
+	KeyFilterSkips uint64
+}
+
+// cacheIndex is a serialized set of cached node hashes.
+type cacheIndex struct {
+	cbor.Versioned
+
+	// Hashes are the hashes of the cached nodes, from the most to the least recently used.
+	Hashes []hash.Hash `json:"hashes"`
+}
+
+func writeCacheIndex(w io.Writer, hashes []hash.Hash) error {
+	if len(hashes) > MaxCacheIndexEntries {
+		hashes = hashes[:MaxCacheIndexEntries]
+	}
+	_, err := w.Write(cbor.Marshal(&cacheIndex{
+		Versioned: cbor.NewVersioned(cacheIndexVersion),
+		Hashes:    hashes,
+	}))
+	return err
+}
+
+func readCacheIndex(r io.Reader) ([]hash.Hash, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxCacheIndexSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCacheIndexSize {
+		return nil, fmt.Errorf("%w: index too large", ErrInvalidCacheIndex)
+	}
+
+	version, err := cbor.GetVersion(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCacheIndex, err)
+	}
+	if version != cacheIndexVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidCacheIndex, version)
+	}
+	var index cacheIndex
+	if err = cbor.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCacheIndex, err)
+	}
+	if len(index.Hashes) > MaxCacheIndexEntries {
+		return nil, fmt.Errorf("%w: too many entries", ErrInvalidCacheIndex)
+	}
+	return index.Hashes, nil
+}
+
+// Implements Tree.
+func (t *tree) CacheStats() CacheStats {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	return t.cache.stats
+}
+
+// Implements Tree.
+func (t *tree) SaveCacheIndex(w io.Writer) error {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+
+	var hashes []hash.Hash
+	for _, l := range []*list.List{t.cache.lruInternal, t.cache.lruLeaf} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			// Only clean nodes may be available in the node database.
+			if ptr := e.Value.(*node.Pointer); ptr.Clean && ptr.Node != nil {
+				hashes = append(hashes, ptr.Hash)
+			}
+		}
+	}
+	return writeCacheIndex(w, hashes)
+}
+
+// Implements Tree.
+func (t *tree) WarmFromIndex(ctx context.Context, r io.Reader) error {
+	hashes, err := readCacheIndex(r)
+	if err != nil {
+		return err
+	}
+	indexed := make(map[hash.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		indexed[h] = true
+	}
+
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+	return t.cache.warm(ctx, t.cache.pendingRoot, indexed)
+}
+
+// warm loads all indexed nodes reachable from the given pointer into the cache. Nodes which are
+// not available locally are skipped.
+func (c *cache) warm(ctx context.Context, ptr *node.Pointer, indexed map[hash.Hash]bool) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if ptr == nil {
+		return nil
+	}
+
+	if ptr.Node == nil {
+		if !ptr.Clean || !indexed[ptr.Hash] {
+			return nil
+		}
+		switch err := c.fetchLocalNode(ptr); err {
+		case nil:
+		case db.ErrNodeNotFound:
+			// Node no longer exists, skip it.
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if n, ok := ptr.Node.(*node.InternalNode); ok {
+		if err := c.warm(ctx, n.Left, indexed); err != nil {
+			return err
+		}
+		if err := c.warm(ctx, n.Right, indexed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveCacheIndex writes the hashes of all nodes in the shared cache (but not their contents) to
+// the given writer, so that the cache can be warmed using WarmFromIndex, e.g., after a restart.
+//
+// At most MaxCacheIndexEntries of the most recently used nodes are included.
+func (sc *SharedCache) SaveCacheIndex(w io.Writer) error {
+	keys := sc.nodes.Keys()
+	hashes := make([]hash.Hash, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		hashes = append(hashes, keys[i].(hash.Hash))
+	}
+	return writeCacheIndex(w, hashes)
+}
+
+// WarmFromIndex reads the nodes in a cache index written by SaveCacheIndex from the given node
+// database into the shared cache. Nodes which no longer exist in the node database are skipped.
+//
+// The root is only used to look up nodes and must exist in the node database.
+func (sc *SharedCache) WarmFromIndex(ctx context.Context, ndb db.NodeDB, root node.Root, r io.Reader) error {
+	hashes, err := readCacheIndex(r)
+	if err != nil {
+		return err
+	}
+
+	// Insert the least recently used nodes first to preserve the order of use.
+	for i := len(hashes) - 1; i >= 0; i-- {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		n, err := ndb.GetNode(root, &node.Pointer{Clean: true, Hash: hashes[i]})
+		switch err {
+		case nil:
+			sc.put(n)
+		case db.ErrNodeNotFound:
+			// Node no longer exists, skip it.
+		default:
+			return err
+		}
+	}
+	return nil
+}
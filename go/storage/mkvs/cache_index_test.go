@@ -0,0 +1,139 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+)
+
+const cacheIndexTestHotKeys = 100
+
+func TestCacheIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ndb, root, cleanup := newSharedCacheTestDB(t)
+	defer cleanup()
+
+	getHotKeys := func(tree Tree) {
+		for i := 0; i < cacheIndexTestHotKeys; i++ {
+			value, err := tree.Get(ctx, sharedCacheTestKey(i))
+			require.NoError(err, "Get")
+			require.Equal(sharedCacheTestValue(i), value, "Get should return the correct value")
+		}
+	}
+
+	// Populate the cache of a tree and save its index.
+	tree := NewWithRoot(nil, ndb, root)
+	getHotKeys(tree)
+	stats := tree.CacheStats()
+	require.NotZero(stats.NodeDBReads, "cold tree should read from the node database")
+	require.EqualValues(ndb.resetReads(), stats.NodeDBReads, "node database reads should be counted")
+
+	var index bytes.Buffer
+	err := tree.SaveCacheIndex(&index)
+	require.NoError(err, "SaveCacheIndex")
+	tree.Close()
+	err = tree.SaveCacheIndex(&index)
+	require.ErrorIs(err, ErrClosed, "SaveCacheIndex should fail on a closed tree")
+
+	// Warm a fresh tree from the index.
+	tree = NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	err = tree.WarmFromIndex(ctx, bytes.NewReader(index.Bytes()))
+	require.NoError(err, "WarmFromIndex")
+	warmReads := ndb.resetReads()
+	require.NotZero(warmReads, "warming should read from the node database")
+	stats = tree.CacheStats()
+	require.EqualValues(warmReads, stats.NodeDBReads, "node database reads should be counted")
+
+	// Previously hot keys should be served from the cache without any further reads.
+	getHotKeys(tree)
+	require.Zero(ndb.resetReads(), "hot keys should be served from the warmed cache")
+	newStats := tree.CacheStats()
+	require.Equal(stats.NodeDBReads, newStats.NodeDBReads, "no node database reads beyond warming")
+	require.True(newStats.Hits > stats.Hits, "hot keys should be cache hits")
+
+	// Other keys still need to be fetched.
+	_, err = tree.Get(ctx, sharedCacheTestKey(sharedCacheTestKeys-1))
+	require.NoError(err, "Get")
+	require.NotZero(ndb.resetReads(), "cold keys should read from the node database")
+
+	// Nodes which no longer exist should be skipped.
+	var missing bytes.Buffer
+	bogus := hash.NewFromBytes([]byte("i am a bogus hash"))
+	err = writeCacheIndex(&missing, []hash.Hash{bogus, root.Hash})
+	require.NoError(err, "writeCacheIndex")
+	tree2 := NewWithRoot(nil, ndb, root)
+	defer tree2.Close()
+	err = tree2.WarmFromIndex(ctx, &missing)
+	require.NoError(err, "WarmFromIndex should skip missing nodes")
+	require.EqualValues(1, tree2.CacheStats().NodeDBReads, "only the root node should be read")
+}
+
+func TestSharedCacheIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ndb, root, cleanup := newSharedCacheTestDB(t)
+	defer cleanup()
+
+	sc := NewSharedCache(16 * 1024 * 1024)
+	tree := NewWithRoot(nil, ndb, root, WithSharedCache(sc))
+	for i := 0; i < cacheIndexTestHotKeys; i++ {
+		_, err := tree.Get(ctx, sharedCacheTestKey(i))
+		require.NoError(err, "Get")
+	}
+	tree.Close()
+
+	var index bytes.Buffer
+	err := sc.SaveCacheIndex(&index)
+	require.NoError(err, "SaveCacheIndex")
+
+	// Warm a fresh shared cache from the index.
+	sc = NewSharedCache(16 * 1024 * 1024)
+	ndb.resetReads()
+	err = sc.WarmFromIndex(ctx, ndb, root, &index)
+	require.NoError(err, "WarmFromIndex")
+	require.NotZero(ndb.resetReads(), "warming should read from the node database")
+
+	tree = NewWithRoot(nil, ndb, root, WithSharedCache(sc))
+	defer tree.Close()
+	for i := 0; i < cacheIndexTestHotKeys; i++ {
+		value, err := tree.Get(ctx, sharedCacheTestKey(i))
+		require.NoError(err, "Get")
+		require.Equal(sharedCacheTestValue(i), value, "Get should return the correct value")
+	}
+	require.Zero(ndb.resetReads(), "hot keys should be served from the warmed shared cache")
+	stats := tree.CacheStats()
+	require.Zero(stats.NodeDBReads, "no node database reads beyond warming")
+	require.NotZero(stats.SharedCacheHits, "hot keys should be shared cache hits")
+}
+
+func TestCacheIndexInvalid(t *testing.T) {
+	require := require.New(t)
+
+	_, err := readCacheIndex(bytes.NewReader([]byte("not an index")))
+	require.ErrorIs(err, ErrInvalidCacheIndex, "malformed index should be rejected")
+
+	_, err = readCacheIndex(bytes.NewReader(cbor.Marshal(&cacheIndex{
+		Versioned: cbor.NewVersioned(cacheIndexVersion + 1),
+	})))
+	require.ErrorIs(err, ErrInvalidCacheIndex, "unsupported version should be rejected")
+
+	_, err = readCacheIndex(bytes.NewReader(make([]byte, maxCacheIndexSize+1)))
+	require.ErrorIs(err, ErrInvalidCacheIndex, "oversized index should be rejected")
+
+	// Saved indices should be truncated to the maximum number of entries.
+	var index bytes.Buffer
+	err = writeCacheIndex(&index, make([]hash.Hash, MaxCacheIndexEntries+1))
+	require.NoError(err, "writeCacheIndex")
+	hashes, err := readCacheIndex(&index)
+	require.NoError(err, "readCacheIndex")
+	require.Len(hashes, MaxCacheIndexEntries, "index should be truncated")
+}
@@ -34,9 +34,9 @@ func TestFileCheckpointCreator(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	ndb, err := badgerDb.New(&db.Config{
-		DB:           filepath.Join(dir, "db"),
-		Namespace:    testNs,
-		MaxCacheSize: 16 * 1024 * 1024,
+		DB:             filepath.Join(dir, "db"),
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
 	})
 	require.NoError(err, "New")
 
@@ -119,9 +119,9 @@ func TestFileCheckpointCreator(t *testing.T) {
 
 	// Create a fresh node database to restore into.
 	ndb2, err := badgerDb.New(&db.Config{
-		DB:           filepath.Join(dir, "db2"),
-		Namespace:    testNs,
-		MaxCacheSize: 16 * 1024 * 1024,
+		DB:             filepath.Join(dir, "db2"),
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
 	})
 	require.NoError(err, "New")
 
@@ -269,9 +269,9 @@ func TestOversizedChunks(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	ndb, err := badgerDb.New(&db.Config{
-		DB:           filepath.Join(dir, "db"),
-		Namespace:    testNs,
-		MaxCacheSize: 16 * 1024 * 1024,
+		DB:             filepath.Join(dir, "db"),
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
 	})
 	require.NoError(err, "New")
 
@@ -33,9 +33,9 @@ func testCheckpointer(t *testing.T, earliestVersion, interval uint64, preExistin
 	defer os.RemoveAll(dir)
 
 	ndb, err := badgerDb.New(&db.Config{
-		DB:           filepath.Join(dir, "db"),
-		Namespace:    testNs,
-		MaxCacheSize: 16 * 1024 * 1024,
+		DB:             filepath.Join(dir, "db"),
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
 	})
 	require.NoError(err, "New")
 
@@ -121,7 +121,7 @@ func restoreChunk(ctx context.Context, ndb db.NodeDB, chunk *ChunkMetadata, r io
 	}
 
 	// Verify the proof.
-	var pv syncer.ProofVerifier
+	pv := syncer.ProofVerifier{Domain: chunk.Root.HashDomain()}
 	ptr, err := pv.VerifyProof(ctx, chunk.Root.Hash, &p)
 	if err != nil {
 		return fmt.Errorf("%w: %s", ErrChunkProofVerificationFailed, err.Error())
@@ -132,6 +132,7 @@ func restoreChunk(ctx context.Context, ndb db.NodeDB, chunk *ChunkMetadata, r io
 		Namespace: chunk.Root.Namespace,
 		Version:   chunk.Root.Version,
 		Type:      chunk.Root.Type,
+		HashMode:  chunk.Root.HashMode,
 	}
 	emptyRoot.Hash.Empty()
 
@@ -2,6 +2,7 @@ package mkvs
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
@@ -21,13 +22,83 @@ func NoPersist() CommitOption {
 	}
 }
 
+// NoWriteLog returns a commit option that makes the Commit skip constructing the write log and
+// return a nil write log instead. Everything else is persisted as usual, but the write log for the
+// committed root is not stored so retrieving it from the node database results in
+// db.ErrWriteLogNotAvailable.
+func NoWriteLog() CommitOption {
+	return func(o *commitOptions) {
+		o.noWriteLog = true
+	}
+}
+
+// NoPersistWriteLog returns a commit option that makes the Commit construct and return the write
+// log, but not persist it in the node database. Retrieving the write log for the committed root
+// from the node database results in db.ErrWriteLogNotAvailable.
+func NoPersistWriteLog() CommitOption {
+	return func(o *commitOptions) {
+		o.noPersistWriteLog = true
+	}
+}
+
+// WithCommitStats returns a commit option that makes the Commit populate the given stats with
+// information about the nodes written by the commit.
+func WithCommitStats(stats *CommitStats) CommitOption {
+	return func(o *commitOptions) {
+		o.stats = stats
+	}
+}
+
 type commitOptions struct {
-	noPersist bool
+	noPersist         bool
+	noWriteLog        bool
+	noPersistWriteLog bool
+	stats             *CommitStats
+}
+
+// CommitStats contains statistics about the nodes written by a commit.
+type CommitStats struct {
+	// InternalNodes is the number of newly created internal nodes.
+	InternalNodes uint64 `json:"internal_nodes"`
+	// LeafNodes is the number of newly created leaf nodes.
+	LeafNodes uint64 `json:"leaf_nodes"`
+	// ReusedNodes is the number of roots of unmodified subtrees that are referenced by the new
+	// root without being written again.
+	ReusedNodes uint64 `json:"reused_nodes"`
+	// Bytes is the total size of the serialized newly created nodes.
+	Bytes uint64 `json:"bytes"`
+}
+
+func (s *CommitStats) addNode(n node.Node) error {
+	if s == nil {
+		return nil
+	}
+
+	data, err := node.MarshalVersionedBinary(n)
+	if err != nil {
+		return err
+	}
+	s.Bytes += uint64(len(data))
+
+	switch n.(type) {
+	case *node.InternalNode:
+		s.InternalNodes++
+	case *node.LeafNode:
+		s.LeafNodes++
+	}
+	return nil
+}
+
+func (s *CommitStats) addReusedNode() {
+	if s == nil {
+		return
+	}
+	s.ReusedNodes++
 }
 
 // Implements Tree.
 func (t *tree) CommitKnown(ctx context.Context, root node.Root) (writelog.WriteLog, error) {
-	writeLog, _, err := t.commitWithHooks(ctx, root.Namespace, root.Version, func(rootHash hash.Hash) error {
+	writeLog, _, err := t.commitWithHooks(ctx, root.Namespace, root.Version, true, func(rootHash hash.Hash) error {
 		if !rootHash.Equal(&root.Hash) {
 			return ErrKnownRootMismatch
 		}
@@ -39,27 +110,94 @@ func (t *tree) CommitKnown(ctx context.Context, root node.Root) (writelog.WriteL
 
 // Implements Tree.
 func (t *tree) Commit(ctx context.Context, namespace common.Namespace, version uint64, options ...CommitOption) (writelog.WriteLog, hash.Hash, error) {
-	return t.commitWithHooks(ctx, namespace, version, nil, options...)
+	return t.commitWithHooks(ctx, namespace, version, false, nil, options...)
+}
+
+// Implements Tree.
+func (t *tree) OnCommit(hook func(root node.Root)) {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	t.commitHooks = append(t.commitHooks, commitHook{fn: hook})
+}
+
+// Implements Tree.
+func (t *tree) OnCommitPersist(hook func(root node.Root)) {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	t.commitHooks = append(t.commitHooks, commitHook{fn: hook, known: true})
+}
+
+// commitHook is a tree-level hook registered via OnCommit or OnCommitPersist.
+type commitHook struct {
+	fn func(root node.Root)
+	// known is true iff the hook should also fire for CommitKnown.
+	known bool
+}
+
+// takeCommitHooksLocked removes and returns all registered tree-level hooks that should fire
+// after a successful commit.
+func (t *tree) takeCommitHooksLocked(known bool) []func(node.Root) {
+	var (
+		fire      []func(node.Root)
+		remaining []commitHook
+	)
+	for _, hook := range t.commitHooks {
+		if known && !hook.known {
+			remaining = append(remaining, hook)
+			continue
+		}
+		fire = append(fire, hook.fn)
+	}
+	t.commitHooks = remaining
+	return fire
 }
 
 func (t *tree) commitWithHooks(
 	ctx context.Context,
 	namespace common.Namespace,
 	version uint64,
+	known bool,
 	beforeDbCommit func(hash.Hash) error,
 	options ...CommitOption,
 ) (writelog.WriteLog, hash.Hash, error) {
+	log, root, hooks, err := t.commitLocked(ctx, namespace, version, known, beforeDbCommit, options...)
+	if err != nil {
+		return nil, hash.Hash{}, err
+	}
+
+	// Fire tree-level hooks without holding the lock so that they are free to use the tree.
+	for _, hook := range hooks {
+		hook(root)
+	}
+
+	return log, root.Hash, nil
+}
+
+// commitLocked commits the tree and returns the tree-level hooks that should fire afterwards.
+func (t *tree) commitLocked(
+	ctx context.Context,
+	namespace common.Namespace,
+	version uint64,
+	known bool,
+	beforeDbCommit func(hash.Hash) error,
+	options ...CommitOption,
+) (writelog.WriteLog, node.Root, []func(node.Root), error) {
 	t.cache.Lock()
 	defer t.cache.Unlock()
 
 	if t.cache.isClosed() {
-		return nil, hash.Hash{}, ErrClosed
+		return nil, node.Root{}, nil, ErrClosed
 	}
 
 	var opts commitOptions
 	for _, o := range options {
 		o(&opts)
 	}
+	if opts.stats != nil {
+		*opts.stats = CommitStats{}
+	}
 
 	oldRoot := t.cache.getSyncRoot()
 	if oldRoot.IsEmpty() {
@@ -67,6 +205,14 @@ func (t *tree) commitWithHooks(
 		oldRoot.Version = version
 		oldRoot.Type = t.rootType
 	}
+	// Clean nodes have been hashed in the domain of the old root, so the namespace cannot change
+	// when it is mixed into node hashes.
+	if oldRoot.HashMode == node.HashModeNamespaced && !oldRoot.Namespace.Equal(&namespace) {
+		return nil, node.Root{}, nil, fmt.Errorf("%w: cannot commit tree from namespace %s under namespace %s",
+			db.ErrHashModeMismatch, oldRoot.Namespace, namespace,
+		)
+	}
+	domain := node.HashDomain{Mode: oldRoot.HashMode, Namespace: namespace}
 
 	var batch db.Batch
 	var err error
@@ -79,47 +225,58 @@ func (t *tree) commitWithHooks(
 		batch, err = nopDb.NewBatch(oldRoot, version, false)
 	}
 	if err != nil {
-		return nil, hash.Hash{}, err
+		return nil, node.Root{}, nil, err
 	}
 	defer batch.Reset()
 
 	subtree := batch.MaybeStartSubtree(nil, 0, t.cache.pendingRoot)
 
-	rootHash, err := doCommit(ctx, t.cache, batch, subtree, 0, t.cache.pendingRoot)
+	var committed []*node.Pointer
+	rootHash, err := doCommit(ctx, batch, subtree, domain, opts.stats, &committed, 0, t.cache.pendingRoot)
 	if err != nil {
-		return nil, hash.Hash{}, err
+		return nil, node.Root{}, nil, err
 	}
+	// Register a single hook for all committed pointers instead of one hook per node, as the
+	// hooks are kept in memory until the batch is committed.
+	batch.OnCommit(func() {
+		for _, ptr := range committed {
+			markClean(t.cache, ptr)
+		}
+	})
 	if err := subtree.Commit(); err != nil {
-		return nil, hash.Hash{}, err
+		return nil, node.Root{}, nil, err
 	}
 
 	// Perform pre-commit validation if configured.
 	if beforeDbCommit != nil {
 		if err := beforeDbCommit(rootHash); err != nil {
-			return nil, hash.Hash{}, err
+			return nil, node.Root{}, nil, err
 		}
 	}
 
-	// Store write log summaries.
+	// Store write log summaries, unless the caller does not need them.
 	var log writelog.WriteLog
 	var logAnns writelog.Annotations
-	for _, entry := range t.pendingWriteLog {
-		// Skip all entries that do not exist after all the updates and
-		// did not exist before.
-		if entry.value == nil && !entry.existed {
-			continue
-		}
+	if !opts.noWriteLog {
+		for _, entry := range t.pendingWriteLog {
+			// Skip all entries that do not exist after all the updates and
+			// did not exist before.
+			if entry.value == nil && !entry.existed {
+				continue
+			}
 
-		log = append(log, writelog.LogEntry{Key: entry.key, Value: entry.value})
-		if len(entry.value) == 0 {
-			logAnns = append(logAnns, writelog.LogEntryAnnotation{InsertedNode: nil})
-		} else {
-			logAnns = append(logAnns, writelog.LogEntryAnnotation{InsertedNode: entry.insertedLeaf})
+			log = append(log, writelog.LogEntry{Key: entry.key, Value: entry.value})
+			if len(entry.value) == 0 {
+				logAnns = append(logAnns, writelog.LogEntryAnnotation{InsertedNode: nil})
+			} else {
+				logAnns = append(logAnns, writelog.LogEntryAnnotation{InsertedNode: entry.insertedLeaf})
+			}
 		}
 	}
 
 	if opts.noPersist {
-		return log, rootHash, nil
+		// Nothing has been committed to the database, so no hooks fire.
+		return log, node.Root{Namespace: namespace, Version: version, Type: oldRoot.Type, Hash: rootHash, HashMode: domain.Mode}, nil, nil
 	}
 
 	root := node.Root{
@@ -127,36 +284,58 @@ func (t *tree) commitWithHooks(
 		Version:   version,
 		Type:      oldRoot.Type,
 		Hash:      rootHash,
+		HashMode:  domain.Mode,
 	}
-	if err := batch.PutWriteLog(log, logAnns); err != nil {
-		return nil, hash.Hash{}, err
+	switch opts.noWriteLog || opts.noPersistWriteLog {
+	case false:
+		err = batch.PutWriteLog(log, logAnns)
+	case true:
+		err = batch.SkipWriteLog()
+	}
+	if err != nil {
+		return nil, node.Root{}, nil, err
 	}
 
 	// Store removed nodes.
 	if err := batch.RemoveNodes(t.pendingRemovedNodes); err != nil {
-		return nil, hash.Hash{}, err
+		return nil, node.Root{}, nil, err
 	}
 
 	// And finally commit to the database.
 	if err := batch.Commit(root); err != nil {
-		return nil, hash.Hash{}, err
+		return nil, node.Root{}, nil, err
 	}
 
 	t.pendingWriteLog = make(map[string]*pendingEntry)
 	t.pendingRemovedNodes = nil
 	t.cache.setSyncRoot(root)
 
-	return log, rootHash, nil
+	return log, root, t.takeCommitHooksLocked(known), nil
+}
+
+// markClean marks a committed pointer and its node as clean, making the node
+// eligible for eviction from the in-memory cache.
+func markClean(cache *cache, ptr *node.Pointer) {
+	switch n := ptr.Node.(type) {
+	case *node.InternalNode:
+		n.Clean = true
+	case *node.LeafNode:
+		n.Clean = true
+	}
+	ptr.Clean = true
+	cache.commitNode(ptr)
 }
 
 // doCommit commits all dirty nodes and values into the underlying node
-// database. This operation may cause committed nodes and values to be
-// evicted from the in-memory cache.
+// database. All pointers that need to be marked clean once the batch is
+// committed are appended to committed in post-order.
 func doCommit(
 	ctx context.Context,
-	cache *cache,
 	batch db.Batch,
 	subtree db.Subtree,
+	domain node.HashDomain,
+	stats *CommitStats,
+	committed *[]*node.Pointer,
 	depth node.Depth,
 	ptr *node.Pointer,
 ) (h hash.Hash, err error) {
@@ -167,6 +346,9 @@ func doCommit(
 		if err = subtree.VisitCleanNode(depth, ptr); err != nil {
 			return
 		}
+		if !ptr.Hash.IsEmpty() {
+			stats.addReusedNode()
+		}
 		h = ptr.Hash
 		return
 	}
@@ -174,9 +356,9 @@ func doCommit(
 	// Pointer is not clean, we need to perform some hash computations.
 
 	// NOTE: Irreversible cache operations like clearing the dirty flags
-	//       and updating node/value cache status must be queued via batch
-	//       on-commit hooks as the database operations can fail and this
-	//       must not cause the in-memory cache to be corrupted.
+	//       and updating node/value cache status must be deferred until
+	//       the batch is committed as the database operations can fail and
+	//       this must not cause the in-memory cache to be corrupted.
 
 	switch n := ptr.Node.(type) {
 	case nil:
@@ -189,13 +371,13 @@ func doCommit(
 		}
 
 		// Commit internal leaf (considered to be on the same depth as the internal node).
-		if _, err = doCommit(ctx, cache, batch, subtree, depth, n.LeafNode); err != nil {
+		if _, err = doCommit(ctx, batch, subtree, domain, stats, committed, depth, n.LeafNode); err != nil {
 			return
 		}
 
 		for _, subNode := range []*node.Pointer{n.Left, n.Right} {
 			newSubtree := batch.MaybeStartSubtree(subtree, depth+1, subNode)
-			if _, err = doCommit(ctx, cache, batch, newSubtree, depth+1, subNode); err != nil {
+			if _, err = doCommit(ctx, batch, newSubtree, domain, stats, committed, depth+1, subNode); err != nil {
 				return
 			}
 			if newSubtree != subtree {
@@ -205,16 +387,15 @@ func doCommit(
 			}
 		}
 
-		n.UpdateHash()
+		n.UpdateHashInDomain(domain)
 
 		// Store the node.
 		if err = subtree.PutNode(depth, ptr); err != nil {
 			return
 		}
-
-		batch.OnCommit(func() {
-			n.Clean = true
-		})
+		if err = stats.addNode(n); err != nil {
+			return
+		}
 		ptr.Hash = n.Hash
 	case *node.LeafNode:
 		// Leaf node.
@@ -222,24 +403,19 @@ func doCommit(
 			panic("mkvs: non-clean pointer has clean node")
 		}
 
-		n.UpdateHash()
+		n.UpdateHashInDomain(domain)
 
 		// Store the node.
 		if err = subtree.PutNode(depth, ptr); err != nil {
 			return
 		}
-
-		batch.OnCommit(func() {
-			n.Clean = true
-		})
+		if err = stats.addNode(n); err != nil {
+			return
+		}
 		ptr.Hash = n.Hash
 	}
 
-	batch.OnCommit(func() {
-		ptr.Clean = true
-		// Make node eligible for eviction.
-		cache.commitNode(ptr)
-	})
+	*committed = append(*committed, ptr)
 	h = ptr.Hash
 	return
 }
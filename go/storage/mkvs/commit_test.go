@@ -0,0 +1,279 @@
+package mkvs
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	badgerDb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/badger"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+// collectNodes returns all nodes reachable from the given root.
+func collectNodes(t *testing.T, ndb db.NodeDB, root node.Root) map[hash.Hash]node.Node {
+	nodes := make(map[hash.Hash]node.Node)
+
+	var walk func(h hash.Hash)
+	walk = func(h hash.Hash) {
+		if h.IsEmpty() || nodes[h] != nil {
+			return
+		}
+		n, err := ndb.GetNode(root, &node.Pointer{Clean: true, Hash: h})
+		require.NoError(t, err, "GetNode")
+		nodes[h] = n
+
+		if in, ok := n.(*node.InternalNode); ok {
+			for _, ptr := range []*node.Pointer{in.LeafNode, in.Left, in.Right} {
+				if ptr != nil {
+					walk(ptr.Hash)
+				}
+			}
+		}
+	}
+	walk(root.Hash)
+
+	return nodes
+}
+
+// countCreatedNodes computes the commit stats of the new root by comparing the nodes reachable
+// from the old and the new root.
+func countCreatedNodes(t *testing.T, ndb db.NodeDB, oldRoot, newRoot node.Root) CommitStats {
+	var oldNodes map[hash.Hash]node.Node
+	if oldRoot.Hash.IsEmpty() {
+		oldNodes = make(map[hash.Hash]node.Node)
+	} else {
+		oldNodes = collectNodes(t, ndb, oldRoot)
+	}
+	newNodes := collectNodes(t, ndb, newRoot)
+
+	var stats CommitStats
+	if oldNodes[newRoot.Hash] != nil {
+		// Nothing has changed, the old root is reused.
+		stats.ReusedNodes++
+		return stats
+	}
+	for h, n := range newNodes {
+		if oldNodes[h] != nil {
+			continue
+		}
+
+		data, err := node.MarshalVersionedBinary(n)
+		require.NoError(t, err, "MarshalVersionedBinary")
+		stats.Bytes += uint64(len(data))
+
+		switch n := n.(type) {
+		case *node.InternalNode:
+			stats.InternalNodes++
+			for _, ptr := range []*node.Pointer{n.LeafNode, n.Left, n.Right} {
+				if ptr != nil && oldNodes[ptr.Hash] != nil {
+					stats.ReusedNodes++
+				}
+			}
+		case *node.LeafNode:
+			stats.LeafNodes++
+		}
+	}
+	return stats
+}
+
+func TestCommitStats(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ndb, err := badgerDb.New(&db.Config{
+		MemoryOnly:     true,
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
+	})
+	require.NoError(err, "New")
+	defer ndb.Close()
+
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+
+	root := node.Root{Namespace: testNs, Type: node.RootTypeState}
+	root.Hash.Empty()
+
+	for version, wl := range []writelog.WriteLog{
+		// Fresh tree with both internal and non-internal leaf nodes.
+		{
+			{Key: []byte("foo"), Value: []byte("foo")},
+			{Key: []byte("foo bar"), Value: []byte("foo bar")},
+			{Key: []byte("moo"), Value: []byte("moo")},
+			{Key: []byte("boo"), Value: []byte("boo")},
+			{Key: []byte("goo"), Value: []byte("goo")},
+		},
+		// Updates and inserts.
+		{
+			{Key: []byte("foo bar"), Value: []byte("updated foo bar")},
+			{Key: []byte("zoo"), Value: []byte("zoo")},
+		},
+		// Removals.
+		{
+			{Key: []byte("moo")},
+		},
+		// No changes.
+		{},
+	} {
+		err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog")
+
+		var stats CommitStats
+		_, rootHash, err := tree.Commit(ctx, testNs, uint64(version), WithCommitStats(&stats))
+		require.NoError(err, "Commit")
+
+		newRoot := node.Root{Namespace: testNs, Version: uint64(version), Type: node.RootTypeState, Hash: rootHash}
+		require.Equal(countCreatedNodes(t, ndb, root, newRoot), stats, "commit stats for version %d", version)
+		root = newRoot
+	}
+
+	// Stats should also be available when not persisting.
+	err = tree.Insert(ctx, []byte("noo"), []byte("noo"))
+	require.NoError(err, "Insert")
+	var stats CommitStats
+	_, _, err = tree.Commit(ctx, testNs, 4, NoPersist(), WithCommitStats(&stats))
+	require.NoError(err, "Commit")
+	require.NotZero(stats.LeafNodes, "leaf nodes should be counted")
+	require.NotZero(stats.Bytes, "bytes should be counted")
+}
+
+// envCommitStressTest enables the large commit stress test when set to a non-empty value.
+var envCommitStressTest = os.Getenv("OASIS_TEST_MKVS_COMMIT_STRESS")
+
+// generateCommitWriteLog generates a write log with the given number of entries.
+func generateCommitWriteLog(entries int) writelog.WriteLog {
+	wl := make(writelog.WriteLog, 0, entries)
+	for i := 0; i < entries; i++ {
+		var key [8]byte
+		binary.BigEndian.PutUint64(key[:], uint64(i))
+		// Hash the keys so that they are distributed evenly across the tree.
+		h := hash.NewFromBytes(key[:])
+		wl = append(wl, writelog.LogEntry{Key: h[:], Value: key[:]})
+	}
+	return wl
+}
+
+// commitGeneratedWriteLog applies a generated write log to a fresh tree backed by a new node
+// database using the given batch flush threshold and returns the resulting root hash together
+// with the peak growth of the heap during the commit and the heap used by the uncommitted tree.
+func commitGeneratedWriteLog(t *testing.T, entries int, flushThreshold int64) (hash.Hash, uint64, uint64) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "mkvs.test.commit")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dir)
+
+	ndb, err := badgerDb.New(&db.Config{
+		DB:                  dir,
+		NoFsync:             true,
+		Namespace:           testNs,
+		BlockCacheSize:      16 * 1024 * 1024,
+		BatchFlushThreshold: flushThreshold,
+	})
+	require.NoError(err, "New")
+	defer ndb.Close()
+
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	heapBeforeTree := ms.HeapInuse
+
+	tree := New(nil, ndb, node.RootTypeState, Capacity(0, 0))
+	defer tree.Close()
+	err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(generateCommitWriteLog(entries)))
+	require.NoError(err, "ApplyWriteLog")
+
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	heapBeforeCommit := ms.HeapInuse
+	treeSize := heapBeforeCommit - heapBeforeTree
+
+	// Sample the heap while committing.
+	var (
+		wg       sync.WaitGroup
+		peakHeap uint64
+	)
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var sample runtime.MemStats
+			runtime.ReadMemStats(&sample)
+			if sample.HeapInuse > peakHeap {
+				peakHeap = sample.HeapInuse
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	close(done)
+	wg.Wait()
+	require.NoError(err, "Commit")
+
+	var commitGrowth uint64
+	if peakHeap > heapBeforeCommit {
+		commitGrowth = peakHeap - heapBeforeCommit
+	}
+
+	// Make sure that the committed root is complete.
+	root := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+	committedTree := NewWithRoot(nil, ndb, root)
+	defer committedTree.Close()
+	it := committedTree.NewIterator(ctx)
+	defer it.Close()
+	var count int
+	for it.Rewind(); it.Valid(); it.Next() {
+		count++
+	}
+	require.NoError(it.Err(), "iterator should not fail")
+	require.Equal(entries, count, "all committed entries should be present")
+
+	return rootHash, commitGrowth, treeSize
+}
+
+func TestCommitBatchFlush(t *testing.T) {
+	const entries = 10_000
+
+	// Use a tiny flush threshold to force many intermediate flushes.
+	unboundedRoot, _, _ := commitGeneratedWriteLog(t, entries, 0)
+	boundedRoot, _, _ := commitGeneratedWriteLog(t, entries, 1024)
+	require.Equal(t, unboundedRoot, boundedRoot, "root hash should not depend on batch flushing")
+}
+
+func TestCommitStress(t *testing.T) {
+	if envCommitStressTest == "" {
+		t.Skip("skipping commit stress test, set OASIS_TEST_MKVS_COMMIT_STRESS to enable")
+	}
+
+	// Collect garbage more aggressively so that heap samples reflect live memory.
+	defer debug.SetGCPercent(debug.SetGCPercent(10))
+
+	const entries = 1_000_000
+	_, commitGrowth, treeSize := commitGeneratedWriteLog(t, entries, 16*1024*1024)
+	t.Logf("tree size: %d bytes, commit heap growth: %d bytes", treeSize, commitGrowth)
+
+	// Committing necessarily produces a write log covering all entries and the node database has
+	// its own buffers, but it should not hold additional per-node state for the whole tree. The
+	// budget is generous to account for the imprecision of heap sampling.
+	require.Less(t, commitGrowth, 2*treeSize, "commit heap growth should be bounded")
+}
@@ -3,8 +3,12 @@ package api
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/common/errors"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
@@ -53,8 +57,97 @@ var (
 	// ErrUpgradeInProgress indicates that a database upgrade was started by the upgrader tool and the
 	// database is therefore unusable. Run the upgrade tool to finish upgrading.
 	ErrUpgradeInProgress = errors.New(ModuleName, 15, "mkvs: database upgrade in progress")
+	// ErrNotSupported indicates that the operation is not supported by the node database backend.
+	ErrNotSupported = errors.New(ModuleName, 16, "mkvs: operation not supported")
+	// ErrInvalidCacheSize indicates that the given cache sizes are invalid.
+	ErrInvalidCacheSize = errors.New(ModuleName, 17, "mkvs: invalid cache size")
+	// ErrCorruptedNode indicates that a node read from the database does not match the hash it
+	// is stored under.
+	ErrCorruptedNode = errors.New(ModuleName, 18, "mkvs: corrupted node")
+	// ErrRootTypeMismatch indicates that the given root exists, but with a different root type.
+	ErrRootTypeMismatch = errors.New(ModuleName, 19, "mkvs: root type mismatch")
+	// ErrWriteLogNotAvailable indicates that the root pair exists, but its write log has not been
+	// stored as the root was committed without a write log.
+	ErrWriteLogNotAvailable = errors.New(ModuleName, 20, "mkvs: write log not available")
+	// ErrWriteLogsPruned indicates that write logs for a requested version have already been
+	// pruned.
+	ErrWriteLogsPruned = errors.New(ModuleName, 21, "mkvs: write logs have been pruned")
+
+	// ErrInvalidVisitToken indicates that a resumable traversal token is malformed or belongs to
+	// a different root.
+	ErrInvalidVisitToken = errors.New(ModuleName, 22, "mkvs: invalid visit token")
+	// ErrHashModeMismatch indicates that the hash mode of the given root does not match the hash
+	// mode of the node database.
+	ErrHashModeMismatch = errors.New(ModuleName, 23, "mkvs: hash mode mismatch")
+	// ErrKeyFilterNotFound indicates that no key filter is available for the given root.
+	ErrKeyFilterNotFound = errors.New(ModuleName, 24, "mkvs: key filter not found")
 )
 
+// CorruptedNodeError is the error returned when a node read from the database does not match the
+// hash it is stored under.
+type CorruptedNodeError struct {
+	// Hash is the hash the node is stored under.
+	Hash hash.Hash
+	// Key is the database key the node is stored under.
+	Key []byte
+	// ComputedHash is the hash computed from the stored node.
+	ComputedHash hash.Hash
+}
+
+// Error returns a string representation of the error.
+func (e *CorruptedNodeError) Error() string {
+	return fmt.Sprintf("%s: expected hash %s, got %s (key: %X)", ErrCorruptedNode, e.Hash, e.ComputedHash, e.Key)
+}
+
+// Unwrap returns the underlying error.
+func (e *CorruptedNodeError) Unwrap() error {
+	return ErrCorruptedNode
+}
+
+// MissingNodeError is the error returned when a node of a root is missing from the database.
+type MissingNodeError struct {
+	// Root is the root that was checked.
+	Root node.Root
+	// Hash is the hash of the first missing node.
+	Hash hash.Hash
+}
+
+// Error returns a string representation of the error.
+func (e *MissingNodeError) Error() string {
+	return fmt.Sprintf("%s: missing node %s (root: %s)", ErrNodeNotFound, e.Hash, e.Root)
+}
+
+// Unwrap returns the underlying error.
+func (e *MissingNodeError) Unwrap() error {
+	return ErrNodeNotFound
+}
+
+// RootTypeMismatchError is the error returned when a root is looked up with a different type than
+// the one it is stored under (e.g., an I/O root is queried as a state root).
+//
+// As the root does not exist under the requested type, the error also matches ErrRootNotFound.
+type RootTypeMismatchError struct {
+	// Root is the requested root.
+	Root node.Root
+	// StoredType is the type the root is stored under.
+	StoredType node.RootType
+}
+
+// Error returns a string representation of the error.
+func (e *RootTypeMismatchError) Error() string {
+	return fmt.Sprintf("%s: root %s is stored as %s", ErrRootTypeMismatch, e.Root, e.StoredType)
+}
+
+// Unwrap returns the underlying error.
+func (e *RootTypeMismatchError) Unwrap() error {
+	return ErrRootTypeMismatch
+}
+
+// Is returns true iff the target error is ErrRootNotFound.
+func (e *RootTypeMismatchError) Is(target error) bool {
+	return target == ErrRootNotFound
+}
+
 // Config is the node database backend configuration.
 type Config struct { // nolint: maligned
 	// DB is the path to the database.
@@ -72,14 +165,198 @@ type Config struct { // nolint: maligned
 	// Namespace is the namespace contained within the database.
 	Namespace common.Namespace
 
-	// MaxCacheSize is the maximum in-memory cache size for the database.
-	MaxCacheSize int64
+	// HashMode is the node hash construction used by all roots within the database. The setting
+	// is persisted when the database is created and opening an existing database with a different
+	// setting fails.
+	HashMode node.HashMode
+
+	// BlockCacheSize is the maximum size of the in-memory block cache for the database. If zero,
+	// a backend-specific default is used.
+	BlockCacheSize int64
+
+	// IndexCacheSize is the maximum size of the in-memory index cache for the database. If zero,
+	// all indices are kept in memory.
+	IndexCacheSize int64
 
 	// DiscardWriteLogs will cause all write logs to be discarded.
 	DiscardWriteLogs bool
+
+	// StrictOpen will cause opening the database to fail instead of automatically recovering
+	// when an inconsistency is detected (e.g., after an unclean shutdown).
+	StrictOpen bool
+
+	// BatchFlushThreshold is the number of bytes of serialized nodes a batch buffers before
+	// flushing them to the database, bounding the memory used by large commits. Flushed nodes
+	// are not reachable until the batch is committed, but remain in the database in case the
+	// batch is discarded afterwards. If zero, flushing is left to the backend.
+	BatchFlushThreshold int64
+
+	// MaxTransactionSize is the maximum size in bytes of a single underlying database transaction
+	// used when committing a batch. Commits exceeding it are transparently split across multiple
+	// transactions while remaining atomic. If zero, only the limits of the backend apply.
+	MaxTransactionSize int64
+
+	// NodeKeyShards is the number of key prefixes across which node keys are distributed based on
+	// the first byte of the node hash, spreading writes and compactions. Zero or one disables
+	// sharding. The setting is persisted when the database is created and opening an existing
+	// database with a different setting fails.
+	NodeKeyShards int
+
+	// VerifyNodeHashes will cause the hash of each node read from the database to be checked
+	// against the hash it is stored under, detecting on-disk corruption before it propagates.
+	VerifyNodeHashes bool
+
+	// VerifyNodeHashesSampleRate limits hash verification to one in every N node reads on
+	// average when VerifyNodeHashes is set. Zero or one verifies every read.
+	VerifyNodeHashesSampleRate uint32
+
+	// SlowOpThresholds are the per-operation durations above which operations are reported as
+	// slow. Operations without a threshold are not reported.
+	SlowOpThresholds map[Operation]time.Duration
+
+	// SlowOpHook is an optional hook which is notified about slow operations in addition to them
+	// being logged.
+	SlowOpHook SlowOpHook
+
+	// MetadataSnapshot will cause a compact snapshot of the database metadata to be written next
+	// to the database directory whenever a version is finalized or pruned, so that the metadata
+	// can be recovered in case it is lost. Not all backends support metadata snapshots.
+	MetadataSnapshot bool
+
+	// KeyFilterMaxSize is the maximum size in bytes of the key filter built over the keys of all
+	// roots of each finalized version, which allows lookups of absent keys to complete without
+	// traversing the tree. Larger versions get filters with a higher false positive rate. Key
+	// filters are built in the background after finalization, so versions may lack one. If zero,
+	// key filters are not built. Not all backends support key filters.
+	KeyFilterMaxSize int64
+}
+
+// MaxNodeKeyShards is the maximum number of node key shards.
+const MaxNodeKeyShards = 256
+
+// ValidateCacheSizes checks whether the given block and index cache sizes are valid.
+func ValidateCacheSizes(blockCacheSize, indexCacheSize int64) error {
+	if blockCacheSize < 0 {
+		return fmt.Errorf("%w: negative block cache size (%d)", ErrInvalidCacheSize, blockCacheSize)
+	}
+	if indexCacheSize < 0 {
+		return fmt.Errorf("%w: negative index cache size (%d)", ErrInvalidCacheSize, indexCacheSize)
+	}
+	if blockCacheSize > math.MaxInt64-indexCacheSize {
+		return fmt.Errorf("%w: combined cache size overflows", ErrInvalidCacheSize)
+	}
+	return nil
+}
+
+// Validate validates the node database configuration.
+func (cfg *Config) Validate() error {
+	if err := ValidateCacheSizes(cfg.BlockCacheSize, cfg.IndexCacheSize); err != nil {
+		return err
+	}
+	if cfg.MemoryOnly && cfg.IndexCacheSize > 0 {
+		// All tables of a memory-only database are kept in memory so an index cache only wastes
+		// memory on top of that.
+		return fmt.Errorf("%w: index cache cannot be used with a memory-only database", ErrInvalidCacheSize)
+	}
+	if cfg.BatchFlushThreshold < 0 {
+		return fmt.Errorf("negative batch flush threshold (%d)", cfg.BatchFlushThreshold)
+	}
+	if cfg.MaxTransactionSize < 0 {
+		return fmt.Errorf("negative maximum transaction size (%d)", cfg.MaxTransactionSize)
+	}
+	if cfg.MetadataSnapshot && cfg.MemoryOnly {
+		return fmt.Errorf("metadata snapshots cannot be used with a memory-only database")
+	}
+	if !cfg.HashMode.IsValid() {
+		return fmt.Errorf("invalid hash mode (%d)", cfg.HashMode)
+	}
+	if cfg.KeyFilterMaxSize < 0 {
+		return fmt.Errorf("negative maximum key filter size (%d)", cfg.KeyFilterMaxSize)
+	}
+	if cfg.NodeKeyShards < 0 || cfg.NodeKeyShards > MaxNodeKeyShards {
+		return fmt.Errorf("invalid number of node key shards (%d)", cfg.NodeKeyShards)
+	}
+	for op, threshold := range cfg.SlowOpThresholds {
+		if threshold < 0 {
+			return fmt.Errorf("negative slow operation threshold for %s (%s)", op, threshold)
+		}
+	}
+	return nil
+}
+
+// CacheStats are the node database in-memory cache statistics.
+type CacheStats struct {
+	// BlockCacheSize is the configured maximum size of the block cache.
+	BlockCacheSize int64 `json:"block_cache_size"`
+	// BlockCacheUsed is the current size of the block cache.
+	BlockCacheUsed int64 `json:"block_cache_used"`
+	// IndexCacheSize is the configured maximum size of the index cache.
+	IndexCacheSize int64 `json:"index_cache_size"`
+	// IndexCacheUsed is the current size of the index cache.
+	IndexCacheUsed int64 `json:"index_cache_used"`
+}
+
+// StorageBreakdown is the attribution of the space used by a node database to node data and
+// write logs.
+//
+// Sizes are the total sizes of the stored keys and values, not including any storage overhead
+// or compression of the underlying database.
+type StorageBreakdown struct {
+	// NodeBytes is the total size of all stored nodes.
+	NodeBytes uint64 `json:"node_bytes"`
+	// WriteLogBytes is the total size of all stored write logs.
+	WriteLogBytes uint64 `json:"write_log_bytes"`
+	// Versions is the breakdown by the version in which the data was written, in ascending
+	// version order. Versions without any stored nodes or write logs are omitted.
+	Versions []VersionStorage `json:"versions,omitempty"`
+}
+
+// VersionStorage is the space used by nodes and write logs written in a given version.
+type VersionStorage struct {
+	// Version is the version.
+	Version uint64 `json:"version"`
+	// NodeBytes is the size of the stored nodes written in the version.
+	NodeBytes uint64 `json:"node_bytes"`
+	// WriteLogBytes is the size of the stored write logs of roots in the version.
+	WriteLogBytes uint64 `json:"write_log_bytes"`
+}
+
+// NonFinalizedVersion describes a version with committed roots that has not yet been finalized.
+type NonFinalizedVersion struct {
+	// Version is the version.
+	Version uint64 `json:"version"`
+	// NumRoots is the number of roots committed in the version.
+	NumRoots uint64 `json:"num_roots"`
+}
+
+// VersionWriteLog is a write log between two finalized roots.
+type VersionWriteLog struct {
+	// SrcRoot is the root the write log applies to.
+	SrcRoot node.Root
+	// DstRoot is the root resulting from applying the write log.
+	DstRoot node.Root
+	// WriteLog is the iterator over the write log entries.
+	WriteLog writelog.Iterator
+}
+
+// VersionWriteLogIterator iterates over write logs of a range of versions.
+type VersionWriteLogIterator interface {
+	// Next advances the iterator to the next write log and returns false if there are no more
+	// write logs.
+	Next() (bool, error)
+	// Value returns the write log the iterator is currently pointing to.
+	//
+	// The returned write log iterator streams entries from the database and must either be
+	// consumed or the context used to create the iterator must be canceled.
+	Value() (*VersionWriteLog, error)
 }
 
 // NodeDB is the persistence layer used for persisting the in-memory tree.
+//
+// All methods are safe for concurrent use. Batches (including batches for the same version, e.g.
+// of independent roots) may be written and committed concurrently, while each batch must only be
+// used by a single goroutine at a time. Operations which change the set of versions or roots that
+// batches are committed against (e.g., Finalize and Prune) are serialized with batch commits.
 type NodeDB interface {
 	// GetNode looks up a node in the database.
 	GetNode(root node.Root, ptr *node.Pointer) (node.Node, error)
@@ -87,15 +364,32 @@ type NodeDB interface {
 	// GetWriteLog retrieves a write log between two storage instances from the database.
 	GetWriteLog(ctx context.Context, startRoot, endRoot node.Root) (writelog.Iterator, error)
 
+	// WriteLogIterator returns an iterator over the write logs of all finalized roots in the
+	// given (inclusive) version range, in version order. Within a version, write logs are
+	// ordered so that each write log comes after the write log producing its source root.
+	//
+	// Write logs are loaded from the database as the iterator advances. In case write logs of
+	// any version in the range have been pruned, ErrWriteLogsPruned is returned and in case any
+	// version in the range has not yet been finalized, ErrNotFinalized is returned.
+	WriteLogIterator(ctx context.Context, startVersion, endVersion uint64, namespace common.Namespace) (VersionWriteLogIterator, error)
+
 	// GetLatestVersion returns the most recent version in the node database.
 	GetLatestVersion(ctx context.Context) (uint64, error)
 
 	// GetEarliestVersion returns the earliest version in the node database.
 	GetEarliestVersion(ctx context.Context) (uint64, error)
 
+	// GetEarliestWriteLogVersion returns the earliest version for which write logs are available
+	// in the node database.
+	GetEarliestWriteLogVersion(ctx context.Context) (uint64, error)
+
 	// GetRootsForVersion returns a list of roots stored under the given version.
 	GetRootsForVersion(ctx context.Context, version uint64) ([]node.Root, error)
 
+	// NonFinalizedVersions returns all versions with committed roots that have not yet been
+	// finalized, in ascending order.
+	NonFinalizedVersions(ctx context.Context) ([]NonFinalizedVersion, error)
+
 	// StartMultipartInsert prepares the database for a batch insert job from multiple chunks.
 	// Batches from this call onwards will keep track of inserted nodes so that they can be
 	// deleted if the job fails for any reason.
@@ -119,15 +413,65 @@ type NodeDB interface {
 	// HasRoot checks whether the given root exists.
 	HasRoot(root node.Root) bool
 
+	// HasSubtree checks whether the nodes of the given root exist without reconstructing the
+	// tree. The root node and all nodes up to (and including) the given node depth are checked,
+	// so a depth limit of zero only checks the root node itself.
+	HasSubtree(ctx context.Context, root node.Root, depthLimit node.Depth) (bool, error)
+
+	// HasAllNodes checks whether all nodes of the given root exist, stopping at the first node
+	// that is missing. In case a node is missing, a *MissingNodeError is returned.
+	HasAllNodes(ctx context.Context, root node.Root) error
+
 	// Finalize finalizes the version comprising the passed list of finalized roots.
 	// All non-finalized roots can be discarded.
+	//
+	// Finalizing an already finalized version with the same set of roots is a no-op, while a
+	// different set of roots results in ErrAlreadyFinalized.
 	Finalize(ctx context.Context, roots []node.Root) error
 
-	// Prune removes all roots recorded under the given version.
+	// FinalizeWithFilter finalizes the given version, keeping all roots in the version for which
+	// the keep predicate returns true. All other roots can be discarded.
+	//
+	// Finalizing with a filter is equivalent to calling Finalize with the list of kept roots.
+	FinalizeWithFilter(ctx context.Context, version uint64, keep func(root node.Root) bool) error
+
+	// Prune removes all roots and write logs recorded under the given version.
 	//
 	// Only the earliest version can be pruned, passing any other version will result in an error.
+	// In case write logs are retained for earlier versions (see PruneNodes), they must be pruned
+	// first.
 	Prune(ctx context.Context, version uint64) error
 
+	// PruneNodes removes all roots recorded under the given version while retaining its write
+	// logs. Retained write logs remain available via GetWriteLog until they are pruned using
+	// PruneWriteLogs.
+	//
+	// Only the earliest version can be pruned, passing any other version will result in an error.
+	PruneNodes(ctx context.Context, version uint64) error
+
+	// PruneWriteLogs removes all write logs recorded under the given version while retaining
+	// its roots.
+	//
+	// Only the earliest version for which write logs are available can be pruned, passing any
+	// other version will result in an error.
+	PruneWriteLogs(ctx context.Context, version uint64) error
+
+	// PruneRootType removes all roots of the given type recorded under the given version while
+	// retaining roots of all other types and all write logs of retained roots. This makes it
+	// possible to retain I/O roots for a shorter period than state roots.
+	//
+	// Only finalized versions which have not yet been pruned can be pruned this way.
+	PruneRootType(ctx context.Context, version uint64, rootType node.RootType) error
+
+	// GetKeyFilter returns the key filter of the given finalized root, which covers the keys of
+	// all roots finalized in the root's version (see Config.KeyFilterMaxSize).
+	//
+	// In case no key filter is available for the root (e.g., because the version was finalized
+	// while key filters were disabled or the filter uses an unsupported format), the error
+	// ErrKeyFilterNotFound is returned. Backends which do not support key filters return
+	// ErrNotSupported.
+	GetKeyFilter(ctx context.Context, root node.Root) (*KeyFilter, error)
+
 	// Size returns the size of the database in bytes.
 	Size() (int64, error)
 
@@ -135,6 +479,21 @@ type NodeDB interface {
 	// perform a sync.
 	Sync() error
 
+	// CacheStats returns the current in-memory cache statistics.
+	CacheStats() CacheStats
+
+	// StorageBreakdown returns the attribution of the space used by the database to node data and
+	// write logs.
+	//
+	// Backends which do not track storage usage return ErrNotSupported.
+	StorageBreakdown(ctx context.Context) (*StorageBreakdown, error)
+
+	// ResizeCaches changes the maximum sizes of the in-memory block and index caches.
+	//
+	// Backends which do not support changing cache sizes without reopening the database return
+	// ErrNotSupported.
+	ResizeCaches(blockCacheSize, indexCacheSize int64) error
+
 	// Close closes the database.
 	Close()
 }
@@ -172,10 +531,21 @@ type Batch interface {
 	// PutWriteLog stores the specified write log into the batch.
 	PutWriteLog(writeLog writelog.WriteLog, logAnnotations writelog.Annotations) error
 
+	// SkipWriteLog marks the write log of the batch as not available instead of storing it, so
+	// that requesting it afterwards results in ErrWriteLogNotAvailable.
+	SkipWriteLog() error
+
 	// RemoveNodes marks nodes for eventual garbage collection.
 	RemoveNodes(nodes []node.Node) error
 
 	// Commit commits the batch.
+	//
+	// Committing a root that already exists is a no-op apart from firing the OnCommit hooks, so
+	// retried commits of identical content do not store anything twice. In case the version has
+	// already been finalized, committing succeeds iff the root has been finalized and otherwise
+	// results in ErrAlreadyFinalized.
+	//
+	// Concurrent commits of the same root are allowed and result in the root being stored once.
 	Commit(root node.Root) error
 
 	// Reset resets the batch for another use.
@@ -216,6 +586,10 @@ func (d *nopNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.Roo
 	return nil, ErrWriteLogNotFound
 }
 
+func (d *nopNodeDB) WriteLogIterator(ctx context.Context, startVersion, endVersion uint64, namespace common.Namespace) (VersionWriteLogIterator, error) {
+	return nil, ErrWriteLogNotFound
+}
+
 func (d *nopNodeDB) GetLatestVersion(ctx context.Context) (uint64, error) {
 	return 0, nil
 }
@@ -224,14 +598,33 @@ func (d *nopNodeDB) GetEarliestVersion(ctx context.Context) (uint64, error) {
 	return 0, nil
 }
 
+func (d *nopNodeDB) GetEarliestWriteLogVersion(ctx context.Context) (uint64, error) {
+	return 0, nil
+}
+
 func (d *nopNodeDB) GetRootsForVersion(ctx context.Context, version uint64) ([]node.Root, error) {
 	return nil, nil
 }
 
+func (d *nopNodeDB) NonFinalizedVersions(ctx context.Context) ([]NonFinalizedVersion, error) {
+	return nil, nil
+}
+
 func (d *nopNodeDB) HasRoot(root node.Root) bool {
 	return false
 }
 
+func (d *nopNodeDB) HasSubtree(ctx context.Context, root node.Root, depthLimit node.Depth) (bool, error) {
+	return root.Hash.IsEmpty(), nil
+}
+
+func (d *nopNodeDB) HasAllNodes(ctx context.Context, root node.Root) error {
+	if root.Hash.IsEmpty() {
+		return nil
+	}
+	return &MissingNodeError{Root: root, Hash: root.Hash}
+}
+
 func (d *nopNodeDB) StartMultipartInsert(version uint64) error {
 	return nil
 }
@@ -244,10 +637,30 @@ func (d *nopNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 	return nil
 }
 
+func (d *nopNodeDB) FinalizeWithFilter(ctx context.Context, version uint64, keep func(root node.Root) bool) error {
+	return nil
+}
+
 func (d *nopNodeDB) Prune(ctx context.Context, version uint64) error {
 	return nil
 }
 
+func (d *nopNodeDB) PruneNodes(ctx context.Context, version uint64) error {
+	return nil
+}
+
+func (d *nopNodeDB) PruneWriteLogs(ctx context.Context, version uint64) error {
+	return nil
+}
+
+func (d *nopNodeDB) PruneRootType(ctx context.Context, version uint64, rootType node.RootType) error {
+	return nil
+}
+
+func (d *nopNodeDB) GetKeyFilter(ctx context.Context, root node.Root) (*KeyFilter, error) {
+	return nil, ErrNotSupported
+}
+
 func (d *nopNodeDB) Size() (int64, error) {
 	return 0, nil
 }
@@ -256,6 +669,18 @@ func (d *nopNodeDB) Sync() error {
 	return nil
 }
 
+func (d *nopNodeDB) CacheStats() CacheStats {
+	return CacheStats{}
+}
+
+func (d *nopNodeDB) StorageBreakdown(ctx context.Context) (*StorageBreakdown, error) {
+	return &StorageBreakdown{}, nil
+}
+
+func (d *nopNodeDB) ResizeCaches(blockCacheSize, indexCacheSize int64) error {
+	return ErrNotSupported
+}
+
 func (d *nopNodeDB) Close() {
 }
 
@@ -276,6 +701,10 @@ func (b *nopBatch) PutWriteLog(writeLog writelog.WriteLog, logAnnotations writel
 	return nil
 }
 
+func (b *nopBatch) SkipWriteLog() error {
+	return nil
+}
+
 func (b *nopBatch) RemoveNodes(nodes []node.Node) error {
 	return nil
 }
@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
@@ -102,64 +104,107 @@ func ReviveHashedDBWriteLogs(
 // traversal of child nodes or false to stop.
 type NodeVisitor func(context.Context, node.Node) bool
 
+// visitTokenVersion is the version of the VisitToken format.
+const visitTokenVersion = 1
+
+// VisitToken is an opaque position of a resumable traversal, see VisitResumable.
+type VisitToken struct {
+	cbor.Versioned
+
+	// Root is the root being traversed.
+	Root node.Root `json:"root"`
+	// Frontier are the hashes of the subtrees which remain to be traversed, the last one being
+	// traversed first.
+	Frontier []hash.Hash `json:"frontier"`
+}
+
+// VisitCheckpointFunc is a function that is called with the current position of a resumable
+// traversal. Returning an error aborts the traversal.
+type VisitCheckpointFunc func(context.Context, *VisitToken) error
+
 // Visit traverses the tree in DFS order using the passed visitor. The traversal is
 // a pre-order DFS where the node is visited first, then its leaf (if any) and then
 // its children (first left then right).
 //
 // Different to the Visit method in the MKVS tree, this uses the NodeDB API directly
 // to traverse the tree to avoid the overhead of keeping the cache.
+//
+// An empty root has no nodes, so the visitor is never called for it.
 func Visit(ctx context.Context, ndb NodeDB, root node.Root, visitor NodeVisitor) error {
-	ptr := &node.Pointer{
-		Clean: true,
-		Hash:  root.Hash,
-	}
-	return doVisit(ctx, ndb, root, visitor, ptr)
+	return VisitResumable(ctx, ndb, root, nil, visitor, 0, nil)
 }
 
-func doVisit(ctx context.Context, ndb NodeDB, root node.Root, visitor NodeVisitor, ptr *node.Pointer) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
+// VisitResumable traverses the tree in the same order as Visit, starting at the position given
+// by the token or at the root in case the token is nil.
+//
+// After every interval visited nodes, checkpoint is called with a token that can be persisted
+// and later used to resume the traversal, visiting each remaining node exactly once. Nodes
+// visited after the last checkpoint are visited again when resuming from it. A zero interval
+// disables checkpoints.
+func VisitResumable(
+	ctx context.Context,
+	ndb NodeDB,
+	root node.Root,
+	token *VisitToken,
+	visitor NodeVisitor,
+	interval uint64,
+	checkpoint VisitCheckpointFunc,
+) error {
+	var frontier []hash.Hash
+	switch token {
+	case nil:
+		if !root.Hash.IsEmpty() {
+			frontier = []hash.Hash{root.Hash}
+		}
 	default:
-	}
-
-	var (
-		nd  node.Node
-		err error
-	)
-	if ptr.Node == nil {
-		nd, err = ndb.GetNode(root, ptr)
-		if err != nil {
-			return err
+		if token.V != visitTokenVersion {
+			return fmt.Errorf("%w: unsupported version %d", ErrInvalidVisitToken, token.V)
 		}
-	} else {
-		nd = ptr.Node
+		if !token.Root.Equal(&root) {
+			return fmt.Errorf("%w: root mismatch", ErrInvalidVisitToken)
+		}
+		frontier = append([]hash.Hash{}, token.Frontier...)
 	}
 
-	if !visitor(ctx, nd) {
-		return nil
-	}
+	var visited uint64
+	for len(frontier) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
 
-	if n, ok := nd.(*node.InternalNode); ok {
-		if n.LeafNode != nil {
-			err = doVisit(ctx, ndb, root, visitor, n.LeafNode)
-			if err != nil {
+		if checkpoint != nil && interval > 0 && visited > 0 && visited%interval == 0 {
+			if err := checkpoint(ctx, &VisitToken{
+				Versioned: cbor.NewVersioned(visitTokenVersion),
+				Root:      root,
+				Frontier:  append([]hash.Hash{}, frontier...),
+			}); err != nil {
 				return err
 			}
 		}
-		if n.Left != nil {
-			err = doVisit(ctx, ndb, root, visitor, n.Left)
-			if err != nil {
-				return err
-			}
+
+		h := frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+		nd, err := ndb.GetNode(root, &node.Pointer{Clean: true, Hash: h})
+		if err != nil {
+			return err
 		}
-		if n.Right != nil {
-			err = doVisit(ctx, ndb, root, visitor, n.Right)
-			if err != nil {
-				return err
+		visited++
+
+		if !visitor(ctx, nd) {
+			continue
+		}
+
+		// Push children in reverse order so that the leaf is visited first, then the left and
+		// then the right subtree.
+		if n, ok := nd.(*node.InternalNode); ok {
+			for _, ptr := range []*node.Pointer{n.Right, n.Left, n.LeafNode} {
+				if ptr != nil && !ptr.Hash.IsEmpty() {
+					frontier = append(frontier, ptr.Hash)
+				}
 			}
 		}
 	}
-
 	return nil
 }
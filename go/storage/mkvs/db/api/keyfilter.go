@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+)
+
+const (
+	// keyFilterVersion is the version of the KeyFilter format. Filters using any other version
+	// are ignored.
+	keyFilterVersion = 1
+
+	// keyFilterBitsPerKey is the number of filter bits per key, resulting in a false positive
+	// rate of about 1% unless the filter size is bounded.
+	keyFilterBitsPerKey = 10
+	// maxKeyFilterHashes is the maximum number of hash functions used by a key filter.
+	maxKeyFilterHashes = 16
+)
+
+// KeyFilter is a bloom filter over the keys of a set of roots, which can be used to determine
+// that a key does not exist in any of the roots without traversing them.
+//
+// A negative answer is always correct, while a positive answer only means that the key may exist.
+type KeyFilter struct {
+	cbor.Versioned
+
+	// NumHashes is the number of bits set for each key.
+	NumHashes uint8 `json:"num_hashes"`
+	// Bits are the filter bits.
+	Bits []byte `json:"bits"`
+}
+
+// NewKeyFilter creates a new empty key filter sized for the given number of keys and bounded by
+// the given maximum size in bytes. Bounding the size increases the false positive rate.
+func NewKeyFilter(numKeys uint64, maxSize int64) *KeyFilter {
+	size := uint64(1)
+	if numKeys > 0 {
+		if numKeys > math.MaxUint64/keyFilterBitsPerKey {
+			numKeys = math.MaxUint64 / keyFilterBitsPerKey
+		}
+		size = (numKeys*keyFilterBitsPerKey + 7) / 8
+	}
+	if maxSize > 0 && size > uint64(maxSize) {
+		size = uint64(maxSize)
+	}
+	// Filter bits are addressed using 32-bit indices.
+	if size > math.MaxUint32/8 {
+		size = math.MaxUint32 / 8
+	}
+
+	// The optimal number of hash functions is ln(2) * bits per key.
+	numHashes := 1
+	if numKeys > 0 {
+		numHashes = int(math.Round(math.Ln2 * float64(size*8) / float64(numKeys)))
+	}
+	switch {
+	case numHashes < 1:
+		numHashes = 1
+	case numHashes > maxKeyFilterHashes:
+		numHashes = maxKeyFilterHashes
+	}
+
+	return &KeyFilter{
+		Versioned: cbor.NewVersioned(keyFilterVersion),
+		NumHashes: uint8(numHashes),
+		Bits:      make([]byte, size),
+	}
+}
+
+// DecodeKeyFilter decodes a serialized key filter.
+func DecodeKeyFilter(data []byte) (*KeyFilter, error) {
+	var f KeyFilter
+	if err := cbor.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("malformed key filter: %w", err)
+	}
+	if f.V != keyFilterVersion {
+		return nil, fmt.Errorf("unsupported key filter version %d", f.V)
+	}
+	if f.NumHashes == 0 || f.NumHashes > maxKeyFilterHashes {
+		return nil, fmt.Errorf("invalid number of key filter hashes (%d)", f.NumHashes)
+	}
+	if len(f.Bits) == 0 || uint64(len(f.Bits)) > math.MaxUint32/8 {
+		return nil, fmt.Errorf("invalid key filter size (%d)", len(f.Bits))
+	}
+	return &f, nil
+}
+
+// Add adds the given key to the filter.
+func (f *KeyFilter) Add(key []byte) {
+	f.forEachBit(key, func(idx uint32) bool {
+		f.Bits[idx/8] |= 1 << (idx % 8)
+		return true
+	})
+}
+
+// MayContain returns false in case the given key has definitely not been added to the filter.
+func (f *KeyFilter) MayContain(key []byte) bool {
+	contains := true
+	f.forEachBit(key, func(idx uint32) bool {
+		if f.Bits[idx/8]&(1<<(idx%8)) == 0 {
+			contains = false
+		}
+		return contains
+	})
+	return contains
+}
+
+// Size returns the size of the filter bits in bytes.
+func (f *KeyFilter) Size() int {
+	return len(f.Bits)
+}
+
+// forEachBit calls fn with the index of each filter bit of the given key until it returns false.
+func (f *KeyFilter) forEachBit(key []byte, fn func(idx uint32) bool) {
+	// Derive all bit indices from two hashes using double hashing.
+	h := hash.NewFromBytes(key)
+	h1 := binary.LittleEndian.Uint64(h[0:8])
+	h2 := binary.LittleEndian.Uint64(h[8:16]) | 1
+	numBits := uint64(len(f.Bits)) * 8
+	for i := uint64(0); i < uint64(f.NumHashes); i++ {
+		if !fn(uint32((h1 + i*h2) % numBits)) {
+			return
+		}
+	}
+}
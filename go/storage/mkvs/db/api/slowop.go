@@ -0,0 +1,51 @@
+package api
+
+import (
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// Operation is a node database operation which can be reported as slow.
+type Operation string
+
+const (
+	// OpGetNode is the GetNode operation.
+	OpGetNode Operation = "get_node"
+	// OpGetWriteLog is the GetWriteLog operation.
+	OpGetWriteLog Operation = "get_write_log"
+	// OpCommit is the batch Commit operation.
+	OpCommit Operation = "commit"
+	// OpFinalize is the Finalize (and FinalizeWithFilter) operation.
+	OpFinalize Operation = "finalize"
+	// OpPrune is the Prune (and PruneNodes, PruneWriteLogs) operation.
+	OpPrune Operation = "prune"
+)
+
+// SlowOpInfo describes a node database operation that exceeded its configured threshold.
+type SlowOpInfo struct {
+	// Op is the operation.
+	Op Operation
+	// Root is the root involved in the operation. For operations which only involve a version
+	// (e.g., finalization), only the namespace and version are set.
+	Root node.Root
+	// Duration is the duration of the operation.
+	Duration time.Duration
+	// Threshold is the configured threshold for the operation.
+	Threshold time.Duration
+	// KeysRead is the number of keys read from the backing store, if tracked by the operation.
+	KeysRead uint64
+	// KeysWritten is the number of keys written to the backing store, if tracked by the operation.
+	KeysWritten uint64
+	// Err is the error the operation failed with, if any.
+	Err error
+}
+
+// SlowOpHook is the interface implemented by embedders which want to be notified about slow node
+// database operations, e.g., in order to forward them to a tracing system.
+type SlowOpHook interface {
+	// SlowOperation is called after an operation exceeding its threshold completes.
+	//
+	// The hook is called synchronously from the operation and should not block.
+	SlowOperation(info *SlowOpInfo)
+}
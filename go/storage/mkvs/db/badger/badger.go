@@ -5,7 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
 
@@ -36,7 +38,8 @@ var (
 	// writeLogKeyFmt is the key format for write logs (version, new root,
 	// old root).
 	//
-	// Value is CBOR-serialized write log.
+	// Value is CBOR-serialized write log or empty in case the root has been committed without
+	// a write log.
 	writeLogKeyFmt = keyformat.New(0x01, uint64(0), &typedHash{}, &typedHash{})
 	// rootsMetadataKeyFmt is the key format for roots metadata. The key format is (version).
 	//
@@ -63,15 +66,83 @@ var (
 	//
 	// Value is empty.
 	rootNodeKeyFmt = keyformat.New(0x06, &typedHash{})
+	// detachedWriteLogKeyFmt is the key format for write logs that have been retained after the
+	// nodes of their version have been pruned (version, new root, old root).
+	//
+	// Value is CBOR-serialized write log or empty in case the write log is not available.
+	detachedWriteLogKeyFmt = keyformat.New(0x07, uint64(0), &typedHash{}, &typedHash{})
+	// finalizeJournalKeyFmt is the key format for the pending finalization journal entry. It is
+	// written before finalization starts removing anything and removed once it completes.
+	//
+	// Value is CBOR-serialized finalizeJournal.
+	finalizeJournalKeyFmt = keyformat.New(0x08)
+	// shardedNodeKeyFmt is the key format for nodes when node keys are sharded (shard, node hash).
+	// The shard is derived from the first byte of the node hash.
+	//
+	// Value is serialized node.
+	shardedNodeKeyFmt = keyformat.New(0x09, uint8(0), &hash.Hash{})
+	// pendingCommitKeyFmt is the key format for pending commit markers (version, root). A marker
+	// is written when the metadata updates of a commit need to be split across multiple
+	// transactions and is removed by the final transaction.
+	//
+	// Value is empty.
+	pendingCommitKeyFmt = keyformat.New(0x0A, uint64(0), &typedHash{})
+	// versionStorageKeyFmt is the key format for the storage used by nodes and write logs written
+	// in a given version (version).
+	//
+	// Value is CBOR-serialized versionStorage.
+	versionStorageKeyFmt = keyformat.New(0x0B, uint64(0))
+	// keyFilterKeyFmt is the key format for the key filter over all finalized roots of a given
+	// version (version).
+	//
+	// Value is CBOR-serialized api.KeyFilter.
+	keyFilterKeyFmt = keyformat.New(0x0C, uint64(0))
+	// flushedNodeKeyFmt is the key format for nodes flushed by batches before they have been
+	// committed (version, node hash). Nodes that are not referenced by any finalized root are
+	// removed when the version is finalized, which takes care of nodes of discarded batches.
+	//
+	// Value is empty.
+	flushedNodeKeyFmt = keyformat.New(0x0D, uint64(0), &hash.Hash{})
+)
+
+// finalizeStep is a step of the finalization process.
+type finalizeStep int
+
+const (
+	// finalizeStepJournal is the step where the finalization journal entry has been written.
+	finalizeStepJournal finalizeStep = iota
+	// finalizeStepNodes is the step where the nodes of discarded roots have been removed.
+	finalizeStepNodes
+	// finalizeStepMetadata is the step where the metadata has been updated.
+	finalizeStepMetadata
 )
 
 // New creates a new BadgerDB-backed node database.
 func New(cfg *api.Config) (api.NodeDB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("mkvs/badger: invalid configuration: %w", err)
+	}
+
 	db := &badgerNodeDB{
-		logger:           logging.GetLogger("mkvs/db/badger"),
-		namespace:        cfg.Namespace,
-		readOnly:         cfg.ReadOnly,
-		discardWriteLogs: cfg.DiscardWriteLogs,
+		logger:              logging.GetLogger("mkvs/db/badger"),
+		namespace:           cfg.Namespace,
+		hashMode:            cfg.HashMode,
+		readOnly:            cfg.ReadOnly,
+		discardWriteLogs:    cfg.DiscardWriteLogs,
+		batchFlushThreshold: cfg.BatchFlushThreshold,
+		maxTransactionSize:  cfg.MaxTransactionSize,
+		verifyNodeHashes:    cfg.VerifyNodeHashes,
+		verifySampleRate:    cfg.VerifyNodeHashesSampleRate,
+		slowOpThresholds:    cfg.SlowOpThresholds,
+		slowOpHook:          cfg.SlowOpHook,
+		keyFilterMaxSize:    cfg.KeyFilterMaxSize,
+		storageTracker:      newStorageTracker(),
+	}
+	if cfg.NodeKeyShards > 1 {
+		db.nodeKeyShards = uint16(cfg.NodeKeyShards)
+	}
+	if cfg.MetadataSnapshot {
+		db.metadataSnapshotPath = MetadataSnapshotPath(cfg.DB)
 	}
 	opts := commonConfigToBadgerOptions(cfg, db)
 
@@ -89,13 +160,42 @@ func New(cfg *api.Config) (api.NodeDB, error) {
 		return nil, fmt.Errorf("mkvs/badger: failed to load metadata: %w", err)
 	}
 
+	// Complete any finalization interrupted by an unclean shutdown.
+	if !db.readOnly {
+		if err = db.resumeFinalizeLocked(); err != nil {
+			_ = db.db.Close()
+			return nil, fmt.Errorf("mkvs/badger: failed to resume interrupted finalization: %w", err)
+		}
+	}
+
+	// Make sure that the database is consistent and recover from any unclean shutdowns.
+	if err = db.openCheck(cfg.StrictOpen); err != nil {
+		_ = db.db.Close()
+		return nil, fmt.Errorf("mkvs/badger: startup consistency check failed: %w", err)
+	}
+
 	// Cleanup any multipart restore remnants, since they can't be used anymore.
 	if err = db.cleanMultipartLocked(true); err != nil {
 		_ = db.db.Close()
 		return nil, fmt.Errorf("mkvs/badger: failed to clean leftovers from multipart restore: %w", err)
 	}
 
+	// Start tracking storage in case the database does not track it yet.
+	if !db.readOnly {
+		if err = db.deriveStorage(); err != nil {
+			_ = db.db.Close()
+			return nil, err
+		}
+	}
+
 	db.gc = cmnBadger.NewGCWorker(db.logger, db.db)
+	if db.keyFilterMaxSize > 0 && !db.readOnly {
+		db.keyFilters = newKeyFilterWorker(db)
+	}
+
+	initMetrics()
+	db.updateNonFinalizedMetrics()
+	db.updateStorageMetrics()
 
 	return db, nil
 }
@@ -104,20 +204,55 @@ type badgerNodeDB struct { // nolint: maligned
 	logger *logging.Logger
 
 	namespace common.Namespace
+	hashMode  node.HashMode
+
+	readOnly            bool
+	discardWriteLogs    bool
+	batchFlushThreshold int64
+	maxTransactionSize  int64
+	nodeKeyShards       uint16
+	verifyNodeHashes    bool
+	verifySampleRate    uint32
+	keyFilterMaxSize    int64
 
-	readOnly         bool
-	discardWriteLogs bool
+	slowOpThresholds map[api.Operation]time.Duration
+	slowOpHook       api.SlowOpHook
+
+	// metadataSnapshotPath is the path of the metadata snapshot file, or empty in case metadata
+	// snapshots are disabled.
+	metadataSnapshotPath string
 
 	multipartVersion uint64
 
 	db *badger.DB
 	gc *cmnBadger.GCWorker
+	// keyFilters builds key filters of finalized versions, in case key filters are enabled.
+	keyFilters *keyFilterWorker
 
+	// commitLock is held for reading by batch commits and for writing by operations which change
+	// the set of versions or roots that batches may be committed against (e.g., finalization and
+	// pruning). This allows batches to be committed concurrently.
+	//
+	// When both locks are needed, commitLock must be acquired before metaUpdateLock.
+	commitLock sync.RWMutex
 	// metaUpdateLock must be held at any point where data at tsMetadata is read and updated. This
 	// is required because all metadata updates happen at the same timestamp and as such conflicts
 	// cannot be detected.
 	metaUpdateLock sync.Mutex
 	meta           metadata
+	// storageTracker reconciles the storage accounted for by batches written concurrently.
+	storageTracker *storageTracker
+
+	// finalizeHook is invoked after each finalization step in case it is set. Returning an error
+	// aborts finalization, which is used in tests to simulate crashes.
+	finalizeHook func(step finalizeStep) error
+	// commitSplitHook is invoked after each intermediate transaction of split commit metadata
+	// updates in case it is set. Returning an error aborts the commit, which is used in tests to
+	// simulate crashes.
+	commitSplitHook func() error
+	// slowOpDelayHook is invoked before tracked operations complete in case it is set, which is
+	// used in tests to inject latency.
+	slowOpDelayHook func(op api.Operation)
 
 	closeOnce sync.Once
 }
@@ -157,6 +292,22 @@ func (d *badgerNodeDB) load() error {
 				d.meta.value.Namespace,
 			)
 		}
+		if d.meta.value.HashMode != d.hashMode {
+			return fmt.Errorf("%w: incompatible hash mode (expected: %s got: %s)",
+				api.ErrHashModeMismatch,
+				d.hashMode,
+				d.meta.value.HashMode,
+			)
+		}
+		if d.meta.value.NodeKeyShards != d.nodeKeyShards {
+			return fmt.Errorf("incompatible number of node key shards (expected: %d got: %d)",
+				d.nodeKeyShards,
+				d.meta.value.NodeKeyShards,
+			)
+		}
+		if d.meta.value.NonFinalizedRoots == nil {
+			return d.deriveNonFinalizedRoots(tx)
+		}
 		return nil
 	case badger.ErrKeyNotFound:
 	default:
@@ -166,6 +317,9 @@ func (d *badgerNodeDB) load() error {
 	// No metadata exists, create some.
 	d.meta.value.Version = dbVersion
 	d.meta.value.Namespace = d.namespace
+	d.meta.value.NodeKeyShards = d.nodeKeyShards
+	d.meta.value.HashMode = d.hashMode
+	d.meta.value.Storage = &storageTotals{}
 	if err = d.meta.save(tx); err != nil {
 		return err
 	}
@@ -173,6 +327,46 @@ func (d *badgerNodeDB) load() error {
 	return tx.CommitAt(tsMetadata, nil)
 }
 
+// deriveNonFinalizedRoots derives the number of committed roots in each non-finalized version
+// from the roots metadata. This is only needed in case the metadata does not track them yet.
+func (d *badgerNodeDB) deriveNonFinalizedRoots(tx *badger.Txn) error {
+	var firstUnfinalized uint64
+	if lastFinalizedVersion, finalized := d.meta.getLastFinalizedVersion(); finalized {
+		firstUnfinalized = lastFinalizedVersion + 1
+	}
+
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: rootsMetadataKeyFmt.Encode()})
+	defer it.Close()
+
+	nonFinalizedRoots := make(map[uint64]uint64)
+	for it.Seek(rootsMetadataKeyFmt.Encode(firstUnfinalized)); it.Valid(); it.Next() {
+		var version uint64
+		if !rootsMetadataKeyFmt.Decode(it.Item().Key(), &version) {
+			return fmt.Errorf("undecodable roots metadata key (%v)", it.Item().Key())
+		}
+
+		rootsMeta := &rootsMetadata{version: version}
+		if err := it.Item().Value(func(val []byte) error {
+			return cbor.UnmarshalTrusted(val, &rootsMeta)
+		}); err != nil {
+			return fmt.Errorf("error reading roots metadata for version %d: %w", version, err)
+		}
+		if len(rootsMeta.Roots) > 0 {
+			nonFinalizedRoots[version] = uint64(len(rootsMeta.Roots))
+		}
+	}
+	d.meta.value.NonFinalizedRoots = nonFinalizedRoots
+	return nil
+}
+
+// nodeKey returns the key under which the node with the given hash is stored.
+func (d *badgerNodeDB) nodeKey(h *hash.Hash) []byte {
+	if d.nodeKeyShards == 0 {
+		return nodeKeyFmt.Encode(h)
+	}
+	return shardedNodeKeyFmt.Encode(uint8(uint16(h[0])%d.nodeKeyShards), h)
+}
+
 func (d *badgerNodeDB) sanityCheckNamespace(ns common.Namespace) error {
 	if !ns.Equal(&d.namespace) {
 		return api.ErrBadNamespace
@@ -180,12 +374,25 @@ func (d *badgerNodeDB) sanityCheckNamespace(ns common.Namespace) error {
 	return nil
 }
 
+// sanityCheckRoot checks that the given root can be stored in the database.
+func (d *badgerNodeDB) sanityCheckRoot(root node.Root) error {
+	if err := d.sanityCheckNamespace(root.Namespace); err != nil {
+		return err
+	}
+	if root.HashMode != d.hashMode {
+		return fmt.Errorf("%w: root uses %s hash mode, database uses %s hash mode",
+			api.ErrHashModeMismatch, root.HashMode, d.hashMode,
+		)
+	}
+	return nil
+}
+
 func (d *badgerNodeDB) checkRoot(txn *badger.Txn, root node.Root) error {
 	rootHash := typedHashFromRoot(root)
 	if _, err := txn.Get(rootNodeKeyFmt.Encode(&rootHash)); err != nil {
 		switch err {
 		case badger.ErrKeyNotFound:
-			return api.ErrRootNotFound
+			return d.checkRootType(txn, root)
 		default:
 			d.logger.Error("failed to check root existence",
 				"err", err,
@@ -196,7 +403,47 @@ func (d *badgerNodeDB) checkRoot(txn *badger.Txn, root node.Root) error {
 	return nil
 }
 
+// checkRootType returns a *api.RootTypeMismatchError in case the given (missing) root is stored
+// under a different root type and api.ErrRootNotFound otherwise.
+func (d *badgerNodeDB) checkRootType(txn *badger.Txn, root node.Root) error {
+	for typ := node.RootTypeInvalid + 1; typ <= node.RootTypeMax; typ++ {
+		if typ == root.Type {
+			continue
+		}
+
+		rootHash := typedHashFromParts(typ, root.Hash)
+		switch _, err := txn.Get(rootNodeKeyFmt.Encode(&rootHash)); err {
+		case nil:
+			return &api.RootTypeMismatchError{Root: root, StoredType: typ}
+		case badger.ErrKeyNotFound:
+		default:
+			return fmt.Errorf("mkvs/badger: failed to check root type: %w", err)
+		}
+	}
+	return api.ErrRootNotFound
+}
+
 // Assumes metaUpdateLock is held when called.
+// deleteWithPrefixStorage deletes all node or write log keys with the given prefix visible at the
+// given version and records their removal.
+func (d *badgerNodeDB) deleteWithPrefixStorage(batch *badger.WriteBatch, storage *storageDelta, version uint64, prefix []byte) error {
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := storage.remove(version, it.Item().Key()); err != nil {
+			return err
+		}
+		if err := batch.Delete(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *badgerNodeDB) cleanMultipartLocked(removeNodes bool) error {
 	var version uint64
 
@@ -220,6 +467,7 @@ func (d *badgerNodeDB) cleanMultipartLocked(removeNodes bool) error {
 
 	batch := d.db.NewWriteBatchAt(versionToTs(version))
 	defer batch.Cancel()
+	storage := newStorageDelta(d.db)
 
 	var logged bool
 	for it.Rewind(); it.Valid(); it.Next() {
@@ -236,7 +484,10 @@ func (d *badgerNodeDB) cleanMultipartLocked(removeNodes bool) error {
 			switch hash.Type() {
 			case node.RootTypeInvalid:
 				h := hash.Hash()
-				if err := batch.Delete(nodeKeyFmt.Encode(&h)); err != nil {
+				if err := storage.remove(version, d.nodeKey(&h)); err != nil {
+					return err
+				}
+				if err := batch.Delete(d.nodeKey(&h)); err != nil {
 					return err
 				}
 			default:
@@ -261,19 +512,38 @@ func (d *badgerNodeDB) cleanMultipartLocked(removeNodes bool) error {
 	if err := d.meta.setMultipartVersion(metaTx, 0); err != nil {
 		return err
 	}
+	if err := d.meta.applyStorage(metaTx, storage); err != nil {
+		return err
+	}
 	if err := metaTx.CommitAt(tsMetadata, nil); err != nil {
 		return err
 	}
+	d.updateStorageMetrics()
 
 	d.multipartVersion = multipartVersionNone
 	return nil
 }
 
-func (d *badgerNodeDB) GetNode(root node.Root, ptr *node.Pointer) (node.Node, error) {
+// shouldVerifyNodeHash returns true iff the hash of the node being read should be verified.
+func (d *badgerNodeDB) shouldVerifyNodeHash() bool {
+	switch {
+	case !d.verifyNodeHashes:
+		return false
+	case d.verifySampleRate <= 1:
+		return true
+	default:
+		return rand.Int63n(int64(d.verifySampleRate)) == 0
+	}
+}
+
+func (d *badgerNodeDB) GetNode(root node.Root, ptr *node.Pointer) (_ node.Node, err error) {
 	if ptr == nil || !ptr.IsClean() {
 		panic("mkvs/badger: attempted to get invalid pointer from node database")
 	}
-	if err := d.sanityCheckNamespace(root.Namespace); err != nil {
+	op := d.startOp(api.OpGetNode, root)
+	defer func() { op.finish(err) }()
+
+	if err := d.sanityCheckRoot(root); err != nil {
 		return nil, err
 	}
 	// If the version is earlier than the earliest version, we don't have the node (it was pruned).
@@ -290,7 +560,9 @@ func (d *badgerNodeDB) GetNode(root node.Root, ptr *node.Pointer) (node.Node, er
 		return nil, err
 	}
 
-	item, err := tx.Get(nodeKeyFmt.Encode(&ptr.Hash))
+	key := d.nodeKey(&ptr.Hash)
+	item, err := tx.Get(key)
+	op.read(1)
 	switch err {
 	case nil:
 	case badger.ErrKeyNotFound:
@@ -305,7 +577,7 @@ func (d *badgerNodeDB) GetNode(root node.Root, ptr *node.Pointer) (node.Node, er
 	var n node.Node
 	if err = item.Value(func(val []byte) error {
 		var vErr error
-		n, vErr = node.UnmarshalBinary(val)
+		n, vErr = node.UnmarshalVersionedBinary(val)
 		return vErr
 	}); err != nil {
 		d.logger.Error("failed to unmarshal node",
@@ -314,23 +586,56 @@ func (d *badgerNodeDB) GetNode(root node.Root, ptr *node.Pointer) (node.Node, er
 		return nil, fmt.Errorf("mkvs/badger: failed to unmarshal node: %w", err)
 	}
 
+	if d.hashMode != node.HashModeDefault {
+		// Decoding computes the node hash in the default hash domain.
+		node.UpdateDecodedHash(n, root.HashDomain())
+	}
+
+	if d.shouldVerifyNodeHash() {
+		// Decoding always recomputes the node hash from the node content.
+		if computed := n.GetHash(); !computed.Equal(&ptr.Hash) {
+			err = &api.CorruptedNodeError{
+				Hash:         ptr.Hash,
+				Key:          key,
+				ComputedHash: computed,
+			}
+			d.logger.Error("detected corrupted node",
+				"err", err,
+			)
+			d.recordCorruptedNode()
+			return nil, err
+		}
+	}
+
 	return n, nil
 }
 
-func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.Root) (writelog.Iterator, error) {
+func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.Root) (_ writelog.Iterator, err error) {
+	// Only the lookup of the write log is tracked, as the returned iterator is consumed by the
+	// caller afterwards.
+	op := d.startOp(api.OpGetWriteLog, endRoot)
+	defer func() { op.finish(err) }()
+
 	if d.discardWriteLogs {
 		return nil, api.ErrWriteLogNotFound
 	}
 	if !endRoot.Follows(&startRoot) {
 		return nil, api.ErrRootMustFollowOld
 	}
-	if err := d.sanityCheckNamespace(startRoot.Namespace); err != nil {
+	if err := d.sanityCheckRoot(startRoot); err != nil {
 		return nil, err
 	}
-	// If the version is earlier than the earliest version, we don't have the roots.
-	if endRoot.Version < d.meta.getEarliestVersion() {
+	// If the version is earlier than the earliest write log version, we don't have the write logs.
+	if endRoot.Version < d.meta.getEarliestWriteLogVersion() {
 		return nil, api.ErrWriteLogNotFound
 	}
+	// If the version is earlier than the earliest version, the nodes have been pruned and only
+	// detached write logs are available.
+	detached := endRoot.Version < d.meta.getEarliestVersion()
+	logKeyFmt := writeLogKeyFmt
+	if detached {
+		logKeyFmt = detachedWriteLogKeyFmt
+	}
 
 	tx := d.db.NewTransactionAt(versionToTs(endRoot.Version), false)
 	discardTx := true
@@ -341,8 +646,16 @@ func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.
 	}()
 
 	// Check if the root actually exists.
-	if err := d.checkRoot(tx, endRoot); err != nil {
-		return nil, err
+	if !detached {
+		if err := d.checkRoot(tx, endRoot); err != nil {
+			return nil, err
+		}
+	}
+
+	// The write log between empty roots is always empty. As nothing is stored for such write
+	// logs when committing an empty tree, handle them explicitly.
+	if startRoot.Hash.IsEmpty() && endRoot.Hash.IsEmpty() {
+		return writelog.NewStaticIterator(nil), nil
 	}
 
 	// Start at the end root and search towards the start root. This assumes that the
@@ -376,7 +689,7 @@ func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.
 
 		wl, err := func() (writelog.Iterator, error) {
 			// Iterate over all write logs that result in the current item.
-			prefix := writeLogKeyFmt.Encode(endRoot.Version, &curItem.endRootHash)
+			prefix := logKeyFmt.Encode(endRoot.Version, &curItem.endRootHash)
 			it := tx.NewIterator(badger.IteratorOptions{Prefix: prefix})
 			defer it.Close()
 
@@ -386,12 +699,13 @@ func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.
 				}
 
 				item := it.Item()
+				op.read(1)
 
 				var decVersion uint64
 				var decEndRootHash typedHash
 				var decStartRootHash typedHash
 
-				if !writeLogKeyFmt.Decode(item.Key(), &decVersion, &decEndRootHash, &decStartRootHash) {
+				if !logKeyFmt.Decode(item.Key(), &decVersion, &decEndRootHash, &decStartRootHash) {
 					// This should not happen as the Badger iterator should take care of it.
 					panic("mkvs/badger: bad iterator")
 				}
@@ -404,8 +718,18 @@ func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.
 					logKeys:  append(curItem.logKeys, item.KeyCopy(nil)),
 					logRoots: append(curItem.logRoots, curItem.endRootHash),
 				}
+				if nextItem.endRootHash.Equal(&startRootHash) && detached {
+					// Path has been found, detached write logs are self-contained.
+					return d.getDetachedWriteLogs(tx, nextItem.logKeys)
+				}
 				if nextItem.endRootHash.Equal(&startRootHash) {
-					// Path has been found, deserialize and stream write logs.
+					// Path has been found, make sure that all write logs on it have been stored
+					// before streaming them as they are only deserialized lazily.
+					if err := checkWriteLogsAvailable(tx, nextItem.logKeys); err != nil {
+						return nil, err
+					}
+
+					// Deserialize and stream write logs.
 					var index int
 					discardTx = false
 					// Close iterator now as ReviveHashedDBWriteLogs can close the txn immediately.
@@ -419,6 +743,7 @@ func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.
 							key := nextItem.logKeys[index]
 							root := node.Root{
 								Namespace: endRoot.Namespace,
+								HashMode:  endRoot.HashMode,
 								Version:   endRoot.Version,
 								Type:      nextItem.logRoots[index].Type(),
 								Hash:      nextItem.logRoots[index].Hash(),
@@ -468,6 +793,44 @@ func (d *badgerNodeDB) GetWriteLog(ctx context.Context, startRoot, endRoot node.
 	return nil, api.ErrWriteLogNotFound
 }
 
+// checkWriteLogsAvailable returns ErrWriteLogNotAvailable in case any of the write logs stored
+// under the given keys is the marker of a root committed without a write log.
+func checkWriteLogsAvailable(tx *badger.Txn, logKeys [][]byte) error {
+	for _, key := range logKeys {
+		item, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		// Empty values are always stored inline, so this does not need to fetch the value.
+		if item.ValueSize() == 0 {
+			return api.ErrWriteLogNotAvailable
+		}
+	}
+	return nil
+}
+
+func (d *badgerNodeDB) getDetachedWriteLogs(tx *badger.Txn, logKeys [][]byte) (writelog.Iterator, error) {
+	var wl writelog.WriteLog
+	for _, key := range logKeys {
+		item, err := tx.Get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		var log writelog.WriteLog
+		if err = item.Value(func(data []byte) error {
+			if len(data) == 0 {
+				return api.ErrWriteLogNotAvailable
+			}
+			return cbor.UnmarshalTrusted(data, &log)
+		}); err != nil {
+			return nil, err
+		}
+		wl = append(wl, log...)
+	}
+	return writelog.NewStaticIterator(wl), nil
+}
+
 func (d *badgerNodeDB) GetLatestVersion(ctx context.Context) (uint64, error) {
 	version, _ := d.meta.getLastFinalizedVersion()
 	return version, nil
@@ -477,6 +840,10 @@ func (d *badgerNodeDB) GetEarliestVersion(ctx context.Context) (uint64, error) {
 	return d.meta.getEarliestVersion(), nil
 }
 
+func (d *badgerNodeDB) GetEarliestWriteLogVersion(ctx context.Context) (uint64, error) {
+	return d.meta.getEarliestWriteLogVersion(), nil
+}
+
 func (d *badgerNodeDB) GetRootsForVersion(ctx context.Context, version uint64) (roots []node.Root, err error) {
 	// If the version is earlier than the earliest version, we don't have the roots.
 	if version < d.meta.getEarliestVersion() {
@@ -494,6 +861,7 @@ func (d *badgerNodeDB) GetRootsForVersion(ctx context.Context, version uint64) (
 	for rootHash := range rootsMeta.Roots {
 		roots = append(roots, node.Root{
 			Namespace: d.namespace,
+			HashMode:  d.hashMode,
 			Version:   version,
 			Type:      rootHash.Type(),
 			Hash:      rootHash.Hash(),
@@ -502,8 +870,12 @@ func (d *badgerNodeDB) GetRootsForVersion(ctx context.Context, version uint64) (
 	return
 }
 
+func (d *badgerNodeDB) NonFinalizedVersions(ctx context.Context) ([]api.NonFinalizedVersion, error) {
+	return d.meta.getNonFinalizedVersions(), nil
+}
+
 func (d *badgerNodeDB) HasRoot(root node.Root) bool {
-	if err := d.sanityCheckNamespace(root.Namespace); err != nil {
+	if err := d.sanityCheckRoot(root); err != nil {
 		return false
 	}
 
@@ -529,7 +901,7 @@ func (d *badgerNodeDB) HasRoot(root node.Root) bool {
 	return exists
 }
 
-func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error { // nolint: gocyclo
+func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 	if d.readOnly {
 		return api.ErrReadOnly
 	}
@@ -539,6 +911,71 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 	}
 	version := roots[0].Version
 
+	err := d.finalize(ctx, version, func(rootsMeta *rootsMetadata) (map[typedHash]bool, error) {
+		finalizedRoots := make(map[typedHash]bool)
+		for _, root := range roots {
+			if root.Version != version {
+				return nil, fmt.Errorf("mkvs/badger: roots to finalize don't have matching versions")
+			}
+			rootHash := typedHashFromRoot(root)
+			if _, ok := rootsMeta.Roots[rootHash]; !ok {
+				if typ, ok := rootsMeta.storedType(rootHash); ok {
+					return nil, &api.RootTypeMismatchError{Root: root, StoredType: typ}
+				}
+			}
+			finalizedRoots[rootHash] = true
+		}
+		return finalizedRoots, nil
+	})
+	if err != nil {
+		return err
+	}
+	d.maybeBuildKeyFilter(version)
+	return nil
+}
+
+func (d *badgerNodeDB) FinalizeWithFilter(ctx context.Context, version uint64, keep func(root node.Root) bool) error {
+	if d.readOnly {
+		return api.ErrReadOnly
+	}
+
+	err := d.finalize(ctx, version, func(rootsMeta *rootsMetadata) (map[typedHash]bool, error) {
+		finalizedRoots := make(map[typedHash]bool)
+		for rootHash := range rootsMeta.Roots {
+			root := node.Root{
+				Namespace: d.namespace,
+				HashMode:  d.hashMode,
+				Version:   version,
+				Type:      rootHash.Type(),
+				Hash:      rootHash.Hash(),
+			}
+			if keep(root) {
+				finalizedRoots[rootHash] = true
+			}
+		}
+		return finalizedRoots, nil
+	})
+	if err != nil {
+		return err
+	}
+	d.maybeBuildKeyFilter(version)
+	return nil
+}
+
+// finalize finalizes the given version, keeping the roots (and all roots they were derived from)
+// returned by selectRoots and discarding all other roots.
+//
+// Finalizing an already finalized version with the same set of roots is a no-op.
+func (d *badgerNodeDB) finalize(
+	ctx context.Context,
+	version uint64,
+	selectRoots func(rootsMeta *rootsMetadata) (map[typedHash]bool, error),
+) (err error) {
+	op := d.startVersionOp(api.OpFinalize, version)
+	defer func() { op.finish(err) }()
+
+	d.commitLock.Lock()
+	defer d.commitLock.Unlock()
 	d.metaUpdateLock.Lock()
 	defer d.metaUpdateLock.Unlock()
 
@@ -546,39 +983,88 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 		return api.ErrInvalidMultipartVersion
 	}
 
-	// Version batch collects removals at the version timestamp.
-	versionBatch := d.db.NewWriteBatchAt(versionToTs(version))
-	defer versionBatch.Cancel()
-	// Transaction is used to read at the version timestamp.
-	tx := d.db.NewTransactionAt(versionToTs(version), true)
-	defer tx.Discard()
+	// Complete any previously interrupted finalization first.
+	if err := d.resumeFinalizeLocked(); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to resume interrupted finalization: %w", err)
+	}
 
 	// Make sure that the previous version has been finalized (if we are not restoring).
 	lastFinalizedVersion, exists := d.meta.getLastFinalizedVersion()
 	if d.multipartVersion == multipartVersionNone && version > 0 && exists && lastFinalizedVersion < (version-1) {
 		return api.ErrNotFinalized
 	}
-	// Make sure that this version has not yet been finalized.
-	if exists && version <= lastFinalizedVersion {
-		return api.ErrAlreadyFinalized
+
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+
+	rootsMeta, err := loadRootsMetadata(tx, version)
+	if err != nil {
+		return err
 	}
 
-	// Determine the set of finalized roots. Finalization is transitive, so if
-	// a parent root is finalized the child should be considered finalized too.
-	finalizedRoots := make(map[typedHash]bool)
-	for _, root := range roots {
-		if root.Version != version {
-			return fmt.Errorf("mkvs/badger: roots to finalize don't have matching versions")
+	// In case this version has already been finalized, only succeed if it was finalized with the
+	// same set of roots.
+	if exists && version <= lastFinalizedVersion {
+		if version < d.meta.getEarliestVersion() {
+			return api.ErrAlreadyFinalized
+		}
+		finalizedRoots, err := computeFinalizedRoots(rootsMeta, selectRoots)
+		switch err {
+		case nil:
+		case api.ErrRootNotFound:
+			// Roots not among the stored roots must have been discarded.
+			return api.ErrAlreadyFinalized
+		default:
+			return err
 		}
-		finalizedRoots[typedHashFromRoot(root)] = true
+		for rootHash := range rootsMeta.Roots {
+			if !finalizedRoots[rootHash] {
+				return api.ErrAlreadyFinalized
+			}
+		}
+		return nil
 	}
 
-	var rootsChanged bool
-	rootsMeta, err := loadRootsMetadata(tx, version)
+	finalizedRoots, err := computeFinalizedRoots(rootsMeta, selectRoots)
 	if err != nil {
 		return err
 	}
 
+	// Record the finalized roots before removing anything, so that finalization can be completed
+	// in case it is interrupted.
+	fj := newFinalizeJournal(version, finalizedRoots)
+	metaTx := d.db.NewTransactionAt(tsMetadata, true)
+	defer metaTx.Discard()
+	if err = fj.save(metaTx); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to save finalization journal: %w", err)
+	}
+	if err = metaTx.CommitAt(tsMetadata, nil); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to commit finalization journal: %w", err)
+	}
+	if err = d.runFinalizeHook(finalizeStepJournal); err != nil {
+		return err
+	}
+
+	if err = d.finalizeJournaledLocked(fj); err != nil {
+		return err
+	}
+	d.updateMetadataSnapshotLocked()
+	return nil
+}
+
+// computeFinalizedRoots determines the set of finalized roots, which includes the roots returned by
+// selectRoots and all roots they were derived from.
+func computeFinalizedRoots(
+	rootsMeta *rootsMetadata,
+	selectRoots func(rootsMeta *rootsMetadata) (map[typedHash]bool, error),
+) (map[typedHash]bool, error) {
+	finalizedRoots, err := selectRoots(rootsMeta)
+	if err != nil {
+		return nil, err
+	}
+
+	// Finalization is transitive, so if a parent root is finalized the child should be considered
+	// finalized too.
 	for updated := true; updated; {
 		updated = false
 
@@ -600,13 +1086,70 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 	for iroot := range finalizedRoots {
 		h := iroot.Hash()
 		if _, ok := rootsMeta.Roots[iroot]; !ok && !h.IsEmpty() {
-			return api.ErrRootNotFound
+			return nil, api.ErrRootNotFound
+		}
+	}
+	return finalizedRoots, nil
+}
+
+// resumeFinalizeLocked completes the finalization recorded in the finalization journal, if any.
+//
+// Assumes metaUpdateLock is held when called.
+func (d *badgerNodeDB) resumeFinalizeLocked() error {
+	tx := d.db.NewTransactionAt(tsMetadata, false)
+	defer tx.Discard()
+
+	fj, err := loadFinalizeJournal(tx)
+	if err != nil {
+		return err
+	}
+	if fj == nil {
+		return nil
+	}
+
+	if lastFinalizedVersion, exists := d.meta.getLastFinalizedVersion(); exists && fj.Version <= lastFinalizedVersion {
+		// The journal entry is removed together with the metadata update, so this should never
+		// happen, but make sure not to get stuck in case it does.
+		metaTx := d.db.NewTransactionAt(tsMetadata, true)
+		defer metaTx.Discard()
+		if err = fj.remove(metaTx); err != nil {
+			return err
 		}
+		return metaTx.CommitAt(tsMetadata, nil)
+	}
+
+	d.logger.Warn("resuming interrupted finalization",
+		"version", fj.Version,
+		"num_roots", len(fj.Roots),
+	)
+	return d.finalizeJournaledLocked(fj)
+}
+
+// finalizeJournaledLocked performs finalization as recorded in the given journal entry. All steps
+// are idempotent so finalization can be resumed from the journal entry after an interruption.
+//
+// Assumes metaUpdateLock is held when called.
+func (d *badgerNodeDB) finalizeJournaledLocked(fj *finalizeJournal) error { // nolint: gocyclo
+	version := fj.Version
+	finalizedRoots := fj.finalizedRoots()
+
+	// Version batch collects removals at the version timestamp.
+	versionBatch := d.db.NewWriteBatchAt(versionToTs(version))
+	defer versionBatch.Cancel()
+	// Transaction is used to read at the version timestamp.
+	tx := d.db.NewTransactionAt(versionToTs(version), true)
+	defer tx.Discard()
+
+	var rootsChanged bool
+	rootsMeta, err := loadRootsMetadata(tx, version)
+	if err != nil {
+		return err
 	}
 
 	// Go through all roots and prune them based on whether they are finalized or not.
 	maybeLoneNodes := make(map[hash.Hash]bool)
 	notLoneNodes := make(map[hash.Hash]bool)
+	storage := newStorageDelta(d.db)
 
 	for rootHash := range rootsMeta.Roots {
 		// TODO: Consider colocating updated nodes with the root metadata.
@@ -657,6 +1200,9 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 					defer wit.Close()
 
 					for wit.Rewind(); wit.Valid(); wit.Next() {
+						if err = storage.remove(version, wit.Item().Key()); err != nil {
+							return err
+						}
 						if err = versionBatch.Delete(wit.Item().KeyCopy(nil)); err != nil {
 							return err
 						}
@@ -680,16 +1226,56 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 			continue
 		}
 
-		key := nodeKeyFmt.Encode(&h)
+		key := d.nodeKey(&h)
+		if err := storage.remove(version, key); err != nil {
+			return err
+		}
 		if err := versionBatch.Delete(key); err != nil {
 			return err
 		}
 	}
 
+	// Clean any nodes flushed by batches which have not been committed. The storage of these
+	// nodes has never been accounted for, unless they are also part of a committed root.
+	flushedBatch := d.db.NewWriteBatchAt(tsMetadata)
+	defer flushedBatch.Cancel()
+	if err = func() error {
+		it := tx.NewIterator(badger.IteratorOptions{Prefix: flushedNodeKeyFmt.Encode(version)})
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var (
+				decVersion uint64
+				h          hash.Hash
+			)
+			if !flushedNodeKeyFmt.Decode(it.Item().Key(), &decVersion, &h) {
+				panic("mkvs/badger: bad iterator")
+			}
+			if err = flushedBatch.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+			if notLoneNodes[h] || maybeLoneNodes[h] {
+				continue
+			}
+			if err = versionBatch.Delete(d.nodeKey(&h)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}(); err != nil {
+		return err
+	}
+
 	// Commit batch.
 	if err := versionBatch.Flush(); err != nil {
 		return err
 	}
+	if err := flushedBatch.Flush(); err != nil {
+		return err
+	}
+	if err := d.runFinalizeHook(finalizeStepNodes); err != nil {
+		return err
+	}
 
 	// Save roots metadata if changed.
 	if rootsChanged {
@@ -698,17 +1284,30 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 		}
 	}
 
-	// Update last finalized version.
-	if err := d.meta.setLastFinalizedVersion(tx, version); err != nil {
+	if err := d.meta.applyStorage(tx, storage); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to update storage: %w", err)
+	}
+
+	// Update last finalized version and remove the journal entry at the same time.
+	if err := d.meta.setLastFinalizedVersion(tx, version); err != nil {
 		return fmt.Errorf("mkvs/badger: failed to set last finalized version: %w", err)
 	}
+	if err := fj.remove(tx); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to remove finalization journal: %w", err)
+	}
 
 	if err := tx.CommitAt(tsMetadata, nil); err != nil {
 		return fmt.Errorf("mkvs/badger: failed to commit metadata: %w", err)
 	}
+	d.storageTracker.finalized(version)
+	d.updateNonFinalizedMetrics()
+	d.updateStorageMetrics()
+	if err := d.runFinalizeHook(finalizeStepMetadata); err != nil {
+		return err
+	}
 
 	// Clean multipart metadata if there is any.
-	if d.multipartVersion != multipartVersionNone {
+	if d.meta.getMultipartVersion() != multipartVersionNone {
 		if err := d.cleanMultipartLocked(false); err != nil {
 			return err
 		}
@@ -716,11 +1315,34 @@ func (d *badgerNodeDB) Finalize(ctx context.Context, roots []node.Root) error {
 	return nil
 }
 
+func (d *badgerNodeDB) runFinalizeHook(step finalizeStep) error {
+	if d.finalizeHook == nil {
+		return nil
+	}
+	return d.finalizeHook(step)
+}
+
 func (d *badgerNodeDB) Prune(ctx context.Context, version uint64) error {
+	return d.prune(ctx, version, true, true)
+}
+
+func (d *badgerNodeDB) PruneNodes(ctx context.Context, version uint64) error {
+	return d.prune(ctx, version, true, false)
+}
+
+func (d *badgerNodeDB) PruneWriteLogs(ctx context.Context, version uint64) error {
+	return d.prune(ctx, version, false, true)
+}
+
+func (d *badgerNodeDB) prune(ctx context.Context, version uint64, pruneNodes, pruneWriteLogs bool) (err error) { // nolint: gocyclo
 	if d.readOnly {
 		return api.ErrReadOnly
 	}
+	op := d.startVersionOp(api.OpPrune, version)
+	defer func() { op.finish(err) }()
 
+	d.commitLock.Lock()
+	defer d.commitLock.Unlock()
 	d.metaUpdateLock.Lock()
 	defer d.metaUpdateLock.Unlock()
 
@@ -734,16 +1356,100 @@ func (d *badgerNodeDB) Prune(ctx context.Context, version uint64) error {
 		return api.ErrNotFinalized
 	}
 	// Make sure that the version that we are trying to prune is the earliest version.
-	if version != d.meta.getEarliestVersion() {
+	earliestVersion := d.meta.getEarliestVersion()
+	earliestWriteLogVersion := d.meta.getEarliestWriteLogVersion()
+	if pruneNodes && version != earliestVersion {
 		return api.ErrNotEarliest
 	}
+	switch {
+	case pruneWriteLogs && pruneNodes:
+		// Write logs may have already been pruned past this version, but any earlier write logs
+		// must be pruned first.
+		if earliestWriteLogVersion < version {
+			return api.ErrNotEarliest
+		}
+	case pruneWriteLogs:
+		if version != earliestWriteLogVersion {
+			return api.ErrNotEarliest
+		}
+	}
+	// Write logs are only present if they have not been pruned yet.
+	hasWriteLogs := !d.discardWriteLogs && version >= earliestWriteLogVersion
 
-	// Remove all roots in version.
 	batch := d.db.NewWriteBatchAt(versionToTs(version))
 	defer batch.Cancel()
 	tx := d.db.NewTransactionAt(versionToTs(version), true)
 	defer tx.Discard()
+	storage := newStorageDelta(d.db)
+
+	// Retain write logs by detaching them from the nodes that are about to be removed.
+	if pruneNodes && !pruneWriteLogs && hasWriteLogs {
+		if err := d.detachWriteLogs(ctx, batch, storage, version); err != nil {
+			return err
+		}
+	}
+
+	// Remove all roots in version.
+	if pruneNodes {
+		if err := d.pruneNodes(ctx, tx, batch, storage, version); err != nil {
+			return err
+		}
+	}
+
+	// Prune all write logs in version.
+	if pruneWriteLogs && hasWriteLogs {
+		// Write logs are detached in case the nodes have already been pruned.
+		logKeyFmt := writeLogKeyFmt
+		if version < earliestVersion {
+			logKeyFmt = detachedWriteLogKeyFmt
+		}
+
+		if err := d.deleteWithPrefixStorage(batch, storage, version, logKeyFmt.Encode(version)); err != nil {
+			return err
+		}
+	}
+
+	// Commit batch.
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to flush batch: %w", err)
+	}
+
+	// Update metadata.
+	newEarliestVersion, newEarliestWriteLogVersion := earliestVersion, earliestWriteLogVersion
+	if pruneNodes {
+		newEarliestVersion = version + 1
+	}
+	if pruneWriteLogs {
+		newEarliestWriteLogVersion = version + 1
+	}
+	if err := d.meta.setEarliestVersions(tx, newEarliestVersion, newEarliestWriteLogVersion); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to set earliest versions: %w", err)
+	}
+	if err := d.meta.applyStorage(tx, storage); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to update storage: %w", err)
+	}
+	if err := tx.CommitAt(tsMetadata, nil); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to commit: %w", err)
+	}
+	d.updateStorageMetrics()
+
+	// Discard everything invalidated at or below given version. Note that detached write logs
+	// are not invalidated so they are not discarded.
+	if pruneNodes {
+		d.db.SetDiscardTs(versionToTs(version + 1))
+	}
+	d.updateMetadataSnapshotLocked()
 
+	return nil
+}
+
+func (d *badgerNodeDB) pruneNodes(
+	ctx context.Context,
+	tx *badger.Txn,
+	batch *badger.WriteBatch,
+	storage *storageDelta,
+	version uint64,
+) error {
 	rootsMeta, err := loadRootsMetadata(tx, version)
 	if err != nil {
 		return err
@@ -758,6 +1464,7 @@ func (d *badgerNodeDB) Prune(ctx context.Context, version uint64) error {
 		// Traverse the root and prune all items created in this version.
 		root := node.Root{
 			Namespace: d.namespace,
+			HashMode:  d.hashMode,
 			Version:   version,
 			Type:      rootHash.Type(),
 			Hash:      rootHash.Hash(),
@@ -766,12 +1473,15 @@ func (d *badgerNodeDB) Prune(ctx context.Context, version uint64) error {
 		err := api.Visit(ctx, d, root, func(ctx context.Context, n node.Node) bool {
 			h := n.GetHash()
 			var item *badger.Item
-			if item, innerErr = tx.Get(nodeKeyFmt.Encode(&h)); innerErr != nil {
+			if item, innerErr = tx.Get(d.nodeKey(&h)); innerErr != nil {
 				return false
 			}
 
 			if tsToVersion(item.Version()) == version {
-				if innerErr = batch.Delete(nodeKeyFmt.Encode(&h)); innerErr != nil {
+				if innerErr = storage.remove(version, d.nodeKey(&h)); innerErr != nil {
+					return false
+				}
+				if innerErr = batch.Delete(d.nodeKey(&h)); innerErr != nil {
 					return false
 				}
 			}
@@ -789,47 +1499,321 @@ func (d *badgerNodeDB) Prune(ctx context.Context, version uint64) error {
 		}
 	}
 
-	// Delete roots metadata.
+	// Delete roots metadata and the key filter.
 	if err := tx.Delete(rootsMetadataKeyFmt.Encode(version)); err != nil {
 		return fmt.Errorf("mkvs/badger: failed to remove roots metadata: %w", err)
 	}
+	if err := tx.Delete(keyFilterKeyFmt.Encode(version)); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to remove key filter: %w", err)
+	}
+	return nil
+}
 
-	// Prune all write logs in version.
-	if !d.discardWriteLogs {
-		wtx := d.db.NewTransactionAt(versionToTs(version), false)
-		defer wtx.Discard()
+func (d *badgerNodeDB) PruneRootType(ctx context.Context, version uint64, rootType node.RootType) error { // nolint: gocyclo
+	if d.readOnly {
+		return api.ErrReadOnly
+	}
+	if rootType == node.RootTypeInvalid || rootType > node.RootTypeMax {
+		return fmt.Errorf("mkvs/badger: invalid root type: %s", rootType)
+	}
 
-		prefix := writeLogKeyFmt.Encode(version)
-		it := wtx.NewIterator(badger.IteratorOptions{Prefix: prefix})
-		defer it.Close()
+	d.commitLock.Lock()
+	defer d.commitLock.Unlock()
+	d.metaUpdateLock.Lock()
+	defer d.metaUpdateLock.Unlock()
 
-		for it.Rewind(); it.Valid(); it.Next() {
-			if err := batch.Delete(it.Item().KeyCopy(nil)); err != nil {
+	if d.multipartVersion != multipartVersionNone {
+		return api.ErrMultipartInProgress
+	}
+
+	// Make sure that the version that we try to prune has been finalized and not yet pruned.
+	lastFinalizedVersion, exists := d.meta.getLastFinalizedVersion()
+	if !exists || lastFinalizedVersion < version {
+		return api.ErrNotFinalized
+	}
+	earliestVersion := d.meta.getEarliestVersion()
+	if version < earliestVersion {
+		return api.ErrVersionNotFound
+	}
+	hasWriteLogs := !d.discardWriteLogs && version >= d.meta.getEarliestWriteLogVersion()
+
+	batch := d.db.NewWriteBatchAt(versionToTs(version))
+	defer batch.Cancel()
+	tx := d.db.NewTransactionAt(versionToTs(version), true)
+	defer tx.Discard()
+
+	rootsMeta, err := loadRootsMetadata(tx, version)
+	if err != nil {
+		return err
+	}
+
+	storage := newStorageDelta(d.db)
+	prunedRoots := make(map[typedHash]bool)
+	for rootHash := range rootsMeta.Roots {
+		if rootHash.Type() == rootType {
+			prunedRoots[rootHash] = true
+		}
+	}
+	if len(prunedRoots) == 0 {
+		return nil
+	}
+
+	// Collect nodes created in this version which are shared with any of the retained roots, so
+	// that they are not removed.
+	sharedNodes := make(map[hash.Hash]bool)
+	for rootHash := range rootsMeta.Roots {
+		if prunedRoots[rootHash] {
+			continue
+		}
+
+		root := node.Root{
+			Namespace: d.namespace,
+			HashMode:  d.hashMode,
+			Version:   version,
+			Type:      rootHash.Type(),
+			Hash:      rootHash.Hash(),
+		}
+		var innerErr error
+		err = api.Visit(ctx, d, root, func(ctx context.Context, n node.Node) bool {
+			h := n.GetHash()
+			if sharedNodes[h] {
+				return false
+			}
+
+			var item *badger.Item
+			if item, innerErr = tx.Get(d.nodeKey(&h)); innerErr != nil {
+				return false
+			}
+			if tsToVersion(item.Version()) != version {
+				// Nodes from earlier versions can only reference nodes from earlier versions.
+				return false
+			}
+			sharedNodes[h] = true
+			return true
+		})
+		if innerErr != nil {
+			return innerErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for rootHash := range prunedRoots {
+		// Nodes of roots that have derived roots in later versions are still referenced.
+		lone := true
+		for _, derivedRoot := range rootsMeta.Roots[rootHash] {
+			if derivedRoot.Equal(&rootHash) || !prunedRoots[derivedRoot] {
+				lone = false
+				break
+			}
+		}
+
+		if lone {
+			root := node.Root{
+				Namespace: d.namespace,
+				HashMode:  d.hashMode,
+				Version:   version,
+				Type:      rootHash.Type(),
+				Hash:      rootHash.Hash(),
+			}
+			var innerErr error
+			err = api.Visit(ctx, d, root, func(ctx context.Context, n node.Node) bool {
+				h := n.GetHash()
+				if sharedNodes[h] {
+					return false
+				}
+
+				var item *badger.Item
+				if item, innerErr = tx.Get(d.nodeKey(&h)); innerErr != nil {
+					return false
+				}
+
+				if tsToVersion(item.Version()) == version {
+					if innerErr = storage.remove(version, d.nodeKey(&h)); innerErr != nil {
+						return false
+					}
+					if innerErr = batch.Delete(d.nodeKey(&h)); innerErr != nil {
+						return false
+					}
+				}
+				return true
+			})
+			if innerErr != nil {
+				return innerErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err = batch.Delete(rootNodeKeyFmt.Encode(&rootHash)); err != nil {
+			return err
+		}
+		if hasWriteLogs {
+			if err = d.deleteWithPrefixStorage(batch, storage, version, writeLogKeyFmt.Encode(version, &rootHash)); err != nil {
 				return err
 			}
 		}
+		delete(rootsMeta.Roots, rootHash)
 	}
 
 	// Commit batch.
-	if err := batch.Flush(); err != nil {
+	if err = batch.Flush(); err != nil {
 		return fmt.Errorf("mkvs/badger: failed to flush batch: %w", err)
 	}
 
-	// Update metadata.
-	if err := d.meta.setEarliestVersion(tx, version+1); err != nil {
-		return fmt.Errorf("mkvs/badger: failed to set earliest version: %w", err)
+	// Update roots metadata, including links to the pruned roots from the previous version.
+	if err = rootsMeta.save(tx); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to save roots metadata: %w", err)
 	}
-	if err := tx.CommitAt(tsMetadata, nil); err != nil {
+	if version > earliestVersion {
+		var prevRootsMeta *rootsMetadata
+		if prevRootsMeta, err = loadRootsMetadata(tx, version-1); err != nil {
+			return err
+		}
+
+		var changed bool
+		for rootHash, derivedRoots := range prevRootsMeta.Roots {
+			retainedRoots := make([]typedHash, 0, len(derivedRoots))
+			for _, derivedRoot := range derivedRoots {
+				if _, ok := prevRootsMeta.Roots[derivedRoot]; !prunedRoots[derivedRoot] || ok {
+					retainedRoots = append(retainedRoots, derivedRoot)
+				}
+			}
+			if len(retainedRoots) != len(derivedRoots) {
+				prevRootsMeta.Roots[rootHash] = retainedRoots
+				changed = true
+			}
+		}
+		if changed {
+			if err = prevRootsMeta.save(tx); err != nil {
+				return fmt.Errorf("mkvs/badger: failed to save roots metadata: %w", err)
+			}
+		}
+	}
+	if err = d.meta.applyStorage(tx, storage); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to update storage: %w", err)
+	}
+	if err = tx.CommitAt(tsMetadata, nil); err != nil {
 		return fmt.Errorf("mkvs/badger: failed to commit: %w", err)
 	}
+	d.updateStorageMetrics()
+
+	return nil
+}
+
+// detachWriteLogs replaces all write logs in the given version with detached write logs that
+// contain the values directly instead of referencing leaf nodes, so that they remain available
+// after the nodes have been pruned.
+func (d *badgerNodeDB) detachWriteLogs(
+	ctx context.Context,
+	batch *badger.WriteBatch,
+	storage *storageDelta,
+	version uint64,
+) error {
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: writeLogKeyFmt.Encode(version)})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var (
+			decVersion       uint64
+			decEndRootHash   typedHash
+			decStartRootHash typedHash
+		)
+		item := it.Item()
+		if !writeLogKeyFmt.Decode(item.Key(), &decVersion, &decEndRootHash, &decStartRootHash) {
+			// This should not happen as the Badger iterator should take care of it.
+			panic("mkvs/badger: bad iterator")
+		}
+
+		key := detachedWriteLogKeyFmt.Encode(version, &decEndRootHash, &decStartRootHash)
+		var (
+			log       api.HashedDBWriteLog
+			available bool
+		)
+		if err := item.Value(func(data []byte) error {
+			if available = len(data) > 0; !available {
+				return nil
+			}
+			return cbor.UnmarshalTrusted(data, &log)
+		}); err != nil {
+			return err
+		}
+		if !available {
+			// Retain the marker so that the write log is reported as not available.
+			if err := storage.put(version, key, nil); err != nil {
+				return err
+			}
+			if err := batch.Set(key, []byte{}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		root := node.Root{
+			Namespace: d.namespace,
+			HashMode:  d.hashMode,
+			Version:   version,
+			Type:      decEndRootHash.Type(),
+			Hash:      decEndRootHash.Hash(),
+		}
+		wl := make(writelog.WriteLog, 0, len(log))
+		for _, entry := range log {
+			logEntry := writelog.LogEntry{Key: entry.Key}
+			if entry.InsertedHash != nil {
+				leaf, err := d.GetNode(root, &node.Pointer{Hash: *entry.InsertedHash, Clean: true})
+				if err != nil {
+					return fmt.Errorf("mkvs/badger: failed to fetch write log value: %w", err)
+				}
+				logEntry.Value = leaf.(*node.LeafNode).Value
+			}
+			wl = append(wl, logEntry)
+		}
+
+		detached := cbor.Marshal(wl)
+		if err := storage.put(version, key, detached); err != nil {
+			return err
+		}
+		if err := batch.Set(key, detached); err != nil {
+			return fmt.Errorf("mkvs/badger: failed to set detached write log: %w", err)
+		}
+		if err := storage.remove(version, item.Key()); err != nil {
+			return err
+		}
+		if err := batch.Delete(item.KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// Discard everything invalidated at or below given version.
-	d.db.SetDiscardTs(versionToTs(version + 1))
+// deleteWithPrefix deletes all keys with the given prefix visible at the given timestamp.
+func (d *badgerNodeDB) deleteWithPrefix(batch *badger.WriteBatch, ts uint64, prefix []byte) error {
+	tx := d.db.NewTransactionAt(ts, false)
+	defer tx.Discard()
+
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
 
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := batch.Delete(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (d *badgerNodeDB) StartMultipartInsert(version uint64) error {
+	d.commitLock.Lock()
+	defer d.commitLock.Unlock()
 	d.metaUpdateLock.Lock()
 	defer d.metaUpdateLock.Unlock()
 
@@ -861,6 +1845,8 @@ func (d *badgerNodeDB) StartMultipartInsert(version uint64) error {
 }
 
 func (d *badgerNodeDB) AbortMultipartInsert() error {
+	d.commitLock.Lock()
+	defer d.commitLock.Unlock()
 	d.metaUpdateLock.Lock()
 	defer d.metaUpdateLock.Unlock()
 
@@ -868,13 +1854,8 @@ func (d *badgerNodeDB) AbortMultipartInsert() error {
 }
 
 func (d *badgerNodeDB) NewBatch(oldRoot node.Root, version uint64, chunk bool) (api.Batch, error) {
-	// WARNING: There is a maximum batch size and maximum batch entry count.
-	// Both of these things are derived from the MaxTableSize option.
-	//
-	// The size limit also applies to normal transactions, so the "right"
-	// thing to do would be to either crank up MaxTableSize or maybe split
-	// the transaction out.
-
+	// NOTE: There is a maximum transaction size and maximum transaction entry count, so all
+	// writes performed by the batch are transparently split across multiple transactions.
 	if d.readOnly {
 		return nil, api.ErrReadOnly
 	}
@@ -900,11 +1881,13 @@ func (d *badgerNodeDB) NewBatch(oldRoot node.Root, version uint64, chunk bool) (
 
 	return &badgerBatch{
 		db:             d,
-		bat:            d.db.NewWriteBatchAt(versionToTs(version)),
+		bat:            d.newSplitTxn(versionToTs(version)),
 		multipartNodes: logBatch,
 		readTxn:        readTxn,
 		oldRoot:        oldRoot,
+		version:        version,
 		chunk:          chunk,
+		storage:        newStorageDelta(d.db),
 	}, nil
 }
 
@@ -917,11 +1900,42 @@ func (d *badgerNodeDB) Sync() error {
 	return d.db.Sync()
 }
 
+func (d *badgerNodeDB) CacheStats() api.CacheStats {
+	opts := d.db.Opts()
+	stats := api.CacheStats{
+		BlockCacheSize: opts.BlockCacheSize,
+		IndexCacheSize: opts.IndexCacheSize,
+	}
+
+	// Cache usage is the total cost of all items added to the cache which have not yet been
+	// evicted. Caches which are not enabled have no metrics.
+	if m := d.db.BlockCacheMetrics(); m != nil {
+		stats.BlockCacheUsed = int64(m.CostAdded() - m.CostEvicted())
+	}
+	if m := d.db.IndexCacheMetrics(); m != nil {
+		stats.IndexCacheUsed = int64(m.CostAdded() - m.CostEvicted())
+	}
+	return stats
+}
+
+func (d *badgerNodeDB) ResizeCaches(blockCacheSize, indexCacheSize int64) error {
+	if err := api.ValidateCacheSizes(blockCacheSize, indexCacheSize); err != nil {
+		return err
+	}
+
+	// Badger does not expose its caches so their sizes can only be changed by reopening the
+	// database with a different configuration.
+	return fmt.Errorf("%w: badger caches cannot be resized at runtime", api.ErrNotSupported)
+}
+
 func (d *badgerNodeDB) Close() {
 	d.closeOnce.Do(func() {
 		if d.gc != nil {
 			d.gc.Close()
 		}
+		if d.keyFilters != nil {
+			d.keyFilters.Close()
+		}
 
 		if err := d.db.Close(); err != nil {
 			d.logger.Error("close returned error",
@@ -935,7 +1949,7 @@ type badgerBatch struct {
 	api.BaseBatch
 
 	db             *badgerNodeDB
-	bat            *badger.WriteBatch
+	bat            *splitTxn
 	multipartNodes *badger.WriteBatch
 
 	// readTx is the read transaction used to check for node existence during
@@ -943,11 +1957,33 @@ type badgerBatch struct {
 	readTxn *badger.Txn
 
 	oldRoot node.Root
+	version uint64
 	chunk   bool
 
+	// pendingBytes is the number of bytes written to the batch since it was last flushed.
+	pendingBytes int64
+	// pendingNodes are the hashes of nodes written to the batch since it was last flushed and
+	// flushedNodes are the hashes of flushed nodes that need to be removed in case the batch is
+	// discarded after its version has been finalized.
+	pendingNodes []hash.Hash
+	flushedNodes []hash.Hash
+
 	writeLog     writelog.WriteLog
 	annotations  writelog.Annotations
+	skipWriteLog bool
 	updatedNodes []updatedNode
+	// storage is the storage used by the nodes and write logs written by this batch.
+	storage *storageDelta
+	// writing is true iff the batch has started writing and storageGen is the generation of the
+	// storage tracker in which it started.
+	writing    bool
+	storageGen uint64
+
+	// Statistics about the nodes written by this batch.
+	internalNodes uint64
+	leafNodes     uint64
+	reusedNodes   uint64
+	nodeBytes     uint64
 }
 
 func (ba *badgerBatch) MaybeStartSubtree(subtree api.Subtree, depth node.Depth, subtreeRoot *node.Pointer) api.Subtree {
@@ -967,6 +2003,21 @@ func (ba *badgerBatch) PutWriteLog(writeLog writelog.WriteLog, annotations write
 
 	ba.writeLog = writeLog
 	ba.annotations = annotations
+	ba.skipWriteLog = false
+	return nil
+}
+
+func (ba *badgerBatch) SkipWriteLog() error {
+	if ba.chunk {
+		return fmt.Errorf("mkvs/badger: cannot skip write log in chunk mode")
+	}
+	if ba.db.discardWriteLogs {
+		return nil
+	}
+
+	ba.writeLog = nil
+	ba.annotations = nil
+	ba.skipWriteLog = true
 	return nil
 }
 
@@ -984,108 +2035,142 @@ func (ba *badgerBatch) RemoveNodes(nodes []node.Node) error {
 	return nil
 }
 
-func (ba *badgerBatch) Commit(root node.Root) error {
-	ba.db.metaUpdateLock.Lock()
-	defer ba.db.metaUpdateLock.Unlock()
+func (ba *badgerBatch) Commit(root node.Root) (err error) {
+	op := ba.db.startOp(api.OpCommit, root)
+	defer func() { op.finish(err) }()
+
+	// Batches may be committed concurrently, but not while the set of versions is being changed.
+	ba.db.commitLock.RLock()
+	defer ba.db.commitLock.RUnlock()
 
 	if ba.db.multipartVersion != multipartVersionNone && ba.db.multipartVersion != root.Version {
 		return api.ErrInvalidMultipartVersion
 	}
 
-	if err := ba.db.sanityCheckNamespace(root.Namespace); err != nil {
+	if err := ba.db.sanityCheckRoot(root); err != nil {
 		return err
 	}
 	if !root.Follows(&ba.oldRoot) {
 		return api.ErrRootMustFollowOld
 	}
 
-	// Make sure that the version that we try to commit into has not yet been finalized.
-	lastFinalizedVersion, exists := ba.db.meta.getLastFinalizedVersion()
-	if exists && lastFinalizedVersion >= root.Version {
-		return api.ErrAlreadyFinalized
-	}
-
-	// Update the set of roots for this version.
-	tx := ba.db.db.NewTransactionAt(versionToTs(root.Version), true)
+	// Load the set of roots for this version. As roots are only removed while the commit lock is
+	// held exclusively, it is safe to check the roots without holding the metadata lock.
+	tx := ba.db.db.NewTransactionAt(versionToTs(root.Version), false)
 	defer tx.Discard()
 
 	rootsMeta, err := loadRootsMetadata(tx, root.Version)
 	if err != nil {
 		return err
 	}
-
 	rootHash := typedHashFromRoot(root)
-	if err = ba.bat.Set(rootNodeKeyFmt.Encode(&rootHash), []byte{}); err != nil {
-		return err
-	}
-	if ba.multipartNodes != nil {
-		if err = ba.multipartNodes.Set(multipartRestoreNodeLogKeyFmt.Encode(&rootHash), []byte{}); err != nil {
-			return err
+
+	// Make sure that the version that we try to commit into has not yet been finalized. As all
+	// non-finalized roots are discarded during finalization, committing a root that still exists
+	// in a finalized version means that it has been finalized and the commit is a no-op.
+	lastFinalizedVersion, exists := ba.db.meta.getLastFinalizedVersion()
+	if exists && lastFinalizedVersion >= root.Version {
+		if ba.chunk || root.Version < ba.db.meta.getEarliestVersion() || rootsMeta.Roots[rootHash] == nil {
+			return api.ErrAlreadyFinalized
 		}
+		// Any flushed nodes are part of the existing root.
+		ba.flushedNodes = nil
+		ba.Reset()
+		return ba.BaseBatch.Commit(root)
 	}
 
-	if rootsMeta.Roots[rootHash] != nil {
+	if rootsMeta.Roots[rootHash] != nil && !ba.chunk {
 		// Root already exists, no need to do anything since if the hash matches, everything will
-		// be identical and we would just be duplicating work.
+		// be identical and we would just be duplicating work. In particular, the write log is not
+		// stored again.
 		//
 		// If we are importing a chunk, there can be multiple commits for the same root.
-		if !ba.chunk {
-			ba.Reset()
-			return ba.BaseBatch.Commit(root)
-		}
-	} else {
-		// Create root with no derived roots.
-		rootsMeta.Roots[rootHash] = []typedHash{}
-
-		if err = rootsMeta.save(tx); err != nil {
-			return fmt.Errorf("mkvs/badger: failed to save roots metadata: %w", err)
-		}
+		ba.flushedNodes = nil
+		ba.Reset()
+		return ba.BaseBatch.Commit(root)
 	}
 
-	if ba.chunk {
-		// Skip most of metadata updates if we are just importing chunks.
-		key := rootUpdatedNodesKeyFmt.Encode(root.Version, &rootHash)
-		if err = tx.Set(key, cbor.Marshal([]updatedNode{})); err != nil {
-			return fmt.Errorf("mkvs/badger: set returned error: %w", err)
+	// Make sure that the old root exists before writing anything.
+	oldRootHash := typedHashFromRoot(ba.oldRoot)
+	if !ba.chunk && !ba.oldRoot.Hash.IsEmpty() {
+		if ba.oldRoot.Version < ba.db.meta.getEarliestVersion() && ba.oldRoot.Version != root.Version {
+			return api.ErrPreviousVersionMismatch
 		}
-	} else {
-		// Update the root link for the old root.
-		oldRootHash := typedHashFromRoot(ba.oldRoot)
-		if !ba.oldRoot.Hash.IsEmpty() {
-			if ba.oldRoot.Version < ba.db.meta.getEarliestVersion() && ba.oldRoot.Version != root.Version {
-				return api.ErrPreviousVersionMismatch
-			}
 
-			var oldRootsMeta *rootsMetadata
+		oldRootsMeta := rootsMeta
+		if ba.oldRoot.Version != root.Version {
 			oldRootsMeta, err = loadRootsMetadata(tx, ba.oldRoot.Version)
 			if err != nil {
 				return err
 			}
-
-			if _, ok := oldRootsMeta.Roots[oldRootHash]; !ok {
-				return api.ErrRootNotFound
+		}
+		if _, ok := oldRootsMeta.Roots[oldRootHash]; !ok {
+			if typ, ok := oldRootsMeta.storedType(oldRootHash); ok {
+				return &api.RootTypeMismatchError{Root: ba.oldRoot, StoredType: typ}
 			}
+			return api.ErrRootNotFound
+		}
+	}
 
-			oldRootsMeta.Roots[oldRootHash] = append(oldRootsMeta.Roots[oldRootHash], rootHash)
-			if err = oldRootsMeta.save(tx); err != nil {
-				return fmt.Errorf("mkvs/badger: failed to save old roots metadata: %w", err)
-			}
+	// Nodes have already been written to the batch, but they are only committed below.
+	op.wrote(ba.internalNodes + ba.leafNodes)
+
+	if err = ba.bat.Set(rootNodeKeyFmt.Encode(&rootHash), []byte{}); err != nil {
+		return err
+	}
+	if ba.multipartNodes != nil {
+		if err = ba.multipartNodes.Set(multipartRestoreNodeLogKeyFmt.Encode(&rootHash), []byte{}); err != nil {
+			return err
 		}
+	}
 
+	// Metadata updates may need to be split across multiple transactions. Roots metadata is
+	// written last, together with the removal of the pending marker, so the root only becomes
+	// reachable once all of its metadata has been written.
+	metaTx := ba.db.newSplitTxn(tsMetadata)
+	defer metaTx.Discard()
+	metaTx.marker = pendingCommitKeyFmt.Encode(root.Version, &rootHash)
+	metaTx.splitHook = ba.db.commitSplitHook
+
+	if ba.chunk {
+		// Skip most of metadata updates if we are just importing chunks.
+		key := rootUpdatedNodesKeyFmt.Encode(root.Version, &rootHash)
+		if err = metaTx.Set(key, cbor.Marshal([]updatedNode{})); err != nil {
+			return fmt.Errorf("mkvs/badger: set returned error: %w", err)
+		}
+	} else {
 		// Store updated nodes (only needed until the version is finalized).
 		key := rootUpdatedNodesKeyFmt.Encode(root.Version, &rootHash)
-		if err = tx.Set(key, cbor.Marshal(ba.updatedNodes)); err != nil {
+		if err = metaTx.Set(key, cbor.Marshal(ba.updatedNodes)); err != nil {
 			return fmt.Errorf("mkvs/badger: set returned error: %w", err)
 		}
 
 		// Store write log.
-		if ba.writeLog != nil && ba.annotations != nil {
+		switch {
+		case ba.skipWriteLog:
+			// Store an empty marker so that the write log is reported as not available instead
+			// of not found.
+			key := writeLogKeyFmt.Encode(root.Version, &rootHash, &oldRootHash)
+			ba.startWriting()
+			if err = ba.storage.put(root.Version, key, nil); err != nil {
+				return err
+			}
+			if err = ba.bat.Set(key, []byte{}); err != nil {
+				return fmt.Errorf("mkvs/badger: set write log marker returned error: %w", err)
+			}
+			op.wrote(1)
+		case ba.writeLog != nil && ba.annotations != nil:
 			log := api.MakeHashedDBWriteLog(ba.writeLog, ba.annotations)
 			bytes := cbor.Marshal(log)
 			key := writeLogKeyFmt.Encode(root.Version, &rootHash, &oldRootHash)
+			ba.startWriting()
+			if err = ba.storage.put(root.Version, key, bytes); err != nil {
+				return err
+			}
 			if err = ba.bat.Set(key, bytes); err != nil {
 				return fmt.Errorf("mkvs/badger: set new write log returned error: %w", err)
 			}
+			op.wrote(1)
 		}
 	}
 
@@ -1095,31 +2180,264 @@ func (ba *badgerBatch) Commit(root node.Root) error {
 			return fmt.Errorf("mkvs/badger: failed to flush node log batch: %w", err)
 		}
 	}
-	if err = ba.bat.Flush(); err != nil {
-		return fmt.Errorf("mkvs/badger: failed to flush batch: %w", err)
+	if err = ba.bat.Commit(); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to commit batch: %w", err)
 	}
 
 	// Commit root metadata updates. This is done last, so in case we fail, we can still retry.
-	if err = tx.CommitAt(tsMetadata, nil); err != nil {
+	if err = ba.commitRoot(root, metaTx, op); err != nil {
 		return err
 	}
 
+	ba.db.logger.Debug("committed batch",
+		"root", root,
+		"internal_nodes", ba.internalNodes,
+		"leaf_nodes", ba.leafNodes,
+		"reused_nodes", ba.reusedNodes,
+		"bytes", ba.nodeBytes,
+	)
+
 	ba.writeLog = nil
 	ba.annotations = nil
+	ba.skipWriteLog = false
 	ba.updatedNodes = nil
+	ba.resetStorage()
+	ba.pendingBytes = 0
+	ba.pendingNodes = nil
+	ba.flushedNodes = nil
+	ba.resetStats()
 
 	return ba.BaseBatch.Commit(root)
 }
 
+// commitRoot registers the committed root in the roots metadata, links it to the old root
+// and applies the storage used by the batch.
+//
+// This is the only part of a commit that needs to be serialized with other commits. As batches
+// for the same version may be committed concurrently, the roots metadata is reloaded and the root
+// may already have been registered by a concurrent commit of identical content. The whole
+// read-modify-write of the roots metadata is done under metaUpdateLock as writes at tsMetadata
+// are not conflict-checked, so concurrent updates would otherwise be lost.
+//
+// Assumes commitLock is held for reading when called.
+func (ba *badgerBatch) commitRoot(root node.Root, metaTx *splitTxn, op *slowOp) error {
+	ba.db.metaUpdateLock.Lock()
+	defer ba.db.metaUpdateLock.Unlock()
+
+	tx := ba.db.db.NewTransactionAt(versionToTs(root.Version), false)
+	defer tx.Discard()
+
+	rootsMeta, err := loadRootsMetadata(tx, root.Version)
+	if err != nil {
+		return err
+	}
+	rootHash := typedHashFromRoot(root)
+	updatedRootsMeta := []*rootsMetadata{rootsMeta}
+
+	newRoot := rootsMeta.Roots[rootHash] == nil
+	if newRoot {
+		// Create root with no derived roots.
+		rootsMeta.Roots[rootHash] = []typedHash{}
+	}
+
+	// Update the root link for the old root.
+	if !ba.chunk && !ba.oldRoot.Hash.IsEmpty() {
+		oldRootHash := typedHashFromRoot(ba.oldRoot)
+		oldRootsMeta := rootsMeta
+		if ba.oldRoot.Version != root.Version {
+			oldRootsMeta, err = loadRootsMetadata(tx, ba.oldRoot.Version)
+			if err != nil {
+				return err
+			}
+			updatedRootsMeta = append(updatedRootsMeta, oldRootsMeta)
+		}
+
+		derivedRoots, ok := oldRootsMeta.Roots[oldRootHash]
+		if !ok {
+			return api.ErrRootNotFound
+		}
+		var linked bool
+		for _, h := range derivedRoots {
+			if h == rootHash {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			oldRootsMeta.Roots[oldRootHash] = append(derivedRoots, rootHash)
+		}
+	}
+
+	rootsMetaUpdates := make([]splitEntry, 0, len(updatedRootsMeta))
+	for _, rm := range updatedRootsMeta {
+		rootsMetaUpdates = append(rootsMetaUpdates, rm.entry())
+	}
+	if ba.writing {
+		// Make sure that keys written concurrently by other batches are only accounted for once.
+		ba.db.storageTracker.commit(root.Version, ba.storage, ba.storageGen)
+		ba.writing = false
+	}
+	storageUpdates, err := ba.db.meta.updateStorage(tx, ba.storage)
+	if err != nil {
+		return err
+	}
+	rootsMetaUpdates = append(rootsMetaUpdates, storageUpdates...)
+	switch {
+	case newRoot:
+		// Track the new non-finalized root together with the roots metadata.
+		rootsMetaUpdates = append(rootsMetaUpdates, ba.db.meta.addNonFinalizedRoot(root.Version))
+	case len(storageUpdates) > 0:
+		rootsMetaUpdates = append(rootsMetaUpdates, ba.db.meta.entry())
+	}
+	if err = metaTx.write(rootsMetaUpdates...); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to save roots metadata: %w", err)
+	}
+	if err = metaTx.Commit(); err != nil {
+		return err
+	}
+	op.wrote(uint64(len(rootsMetaUpdates)))
+	if newRoot {
+		ba.db.updateNonFinalizedMetrics()
+	}
+	ba.db.updateStorageMetrics()
+	return nil
+}
+
+// maybeFlush flushes the nodes written so far in case the configured flush threshold has been
+// reached. This bounds the amount of memory used by the batch as the underlying write batch would
+// otherwise buffer nodes until it decides to commit them on its own.
+//
+// Flushing is safe as nodes are only reachable through root metadata, which is only written when
+// the batch is committed. Flushed nodes which did not exist before are recorded so that they can
+// be removed in case the batch is discarded.
+func (ba *badgerBatch) maybeFlush() error {
+	if ba.db.batchFlushThreshold == 0 || ba.pendingBytes < ba.db.batchFlushThreshold {
+		return nil
+	}
+
+	if err := ba.recordFlushedNodes(); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to record flushed nodes: %w", err)
+	}
+	if err := ba.bat.Flush(); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to flush batch: %w", err)
+	}
+	ba.pendingBytes = 0
+	ba.pendingNodes = nil
+	return nil
+}
+
+// recordFlushedNodes records the pending nodes which do not yet exist before they are flushed.
+//
+// As long as the version has not been finalized, the nodes are recorded in the database and
+// finalization removes any of them which are not referenced by a finalized root. As nodes are
+// shared between roots, this is the only point at which it is known that a node is no longer
+// needed. Once the version has been finalized the batch can no longer be committed, so the nodes
+// are tracked in memory and removed when the batch is reset.
+func (ba *badgerBatch) recordFlushedNodes() error {
+	// Prevent the version from being finalized while recording.
+	ba.db.commitLock.RLock()
+	defer ba.db.commitLock.RUnlock()
+
+	readTx := ba.db.db.NewTransactionAt(versionToTs(ba.version), false)
+	defer readTx.Discard()
+
+	var newNodes []hash.Hash
+	for _, h := range ba.pendingNodes {
+		_, err := readTx.Get(ba.db.nodeKey(&h))
+		switch err {
+		case nil:
+			// Node already exists, removing it could break other roots.
+			continue
+		case badger.ErrKeyNotFound:
+			newNodes = append(newNodes, h)
+		default:
+			return err
+		}
+	}
+	if len(newNodes) == 0 {
+		return nil
+	}
+
+	if lastFinalizedVersion, exists := ba.db.meta.getLastFinalizedVersion(); exists && lastFinalizedVersion >= ba.version {
+		ba.flushedNodes = append(ba.flushedNodes, newNodes...)
+		return nil
+	}
+
+	batch := ba.db.db.NewWriteBatchAt(tsMetadata)
+	defer batch.Cancel()
+	for i := range newNodes {
+		if err := batch.Set(flushedNodeKeyFmt.Encode(ba.version, &newNodes[i]), []byte{}); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// removeFlushedNodes removes nodes flushed by the batch after its version has been finalized.
+func (ba *badgerBatch) removeFlushedNodes() {
+	if len(ba.flushedNodes) == 0 {
+		return
+	}
+
+	batch := ba.db.db.NewWriteBatchAt(versionToTs(ba.version))
+	defer batch.Cancel()
+	err := func() error {
+		for i := range ba.flushedNodes {
+			if err := batch.Delete(ba.db.nodeKey(&ba.flushedNodes[i])); err != nil {
+				return err
+			}
+		}
+		return batch.Flush()
+	}()
+	if err != nil {
+		ba.db.logger.Error("failed to remove flushed nodes of discarded batch",
+			"err", err,
+			"version", ba.version,
+		)
+	}
+	ba.flushedNodes = nil
+}
+
+// startWriting registers the batch with the storage tracker before it writes its first key.
+func (ba *badgerBatch) startWriting() {
+	if ba.writing {
+		return
+	}
+	ba.storageGen = ba.db.storageTracker.begin()
+	ba.writing = true
+}
+
+// resetStorage discards the storage used by the batch.
+func (ba *badgerBatch) resetStorage() {
+	if ba.writing {
+		ba.db.storageTracker.end(ba.storageGen)
+		ba.writing = false
+	}
+	ba.storage = newStorageDelta(ba.db.db)
+}
+
+func (ba *badgerBatch) resetStats() {
+	ba.internalNodes = 0
+	ba.leafNodes = 0
+	ba.reusedNodes = 0
+	ba.nodeBytes = 0
+}
+
 func (ba *badgerBatch) Reset() {
-	ba.bat.Cancel()
+	ba.bat.Discard()
+	ba.removeFlushedNodes()
 	if ba.multipartNodes != nil {
 		ba.multipartNodes.Cancel()
 		ba.readTxn.Discard()
 	}
 	ba.writeLog = nil
 	ba.annotations = nil
+	ba.skipWriteLog = false
 	ba.updatedNodes = nil
+	ba.resetStorage()
+	ba.pendingBytes = 0
+	ba.pendingNodes = nil
+	ba.resetStats()
 }
 
 type badgerSubtree struct {
@@ -1127,14 +2445,18 @@ type badgerSubtree struct {
 }
 
 func (s *badgerSubtree) PutNode(depth node.Depth, ptr *node.Pointer) error {
-	data, err := ptr.Node.MarshalBinary()
+	data, err := node.MarshalVersionedBinary(ptr.Node)
 	if err != nil {
 		return err
 	}
 
 	h := ptr.Node.GetHash()
 	s.batch.updatedNodes = append(s.batch.updatedNodes, updatedNode{Hash: h})
-	nodeKey := nodeKeyFmt.Encode(&h)
+	if s.batch.db.batchFlushThreshold > 0 {
+		s.batch.pendingNodes = append(s.batch.pendingNodes, h)
+	}
+	nodeKey := s.batch.db.nodeKey(&h)
+	s.batch.startWriting()
 	if s.batch.multipartNodes != nil {
 		if _, err = s.batch.readTxn.Get(nodeKey); err != nil && errors.Is(err, badger.ErrKeyNotFound) {
 			th := typedHashFromParts(node.RootTypeInvalid, h)
@@ -1143,13 +2465,28 @@ func (s *badgerSubtree) PutNode(depth node.Depth, ptr *node.Pointer) error {
 			}
 		}
 	}
+	if err = s.batch.storage.put(s.batch.version, nodeKey, data); err != nil {
+		return err
+	}
 	if err = s.batch.bat.Set(nodeKey, data); err != nil {
 		return err
 	}
-	return nil
+
+	switch ptr.Node.(type) {
+	case *node.InternalNode:
+		s.batch.internalNodes++
+	case *node.LeafNode:
+		s.batch.leafNodes++
+	}
+	s.batch.nodeBytes += uint64(len(data))
+	s.batch.pendingBytes += int64(len(nodeKey) + len(data))
+	return s.batch.maybeFlush()
 }
 
 func (s *badgerSubtree) VisitCleanNode(depth node.Depth, ptr *node.Pointer) error {
+	if !ptr.Hash.IsEmpty() {
+		s.batch.reusedNodes++
+	}
 	return nil
 }
 
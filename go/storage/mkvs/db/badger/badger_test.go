@@ -3,16 +3,21 @@ package badger
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/dgraph-io/badger/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/checkpoint"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
@@ -28,10 +33,10 @@ var (
 	testNs = common.NewTestNamespaceFromSeed([]byte("badger node db test ns"), 0)
 
 	dbCfg = &api.Config{
-		Namespace:    testNs,
-		MaxCacheSize: 16 * 1024 * 1024,
-		NoFsync:      true,
-		MemoryOnly:   true,
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
+		NoFsync:        true,
+		MemoryOnly:     true,
 	}
 
 	testValues = [][]byte{
@@ -380,3 +385,573 @@ func TestFinalizeBasic(t *testing.T) {
 	err = ndb.Finalize(ctx, []node.Root{root2})
 	require.Errorf(err, "mkvs: root not found", "Finalize({root2-broken})")
 }
+
+func TestCacheSizes(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "mkvs.badger.cache")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dir)
+
+	cfg := *dbCfg
+	cfg.MemoryOnly = false
+	cfg.DB = dir
+	cfg.BlockCacheSize = 1024 * 1024
+	cfg.IndexCacheSize = 1024 * 1024
+
+	// Invalid cache configurations should be rejected.
+	invalidCfg := cfg
+	invalidCfg.BlockCacheSize = -1
+	_, err = New(&invalidCfg)
+	require.ErrorIs(err, api.ErrInvalidCacheSize, "New() should fail with a negative block cache size")
+	invalidCfg = *dbCfg
+	invalidCfg.IndexCacheSize = 1024 * 1024
+	_, err = New(&invalidCfg)
+	require.ErrorIs(err, api.ErrInvalidCacheSize, "New() should fail with an index cache on a memory-only database")
+
+	ndb, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	root := fillDB(ctx, require, testValues, nil, 1, 2, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root})
+	require.NoError(err, "Finalize({root})")
+
+	var data [][][]byte
+	for i, val := range testValues {
+		data = append(data, [][]byte{[]byte(strconv.Itoa(i)), val})
+	}
+	checkContents(ctx, t, ndb, root, data)
+
+	stats := ndb.CacheStats()
+	require.EqualValues(cfg.BlockCacheSize, stats.BlockCacheSize, "reported block cache size")
+	require.EqualValues(cfg.IndexCacheSize, stats.IndexCacheSize, "reported index cache size")
+	require.True(stats.BlockCacheUsed <= stats.BlockCacheSize, "block cache usage should be within limits")
+	require.True(stats.IndexCacheUsed <= stats.IndexCacheSize, "index cache usage should be within limits")
+
+	// Cache statistics should be exported as metrics.
+	blockLabels := prometheus.Labels{"namespace": testNs.String(), "cache": "block"}
+	indexLabels := prometheus.Labels{"namespace": testNs.String(), "cache": "index"}
+	require.EqualValues(cfg.BlockCacheSize, testutil.ToFloat64(cacheSize.With(blockLabels)), "block cache size gauge")
+	require.EqualValues(cfg.IndexCacheSize, testutil.ToFloat64(cacheSize.With(indexLabels)), "index cache size gauge")
+	require.True(testutil.ToFloat64(cacheUsed.With(blockLabels)) <= float64(stats.BlockCacheSize), "block cache usage gauge")
+
+	// Badger does not support resizing caches at runtime.
+	err = ndb.ResizeCaches(-1, 0)
+	require.ErrorIs(err, api.ErrInvalidCacheSize, "ResizeCaches should fail with a negative size")
+	err = ndb.ResizeCaches(16*1024*1024, 16*1024*1024)
+	require.ErrorIs(err, api.ErrNotSupported, "ResizeCaches")
+
+	stats = ndb.CacheStats()
+	require.EqualValues(cfg.BlockCacheSize, stats.BlockCacheSize, "block cache size should be unchanged")
+	require.EqualValues(cfg.IndexCacheSize, stats.IndexCacheSize, "index cache size should be unchanged")
+	checkContents(ctx, t, ndb, root, data)
+
+	// A default block cache should be used when none is configured.
+	ndb.Close()
+	cfg.BlockCacheSize = 0
+	ndb, err = New(&cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+	require.EqualValues(defaultBlockCacheSize, ndb.CacheStats().BlockCacheSize, "default block cache size")
+	checkContents(ctx, t, ndb, root, data)
+}
+
+func TestLegacyNodeEncoding(t *testing.T) {
+	// The test case contains a tree written before node encoding versioning was introduced.
+	ctx, ndb, bdb, tc := makeDB(t, "case-legacy-encoding.json")
+	defer ndb.Close()
+	require := require.New(t)
+
+	err := bdb.load()
+	require.NoError(err, "load")
+
+	root1 := node.Root{
+		Namespace: testNs,
+		Version:   tc.PendingVersion,
+		Type:      node.RootTypeState,
+		Hash:      tc.PendingRoot,
+	}
+	var legacyData [][][]byte
+	for i, val := range testValues {
+		legacyData = append(legacyData, [][]byte{[]byte(strconv.Itoa(i)), val})
+	}
+	checkContents(ctx, t, ndb, root1, legacyData)
+
+	// Nodes written after versioning was introduced should use the versioned encoding and
+	// co-exist with the legacy nodes.
+	values2 := append(append([][]byte{}, testValues...), []byte("versioned"))
+	root2 := fillDB(ctx, require, values2, &root1, 1, 2, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root2})
+	require.NoError(err, "Finalize({root2})")
+
+	txn := bdb.db.NewTransactionAt(versionToTs(root2.Version), false)
+	defer txn.Discard()
+	item, err := txn.Get(nodeKeyFmt.Encode(&root2.Hash))
+	require.NoError(err, "Get(root2)")
+	err = item.Value(func(val []byte) error {
+		require.Equal(node.PrefixVersionedNode, val[0], "new nodes should use the versioned encoding")
+		require.EqualValues(node.LatestEncodingVersion, val[1], "new nodes should use the latest encoding version")
+		return nil
+	})
+	require.NoError(err, "Value")
+
+	var data2 [][][]byte
+	for i, val := range values2 {
+		data2 = append(data2, [][]byte{[]byte(strconv.Itoa(i)), val})
+	}
+	checkContents(ctx, t, ndb, root2, data2)
+	checkContents(ctx, t, ndb, root1, legacyData)
+}
+
+func TestWriteLogRetention(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	ndb, err := New(dbCfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	emptyRoot := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+	}
+	emptyRoot.Hash.Empty()
+
+	commit := func(prevRoot node.Root, version uint64, wl writelog.WriteLog) node.Root {
+		tree := mkvs.NewWithRoot(nil, ndb, prevRoot)
+		defer tree.Close()
+
+		err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog()")
+		_, rootHash, err := tree.Commit(ctx, testNs, version)
+		require.NoError(err, "Commit()")
+
+		root := node.Root{
+			Namespace: testNs,
+			Version:   version,
+			Type:      node.RootTypeState,
+			Hash:      rootHash,
+		}
+		err = ndb.Finalize(ctx, []node.Root{root})
+		require.NoError(err, "Finalize()")
+		return root
+	}
+
+	root0 := commit(emptyRoot, 0, writelog.WriteLog{
+		{Key: []byte("key 1"), Value: []byte("one")},
+		{Key: []byte("key 2"), Value: []byte("two")},
+		{Key: []byte("key 3"), Value: []byte("three")},
+	})
+	root1 := commit(root0, 1, writelog.WriteLog{
+		{Key: []byte("key 1"), Value: []byte("uno")},
+		{Key: []byte("key 2"), Value: nil},
+	})
+
+	// Prune nodes for version 0 while keeping its write log.
+	err = ndb.PruneNodes(ctx, 0)
+	require.NoError(err, "PruneNodes(0)")
+
+	earliest, err := ndb.GetEarliestVersion(ctx)
+	require.NoError(err, "GetEarliestVersion()")
+	require.EqualValues(1, earliest, "nodes should be pruned")
+	earliest, err = ndb.GetEarliestWriteLogVersion(ctx)
+	require.NoError(err, "GetEarliestWriteLogVersion()")
+	require.EqualValues(0, earliest, "write logs should be retained")
+
+	require.False(ndb.HasRoot(root0), "pruned root should not exist")
+	tree := mkvs.NewWithRoot(nil, ndb, root0)
+	_, err = tree.Get(ctx, []byte("key 1"))
+	require.ErrorIs(err, api.ErrNodeNotFound, "reading a pruned root should fail")
+	tree.Close()
+
+	// The retained write log should be replayable onto a fresh tree.
+	it, err := ndb.GetWriteLog(ctx, emptyRoot, root0)
+	require.NoError(err, "GetWriteLog() for a pruned version")
+	tree = mkvs.New(nil, nil, node.RootTypeState)
+	err = tree.ApplyWriteLog(ctx, it)
+	require.NoError(err, "ApplyWriteLog()")
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit()")
+	require.Equal(root0.Hash, rootHash, "replayed write log should result in the same root")
+	tree.Close()
+
+	// Write logs for version 0 need to be pruned first.
+	err = ndb.Prune(ctx, 1)
+	require.ErrorIs(err, api.ErrNotEarliest, "Prune(1) should fail while earlier write logs are retained")
+	err = ndb.PruneWriteLogs(ctx, 1)
+	require.ErrorIs(err, api.ErrNotEarliest, "PruneWriteLogs(1) should fail")
+
+	err = ndb.PruneWriteLogs(ctx, 0)
+	require.NoError(err, "PruneWriteLogs(0)")
+	_, err = ndb.GetWriteLog(ctx, emptyRoot, root0)
+	require.ErrorIs(err, api.ErrWriteLogNotFound, "GetWriteLog() for a pruned write log should fail")
+
+	// Write logs can also be pruned ahead of the nodes.
+	_, err = ndb.GetWriteLog(ctx, root0, root1)
+	require.NoError(err, "GetWriteLog() before pruning")
+	err = ndb.PruneWriteLogs(ctx, 1)
+	require.NoError(err, "PruneWriteLogs(1)")
+	_, err = ndb.GetWriteLog(ctx, root0, root1)
+	require.ErrorIs(err, api.ErrWriteLogNotFound, "GetWriteLog() for a pruned write log should fail")
+	require.True(ndb.HasRoot(root1), "root should be retained when only pruning write logs")
+
+	err = ndb.Prune(ctx, 1)
+	require.NoError(err, "Prune(1)")
+	require.False(ndb.HasRoot(root1), "pruned root should not exist")
+	earliest, err = ndb.GetEarliestWriteLogVersion(ctx)
+	require.NoError(err, "GetEarliestWriteLogVersion()")
+	require.EqualValues(2, earliest, "earliest write log version should be correct")
+}
+
+func TestNodeKeySharding(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newOpenCheckTest(t)
+	cfg.NodeKeyShards = 16
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	root := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root})
+	require.NoError(err, "Finalize({root})")
+
+	// All nodes should be stored under the sharded prefixes.
+	require.Empty(nodeKeys(require, ndb), "no nodes should be stored under the unsharded prefix")
+	shards := make(map[uint8]bool)
+	err = ndb.(*badgerNodeDB).db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: shardedNodeKeyFmt.Encode()})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var (
+				shard uint8
+				h     hash.Hash
+			)
+			require.True(shardedNodeKeyFmt.Decode(it.Item().Key(), &shard, &h), "node key should decode")
+			require.EqualValues(h[0]%16, shard, "node should be stored in the correct shard")
+			shards[shard] = true
+		}
+		return nil
+	})
+	require.NoError(err, "View")
+	require.Greater(len(shards), 1, "nodes should be distributed across shards")
+	ndb.Close()
+
+	// Opening with a different number of shards should fail.
+	for _, nodeKeyShards := range []int{0, 1, 8} {
+		otherCfg := *cfg
+		otherCfg.NodeKeyShards = nodeKeyShards
+		_, err = New(&otherCfg)
+		require.Error(err, "New() with %d shards should fail", nodeKeyShards)
+		require.Contains(err.Error(), "incompatible number of node key shards")
+	}
+
+	// Invalid number of shards should be rejected.
+	invalidCfg := *cfg
+	invalidCfg.NodeKeyShards = api.MaxNodeKeyShards + 1
+	_, err = New(&invalidCfg)
+	require.Error(err, "New() with too many shards should fail")
+
+	ndb, err = New(cfg)
+	require.NoError(err, "New() with the same number of shards")
+	defer ndb.Close()
+
+	var data [][][]byte
+	for i, val := range testValues {
+		data = append(data, [][]byte{[]byte(strconv.Itoa(i)), val})
+	}
+	checkContents(ctx, t, ndb, root, data)
+}
+
+func TestRootTypes(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	ndb, err := New(dbCfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	emptyRoot := func(version uint64, typ node.RootType) node.Root {
+		root := node.Root{
+			Namespace: testNs,
+			Version:   version,
+			Type:      typ,
+		}
+		root.Hash.Empty()
+		return root
+	}
+	commit := func(prevRoot node.Root, version uint64, wl writelog.WriteLog) node.Root {
+		tree := mkvs.NewWithRoot(nil, ndb, prevRoot)
+		defer tree.Close()
+
+		err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog()")
+		_, rootHash, err := tree.Commit(ctx, testNs, version)
+		require.NoError(err, "Commit()")
+
+		return node.Root{
+			Namespace: testNs,
+			Version:   version,
+			Type:      prevRoot.Type,
+			Hash:      rootHash,
+		}
+	}
+	asType := func(root node.Root, typ node.RootType) node.Root {
+		root.Type = typ
+		return root
+	}
+	requireValues := func(root node.Root, values map[string]string) {
+		tree := mkvs.NewWithRoot(nil, ndb, root)
+		defer tree.Close()
+
+		for key, value := range values {
+			v, err := tree.Get(ctx, []byte(key))
+			require.NoError(err, "Get()")
+			require.EqualValues(value, v, "value should be correct")
+		}
+	}
+
+	// Commit mixed-type roots in the same versions. The I/O roots share some nodes with the state
+	// roots as they contain identical entries.
+	state0 := commit(emptyRoot(0, node.RootTypeState), 0, writelog.WriteLog{
+		{Key: []byte("shared"), Value: []byte("value")},
+		{Key: []byte("state"), Value: []byte("state 0")},
+	})
+	io0 := commit(emptyRoot(0, node.RootTypeIO), 0, writelog.WriteLog{
+		{Key: []byte("shared"), Value: []byte("value")},
+		{Key: []byte("io"), Value: []byte("io 0")},
+	})
+	require.Equal(io0.Hash, commit(emptyRoot(0, node.RootTypeIO), 0, writelog.WriteLog{
+		{Key: []byte("io"), Value: []byte("io 0")},
+		{Key: []byte("shared"), Value: []byte("value")},
+	}).Hash, "recommitting the same root should result in the same hash")
+
+	// Roots only exist under their own type.
+	require.True(ndb.HasRoot(state0), "state root should exist")
+	require.True(ndb.HasRoot(io0), "I/O root should exist")
+	require.False(ndb.HasRoot(asType(state0, node.RootTypeIO)), "state root should not exist as an I/O root")
+	require.False(ndb.HasRoot(asType(io0, node.RootTypeState)), "I/O root should not exist as a state root")
+
+	_, err = ndb.GetNode(asType(io0, node.RootTypeState), &node.Pointer{Clean: true, Hash: io0.Hash})
+	require.ErrorIs(err, api.ErrRootTypeMismatch, "GetNode() with a mismatched root type should fail")
+	require.ErrorIs(err, api.ErrRootNotFound, "root type mismatch should also be a missing root")
+	var rtErr *api.RootTypeMismatchError
+	require.True(errors.As(err, &rtErr), "error should be a RootTypeMismatchError")
+	require.Equal(node.RootTypeIO, rtErr.StoredType, "error should report the stored root type")
+
+	_, err = ndb.GetWriteLog(ctx, emptyRoot(0, node.RootTypeState), asType(io0, node.RootTypeState))
+	require.ErrorIs(err, api.ErrRootTypeMismatch, "GetWriteLog() with a mismatched root type should fail")
+
+	err = ndb.Finalize(ctx, []node.Root{state0, asType(io0, node.RootTypeState)})
+	require.ErrorIs(err, api.ErrRootTypeMismatch, "Finalize() with a mismatched root type should fail")
+	err = ndb.Finalize(ctx, []node.Root{state0, io0})
+	require.NoError(err, "Finalize()")
+
+	state1 := commit(state0, 1, writelog.WriteLog{
+		{Key: []byte("state"), Value: []byte("state 1")},
+	})
+	io1 := commit(emptyRoot(1, node.RootTypeIO), 1, writelog.WriteLog{
+		{Key: []byte("io"), Value: []byte("io 1")},
+	})
+	err = ndb.Finalize(ctx, []node.Root{state1, io1})
+	require.NoError(err, "Finalize()")
+
+	// Prune I/O roots ahead of state roots.
+	err = ndb.PruneRootType(ctx, 0, node.RootTypeInvalid)
+	require.Error(err, "PruneRootType() with an invalid root type should fail")
+	err = ndb.PruneRootType(ctx, 2, node.RootTypeIO)
+	require.ErrorIs(err, api.ErrNotFinalized, "PruneRootType() of a non-finalized version should fail")
+
+	err = ndb.PruneRootType(ctx, 0, node.RootTypeIO)
+	require.NoError(err, "PruneRootType(0, io)")
+	err = ndb.PruneRootType(ctx, 1, node.RootTypeIO)
+	require.NoError(err, "PruneRootType(1, io)")
+
+	require.False(ndb.HasRoot(io0), "pruned I/O root should not exist")
+	require.False(ndb.HasRoot(io1), "pruned I/O root should not exist")
+	_, err = ndb.GetWriteLog(ctx, emptyRoot(0, node.RootTypeIO), io0)
+	require.ErrorIs(err, api.ErrRootNotFound, "GetWriteLog() for a pruned I/O root should fail")
+
+	roots, err := ndb.GetRootsForVersion(ctx, 0)
+	require.NoError(err, "GetRootsForVersion()")
+	require.Equal([]node.Root{state0}, roots, "only the state root should be retained")
+
+	// State roots should be intact, including nodes shared with the pruned I/O roots.
+	require.True(ndb.HasRoot(state0), "state root should be retained")
+	require.NoError(ndb.HasAllNodes(ctx, state0), "all state root nodes should be retained")
+	require.NoError(ndb.HasAllNodes(ctx, state1), "all state root nodes should be retained")
+	requireValues(state0, map[string]string{"shared": "value", "state": "state 0"})
+	requireValues(state1, map[string]string{"shared": "value", "state": "state 1"})
+	_, err = ndb.GetWriteLog(ctx, emptyRoot(0, node.RootTypeState), state0)
+	require.NoError(err, "GetWriteLog() for a retained state root")
+
+	// State roots can be pruned afterwards as usual.
+	err = ndb.Prune(ctx, 0)
+	require.NoError(err, "Prune(0)")
+	require.False(ndb.HasRoot(state0), "pruned state root should not exist")
+	requireValues(state1, map[string]string{"shared": "value", "state": "state 1"})
+
+	err = ndb.PruneRootType(ctx, 0, node.RootTypeState)
+	require.ErrorIs(err, api.ErrVersionNotFound, "PruneRootType() of a pruned version should fail")
+}
+
+func TestCommitIdempotentKeys(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	ndb, err := New(dbCfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+	badgerdb := ndb.(*badgerNodeDB)
+
+	// countKeys counts all stored key versions, including metadata.
+	countKeys := func() int {
+		tx := badgerdb.db.NewTransactionAt(maxTimestamp, false)
+		defer tx.Discard()
+		it := tx.NewIterator(badger.IteratorOptions{AllVersions: true})
+		defer it.Close()
+
+		var n int
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return n
+	}
+	commit := func(version uint64, wl writelog.WriteLog) node.Root {
+		root := node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState}
+		root.Hash.Empty()
+		tree := mkvs.NewWithRoot(nil, ndb, root)
+		defer tree.Close()
+
+		err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog()")
+		_, root.Hash, err = tree.Commit(ctx, testNs, version)
+		require.NoError(err, "Commit()")
+		return root
+	}
+
+	wl := writelog.WriteLog{
+		{Key: []byte("foo"), Value: []byte("bar")},
+		{Key: []byte("moo"), Value: []byte("boo")},
+	}
+	root := commit(0, wl)
+	numKeys := countKeys()
+
+	require.Equal(root, commit(0, wl), "recommitting the same root should result in the same root")
+	require.Equal(numKeys, countKeys(), "recommitting a non-finalized root should not store any keys")
+
+	err = ndb.Finalize(ctx, []node.Root{root})
+	require.NoError(err, "Finalize()")
+	numKeys = countKeys()
+
+	require.Equal(root, commit(0, wl), "recommitting the same root should result in the same root")
+	require.Equal(numKeys, countKeys(), "recommitting a finalized root should not store any keys")
+}
+
+func TestConcurrentCommits(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	ndb, err := New(dbCfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+	badgerdb := ndb.(*badgerNodeDB)
+
+	const (
+		numTrees = 16
+		numKeys  = 64
+	)
+	key := func(tree, i int) []byte {
+		return []byte(fmt.Sprintf("tree %02d key %03d", tree, i))
+	}
+	value := func(tree, i int) []byte {
+		return []byte(fmt.Sprintf("tree %02d value %03d", tree, i))
+	}
+
+	baseRoot := fillDB(ctx, require, testValues, nil, 0, 0, ndb)
+	baseRoot.Version = 0
+	err = ndb.Finalize(ctx, []node.Root{baseRoot})
+	require.NoError(err, "Finalize()")
+
+	// Commit independent trees derived from the same root into the same version in parallel.
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	roots := make([]node.Root, numTrees)
+	errCh := make(chan error, numTrees)
+	for w := 0; w < numTrees; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			tree := mkvs.NewWithRoot(nil, ndb, baseRoot)
+			defer tree.Close()
+
+			for i := 0; i < numKeys; i++ {
+				if err := tree.Insert(ctx, key(w, i), value(w, i)); err != nil {
+					errCh <- err
+					return
+				}
+			}
+
+			<-start
+			_, rootHash, err := tree.Commit(ctx, testNs, 1)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			roots[w] = node.Root{Namespace: testNs, Version: 1, Type: node.RootTypeState, Hash: rootHash}
+		}(w)
+	}
+	close(start)
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(err, "concurrent commits should succeed")
+	}
+
+	// All roots should have been registered and linked to the base root.
+	tx := badgerdb.db.NewTransactionAt(versionToTs(0), false)
+	defer tx.Discard()
+	rootsMeta, err := loadRootsMetadata(tx, 0)
+	require.NoError(err, "loadRootsMetadata()")
+	require.Len(rootsMeta.Roots[typedHashFromRoot(baseRoot)], numTrees, "all roots should be derived from the base root")
+	rootsMeta, err = loadRootsMetadata(tx, 1)
+	require.NoError(err, "loadRootsMetadata()")
+	require.Len(rootsMeta.Roots, numTrees, "all roots should be registered")
+	requireStorage(require, ndb)
+
+	err = ndb.Finalize(ctx, roots)
+	require.NoError(err, "Finalize()")
+	requireStorage(require, ndb)
+
+	for w, root := range roots {
+		require.True(ndb.HasRoot(root), "finalized root %d should exist", w)
+
+		tree := mkvs.NewWithRoot(nil, ndb, root)
+		for i := 0; i < numKeys; i++ {
+			v, err := tree.Get(ctx, key(w, i))
+			require.NoError(err, "Get()")
+			require.Equal(value(w, i), v, "root %d should contain its own values", w)
+		}
+		v, err := tree.Get(ctx, key((w+1)%numTrees, 0))
+		require.NoError(err, "Get()")
+		require.Nil(v, "root %d should not contain values of other roots", w)
+		tree.Close()
+
+		it, err := ndb.GetWriteLog(ctx, baseRoot, root)
+		require.NoError(err, "GetWriteLog()")
+		var n int
+		for {
+			more, err := it.Next()
+			require.NoError(err, "it.Next()")
+			if !more {
+				break
+			}
+			n++
+		}
+		require.Equal(numKeys, n, "write log of root %d should contain all of its entries", w)
+	}
+}
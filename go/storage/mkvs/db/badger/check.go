@@ -106,6 +106,19 @@ func checkSanityInternal(ctx context.Context, db *badgerNodeDB, display DisplayH
 	}
 	totalVersions := lastVersion - firstVersion + 1
 
+	// Write logs may have been pruned independently of the roots.
+	var meta metadata
+	item, err := txn.Get(metadataKeyFmt.Encode())
+	if err != nil {
+		return fmt.Errorf("mkvs/badger/check: failed to load metadata: %w", err)
+	}
+	if err = item.Value(func(val []byte) error {
+		return cbor.Unmarshal(val, &meta.value)
+	}); err != nil {
+		return fmt.Errorf("mkvs/badger/check: failed to decode metadata: %w", err)
+	}
+	earliestWriteLogVersion := meta.getEarliestWriteLogVersion()
+
 	// Check versions.
 	itOpts := badger.DefaultIteratorOptions
 	itOpts.Reverse = true
@@ -143,6 +156,7 @@ func checkSanityInternal(ctx context.Context, db *badgerNodeDB, display DisplayH
 
 			root := node.Root{
 				Namespace: db.namespace,
+				HashMode:  db.hashMode,
 				Version:   version,
 				Type:      rootHash.Type(),
 				Hash:      rootHash.Hash(),
@@ -162,7 +176,7 @@ func checkSanityInternal(ctx context.Context, db *badgerNodeDB, display DisplayH
 				if !ok {
 					return fmt.Errorf("mkvs/badger/check: missing target root (%s -> %s)", rootHash, dstRoot)
 				}
-				if !dstRoot.Equal(&rootHash) {
+				if !dstRoot.Equal(&rootHash) && dstVersion >= earliestWriteLogVersion {
 					_, err = txn.Get(writeLogKeyFmt.Encode(dstVersion, &dstRoot, &rootHash)) //nolint: gosec
 					if err != nil {
 						return fmt.Errorf("mkvs/badger/check: missing write log (%d, %s, %s)", dstVersion, dstRoot, rootHash)
@@ -0,0 +1,297 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+var errSimulatedCrash = errors.New("simulated crash")
+
+// nodeKeys returns the set of all node keys currently present in the database.
+func nodeKeys(require *require.Assertions, ndb api.NodeDB) keySet {
+	keys := make(keySet)
+	err := ndb.(*badgerNodeDB).db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: nodePrefix})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys[string(it.Item().KeyCopy(nil))] = struct{}{}
+		}
+		return nil
+	})
+	require.NoError(err, "nodeKeys()")
+	return keys
+}
+
+// prepareFinalize creates a database with a finalized version followed by an unfinalized version
+// with two roots, one of which should be kept and one discarded.
+func prepareFinalize(ctx context.Context, require *require.Assertions, cfg *api.Config) (api.NodeDB, node.Root, node.Root) {
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	root1 := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(err, "Finalize({root1})")
+
+	keepValues := append(append([][]byte{}, testValues...), []byte("kept"))
+	discardValues := append(append([][]byte{}, testValues...), []byte("discarded"))
+	keptRoot := fillDB(ctx, require, keepValues, &root1, 1, 2, ndb)
+	discardedRoot := fillDB(ctx, require, discardValues, &root1, 1, 2, ndb)
+
+	return ndb, keptRoot, discardedRoot
+}
+
+func TestFinalizeIdempotent(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	ndb, keptRoot, discardedRoot := prepareFinalize(ctx, require, dbCfg)
+	defer ndb.Close()
+
+	err := ndb.Finalize(ctx, []node.Root{keptRoot})
+	require.NoError(err, "Finalize({keptRoot})")
+	keys := nodeKeys(require, ndb)
+
+	// Finalizing with the same set of roots should succeed without changing anything.
+	err = ndb.Finalize(ctx, []node.Root{keptRoot})
+	require.NoError(err, "Finalize({keptRoot}) again")
+	err = ndb.FinalizeWithFilter(ctx, keptRoot.Version, func(node.Root) bool { return true })
+	require.NoError(err, "FinalizeWithFilter(all) again")
+	require.Equal(keys, nodeKeys(require, ndb), "repeated finalization should not change nodes")
+	require.True(ndb.HasRoot(keptRoot), "finalized root should be kept")
+
+	// Finalizing with a different set of roots should fail.
+	err = ndb.Finalize(ctx, []node.Root{discardedRoot})
+	require.ErrorIs(err, api.ErrAlreadyFinalized, "Finalize({discardedRoot})")
+	err = ndb.Finalize(ctx, []node.Root{keptRoot, discardedRoot})
+	require.ErrorIs(err, api.ErrAlreadyFinalized, "Finalize({keptRoot, discardedRoot})")
+	err = ndb.FinalizeWithFilter(ctx, keptRoot.Version, func(node.Root) bool { return false })
+	require.ErrorIs(err, api.ErrAlreadyFinalized, "FinalizeWithFilter(none)")
+}
+
+func TestFinalizeCrashRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	// Determine the expected state after a finalization which was not interrupted.
+	require, cfg := newOpenCheckTest(t)
+	ndb, keptRoot, discardedRoot := prepareFinalize(ctx, require, cfg)
+	err := ndb.Finalize(ctx, []node.Root{keptRoot})
+	require.NoError(err, "Finalize({keptRoot})")
+	expectedKeys := nodeKeys(require, ndb)
+	ndb.Close()
+
+	for _, step := range []finalizeStep{
+		finalizeStepJournal,
+		finalizeStepNodes,
+		finalizeStepMetadata,
+	} {
+		t.Run(fmt.Sprintf("Step%d", step), func(t *testing.T) {
+			require, cfg := newOpenCheckTest(t)
+			ndb, keptRoot, discardedRoot := prepareFinalize(ctx, require, cfg)
+
+			// Simulate a crash after the given finalization step.
+			ndb.(*badgerNodeDB).finalizeHook = func(s finalizeStep) error {
+				if s == step {
+					return errSimulatedCrash
+				}
+				return nil
+			}
+			err := ndb.Finalize(ctx, []node.Root{keptRoot})
+			require.ErrorIs(err, errSimulatedCrash, "Finalize({keptRoot}) should be interrupted")
+			ndb.Close()
+
+			// The interrupted finalization should be completed on reopen, without needing to
+			// repair anything.
+			strictCfg := *cfg
+			strictCfg.StrictOpen = true
+			ndb, err = New(&strictCfg)
+			require.NoError(err, "New()")
+			defer ndb.Close()
+
+			require.False(hasMetaKey(require, ndb, finalizeJournalKeyFmt.Encode()), "journal should be removed")
+			lastFinalizedVersion, exists := ndb.(*badgerNodeDB).meta.getLastFinalizedVersion()
+			require.True(exists, "version should be finalized")
+			require.EqualValues(keptRoot.Version, lastFinalizedVersion, "last finalized version")
+			require.True(ndb.HasRoot(keptRoot), "finalized root should be kept")
+			require.False(ndb.HasRoot(discardedRoot), "non-finalized root should be discarded")
+			require.Equal(expectedKeys, nodeKeys(require, ndb), "nodes should match uninterrupted finalization")
+
+			tree := mkvs.NewWithRoot(nil, ndb, keptRoot)
+			defer tree.Close()
+			value, err := tree.Get(ctx, []byte("3"))
+			require.NoError(err, "Get")
+			require.Equal([]byte("kept"), value, "finalized root should be readable")
+
+			// Retrying the finalization after recovery should be a no-op.
+			err = ndb.Finalize(ctx, []node.Root{keptRoot})
+			require.NoError(err, "Finalize({keptRoot}) after recovery")
+			err = ndb.Finalize(ctx, []node.Root{discardedRoot})
+			require.ErrorIs(err, api.ErrAlreadyFinalized, "Finalize({discardedRoot}) after recovery")
+		})
+	}
+
+	// An interrupted finalization should also be completed before the next finalization without
+	// reopening the database.
+	require, cfg = newOpenCheckTest(t)
+	ndb, keptRoot, discardedRoot = prepareFinalize(ctx, require, cfg)
+	defer ndb.Close()
+
+	ndb.(*badgerNodeDB).finalizeHook = func(s finalizeStep) error {
+		if s == finalizeStepNodes {
+			return errSimulatedCrash
+		}
+		return nil
+	}
+	err = ndb.Finalize(ctx, []node.Root{keptRoot})
+	require.ErrorIs(err, errSimulatedCrash, "Finalize({keptRoot}) should be interrupted")
+	ndb.(*badgerNodeDB).finalizeHook = nil
+
+	// Retrying with a different set of roots should not be able to override the journal.
+	err = ndb.Finalize(ctx, []node.Root{discardedRoot})
+	require.ErrorIs(err, api.ErrAlreadyFinalized, "Finalize({discardedRoot}) after interruption")
+	require.True(ndb.HasRoot(keptRoot), "finalized root should be kept")
+	require.False(ndb.HasRoot(discardedRoot), "non-finalized root should be discarded")
+	require.Equal(expectedKeys, nodeKeys(require, ndb), "nodes should match uninterrupted finalization")
+}
+
+func TestFinalizeNonFinalizedVersions(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newOpenCheckTest(t)
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	requireNonFinalized := func(ndb api.NodeDB, expected []api.NonFinalizedVersion) {
+		versions, err := ndb.NonFinalizedVersions(ctx)
+		require.NoError(err, "NonFinalizedVersions")
+		require.Equal(expected, versions, "NonFinalizedVersions")
+
+		var numRoots uint64
+		for _, v := range expected {
+			numRoots += v.NumRoots
+		}
+		labels := prometheus.Labels{"namespace": testNs.String()}
+		require.EqualValues(len(expected), testutil.ToFloat64(nonFinalizedVersions.With(labels)), "non-finalized versions gauge")
+		require.EqualValues(numRoots, testutil.ToFloat64(nonFinalizedRoots.With(labels)), "non-finalized roots gauge")
+	}
+	requireNonFinalized(ndb, []api.NonFinalizedVersion{})
+
+	// Commit two roots into version 3 and one root into version 4.
+	values3 := append(append([][]byte{}, testValues...), []byte("version three"))
+	root3a := fillDB(ctx, require, testValues, nil, 2, 3, ndb)
+	root3b := fillDB(ctx, require, values3, nil, 2, 3, ndb)
+	values4 := append(append([][]byte{}, testValues...), []byte("version four"))
+	root4 := fillDB(ctx, require, values4, &root3a, 3, 4, ndb)
+
+	expected := []api.NonFinalizedVersion{
+		{Version: 3, NumRoots: 2},
+		{Version: 4, NumRoots: 1},
+	}
+	requireNonFinalized(ndb, expected)
+
+	// Committing an existing root again should not change anything.
+	_ = fillDB(ctx, require, testValues, nil, 2, 3, ndb)
+	requireNonFinalized(ndb, expected)
+	ndb.Close()
+
+	// Non-finalized versions should be tracked across restarts.
+	ndb, err = New(cfg)
+	require.NoError(err, "New()")
+	requireNonFinalized(ndb, expected)
+
+	// Databases which do not track non-finalized versions yet should derive them on open.
+	corruptMetadata(require, ndb, func(meta *serializedMetadata) {
+		meta.NonFinalizedRoots = nil
+	})
+	ndb.Close()
+	ndb, err = New(cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+	requireNonFinalized(ndb, expected)
+
+	err = ndb.Finalize(ctx, []node.Root{root3a})
+	require.NoError(err, "Finalize({root3a})")
+	require.False(ndb.HasRoot(root3b), "non-finalized root should be discarded")
+	requireNonFinalized(ndb, expected[1:])
+
+	err = ndb.Finalize(ctx, []node.Root{root4})
+	require.NoError(err, "Finalize({root4})")
+	requireNonFinalized(ndb, []api.NonFinalizedVersion{})
+}
+
+func TestFinalizeDiscardedFlushedNodes(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	// Flush after every node so that discarded batches leave nodes behind.
+	cfg := *dbCfg
+	cfg.BatchFlushThreshold = 1
+	ndb, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	// discard commits a tree derived from the given root at the given version, but discards the
+	// batch after all nodes have been written.
+	discard := func(root node.Root, version uint64, value []byte) {
+		tree := mkvs.NewWithRoot(nil, ndb, root)
+		defer tree.Close()
+		err := tree.Insert(ctx, []byte("discarded"), value)
+		require.NoError(err, "Insert()")
+		_, err = tree.CommitKnown(ctx, node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState})
+		require.ErrorIs(err, mkvs.ErrKnownRootMismatch, "CommitKnown()")
+	}
+
+	// flushed discards a batch and returns the keys of the nodes it left behind.
+	flushed := func(root node.Root, version uint64, value []byte) keySet {
+		before := nodeKeys(require, ndb)
+		discard(root, version, value)
+		keys := make(keySet)
+		for key := range nodeKeys(require, ndb) {
+			if _, ok := before[key]; !ok {
+				keys[key] = struct{}{}
+			}
+		}
+		return keys
+	}
+	// requireRemoved makes sure that none of the given keys exist.
+	requireRemoved := func(keys keySet, msg string) {
+		current := nodeKeys(require, ndb)
+		for key := range keys {
+			require.NotContains(current, key, msg)
+		}
+	}
+
+	root1 := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(err, "Finalize({root1})")
+	keptRoot := fillDB(ctx, require, append(append([][]byte{}, testValues...), []byte("kept")), &root1, 1, 2, ndb)
+
+	// Nodes flushed by a discarded batch should be removed when the version is finalized.
+	keys := flushed(root1, 2, []byte("before finalization"))
+	require.NotEmpty(keys, "discarded batch should have flushed nodes")
+	err = ndb.Finalize(ctx, []node.Root{keptRoot})
+	require.NoError(err, "Finalize({keptRoot})")
+	requireRemoved(keys, "flushed nodes should be removed on finalization")
+
+	// Nodes flushed after the version has been finalized should be removed on reset.
+	keys = nodeKeys(require, ndb)
+	discard(root1, 2, []byte("after finalization"))
+	require.Equal(keys, nodeKeys(require, ndb), "flushed nodes should be removed on reset")
+
+	// The finalized root must remain intact.
+	tree := mkvs.NewWithRoot(nil, ndb, keptRoot)
+	defer tree.Close()
+	value, err := tree.Get(ctx, []byte("3"))
+	require.NoError(err, "Get()")
+	require.Equal([]byte("kept"), value, "finalized root should be readable")
+}
@@ -26,18 +26,26 @@ func tsToVersion(ts uint64) uint64 {
 	return ts - tsMetadata - 1
 }
 
+// defaultBlockCacheSize is the block cache size used when none is configured. A block cache is
+// always required as compression is enabled.
+const defaultBlockCacheSize = 64 * 1024 * 1024
+
+// blockCacheSize returns the effective block cache size for the given configuration.
+func blockCacheSize(cfg *api.Config) int64 {
+	if cfg.BlockCacheSize == 0 {
+		return defaultBlockCacheSize
+	}
+	return cfg.BlockCacheSize
+}
+
 // commonConfigToBadgerOptions prepares a badger option struct with common options.
 func commonConfigToBadgerOptions(cfg *api.Config, db *badgerNodeDB) badger.Options {
 	opts := badger.DefaultOptions(cfg.DB)
 	opts = opts.WithLogger(cmnBadger.NewLogAdapter(db.logger))
 	opts = opts.WithSyncWrites(!cfg.NoFsync)
 	opts = opts.WithCompression(options.Snappy)
-	if cfg.MaxCacheSize == 0 {
-		// Default to 64mb block cache size if not configured to avoid a panic.
-		opts = opts.WithBlockCacheSize(64 * 1024 * 1024)
-	} else {
-		opts = opts.WithBlockCacheSize(cfg.MaxCacheSize)
-	}
+	opts = opts.WithBlockCacheSize(blockCacheSize(cfg))
+	opts = opts.WithIndexCacheSize(cfg.IndexCacheSize)
 	opts = opts.WithReadOnly(cfg.ReadOnly)
 	opts = opts.WithDetectConflicts(false)
 
@@ -0,0 +1,255 @@
+package badger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// Implements api.NodeDB.
+func (d *badgerNodeDB) GetKeyFilter(ctx context.Context, root node.Root) (*api.KeyFilter, error) {
+	if err := d.sanityCheckRoot(root); err != nil {
+		return nil, err
+	}
+	if root.Version < d.meta.getEarliestVersion() {
+		return nil, api.ErrKeyFilterNotFound
+	}
+
+	tx := d.db.NewTransactionAt(versionToTs(root.Version), false)
+	defer tx.Discard()
+
+	// The filter covers all roots finalized in the version, so make sure that the root is one of
+	// them and not, e.g., a root of another type.
+	if err := d.checkRoot(tx, root); err != nil {
+		return nil, err
+	}
+
+	item, err := tx.Get(keyFilterKeyFmt.Encode(root.Version))
+	switch err {
+	case nil:
+	case badger.ErrKeyNotFound:
+		return nil, api.ErrKeyFilterNotFound
+	default:
+		return nil, fmt.Errorf("mkvs/badger: failed to get key filter: %w", err)
+	}
+
+	var kf *api.KeyFilter
+	if err = item.Value(func(val []byte) error {
+		var dErr error
+		kf, dErr = api.DecodeKeyFilter(val)
+		return dErr
+	}); err != nil {
+		// Filters which cannot be decoded (e.g., due to using a newer format) are ignored.
+		return nil, fmt.Errorf("%w: %s", api.ErrKeyFilterNotFound, err)
+	}
+	return kf, nil
+}
+
+// keyFilterWorker builds key filters of finalized versions in the background, so that building
+// them does not delay finalization.
+//
+// In case finalization outpaces the worker, only the latest finalized version is built and the
+// skipped versions remain without a key filter.
+type keyFilterWorker struct {
+	d *badgerNodeDB
+
+	l              sync.Mutex
+	pendingVersion uint64
+	hasPending     bool
+
+	notifyCh chan struct{}
+	cancel   context.CancelFunc
+	closedCh chan struct{}
+}
+
+func newKeyFilterWorker(d *badgerNodeDB) *keyFilterWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &keyFilterWorker{
+		d:        d,
+		notifyCh: make(chan struct{}, 1),
+		cancel:   cancel,
+		closedCh: make(chan struct{}),
+	}
+	go w.worker(ctx)
+	return w
+}
+
+// Close halts the key filter worker, abandoning any key filter being built.
+func (w *keyFilterWorker) Close() {
+	w.cancel()
+	<-w.closedCh
+}
+
+// schedule schedules building the key filter of the given finalized version.
+func (w *keyFilterWorker) schedule(version uint64) {
+	w.l.Lock()
+	if !w.hasPending || version > w.pendingVersion {
+		w.pendingVersion = version
+		w.hasPending = true
+	}
+	w.l.Unlock()
+
+	select {
+	case w.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (w *keyFilterWorker) worker(ctx context.Context) {
+	defer close(w.closedCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.notifyCh:
+		}
+
+		w.l.Lock()
+		version, ok := w.pendingVersion, w.hasPending
+		w.hasPending = false
+		w.l.Unlock()
+		if !ok {
+			continue
+		}
+
+		// Failing to build a key filter is not fatal as lookups in roots without a key filter
+		// traverse the tree as usual.
+		if err := w.d.buildKeyFilter(ctx, version); err != nil && ctx.Err() == nil {
+			w.d.logger.Warn("failed to build key filter",
+				"err", err,
+				"version", version,
+			)
+		}
+	}
+}
+
+// maybeBuildKeyFilter schedules building the key filter of the given finalized version in case
+// key filters are enabled.
+func (d *badgerNodeDB) maybeBuildKeyFilter(version uint64) {
+	if d.keyFilters == nil {
+		return
+	}
+	d.keyFilters.schedule(version)
+}
+
+// buildKeyFilter builds the key filter over the keys of all finalized roots of the given version
+// and stores it.
+//
+// The filter is built without holding any locks as it requires walking all finalized roots twice,
+// first to determine the number of keys and then to populate the filter. It is only called from
+// the key filter worker.
+func (d *badgerNodeDB) buildKeyFilter(ctx context.Context, version uint64) error {
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+
+	switch _, err := tx.Get(keyFilterKeyFmt.Encode(version)); err {
+	case nil:
+		// Key filter has already been built.
+		return nil
+	case badger.ErrKeyNotFound:
+	default:
+		return err
+	}
+
+	rootsMeta, err := loadRootsMetadata(tx, version)
+	if err != nil {
+		return err
+	}
+
+	var numKeys uint64
+	for rootHash := range rootsMeta.Roots {
+		if err = d.visitLeafKeys(ctx, tx, rootHash.Hash(), func([]byte) { numKeys++ }); err != nil {
+			return err
+		}
+	}
+	kf := api.NewKeyFilter(numKeys, d.keyFilterMaxSize)
+	for rootHash := range rootsMeta.Roots {
+		if err = d.visitLeafKeys(ctx, tx, rootHash.Hash(), kf.Add); err != nil {
+			return err
+		}
+	}
+	data := cbor.Marshal(kf)
+
+	d.metaUpdateLock.Lock()
+	defer d.metaUpdateLock.Unlock()
+
+	// Make sure the version has not been pruned in the meantime.
+	if version < d.meta.getEarliestVersion() {
+		return nil
+	}
+
+	metaTx := d.db.NewTransactionAt(tsMetadata, true)
+	defer metaTx.Discard()
+	if err = metaTx.Set(keyFilterKeyFmt.Encode(version), data); err != nil {
+		return err
+	}
+	if err = metaTx.CommitAt(tsMetadata, nil); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to commit key filter: %w", err)
+	}
+
+	d.logger.Debug("built key filter",
+		"version", version,
+		"num_keys", numKeys,
+		"size", kf.Size(),
+	)
+	return nil
+}
+
+// visitLeafKeys calls fn with the key of each leaf node of the tree with the given root hash.
+func (d *badgerNodeDB) visitLeafKeys(ctx context.Context, tx *badger.Txn, rootHash hash.Hash, fn func(key []byte)) error {
+	if rootHash.IsEmpty() {
+		return nil
+	}
+
+	stack := []hash.Hash{rootHash}
+	for len(stack) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		item, err := tx.Get(d.nodeKey(&h))
+		if err != nil {
+			return fmt.Errorf("mkvs/badger: failed to get node %s: %w", h, err)
+		}
+		var n node.Node
+		if err = item.Value(func(val []byte) error {
+			var vErr error
+			n, vErr = node.UnmarshalVersionedBinary(val)
+			return vErr
+		}); err != nil {
+			return fmt.Errorf("mkvs/badger: failed to unmarshal node: %w", err)
+		}
+
+		switch n := n.(type) {
+		case *node.LeafNode:
+			fn(n.Key)
+		case *node.InternalNode:
+			// The leaf node of an internal node is stored together with the internal node.
+			if n.LeafNode != nil {
+				if leaf, ok := n.LeafNode.Node.(*node.LeafNode); ok {
+					fn(leaf.Key)
+				}
+			}
+			for _, child := range []*node.Pointer{n.Right, n.Left} {
+				if child == nil || child.Hash.IsEmpty() {
+					continue
+				}
+				stack = append(stack, child.Hash)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+const keyFilterTestNumKeys = 100
+
+func keyFilterTestKey(i int) []byte {
+	return []byte(fmt.Sprintf("key %d", i))
+}
+
+func commitKeyFilterTestRoot(ctx context.Context, require *require.Assertions, ndb api.NodeDB, version uint64) node.Root {
+	var wl writelog.WriteLog
+	for i := 0; i < keyFilterTestNumKeys; i++ {
+		wl = append(wl, writelog.LogEntry{Key: keyFilterTestKey(i), Value: []byte(fmt.Sprintf("value %d", i))})
+	}
+
+	tree := mkvs.New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+	err := tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+	require.NoError(err, "ApplyWriteLog()")
+	_, rootHash, err := tree.Commit(ctx, testNs, version)
+	require.NoError(err, "Commit()")
+
+	root := node.Root{
+		Namespace: testNs,
+		Version:   version,
+		Type:      node.RootTypeState,
+		Hash:      rootHash,
+	}
+	err = ndb.Finalize(ctx, []node.Root{root})
+	require.NoError(err, "Finalize()")
+	return root
+}
+
+// waitKeyFilter waits for the key filter of the given root to be built in the background.
+func waitKeyFilter(ctx context.Context, require *require.Assertions, ndb api.NodeDB, root node.Root) *api.KeyFilter {
+	var kf *api.KeyFilter
+	require.Eventually(func() bool {
+		var err error
+		kf, err = ndb.GetKeyFilter(ctx, root)
+		return !errors.Is(err, api.ErrKeyFilterNotFound)
+	}, 10*time.Second, 10*time.Millisecond, "key filter should be built")
+	return kf
+}
+
+func TestKeyFilter(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	cfg := *dbCfg
+	cfg.KeyFilterMaxSize = 1024 * 1024
+	ndb, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	root := commitKeyFilterTestRoot(ctx, require, ndb, 0)
+
+	kf := waitKeyFilter(ctx, require, ndb, root)
+	require.NotNil(kf, "GetKeyFilter()")
+	for i := 0; i < keyFilterTestNumKeys; i++ {
+		require.True(kf.MayContain(keyFilterTestKey(i)), "key filter should contain all keys")
+	}
+
+	// Lookups of absent keys should not need any node reads.
+	tree := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	var skipped uint64
+	for i := keyFilterTestNumKeys; i < 2*keyFilterTestNumKeys; i++ {
+		key := keyFilterTestKey(i)
+		if kf.MayContain(key) {
+			// False positives are covered separately.
+			continue
+		}
+		skipped++
+
+		var value []byte
+		value, err = tree.Get(ctx, key)
+		require.NoError(err, "Get(absent)")
+		require.Nil(value, "absent key should not exist")
+	}
+	require.NotZero(skipped, "key filter should exclude absent keys")
+	stats := tree.CacheStats()
+	require.EqualValues(skipped, stats.KeyFilterSkips, "lookups excluded by the key filter should be skipped")
+	require.EqualValues(0, stats.NodeDBReads, "lookups of absent keys should not read any nodes")
+
+	// Lookups of existing keys should be unaffected.
+	for i := 0; i < keyFilterTestNumKeys; i++ {
+		var value []byte
+		value, err = tree.Get(ctx, keyFilterTestKey(i))
+		require.NoError(err, "Get(present)")
+		require.EqualValues(fmt.Sprintf("value %d", i), value, "existing key should have the correct value")
+	}
+
+	// The key filter should not be consulted for locally modified trees.
+	err = tree.Insert(ctx, []byte("new key"), []byte("new value"))
+	require.NoError(err, "Insert()")
+	value, err := tree.Get(ctx, []byte("new key"))
+	require.NoError(err, "Get(inserted)")
+	require.EqualValues("new value", value, "inserted key should exist")
+
+	// Pruning should remove the key filter.
+	root1 := commitKeyFilterTestRoot(ctx, require, ndb, 1)
+	_ = waitKeyFilter(ctx, require, ndb, root1)
+	err = ndb.Prune(ctx, 0)
+	require.NoError(err, "Prune(0)")
+	_, err = ndb.GetKeyFilter(ctx, root)
+	require.ErrorIs(err, api.ErrKeyFilterNotFound, "GetKeyFilter() for a pruned version should fail")
+	bdb := ndb.(*badgerNodeDB)
+	err = bdb.db.View(func(tx *badger.Txn) error {
+		_, gErr := tx.Get(keyFilterKeyFmt.Encode(uint64(0)))
+		return gErr
+	})
+	require.ErrorIs(err, badger.ErrKeyNotFound, "pruned key filter should be removed")
+}
+
+func TestKeyFilterFalsePositives(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	// A single byte filter is saturated by the keys of the root, so every lookup is a false
+	// positive.
+	cfg := *dbCfg
+	cfg.KeyFilterMaxSize = 1
+	ndb, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	root := commitKeyFilterTestRoot(ctx, require, ndb, 0)
+
+	kf := waitKeyFilter(ctx, require, ndb, root)
+	require.NotNil(kf, "GetKeyFilter()")
+	require.Equal(1, kf.Size(), "key filter size should be bounded")
+
+	tree := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	for i := keyFilterTestNumKeys; i < 2*keyFilterTestNumKeys; i++ {
+		var value []byte
+		value, err = tree.Get(ctx, keyFilterTestKey(i))
+		require.NoError(err, "Get(absent)")
+		require.Nil(value, "absent key should not exist")
+	}
+	for i := 0; i < keyFilterTestNumKeys; i++ {
+		var value []byte
+		value, err = tree.Get(ctx, keyFilterTestKey(i))
+		require.NoError(err, "Get(present)")
+		require.EqualValues(fmt.Sprintf("value %d", i), value, "existing key should have the correct value")
+	}
+	stats := tree.CacheStats()
+	require.EqualValues(0, stats.KeyFilterSkips, "no lookups should be skipped")
+	require.NotZero(stats.NodeDBReads, "lookups should read nodes")
+}
+
+func TestKeyFilterMissing(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	ndb, err := New(dbCfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	// Roots finalized with key filters disabled should not have a key filter.
+	root := commitKeyFilterTestRoot(ctx, require, ndb, 0)
+	_, err = ndb.GetKeyFilter(ctx, root)
+	require.ErrorIs(err, api.ErrKeyFilterNotFound, "GetKeyFilter() without a key filter should fail")
+
+	tree := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	value, err := tree.Get(ctx, keyFilterTestKey(keyFilterTestNumKeys))
+	require.NoError(err, "Get(absent)")
+	require.Nil(value, "absent key should not exist")
+	value, err = tree.Get(ctx, keyFilterTestKey(0))
+	require.NoError(err, "Get(present)")
+	require.EqualValues("value 0", value, "existing key should have the correct value")
+	require.EqualValues(0, tree.CacheStats().KeyFilterSkips, "no lookups should be skipped")
+
+	// Key filters in an unsupported format should be ignored.
+	bdb := ndb.(*badgerNodeDB)
+	kf := api.NewKeyFilter(0, 1)
+	kf.Versioned = cbor.NewVersioned(2)
+	tx := bdb.db.NewTransactionAt(tsMetadata, true)
+	defer tx.Discard()
+	err = tx.Set(keyFilterKeyFmt.Encode(root.Version), cbor.Marshal(kf))
+	require.NoError(err, "Set()")
+	err = tx.CommitAt(tsMetadata, nil)
+	require.NoError(err, "CommitAt()")
+
+	_, err = ndb.GetKeyFilter(ctx, root)
+	require.ErrorIs(err, api.ErrKeyFilterNotFound, "GetKeyFilter() with an unsupported key filter should fail")
+
+	tree2 := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree2.Close()
+	value, err = tree2.Get(ctx, keyFilterTestKey(0))
+	require.NoError(err, "Get(present)")
+	require.EqualValues("value 0", value, "existing key should have the correct value")
+	require.EqualValues(0, tree2.CacheStats().KeyFilterSkips, "no lookups should be skipped")
+}
+
+func TestKeyFilterEncoding(t *testing.T) {
+	require := require.New(t)
+
+	kf := api.NewKeyFilter(keyFilterTestNumKeys, 0)
+	require.Equal((keyFilterTestNumKeys*10+7)/8, kf.Size(), "key filter should be sized for the keys")
+	for i := 0; i < keyFilterTestNumKeys; i++ {
+		kf.Add(keyFilterTestKey(i))
+	}
+	decoded, err := api.DecodeKeyFilter(cbor.Marshal(kf))
+	require.NoError(err, "DecodeKeyFilter()")
+	require.Equal(kf, decoded, "decoded key filter should be equal")
+
+	_, err = api.DecodeKeyFilter([]byte("garbage"))
+	require.Error(err, "DecodeKeyFilter() should fail on malformed input")
+	kf.NumHashes = 0
+	_, err = api.DecodeKeyFilter(cbor.Marshal(kf))
+	require.Error(err, "DecodeKeyFilter() should fail on invalid number of hashes")
+}
+
+func TestKeyFilterBackground(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	cfg := *dbCfg
+	cfg.KeyFilterMaxSize = 1024 * 1024
+	ndb, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	// Finalization should not wait for key filters to be built, but the latest finalized version
+	// should eventually get one.
+	var root node.Root
+	for version := uint64(0); version < 10; version++ {
+		root = commitKeyFilterTestRoot(ctx, require, ndb, version)
+	}
+	kf := waitKeyFilter(ctx, require, ndb, root)
+	require.True(kf.MayContain(keyFilterTestKey(0)), "key filter should contain all keys")
+}
@@ -1,7 +1,9 @@
 package badger
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/dgraph-io/badger/v3"
@@ -9,6 +11,8 @@ import (
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
 )
 
 // serializedMetadata is the on-disk serialized metadata.
@@ -20,10 +24,23 @@ type serializedMetadata struct {
 
 	// EarliestVersion is the earliest version.
 	EarliestVersion uint64 `json:"earliest_version"`
+	// EarliestWriteLogVersion is the earliest version for which write logs are available. If nil,
+	// this is the same as EarliestVersion.
+	EarliestWriteLogVersion *uint64 `json:"earliest_write_log_version,omitempty"`
 	// LastFinalizedVersion is the last finalized version.
 	LastFinalizedVersion *uint64 `json:"last_finalized_version"`
 	// MultipartVersion is the version for the in-progress multipart restore, or 0 if none was in progress.
 	MultipartVersion uint64 `json:"multipart_version"`
+	// NodeKeyShards is the number of node key shards, or 0 if node keys are not sharded.
+	NodeKeyShards uint16 `json:"node_key_shards,omitempty"`
+	// HashMode is the node hash construction used by all roots in the database.
+	HashMode node.HashMode `json:"hash_mode,omitempty"`
+	// NonFinalizedRoots is the number of committed roots in each version that has not yet been
+	// finalized. If nil, it is derived from the roots metadata when the database is opened.
+	NonFinalizedRoots map[uint64]uint64 `json:"non_finalized_roots,omitempty"`
+	// Storage is the total storage used by nodes and write logs. If nil, it is derived from the
+	// stored nodes and write logs when the database is opened.
+	Storage *storageTotals `json:"storage,omitempty"`
 }
 
 // metadata is the database metadata.
@@ -40,16 +57,39 @@ func (m *metadata) getEarliestVersion() uint64 {
 	return m.value.EarliestVersion
 }
 
-func (m *metadata) setEarliestVersion(tx *badger.Txn, version uint64) error {
+func (m *metadata) getEarliestWriteLogVersion() uint64 {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.earliestWriteLogVersionLocked()
+}
+
+func (m *metadata) earliestWriteLogVersionLocked() uint64 {
+	if m.value.EarliestWriteLogVersion == nil {
+		return m.value.EarliestVersion
+	}
+	return *m.value.EarliestWriteLogVersion
+}
+
+func (m *metadata) setEarliestVersions(tx *badger.Txn, version, writeLogVersion uint64) error {
 	m.Lock()
 	defer m.Unlock()
 
-	// The earliest version can only increase, not decrease.
+	// The earliest versions can only increase, not decrease.
 	if version < m.value.EarliestVersion {
-		return nil
+		version = m.value.EarliestVersion
+	}
+	if current := m.earliestWriteLogVersionLocked(); writeLogVersion < current {
+		writeLogVersion = current
 	}
 
 	m.value.EarliestVersion = version
+	switch writeLogVersion {
+	case version:
+		m.value.EarliestWriteLogVersion = nil
+	default:
+		m.value.EarliestWriteLogVersion = &writeLogVersion
+	}
 	return m.save(tx)
 }
 
@@ -76,6 +116,50 @@ func (m *metadata) setLastFinalizedVersion(tx *badger.Txn, version uint64) error
 	}
 
 	m.value.LastFinalizedVersion = &version
+	for v := range m.value.NonFinalizedRoots {
+		if v <= version {
+			delete(m.value.NonFinalizedRoots, v)
+		}
+	}
+	return m.save(tx)
+}
+
+func (m *metadata) getNonFinalizedVersions() []api.NonFinalizedVersion {
+	m.RLock()
+	defer m.RUnlock()
+
+	versions := make([]api.NonFinalizedVersion, 0, len(m.value.NonFinalizedRoots))
+	for version, numRoots := range m.value.NonFinalizedRoots {
+		versions = append(versions, api.NonFinalizedVersion{Version: version, NumRoots: numRoots})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions
+}
+
+// addNonFinalizedRoot records a new root committed in the given version and returns the split
+// transaction entry for saving the metadata.
+func (m *metadata) addNonFinalizedRoot(version uint64) splitEntry {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.value.NonFinalizedRoots == nil {
+		m.value.NonFinalizedRoots = make(map[uint64]uint64)
+	}
+	m.value.NonFinalizedRoots[version]++
+	return splitEntry{key: metadataKeyFmt.Encode(), value: cbor.Marshal(m.value)}
+}
+
+// removeNonFinalizedVersions removes the given versions from the set of non-finalized versions
+// after all of their roots have been removed.
+func (m *metadata) removeNonFinalizedVersions(tx *badger.Txn, versions []uint64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, version := range versions {
+		delete(m.value.NonFinalizedRoots, version)
+	}
 	return m.save(tx)
 }
 
@@ -94,6 +178,14 @@ func (m *metadata) setMultipartVersion(tx *badger.Txn, version uint64) error {
 	return m.save(tx)
 }
 
+// entry returns the split transaction entry for saving the metadata.
+func (m *metadata) entry() splitEntry {
+	m.RLock()
+	defer m.RUnlock()
+
+	return splitEntry{key: metadataKeyFmt.Encode(), value: cbor.Marshal(m.value)}
+}
+
 func (m *metadata) save(tx *badger.Txn) error {
 	return tx.Set(metadataKeyFmt.Encode(), cbor.Marshal(m.value))
 }
@@ -138,7 +230,92 @@ func loadRootsMetadata(tx *badger.Txn, version uint64) (*rootsMetadata, error) {
 	return rootsMeta, nil
 }
 
+// storedType returns the type the given root is stored under in case it is only stored under a
+// different type than the requested one.
+func (rm *rootsMetadata) storedType(rootHash typedHash) (node.RootType, bool) {
+	for typ := node.RootTypeInvalid + 1; typ <= node.RootTypeMax; typ++ {
+		if typ == rootHash.Type() {
+			continue
+		}
+		if _, ok := rm.Roots[typedHashFromParts(typ, rootHash.Hash())]; ok {
+			return typ, true
+		}
+	}
+	return node.RootTypeInvalid, false
+}
+
+// entry returns the split transaction entry for saving the roots metadata to the database.
+func (rm *rootsMetadata) entry() splitEntry {
+	return splitEntry{key: rootsMetadataKeyFmt.Encode(rm.version), value: cbor.Marshal(rm)}
+}
+
 // save saves the roots metadata to the database.
 func (rm *rootsMetadata) save(tx *badger.Txn) error {
 	return tx.Set(rootsMetadataKeyFmt.Encode(rm.version), cbor.Marshal(rm))
 }
+
+// finalizeJournal is the journal entry recorded before a version is finalized, so that an
+// interrupted finalization can be completed on the next startup.
+//
+// NOTE: Public fields of this structure are part of the on-disk format.
+type finalizeJournal struct {
+	_ struct{} `cbor:",toarray"`
+
+	// Version is the version being finalized.
+	Version uint64
+	// Roots is the sorted set of finalized roots, including all roots they were derived from.
+	Roots []typedHash
+}
+
+// newFinalizeJournal creates a new finalization journal entry for the given set of finalized roots.
+func newFinalizeJournal(version uint64, finalizedRoots map[typedHash]bool) *finalizeJournal {
+	fj := &finalizeJournal{
+		Version: version,
+		Roots:   make([]typedHash, 0, len(finalizedRoots)),
+	}
+	for rootHash := range finalizedRoots {
+		fj.Roots = append(fj.Roots, rootHash)
+	}
+	sort.Slice(fj.Roots, func(i, j int) bool {
+		return bytes.Compare(fj.Roots[i][:], fj.Roots[j][:]) < 0
+	})
+	return fj
+}
+
+// loadFinalizeJournal loads the pending finalization journal entry from the database. Returns nil
+// in case there is no pending finalization.
+func loadFinalizeJournal(tx *badger.Txn) (*finalizeJournal, error) {
+	item, err := tx.Get(finalizeJournalKeyFmt.Encode())
+	switch err {
+	case nil:
+	case badger.ErrKeyNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("mkvs/badger: error reading finalization journal: %w", err)
+	}
+
+	var fj finalizeJournal
+	if err = item.Value(func(val []byte) error { return cbor.UnmarshalTrusted(val, &fj) }); err != nil {
+		return nil, fmt.Errorf("mkvs/badger: error reading finalization journal: %w", err)
+	}
+	return &fj, nil
+}
+
+// finalizedRoots returns the set of finalized roots recorded in the journal entry.
+func (fj *finalizeJournal) finalizedRoots() map[typedHash]bool {
+	finalizedRoots := make(map[typedHash]bool, len(fj.Roots))
+	for _, rootHash := range fj.Roots {
+		finalizedRoots[rootHash] = true
+	}
+	return finalizedRoots
+}
+
+// save saves the journal entry to the database.
+func (fj *finalizeJournal) save(tx *badger.Txn) error {
+	return tx.Set(finalizeJournalKeyFmt.Encode(), cbor.Marshal(fj))
+}
+
+// remove removes the journal entry from the database.
+func (fj *finalizeJournal) remove(tx *badger.Txn) error {
+	return tx.Delete(finalizeJournalKeyFmt.Encode())
+}
@@ -0,0 +1,122 @@
+package badger
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	nonFinalizedVersions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_non_finalized_versions",
+			Help: "Number of versions with committed roots that have not yet been finalized.",
+		},
+		[]string{"namespace"},
+	)
+	nonFinalizedRoots = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_non_finalized_roots",
+			Help: "Number of committed roots in versions that have not yet been finalized.",
+		},
+		[]string{"namespace"},
+	)
+	corruptedNodes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oasis_storage_mkvs_corrupted_nodes",
+			Help: "Number of corrupted nodes detected when reading nodes.",
+		},
+		[]string{"namespace"},
+	)
+	nodeBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_node_bytes",
+			Help: "Total size of all stored nodes (bytes).",
+		},
+		[]string{"namespace"},
+	)
+	writeLogBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_write_log_bytes",
+			Help: "Total size of all stored write logs (bytes).",
+		},
+		[]string{"namespace"},
+	)
+	cacheSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_cache_size",
+			Help: "Configured maximum size of the in-memory cache (bytes).",
+		},
+		[]string{"namespace", "cache"},
+	)
+	cacheUsed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_cache_used",
+			Help: "Current size of the in-memory cache (bytes).",
+		},
+		[]string{"namespace", "cache"},
+	)
+
+	nodeDBCollectors = []prometheus.Collector{
+		nonFinalizedVersions,
+		nonFinalizedRoots,
+		corruptedNodes,
+		nodeBytes,
+		writeLogBytes,
+		cacheSize,
+		cacheUsed,
+	}
+
+	metricsOnce sync.Once
+)
+
+func initMetrics() {
+	metricsOnce.Do(func() {
+		prometheus.MustRegister(nodeDBCollectors...)
+	})
+}
+
+// updateNonFinalizedMetrics updates the non-finalized version metrics from the current metadata.
+func (d *badgerNodeDB) updateNonFinalizedMetrics() {
+	labels := prometheus.Labels{"namespace": d.namespace.String()}
+
+	var numRoots uint64
+	versions := d.meta.getNonFinalizedVersions()
+	for _, v := range versions {
+		numRoots += v.NumRoots
+	}
+	nonFinalizedVersions.With(labels).Set(float64(len(versions)))
+	nonFinalizedRoots.With(labels).Set(float64(numRoots))
+}
+
+// recordCorruptedNode records the detection of a corrupted node.
+func (d *badgerNodeDB) recordCorruptedNode() {
+	corruptedNodes.With(prometheus.Labels{"namespace": d.namespace.String()}).Inc()
+}
+
+// updateCacheMetrics updates the cache metrics from the current cache statistics.
+func (d *badgerNodeDB) updateCacheMetrics() {
+	stats := d.CacheStats()
+	ns := d.namespace.String()
+	blockLabels := prometheus.Labels{"namespace": ns, "cache": "block"}
+	indexLabels := prometheus.Labels{"namespace": ns, "cache": "index"}
+	cacheSize.With(blockLabels).Set(float64(stats.BlockCacheSize))
+	cacheUsed.With(blockLabels).Set(float64(stats.BlockCacheUsed))
+	cacheSize.With(indexLabels).Set(float64(stats.IndexCacheSize))
+	cacheUsed.With(indexLabels).Set(float64(stats.IndexCacheUsed))
+}
+
+// updateStorageMetrics updates the storage metrics from the current metadata. The cache metrics
+// are updated as well, so that they are refreshed whenever the database is written to.
+func (d *badgerNodeDB) updateStorageMetrics() {
+	d.updateCacheMetrics()
+
+	totals, tracked := d.meta.getStorageTotals()
+	if !tracked {
+		return
+	}
+
+	labels := prometheus.Labels{"namespace": d.namespace.String()}
+	nodeBytes.With(labels).Set(float64(totals.NodeBytes))
+	writeLogBytes.With(labels).Set(float64(totals.WriteLogBytes))
+}
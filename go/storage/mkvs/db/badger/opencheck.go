@@ -0,0 +1,487 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+// ErrInconsistentDatabase is the error returned when the database fails the startup consistency
+// check and cannot (or must not) be recovered automatically.
+var ErrInconsistentDatabase = errors.New("mkvs/badger: inconsistent database")
+
+// openCheckReport is the result of the startup consistency check.
+type openCheckReport struct {
+	// violations are the metadata invariant violations that cannot be repaired automatically.
+	violations []string
+
+	// partialVersions are the unfinalized versions that need to be rolled back, in ascending
+	// order. Once an unfinalized version is found to be only partially written, all later
+	// versions are rolled back as well since they may derive from it.
+	partialVersions []uint64
+	// partialReasons describe why the first partial version is considered partially written.
+	partialReasons []string
+
+	// orphanedUpdatedNodes are the keys of updated node indices left over for already finalized
+	// versions.
+	orphanedUpdatedNodes [][]byte
+	// orphanedMultipartLog are the keys of multipart restore node log entries left over while no
+	// multipart restore is in progress.
+	orphanedMultipartLog [][]byte
+	// pendingCommits are the keys of pending commit markers left over by commits whose metadata
+	// updates were split across multiple transactions and have been interrupted.
+	pendingCommits [][]byte
+	// finalizedMultipart is true if an in-progress multipart restore marker refers to a version
+	// that has already been finalized.
+	finalizedMultipart bool
+}
+
+// isClean returns true if no problems were found.
+func (r *openCheckReport) isClean() bool {
+	return len(r.violations) == 0 &&
+		len(r.partialVersions) == 0 &&
+		len(r.orphanedUpdatedNodes) == 0 &&
+		len(r.orphanedMultipartLog) == 0 &&
+		len(r.pendingCommits) == 0 &&
+		!r.finalizedMultipart
+}
+
+// String returns a human readable description of all found problems.
+func (r *openCheckReport) String() string {
+	problems := append([]string{}, r.violations...)
+	if len(r.partialVersions) > 0 {
+		problems = append(problems, fmt.Sprintf("partially written unfinalized versions %v (%s)",
+			r.partialVersions,
+			strings.Join(r.partialReasons, ", "),
+		))
+	}
+	if n := len(r.orphanedUpdatedNodes); n > 0 {
+		problems = append(problems, fmt.Sprintf("%d orphaned updated node indices for finalized versions", n))
+	}
+	if n := len(r.orphanedMultipartLog); n > 0 {
+		problems = append(problems, fmt.Sprintf("%d orphaned multipart restore log entries", n))
+	}
+	if n := len(r.pendingCommits); n > 0 {
+		problems = append(problems, fmt.Sprintf("%d interrupted split commits", n))
+	}
+	if r.finalizedMultipart {
+		problems = append(problems, "multipart restore marker for an already finalized version")
+	}
+	return strings.Join(problems, "; ")
+}
+
+// openCheck validates database metadata invariants and, unless strict is set, automatically
+// recovers from any problems that can be caused by an unclean shutdown.
+//
+// Problems that cannot be repaired automatically always result in an error.
+func (d *badgerNodeDB) openCheck(strict bool) error {
+	d.metaUpdateLock.Lock()
+	defer d.metaUpdateLock.Unlock()
+
+	report, err := d.checkOpenLocked()
+	if err != nil {
+		return err
+	}
+	if report.isClean() {
+		return nil
+	}
+
+	if len(report.violations) > 0 || strict {
+		return fmt.Errorf("%w: %s", ErrInconsistentDatabase, report)
+	}
+	if d.readOnly {
+		d.logger.Warn("database is inconsistent, but not recovering in read-only mode",
+			"problems", report.String(),
+		)
+		return nil
+	}
+
+	if err = d.recoverLocked(report); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to recover database: %w", err)
+	}
+
+	lastFinalizedVersion, _ := d.meta.getLastFinalizedVersion()
+	d.logger.Warn("recovered database from unclean shutdown",
+		"problems", report.String(),
+		"earliest_version", d.meta.getEarliestVersion(),
+		"last_finalized_version", lastFinalizedVersion,
+		"rolled_back_versions", report.partialVersions,
+		"removed_orphaned_entries", len(report.orphanedUpdatedNodes)+len(report.orphanedMultipartLog),
+		"interrupted_commits", len(report.pendingCommits),
+	)
+	return nil
+}
+
+// Assumes metaUpdateLock is held when called.
+func (d *badgerNodeDB) checkOpenLocked() (*openCheckReport, error) {
+	var report openCheckReport
+
+	earliestVersion := d.meta.getEarliestVersion()
+	lastFinalizedVersion, finalized := d.meta.getLastFinalizedVersion()
+	multipartVersion := d.meta.getMultipartVersion()
+
+	// Check version invariants.
+	if finalized {
+		if earliestVersion > lastFinalizedVersion {
+			report.violations = append(report.violations, fmt.Sprintf(
+				"earliest version %d is after last finalized version %d",
+				earliestVersion, lastFinalizedVersion,
+			))
+		}
+		if multipartVersion != multipartVersionNone && multipartVersion <= lastFinalizedVersion {
+			report.finalizedMultipart = true
+		}
+	} else if earliestVersion != 0 {
+		report.violations = append(report.violations, fmt.Sprintf(
+			"earliest version %d set while no version has been finalized",
+			earliestVersion,
+		))
+	}
+
+	tx := d.db.NewTransactionAt(tsMetadata, false)
+	defer tx.Discard()
+
+	// Make sure that there are no roots left below the earliest version, as that would mean that
+	// the stored version chain is not contiguous.
+	if err := func() error {
+		it := tx.NewIterator(badger.IteratorOptions{Prefix: rootsMetadataKeyFmt.Encode()})
+		defer it.Close()
+
+		it.Rewind()
+		if !it.Valid() {
+			return nil
+		}
+		var version uint64
+		if !rootsMetadataKeyFmt.Decode(it.Item().Key(), &version) {
+			return fmt.Errorf("mkvs/badger: undecodable roots metadata key (%v)", it.Item().Key())
+		}
+		if version < earliestVersion {
+			report.violations = append(report.violations, fmt.Sprintf(
+				"roots for version %d are stored below earliest version %d",
+				version, earliestVersion,
+			))
+		}
+		return nil
+	}(); err != nil {
+		return nil, err
+	}
+
+	// Updated node indices are removed during finalization, so any left for finalized versions
+	// are orphaned.
+	if finalized {
+		if err := func() error {
+			it := tx.NewIterator(badger.IteratorOptions{Prefix: rootUpdatedNodesKeyFmt.Encode()})
+			defer it.Close()
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				var (
+					version  uint64
+					rootHash typedHash
+				)
+				if !rootUpdatedNodesKeyFmt.Decode(it.Item().Key(), &version, &rootHash) {
+					return fmt.Errorf("mkvs/badger: undecodable root updated nodes key (%v)", it.Item().Key())
+				}
+				if version > lastFinalizedVersion {
+					break
+				}
+				report.orphanedUpdatedNodes = append(report.orphanedUpdatedNodes, it.Item().KeyCopy(nil))
+			}
+			return nil
+		}(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Multipart restore node log entries are only valid during a multipart restore.
+	if multipartVersion == multipartVersionNone {
+		it := tx.NewIterator(badger.IteratorOptions{Prefix: multipartRestoreNodeLogKeyFmt.Encode()})
+		for it.Rewind(); it.Valid(); it.Next() {
+			report.orphanedMultipartLog = append(report.orphanedMultipartLog, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+	}
+
+	// Pending commit markers are removed once a commit completes.
+	pit := tx.NewIterator(badger.IteratorOptions{Prefix: pendingCommitKeyFmt.Encode()})
+	for pit.Rewind(); pit.Valid(); pit.Next() {
+		report.pendingCommits = append(report.pendingCommits, pit.Item().KeyCopy(nil))
+	}
+	pit.Close()
+
+	// Check that all unfinalized versions have been completely written.
+	var firstUnfinalized uint64
+	if finalized {
+		firstUnfinalized = lastFinalizedVersion + 1
+	}
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: rootsMetadataKeyFmt.Encode()})
+	defer it.Close()
+
+	for it.Seek(rootsMetadataKeyFmt.Encode(firstUnfinalized)); it.Valid(); it.Next() {
+		var version uint64
+		if !rootsMetadataKeyFmt.Decode(it.Item().Key(), &version) {
+			return nil, fmt.Errorf("mkvs/badger: undecodable roots metadata key (%v)", it.Item().Key())
+		}
+		if len(report.partialVersions) > 0 {
+			report.partialVersions = append(report.partialVersions, version)
+			continue
+		}
+		if multipartVersion != multipartVersionNone && version == multipartVersion {
+			// Multipart restore remnants are handled separately.
+			continue
+		}
+
+		rootsMeta := &rootsMetadata{version: version}
+		if err := it.Item().Value(func(val []byte) error {
+			return cbor.UnmarshalTrusted(val, &rootsMeta)
+		}); err != nil {
+			report.violations = append(report.violations, fmt.Sprintf(
+				"undecodable roots metadata for version %d: %s", version, err,
+			))
+			continue
+		}
+
+		reasons, err := d.checkVersionWritten(tx, rootsMeta)
+		if err != nil {
+			return nil, err
+		}
+		if len(reasons) > 0 {
+			report.partialVersions = append(report.partialVersions, version)
+			report.partialReasons = reasons
+		}
+	}
+
+	return &report, nil
+}
+
+// checkVersionWritten checks that all roots in the given unfinalized version have been completely
+// written and returns the reasons why they have not been.
+func (d *badgerNodeDB) checkVersionWritten(metaTx *badger.Txn, rootsMeta *rootsMetadata) ([]string, error) {
+	tx := d.db.NewTransactionAt(versionToTs(rootsMeta.version), false)
+	defer tx.Discard()
+
+	var reasons []string
+	for rootHash := range rootsMeta.Roots {
+		for _, check := range []struct {
+			txn  *badger.Txn
+			key  []byte
+			what string
+		}{
+			{metaTx, rootUpdatedNodesKeyFmt.Encode(rootsMeta.version, &rootHash), "updated nodes index"},
+			{tx, rootNodeKeyFmt.Encode(&rootHash), "root node"},
+		} {
+			_, err := check.txn.Get(check.key)
+			switch err {
+			case nil:
+			case badger.ErrKeyNotFound:
+				reasons = append(reasons, fmt.Sprintf("missing %s for root %s in version %d",
+					check.what, rootHash, rootsMeta.version,
+				))
+			default:
+				return nil, fmt.Errorf("mkvs/badger: failed to check root %s: %w", rootHash, err)
+			}
+		}
+	}
+	return reasons, nil
+}
+
+// Assumes metaUpdateLock is held when called.
+func (d *badgerNodeDB) recoverLocked(report *openCheckReport) error {
+	tx := d.db.NewTransactionAt(tsMetadata, true)
+	defer tx.Discard()
+
+	for _, key := range report.orphanedUpdatedNodes {
+		if err := tx.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, key := range report.orphanedMultipartLog {
+		if err := tx.Delete(key); err != nil {
+			return err
+		}
+	}
+	for _, key := range report.pendingCommits {
+		if err := d.discardPendingCommit(tx, key); err != nil {
+			return fmt.Errorf("failed to discard interrupted commit: %w", err)
+		}
+	}
+
+	if len(report.partialVersions) > 0 {
+		removedRoots := make(map[typedHash]bool)
+		for _, version := range report.partialVersions {
+			if err := d.rollbackVersion(tx, version, removedRoots); err != nil {
+				return fmt.Errorf("failed to roll back version %d: %w", version, err)
+			}
+		}
+
+		// Remove any links from the remaining roots to the removed roots.
+		earliestVersion := d.meta.getEarliestVersion()
+		for version := earliestVersion; version < report.partialVersions[0]; version++ {
+			rootsMeta, err := loadRootsMetadata(tx, version)
+			if err != nil {
+				return err
+			}
+
+			var changed bool
+			for rootHash, derivedRoots := range rootsMeta.Roots {
+				keptRoots := derivedRoots[:0]
+				for _, derivedRoot := range derivedRoots {
+					if removedRoots[derivedRoot] {
+						changed = true
+						continue
+					}
+					keptRoots = append(keptRoots, derivedRoot)
+				}
+				rootsMeta.Roots[rootHash] = keptRoots
+			}
+			if changed {
+				if err = rootsMeta.save(tx); err != nil {
+					return fmt.Errorf("failed to save roots metadata: %w", err)
+				}
+			}
+		}
+
+		if err := d.meta.removeNonFinalizedVersions(tx, report.partialVersions); err != nil {
+			return fmt.Errorf("failed to save metadata: %w", err)
+		}
+	}
+
+	// Commit metadata updates last, so in case we fail, the check will simply find the same
+	// problems on next startup.
+	if err := tx.CommitAt(tsMetadata, nil); err != nil {
+		return err
+	}
+
+	if report.finalizedMultipart {
+		// The multipart restore has been finalized, so the restored nodes must be kept.
+		if err := d.cleanMultipartLocked(false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollbackVersion removes all roots of the given unfinalized version, the same way as finalization
+// removes non-finalized roots. All removed roots are added to removedRoots.
+func (d *badgerNodeDB) rollbackVersion(metaTx *badger.Txn, version uint64, removedRoots map[typedHash]bool) error {
+	batch := d.db.NewWriteBatchAt(versionToTs(version))
+	defer batch.Cancel()
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+
+	rootsMeta, err := loadRootsMetadata(metaTx, version)
+	if err != nil {
+		return err
+	}
+
+	for rootHash := range rootsMeta.Roots {
+		removedRoots[rootHash] = true
+
+		// Remove nodes added in this version for this root, if the index is available.
+		rootUpdatedNodesKey := rootUpdatedNodesKeyFmt.Encode(version, &rootHash)
+		item, err := metaTx.Get(rootUpdatedNodesKey)
+		switch err {
+		case nil:
+			var updatedNodes []updatedNode
+			if err = item.Value(func(data []byte) error {
+				return cbor.UnmarshalTrusted(data, &updatedNodes)
+			}); err != nil {
+				return fmt.Errorf("corrupted root updated nodes index: %w", err)
+			}
+			for _, n := range updatedNodes {
+				if n.Removed {
+					continue
+				}
+				if err = batch.Delete(d.nodeKey(&n.Hash)); err != nil {
+					return err
+				}
+			}
+			if err = metaTx.Delete(rootUpdatedNodesKey); err != nil {
+				return err
+			}
+		case badger.ErrKeyNotFound:
+		default:
+			return err
+		}
+
+		if err = batch.Delete(rootNodeKeyFmt.Encode(&rootHash)); err != nil {
+			return err
+		}
+
+		// Remove write logs for the root.
+		if err = func() error {
+			wit := tx.NewIterator(badger.IteratorOptions{Prefix: writeLogKeyFmt.Encode(version, &rootHash)})
+			defer wit.Close()
+
+			for wit.Rewind(); wit.Valid(); wit.Next() {
+				if err = batch.Delete(wit.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+
+	if err = metaTx.Delete(rootsMetadataKeyFmt.Encode(version)); err != nil {
+		return err
+	}
+
+	return batch.Flush()
+}
+
+// discardPendingCommit removes the metadata written by an interrupted commit with the given
+// pending commit marker key, together with the marker itself.
+//
+// Nodes written by the interrupted commit are left in place, the same as for discarded batches,
+// as they are unreachable and could be shared with other roots.
+func (d *badgerNodeDB) discardPendingCommit(metaTx *badger.Txn, key []byte) error {
+	var (
+		version  uint64
+		rootHash typedHash
+	)
+	if !pendingCommitKeyFmt.Decode(key, &version, &rootHash) {
+		return fmt.Errorf("mkvs/badger: undecodable pending commit key (%v)", key)
+	}
+
+	rootsMeta, err := loadRootsMetadata(metaTx, version)
+	if err != nil {
+		return err
+	}
+	if _, ok := rootsMeta.Roots[rootHash]; !ok {
+		// The root has never been made reachable, so remove everything that refers to it.
+		batch := d.db.NewWriteBatchAt(versionToTs(version))
+		defer batch.Cancel()
+
+		if err = batch.Delete(rootNodeKeyFmt.Encode(&rootHash)); err != nil {
+			return err
+		}
+		if err = func() error {
+			tx := d.db.NewTransactionAt(versionToTs(version), false)
+			defer tx.Discard()
+			wit := tx.NewIterator(badger.IteratorOptions{Prefix: writeLogKeyFmt.Encode(version, &rootHash)})
+			defer wit.Close()
+
+			for wit.Rewind(); wit.Valid(); wit.Next() {
+				if err = batch.Delete(wit.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}(); err != nil {
+			return err
+		}
+		if err = batch.Flush(); err != nil {
+			return err
+		}
+		if err = metaTx.Delete(rootUpdatedNodesKeyFmt.Encode(version, &rootHash)); err != nil {
+			return err
+		}
+	}
+
+	return metaTx.Delete(key)
+}
@@ -0,0 +1,197 @@
+package badger
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// corruptMetaKey sets (or removes in case value is nil) the given key stored at the metadata
+// timestamp, bypassing all database invariants.
+func corruptMetaKey(require *require.Assertions, ndb api.NodeDB, key, value []byte) {
+	db := ndb.(*badgerNodeDB)
+	tx := db.db.NewTransactionAt(tsMetadata, true)
+	defer tx.Discard()
+
+	var err error
+	if value == nil {
+		err = tx.Delete(key)
+	} else {
+		err = tx.Set(key, value)
+	}
+	require.NoError(err, "corrupting metadata key")
+	require.NoError(tx.CommitAt(tsMetadata, nil), "CommitAt")
+}
+
+// corruptPartialCommit simulates an unclean shutdown while the metadata of the given
+// non-finalized root was being written by removing its updated nodes index.
+func corruptPartialCommit(require *require.Assertions, ndb api.NodeDB, root node.Root) {
+	rootHash := typedHashFromRoot(root)
+	corruptMetaKey(require, ndb, rootUpdatedNodesKeyFmt.Encode(root.Version, &rootHash), nil)
+}
+
+// corruptOrphanedMarkers simulates an unclean shutdown during finalization and multipart restore
+// by writing an updated nodes index and a multipart restore log entry for the given finalized
+// root. It returns the keys of the written entries.
+func corruptOrphanedMarkers(require *require.Assertions, ndb api.NodeDB, root node.Root) (updatedNodesKey, logKey []byte) {
+	rootHash := typedHashFromRoot(root)
+	updatedNodesKey = rootUpdatedNodesKeyFmt.Encode(root.Version, &rootHash)
+	logKey = multipartRestoreNodeLogKeyFmt.Encode(&rootHash)
+	corruptMetaKey(require, ndb, updatedNodesKey, cbor.Marshal([]updatedNode{}))
+	corruptMetaKey(require, ndb, logKey, []byte{})
+	return updatedNodesKey, logKey
+}
+
+// corruptMetadata modifies the database metadata, bypassing all database invariants.
+func corruptMetadata(require *require.Assertions, ndb api.NodeDB, fn func(meta *serializedMetadata)) {
+	db := ndb.(*badgerNodeDB)
+	meta := db.meta.value
+	fn(&meta)
+	corruptMetaKey(require, ndb, metadataKeyFmt.Encode(), cbor.Marshal(meta))
+}
+
+// hasMetaKey checks whether the given key exists at the metadata timestamp.
+func hasMetaKey(require *require.Assertions, ndb api.NodeDB, key []byte) bool {
+	db := ndb.(*badgerNodeDB)
+	tx := db.db.NewTransactionAt(tsMetadata, false)
+	defer tx.Discard()
+
+	_, err := tx.Get(key)
+	switch err {
+	case nil:
+		return true
+	case badger.ErrKeyNotFound:
+		return false
+	default:
+		require.NoError(err, "Get")
+		return false
+	}
+}
+
+func newOpenCheckTest(t *testing.T) (*require.Assertions, *api.Config) {
+	dir, err := ioutil.TempDir("", "mkvs.badger.opencheck")
+	require.NoError(t, err, "TempDir")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := *dbCfg
+	cfg.MemoryOnly = false
+	cfg.DB = dir
+	return require.New(t), &cfg
+}
+
+func TestOpenCheckPartialVersion(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newOpenCheckTest(t)
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	root1 := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(err, "Finalize({root1})")
+
+	// Commit a version and simulate an unclean shutdown before the metadata was fully written.
+	values2 := append(append([][]byte{}, testValues...), []byte("version two"))
+	root2 := fillDB(ctx, require, values2, &root1, 1, 2, ndb)
+	corruptPartialCommit(require, ndb, root2)
+	ndb.Close()
+
+	// Strict open should fail with a descriptive error.
+	strictCfg := *cfg
+	strictCfg.StrictOpen = true
+	_, err = New(&strictCfg)
+	require.ErrorIs(err, ErrInconsistentDatabase, "New() should fail in strict mode")
+	require.Contains(err.Error(), "partially written unfinalized versions [2]")
+
+	// Non-strict open should roll back the partially written version.
+	ndb, err = New(cfg)
+	require.NoError(err, "New() should recover")
+	require.False(ndb.HasRoot(root2), "partially written root should be rolled back")
+	roots, err := ndb.GetRootsForVersion(ctx, root2.Version)
+	require.NoError(err, "GetRootsForVersion")
+	require.Empty(roots, "partially written version should have no roots")
+	require.False(hasMetaKey(require, ndb, rootsMetadataKeyFmt.Encode(root2.Version)), "roots metadata should be removed")
+	nonFinalized, err := ndb.NonFinalizedVersions(ctx)
+	require.NoError(err, "NonFinalizedVersions")
+	require.Empty(nonFinalized, "rolled back version should not be tracked as non-finalized")
+
+	latest, err := ndb.GetLatestVersion(ctx)
+	require.NoError(err, "GetLatestVersion")
+	require.EqualValues(root1.Version, latest, "latest version should be unchanged")
+
+	// The version should be usable again.
+	root2 = fillDB(ctx, require, values2, &root1, 1, 2, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root2})
+	require.NoError(err, "Finalize({root2})")
+	ndb.Close()
+
+	// The recovered database should pass the sanity check and a subsequent strict open.
+	err = CheckSanity(ctx, cfg, &testMigrationHelper{})
+	require.NoError(err, "CheckSanity")
+	ndb, err = New(&strictCfg)
+	require.NoError(err, "New() in strict mode after recovery")
+	ndb.Close()
+}
+
+func TestOpenCheckOrphanedMarkers(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newOpenCheckTest(t)
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	root1 := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(err, "Finalize({root1})")
+
+	updatedNodesKey, logKey := corruptOrphanedMarkers(require, ndb, root1)
+	ndb.Close()
+
+	strictCfg := *cfg
+	strictCfg.StrictOpen = true
+	_, err = New(&strictCfg)
+	require.ErrorIs(err, ErrInconsistentDatabase, "New() should fail in strict mode")
+
+	ndb, err = New(cfg)
+	require.NoError(err, "New() should recover")
+	require.False(hasMetaKey(require, ndb, updatedNodesKey), "orphaned updated nodes index should be removed")
+	require.False(hasMetaKey(require, ndb, logKey), "orphaned multipart log entry should be removed")
+	require.True(ndb.HasRoot(root1), "finalized root should be kept")
+	ndb.Close()
+
+	// The recovered database should pass a subsequent strict open.
+	ndb, err = New(&strictCfg)
+	require.NoError(err, "New() in strict mode after recovery")
+	defer ndb.Close()
+	require.True(ndb.HasRoot(root1), "finalized root should be kept")
+}
+
+func TestOpenCheckViolations(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newOpenCheckTest(t)
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	root1 := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(err, "Finalize({root1})")
+
+	corruptMetadata(require, ndb, func(meta *serializedMetadata) {
+		meta.EarliestVersion = *meta.LastFinalizedVersion + 1
+	})
+	ndb.Close()
+
+	// Violations that cannot be repaired should fail even in non-strict mode.
+	_, err = New(cfg)
+	require.ErrorIs(err, ErrInconsistentDatabase, "New() should fail")
+	require.Contains(err.Error(), "earliest version 2 is after last finalized version 1")
+}
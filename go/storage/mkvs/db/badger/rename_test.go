@@ -22,26 +22,26 @@ func TestRenameNamespace(t *testing.T) {
 	require.NoError(err, "TempDir")
 	defer os.RemoveAll(dir)
 
-	dbCfg = &api.Config{
-		DB:           dir,
-		Namespace:    srcNs,
-		MaxCacheSize: 16 * 1024 * 1024,
-		NoFsync:      true,
+	cfg := &api.Config{
+		DB:             dir,
+		Namespace:      srcNs,
+		BlockCacheSize: 16 * 1024 * 1024,
+		NoFsync:        true,
 	}
 
-	ndb, err := New(dbCfg)
+	ndb, err := New(cfg)
 	require.NoError(err, "New(srcNs)")
 	ndb.Close()
 
-	err = RenameNamespace(dbCfg, dstNs)
+	err = RenameNamespace(cfg, dstNs)
 	require.NoError(err, "RenameNamespace")
 
-	_, err = New(dbCfg)
+	_, err = New(cfg)
 	require.Error(err, "New(srcNs) should fail on renamed database")
 
-	dbCfg.Namespace = dstNs
+	cfg.Namespace = dstNs
 
-	ndb, err = New(dbCfg)
+	ndb, err = New(cfg)
 	require.NoError(err, "New(dstNs)")
 	ndb.Close()
 }
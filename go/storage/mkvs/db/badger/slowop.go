@@ -0,0 +1,96 @@
+package badger
+
+import (
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// slowOp tracks a single node database operation which is reported in case it exceeds its
+// configured threshold.
+//
+// A nil slowOp is valid and means that the operation is not being tracked.
+type slowOp struct {
+	db *badgerNodeDB
+
+	op        api.Operation
+	root      node.Root
+	threshold time.Duration
+	start     time.Time
+
+	keysRead    uint64
+	keysWritten uint64
+}
+
+// startOp starts tracking an operation. In case no threshold is configured for the operation, nil
+// is returned.
+func (d *badgerNodeDB) startOp(op api.Operation, root node.Root) *slowOp {
+	threshold, ok := d.slowOpThresholds[op]
+	if !ok {
+		return nil
+	}
+	return &slowOp{
+		db:        d,
+		op:        op,
+		root:      root,
+		threshold: threshold,
+		start:     time.Now(),
+	}
+}
+
+// startVersionOp starts tracking an operation which only involves a version.
+func (d *badgerNodeDB) startVersionOp(op api.Operation, version uint64) *slowOp {
+	return d.startOp(op, node.Root{Namespace: d.namespace, Version: version})
+}
+
+func (s *slowOp) read(n uint64) {
+	if s == nil {
+		return
+	}
+	s.keysRead += n
+}
+
+func (s *slowOp) wrote(n uint64) {
+	if s == nil {
+		return
+	}
+	s.keysWritten += n
+}
+
+// finish completes the operation and reports it in case it exceeded its threshold.
+func (s *slowOp) finish(err error) {
+	if s == nil {
+		return
+	}
+	if s.db.slowOpDelayHook != nil {
+		s.db.slowOpDelayHook(s.op)
+	}
+
+	duration := time.Since(s.start)
+	if duration <= s.threshold {
+		return
+	}
+
+	s.db.logger.Warn("slow node database operation",
+		"op", s.op,
+		"root", s.root,
+		"duration", duration,
+		"threshold", s.threshold,
+		"keys_read", s.keysRead,
+		"keys_written", s.keysWritten,
+		"err", err,
+	)
+
+	if s.db.slowOpHook != nil {
+		s.db.slowOpHook.SlowOperation(&api.SlowOpInfo{
+			Op:          s.op,
+			Root:        s.root,
+			Duration:    duration,
+			Threshold:   s.threshold,
+			KeysRead:    s.keysRead,
+			KeysWritten: s.keysWritten,
+			Err:         err,
+		})
+	}
+}
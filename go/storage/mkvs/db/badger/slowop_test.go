@@ -0,0 +1,143 @@
+package badger
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+const (
+	slowOpTestThreshold = 100 * time.Millisecond
+	slowOpTestDelay     = 2 * slowOpTestThreshold
+)
+
+// recordingSlowOpHook is a slow operation hook which records all reported operations.
+type recordingSlowOpHook struct {
+	sync.Mutex
+
+	ops []api.SlowOpInfo
+}
+
+func (h *recordingSlowOpHook) SlowOperation(info *api.SlowOpInfo) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.ops = append(h.ops, *info)
+}
+
+func (h *recordingSlowOpHook) take() []api.SlowOpInfo {
+	h.Lock()
+	defer h.Unlock()
+
+	ops := h.ops
+	h.ops = nil
+	return ops
+}
+
+func TestSlowOperations(t *testing.T) {
+	ctx := context.Background()
+	values := splitTestValues()[:100]
+
+	hook := &recordingSlowOpHook{}
+	cfg := *dbCfg
+	cfg.SlowOpThresholds = map[api.Operation]time.Duration{
+		api.OpGetNode:  slowOpTestThreshold,
+		api.OpCommit:   slowOpTestThreshold,
+		api.OpFinalize: slowOpTestThreshold,
+	}
+	cfg.SlowOpHook = hook
+	ndb, err := New(&cfg)
+	require.NoError(t, err, "New()")
+	defer ndb.Close()
+	badgerdb := ndb.(*badgerNodeDB)
+
+	// Operations below the threshold should not be reported.
+	root, err := commitSplitTest(ctx, ndb, values)
+	require.NoError(t, err, "Commit")
+	verifySplitTest(ctx, require.New(t), ndb, root, values)
+	require.Empty(t, hook.take(), "fast operations should not be reported")
+
+	var delayedOp api.Operation
+	badgerdb.slowOpDelayHook = func(op api.Operation) {
+		if op == delayedOp {
+			time.Sleep(slowOpTestDelay)
+		}
+	}
+
+	t.Run("GetNode", func(t *testing.T) {
+		require := require.New(t)
+
+		delayedOp = api.OpGetNode
+		_, err := ndb.GetNode(root, &node.Pointer{Clean: true, Hash: root.Hash})
+		require.NoError(err, "GetNode")
+
+		ops := hook.take()
+		require.Len(ops, 1, "slow operation should be reported")
+		require.Equal(api.OpGetNode, ops[0].Op)
+		require.Equal(root, ops[0].Root)
+		require.True(ops[0].Duration > slowOpTestThreshold, "reported duration should exceed threshold")
+		require.Equal(slowOpTestThreshold, ops[0].Threshold)
+		require.EqualValues(1, ops[0].KeysRead)
+		require.EqualValues(0, ops[0].KeysWritten)
+		require.NoError(ops[0].Err)
+
+		// Failed operations should be reported together with the error.
+		_, err = ndb.GetNode(root, &node.Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("missing node"))})
+		require.ErrorIs(err, api.ErrNodeNotFound)
+
+		ops = hook.take()
+		require.Len(ops, 1, "slow failed operation should be reported")
+		require.ErrorIs(ops[0].Err, api.ErrNodeNotFound)
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		require := require.New(t)
+
+		delayedOp = api.OpCommit
+		_, err := commitSplitTest(ctx, ndb, values[:10])
+		require.NoError(err, "Commit")
+
+		ops := hook.take()
+		require.Len(ops, 1, "slow operation should be reported")
+		require.Equal(api.OpCommit, ops[0].Op)
+		require.EqualValues(0, ops[0].Root.Version)
+		require.NotZero(ops[0].KeysWritten, "written keys should be reported")
+	})
+
+	t.Run("Finalize", func(t *testing.T) {
+		require := require.New(t)
+
+		delayedOp = api.OpFinalize
+		err := ndb.Finalize(ctx, []node.Root{root})
+		require.NoError(err, "Finalize")
+
+		ops := hook.take()
+		require.Len(ops, 1, "slow operation should be reported")
+		require.Equal(api.OpFinalize, ops[0].Op)
+		require.Equal(testNs, ops[0].Root.Namespace)
+		require.EqualValues(0, ops[0].Root.Version)
+	})
+
+	t.Run("Untracked", func(t *testing.T) {
+		require := require.New(t)
+
+		// Operations without a configured threshold are never reported.
+		delayedOp = api.OpPrune
+		err := ndb.Prune(ctx, 0)
+		require.NoError(err, "Prune")
+		require.Empty(hook.take(), "untracked operations should not be reported")
+	})
+
+	// Invalid thresholds should be rejected.
+	invalidCfg := *dbCfg
+	invalidCfg.SlowOpThresholds = map[api.Operation]time.Duration{api.OpCommit: -1}
+	_, err = New(&invalidCfg)
+	require.Error(t, err, "New() should fail with a negative slow operation threshold")
+}
@@ -0,0 +1,508 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+
+	cmnBadger "github.com/oasisprotocol/oasis-core/go/common/badger"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+)
+
+// metadataSnapshotSuffix is the suffix appended to the database path to obtain the path of the
+// metadata snapshot file.
+const metadataSnapshotSuffix = ".metadata-snapshot"
+
+// ErrInvalidMetadataSnapshot is the error returned when a metadata snapshot is corrupted or does
+// not match the database being recovered.
+var ErrInvalidMetadataSnapshot = errors.New("mkvs/badger: invalid metadata snapshot")
+
+// metadataSnapshot is a snapshot of the database metadata taken after a version was finalized.
+//
+// NOTE: Public fields of this structure are part of the on-disk format.
+type metadataSnapshot struct {
+	_ struct{} `cbor:",toarray"`
+
+	// Metadata is the database metadata.
+	Metadata serializedMetadata
+	// Roots are the roots of the last finalized version together with their derived roots.
+	Roots map[typedHash][]typedHash
+}
+
+// metadataSnapshotFile is the checksummed envelope of a metadata snapshot as stored on disk.
+//
+// NOTE: Public fields of this structure are part of the on-disk format.
+type metadataSnapshotFile struct {
+	_ struct{} `cbor:",toarray"`
+
+	// Checksum is the hash of the serialized snapshot.
+	Checksum hash.Hash
+	// Snapshot is the CBOR-serialized metadataSnapshot.
+	Snapshot []byte
+}
+
+// MetadataSnapshotPath returns the path of the metadata snapshot file written next to the
+// database directory at the given path.
+func MetadataSnapshotPath(dbPath string) string {
+	return filepath.Clean(dbPath) + metadataSnapshotSuffix
+}
+
+// updateMetadataSnapshotLocked writes a new metadata snapshot in case metadata snapshots are
+// enabled. Failures are only logged as the database itself has already been updated.
+//
+// Assumes metaUpdateLock is held when called.
+func (d *badgerNodeDB) updateMetadataSnapshotLocked() {
+	if d.metadataSnapshotPath == "" {
+		return
+	}
+	if err := d.writeMetadataSnapshotLocked(); err != nil {
+		d.logger.Error("failed to write metadata snapshot",
+			"err", err,
+			"path", d.metadataSnapshotPath,
+		)
+	}
+}
+
+// Assumes metaUpdateLock is held when called.
+func (d *badgerNodeDB) writeMetadataSnapshotLocked() error {
+	lastFinalizedVersion, finalized := d.meta.getLastFinalizedVersion()
+	if !finalized {
+		return nil
+	}
+
+	tx := d.db.NewTransactionAt(tsMetadata, false)
+	defer tx.Discard()
+
+	rootsMeta, err := loadRootsMetadata(tx, lastFinalizedVersion)
+	if err != nil {
+		return err
+	}
+
+	d.meta.RLock()
+	snapshot := metadataSnapshot{
+		Metadata: d.meta.value,
+		Roots:    rootsMeta.Roots,
+	}
+	// Non-finalized roots cannot be recovered from a snapshot and storage is derived again once
+	// the recovered database is opened.
+	snapshot.Metadata.NonFinalizedRoots = nil
+	snapshot.Metadata.Storage = nil
+	raw := cbor.Marshal(&snapshot)
+	d.meta.RUnlock()
+
+	return writeMetadataSnapshot(d.metadataSnapshotPath, raw)
+}
+
+// writeMetadataSnapshot atomically replaces the metadata snapshot file at the given path.
+func writeMetadataSnapshot(path string, raw []byte) error {
+	data := cbor.Marshal(&metadataSnapshotFile{
+		Checksum: hash.NewFromBytes(raw),
+		Snapshot: raw,
+	})
+
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// loadMetadataSnapshot loads and verifies the metadata snapshot file at the given path.
+func loadMetadataSnapshot(path string) (*metadataSnapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata snapshot: %w", err)
+	}
+
+	var file metadataSnapshotFile
+	if err = cbor.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: malformed snapshot file: %s", ErrInvalidMetadataSnapshot, err)
+	}
+	if checksum := hash.NewFromBytes(file.Snapshot); !checksum.Equal(&file.Checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMetadataSnapshot)
+	}
+
+	var snapshot metadataSnapshot
+	if err = cbor.Unmarshal(file.Snapshot, &snapshot); err != nil {
+		return nil, fmt.Errorf("%w: malformed snapshot: %s", ErrInvalidMetadataSnapshot, err)
+	}
+	return &snapshot, nil
+}
+
+// wipeMetadata removes all keys stored at the metadata timestamp.
+func (d *badgerNodeDB) wipeMetadata() error {
+	batch := d.db.NewWriteBatchAt(tsMetadata)
+	defer batch.Cancel()
+
+	for _, prefix := range [][]byte{
+		metadataKeyFmt.Encode(),
+		rootsMetadataKeyFmt.Encode(),
+		rootUpdatedNodesKeyFmt.Encode(),
+		multipartRestoreNodeLogKeyFmt.Encode(),
+		finalizeJournalKeyFmt.Encode(),
+		pendingCommitKeyFmt.Encode(),
+		versionStorageKeyFmt.Encode(),
+		keyFilterKeyFmt.Encode(),
+		flushedNodeKeyFmt.Encode(),
+	} {
+		if err := d.deleteWithPrefix(batch, tsMetadata, prefix); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// RecoverMetadata reconstructs the metadata of the database with the given configuration from
+// the metadata snapshot at snapshotPath and the root node and write log keys stored in the
+// database. The database must not be open and any metadata it still contains is replaced.
+//
+// The database is recovered to the last finalized version recorded in the snapshot. Roots
+// committed in later versions are removed, leaving behind any nodes only referenced by them.
+// Links between roots in earlier versions are only known exactly where write logs are available,
+// otherwise a root is conservatively assumed to be derived from all roots of the same type in
+// the same and the previous version, which may cause pruning to retain some unneeded nodes.
+func RecoverMetadata(ctx context.Context, cfg *api.Config, snapshotPath string) error {
+	if cfg.ReadOnly {
+		return api.ErrReadOnly
+	}
+
+	snapshot, err := loadMetadataSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+	if snapshot.Metadata.Version != dbVersion {
+		return fmt.Errorf("%w: incompatible database version (expected: %d got: %d)",
+			ErrInvalidMetadataSnapshot,
+			dbVersion,
+			snapshot.Metadata.Version,
+		)
+	}
+	if !snapshot.Metadata.Namespace.Equal(&cfg.Namespace) {
+		return fmt.Errorf("%w: incompatible namespace (expected: %s got: %s)",
+			ErrInvalidMetadataSnapshot,
+			cfg.Namespace,
+			snapshot.Metadata.Namespace,
+		)
+	}
+	if snapshot.Metadata.LastFinalizedVersion == nil {
+		return fmt.Errorf("%w: no finalized version", ErrInvalidMetadataSnapshot)
+	}
+
+	db := &badgerNodeDB{
+		logger:           logging.GetLogger("mkvs/db/badger/recover"),
+		namespace:        cfg.Namespace,
+		discardWriteLogs: cfg.DiscardWriteLogs,
+		nodeKeyShards:    snapshot.Metadata.NodeKeyShards,
+	}
+	opts := commonConfigToBadgerOptions(cfg, db)
+
+	if db.db, err = cmnBadger.OpenManaged(opts); err != nil {
+		return fmt.Errorf("mkvs/badger/recover: failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if err = db.recoverMetadata(ctx, snapshot); err != nil {
+		return fmt.Errorf("mkvs/badger/recover: %w", err)
+	}
+	return nil
+}
+
+// recoveredRoots are the roots reconstructed during metadata recovery, indexed by version.
+type recoveredRoots map[uint64]map[typedHash][]typedHash
+
+// link records that derivedRoot is derived from rootHash in the given version.
+func (rr recoveredRoots) link(version uint64, rootHash, derivedRoot typedHash) {
+	for _, h := range rr[version][rootHash] {
+		if h == derivedRoot {
+			return
+		}
+	}
+	rr[version][rootHash] = append(rr[version][rootHash], derivedRoot)
+}
+
+func (d *badgerNodeDB) recoverMetadata(ctx context.Context, snapshot *metadataSnapshot) error {
+	earliestVersion := snapshot.Metadata.EarliestVersion
+	lastFinalizedVersion := *snapshot.Metadata.LastFinalizedVersion
+
+	// Keys of roots committed after the snapshot was taken, indexed by version.
+	laterKeys := make(map[uint64][][]byte)
+
+	roots, err := d.recoverRoots(ctx, earliestVersion, lastFinalizedVersion, laterKeys)
+	if err != nil {
+		return err
+	}
+
+	// The roots of the last finalized version are known exactly.
+	for rootHash := range snapshot.Roots {
+		if _, ok := roots[lastFinalizedVersion][rootHash]; !ok {
+			return fmt.Errorf("%w: root %s of version %d not found in database",
+				ErrInvalidMetadataSnapshot, rootHash, lastFinalizedVersion,
+			)
+		}
+	}
+	roots[lastFinalizedVersion] = snapshot.Roots
+
+	hasParent, err := d.recoverLinks(ctx, roots, earliestVersion, lastFinalizedVersion, laterKeys)
+	if err != nil {
+		return err
+	}
+
+	// Conservatively link roots with an unknown parent to all roots they could be derived from.
+	for version := earliestVersion; version <= lastFinalizedVersion; version++ {
+		for rootHash := range roots[version] {
+			if hasParent[version][rootHash] {
+				continue
+			}
+			if version > earliestVersion {
+				for prevRoot := range roots[version-1] {
+					if prevRoot.Type() == rootHash.Type() {
+						roots.link(version-1, prevRoot, rootHash)
+					}
+				}
+			}
+			if version == lastFinalizedVersion {
+				continue
+			}
+			for otherRoot := range roots[version] {
+				if otherRoot != rootHash && otherRoot.Type() == rootHash.Type() {
+					roots.link(version, otherRoot, rootHash)
+				}
+			}
+		}
+	}
+
+	// Keep derived roots in a deterministic order.
+	for _, versionRoots := range roots {
+		for _, derivedRoots := range versionRoots {
+			sort.Slice(derivedRoots, func(i, j int) bool {
+				return bytes.Compare(derivedRoots[i][:], derivedRoots[j][:]) < 0
+			})
+		}
+	}
+
+	// Remove roots committed after the snapshot was taken as they cannot be recovered.
+	for version, keys := range laterKeys {
+		batch := d.db.NewWriteBatchAt(versionToTs(version))
+		for _, key := range keys {
+			if err = batch.Delete(key); err != nil {
+				batch.Cancel()
+				return err
+			}
+		}
+		if err = batch.Flush(); err != nil {
+			return fmt.Errorf("failed to remove keys of version %d: %w", version, err)
+		}
+	}
+
+	// Replace the metadata keyspace.
+	if err = d.wipeMetadata(); err != nil {
+		return fmt.Errorf("failed to remove existing metadata: %w", err)
+	}
+
+	batch := d.db.NewWriteBatchAt(tsMetadata)
+	defer batch.Cancel()
+
+	var numRoots int
+	for version, versionRoots := range roots {
+		if len(versionRoots) == 0 {
+			continue
+		}
+		rootsMeta := &rootsMetadata{version: version, Roots: versionRoots}
+		if err = batch.Set(rootsMetadataKeyFmt.Encode(version), cbor.Marshal(rootsMeta)); err != nil {
+			return err
+		}
+		numRoots += len(versionRoots)
+	}
+	if err = batch.Flush(); err != nil {
+		return fmt.Errorf("failed to save roots metadata: %w", err)
+	}
+
+	// Save the database metadata last, so the database can only be opened once recovery has
+	// completed.
+	d.meta.value = snapshot.Metadata
+	d.meta.value.MultipartVersion = multipartVersionNone
+	d.meta.value.NonFinalizedRoots = make(map[uint64]uint64)
+
+	tx := d.db.NewTransactionAt(tsMetadata, true)
+	defer tx.Discard()
+	if err = d.meta.save(tx); err != nil {
+		return err
+	}
+	if err = tx.CommitAt(tsMetadata, nil); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	d.logger.Info("recovered database metadata",
+		"earliest_version", earliestVersion,
+		"last_finalized_version", lastFinalizedVersion,
+		"num_roots", numRoots,
+		"removed_versions", len(laterKeys),
+	)
+	return nil
+}
+
+// recoverRoots reconstructs the set of roots in each version between earliestVersion and
+// lastFinalizedVersion (inclusive) from the root node keys, collecting keys of roots in later
+// versions into laterKeys.
+func (d *badgerNodeDB) recoverRoots(
+	ctx context.Context,
+	earliestVersion, lastFinalizedVersion uint64,
+	laterKeys map[uint64][][]byte,
+) (recoveredRoots, error) {
+	roots := make(recoveredRoots)
+	for version := earliestVersion; version <= lastFinalizedVersion; version++ {
+		roots[version] = make(map[typedHash][]typedHash)
+	}
+
+	tx := d.db.NewTransactionAt(maxTimestamp, false)
+	defer tx.Discard()
+
+	// Root node keys are written at the timestamp of each version the root was committed in.
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: rootNodeKeyFmt.Encode(), AllVersions: true})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		item := it.Item()
+		if item.IsDeletedOrExpired() {
+			continue
+		}
+		var rootHash typedHash
+		if !rootNodeKeyFmt.Decode(item.Key(), &rootHash) {
+			return nil, fmt.Errorf("undecodable root node key (%v)", item.Key())
+		}
+
+		version := tsToVersion(item.Version())
+		switch {
+		case version < earliestVersion:
+			continue
+		case version > lastFinalizedVersion:
+			laterKeys[version] = append(laterKeys[version], item.KeyCopy(nil))
+			continue
+		}
+
+		// Nodes of roots discarded during finalization have been removed, so only consider roots
+		// whose root node is still present.
+		if h := rootHash.Hash(); !h.IsEmpty() {
+			present, err := d.hasNodeAt(version, &h)
+			if err != nil {
+				return nil, err
+			}
+			if !present {
+				continue
+			}
+		}
+		roots[version][rootHash] = []typedHash{}
+	}
+	return roots, nil
+}
+
+// recoverLinks reconstructs the links between roots from the write log keys and returns the set
+// of roots in each version whose parent is known, collecting keys of write logs in later versions
+// into laterKeys.
+func (d *badgerNodeDB) recoverLinks(
+	ctx context.Context,
+	roots recoveredRoots,
+	earliestVersion, lastFinalizedVersion uint64,
+	laterKeys map[uint64][][]byte,
+) (map[uint64]map[typedHash]bool, error) {
+	hasParent := make(map[uint64]map[typedHash]bool)
+	if d.discardWriteLogs {
+		return hasParent, nil
+	}
+
+	tx := d.db.NewTransactionAt(maxTimestamp, false)
+	defer tx.Discard()
+
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: writeLogKeyFmt.Encode()})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var (
+			version          uint64
+			rootHash, parent typedHash
+		)
+		if !writeLogKeyFmt.Decode(it.Item().Key(), &version, &rootHash, &parent) {
+			return nil, fmt.Errorf("undecodable write log key (%v)", it.Item().Key())
+		}
+		switch {
+		case version < earliestVersion:
+			continue
+		case version > lastFinalizedVersion:
+			laterKeys[version] = append(laterKeys[version], it.Item().KeyCopy(nil))
+			continue
+		}
+		if _, ok := roots[version][rootHash]; !ok {
+			continue
+		}
+
+		// The parent is either in the same or in the previous version. In case it is present in
+		// both, link it in both versions.
+		var found bool
+		if h := parent.Hash(); h.IsEmpty() {
+			found = true
+		}
+		if _, ok := roots[version][parent]; ok && parent != rootHash && version != lastFinalizedVersion {
+			roots.link(version, parent, rootHash)
+			found = true
+		}
+		if version > earliestVersion {
+			if _, ok := roots[version-1][parent]; ok {
+				roots.link(version-1, parent, rootHash)
+				found = true
+			}
+		}
+		if found {
+			if hasParent[version] == nil {
+				hasParent[version] = make(map[typedHash]bool)
+			}
+			hasParent[version][rootHash] = true
+		}
+	}
+
+	return hasParent, nil
+}
+
+// hasNodeAt returns true iff the node with the given hash is present in the given version.
+func (d *badgerNodeDB) hasNodeAt(version uint64, h *hash.Hash) (bool, error) {
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+
+	switch _, err := tx.Get(d.nodeKey(h)); err {
+	case nil:
+		return true, nil
+	case badger.ErrKeyNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check node %s: %w", h, err)
+	}
+}
@@ -0,0 +1,162 @@
+package badger
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+func newMetadataSnapshotTest(t *testing.T) (*require.Assertions, *api.Config) {
+	require, cfg := newOpenCheckTest(t)
+	// Use a subdirectory so that the snapshot written next to the database is cleaned up too.
+	cfg.DB = filepath.Join(cfg.DB, "db")
+	cfg.MetadataSnapshot = true
+	return require, cfg
+}
+
+func versionValues(version uint64) [][]byte {
+	values := make([][]byte, 0, len(testValues))
+	for _, v := range testValues {
+		values = append(values, []byte(fmt.Sprintf("%s %d", v, version)))
+	}
+	return values
+}
+
+func verifyRecoveredRoot(ctx context.Context, require *require.Assertions, ndb api.NodeDB, root node.Root) {
+	require.True(ndb.HasRoot(root), "HasRoot(%d)", root.Version)
+
+	tree := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	for i, expected := range versionValues(root.Version) {
+		value, err := tree.Get(ctx, []byte(strconv.Itoa(i)))
+		require.NoError(err, "Get(%d) at version %d", i, root.Version)
+		require.Equal(expected, value, "value %d at version %d", i, root.Version)
+	}
+}
+
+func TestRecoverMetadata(t *testing.T) {
+	t.Run("WriteLogs", func(t *testing.T) { testRecoverMetadata(t, false) })
+	// Without write logs, links between roots need to be reconstructed conservatively.
+	t.Run("DiscardWriteLogs", func(t *testing.T) { testRecoverMetadata(t, true) })
+}
+
+func testRecoverMetadata(t *testing.T, discardWriteLogs bool) {
+	ctx := context.Background()
+	require, cfg := newMetadataSnapshotTest(t)
+	cfg.DiscardWriteLogs = discardWriteLogs
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	// Finalize a few versions, discarding an alternative root in one of them, and prune the
+	// earliest one.
+	var (
+		roots         []node.Root
+		prevRoot      *node.Root
+		discardedRoot node.Root
+	)
+	for version := uint64(0); version < 5; version++ {
+		root := fillDB(ctx, require, versionValues(version+1), prevRoot, version, version+1, ndb)
+		if version == 2 {
+			discardedRoot = fillDB(ctx, require, testValues, prevRoot, version, version+1, ndb)
+		}
+		err = ndb.Finalize(ctx, []node.Root{root})
+		require.NoError(err, "Finalize(%d)", root.Version)
+
+		roots = append(roots, root)
+		prevRoot = &roots[len(roots)-1]
+	}
+	err = ndb.Prune(ctx, roots[0].Version)
+	require.NoError(err, "Prune(%d)", roots[0].Version)
+	roots = roots[1:]
+
+	// Commit a version that is not finalized when the snapshot is used for recovery.
+	lastRoot := roots[len(roots)-1]
+	unfinalizedRoot := fillDB(ctx, require, versionValues(lastRoot.Version+1), &lastRoot, lastRoot.Version, lastRoot.Version+1, ndb)
+
+	earliestVersion, err := ndb.GetEarliestVersion(ctx)
+	require.NoError(err, "GetEarliestVersion()")
+	latestVersion, err := ndb.GetLatestVersion(ctx)
+	require.NoError(err, "GetLatestVersion()")
+
+	// Lose all metadata.
+	err = ndb.(*badgerNodeDB).wipeMetadata()
+	require.NoError(err, "wipeMetadata()")
+	require.False(ndb.HasRoot(lastRoot), "roots should not be available without metadata")
+	ndb.Close()
+
+	err = RecoverMetadata(ctx, cfg, MetadataSnapshotPath(cfg.DB))
+	require.NoError(err, "RecoverMetadata()")
+
+	strictCfg := *cfg
+	strictCfg.StrictOpen = true
+	ndb, err = New(&strictCfg)
+	require.NoError(err, "New() after recovery")
+	defer ndb.Close()
+
+	version, err := ndb.GetEarliestVersion(ctx)
+	require.NoError(err, "GetEarliestVersion()")
+	require.Equal(earliestVersion, version, "earliest version should be recovered")
+	version, err = ndb.GetLatestVersion(ctx)
+	require.NoError(err, "GetLatestVersion()")
+	require.Equal(latestVersion, version, "latest version should be recovered")
+
+	for _, root := range roots {
+		verifyRecoveredRoot(ctx, require, ndb, root)
+	}
+	require.False(ndb.HasRoot(discardedRoot), "discarded root should not be recovered")
+	require.False(ndb.HasRoot(unfinalizedRoot), "unfinalized root should not be recovered")
+
+	// The recovered database should remain fully usable.
+	nextRoot := fillDB(ctx, require, versionValues(lastRoot.Version+1), &lastRoot, lastRoot.Version, lastRoot.Version+1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{nextRoot})
+	require.NoError(err, "Finalize() after recovery")
+	verifyRecoveredRoot(ctx, require, ndb, nextRoot)
+
+	for _, root := range roots {
+		err = ndb.Prune(ctx, root.Version)
+		require.NoError(err, "Prune(%d) after recovery", root.Version)
+	}
+	verifyRecoveredRoot(ctx, require, ndb, nextRoot)
+}
+
+func TestRecoverMetadataInvalidSnapshot(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newMetadataSnapshotTest(t)
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+	root := fillDB(ctx, require, testValues, nil, 0, 1, ndb)
+	err = ndb.Finalize(ctx, []node.Root{root})
+	require.NoError(err, "Finalize()")
+	ndb.Close()
+
+	path := MetadataSnapshotPath(cfg.DB)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(err, "ReadFile()")
+
+	// Corrupt the snapshot.
+	data[len(data)-1]++
+	err = ioutil.WriteFile(path, data, 0o600)
+	require.NoError(err, "WriteFile()")
+	err = RecoverMetadata(ctx, cfg, path)
+	require.ErrorIs(err, ErrInvalidMetadataSnapshot, "RecoverMetadata() with a corrupted snapshot")
+
+	// Use a snapshot for a different namespace.
+	data[len(data)-1]--
+	err = ioutil.WriteFile(path, data, 0o600)
+	require.NoError(err, "WriteFile()")
+	otherCfg := *cfg
+	otherCfg.Namespace[0]++
+	err = RecoverMetadata(ctx, &otherCfg, path)
+	require.ErrorIs(err, ErrInvalidMetadataSnapshot, "RecoverMetadata() with a different namespace")
+}
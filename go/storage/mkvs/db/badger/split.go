@@ -0,0 +1,174 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// splitEntryOverhead is the per-entry overhead used when estimating transaction sizes. It is an
+// upper bound on what Badger accounts for each entry on top of its key and value.
+const splitEntryOverhead = 12
+
+// splitEntry is an entry written by a split transaction.
+type splitEntry struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// writeTo writes the entry in the given transaction.
+func (e *splitEntry) writeTo(tx *badger.Txn) error {
+	if e.delete {
+		return tx.Delete(e.key)
+	}
+	return tx.Set(e.key, e.value)
+}
+
+func (e *splitEntry) size() int64 {
+	return int64(len(e.key) + len(e.value) + splitEntryOverhead)
+}
+
+// splitTxn writes entries at a single timestamp, transparently splitting the writes across as
+// many Badger transactions as needed to stay within the transaction size limits.
+//
+// When a marker key is configured, the marker is written by the first sub-transaction in case the
+// writes end up being split and is only removed by the final sub-transaction. This makes it
+// possible to detect (and clean up after) split writes that have been interrupted.
+type splitTxn struct {
+	db *badger.DB
+	ts uint64
+
+	maxSize  int64
+	maxCount int64
+
+	// marker is the optional pending marker key.
+	marker []byte
+	// splitHook is invoked after each intermediate sub-transaction has been committed in case it
+	// is set. Returning an error aborts the write, which is used in tests to simulate crashes.
+	splitHook func() error
+
+	txn    *badger.Txn
+	size   int64
+	count  int64
+	splits int
+}
+
+// write writes the given entries within the same sub-transaction, committing the current
+// sub-transaction first in case the entries would not fit into it.
+func (st *splitTxn) write(entries ...splitEntry) error {
+	var size int64
+	for i := range entries {
+		size += entries[i].size()
+	}
+	if st.count > 0 && (st.size+size >= st.maxSize || st.count+int64(len(entries)) >= st.maxCount) {
+		if err := st.split(); err != nil {
+			return err
+		}
+	}
+
+	for i := range entries {
+		err := st.writeEntry(&entries[i])
+		if errors.Is(err, badger.ErrTxnTooBig) && i == 0 && st.count > 0 {
+			// Our estimate was off, retry in a fresh sub-transaction.
+			if err = st.split(); err != nil {
+				return err
+			}
+			err = st.writeEntry(&entries[i])
+		}
+		if err != nil {
+			return err
+		}
+		st.size += entries[i].size()
+		st.count++
+	}
+	return nil
+}
+
+func (st *splitTxn) writeEntry(e *splitEntry) error {
+	return e.writeTo(st.txn)
+}
+
+// Set writes the given key.
+func (st *splitTxn) Set(key, value []byte) error {
+	return st.write(splitEntry{key: key, value: value})
+}
+
+// Delete removes the given key.
+func (st *splitTxn) Delete(key []byte) error {
+	return st.write(splitEntry{key: key, delete: true})
+}
+
+// split commits the current sub-transaction and starts a new one.
+func (st *splitTxn) split() error {
+	if st.marker != nil && st.splits == 0 {
+		if err := st.txn.Set(st.marker, []byte{}); err != nil {
+			return fmt.Errorf("mkvs/badger: failed to set pending marker: %w", err)
+		}
+	}
+	if err := st.txn.CommitAt(st.ts, nil); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to commit sub-transaction: %w", err)
+	}
+	st.splits++
+	st.reset()
+
+	if st.splitHook != nil {
+		return st.splitHook()
+	}
+	return nil
+}
+
+func (st *splitTxn) reset() {
+	st.txn = st.db.NewTransactionAt(st.ts, true)
+	st.size = 0
+	st.count = 0
+}
+
+// Flush commits all entries written so far, without waiting for the final commit.
+//
+// NOTE: Flushing counts as a split.
+func (st *splitTxn) Flush() error {
+	if st.count == 0 {
+		return nil
+	}
+	return st.split()
+}
+
+// Commit commits the final sub-transaction, removing the pending marker in case the writes have
+// been split.
+func (st *splitTxn) Commit() error {
+	if st.marker != nil && st.splits > 0 {
+		if err := st.txn.Delete(st.marker); err != nil {
+			return fmt.Errorf("mkvs/badger: failed to remove pending marker: %w", err)
+		}
+	}
+	if err := st.txn.CommitAt(st.ts, nil); err != nil {
+		return err
+	}
+	st.reset()
+	st.splits = 0
+	return nil
+}
+
+// Discard discards any entries that have not yet been committed.
+func (st *splitTxn) Discard() {
+	st.txn.Discard()
+}
+
+// newSplitTxn creates a new split transaction writing at the given timestamp.
+func (d *badgerNodeDB) newSplitTxn(ts uint64) *splitTxn {
+	maxSize := d.db.MaxBatchSize()
+	if d.maxTransactionSize > 0 && d.maxTransactionSize < maxSize {
+		maxSize = d.maxTransactionSize
+	}
+
+	st := &splitTxn{
+		db:       d.db,
+		ts:       ts,
+		maxSize:  maxSize,
+		maxCount: d.db.MaxBatchCount(),
+	}
+	st.reset()
+	return st
+}
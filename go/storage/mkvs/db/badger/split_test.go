@@ -0,0 +1,216 @@
+package badger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// splitTestValues generates values for a tree that is large enough to require many splits when
+// using a tiny maximum transaction size.
+func splitTestValues() [][]byte {
+	values := make([][]byte, 0, 2000)
+	for i := 0; i < cap(values); i++ {
+		values = append(values, []byte(fmt.Sprintf("split test value %d", i)))
+	}
+	return values
+}
+
+// commitSplitTest commits the given values into a fresh root at version 0.
+func commitSplitTest(ctx context.Context, ndb api.NodeDB, values [][]byte) (node.Root, error) {
+	root := node.Root{
+		Namespace: testNs,
+		Type:      node.RootTypeState,
+	}
+	root.Hash.Empty()
+
+	tree := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	for i, val := range values {
+		if err := tree.Insert(ctx, []byte(fmt.Sprintf("%d", i)), val); err != nil {
+			return root, err
+		}
+	}
+
+	var err error
+	_, root.Hash, err = tree.Commit(ctx, testNs, 0)
+	return root, err
+}
+
+// verifySplitTest checks that all values are present under the given root.
+func verifySplitTest(ctx context.Context, require *require.Assertions, ndb api.NodeDB, root node.Root, values [][]byte) {
+	tree := mkvs.NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	for i, val := range values {
+		value, err := tree.Get(ctx, []byte(fmt.Sprintf("%d", i)))
+		require.NoError(err, "Get")
+		require.Equal(val, value, "committed value should be readable")
+	}
+}
+
+// expectedSplitTestRoot returns the root resulting from committing the given values without any
+// artificial transaction size limits.
+func expectedSplitTestRoot(ctx context.Context, t *testing.T, values [][]byte) node.Root {
+	cfg := *dbCfg
+	cfg.Namespace = testNs
+	ndb, err := New(&cfg)
+	require.NoError(t, err, "New()")
+	defer ndb.Close()
+
+	root, err := commitSplitTest(ctx, ndb, values)
+	require.NoError(t, err, "Commit")
+	return root
+}
+
+func TestSplitCommit(t *testing.T) {
+	ctx := context.Background()
+	values := splitTestValues()
+	expectedRoot := expectedSplitTestRoot(ctx, t, values)
+
+	require, cfg := newOpenCheckTest(t)
+	cfg.Namespace = testNs
+	cfg.MaxTransactionSize = 1024
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	var splits int
+	ndb.(*badgerNodeDB).commitSplitHook = func() error {
+		splits++
+		return nil
+	}
+	root, err := commitSplitTest(ctx, ndb, values)
+	require.NoError(err, "Commit")
+	require.Equal(expectedRoot.Hash, root.Hash, "root hash should not depend on transaction splitting")
+	require.NotZero(splits, "metadata updates should be split")
+	require.True(ndb.HasRoot(root), "committed root should exist")
+	rootHash := typedHashFromRoot(root)
+	require.False(hasMetaKey(require, ndb, pendingCommitKeyFmt.Encode(root.Version, &rootHash)), "pending commit marker should be removed")
+	verifySplitTest(ctx, require, ndb, root, values)
+
+	invalidCfg := *cfg
+	invalidCfg.MaxTransactionSize = -1
+	_, err = New(&invalidCfg)
+	require.Error(err, "New() should fail with a negative maximum transaction size")
+}
+
+func TestSplitCommitCrashRecovery(t *testing.T) {
+	ctx := context.Background()
+	values := splitTestValues()
+	root := expectedSplitTestRoot(ctx, t, values)
+	rootHash := typedHashFromRoot(root)
+	markerKey := pendingCommitKeyFmt.Encode(root.Version, &rootHash)
+	updatedNodesKey := rootUpdatedNodesKeyFmt.Encode(root.Version, &rootHash)
+
+	require, cfg := newOpenCheckTest(t)
+	cfg.Namespace = testNs
+	cfg.MaxTransactionSize = 1024
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	// Simulate a crash after the first metadata sub-transaction has been committed.
+	ndb.(*badgerNodeDB).commitSplitHook = func() error {
+		return errSimulatedCrash
+	}
+	_, err = commitSplitTest(ctx, ndb, values)
+	require.ErrorIs(err, errSimulatedCrash, "Commit should be interrupted")
+	require.True(hasMetaKey(require, ndb, markerKey), "pending commit marker should be written")
+	require.False(ndb.HasRoot(root), "interrupted root should not exist")
+	ndb.Close()
+
+	// Opening in strict mode should fail.
+	strictCfg := *cfg
+	strictCfg.StrictOpen = true
+	_, err = New(&strictCfg)
+	require.ErrorIs(err, ErrInconsistentDatabase, "New() should fail in strict mode")
+
+	// Opening normally should clean up after the interrupted commit.
+	ndb, err = New(cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	require.False(hasMetaKey(require, ndb, markerKey), "pending commit marker should be removed")
+	require.False(hasMetaKey(require, ndb, updatedNodesKey), "updated nodes index should be removed")
+	require.False(ndb.HasRoot(root), "interrupted root should not exist")
+
+	// Retrying the commit should succeed.
+	root, err = commitSplitTest(ctx, ndb, values)
+	require.NoError(err, "Commit")
+	require.True(ndb.HasRoot(root), "committed root should exist")
+	require.False(hasMetaKey(require, ndb, markerKey), "pending commit marker should be removed")
+	verifySplitTest(ctx, require, ndb, root, values)
+}
+
+func TestSplitCommitConcurrent(t *testing.T) {
+	ctx := context.Background()
+	values := splitTestValues()
+
+	require, cfg := newOpenCheckTest(t)
+	cfg.Namespace = testNs
+	cfg.MaxTransactionSize = 1024
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+	badgerdb := ndb.(*badgerNodeDB)
+
+	var splits uint64
+	badgerdb.commitSplitHook = func() error {
+		atomic.AddUint64(&splits, 1)
+		return nil
+	}
+
+	baseRoot, err := commitSplitTest(ctx, ndb, values[:100])
+	require.NoError(err, "Commit")
+	err = ndb.Finalize(ctx, []node.Root{baseRoot})
+	require.NoError(err, "Finalize()")
+
+	// Commit split roots derived from the same root into the same version in parallel. The roots
+	// metadata of both versions is updated by every commit, so no update may be lost.
+	const numTrees = 8
+	var wg sync.WaitGroup
+	errCh := make(chan error, numTrees)
+	for w := 0; w < numTrees; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			tree := mkvs.NewWithRoot(nil, ndb, baseRoot)
+			defer tree.Close()
+			for i, val := range values {
+				if err := tree.Insert(ctx, []byte(fmt.Sprintf("%d %d", w, i)), val); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			if _, _, err := tree.Commit(ctx, testNs, 1); err != nil {
+				errCh <- err
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(err, "concurrent commits should succeed")
+	}
+	require.NotZero(atomic.LoadUint64(&splits), "metadata updates should be split")
+
+	tx := badgerdb.db.NewTransactionAt(versionToTs(1), false)
+	defer tx.Discard()
+	rootsMeta, err := loadRootsMetadata(tx, 0)
+	require.NoError(err, "loadRootsMetadata()")
+	require.Len(rootsMeta.Roots[typedHashFromRoot(baseRoot)], numTrees, "all roots should be derived from the base root")
+	rootsMeta, err = loadRootsMetadata(tx, 1)
+	require.NoError(err, "loadRootsMetadata()")
+	require.Len(rootsMeta.Roots, numTrees, "all roots should be registered")
+	for rootHash := range rootsMeta.Roots {
+		require.False(hasMetaKey(require, ndb, pendingCommitKeyFmt.Encode(uint64(1), &rootHash)), "pending commit marker should be removed")
+	}
+}
@@ -0,0 +1,473 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+)
+
+// storageTotals is the total storage used by nodes and write logs.
+type storageTotals struct {
+	// NodeBytes is the total size of all stored nodes.
+	NodeBytes uint64 `json:"node_bytes"`
+	// WriteLogBytes is the total size of all stored write logs.
+	WriteLogBytes uint64 `json:"write_log_bytes"`
+}
+
+// versionStorage is the storage used by nodes and write logs written in a given version.
+//
+// NOTE: Public fields of this structure are part of the on-disk format.
+type versionStorage struct {
+	_ struct{} `cbor:",toarray"` // nolint
+
+	NodeBytes     uint64
+	WriteLogBytes uint64
+}
+
+// loadVersionStorage loads the storage used by the given version from the database.
+func loadVersionStorage(tx *badger.Txn, version uint64) (*versionStorage, error) {
+	var vs versionStorage
+	item, err := tx.Get(versionStorageKeyFmt.Encode(version))
+	switch err {
+	case nil:
+		if err = item.Value(func(val []byte) error { return cbor.UnmarshalTrusted(val, &vs) }); err != nil {
+			return nil, fmt.Errorf("mkvs/badger: error reading version storage: %w", err)
+		}
+	case badger.ErrKeyNotFound:
+	default:
+		return nil, fmt.Errorf("mkvs/badger: error reading version storage: %w", err)
+	}
+	return &vs, nil
+}
+
+// storageDelta collects the changes to the storage used by nodes and write logs in each version.
+//
+// Storage accounts for the nodes and write logs visible in the latest version, attributed to the
+// version in which they were written. Sizes are the sizes of the stored keys and values.
+type storageDelta struct {
+	db *badger.DB
+
+	nodeBytes     map[uint64]int64
+	writeLogBytes map[uint64]int64
+
+	// removed is the set of keys whose removal has already been recorded.
+	removed map[string]bool
+	// added is the size of the keys which did not exist when they were recorded as written.
+	added map[string]int64
+}
+
+func newStorageDelta(db *badger.DB) *storageDelta {
+	return &storageDelta{
+		db:            db,
+		nodeBytes:     make(map[uint64]int64),
+		writeLogBytes: make(map[uint64]int64),
+		removed:       make(map[string]bool),
+		added:         make(map[string]int64),
+	}
+}
+
+func (sd *storageDelta) change(version uint64, key []byte, size int64) {
+	switch {
+	case bytes.HasPrefix(key, nodeKeyFmt.Encode()), bytes.HasPrefix(key, shardedNodeKeyFmt.Encode()):
+		sd.nodeBytes[version] += size
+	case bytes.HasPrefix(key, writeLogKeyFmt.Encode()), bytes.HasPrefix(key, detachedWriteLogKeyFmt.Encode()):
+		sd.writeLogBytes[version] += size
+	}
+}
+
+// latest returns the given key as visible in the latest version, or nil in case it does not exist.
+func (sd *storageDelta) latest(key []byte) (*badger.Item, int, error) {
+	tx := sd.db.NewTransactionAt(maxTimestamp, false)
+	defer tx.Discard()
+
+	item, err := tx.Get(key)
+	switch err {
+	case nil:
+	case badger.ErrKeyNotFound:
+		return nil, 0, nil
+	default:
+		return nil, 0, err
+	}
+
+	// Item.ValueSize is only an estimate for values stored in the value log.
+	var size int
+	if err = item.Value(func(val []byte) error {
+		size = len(val)
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+	return item, size, nil
+}
+
+// put records a node or write log entry about to be written in the given version.
+func (sd *storageDelta) put(version uint64, key, value []byte) error {
+	item, size, err := sd.latest(key)
+	if err != nil {
+		return err
+	}
+	if item != nil {
+		if item.Version() > versionToTs(version) {
+			// Writing an earlier version does not change the latest version.
+			return nil
+		}
+		// The entry is replaced, e.g. when the same node is written again.
+		sd.change(tsToVersion(item.Version()), key, -int64(len(key)+size))
+	} else {
+		sd.added[string(key)] = int64(len(key) + len(value))
+	}
+	sd.change(version, key, int64(len(key)+len(value)))
+	return nil
+}
+
+// remove records the removal of the given node or write log key in the given version.
+func (sd *storageDelta) remove(version uint64, key []byte) error {
+	if sd.removed[string(key)] {
+		return nil
+	}
+	item, size, err := sd.latest(key)
+	if err != nil {
+		return err
+	}
+	if item == nil || item.Version() > versionToTs(version) {
+		// Removing the entry in an earlier version does not change the latest version.
+		return nil
+	}
+	sd.removed[string(key)] = true
+	sd.change(tsToVersion(item.Version()), key, -int64(len(key)+size))
+	return nil
+}
+
+func (sd *storageDelta) versions() []uint64 {
+	versions := make([]uint64, 0, len(sd.nodeBytes)+len(sd.writeLogBytes))
+	for v, size := range sd.nodeBytes {
+		if size != 0 {
+			versions = append(versions, v)
+		}
+	}
+	for v, size := range sd.writeLogBytes {
+		if size != 0 && sd.nodeBytes[v] == 0 {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions
+}
+
+// storageTracker reconciles the storage accounted for by batches written concurrently.
+//
+// Batches determine whether the keys they write are new at the time they are written, so batches
+// which concurrently write the same new key (e.g., a node shared by independent roots) would all
+// account for it. Keys accounted for as new by committed batches are therefore remembered for as
+// long as any batch which started writing before the commit is still in progress, so that their
+// storage is only accounted for once.
+type storageTracker struct {
+	sync.Mutex
+
+	// gen is the number of commits so far.
+	gen uint64
+	// active is the number of batches being written by the generation in which they started.
+	active map[uint64]int
+	// accounted are the keys accounted for as new by recent commits.
+	accounted map[string]trackedKey
+}
+
+type trackedKey struct {
+	gen     uint64
+	version uint64
+}
+
+func newStorageTracker() *storageTracker {
+	return &storageTracker{
+		active:    make(map[uint64]int),
+		accounted: make(map[string]trackedKey),
+	}
+}
+
+// begin registers a batch which starts writing and returns its generation.
+func (st *storageTracker) begin() uint64 {
+	st.Lock()
+	defer st.Unlock()
+
+	st.active[st.gen]++
+	return st.gen
+}
+
+// end unregisters a batch which started writing in the given generation without committing.
+func (st *storageTracker) end(gen uint64) {
+	st.Lock()
+	defer st.Unlock()
+
+	st.endLocked(gen)
+}
+
+func (st *storageTracker) endLocked(gen uint64) {
+	st.active[gen]--
+	if st.active[gen] <= 0 {
+		delete(st.active, gen)
+	}
+
+	if len(st.active) == 0 {
+		if len(st.accounted) > 0 {
+			st.accounted = make(map[string]trackedKey)
+		}
+		return
+	}
+	minGen := st.gen
+	for gen := range st.active {
+		if gen < minGen {
+			minGen = gen
+		}
+	}
+	for key, tk := range st.accounted {
+		if tk.gen <= minGen {
+			delete(st.accounted, key)
+		}
+	}
+}
+
+// commit reconciles the storage delta of a batch which started writing in the given generation
+// and is being committed into the given version, and unregisters the batch.
+//
+// The caller must serialize commits (e.g., by holding metaUpdateLock).
+func (st *storageTracker) commit(version uint64, sd *storageDelta, gen uint64) {
+	st.Lock()
+	defer st.Unlock()
+
+	st.gen++
+	track := st.active[gen] > 1 || len(st.active) > 1
+	for key, size := range sd.added {
+		if tk, ok := st.accounted[key]; ok && tk.gen > gen {
+			// The key has been accounted for by a batch committed after this batch started.
+			sd.change(version, []byte(key), -size)
+			continue
+		}
+		if track {
+			st.accounted[key] = trackedKey{gen: st.gen, version: version}
+		}
+	}
+	st.endLocked(gen)
+}
+
+// finalized forgets about keys accounted for in versions up to the given finalized version, as
+// they may have been discarded during finalization.
+func (st *storageTracker) finalized(version uint64) {
+	st.Lock()
+	defer st.Unlock()
+
+	for key, tk := range st.accounted {
+		if tk.version <= version {
+			delete(st.accounted, key)
+		}
+	}
+}
+
+func applySizeDelta(size uint64, delta int64) uint64 {
+	if delta < 0 && uint64(-delta) > size {
+		return 0
+	}
+	return size + uint64(delta)
+}
+
+// updateStorage applies the given storage delta to the storage totals and returns the split
+// transaction entries for saving the storage of the affected versions. The caller is responsible
+// for also saving the metadata.
+func (m *metadata) updateStorage(tx *badger.Txn, sd *storageDelta) ([]splitEntry, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.updateStorageLocked(tx, sd)
+}
+
+func (m *metadata) updateStorageLocked(tx *badger.Txn, sd *storageDelta) ([]splitEntry, error) {
+	if m.value.Storage == nil {
+		// Storage is not tracked yet, it will be derived once the database is reopened.
+		return nil, nil
+	}
+
+	versions := sd.versions()
+	entries := make([]splitEntry, 0, len(versions))
+	for _, version := range versions {
+		vs, err := loadVersionStorage(tx, version)
+		if err != nil {
+			return nil, err
+		}
+
+		nodeDelta, writeLogDelta := sd.nodeBytes[version], sd.writeLogBytes[version]
+		vs.NodeBytes = applySizeDelta(vs.NodeBytes, nodeDelta)
+		vs.WriteLogBytes = applySizeDelta(vs.WriteLogBytes, writeLogDelta)
+		m.value.Storage.NodeBytes = applySizeDelta(m.value.Storage.NodeBytes, nodeDelta)
+		m.value.Storage.WriteLogBytes = applySizeDelta(m.value.Storage.WriteLogBytes, writeLogDelta)
+
+		key := versionStorageKeyFmt.Encode(version)
+		switch {
+		case vs.NodeBytes == 0 && vs.WriteLogBytes == 0:
+			entries = append(entries, splitEntry{key: key, delete: true})
+		default:
+			entries = append(entries, splitEntry{key: key, value: cbor.Marshal(vs)})
+		}
+	}
+	return entries, nil
+}
+
+// applyStorage applies the given storage delta and saves the storage of the affected versions
+// together with the metadata.
+func (m *metadata) applyStorage(tx *badger.Txn, sd *storageDelta) error {
+	m.Lock()
+	defer m.Unlock()
+
+	entries, err := m.updateStorageLocked(tx, sd)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	for i := range entries {
+		if err = entries[i].writeTo(tx); err != nil {
+			return err
+		}
+	}
+	return m.save(tx)
+}
+
+func (m *metadata) getStorageTotals() (storageTotals, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.value.Storage == nil {
+		return storageTotals{}, false
+	}
+	return *m.value.Storage, true
+}
+
+// deriveStorage derives the storage used by nodes and write logs in each version from the stored
+// nodes and write logs. This is only needed in case the metadata does not track storage yet.
+func (d *badgerNodeDB) deriveStorage() error {
+	d.metaUpdateLock.Lock()
+	defer d.metaUpdateLock.Unlock()
+
+	if _, tracked := d.meta.getStorageTotals(); tracked {
+		return nil
+	}
+
+	sd := newStorageDelta(d.db)
+	if err := func() error {
+		tx := d.db.NewTransactionAt(maxTimestamp, false)
+		defer tx.Discard()
+
+		for _, prefix := range [][]byte{
+			nodeKeyFmt.Encode(),
+			shardedNodeKeyFmt.Encode(),
+			writeLogKeyFmt.Encode(),
+			detachedWriteLogKeyFmt.Encode(),
+		} {
+			if err := func() error {
+				it := tx.NewIterator(badger.IteratorOptions{Prefix: prefix})
+				defer it.Close()
+
+				for it.Rewind(); it.Valid(); it.Next() {
+					item := it.Item()
+					if err := item.Value(func(val []byte) error {
+						sd.change(tsToVersion(item.Version()), item.Key(), int64(len(item.Key())+len(val)))
+						return nil
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}(); err != nil {
+		return fmt.Errorf("mkvs/badger: failed to derive storage: %w", err)
+	}
+
+	// Remove any storage left behind by an interrupted derivation.
+	batch := d.db.NewWriteBatchAt(tsMetadata)
+	defer batch.Cancel()
+	if err := d.deleteWithPrefix(batch, tsMetadata, versionStorageKeyFmt.Encode()); err != nil {
+		return err
+	}
+	if err := batch.Flush(); err != nil {
+		return err
+	}
+
+	// Storage of all versions needs to be written before the metadata starts tracking it.
+	tx := d.db.NewTransactionAt(tsMetadata, false)
+	defer tx.Discard()
+
+	d.meta.Lock()
+	defer d.meta.Unlock()
+
+	d.meta.value.Storage = &storageTotals{}
+	entries, err := d.meta.updateStorageLocked(tx, sd)
+	if err != nil {
+		d.meta.value.Storage = nil
+		return err
+	}
+	metaTx := d.newSplitTxn(tsMetadata)
+	defer metaTx.Discard()
+	entries = append(entries, splitEntry{key: metadataKeyFmt.Encode(), value: cbor.Marshal(d.meta.value)})
+	for i := range entries {
+		if err = metaTx.write(entries[i]); err != nil {
+			d.meta.value.Storage = nil
+			return err
+		}
+	}
+	if err = metaTx.Commit(); err != nil {
+		d.meta.value.Storage = nil
+		return err
+	}
+	return nil
+}
+
+func (d *badgerNodeDB) StorageBreakdown(ctx context.Context) (*api.StorageBreakdown, error) {
+	totals, tracked := d.meta.getStorageTotals()
+	if !tracked {
+		return nil, fmt.Errorf("%w: storage is not tracked by the database", api.ErrNotSupported)
+	}
+
+	tx := d.db.NewTransactionAt(tsMetadata, false)
+	defer tx.Discard()
+
+	breakdown := &api.StorageBreakdown{
+		NodeBytes:     totals.NodeBytes,
+		WriteLogBytes: totals.WriteLogBytes,
+	}
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: versionStorageKeyFmt.Encode(), PrefetchValues: true})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var version uint64
+		if !versionStorageKeyFmt.Decode(it.Item().Key(), &version) {
+			// This should not happen as the Badger iterator should take care of it.
+			panic("mkvs/badger: bad iterator")
+		}
+		var vs versionStorage
+		if err := it.Item().Value(func(val []byte) error { return cbor.UnmarshalTrusted(val, &vs) }); err != nil {
+			return nil, fmt.Errorf("mkvs/badger: error reading version storage: %w", err)
+		}
+		breakdown.Versions = append(breakdown.Versions, api.VersionStorage{
+			Version:       version,
+			NodeBytes:     vs.NodeBytes,
+			WriteLogBytes: vs.WriteLogBytes,
+		})
+	}
+	return breakdown, nil
+}
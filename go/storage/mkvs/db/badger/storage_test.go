@@ -0,0 +1,212 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+// scanStorage returns the storage used by nodes and write logs in each version by scanning all
+// stored nodes and write logs.
+func scanStorage(require *require.Assertions, ndb *badgerNodeDB) map[uint64]api.VersionStorage {
+	tx := ndb.db.NewTransactionAt(maxTimestamp, false)
+	defer tx.Discard()
+
+	versions := make(map[uint64]api.VersionStorage)
+	for _, prefix := range [][]byte{
+		nodeKeyFmt.Encode(),
+		writeLogKeyFmt.Encode(),
+		detachedWriteLogKeyFmt.Encode(),
+	} {
+		it := tx.NewIterator(badger.IteratorOptions{Prefix: prefix})
+		for it.Rewind(); it.Valid(); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			require.NoError(err, "ValueCopy()")
+
+			version := tsToVersion(it.Item().Version())
+			vs := versions[version]
+			vs.Version = version
+			switch bytes.Equal(prefix, nodeKeyFmt.Encode()) {
+			case true:
+				vs.NodeBytes += uint64(len(it.Item().Key()) + len(value))
+			case false:
+				vs.WriteLogBytes += uint64(len(it.Item().Key()) + len(value))
+			}
+			versions[version] = vs
+		}
+		it.Close()
+	}
+	return versions
+}
+
+// requireStorage checks that the storage breakdown matches the stored nodes and write logs and
+// returns it.
+func requireStorage(require *require.Assertions, ndb api.NodeDB) *api.StorageBreakdown {
+	breakdown, err := ndb.StorageBreakdown(context.Background())
+	require.NoError(err, "StorageBreakdown()")
+
+	var nodeBytes, writeLogBytes uint64
+	versions := make(map[uint64]api.VersionStorage)
+	for _, vs := range breakdown.Versions {
+		nodeBytes += vs.NodeBytes
+		writeLogBytes += vs.WriteLogBytes
+		versions[vs.Version] = vs
+	}
+	require.Equal(nodeBytes, breakdown.NodeBytes, "total node bytes should match versions")
+	require.Equal(writeLogBytes, breakdown.WriteLogBytes, "total write log bytes should match versions")
+	require.Equal(scanStorage(require, ndb.(*badgerNodeDB)), versions, "storage should match stored data")
+	return breakdown
+}
+
+func TestStorageBreakdown(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "mkvs.badger.storage")
+	require.NoError(err, "TempDir()")
+	defer os.RemoveAll(dir)
+
+	cfg := *dbCfg
+	cfg.MemoryOnly = false
+	cfg.DB = dir
+	ndb, err := New(&cfg)
+	require.NoError(err, "New()")
+	defer func() { ndb.Close() }()
+
+	breakdown := requireStorage(require, ndb)
+	require.Equal(&api.StorageBreakdown{}, breakdown, "empty database should not use any storage")
+
+	const (
+		numEntries = 100
+		keySize    = 16
+		valueSize  = 1024
+		// nodeOverhead is an upper bound on the size of node keys and node metadata (including
+		// the internal nodes) per entry.
+		nodeOverhead = 256
+		// writeLogOverhead is an upper bound on the encoding overhead of each write log entry.
+		writeLogOverhead = 24
+	)
+	makeWriteLog := func(seed byte, n int) writelog.WriteLog {
+		wl := make(writelog.WriteLog, 0, n)
+		for i := 0; i < n; i++ {
+			wl = append(wl, writelog.LogEntry{
+				Key:   []byte(fmt.Sprintf("key %012d", i)),
+				Value: bytes.Repeat([]byte{seed}, valueSize),
+			})
+		}
+		return wl
+	}
+	commit := func(prevRoot node.Root, version uint64, wl writelog.WriteLog) node.Root {
+		tree := mkvs.NewWithRoot(nil, ndb, prevRoot)
+		defer tree.Close()
+
+		err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog()")
+		_, rootHash, err := tree.Commit(ctx, testNs, version)
+		require.NoError(err, "Commit()")
+		return node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}
+	}
+	// Each hashed write log entry contains the key and the hash of the value.
+	minWriteLogBytes := func(n int) uint64 {
+		return uint64(n * (keySize + hash.Size))
+	}
+	maxWriteLogBytes := func(n int) uint64 {
+		keySize := len(writeLogKeyFmt.Encode(uint64(0), &typedHash{}, &typedHash{}))
+		return minWriteLogBytes(n) + uint64(n*writeLogOverhead+keySize)
+	}
+
+	emptyRoot := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState}
+	emptyRoot.Hash.Empty()
+
+	root0 := commit(emptyRoot, 0, makeWriteLog(0xaa, numEntries))
+	err = ndb.Finalize(ctx, []node.Root{root0})
+	require.NoError(err, "Finalize()")
+
+	breakdown = requireStorage(require, ndb)
+	require.Len(breakdown.Versions, 1, "storage should be attributed to a single version")
+	require.EqualValues(0, breakdown.Versions[0].Version)
+	require.GreaterOrEqual(breakdown.NodeBytes, uint64(numEntries*(keySize+valueSize)))
+	require.LessOrEqual(breakdown.NodeBytes, uint64(numEntries*(keySize+valueSize+nodeOverhead)))
+	require.GreaterOrEqual(breakdown.WriteLogBytes, minWriteLogBytes(numEntries))
+	require.LessOrEqual(breakdown.WriteLogBytes, maxWriteLogBytes(numEntries))
+	v0 := breakdown.Versions[0]
+
+	// Nodes and write logs of discarded roots should not be accounted for.
+	const numUpdated = 10
+	root1 := commit(root0, 1, makeWriteLog(0xbb, numUpdated))
+	discarded := commit(root0, 1, makeWriteLog(0xcc, numEntries))
+	breakdown = requireStorage(require, ndb)
+	require.Len(breakdown.Versions, 2)
+	require.Greater(breakdown.Versions[1].NodeBytes, uint64((numEntries+numUpdated)*(keySize+valueSize)))
+
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(err, "Finalize()")
+	require.False(ndb.HasRoot(discarded), "discarded root should not exist")
+
+	// Nodes replaced in the finalized version are no longer accounted for in earlier versions.
+	breakdown = requireStorage(require, ndb)
+	require.Len(breakdown.Versions, 2)
+	require.Equal(v0.WriteLogBytes, breakdown.Versions[0].WriteLogBytes, "earlier write logs should not change")
+	require.Less(breakdown.Versions[0].NodeBytes, v0.NodeBytes-uint64(numUpdated*(keySize+valueSize)))
+	require.Greater(breakdown.Versions[0].NodeBytes, uint64((numEntries-numUpdated)*(keySize+valueSize)))
+	v0 = breakdown.Versions[0]
+	v1 := breakdown.Versions[1]
+	require.GreaterOrEqual(v1.NodeBytes, uint64(numUpdated*(keySize+valueSize)))
+	require.LessOrEqual(v1.NodeBytes, uint64(numUpdated*(keySize+valueSize+nodeOverhead)))
+	require.GreaterOrEqual(v1.WriteLogBytes, minWriteLogBytes(numUpdated))
+	require.LessOrEqual(v1.WriteLogBytes, maxWriteLogBytes(numUpdated))
+
+	// Pruning nodes while retaining write logs should retain the nodes used by later versions,
+	// while detached write logs contain the values.
+	err = ndb.PruneNodes(ctx, 0)
+	require.NoError(err, "PruneNodes(0)")
+
+	breakdown = requireStorage(require, ndb)
+	require.Len(breakdown.Versions, 2)
+	require.Equal(v1, breakdown.Versions[1], "later versions should not change")
+	require.Equal(v0.NodeBytes, breakdown.Versions[0].NodeBytes, "nodes used by later versions should be retained")
+	require.Greater(breakdown.Versions[0].WriteLogBytes, uint64(numEntries*valueSize))
+
+	// Pruning write logs should remove all of them.
+	err = ndb.PruneWriteLogs(ctx, 0)
+	require.NoError(err, "PruneWriteLogs(0)")
+
+	breakdown = requireStorage(require, ndb)
+	require.Zero(breakdown.Versions[0].WriteLogBytes, "pruned write logs should not use any storage")
+	require.Equal(breakdown.Versions[0].NodeBytes+v1.NodeBytes, breakdown.NodeBytes)
+	require.Equal(v1.WriteLogBytes, breakdown.WriteLogBytes)
+	tracked := breakdown
+
+	// Storage should be derived for databases which do not track it yet.
+	badgerDb := ndb.(*badgerNodeDB)
+	badgerDb.meta.value.Storage = nil
+	tx := badgerDb.db.NewTransactionAt(tsMetadata, true)
+	err = badgerDb.meta.save(tx)
+	require.NoError(err, "save()")
+	err = tx.CommitAt(tsMetadata, nil)
+	require.NoError(err, "CommitAt()")
+	tx.Discard()
+	ndb.Close()
+
+	ndb, err = New(&cfg)
+	require.NoError(err, "New()")
+	require.Equal(tracked, requireStorage(require, ndb), "derived storage should match tracked storage")
+
+	// Pruning a version should remove all of its nodes and write logs from the breakdown.
+	err = ndb.Prune(ctx, 1)
+	require.NoError(err, "Prune(1)")
+	breakdown = requireStorage(require, ndb)
+	require.Equal([]api.VersionStorage{{Version: 0, NodeBytes: v0.NodeBytes}}, breakdown.Versions)
+}
@@ -0,0 +1,123 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// Implements api.NodeDB.
+func (d *badgerNodeDB) HasSubtree(ctx context.Context, root node.Root, depthLimit node.Depth) (bool, error) {
+	missing, err := d.findMissingNode(ctx, root, &depthLimit)
+	if err != nil {
+		return false, err
+	}
+	return missing == nil, nil
+}
+
+// Implements api.NodeDB.
+func (d *badgerNodeDB) HasAllNodes(ctx context.Context, root node.Root) error {
+	missing, err := d.findMissingNode(ctx, root, nil)
+	if err != nil {
+		return err
+	}
+	if missing != nil {
+		return &api.MissingNodeError{Root: root, Hash: *missing}
+	}
+	return nil
+}
+
+// findMissingNode walks the nodes of the given root up to the given depth limit (or the whole
+// tree if no limit is given) and returns the hash of the first missing node, if any.
+//
+// Only internal nodes are decoded in order to discover their children, all other nodes are only
+// checked for existence. A single read transaction is used for the whole walk.
+func (d *badgerNodeDB) findMissingNode(ctx context.Context, root node.Root, depthLimit *node.Depth) (*hash.Hash, error) {
+	if err := d.sanityCheckRoot(root); err != nil {
+		return nil, err
+	}
+	// An empty root is always implicitly present.
+	if root.Hash.IsEmpty() {
+		return nil, nil
+	}
+	// If the version is earlier than the earliest version, we don't have the root.
+	if root.Version < d.meta.getEarliestVersion() {
+		return &root.Hash, nil
+	}
+
+	tx := d.db.NewTransactionAt(versionToTs(root.Version), false)
+	defer tx.Discard()
+
+	switch err := d.checkRoot(tx, root); {
+	case err == nil:
+	case errors.Is(err, api.ErrRootNotFound):
+		return &root.Hash, nil
+	default:
+		return nil, err
+	}
+
+	type pendingNode struct {
+		hash  hash.Hash
+		depth node.Depth
+	}
+	stack := []pendingNode{{hash: root.Hash}}
+	for len(stack) > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		pn := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		item, err := tx.Get(d.nodeKey(&pn.hash))
+		switch err {
+		case nil:
+		case badger.ErrKeyNotFound:
+			return &pn.hash, nil
+		default:
+			d.logger.Error("failed to Get node from backing store",
+				"err", err,
+			)
+			return nil, fmt.Errorf("mkvs/badger: failed to Get node from backing store: %w", err)
+		}
+
+		if depthLimit != nil && pn.depth >= *depthLimit {
+			continue
+		}
+
+		var n node.Node
+		if err = item.Value(func(val []byte) error {
+			var vErr error
+			n, vErr = node.UnmarshalVersionedBinary(val)
+			return vErr
+		}); err != nil {
+			d.logger.Error("failed to unmarshal node",
+				"err", err,
+			)
+			return nil, fmt.Errorf("mkvs/badger: failed to unmarshal node: %w", err)
+		}
+
+		// The leaf node of an internal node is stored together with the internal node, so only
+		// the children need to be checked. Push the right child first so that the walk visits
+		// the left subtree first.
+		in, ok := n.(*node.InternalNode)
+		if !ok {
+			continue
+		}
+		for _, child := range []*node.Pointer{in.Right, in.Left} {
+			if child == nil || child.Hash.IsEmpty() {
+				continue
+			}
+			stack = append(stack, pendingNode{hash: child.Hash, depth: pn.depth + 1})
+		}
+	}
+	return nil, nil
+}
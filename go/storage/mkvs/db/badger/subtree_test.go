@@ -0,0 +1,94 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// deleteNode removes the node with the given hash, simulating a node missing from the database.
+func deleteNode(require *require.Assertions, ndb api.NodeDB, root node.Root, h hash.Hash) {
+	d := ndb.(*badgerNodeDB)
+	tx := d.db.NewTransactionAt(versionToTs(root.Version), true)
+	defer tx.Discard()
+	err := tx.Delete(d.nodeKey(&h))
+	require.NoError(err, "Delete")
+	err = tx.CommitAt(versionToTs(root.Version), nil)
+	require.NoError(err, "CommitAt")
+}
+
+func TestHasSubtree(t *testing.T) {
+	ctx := context.Background()
+	require, cfg := newOpenCheckTest(t)
+	cfg.Namespace = testNs
+
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	var values [][]byte
+	for i := 0; i < 100; i++ {
+		values = append(values, []byte(fmt.Sprintf("value %d", i)))
+	}
+	root, err := commitSplitTest(ctx, ndb, values)
+	require.NoError(err, "Commit")
+
+	for _, depth := range []node.Depth{0, 1, 2, 100} {
+		exists, err := ndb.HasSubtree(ctx, root, depth)
+		require.NoError(err, "HasSubtree")
+		require.True(exists, "HasSubtree should find all nodes up to depth %d", depth)
+	}
+	require.NoError(ndb.HasAllNodes(ctx, root), "HasAllNodes should find all nodes")
+
+	// Unknown roots do not exist.
+	unknownRoot := root
+	unknownRoot.Hash = hash.NewFromBytes([]byte("unknown root"))
+	exists, err := ndb.HasSubtree(ctx, unknownRoot, 0)
+	require.NoError(err, "HasSubtree")
+	require.False(exists, "HasSubtree should not find an unknown root")
+
+	// Empty roots are always present.
+	emptyRoot := root
+	emptyRoot.Hash.Empty()
+	exists, err = ndb.HasSubtree(ctx, emptyRoot, 0)
+	require.NoError(err, "HasSubtree")
+	require.True(exists, "HasSubtree should find an empty root")
+	require.NoError(ndb.HasAllNodes(ctx, emptyRoot), "HasAllNodes should find an empty root")
+
+	// Find an interior node at depth 2 and delete it.
+	ptr := &node.Pointer{Clean: true, Hash: root.Hash}
+	for depth := 0; depth < 2; depth++ {
+		n, err := ndb.GetNode(root, ptr)
+		require.NoError(err, "GetNode")
+		in, ok := n.(*node.InternalNode)
+		require.True(ok, "node at depth %d should be an internal node", depth)
+		ptr = in.Left
+	}
+	n, err := ndb.GetNode(root, ptr)
+	require.NoError(err, "GetNode")
+	require.IsType(&node.InternalNode{}, n, "deleted node should be an interior node")
+	deleteNode(require, ndb, root, ptr.Hash)
+
+	for _, depth := range []node.Depth{0, 1} {
+		exists, err = ndb.HasSubtree(ctx, root, depth)
+		require.NoError(err, "HasSubtree")
+		require.True(exists, "HasSubtree should find all nodes up to depth %d", depth)
+	}
+	exists, err = ndb.HasSubtree(ctx, root, 2)
+	require.NoError(err, "HasSubtree")
+	require.False(exists, "HasSubtree should detect the missing node at depth 2")
+
+	err = ndb.HasAllNodes(ctx, root)
+	require.ErrorIs(err, api.ErrNodeNotFound, "HasAllNodes should detect the missing node")
+	var mnErr *api.MissingNodeError
+	require.True(errors.As(err, &mnErr), "error should be a MissingNodeError")
+	require.Equal(ptr.Hash, mnErr.Hash, "HasAllNodes should report the missing hash")
+	require.Equal(root, mnErr.Root, "HasAllNodes should report the checked root")
+}
@@ -0,0 +1,102 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// corruptNode overwrites the node stored under the given root hash with a node of different
+// content, simulating silent on-disk corruption.
+func corruptNode(require *require.Assertions, ndb api.NodeDB, root node.Root) {
+	d := ndb.(*badgerNodeDB)
+	leaf := node.LeafNode{
+		Key:   []byte("corrupted key"),
+		Value: []byte("corrupted value"),
+	}
+	data, err := node.MarshalVersionedBinary(&leaf)
+	require.NoError(err, "MarshalVersionedBinary")
+
+	tx := d.db.NewTransactionAt(versionToTs(root.Version), true)
+	defer tx.Discard()
+	err = tx.Set(d.nodeKey(&root.Hash), data)
+	require.NoError(err, "Set")
+	err = tx.CommitAt(versionToTs(root.Version), nil)
+	require.NoError(err, "CommitAt")
+}
+
+// newCorruptedDB creates a new database using the given configuration, commits a single root
+// and corrupts its root node.
+func newCorruptedDB(ctx context.Context, require *require.Assertions, cfg *api.Config) (api.NodeDB, node.Root) {
+	ndb, err := New(cfg)
+	require.NoError(err, "New()")
+
+	root, err := commitSplitTest(ctx, ndb, [][]byte{[]byte("value")})
+	require.NoError(err, "Commit")
+	corruptNode(require, ndb, root)
+	return ndb, root
+}
+
+func TestVerifyNodeHashes(t *testing.T) {
+	ctx := context.Background()
+	labels := prometheus.Labels{"namespace": testNs.String()}
+
+	// Without verification the corrupted node is returned.
+	require, cfg := newOpenCheckTest(t)
+	cfg.Namespace = testNs
+	ndb, root := newCorruptedDB(ctx, require, cfg)
+	ptr := &node.Pointer{Clean: true, Hash: root.Hash}
+	n, err := ndb.GetNode(root, ptr)
+	require.NoError(err, "GetNode without verification")
+	require.NotEqual(root.Hash, n.GetHash(), "corrupted node should be returned without verification")
+	ndb.Close()
+
+	// With verification of every read the corruption should always be detected.
+	cfg.VerifyNodeHashes = true
+	ndb, err = New(cfg)
+	require.NoError(err, "New()")
+	detected := testutil.ToFloat64(corruptedNodes.With(labels))
+	for i := 0; i < 10; i++ {
+		_, err = ndb.GetNode(root, ptr)
+		require.ErrorIs(err, api.ErrCorruptedNode, "GetNode should detect corruption")
+
+		var cnErr *api.CorruptedNodeError
+		require.True(errors.As(err, &cnErr), "error should be a CorruptedNodeError")
+		require.Equal(root.Hash, cnErr.Hash, "error should contain the expected hash")
+		require.Equal(ndb.(*badgerNodeDB).nodeKey(&root.Hash), cnErr.Key, "error should contain the node key")
+		require.NotEqual(root.Hash, cnErr.ComputedHash, "error should contain the computed hash")
+	}
+	require.EqualValues(detected+10, testutil.ToFloat64(corruptedNodes.With(labels)), "corruptions should be counted")
+	ndb.Close()
+
+	// With sampled verification the corruption should be detected in a fraction of reads.
+	const (
+		sampleRate = 4
+		numReads   = 4000
+	)
+	cfg.VerifyNodeHashesSampleRate = sampleRate
+	ndb, err = New(cfg)
+	require.NoError(err, "New()")
+	defer ndb.Close()
+
+	var numDetected int
+	for i := 0; i < numReads; i++ {
+		_, err = ndb.GetNode(root, ptr)
+		switch {
+		case err == nil:
+		case errors.Is(err, api.ErrCorruptedNode):
+			numDetected++
+		default:
+			require.NoError(err, "GetNode")
+		}
+	}
+	expected := numReads / sampleRate
+	require.InDelta(expected, numDetected, float64(expected)*0.25, "corruption should be detected at the sample rate")
+}
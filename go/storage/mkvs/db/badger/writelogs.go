@@ -0,0 +1,180 @@
+package badger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+var _ api.VersionWriteLogIterator = (*versionWriteLogIterator)(nil)
+
+type versionWriteLogIterator struct {
+	ctx context.Context
+	db  *badgerNodeDB
+
+	nextVersion uint64
+	endVersion  uint64
+	done        bool
+
+	// pending are the root pairs of the current version that have not yet been visited.
+	pending []api.VersionWriteLog
+	current *api.VersionWriteLog
+}
+
+func (it *versionWriteLogIterator) Next() (bool, error) {
+	it.current = nil
+	for len(it.pending) == 0 {
+		if it.done {
+			return false, nil
+		}
+		if err := it.ctx.Err(); err != nil {
+			return false, err
+		}
+
+		pending, err := it.db.getVersionWriteLogRoots(it.nextVersion)
+		if err != nil {
+			return false, err
+		}
+		it.pending = pending
+
+		if it.nextVersion == it.endVersion {
+			it.done = true
+		} else {
+			it.nextVersion++
+		}
+	}
+
+	wl := it.pending[0]
+	it.pending = it.pending[1:]
+
+	var err error
+	if wl.WriteLog, err = it.db.GetWriteLog(it.ctx, wl.SrcRoot, wl.DstRoot); err != nil {
+		return false, fmt.Errorf("mkvs/badger: failed to get write log (%s -> %s): %w",
+			wl.SrcRoot, wl.DstRoot, err,
+		)
+	}
+	it.current = &wl
+	return true, nil
+}
+
+func (it *versionWriteLogIterator) Value() (*api.VersionWriteLog, error) {
+	if it.current == nil {
+		return nil, writelog.ErrIteratorInvalid
+	}
+	return it.current, nil
+}
+
+func (d *badgerNodeDB) WriteLogIterator(ctx context.Context, startVersion, endVersion uint64, namespace common.Namespace) (api.VersionWriteLogIterator, error) {
+	if d.discardWriteLogs {
+		return nil, api.ErrWriteLogNotFound
+	}
+	if err := d.sanityCheckNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if endVersion < startVersion {
+		return nil, fmt.Errorf("mkvs/badger: end version %d is before start version %d", endVersion, startVersion)
+	}
+	if startVersion < d.meta.getEarliestWriteLogVersion() {
+		return nil, api.ErrWriteLogsPruned
+	}
+	if lastFinalizedVersion, exists := d.meta.getLastFinalizedVersion(); !exists || endVersion > lastFinalizedVersion {
+		return nil, api.ErrNotFinalized
+	}
+
+	return &versionWriteLogIterator{
+		ctx:         ctx,
+		db:          d,
+		nextVersion: startVersion,
+		endVersion:  endVersion,
+	}, nil
+}
+
+// getVersionWriteLogRoots returns the root pairs of all write logs stored under the given
+// finalized version, ordered so that each pair comes after the pair producing its source root.
+//
+// As write logs of discarded roots are removed during finalization, all returned pairs end in
+// finalized roots.
+func (d *badgerNodeDB) getVersionWriteLogRoots(version uint64) ([]api.VersionWriteLog, error) {
+	// Write logs could have been pruned since the iterator was created.
+	if version < d.meta.getEarliestWriteLogVersion() {
+		return nil, api.ErrWriteLogsPruned
+	}
+	logKeyFmt := writeLogKeyFmt
+	if version < d.meta.getEarliestVersion() {
+		logKeyFmt = detachedWriteLogKeyFmt
+	}
+
+	type rootPair struct {
+		dst, src typedHash
+	}
+	var pairs []rootPair
+	dstRoots := make(map[typedHash]bool)
+
+	tx := d.db.NewTransactionAt(versionToTs(version), false)
+	defer tx.Discard()
+	it := tx.NewIterator(badger.IteratorOptions{Prefix: logKeyFmt.Encode(version)})
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		var (
+			decVersion uint64
+			pair       rootPair
+		)
+		if !logKeyFmt.Decode(it.Item().Key(), &decVersion, &pair.dst, &pair.src) {
+			// This should not happen as the Badger iterator should take care of it.
+			panic("mkvs/badger: bad iterator")
+		}
+		pairs = append(pairs, pair)
+		dstRoots[pair.dst] = true
+	}
+
+	makeRoot := func(h typedHash, version uint64) node.Root {
+		return node.Root{
+			Namespace: d.namespace,
+			HashMode:  d.hashMode,
+			Version:   version,
+			Type:      h.Type(),
+			Hash:      h.Hash(),
+		}
+	}
+
+	// Order root pairs so that roots derived within the same version (e.g., I/O roots) come after
+	// the roots they are derived from.
+	ordered := make([]api.VersionWriteLog, 0, len(pairs))
+	visited := make(map[typedHash]bool)
+	for len(pairs) > 0 {
+		var remaining []rootPair
+		for _, pair := range pairs {
+			if dstRoots[pair.src] && !visited[pair.src] {
+				remaining = append(remaining, pair)
+				continue
+			}
+
+			// Source roots are from the previous version, unless they are empty or have been
+			// derived within the same version.
+			srcVersion := version
+			srcHash := pair.src.Hash()
+			if !dstRoots[pair.src] && !srcHash.IsEmpty() && version > 0 {
+				srcVersion = version - 1
+			}
+			ordered = append(ordered, api.VersionWriteLog{
+				SrcRoot: makeRoot(pair.src, srcVersion),
+				DstRoot: makeRoot(pair.dst, version),
+			})
+		}
+		if len(remaining) == len(pairs) {
+			return nil, fmt.Errorf("mkvs/badger: cyclic write logs at version %d", version)
+		}
+		for _, wl := range ordered[len(ordered)-(len(pairs)-len(remaining)):] {
+			visited[typedHashFromRoot(wl.DstRoot)] = true
+		}
+		pairs = remaining
+	}
+	return ordered, nil
+}
@@ -0,0 +1,323 @@
+package mkvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+var (
+	_ ChangedKeysIterator = (*changedKeysList)(nil)
+	_ ChangedKeysIterator = (*diffIterator)(nil)
+)
+
+// ChangedKey is a key which has changed between two roots.
+type ChangedKey struct {
+	// Key is the changed key.
+	Key node.Key
+	// Type is the type of the change. It is LogInsert for keys which have been inserted or updated
+	// and LogDelete for keys which have been removed.
+	Type writelog.LogEntryType
+}
+
+// ChangedKeysIterator iterates over keys which have changed between two roots.
+type ChangedKeysIterator interface {
+	// Next advances the iterator to the next changed key and returns false if there are no more
+	// changed keys.
+	Next() (bool, error)
+	// Value returns the changed key the iterator is currently pointing to.
+	Value() (ChangedKey, error)
+}
+
+// ChangedKeys returns an iterator over the keys which have changed between the given roots in
+// key order, without retrieving their values. The end root must follow the start root.
+//
+// In case the node database has the write log between the roots, the changed keys are taken
+// from the write log. Note that unless the roots were committed by a tree using ElideNoopWrites,
+// write logs may also contain keys that were written without changing their values. Otherwise,
+// e.g., when the end root was committed without a write log or the write log has been pruned,
+// the changed keys are determined by a structural diff of both trees which skips identical
+// subtrees. In this case, both roots must be available in the node database.
+func ChangedKeys(ctx context.Context, ndb db.NodeDB, startRoot, endRoot node.Root) (ChangedKeysIterator, error) {
+	if !endRoot.Follows(&startRoot) {
+		return nil, db.ErrRootMustFollowOld
+	}
+
+	wl, err := ndb.GetWriteLog(ctx, startRoot, endRoot)
+	switch {
+	case err == nil:
+		return changedKeysFromWriteLog(wl)
+	case errors.Is(err, db.ErrWriteLogNotFound),
+		errors.Is(err, db.ErrWriteLogNotAvailable),
+		errors.Is(err, db.ErrWriteLogsPruned):
+		return changedKeysFromDiff(ctx, ndb, startRoot, endRoot)
+	default:
+		return nil, err
+	}
+}
+
+type changedKeysList struct {
+	cursor  int
+	entries []ChangedKey
+}
+
+func (l *changedKeysList) Next() (bool, error) {
+	if l.cursor >= len(l.entries) {
+		return false, nil
+	}
+	l.cursor++
+	return l.cursor < len(l.entries), nil
+}
+
+func (l *changedKeysList) Value() (ChangedKey, error) {
+	if l.cursor < 0 || l.cursor >= len(l.entries) {
+		return ChangedKey{}, writelog.ErrIteratorInvalid
+	}
+	return l.entries[l.cursor], nil
+}
+
+// changedKeysFromWriteLog returns the keys changed by the given write log in key order. In case
+// the write log spans multiple roots and a key has been written more than once, the last change
+// is used.
+func changedKeysFromWriteLog(wl writelog.Iterator) (ChangedKeysIterator, error) {
+	changes := make(map[string]writelog.LogEntryType)
+	for {
+		more, err := wl.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		entry, err := wl.Value()
+		if err != nil {
+			return nil, err
+		}
+		changes[string(entry.Key)] = entry.Type()
+	}
+
+	entries := make([]ChangedKey, 0, len(changes))
+	for key, typ := range changes {
+		entries = append(entries, ChangedKey{Key: node.Key(key), Type: typ})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key.Compare(entries[j].Key) < 0
+	})
+	return &changedKeysList{cursor: -1, entries: entries}, nil
+}
+
+// diffSubtree is a subtree visited during a structural diff.
+type diffSubtree struct {
+	ptr *node.Pointer
+	nd  node.Node
+
+	// bitDepth and path identify the position of the subtree in the tree.
+	bitDepth node.Depth
+	path     node.Key
+}
+
+// sameAs returns true if both subtrees are known to contain the same keys and values.
+func (s *diffSubtree) sameAs(other *diffSubtree) bool {
+	if !s.ptr.Hash.Equal(&other.ptr.Hash) {
+		return false
+	}
+	if _, ok := s.nd.(*node.LeafNode); ok {
+		// Leaf nodes contain the full key.
+		return true
+	}
+	// Internal nodes only contain a part of the key, so they need to be at the same position.
+	return s.bitDepth == other.bitDepth &&
+		s.path.CommonPrefixLen(s.bitDepth, other.path, other.bitDepth) == s.bitDepth
+}
+
+// diffTree is one of the trees compared in a structural diff.
+type diffTree struct {
+	// deref dereferences the root node of the given subtree.
+	deref func(s *diffSubtree) (node.Node, error)
+
+	// stack contains the subtrees still to be visited, the next one on top.
+	stack []*diffSubtree
+}
+
+// newNodeDBDiffTree returns a diff tree with nodes of the given root retrieved from the given node
+// database.
+func newNodeDBDiffTree(ndb db.NodeDB, root node.Root) diffTree {
+	return diffTree{
+		deref: func(s *diffSubtree) (node.Node, error) {
+			if s.ptr.Node != nil {
+				return s.ptr.Node, nil
+			}
+			return ndb.GetNode(root, s.ptr)
+		},
+	}
+}
+
+func (t *diffTree) push(ptr *node.Pointer, bitDepth node.Depth, path node.Key) {
+	if ptr == nil || ptr.Hash.IsEmpty() {
+		return
+	}
+	t.stack = append(t.stack, &diffSubtree{ptr: ptr, bitDepth: bitDepth, path: path})
+}
+
+func (t *diffTree) pop() {
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// top returns the next subtree to be visited or nil in case there are no more subtrees.
+func (t *diffTree) top() (*diffSubtree, error) {
+	if len(t.stack) == 0 {
+		return nil, nil
+	}
+	s := t.stack[len(t.stack)-1]
+	if s.nd == nil {
+		nd, err := t.deref(s)
+		if err != nil {
+			return nil, err
+		}
+		if nd == nil {
+			return nil, fmt.Errorf("mkvs: missing node %s", s.ptr.Hash)
+		}
+		s.nd = nd
+	}
+	return s, nil
+}
+
+// expand replaces the internal node on top of the stack with its children.
+func (t *diffTree) expand(s *diffSubtree) {
+	n := s.nd.(*node.InternalNode)
+	bitLength := s.bitDepth + n.LabelBitLength
+	newPath := s.path.Merge(s.bitDepth, n.Label, n.LabelBitLength)
+
+	t.pop()
+	// Push children in reverse order so that they are visited in key order.
+	t.push(n.Right, bitLength, newPath.AppendBit(bitLength, true))
+	t.push(n.Left, bitLength, newPath.AppendBit(bitLength, false))
+	t.push(n.LeafNode, bitLength, newPath)
+}
+
+func isInternal(s *diffSubtree) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.nd.(*node.InternalNode)
+	return ok
+}
+
+// diffIterator is an iterator over the keys which differ between two trees.
+//
+// Both trees are traversed in key order at the same time, expanding subtrees until either both
+// sides are at a leaf node (in which case the keys are compared) or both sides are at the same
+// position in the tree with the same hash (in which case the subtree is skipped).
+type diffIterator struct {
+	ctx context.Context
+
+	start diffTree
+	end   diffTree
+
+	cur *ChangedKey
+	// startLeaf and endLeaf are the leaf nodes of the current key in the start and end trees, or
+	// nil in case the key does not exist in the respective tree.
+	startLeaf *node.LeafNode
+	endLeaf   *node.LeafNode
+}
+
+func changedKeysFromDiff(ctx context.Context, ndb db.NodeDB, startRoot, endRoot node.Root) (ChangedKeysIterator, error) {
+	for _, root := range []node.Root{startRoot, endRoot} {
+		if !ndb.HasRoot(root) {
+			return nil, db.ErrRootNotFound
+		}
+	}
+
+	it := &diffIterator{
+		ctx:   ctx,
+		start: newNodeDBDiffTree(ndb, startRoot),
+		end:   newNodeDBDiffTree(ndb, endRoot),
+	}
+	it.start.push(&node.Pointer{Clean: true, Hash: startRoot.Hash}, 0, node.Key{})
+	it.end.push(&node.Pointer{Clean: true, Hash: endRoot.Hash}, 0, node.Key{})
+	return it, nil
+}
+
+func (it *diffIterator) Next() (bool, error) {
+	it.cur, it.startLeaf, it.endLeaf = nil, nil, nil
+	for {
+		if err := it.ctx.Err(); err != nil {
+			return false, err
+		}
+
+		a, err := it.start.top()
+		if err != nil {
+			return false, err
+		}
+		b, err := it.end.top()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case a == nil && b == nil:
+			return false, nil
+		case a != nil && b != nil && a.sameAs(b):
+			// Identical subtrees, skip them.
+			it.start.pop()
+			it.end.pop()
+			continue
+		}
+
+		// Expand internal nodes, starting with the shallower one so that the positions of
+		// both sides have a chance to align.
+		aInternal, bInternal := isInternal(a), isInternal(b)
+		switch {
+		case aInternal && bInternal && a.bitDepth == b.bitDepth:
+			it.start.expand(a)
+			it.end.expand(b)
+			continue
+		case aInternal && (!bInternal || a.bitDepth < b.bitDepth):
+			it.start.expand(a)
+			continue
+		case bInternal:
+			it.end.expand(b)
+			continue
+		}
+
+		// Both sides are at leaf nodes (or exhausted), compare the keys.
+		var aLeaf, bLeaf *node.LeafNode
+		if a != nil {
+			aLeaf = a.nd.(*node.LeafNode)
+		}
+		if b != nil {
+			bLeaf = b.nd.(*node.LeafNode)
+		}
+		switch {
+		case b == nil || (a != nil && aLeaf.Key.Compare(bLeaf.Key) < 0):
+			// Key has been removed.
+			it.start.pop()
+			it.cur = &ChangedKey{Key: aLeaf.Key, Type: writelog.LogDelete}
+			it.startLeaf = aLeaf
+		case a == nil || aLeaf.Key.Compare(bLeaf.Key) > 0:
+			// Key has been inserted.
+			it.end.pop()
+			it.cur = &ChangedKey{Key: bLeaf.Key, Type: writelog.LogInsert}
+			it.endLeaf = bLeaf
+		default:
+			// Key exists on both sides, its value has been updated as the leaf nodes differ.
+			it.start.pop()
+			it.end.pop()
+			it.cur = &ChangedKey{Key: bLeaf.Key, Type: writelog.LogInsert}
+			it.startLeaf, it.endLeaf = aLeaf, bLeaf
+		}
+		return true, nil
+	}
+}
+
+func (it *diffIterator) Value() (ChangedKey, error) {
+	if it.cur == nil {
+		return ChangedKey{}, writelog.ErrIteratorInvalid
+	}
+	return *it.cur, nil
+}
@@ -0,0 +1,154 @@
+package mkvs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// DivergentKey is a key whose value differs between two trees.
+type DivergentKey struct {
+	// Key is the divergent key.
+	Key node.Key `json:"key"`
+	// LocalValueHash is the hash of the value in the local tree or nil in case the key does not
+	// exist in the local tree.
+	LocalValueHash *hash.Hash `json:"local_value_hash,omitempty"`
+	// ExpectedValueHash is the hash of the value in the expected tree or nil in case the key does
+	// not exist in the expected tree.
+	ExpectedValueHash *hash.Hash `json:"expected_value_hash,omitempty"`
+}
+
+// String returns a string representation of the divergent key.
+func (k *DivergentKey) String() string {
+	valueHash := func(h *hash.Hash) string {
+		if h == nil {
+			return "<missing>"
+		}
+		return h.String()
+	}
+	return fmt.Sprintf("%x (local: %s, expected: %s)", []byte(k.Key), valueHash(k.LocalValueHash), valueHash(k.ExpectedValueHash))
+}
+
+// DivergenceReport is a report of the keys whose values differ between two trees.
+type DivergenceReport struct {
+	// LocalRoot is the root hash of the local tree.
+	LocalRoot hash.Hash `json:"local_root"`
+	// ExpectedRoot is the root hash of the expected tree.
+	ExpectedRoot hash.Hash `json:"expected_root"`
+	// Keys are the divergent keys in key order.
+	Keys []DivergentKey `json:"keys,omitempty"`
+	// Truncated is true iff there are more divergent keys than included in the report.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// String returns a string representation of the divergence report.
+func (r *DivergenceReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "local root %s diverges from expected root %s in %d key(s)", r.LocalRoot, r.ExpectedRoot, len(r.Keys))
+	if r.Truncated {
+		b.WriteString(" (truncated)")
+	}
+	for i := range r.Keys {
+		fmt.Fprintf(&b, "\n  %s", r.Keys[i].String())
+	}
+	return b.String()
+}
+
+// newTreeDiffTree returns a diff tree with nodes dereferenced via the cache of the given tree,
+// fetching them from its node database or read syncer as needed.
+//
+// The tree cache lock must be held while the diff tree is in use.
+func newTreeDiffTree(ctx context.Context, t *tree) diffTree {
+	return diffTree{
+		deref: func(s *diffSubtree) (node.Node, error) {
+			return t.cache.derefNodePtr(ctx, s.ptr, s.bitDepth, s.path, t.newFetcherSyncIterate(s.path, 0))
+		},
+	}
+}
+
+func valueHash(leaf *node.LeafNode) *hash.Hash {
+	if leaf == nil {
+		return nil
+	}
+	h := hash.NewFromBytes(leaf.Value)
+	return &h
+}
+
+// FindDivergentKeys compares the local tree against the expected tree and returns a report of up
+// to limit keys whose values differ between them. This is a diagnostic tool for finding the cause
+// of a root mismatch (e.g., when CommitKnown fails with ErrKnownRootMismatch).
+//
+// Both trees are traversed at the same time, skipping identical subtrees, so only the parts of
+// the expected tree that differ from the local tree are fetched in case it is backed by a remote
+// read syncer. Uncommitted changes of the local tree are hashed as if they were committed under
+// the namespace and version of the expected tree, without persisting anything.
+func FindDivergentKeys(ctx context.Context, local, expected Tree, limit int) (*DivergenceReport, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("mkvs: invalid divergent key limit: %d", limit)
+	}
+	lt, ok := local.(*tree)
+	if !ok {
+		return nil, fmt.Errorf("mkvs: unsupported local tree type: %T", local)
+	}
+	et, ok := expected.(*tree)
+	if !ok {
+		return nil, fmt.Errorf("mkvs: unsupported expected tree type: %T", expected)
+	}
+	if lt == et {
+		return nil, fmt.Errorf("mkvs: cannot compare a tree against itself")
+	}
+
+	// Make sure that the hashes of all locally modified nodes are up to date.
+	et.cache.Lock()
+	syncRoot := et.cache.getSyncRoot()
+	et.cache.Unlock()
+	_, localHash, err := local.Commit(ctx, syncRoot.Namespace, syncRoot.Version, NoPersist())
+	if err != nil {
+		return nil, err
+	}
+
+	lt.cache.Lock()
+	defer lt.cache.Unlock()
+	et.cache.Lock()
+	defer et.cache.Unlock()
+
+	if lt.cache.isClosed() || et.cache.isClosed() {
+		return nil, ErrClosed
+	}
+
+	report := &DivergenceReport{
+		LocalRoot:    localHash,
+		ExpectedRoot: syncRoot.Hash,
+	}
+	localRoot, expectedRoot := lt.cache.pendingRoot, et.cache.pendingRoot
+
+	it := &diffIterator{
+		ctx:   ctx,
+		start: newTreeDiffTree(ctx, lt),
+		end:   newTreeDiffTree(ctx, et),
+	}
+	it.start.push(localRoot, 0, node.Key{})
+	it.end.push(expectedRoot, 0, node.Key{})
+	for {
+		more, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		if len(report.Keys) >= limit {
+			report.Truncated = true
+			break
+		}
+		report.Keys = append(report.Keys, DivergentKey{
+			Key:               it.cur.Key,
+			LocalValueHash:    valueHash(it.startLeaf),
+			ExpectedValueHash: valueHash(it.endLeaf),
+		})
+	}
+	return report, nil
+}
@@ -0,0 +1,158 @@
+package mkvs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	badgerDb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/badger"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+func TestFindDivergentKeys(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "mkvs.test.badger")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dir)
+
+	ndb, err := badgerDb.New(&db.Config{
+		DB:        dir,
+		NoFsync:   true,
+		Namespace: testNs,
+	})
+	require.NoError(err, "New")
+	defer ndb.Close()
+
+	// Populate the base root.
+	keys, values := generateKeyValuePairsEx("base", 500)
+	tree := New(nil, ndb, node.RootTypeState)
+	for i := range keys {
+		err = tree.Insert(ctx, keys[i], values[i])
+		require.NoError(err, "Insert")
+	}
+	_, baseHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	tree.Close()
+	baseRoot := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: baseHash}
+
+	// Apply the write log to get the expected root.
+	var wl writelog.WriteLog
+	for i := 0; i < 50; i++ {
+		wl = append(wl, writelog.LogEntry{
+			Key:   []byte(fmt.Sprintf("new key %d", i)),
+			Value: []byte(fmt.Sprintf("new value %d", i)),
+		})
+	}
+	for i := 0; i < 50; i++ {
+		wl = append(wl, writelog.LogEntry{Key: keys[i*10], Value: []byte(fmt.Sprintf("updated value %d", i))})
+	}
+	wl = append(wl, writelog.LogEntry{Key: keys[1]})
+
+	tree = NewWithRoot(nil, ndb, baseRoot)
+	err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+	require.NoError(err, "ApplyWriteLog")
+	_, expectedHash, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(err, "Commit")
+	tree.Close()
+	expectedRoot := node.Root{Namespace: testNs, Version: 1, Type: node.RootTypeState, Hash: expectedHash}
+
+	// The expected tree is only available via a read syncer.
+	source := NewWithRoot(nil, ndb, expectedRoot)
+	defer source.Close()
+	newExpectedTree := func() Tree {
+		return NewWithRoot(source, nil, expectedRoot, Capacity(0, 0))
+	}
+
+	// applyCorrupted applies the write log modified by the given function and returns the tree
+	// after a failed CommitKnown.
+	applyCorrupted := func(corrupt func(wl writelog.WriteLog) writelog.WriteLog) Tree {
+		corrupted := corrupt(append(writelog.WriteLog{}, wl...))
+		tree := NewWithRoot(nil, ndb, baseRoot)
+		err := tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(corrupted))
+		require.NoError(err, "ApplyWriteLog")
+		_, err = tree.CommitKnown(ctx, expectedRoot)
+		require.ErrorIs(err, ErrKnownRootMismatch, "CommitKnown")
+		return tree
+	}
+	valueHash := func(value []byte) *hash.Hash {
+		h := hash.NewFromBytes(value)
+		return &h
+	}
+
+	// A single corrupted value should be pinpointed.
+	local := applyCorrupted(func(wl writelog.WriteLog) writelog.WriteLog {
+		wl[60] = writelog.LogEntry{Key: wl[60].Key, Value: []byte("corrupted value")}
+		return wl
+	})
+	expected := newExpectedTree()
+	report, err := FindDivergentKeys(ctx, local, expected, 10)
+	require.NoError(err, "FindDivergentKeys")
+	require.Equal(expectedHash, report.ExpectedRoot, "expected root")
+	require.NotEqual(expectedHash, report.LocalRoot, "local root should differ")
+	require.False(report.Truncated, "report should not be truncated")
+	require.Equal([]DivergentKey{{
+		Key:               node.Key(wl[60].Key),
+		LocalValueHash:    valueHash([]byte("corrupted value")),
+		ExpectedValueHash: valueHash(wl[60].Value),
+	}}, report.Keys, "report should pinpoint the corrupted entry")
+	local.Close()
+	expected.Close()
+
+	// Missing and extra entries should be reported.
+	local = applyCorrupted(func(wl writelog.WriteLog) writelog.WriteLog {
+		wl[0].Value = nil
+		return append(wl, writelog.LogEntry{Key: []byte("extra key"), Value: []byte("extra value")})
+	})
+	expected = newExpectedTree()
+	report, err = FindDivergentKeys(ctx, local, expected, 10)
+	require.NoError(err, "FindDivergentKeys")
+	require.Equal([]DivergentKey{
+		{Key: node.Key("extra key"), LocalValueHash: valueHash([]byte("extra value"))},
+		{Key: node.Key(wl[0].Key), ExpectedValueHash: valueHash(wl[0].Value)},
+	}, report.Keys, "report should contain missing and extra keys in key order")
+	local.Close()
+	expected.Close()
+
+	// Reports should be bounded.
+	local = applyCorrupted(func(wl writelog.WriteLog) writelog.WriteLog {
+		for i := range wl {
+			if wl[i].Value != nil {
+				wl[i].Value = append([]byte("corrupted "), wl[i].Value...)
+			}
+		}
+		return wl
+	})
+	expected = newExpectedTree()
+	report, err = FindDivergentKeys(ctx, local, expected, 5)
+	require.NoError(err, "FindDivergentKeys")
+	require.Len(report.Keys, 5, "report should contain the maximum number of keys")
+	require.True(report.Truncated, "report should be truncated")
+	local.Close()
+	expected.Close()
+
+	// Identical trees should not diverge.
+	local = NewWithRoot(nil, ndb, baseRoot)
+	err = local.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+	require.NoError(err, "ApplyWriteLog")
+	expected = newExpectedTree()
+	report, err = FindDivergentKeys(ctx, local, expected, 5)
+	require.NoError(err, "FindDivergentKeys")
+	require.Equal(expectedHash, report.LocalRoot, "local root should match")
+	require.Empty(report.Keys, "identical trees should not diverge")
+	local.Close()
+	expected.Close()
+
+	_, err = FindDivergentKeys(ctx, source, source, 5)
+	require.Error(err, "FindDivergentKeys should fail for the same tree")
+	_, err = FindDivergentKeys(ctx, source, newExpectedTree(), 0)
+	require.Error(err, "FindDivergentKeys should fail for an invalid limit")
+}
@@ -0,0 +1,115 @@
+package mkvs
+
+import (
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// NodeError is the error returned when a node cannot be dereferenced while traversing the tree,
+// e.g., because it is missing from the local node database or could not be fetched via the
+// read syncer.
+//
+// The underlying error is available via errors.Unwrap, so errors.Is can be used to check for
+// specific causes (e.g., db.ErrNodeNotFound).
+type NodeError struct {
+	// BitDepth is the bit depth at which the node is located in the tree.
+	BitDepth node.Depth
+	// Prefix is the key prefix traversed so far, containing the first BitDepth bits with any
+	// remaining bits cleared. All keys that can be stored in the subtree rooted at the node
+	// start with this prefix.
+	Prefix node.Key
+	// Hash is the hash of the node.
+	Hash hash.Hash
+	// Remote is true iff the node was being fetched via the read syncer.
+	Remote bool
+
+	// Err is the underlying error.
+	Err error
+}
+
+func newNodeError(bitDepth node.Depth, path node.Key, ptr *node.Pointer, remote bool, err error) *NodeError {
+	// Never report more bits than the path has.
+	if pathLen := path.BitLength(); bitDepth > pathLen {
+		bitDepth = pathLen
+	}
+	return &NodeError{
+		BitDepth: bitDepth,
+		Prefix:   path.Prefix(bitDepth),
+		Hash:     ptr.Hash,
+		Remote:   remote,
+		Err:      err,
+	}
+}
+
+// Covers returns true iff the given key falls into the subtree rooted at the node.
+func (e *NodeError) Covers(key []byte) bool {
+	return node.Key(key).HasPrefix(e.Prefix, e.BitDepth)
+}
+
+func (e *NodeError) Error() string {
+	source := "local"
+	if e.Remote {
+		source = "remote"
+	}
+	return fmt.Sprintf("mkvs: failed to dereference node %s (%s, bit depth %d, key prefix %x): %s",
+		e.Hash, source, e.BitDepth, []byte(e.Prefix), e.Err,
+	)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// RootError is the error returned by ValidateRoot when the root of a tree is not available in the
+// node database.
+//
+// In case the root's version has been pruned, the underlying error is db.ErrVersionNotFound.
+// Otherwise it is db.ErrRootNotFound.
+type RootError struct {
+	// Root is the root that is not available.
+	Root node.Root
+	// EarliestVersion is the earliest version retained by the node database.
+	EarliestVersion uint64
+	// LatestVersion is the latest finalized version in the node database.
+	LatestVersion uint64
+
+	// Err is the underlying error.
+	Err error
+}
+
+func newRootError(root node.Root, earliestVersion, latestVersion uint64) *RootError {
+	err := db.ErrRootNotFound
+	if root.Version < earliestVersion {
+		err = db.ErrVersionNotFound
+	}
+
+	return &RootError{
+		Root:            root,
+		EarliestVersion: earliestVersion,
+		LatestVersion:   latestVersion,
+		Err:             err,
+	}
+}
+
+// Pruned returns true iff the root is not available because its version has been pruned.
+func (e *RootError) Pruned() bool {
+	return e.Root.Version < e.EarliestVersion
+}
+
+func (e *RootError) Error() string {
+	if e.Pruned() {
+		return fmt.Sprintf("mkvs: root %s is unavailable as its version has been pruned (earliest version %d): %s",
+			e.Root, e.EarliestVersion, e.Err,
+		)
+	}
+	return fmt.Sprintf("mkvs: unknown root %s (versions %d-%d): %s",
+		e.Root, e.EarliestVersion, e.LatestVersion, e.Err,
+	)
+}
+
+func (e *RootError) Unwrap() error {
+	return e.Err
+}
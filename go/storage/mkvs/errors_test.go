@@ -0,0 +1,185 @@
+package mkvs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// hidingNodeDB is a node database which pretends that some nodes have been deleted.
+type hidingNodeDB struct {
+	db.NodeDB
+
+	hidden map[hash.Hash]bool
+}
+
+func (d *hidingNodeDB) GetNode(root node.Root, ptr *node.Pointer) (node.Node, error) {
+	if d.hidden[ptr.Hash] {
+		return nil, db.ErrNodeNotFound
+	}
+	return d.NodeDB.GetNode(root, ptr)
+}
+
+// collectLeafKeys returns the keys of all leaf nodes in the subtree rooted at the given node.
+func collectLeafKeys(t *testing.T, ndb db.NodeDB, root node.Root, h hash.Hash) [][]byte {
+	var keys [][]byte
+	var walk func(ptr *node.Pointer)
+	walk = func(ptr *node.Pointer) {
+		if ptr == nil || ptr.Hash.IsEmpty() {
+			return
+		}
+		n, err := ndb.GetNode(root, &node.Pointer{Clean: true, Hash: ptr.Hash})
+		require.NoError(t, err, "GetNode")
+		switch n := n.(type) {
+		case *node.InternalNode:
+			walk(n.LeafNode)
+			walk(n.Left)
+			walk(n.Right)
+		case *node.LeafNode:
+			keys = append(keys, n.Key)
+		}
+	}
+	walk(&node.Pointer{Hash: h})
+	return keys
+}
+
+// findInternalNode returns the hash of an internal node at the given depth, preferring right
+// branches whenever both children are internal nodes.
+func findInternalNode(t *testing.T, ndb db.NodeDB, root node.Root, depth int) hash.Hash {
+	getInternal := func(ptr *node.Pointer) *node.InternalNode {
+		if ptr == nil {
+			return nil
+		}
+		n, err := ndb.GetNode(root, &node.Pointer{Clean: true, Hash: ptr.Hash})
+		require.NoError(t, err, "GetNode")
+		in, _ := n.(*node.InternalNode)
+		return in
+	}
+
+	h := root.Hash
+	for i := 0; i < depth; i++ {
+		n := getInternal(&node.Pointer{Hash: h})
+		require.NotNil(t, n, "node should be an internal node")
+		switch {
+		case getInternal(n.Right) != nil:
+			h = n.Right.Hash
+		case getInternal(n.Left) != nil:
+			h = n.Left.Hash
+		default:
+			require.Fail(t, "no internal node at the given depth")
+		}
+	}
+	return h
+}
+
+func requireNodeError(t *testing.T, err error, hiddenHash hash.Hash, key []byte) {
+	require := require.New(t)
+
+	require.ErrorIs(err, db.ErrNodeNotFound, "error should wrap the node database error")
+	var nodeErr *NodeError
+	require.True(errors.As(err, &nodeErr), "error should be a NodeError")
+	require.Equal(hiddenHash, nodeErr.Hash, "error should report the hidden node")
+	require.False(nodeErr.Remote, "error should report that the node was fetched locally")
+	require.True(nodeErr.BitDepth > 0, "error should report the bit depth")
+	require.True(nodeErr.Covers(key), "error prefix should cover the key")
+	require.Contains(err.Error(), hiddenHash.String(), "error message should include the node hash")
+}
+
+func TestNodeErrors(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	factory, cleanup := initBadgerBackend(t)
+	defer cleanup()
+	ndb, err := factory(testNs)
+	require.NoError(err, "New")
+	defer ndb.Close()
+
+	keys, values, root, tree := generatePopulatedTree(t, ndb)
+	tree.Close()
+
+	hiddenHash := findInternalNode(t, ndb, root, 3)
+	affectedKeys := collectLeafKeys(t, ndb, root, hiddenHash)
+	require.NotEmpty(affectedKeys, "hidden node should have leaves")
+	affected := make(map[string]bool)
+	for _, key := range affectedKeys {
+		affected[string(key)] = true
+	}
+	require.Less(len(affected), len(keys), "some keys should not be affected")
+
+	hdb := &hidingNodeDB{NodeDB: ndb, hidden: map[hash.Hash]bool{hiddenHash: true}}
+
+	// Lookups.
+	var reported *NodeError
+	for i, key := range keys {
+		// Use a fresh tree for each lookup so that nothing is cached.
+		tree = NewWithRoot(nil, hdb, root)
+		value, err := tree.Get(ctx, key)
+		tree.Close()
+
+		if !affected[string(key)] {
+			require.NoError(err, "Get should not fail for unaffected keys")
+			require.Equal(values[i], value, "Get should return the correct value")
+			continue
+		}
+		requireNodeError(t, err, hiddenHash, key)
+		var nodeErr *NodeError
+		require.True(errors.As(err, &nodeErr))
+		if reported == nil {
+			reported = nodeErr
+		}
+		require.Equal(reported, nodeErr, "all lookups should report the same node location")
+	}
+	for _, key := range affectedKeys {
+		require.True(reported.Covers(key), "reported prefix should cover all affected keys")
+	}
+
+	// Insert and remove.
+	tree = NewWithRoot(nil, hdb, root)
+	err = tree.Insert(ctx, affectedKeys[0], []byte("value"))
+	requireNodeError(t, err, hiddenHash, affectedKeys[0])
+	tree.Close()
+
+	tree = NewWithRoot(nil, hdb, root)
+	err = tree.Remove(ctx, affectedKeys[0])
+	requireNodeError(t, err, hiddenHash, affectedKeys[0])
+	tree.Close()
+
+	// Iteration stops at the first affected key.
+	sort.Slice(keys, func(i, j int) bool {
+		return node.Key(keys[i]).Compare(keys[j]) < 0
+	})
+	tree = NewWithRoot(nil, hdb, root)
+	it := tree.NewIterator(ctx)
+	var iterated int
+	for it.Rewind(); it.Valid(); it.Next() {
+		require.False(affected[string(it.Key())], "iterator should not return affected keys")
+		require.EqualValues(keys[iterated], it.Key(), "iterator should return keys in order")
+		iterated++
+	}
+	require.True(affected[string(keys[iterated])], "iterator should stop at the first affected key")
+	requireNodeError(t, it.Err(), hiddenHash, keys[iterated])
+	it.Close()
+	tree.Close()
+
+	// Remote lookups.
+	remoteTree := NewWithRoot(nil, hdb, root)
+	defer remoteTree.Close()
+	tree = NewWithRoot(remoteTree, nil, root)
+	defer tree.Close()
+	_, err = tree.Get(ctx, affectedKeys[0])
+	var nodeErr *NodeError
+	require.True(errors.As(err, &nodeErr), "error should be a NodeError")
+	require.True(nodeErr.Remote, "error should report that the node was fetched remotely")
+	require.Equal(root.Hash, nodeErr.Hash, "error should report the node requested from the syncer")
+	require.True(nodeErr.Covers(affectedKeys[0]), "error prefix should cover the key")
+	// The error reported by the syncer should be available as well.
+	requireNodeError(t, nodeErr.Err, hiddenHash, affectedKeys[0])
+}
@@ -0,0 +1,261 @@
+package mkvs
+
+import (
+	"context"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+var _ ForkTree = (*treeFork)(nil)
+
+// forkSet is a set of active copy-on-write forks of a tree.
+type forkSet map[*treeFork]struct{}
+
+// copyOnWrite must be called before the parent modifies the given key. It preserves the current
+// value of the key in all forks that still share it with the parent.
+func (fs forkSet) copyOnWrite(ctx context.Context, parent ImmutableKeyValueTree, key []byte) error {
+	var (
+		value   []byte
+		fetched bool
+	)
+	for f := range fs {
+		if f.shadowed[string(key)] {
+			continue
+		}
+
+		if !fetched {
+			var err error
+			if value, err = parent.Get(ctx, key); err != nil {
+				return err
+			}
+			fetched = true
+		}
+
+		if err := f.preserve(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Implements ForkableTree.
+func (t *tree) Fork(ctx context.Context) (ForkTree, error) {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return nil, ErrClosed
+	}
+
+	return newTreeFork(t, t.rootType, &t.forks), nil
+}
+
+// Implements ForkableTree.
+func (t *tree) MergeFork(ctx context.Context, fork ForkTree) error {
+	f, ok := fork.(*treeFork)
+	if !ok || f.parent != KeyValueTree(t) {
+		return ErrForkMismatch
+	}
+	return f.mergeInto(ctx, t)
+}
+
+// treeFork is a copy-on-write fork of a tree.
+//
+// Reads of keys that have not been modified in either the fork or the parent since the fork was
+// created are served by the parent, sharing its cache. Keys modified in the fork and keys whose
+// previous value had to be preserved because the parent modified them are held in an in-memory
+// overlay tree.
+//
+// The fork is not safe for concurrent use.
+type treeFork struct {
+	parent      KeyValueTree
+	parentForks *forkSet
+	rootType    node.RootType
+
+	overlay Tree
+
+	// shadowed are the keys that are held in the overlay and must not be read from the parent.
+	shadowed map[string]bool
+	// dirty are the keys that have been modified in the fork.
+	dirty map[string]bool
+
+	// forks are the active copy-on-write forks of this fork.
+	forks forkSet
+}
+
+func newTreeFork(parent KeyValueTree, rootType node.RootType, parentForks *forkSet) *treeFork {
+	f := &treeFork{
+		parent:      parent,
+		parentForks: parentForks,
+		rootType:    rootType,
+		overlay:     New(nil, nil, rootType, WithoutWriteLog()),
+		shadowed:    make(map[string]bool),
+		dirty:       make(map[string]bool),
+	}
+
+	if *parentForks == nil {
+		*parentForks = make(forkSet)
+	}
+	(*parentForks)[f] = struct{}{}
+
+	return f
+}
+
+// detach removes the fork from its parent's set of active forks.
+func (f *treeFork) detach() {
+	delete(*f.parentForks, f)
+}
+
+func (f *treeFork) isClosed() bool {
+	return f.parent == nil
+}
+
+// preserve stores the given value of a key that is about to be modified by the parent.
+func (f *treeFork) preserve(ctx context.Context, key, value []byte) error {
+	var err error
+	if value == nil {
+		err = f.overlay.Remove(ctx, key)
+	} else {
+		err = f.overlay.Insert(ctx, key, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.shadowed[string(key)] = true
+	return nil
+}
+
+// beforeWrite must be called before the fork modifies the given key.
+func (f *treeFork) beforeWrite(ctx context.Context, key []byte) error {
+	if f.isClosed() {
+		return ErrClosed
+	}
+	if err := f.forks.copyOnWrite(ctx, f, key); err != nil {
+		return err
+	}
+
+	f.shadowed[string(key)] = true
+	f.dirty[string(key)] = true
+	return nil
+}
+
+// Implements KeyValueTree.
+func (f *treeFork) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if f.isClosed() {
+		return nil, ErrClosed
+	}
+	if f.shadowed[string(key)] {
+		return f.overlay.Get(ctx, key)
+	}
+	return f.parent.Get(ctx, key)
+}
+
+// Implements KeyValueTree.
+func (f *treeFork) Insert(ctx context.Context, key, value []byte) error {
+	if err := f.beforeWrite(ctx, key); err != nil {
+		return err
+	}
+	return f.overlay.Insert(ctx, key, value)
+}
+
+// Implements KeyValueTree.
+func (f *treeFork) RemoveExisting(ctx context.Context, key []byte) ([]byte, error) {
+	value, err := f.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.beforeWrite(ctx, key); err != nil {
+		return nil, err
+	}
+	if err = f.overlay.Remove(ctx, key); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Implements KeyValueTree.
+func (f *treeFork) Remove(ctx context.Context, key []byte) error {
+	_, err := f.RemoveExisting(ctx, key)
+	return err
+}
+
+// Implements KeyValueTree.
+func (f *treeFork) NewIterator(ctx context.Context, options ...IteratorOption) Iterator {
+	return &treeOverlayIterator{
+		dirty:   f.shadowed,
+		inner:   f.parent.NewIterator(ctx, options...),
+		overlay: f.overlay.NewIterator(ctx),
+	}
+}
+
+// Implements ForkableTree.
+func (f *treeFork) Fork(ctx context.Context) (ForkTree, error) {
+	if f.isClosed() {
+		return nil, ErrClosed
+	}
+
+	return newTreeFork(f, f.rootType, &f.forks), nil
+}
+
+// Implements ForkableTree.
+func (f *treeFork) MergeFork(ctx context.Context, fork ForkTree) error {
+	if f.isClosed() {
+		return ErrClosed
+	}
+
+	child, ok := fork.(*treeFork)
+	if !ok || child.parent != KeyValueTree(f) {
+		return ErrForkMismatch
+	}
+	return child.mergeInto(ctx, f)
+}
+
+// mergeInto applies all modifications made in the fork into its parent and closes the fork.
+func (f *treeFork) mergeInto(ctx context.Context, parent KeyValueTree) error {
+	if f.isClosed() {
+		return ErrClosed
+	}
+
+	// Detach first so that the parent does not need to preserve values for this fork.
+	f.detach()
+
+	for key := range f.dirty {
+		value, err := f.overlay.Get(ctx, []byte(key))
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			err = parent.Remove(ctx, []byte(key))
+		} else {
+			err = parent.Insert(ctx, []byte(key), value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	f.Close()
+	return nil
+}
+
+// Implements ClosableTree.
+func (f *treeFork) Close() {
+	if f.isClosed() {
+		return
+	}
+
+	for child := range f.forks {
+		child.Close()
+	}
+	f.detach()
+	f.overlay.Close()
+
+	f.parent = nil
+	f.parentForks = nil
+	f.overlay = nil
+	f.shadowed = nil
+	f.dirty = nil
+	f.forks = nil
+}
@@ -0,0 +1,156 @@
+package mkvs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+func requireValues(t *testing.T, tree KeyValueTree, items writelog.WriteLog) {
+	ctx := context.Background()
+	for _, item := range items {
+		value, err := tree.Get(ctx, item.Key)
+		require.NoError(t, err, "Get")
+		require.Equal(t, item.Value, value, "value for key '%s' should be correct", item.Key)
+	}
+}
+
+func TestFork(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	base := writelog.WriteLog{
+		writelog.LogEntry{Key: []byte("key 1"), Value: []byte("one")},
+		writelog.LogEntry{Key: []byte("key 2"), Value: []byte("two")},
+		writelog.LogEntry{Key: []byte("key 5"), Value: []byte("five")},
+	}
+	parentOps := writelog.WriteLog{
+		writelog.LogEntry{Key: []byte("key 1"), Value: []byte("parent one")},
+		writelog.LogEntry{Key: []byte("key 4"), Value: []byte("parent four")},
+		writelog.LogEntry{Key: []byte("key 5"), Value: nil},
+	}
+	childOps := writelog.WriteLog{
+		writelog.LogEntry{Key: []byte("key 1"), Value: []byte("child one")},
+		writelog.LogEntry{Key: []byte("key 2"), Value: nil},
+		writelog.LogEntry{Key: []byte("key 3"), Value: []byte("child three")},
+	}
+	grandchildOps := writelog.WriteLog{
+		writelog.LogEntry{Key: []byte("key 3"), Value: []byte("grandchild three")},
+		writelog.LogEntry{Key: []byte("key 6"), Value: []byte("grandchild six")},
+	}
+
+	// Compute the expected root by applying all operations sequentially.
+	expectedTree := New(nil, nil, node.RootTypeState)
+	defer expectedTree.Close()
+	for _, wl := range []writelog.WriteLog{base, parentOps, childOps, grandchildOps} {
+		err := expectedTree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog")
+	}
+	_, expectedRoot, err := expectedTree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+
+	tree := New(nil, nil, node.RootTypeState)
+	defer tree.Close()
+	err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(base))
+	require.NoError(err, "ApplyWriteLog")
+
+	// A discarded fork should not affect the parent.
+	t.Run("Discard", func(t *testing.T) {
+		fork, err := tree.Fork(ctx)
+		require.NoError(err, "Fork")
+		err = fork.Insert(ctx, []byte("key 1"), []byte("discarded"))
+		require.NoError(err, "Insert")
+		err = fork.Remove(ctx, []byte("key 2"))
+		require.NoError(err, "Remove")
+		fork.Close()
+
+		requireValues(t, tree, base)
+
+		_, err = fork.Get(ctx, []byte("key 1"))
+		require.ErrorIs(err, ErrClosed, "Get on a closed fork should fail")
+	})
+
+	child, err := tree.Fork(ctx)
+	require.NoError(err, "Fork")
+
+	// Apply conflicting modifications in the parent and the child.
+	err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(parentOps))
+	require.NoError(err, "ApplyWriteLog(parent)")
+	err = child.Insert(ctx, []byte("key 1"), []byte("child one"))
+	require.NoError(err, "Insert(child)")
+	value, err := child.RemoveExisting(ctx, []byte("key 2"))
+	require.NoError(err, "RemoveExisting(child)")
+	require.Equal([]byte("two"), value, "RemoveExisting should return the previous value")
+	err = child.Insert(ctx, []byte("key 3"), []byte("child three"))
+	require.NoError(err, "Insert(child)")
+
+	grandchild, err := child.Fork(ctx)
+	require.NoError(err, "Fork(child)")
+	for _, entry := range grandchildOps {
+		err = grandchild.Insert(ctx, entry.Key, entry.Value)
+		require.NoError(err, "Insert(grandchild)")
+	}
+
+	t.Run("Isolation", func(t *testing.T) {
+		requireValues(t, tree, writelog.WriteLog{
+			writelog.LogEntry{Key: []byte("key 1"), Value: []byte("parent one")},
+			writelog.LogEntry{Key: []byte("key 2"), Value: []byte("two")},
+			writelog.LogEntry{Key: []byte("key 3"), Value: nil},
+			writelog.LogEntry{Key: []byte("key 4"), Value: []byte("parent four")},
+			writelog.LogEntry{Key: []byte("key 5"), Value: nil},
+			writelog.LogEntry{Key: []byte("key 6"), Value: nil},
+		})
+
+		childItems := writelog.WriteLog{
+			writelog.LogEntry{Key: []byte("key 1"), Value: []byte("child one")},
+			writelog.LogEntry{Key: []byte("key 3"), Value: []byte("child three")},
+			writelog.LogEntry{Key: []byte("key 5"), Value: []byte("five")},
+		}
+		requireValues(t, child, childItems)
+		requireValues(t, child, writelog.WriteLog{
+			writelog.LogEntry{Key: []byte("key 2"), Value: nil},
+			writelog.LogEntry{Key: []byte("key 4"), Value: nil},
+			writelog.LogEntry{Key: []byte("key 6"), Value: nil},
+		})
+
+		it := child.NewIterator(ctx)
+		defer it.Close()
+		testIterator(t, childItems, it, []testCase{
+			{seek: node.Key("key 0"), pos: 0},
+			{seek: node.Key("key 2"), pos: 1},
+			{seek: node.Key("key 4"), pos: 2},
+			{seek: node.Key("key 6"), pos: -1},
+		})
+
+		requireValues(t, grandchild, writelog.WriteLog{
+			writelog.LogEntry{Key: []byte("key 1"), Value: []byte("child one")},
+			writelog.LogEntry{Key: []byte("key 2"), Value: nil},
+			writelog.LogEntry{Key: []byte("key 3"), Value: []byte("grandchild three")},
+			writelog.LogEntry{Key: []byte("key 4"), Value: nil},
+			writelog.LogEntry{Key: []byte("key 5"), Value: []byte("five")},
+			writelog.LogEntry{Key: []byte("key 6"), Value: []byte("grandchild six")},
+		})
+	})
+
+	t.Run("MergeMismatch", func(t *testing.T) {
+		err := tree.MergeFork(ctx, grandchild)
+		require.ErrorIs(err, ErrForkMismatch, "MergeFork should fail for a fork of another tree")
+	})
+
+	// Merge everything back and make sure the result matches sequential application.
+	err = child.MergeFork(ctx, grandchild)
+	require.NoError(err, "MergeFork(grandchild)")
+	err = tree.MergeFork(ctx, child)
+	require.NoError(err, "MergeFork(child)")
+
+	_, err = child.Get(ctx, []byte("key 1"))
+	require.ErrorIs(err, ErrClosed, "merged fork should be closed")
+
+	_, root, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	require.Equal(expectedRoot, root, "root after merging forks should match sequential application")
+}
@@ -0,0 +1,167 @@
+package mkvs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	badgerDb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/badger"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+)
+
+// allItemsRootNamespaced is the root of all items under testNs in namespaced hash mode.
+const allItemsRootNamespaced = "4597b25a512f2bae6d00b5c005ca3a80ba9d2d4c9155ed0648eaf27d92062c47"
+
+func TestHashModeNamespaced(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	otherNs := common.NewTestNamespaceFromSeed([]byte("oasis mkvs other test ns"), 0)
+	keys, values := generateKeyValuePairs()
+	populate := func(tree Tree) {
+		for i := range keys {
+			err := tree.Insert(ctx, keys[i], values[i])
+			require.NoError(err, "Insert")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "mkvs.test.badger")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dir)
+
+	cfg := &db.Config{
+		DB:               dir,
+		NoFsync:          true,
+		Namespace:        testNs,
+		HashMode:         node.HashModeNamespaced,
+		VerifyNodeHashes: true,
+	}
+	ndb, err := badgerDb.New(cfg)
+	require.NoError(err, "New")
+
+	tree := New(nil, ndb, node.RootTypeState, WithHashMode(node.HashModeNamespaced))
+	populate(tree)
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	require.Equal(allItemsRootNamespaced, rootHash.String())
+
+	root := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+		Hash:      rootHash,
+		HashMode:  node.HashModeNamespaced,
+	}
+	require.True(ndb.HasRoot(root), "HasRoot")
+
+	// The same contents should have different roots in the default hash mode and in other
+	// namespaces.
+	for _, tc := range []struct {
+		ns       common.Namespace
+		mode     node.HashMode
+		expected string
+	}{
+		{testNs, node.HashModeDefault, allItemsRoot},
+		{otherNs, node.HashModeDefault, allItemsRoot},
+		{otherNs, node.HashModeNamespaced, ""},
+	} {
+		other := New(nil, nil, node.RootTypeState, WithHashMode(tc.mode))
+		populate(other)
+		_, otherHash, err := other.Commit(ctx, tc.ns, 0)
+		require.NoError(err, "Commit")
+		require.NotEqual(rootHash, otherHash, "roots should depend on the hash mode and namespace")
+		if tc.expected != "" {
+			require.Equal(tc.expected, otherHash.String())
+		}
+		other.Close()
+	}
+
+	// Nodes read from the database should be hashed in the domain of the root.
+	dbTree := NewWithRoot(nil, ndb, root)
+	defer dbTree.Close()
+	for i := range keys {
+		value, err := dbTree.Get(ctx, keys[i])
+		require.NoError(err, "Get")
+		require.Equal(values[i], value)
+	}
+
+	// Proofs should be verified in the domain of the root.
+	remoteTree := NewWithRoot(dbTree, nil, root, Capacity(0, 0))
+	defer remoteTree.Close()
+	for i := range keys {
+		value, err := remoteTree.Get(ctx, keys[i])
+		require.NoError(err, "remote Get")
+		require.Equal(values[i], value)
+	}
+
+	rsp, err := dbTree.SyncGet(ctx, &syncer.GetRequest{
+		Tree: syncer.TreeID{Root: root, Position: root.Hash},
+		Key:  keys[0],
+	})
+	require.NoError(err, "SyncGet")
+	pv := syncer.ProofVerifier{Domain: root.HashDomain()}
+	_, err = pv.VerifyProof(ctx, root.Hash, &rsp.Proof)
+	require.NoError(err, "VerifyProof should succeed in the domain of the root")
+	pv.Domain = node.HashDomain{}
+	_, err = pv.VerifyProof(ctx, root.Hash, &rsp.Proof)
+	require.Error(err, "VerifyProof should fail in the default domain")
+	pv.Domain = node.HashDomain{Mode: node.HashModeNamespaced, Namespace: otherNs}
+	_, err = pv.VerifyProof(ctx, root.Hash, &rsp.Proof)
+	require.Error(err, "VerifyProof should fail in the domain of another namespace")
+
+	// Standalone proof verification should also use the domain of the root.
+	defaultRoot := root
+	defaultRoot.HashMode = node.HashModeDefault
+	kvs, err := syncer.VerifyProofResponse(ctx, root, rsp)
+	require.NoError(err, "VerifyProofResponse")
+	require.NotEmpty(kvs, "VerifyProofResponse should return the proven key/value pairs")
+	_, err = syncer.VerifyProofResponse(ctx, defaultRoot, rsp)
+	require.Error(err, "VerifyProofResponse should fail in the default domain")
+
+	startKey, endKey := []byte("key 1"), []byte("key 2")
+	rangeKvs, rangeProof, err := dbTree.GetRangeWithProof(ctx, startKey, endKey, 1000)
+	require.NoError(err, "GetRangeWithProof")
+	require.NotEmpty(rangeKvs, "GetRangeWithProof should return keys in range")
+	err = VerifyRangeProof(ctx, root, startKey, endKey, rangeKvs, rangeProof)
+	require.NoError(err, "VerifyRangeProof")
+	err = VerifyRangeProof(ctx, defaultRoot, startKey, endKey, rangeKvs, rangeProof)
+	require.ErrorIs(err, ErrInvalidRangeProof, "VerifyRangeProof should fail in the default domain")
+
+	for _, prefix := range [][]byte{[]byte("key 1"), []byte("key 1a")} {
+		pp, err := dbTree.ProvePrefixEmpty(ctx, prefix)
+		require.NoError(err, "ProvePrefixEmpty")
+		err = VerifyPrefixProof(ctx, root, prefix, pp)
+		require.NoError(err, "VerifyPrefixProof")
+		err = VerifyPrefixProof(ctx, defaultRoot, prefix, pp)
+		require.ErrorIs(err, ErrInvalidPrefixProof, "VerifyPrefixProof should fail in the default domain")
+	}
+
+	// Mixing hash modes within a database should fail.
+	defaultTree := New(nil, ndb, node.RootTypeState)
+	defer defaultTree.Close()
+	populate(defaultTree)
+	_, _, err = defaultTree.Commit(ctx, testNs, 1)
+	require.ErrorIs(err, db.ErrHashModeMismatch, "Commit in the default hash mode should fail")
+
+	require.False(ndb.HasRoot(defaultRoot), "HasRoot should fail for roots in the default hash mode")
+	_, err = ndb.GetNode(defaultRoot, &node.Pointer{Clean: true, Hash: root.Hash})
+	require.ErrorIs(err, db.ErrHashModeMismatch, "GetNode should fail for roots in the default hash mode")
+
+	// Committing a tree under another namespace should fail.
+	err = dbTree.Insert(ctx, []byte("key"), []byte("value"))
+	require.NoError(err, "Insert")
+	_, _, err = dbTree.Commit(ctx, otherNs, 1)
+	require.ErrorIs(err, db.ErrHashModeMismatch, "Commit under another namespace should fail")
+
+	// Opening the database in another hash mode should fail.
+	ndb.Close()
+	cfg.HashMode = node.HashModeDefault
+	_, err = badgerDb.New(cfg)
+	require.ErrorIs(err, db.ErrHashModeMismatch, "New should fail with a different hash mode")
+}
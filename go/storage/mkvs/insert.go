@@ -10,49 +10,126 @@ import (
 
 // Implements Tree.
 func (t *tree) Insert(ctx context.Context, key, value []byte) error {
+	_, _, err := t.InsertEx(ctx, key, value)
+	return err
+}
+
+// Implements Tree.
+func (t *tree) InsertEx(ctx context.Context, key, value []byte) (bool, []byte, error) {
+	result, err := t.insertIf(ctx, key, value, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	return result.existed, result.previous, nil
+}
+
+// Implements Tree.
+func (t *tree) CompareAndSwap(ctx context.Context, key, expectedValue, newValue []byte) (bool, []byte, error) {
+	result, err := t.insertIf(ctx, key, newValue, func(existed bool, previous []byte) bool {
+		if expectedValue == nil {
+			return !existed
+		}
+		return existed && bytes.Equal(previous, expectedValue)
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return !result.skipped, result.previous, nil
+}
+
+// Implements Tree.
+func (t *tree) GetOrInsert(ctx context.Context, key, defaultValue []byte) ([]byte, bool, error) {
+	if defaultValue == nil {
+		defaultValue = []byte{}
+	}
+
+	result, err := t.insertIf(ctx, key, defaultValue, func(existed bool, _ []byte) bool {
+		return !existed
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if result.existed {
+		return result.previous, false, nil
+	}
+	return defaultValue, true, nil
+}
+
+// insertIf inserts a key/value pair into the tree in case the given condition, which is evaluated
+// during the same traversal based on whether the key exists and its current value, holds. A nil
+// condition always holds.
+func (t *tree) insertIf(ctx context.Context, key, value []byte, cond insertCondition) (insertResult, error) {
+	if err := t.checkKeySize(key); err != nil {
+		return insertResult{}, err
+	}
 	if value == nil {
 		value = []byte{}
 	}
 
+	if err := t.forks.copyOnWrite(ctx, t, key); err != nil {
+		return insertResult{}, err
+	}
+
 	t.cache.Lock()
 	defer t.cache.Unlock()
 
 	if t.cache.isClosed() {
-		return ErrClosed
+		return insertResult{}, ErrClosed
 	}
 
 	// Remember where the path from root to target node ends (will end).
 	t.cache.markPosition()
 
 	var result insertResult
-	result, err := t.doInsert(ctx, t.cache.pendingRoot, 0, key, value, 0)
+	result, err := t.doInsert(ctx, t.cache.pendingRoot, 0, key, value, 0, cond)
 	if err != nil {
-		return err
+		return insertResult{}, err
+	}
+	if result.skipped {
+		return result, nil
 	}
 
 	// Update the pending write log.
 	if !t.withoutWriteLog {
 		entry := t.pendingWriteLog[node.ToMapKey(key)]
-		if entry == nil {
+		switch {
+		case entry == nil && result.unchanged && t.elideNoopWrites:
+			// The value of an existing key has not changed, no need to record it.
+		case entry == nil:
 			t.pendingWriteLog[node.ToMapKey(key)] = &pendingEntry{
 				key:          key,
 				value:        value,
 				existed:      result.existed,
 				insertedLeaf: result.insertedLeaf,
 			}
-		} else {
+		default:
 			entry.value = value
 		}
 	}
 
 	t.cache.setPendingRoot(result.newRoot)
-	return nil
+	return result, nil
+}
+
+// insertCondition decides whether an insert should be performed based on whether the key exists
+// and its current value.
+type insertCondition func(existed bool, previous []byte) bool
+
+func (c insertCondition) holds(existed bool, previous []byte) bool {
+	return c == nil || c(existed, previous)
 }
 
 type insertResult struct {
 	newRoot      *node.Pointer
 	insertedLeaf *node.Pointer
 	existed      bool
+	// previous is the previous value of the key in case it existed.
+	previous []byte
+	// unchanged is true iff the key existed and already had the inserted value.
+	unchanged bool
+	// skipped is true iff the insert was not performed as its condition did not hold, in which
+	// case the tree is not modified.
+	skipped bool
 }
 
 func (t *tree) doInsert(
@@ -62,13 +139,14 @@ func (t *tree) doInsert(
 	key node.Key,
 	val []byte,
 	depth node.Depth,
+	cond insertCondition,
 ) (insertResult, error) {
 	if ctx.Err() != nil {
 		return insertResult{}, ctx.Err()
 	}
 
 	// Dereference the node, possibly making a remote request.
-	nd, err := t.cache.derefNodePtr(ctx, ptr, t.newFetcherSyncGet(key, false))
+	nd, err := t.cache.derefNodePtr(ctx, ptr, bitDepth, key, t.newFetcherSyncGet(key, false))
 	if err != nil {
 		return insertResult{}, err
 	}
@@ -77,6 +155,10 @@ func (t *tree) doInsert(
 
 	switch n := nd.(type) {
 	case nil:
+		if !cond.holds(false, nil) {
+			return insertResult{newRoot: ptr, skipped: true}, nil
+		}
+
 		// Insert into nil node, create a new leaf node.
 		newLeaf := t.cache.newLeafNode(key, val)
 		result := insertResult{
@@ -96,17 +178,21 @@ func (t *tree) doInsert(
 			if key.BitLength() == bitLength {
 				// Key to insert ends exactly at this node. Add it to the
 				// existing internal node as LeafNode.
-				result, err = t.doInsert(ctx, n.LeafNode, bitLength, key, val, depth)
+				result, err = t.doInsert(ctx, n.LeafNode, bitLength, key, val, depth, cond)
 			} else if key.GetBit(bitLength) {
 				// Insert recursively based on the bit value.
-				result, err = t.doInsert(ctx, n.Right, bitLength, key, val, depth+1)
+				result, err = t.doInsert(ctx, n.Right, bitLength, key, val, depth+1, cond)
 			} else {
-				result, err = t.doInsert(ctx, n.Left, bitLength, key, val, depth+1)
+				result, err = t.doInsert(ctx, n.Left, bitLength, key, val, depth+1, cond)
 			}
 
 			if err != nil {
 				return insertResult{}, err
 			}
+			if result.skipped {
+				result.newRoot = ptr
+				return result, nil
+			}
 
 			if key.BitLength() == bitLength {
 				n.LeafNode = result.newRoot
@@ -132,6 +218,10 @@ func (t *tree) doInsert(
 			return result, nil
 		}
 
+		if !cond.holds(false, nil) {
+			return insertResult{newRoot: ptr, skipped: true}, nil
+		}
+
 		// Key mismatches the label at position cpLength. Split the edge and
 		// insert new leaf.
 		labelPrefix, labelSuffix := n.Label.Split(cpLength, n.LabelBitLength)
@@ -176,11 +266,21 @@ func (t *tree) doInsert(
 	case *node.LeafNode:
 		// If the key matches, we can just update the value.
 		if n.Key.Equal(key) {
+			if !cond.holds(true, n.Value) {
+				return insertResult{
+					newRoot:  ptr,
+					existed:  true,
+					previous: n.Value,
+					skipped:  true,
+				}, nil
+			}
 			if bytes.Equal(n.Value, val) {
 				return insertResult{
 					newRoot:      ptr,
 					insertedLeaf: ptr,
 					existed:      true,
+					previous:     n.Value,
+					unchanged:    true,
 				}, nil
 			}
 
@@ -189,6 +289,7 @@ func (t *tree) doInsert(
 				t.pendingRemovedNodes = append(t.pendingRemovedNodes, n.ExtractUnchecked())
 			}
 
+			previous := n.Value
 			n.Value = val
 			n.Clean = false
 			ptr.Clean = false
@@ -198,15 +299,20 @@ func (t *tree) doInsert(
 				newRoot:      ptr,
 				insertedLeaf: ptr,
 				existed:      true,
+				previous:     previous,
 			}, nil
 		}
 
+		if !cond.holds(false, nil) {
+			return insertResult{newRoot: ptr, skipped: true}, nil
+		}
+
 		var result insertResult
 		_, leafKeyRemainder := n.Key.Split(bitDepth, n.Key.BitLength())
 		cpLength := leafKeyRemainder.CommonPrefixLen(n.Key.BitLength()-bitDepth, keyRemainder, key.BitLength()-bitDepth)
 
 		// Key mismatches the label at position cpLength. Split the edge.
-		labelPrefix, _ := leafKeyRemainder.Split(cpLength, leafKeyRemainder.BitLength())
+		labelPrefix := leafKeyRemainder.Prefix(cpLength)
 		newLeaf := t.cache.newLeafNode(key, val)
 		result.insertedLeaf = newLeaf
 		var leafNode, left, right *node.Pointer
@@ -68,9 +68,9 @@ func doProtoServer(cmd *cobra.Command, args []string) {
 
 	// Initialize a dummy storage backend.
 	storageCfg := api.Config{
-		Backend:      database.BackendNameBadgerDB,
-		DB:           dataDir,
-		MaxCacheSize: 16 * 1024 * 1024,
+		Backend:        database.BackendNameBadgerDB,
+		DB:             dataDir,
+		BlockCacheSize: 16 * 1024 * 1024,
 	}
 
 	if fixtureName := viper.GetString(cfgServerFixture); fixtureName != "" {
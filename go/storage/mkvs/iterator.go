@@ -25,6 +25,13 @@ func (t *tree) SyncIterate(ctx context.Context, request *syncer.IterateRequest)
 	if !t.cache.pendingRoot.IsClean() {
 		return nil, syncer.ErrDirtyRoot
 	}
+	version, err := negotiateSyncVersion(request.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.checkKeySize(request.Key); err != nil {
+		return nil, err
+	}
 
 	// Create an iterator which generates proofs. Always anchor the proof at the
 	// root as an iterator may encompass many subtrees. Make sure to propagate
@@ -47,35 +54,40 @@ func (t *tree) SyncIterate(ctx context.Context, request *syncer.IterateRequest)
 	}
 
 	// Retrieve the proof for the items iterated over.
-	proof, err := it.GetProof()
+	proof, err := it.GetProofBuilder().BuildForVersion(ctx, version)
 	if err != nil {
 		return nil, err
 	}
 
 	return &syncer.ProofResponse{
-		Proof: *proof,
+		Version: syncer.ResponseVersion(request.Version, version),
+		Proof:   *proof,
 	}, nil
 }
 
 func (t *tree) newFetcherSyncIterate(key node.Key, prefetch uint16) readSyncFetcher {
 	return func(ctx context.Context, ptr *node.Pointer, rs syncer.ReadSyncer) (*syncer.Proof, error) {
-		rsp, err := rs.SyncIterate(ctx, &syncer.IterateRequest{
-			Tree: syncer.TreeID{
-				Root:     t.cache.syncRoot,
-				Position: ptr.Hash,
-			},
-			Key:      key,
-			Prefetch: prefetch,
+		return t.cache.versionedSync(ctx, func(version uint16) (*syncer.ProofResponse, error) {
+			return rs.SyncIterate(ctx, &syncer.IterateRequest{
+				Version: version,
+				Tree: syncer.TreeID{
+					Root:     t.cache.syncRoot,
+					Position: ptr.Hash,
+				},
+				Key:      key,
+				Prefetch: prefetch,
+			})
 		})
-		if err != nil {
-			return nil, err
-		}
-		return &rsp.Proof, nil
 	}
 }
 
 // Iterator is a tree iterator.
 //
+// Keys are always visited in byte-wise lexicographic order (as defined by bytes.Compare), with
+// the empty key being the smallest key. The order is the same regardless of whether the tree is
+// backed by a local node database, only by its in-memory cache or by a remote read syncer, which
+// is what makes proofs of key ranges verifiable by a remote party.
+//
 // Iterators are not safe for concurrent use.
 type Iterator interface {
 	// Valid checks whether the iterator points to a valid item.
@@ -86,6 +98,10 @@ type Iterator interface {
 	Rewind()
 	// Seek moves the iterator either at the given key or at the next larger
 	// key.
+	//
+	// On syncer-backed trees, seeking results in a single SyncIterate request
+	// rooted at the given key which returns exactly the nodes needed to
+	// position the iterator (and any prefetched entries).
 	Seek(node.Key)
 	// Next advances the iterator to the next key.
 	Next()
@@ -100,12 +116,28 @@ type Iterator interface {
 	GetProof() (*syncer.Proof, error)
 	// GetProofBuilder returns the proof builder associated with this iterator.
 	GetProofBuilder() *syncer.ProofBuilder
+	// Cursor returns a serializable cursor which can be used to resume iteration right after the
+	// current key via Tree.NewIteratorAt, even from a different tree instance.
+	//
+	// In case the iterator is not valid, the cursor resumes at the end of the tree. The tree must
+	// not have any uncommitted changes.
+	Cursor() (*IteratorCursor, error)
 	// Close releases resources associated with the iterator.
 	//
 	// Not calling this method leads to memory leaks.
 	Close()
 }
 
+// IteratorCursor is an opaque iterator position obtained via Iterator.Cursor.
+type IteratorCursor struct {
+	// Root is the hash of the root of the iterated tree.
+	Root hash.Hash `json:"root"`
+	// Key is the last key yielded by the iterator.
+	Key node.Key `json:"key,omitempty"`
+	// Exhausted is true iff the iterator has reached the end of the tree.
+	Exhausted bool `json:"exhausted,omitempty"`
+}
+
 type visitState uint8
 
 const (
@@ -166,6 +198,36 @@ func newTreeIterator(ctx context.Context, tree *tree, options ...IteratorOption)
 	return it
 }
 
+// newTreeIteratorAt creates a new iterator positioned right after the key of the given cursor.
+func newTreeIteratorAt(ctx context.Context, tree *tree, cursor *IteratorCursor, options ...IteratorOption) (Iterator, error) {
+	rootHash, err := tree.iteratorRootHash()
+	if err != nil {
+		return nil, err
+	}
+	if !rootHash.Equal(&cursor.Root) {
+		return nil, ErrCursorRootMismatch
+	}
+
+	it := newTreeIterator(ctx, tree, options...)
+	if cursor.Exhausted {
+		return it, nil
+	}
+
+	it.Seek(cursor.Key)
+	if it.Valid() && it.Key().Equal(cursor.Key) {
+		it.Next()
+	}
+	return it, nil
+}
+
+// iteratorRootHash returns the hash of the root that iterators start from.
+func (t *tree) iteratorRootHash() (hash.Hash, error) {
+	if !t.cache.pendingRoot.IsClean() {
+		return hash.Hash{}, syncer.ErrDirtyRoot
+	}
+	return t.cache.pendingRoot.GetHash(), nil
+}
+
 func (it *treeIterator) Valid() bool {
 	return it.key != nil
 }
@@ -244,7 +306,7 @@ func (it *treeIterator) Next() {
 
 func (it *treeIterator) doNext(ptr *node.Pointer, bitDepth node.Depth, path, key node.Key, state visitState) error { // nolint: gocyclo
 	// Dereference the node, possibly making a remote request.
-	nd, err := it.tree.cache.derefNodePtr(it.ctx, ptr, it.tree.newFetcherSyncIterate(key, it.prefetch))
+	nd, err := it.tree.cache.derefNodePtr(it.ctx, ptr, bitDepth, path, it.tree.newFetcherSyncIterate(key, it.prefetch))
 	if err != nil {
 		return err
 	}
@@ -273,7 +335,7 @@ func (it *treeIterator) doNext(ptr *node.Pointer, bitDepth node.Depth, path, key
 		// Does lookup key end here? Look into LeafNode.
 		if (state == visitBefore && (key.BitLength() <= bitLength || takeFirst)) || state == visitAt {
 			if state == visitBefore {
-				err := it.doNext(n.LeafNode, bitLength, path, key, visitBefore)
+				err := it.doNext(n.LeafNode, bitLength, newPath, key, visitBefore)
 				if err != nil {
 					return err
 				}
@@ -307,7 +369,7 @@ func (it *treeIterator) doNext(ptr *node.Pointer, bitDepth node.Depth, path, key
 				}
 			}
 			// Key has not been found, continue with search for next key.
-			key, _ = key.Split(bitLength, key.BitLength())
+			key = key.Prefix(bitLength)
 			key = key.AppendBit(bitLength, true)
 		}
 
@@ -351,6 +413,22 @@ func (it *treeIterator) GetProofBuilder() *syncer.ProofBuilder {
 	return it.proofBuilder
 }
 
+func (it *treeIterator) Cursor() (*IteratorCursor, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	rootHash, err := it.tree.iteratorRootHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &IteratorCursor{
+		Root:      rootHash,
+		Key:       append(node.Key{}, it.key...),
+		Exhausted: !it.Valid(),
+	}, nil
+}
+
 func (it *treeIterator) Close() {
 	it.reset()
 	it.ctx = nil
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
 	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
@@ -137,6 +138,182 @@ func TestIterator(t *testing.T) {
 	})
 }
 
+func TestIteratorSeekRemote(t *testing.T) {
+	ctx := context.Background()
+	tree := New(nil, nil, 0, Capacity(0, 0))
+	defer tree.Close()
+
+	keys, values := generateKeyValuePairs()
+	for i := range keys {
+		err := tree.Insert(ctx, keys[i], values[i])
+		require.NoError(t, err, "Insert")
+	}
+
+	var root node.Root
+	_, rootHash, err := tree.Commit(ctx, root.Namespace, root.Version)
+	require.NoError(t, err, "Commit")
+	root.Hash = rootHash
+
+	// Determine the expected iteration order from the local tree.
+	var sorted []node.Key
+	lit := tree.NewIterator(ctx)
+	defer lit.Close()
+	for lit.Rewind(); lit.Valid(); lit.Next() {
+		sorted = append(sorted, lit.Key())
+	}
+	require.Len(t, sorted, len(keys), "local iteration should return all keys")
+
+	for _, tc := range []struct {
+		name string
+		seek node.Key
+		pos  int
+	}{
+		{"First", sorted[0], 0},
+		{"Middle", sorted[500], 500},
+		{"Last", sorted[len(sorted)-1], len(sorted) - 1},
+		{"BeforeFirst", node.Key("a"), 0},
+		{"Between", append(append(node.Key{}, sorted[500]...), 0x00), 501},
+		{"AfterLast", node.Key("z"), -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := syncer.NewStatsCollector(tree)
+			remote := NewWithRoot(stats, nil, root, Capacity(0, 0))
+			defer remote.Close()
+
+			it := remote.NewIterator(ctx, IteratorPrefetch(10))
+			defer it.Close()
+
+			it.Seek(tc.seek)
+			require.NoError(t, it.Err(), "Seek")
+			if tc.pos < 0 {
+				require.False(t, it.Valid(), "iterator should be invalid")
+			} else {
+				require.True(t, it.Valid(), "iterator should be valid")
+				require.EqualValues(t, sorted[tc.pos], it.Key(), "iterator should be at correct key")
+			}
+
+			require.EqualValues(t, 0, stats.SyncGetCount, "SyncGetCount")
+			require.EqualValues(t, 0, stats.SyncGetPrefixesCount, "SyncGetPrefixesCount")
+			require.EqualValues(t, 1, stats.SyncIterateCount, "Seek should cost exactly one SyncIterate")
+
+			// Subsequent Next calls should be served from prefetched entries.
+			for i := 1; i <= 10 && it.Valid(); i++ {
+				it.Next()
+				require.NoError(t, it.Err(), "Next")
+				if tc.pos+i < len(sorted) {
+					require.EqualValues(t, sorted[tc.pos+i], it.Key(), "iterator should be at correct key")
+				} else {
+					require.False(t, it.Valid(), "iterator should be invalid")
+				}
+			}
+			require.EqualValues(t, 0, stats.SyncGetCount, "SyncGetCount")
+			require.EqualValues(t, 1, stats.SyncIterateCount, "Next should reuse prefetched entries")
+		})
+	}
+}
+
+func TestIteratorCursor(t *testing.T) {
+	ctx := context.Background()
+
+	factory, cleanup := initBadgerBackend(t)
+	defer cleanup()
+	ndb, err := factory(testNs)
+	require.NoError(t, err, "New")
+	defer ndb.Close()
+
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+
+	keys, values := generateKeyValuePairs()
+	for i := range keys {
+		err = tree.Insert(ctx, keys[i], values[i])
+		require.NoError(t, err, "Insert")
+	}
+
+	// Cursors require the tree to be committed.
+	it := tree.NewIterator(ctx)
+	it.Rewind()
+	_, err = it.Cursor()
+	require.ErrorIs(t, err, syncer.ErrDirtyRoot, "Cursor should fail with uncommitted changes")
+	it.Close()
+
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+	root := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+
+	var expected []node.Key
+	it = tree.NewIterator(ctx)
+	for it.Rewind(); it.Valid(); it.Next() {
+		expected = append(expected, it.Key())
+	}
+	require.NoError(t, it.Err(), "iteration should not fail")
+	it.Close()
+
+	// Iterate over the first half and serialize the cursor.
+	half := len(expected) / 2
+	var visited []node.Key
+	it = tree.NewIterator(ctx)
+	it.Rewind()
+	for {
+		visited = append(visited, it.Key())
+		if len(visited) == half {
+			// The cursor refers to the last yielded key, so take it before advancing.
+			break
+		}
+		it.Next()
+	}
+	cursor, err := it.Cursor()
+	require.NoError(t, err, "Cursor")
+	it.Close()
+	rawCursor := cbor.Marshal(cursor)
+
+	for _, tc := range []struct {
+		name string
+		tree Tree
+	}{
+		{"Local", NewWithRoot(nil, ndb, root)},
+		{"Remote", NewWithRoot(tree, nil, root, Capacity(0, 0))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.tree.Close()
+
+			var decoded IteratorCursor
+			err := cbor.Unmarshal(rawCursor, &decoded)
+			require.NoError(t, err, "Unmarshal")
+
+			rit, err := tc.tree.NewIteratorAt(ctx, &decoded, IteratorPrefetch(10))
+			require.NoError(t, err, "NewIteratorAt")
+			defer rit.Close()
+
+			resumed := append([]node.Key{}, visited...)
+			for ; rit.Valid(); rit.Next() {
+				resumed = append(resumed, rit.Key())
+			}
+			require.NoError(t, rit.Err(), "iteration should not fail")
+			require.Equal(t, expected, resumed, "resumed iteration should continue after the cursor")
+
+			// Exhausted iterators should resume at the end.
+			cursor, err := rit.Cursor()
+			require.NoError(t, err, "Cursor")
+			require.True(t, cursor.Exhausted, "cursor should be exhausted")
+			eit, err := tc.tree.NewIteratorAt(ctx, cursor)
+			require.NoError(t, err, "NewIteratorAt")
+			require.False(t, eit.Valid(), "iterator should be invalid")
+			eit.Close()
+		})
+	}
+
+	// Resuming against a different root should fail.
+	err = tree.Insert(ctx, []byte("another key"), []byte("value"))
+	require.NoError(t, err, "Insert")
+	_, otherRootHash, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	other := NewWithRoot(nil, ndb, node.Root{Namespace: testNs, Version: 1, Type: node.RootTypeState, Hash: otherRootHash})
+	defer other.Close()
+	_, err = other.NewIteratorAt(ctx, cursor)
+	require.ErrorIs(t, err, ErrCursorRootMismatch, "NewIteratorAt should fail for a different root")
+}
+
 func TestIteratorCase1(t *testing.T) {
 	ctx := context.Background()
 	tree := New(nil, nil, 0)
@@ -0,0 +1,115 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+func TestMaxKeySize(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	atLimit := bytes.Repeat([]byte{0x42}, DefaultMaxKeySize)
+	overLimit := bytes.Repeat([]byte{0x42}, DefaultMaxKeySize+1)
+	value := []byte("value")
+
+	tree := New(nil, nil, node.RootTypeState)
+	defer tree.Close()
+
+	err := tree.Insert(ctx, []byte("key"), value)
+	require.NoError(err, "Insert")
+	err = tree.Insert(ctx, atLimit, value)
+	require.NoError(err, "Insert should allow keys at the limit")
+	v, err := tree.Get(ctx, atLimit)
+	require.NoError(err, "Get should allow keys at the limit")
+	require.Equal(value, v, "Get should return the correct value")
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+
+	// Operations with oversized keys should be rejected without touching the tree.
+	err = tree.Insert(ctx, overLimit, value)
+	require.ErrorIs(err, ErrKeyTooLarge, "Insert should reject oversized keys")
+	_, _, err = tree.InsertEx(ctx, overLimit, value)
+	require.ErrorIs(err, ErrKeyTooLarge, "InsertEx should reject oversized keys")
+	_, _, err = tree.GetOrInsert(ctx, overLimit, value)
+	require.ErrorIs(err, ErrKeyTooLarge, "GetOrInsert should reject oversized keys")
+	err = tree.Remove(ctx, overLimit)
+	require.ErrorIs(err, ErrKeyTooLarge, "Remove should reject oversized keys")
+	_, err = tree.Get(ctx, overLimit)
+	require.ErrorIs(err, ErrKeyTooLarge, "Get should reject oversized keys")
+
+	wl, newRootHash, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(err, "Commit")
+	require.Empty(wl, "rejected operations should not produce write log entries")
+	require.Equal(rootHash, newRootHash, "rejected operations should not change the root")
+
+	// Write logs are applied up to the first oversized key.
+	err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(writelog.WriteLog{
+		{Key: []byte("another key"), Value: value},
+		{Key: overLimit, Value: value},
+		{Key: []byte("yet another key"), Value: value},
+	}))
+	require.ErrorIs(err, ErrKeyTooLarge, "ApplyWriteLog should reject oversized keys")
+	wl, _, err = tree.Commit(ctx, testNs, 2)
+	require.NoError(err, "Commit")
+	require.Equal(writelog.WriteLog{{Key: []byte("another key"), Value: value}}, wl, "only preceding entries should be applied")
+
+	// The limit should be configurable.
+	small := New(nil, nil, node.RootTypeState, WithMaxKeySize(3))
+	defer small.Close()
+	err = small.Insert(ctx, []byte("key"), value)
+	require.NoError(err, "Insert should allow keys at the configured limit")
+	err = small.Insert(ctx, []byte("keys"), value)
+	require.ErrorIs(err, ErrKeyTooLarge, "Insert should reject keys over the configured limit")
+
+	unlimited := New(nil, nil, node.RootTypeState, WithMaxKeySize(0))
+	defer unlimited.Close()
+	err = unlimited.Insert(ctx, overLimit, value)
+	require.NoError(err, "Insert should allow any key when the limit is disabled")
+}
+
+func TestMaxKeySizeSyncer(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := New(nil, nil, node.RootTypeState)
+	defer server.Close()
+	overLimit := bytes.Repeat([]byte{0x42}, DefaultMaxKeySize+1)
+	err := server.Insert(ctx, []byte("key"), []byte("value"))
+	require.NoError(err, "Insert")
+	_, rootHash, err := server.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	root := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+	treeID := syncer.TreeID{Root: root, Position: rootHash}
+
+	// Servers should reject oversized keys in requests regardless of the limit of the client.
+	_, err = server.SyncGet(ctx, &syncer.GetRequest{Tree: treeID, Key: overLimit})
+	require.ErrorIs(err, ErrKeyTooLarge, "SyncGet should reject oversized keys")
+	_, err = server.SyncGet(ctx, &syncer.GetRequest{
+		Version: syncer.ProtocolVersion2,
+		Tree:    treeID,
+		Key:     []byte("key"),
+		Keys:    [][]byte{overLimit},
+	})
+	require.ErrorIs(err, ErrKeyTooLarge, "SyncGet should reject oversized additional keys")
+	_, err = server.SyncIterate(ctx, &syncer.IterateRequest{Tree: treeID, Key: overLimit})
+	require.ErrorIs(err, ErrKeyTooLarge, "SyncIterate should reject oversized keys")
+	_, err = server.SyncGetPrefixes(ctx, &syncer.GetPrefixesRequest{Tree: treeID, Prefixes: [][]byte{overLimit}})
+	require.ErrorIs(err, ErrKeyTooLarge, "SyncGetPrefixes should reject oversized prefixes")
+
+	_, err = server.SyncGet(ctx, &syncer.GetRequest{Tree: treeID, Key: []byte("key")})
+	require.NoError(err, "SyncGet should allow keys within the limit")
+
+	// Clients without a limit should still be rejected by the server.
+	client := NewWithRoot(server, nil, root, WithMaxKeySize(0))
+	defer client.Close()
+	_, err = client.Get(ctx, overLimit)
+	require.ErrorIs(err, ErrKeyTooLarge, "remote Get should be rejected by the server")
+}
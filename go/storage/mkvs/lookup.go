@@ -10,12 +10,19 @@ import (
 
 // Implements Tree.
 func (t *tree) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if err := t.checkKeySize(key); err != nil {
+		return nil, err
+	}
+
 	t.cache.Lock()
 	defer t.cache.Unlock()
 
 	if t.cache.isClosed() {
 		return nil, ErrClosed
 	}
+	if t.accessRecorder != nil {
+		t.accessRecorder.recordKey(key)
+	}
 
 	// If the key has been modified locally, no need to perform any lookups.
 	if !t.withoutWriteLog {
@@ -24,6 +31,11 @@ func (t *tree) Get(ctx context.Context, key []byte) ([]byte, error) {
 		}
 	}
 
+	// Lookups of keys which are not in the key filter of the root need no traversal.
+	if t.hasNodeDB && !t.cache.mayContainKey(ctx, key) {
+		return nil, nil
+	}
+
 	// Remember where the path from root to target node ends (will end).
 	t.cache.markPosition()
 
@@ -44,6 +56,21 @@ func (t *tree) SyncGet(ctx context.Context, request *syncer.GetRequest) (*syncer
 	if !t.cache.pendingRoot.IsClean() {
 		return nil, syncer.ErrDirtyRoot
 	}
+	version, err := negotiateSyncVersion(request.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err = request.CheckVersion(version); err != nil {
+		return nil, err
+	}
+	if err = t.checkKeySize(request.Key); err != nil {
+		return nil, err
+	}
+	for _, key := range request.Keys {
+		if err = t.checkKeySize(key); err != nil {
+			return nil, err
+		}
+	}
 
 	// Remember where the path from root to target node ends (will end).
 	t.cache.markPosition()
@@ -53,33 +80,39 @@ func (t *tree) SyncGet(ctx context.Context, request *syncer.GetRequest) (*syncer
 		proofBuilder:    pb,
 		includeSiblings: request.IncludeSiblings,
 	}
-	if _, err := t.doGet(ctx, t.cache.pendingRoot, 0, request.Key, opts, false); err != nil {
+	if _, err = t.doGet(ctx, t.cache.pendingRoot, 0, request.Key, opts, false); err != nil {
 		return nil, err
 	}
-	proof, err := pb.Build(ctx)
+	for _, key := range request.Keys {
+		t.cache.markPosition()
+		if _, err = t.doGet(ctx, t.cache.pendingRoot, 0, key, opts, false); err != nil {
+			return nil, err
+		}
+	}
+	proof, err := pb.BuildForVersion(ctx, version)
 	if err != nil {
 		return nil, err
 	}
 
 	return &syncer.ProofResponse{
-		Proof: *proof,
+		Version: syncer.ResponseVersion(request.Version, version),
+		Proof:   *proof,
 	}, nil
 }
 
 func (t *tree) newFetcherSyncGet(key node.Key, includeSiblings bool) readSyncFetcher {
 	return func(ctx context.Context, ptr *node.Pointer, rs syncer.ReadSyncer) (*syncer.Proof, error) {
-		rsp, err := rs.SyncGet(ctx, &syncer.GetRequest{
-			Tree: syncer.TreeID{
-				Root:     t.cache.syncRoot,
-				Position: ptr.Hash,
-			},
-			Key:             key,
-			IncludeSiblings: includeSiblings,
+		return t.cache.versionedSync(ctx, func(version uint16) (*syncer.ProofResponse, error) {
+			return rs.SyncGet(ctx, &syncer.GetRequest{
+				Version: version,
+				Tree: syncer.TreeID{
+					Root:     t.cache.syncRoot,
+					Position: ptr.Hash,
+				},
+				Key:             key,
+				IncludeSiblings: includeSiblings,
+			})
 		})
-		if err != nil {
-			return nil, err
-		}
-		return &rsp.Proof, nil
 	}
 }
 
@@ -101,7 +134,7 @@ func (t *tree) doGet(
 	}
 
 	// Dereference the node, possibly making a remote request.
-	nd, err := t.cache.derefNodePtr(ctx, ptr, t.newFetcherSyncGet(key, opts.includeSiblings))
+	nd, err := t.cache.derefNodePtr(ctx, ptr, bitDepth, key, t.newFetcherSyncGet(key, opts.includeSiblings))
 	if err != nil {
 		return nil, err
 	}
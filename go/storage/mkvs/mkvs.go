@@ -20,8 +20,51 @@ var (
 	// ErrKnownRootMismatch is the error returned by CommitKnown when the known
 	// root mismatches.
 	ErrKnownRootMismatch = errors.New("mkvs: known root mismatch")
+
+	// ErrInvalidRangeLimit is the error returned by GetRange when the limit
+	// is not positive.
+	ErrInvalidRangeLimit = errors.New("mkvs: invalid range limit")
+
+	// ErrInvalidRange is the error returned by GetRange when the end key is
+	// before the start key.
+	ErrInvalidRange = errors.New("mkvs: invalid range")
+
+	// ErrInvalidRangeProof is the error returned by VerifyRangeProof when the
+	// proof does not attest to the given key/value pairs being exactly the
+	// contents of the range.
+	ErrInvalidRangeProof = errors.New("mkvs: invalid range proof")
+
+	// ErrInvalidPrefixProof is the error returned by VerifyPrefixProof when the
+	// proof does not attest to whether the tree contains keys with the prefix.
+	ErrInvalidPrefixProof = errors.New("mkvs: invalid prefix proof")
+
+	// ErrForkMismatch is the error returned by MergeFork when the given fork
+	// was not created from the tree it is being merged into.
+	ErrForkMismatch = errors.New("mkvs: fork does not belong to this tree")
+
+	// ErrCursorRootMismatch is the error returned by NewIteratorAt when the
+	// iterator cursor was obtained from a tree with a different root.
+	ErrCursorRootMismatch = errors.New("mkvs: iterator cursor root mismatch")
+
+	// ErrCursorUnsupported is the error returned by Iterator.Cursor when the
+	// iterator does not support cursors.
+	ErrCursorUnsupported = errors.New("mkvs: iterator cursors are not supported")
+
+	// ErrSubtreeRootMismatch is the error returned by ImportSubtree when the
+	// subtree was exported from a tree with a different root.
+	ErrSubtreeRootMismatch = errors.New("mkvs: subtree export root mismatch")
+
+	// ErrKeyTooLarge is the error returned when a key exceeds the maximum key
+	// size of the tree.
+	ErrKeyTooLarge = syncer.ErrKeyTooLarge
 )
 
+// KeyValue is a key/value pair.
+type KeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
 // ImmutableKeyValueTree is the immutable key-value store tree interface.
 type ImmutableKeyValueTree interface {
 	// Get looks up an existing key.
@@ -65,18 +108,141 @@ type OverlayTree interface {
 	Commit(ctx context.Context) error
 }
 
+// ForkableTree is a tree interface that supports copy-on-write forks.
+type ForkableTree interface {
+	// Fork creates a copy-on-write fork of the tree, including any pending
+	// modifications. The fork shares the parent's state until either of
+	// them is modified and modifications of one are never visible in the
+	// other. Discarding a fork only requires calling Close on it.
+	//
+	// Modifying the parent while forks exist is supported, but requires
+	// preserving the previous value of each modified key in every fork.
+	Fork(ctx context.Context) (ForkTree, error)
+
+	// MergeFork applies all modifications made in the given fork into this
+	// tree and closes the fork. Any forks of the merged fork are closed as
+	// well.
+	//
+	// In case the fork was not created from this tree, ErrForkMismatch is
+	// returned.
+	MergeFork(ctx context.Context, fork ForkTree) error
+}
+
+// ForkTree is a copy-on-write fork of a tree.
+type ForkTree interface {
+	KeyValueTree
+	ClosableTree
+	ForkableTree
+}
+
 // Tree is a general MKVS tree interface.
 type Tree interface {
 	KeyValueTree
 	ClosableTree
+	ForkableTree
 	syncer.ReadSyncer
 
+	// InsertEx inserts a key/value pair into the tree and returns whether the key existed
+	// together with its previous value.
+	//
+	// The previous value is determined during the same traversal as the insert, so this does not
+	// require any more remote syncs than Insert.
+	InsertEx(ctx context.Context, key, value []byte) (existed bool, prevValue []byte, err error)
+
+	// CompareAndSwap sets the value of the given key to newValue in case its current value is
+	// equal to expectedValue, where a nil expectedValue means that the key must not exist.
+	//
+	// Whether the value was swapped is returned together with the value of the key before the
+	// call (nil in case the key did not exist). The comparison is performed during the same
+	// traversal as the insert, so this does not require any more remote syncs than Insert.
+	CompareAndSwap(ctx context.Context, key, expectedValue, newValue []byte) (swapped bool, actual []byte, err error)
+
+	// GetOrInsert returns the value of the given key in case it exists and otherwise inserts
+	// the given default value and returns it, reporting whether it was inserted.
+	//
+	// The lookup is performed during the same traversal as the insert, so this does not require
+	// any more remote syncs than Insert.
+	GetOrInsert(ctx context.Context, key, defaultValue []byte) (value []byte, inserted bool, err error)
+
+	// RemoveEx removes a key from the tree and returns whether the key existed together with its
+	// previous value.
+	//
+	// The previous value is determined during the same traversal as the removal, so this does
+	// not require any more remote syncs than Remove.
+	RemoveEx(ctx context.Context, key []byte) (existed bool, prevValue []byte, err error)
+
 	// PrefetchPrefixes populates the in-memory tree with nodes for keys
 	// starting with given prefixes.
 	PrefetchPrefixes(ctx context.Context, prefixes [][]byte, limit uint16) error
 
+	// PrefetchKeys populates the in-memory tree with nodes for the given keys.
+	//
+	// In case the remote read syncer supports it, all keys are fetched using a single request.
+	// Otherwise keys are fetched one by one.
+	PrefetchKeys(ctx context.Context, keys [][]byte) error
+
+	// PrefetchProfile populates the in-memory tree with nodes for all keys and prefixes in the
+	// given access profile, batching requests to the remote read syncer where possible.
+	//
+	// Access profiles can be recorded by attaching an AccessRecorder to a tree using the
+	// WithAccessRecorder option.
+	PrefetchProfile(ctx context.Context, profile *AccessProfile) error
+
+	// GetRange returns at most limit key/value pairs with keys in the range
+	// [startKey, endKey), in key order. A nil endKey means that the range is
+	// not bounded from above.
+	//
+	// In case there are more pairs in the range, the key of the next pair is
+	// returned as nextKey and can be used as startKey to fetch the next page.
+	// Otherwise nextKey is nil.
+	GetRange(ctx context.Context, startKey, endKey []byte, limit int) ([]KeyValue, []byte, error)
+
+	// GetRangeWithProof returns the key/value pairs with keys in the range
+	// [startKey, endKey) together with a proof anchored at the tree root that
+	// can be checked using VerifyRangeProof. A nil endKey means that the range
+	// is not bounded from above.
+	//
+	// At most limitNodes pairs are returned. In case the range contains more
+	// pairs, the proof only attests to the completeness of the range up to and
+	// including the last returned key.
+	//
+	// The tree must not have any uncommitted changes.
+	GetRangeWithProof(ctx context.Context, startKey, endKey []byte, limitNodes int) ([]KeyValue, *syncer.Proof, error)
+
+	// ProvePrefixEmpty returns a proof anchored at the tree root attesting whether the tree
+	// contains any keys with the given prefix. In case it does, the first such key is included
+	// as a witness. The proof can be checked using VerifyPrefixProof.
+	//
+	// The tree must not have any uncommitted changes.
+	ProvePrefixEmpty(ctx context.Context, prefix []byte) (*PrefixProof, error)
+
+	// ExportSubtree writes a self-contained stream to w containing all nodes needed to look up
+	// any key starting with the given prefix, together with a proof binding them to the tree
+	// root.
+	//
+	// The tree must not have any uncommitted changes.
+	ExportSubtree(ctx context.Context, prefix []byte, w io.Writer) error
+
+	// ImportSubtree reads a stream written by ExportSubtree, verifies it against the root of
+	// this tree and makes all keys under the exported prefix available locally. Keys outside
+	// the exported prefix still need to be fetched via the read syncer.
+	//
+	// The tree must not have any uncommitted changes and its in-memory cache must be large
+	// enough to hold the whole subtree.
+	ImportSubtree(ctx context.Context, r io.Reader) error
+
+	// NewIteratorAt returns a new iterator over the tree which is positioned right after the
+	// last key yielded by the iterator the given cursor was obtained from.
+	//
+	// In case the cursor was obtained from a tree with a different root, ErrCursorRootMismatch
+	// is returned.
+	NewIteratorAt(ctx context.Context, cursor *IteratorCursor, options ...IteratorOption) (Iterator, error)
+
 	// ApplyWriteLog applies the operations from a write log to the current tree.
 	//
+	// In case an entry's key exceeds the maximum key size, ErrKeyTooLarge is
+	// returned and the entry is not applied. Preceding entries remain applied.
+	//
 	// The caller is responsible for calling Commit.
 	ApplyWriteLog(ctx context.Context, wl writelog.Iterator) error
 
@@ -92,9 +258,48 @@ type Tree interface {
 	// the write log and new merkle root.
 	Commit(ctx context.Context, namespace common.Namespace, version uint64, options ...CommitOption) (writelog.WriteLog, hash.Hash, error)
 
+	// OnCommit registers a hook to run after the next successful Commit that persists tree
+	// updates to the underlying database, e.g., to invalidate external caches keyed by root.
+	//
+	// Hooks fire after all hooks registered on the underlying node database batch and after the
+	// tree has been updated to the new root, in registration order. They are not called while
+	// holding any tree locks. Hooks are cleared after firing and never fire for failed commits,
+	// commits using the NoPersist option or CommitKnown.
+	OnCommit(hook func(root node.Root))
+
+	// OnCommitPersist is like OnCommit, but the hook also fires after a successful CommitKnown.
+	OnCommitPersist(hook func(root node.Root))
+
 	// DumpLocal dumps the tree in the local memory into the given writer.
 	DumpLocal(ctx context.Context, w io.Writer, maxDepth node.Depth)
 
+	// ValidateRoot checks that the root the tree was created with is available in the
+	// underlying node database.
+	//
+	// In case the root is not available, a *RootError is returned which wraps either
+	// db.ErrVersionNotFound when the root's version has been pruned or db.ErrRootNotFound
+	// when the root is not known. Trees without a node database and trees that can fetch
+	// missing nodes via a read syncer are not checked.
+	ValidateRoot(ctx context.Context) error
+
+	// CacheStats returns the node lookup statistics of this tree.
+	CacheStats() CacheStats
+
+	// SaveCacheIndex writes the hashes of all clean nodes in the tree's in-memory cache (but not
+	// their contents) to the given writer, so that the cache can be warmed using WarmFromIndex,
+	// e.g., after a restart.
+	//
+	// At most MaxCacheIndexEntries of the most recently used nodes are included.
+	SaveCacheIndex(w io.Writer) error
+
+	// WarmFromIndex reads the nodes in a cache index written by SaveCacheIndex from the node
+	// database into the tree's in-memory cache. Only nodes reachable from the tree root are
+	// loaded and nodes which no longer exist in the node database are skipped.
+	//
+	// In case the index is malformed or uses an unsupported version, ErrInvalidCacheIndex is
+	// returned.
+	WarmFromIndex(ctx context.Context, r io.Reader) error
+
 	// RootType returns the storage root type.
 	RootType() node.RootType
 }
@@ -0,0 +1,66 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedNodeVersion is the error when a node with an unsupported encoding version is
+// encountered during deserialization.
+var ErrUnsupportedNodeVersion = errors.New("mkvs: unsupported node encoding version")
+
+// PrefixVersionedNode is the prefix used to mark a versioned node encoding. It must not collide
+// with any of the node prefixes as unversioned (legacy) encodings start with those.
+const PrefixVersionedNode byte = 0x03
+
+// EncodingVersion is the version of the node encoding used for persisting nodes.
+type EncodingVersion uint8
+
+const (
+	// EncodingVersion0 is the node encoding as produced by MarshalBinary.
+	EncodingVersion0 EncodingVersion = 0
+
+	// LatestEncodingVersion is the encoding version used when encoding nodes.
+	LatestEncodingVersion = EncodingVersion0
+)
+
+// versionedDecoders are the node decoders for all supported encoding versions.
+var versionedDecoders = map[EncodingVersion]func([]byte) (Node, error){
+	EncodingVersion0: UnmarshalBinary,
+}
+
+// MarshalVersionedBinary encodes a node into a versioned binary form, using the latest encoding
+// version.
+//
+// The versioned encoding is only used for persisting nodes. Node hashes are computed over the
+// logical node content and are not affected by the encoding version.
+func MarshalVersionedBinary(n Node) ([]byte, error) {
+	data, err := n.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{PrefixVersionedNode, byte(LatestEncodingVersion)}, data...), nil
+}
+
+// UnmarshalVersionedBinary decodes a node of arbitrary type from its versioned binary form.
+//
+// Unversioned encodings (as produced before versioning was introduced) are decoded as
+// EncodingVersion0.
+func UnmarshalVersionedBinary(data []byte) (Node, error) {
+	if len(data) == 0 {
+		return nil, ErrMalformedNode
+	}
+	if data[0] != PrefixVersionedNode {
+		return UnmarshalBinary(data)
+	}
+	if len(data) < 2 {
+		return nil, ErrMalformedNode
+	}
+
+	version := EncodingVersion(data[1])
+	decoder, ok := versionedDecoders[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedNodeVersion, version)
+	}
+	return decoder(data[2:])
+}
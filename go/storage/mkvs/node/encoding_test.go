@@ -0,0 +1,97 @@
+package node
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+)
+
+func TestVersionedSerialization(t *testing.T) {
+	leafNode := &LeafNode{
+		Key:   []byte("a golden key"),
+		Value: []byte("value"),
+	}
+	leafNode.UpdateHash()
+
+	intNode := &InternalNode{
+		Label:          Key("abc"),
+		LabelBitLength: Depth(24),
+		LeafNode:       &Pointer{Clean: true, Node: leafNode, Hash: leafNode.Hash},
+		Left:           &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone move to the left"))},
+		Right:          &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone move to the right"))},
+	}
+	intNode.UpdateHash()
+
+	for _, n := range []Node{leafNode, intNode} {
+		// Versioned encoding.
+		rawVersioned, err := MarshalVersionedBinary(n)
+		require.NoError(t, err, "MarshalVersionedBinary")
+		require.Equal(t, []byte{PrefixVersionedNode, byte(LatestEncodingVersion)}, rawVersioned[:2])
+
+		// Unversioned (legacy) encoding.
+		rawLegacy, err := n.MarshalBinary()
+		require.NoError(t, err, "MarshalBinary")
+		require.Equal(t, rawLegacy, rawVersioned[2:], "version 0 should wrap the legacy encoding")
+
+		for _, raw := range [][]byte{rawVersioned, rawLegacy} {
+			decoded, err := UnmarshalVersionedBinary(raw)
+			require.NoError(t, err, "UnmarshalVersionedBinary")
+			require.True(t, decoded.IsClean())
+			require.Equal(t, n.GetHash(), decoded.GetHash(), "hash should not depend on the encoding version")
+		}
+	}
+}
+
+func TestVersionedDecodingCompatibility(t *testing.T) {
+	// Encodings of the same leaf node as written by earlier versions (without a version prefix) and
+	// as written using encoding version 0.
+	rawLegacy, _ := hex.DecodeString("000c006120676f6c64656e206b65790500000076616c7565")
+	rawVersion0, _ := hex.DecodeString("0300000c006120676f6c64656e206b65790500000076616c7565")
+	expectedHash := "5c05183d4158b5920b16833acb78ccda464da83f720f824177b3a55a75f9fd88"
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+	}{
+		{"Legacy", rawLegacy},
+		{"Version0", rawVersion0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			decoded, err := UnmarshalVersionedBinary(tc.raw)
+			require.NoError(err, "UnmarshalVersionedBinary")
+			leafNode, ok := decoded.(*LeafNode)
+			require.True(ok, "decoded node should be a leaf node")
+			require.EqualValues("a golden key", leafNode.Key)
+			require.EqualValues("value", leafNode.Value)
+			require.Equal(expectedHash, leafNode.GetHash().String(), "hash should not depend on the encoding")
+		})
+	}
+
+	// Nodes should always be encoded using the latest encoding version.
+	raw, err := MarshalVersionedBinary(&LeafNode{Key: []byte("a golden key"), Value: []byte("value")})
+	require.NoError(t, err, "MarshalVersionedBinary")
+	require.Equal(t, rawVersion0, raw, "nodes should be encoded using encoding version 0")
+}
+
+func TestVersionedSerializationErrors(t *testing.T) {
+	leafNode := &LeafNode{
+		Key:   []byte("a golden key"),
+		Value: []byte("value"),
+	}
+	raw, err := MarshalVersionedBinary(leafNode)
+	require.NoError(t, err, "MarshalVersionedBinary")
+
+	raw[1] = 0xff
+	_, err = UnmarshalVersionedBinary(raw)
+	require.ErrorIs(t, err, ErrUnsupportedNodeVersion, "UnmarshalVersionedBinary should fail on unknown version")
+
+	for _, raw := range [][]byte{nil, {PrefixVersionedNode}, {PrefixNilNode}} {
+		_, err = UnmarshalVersionedBinary(raw)
+		require.ErrorIs(t, err, ErrMalformedNode, "UnmarshalVersionedBinary should fail on malformed input")
+	}
+}
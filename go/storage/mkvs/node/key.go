@@ -74,51 +74,95 @@ func ToMapKey(k []byte) string {
 	return string(k)
 }
 
+// Keys are also used as bit strings, e.g., for node labels and paths through the tree. Bit 0 is
+// the most significant bit of the first byte. As keys are stored as whole bytes, operations on bit
+// strings take the length of the bit string in bits, which may be shorter than the key's bit
+// length. Unless noted otherwise, the result of an operation has any bits following the bit string
+// in its last byte cleared, so that equal bit strings are represented by equal keys.
+
 // BitLength returns the length of the key in bits.
 func (k Key) BitLength() Depth {
 	return Depth(len(k[:]) * 8)
 }
 
-// GetKeyBit returns the given bit of the key.
+// GetBit returns the given bit of the key.
+//
+// Bits beyond the end of the key are reported as unset.
 func (k Key) GetBit(bit Depth) bool {
-	return k[bit/8]&(1<<(7-(bit%8))) != 0
+	if bit >= k.BitLength() {
+		return false
+	}
+	return k[bit/8]&(0x80>>(bit%8)) != 0
 }
 
-// SetKeyBit sets the bit at the given position bit to value val.
+// SetBit sets the bit at the given position bit to value val.
 //
-// This function is immutable and returns a new instance of Key
+// The bit must be within the key, otherwise this function panics.
+// This function is immutable and returns a new instance of Key.
 func (k Key) SetBit(bit Depth, val bool) Key {
+	if bit >= k.BitLength() {
+		panic(fmt.Sprintf("mkvs: bit %d out of range for key of %d bits", bit, k.BitLength()))
+	}
 	kb := make(Key, len(k))
 	copy(kb[:], k[:])
-	mask := byte(1 << (7 - (bit % 8)))
+	mask := byte(0x80 >> (bit % 8))
 	if val {
 		kb[bit/8] |= mask
 	} else {
-		kb[bit/8] &= mask
+		kb[bit/8] &^= mask
 	}
 	return kb
 }
 
+// clearTrailingBits clears any bits of the last byte following a bit string of the given length.
+func (k Key) clearTrailingBits(bitLen Depth) {
+	if bitLen%8 != 0 {
+		k[len(k)-1] &= 0xff << (8 - bitLen%8)
+	}
+}
+
+// Prefix returns the first bitLen bits of the key.
+//
+// The prefix length must not exceed the key's bit length, otherwise this function panics.
+// This function is immutable and returns a new instance of Key.
+func (k Key) Prefix(bitLen Depth) Key {
+	if bitLen > k.BitLength() {
+		panic(fmt.Sprintf("mkvs: prefix length %d greater than key length %d", bitLen, k.BitLength()))
+	}
+	prefix := make(Key, bitLen.ToBytes())
+	copy(prefix[:], k[:])
+	prefix.clearTrailingBits(bitLen)
+	return prefix
+}
+
+// HasPrefix returns true iff the key starts with the first prefixBitLen bits of prefix.
+//
+// A zero-length prefix is a prefix of any key.
+func (k Key) HasPrefix(prefix Key, prefixBitLen Depth) bool {
+	if prefixBitLen > k.BitLength() || prefixBitLen > prefix.BitLength() {
+		return false
+	}
+	return k.Prefix(prefixBitLen).Equal(prefix.Prefix(prefixBitLen))
+}
+
 // Split performs bit-wise split of the key.
 //
 // keyLen is the length of the key in bits and splitPoint is the index of the
-// first suffix bit.
+// first suffix bit. The split point must not exceed keyLen and keyLen must not
+// exceed the key's bit length, otherwise this function panics.
 // This function is immutable and returns two new instances of Key.
 func (k Key) Split(splitPoint, keyLen Depth) (prefix, suffix Key) {
 	if splitPoint > keyLen {
 		panic(fmt.Sprintf("mkvs: splitPoint %+v greater than keyLen %+v", splitPoint, keyLen))
 	}
-	prefixLen := Depth(splitPoint.ToBytes())
-	suffixLen := Depth((keyLen - splitPoint).ToBytes())
-	prefix = make(Key, prefixLen)
-	suffix = make(Key, suffixLen)
-
-	copy(prefix[:], k[:])
-	// Clean the remainder of the byte.
-	if splitPoint%8 != 0 {
-		prefix[prefixLen-1] &= 0xff << (8 - splitPoint%8)
+	if keyLen > k.BitLength() {
+		panic(fmt.Sprintf("mkvs: keyLen %+v greater than key length %+v", keyLen, k.BitLength()))
 	}
+	prefix = k.Prefix(splitPoint)
 
+	suffixBits := keyLen - splitPoint
+	suffixLen := Depth(suffixBits.ToBytes())
+	suffix = make(Key, suffixLen)
 	for i := Depth(0); i < suffixLen; i++ {
 		// First set the left chunk of the byte
 		suffix[i] = k[i+splitPoint/8] << (splitPoint % 8)
@@ -127,6 +171,9 @@ func (k Key) Split(splitPoint, keyLen Depth) (prefix, suffix Key) {
 			suffix[i] |= k[i+splitPoint/8+1] >> (8 - splitPoint%8)
 		}
 	}
+	if suffixLen > 0 {
+		suffix.clearTrailingBits(suffixBits)
+	}
 
 	return
 }
@@ -134,7 +181,8 @@ func (k Key) Split(splitPoint, keyLen Depth) (prefix, suffix Key) {
 // Merge bit-wise merges key of given length with another key of given length.
 //
 // keyLen is the length of the original key in bits and k2Len is the length of
-// another key in bits.
+// another key in bits. Any bits of k following keyLen and of k2 following
+// k2Len are ignored.
 // This function is immutable and returns a new instance of Key.
 func (k Key) Merge(keyLen Depth, k2 Key, k2Len Depth) Key {
 	keyLenBytes := int(keyLen) / 8
@@ -144,8 +192,15 @@ func (k Key) Merge(keyLen Depth, k2 Key, k2Len Depth) Key {
 
 	newKey := make(Key, (keyLen + k2Len).ToBytes())
 	copy(newKey[:], k[:keyLenBytes])
+	if keyLenBytes > 0 {
+		newKey[:keyLenBytes].clearTrailingBits(keyLen)
+	}
 
-	for i := 0; i < len(k2); i++ {
+	k2LenBytes := k2Len.ToBytes()
+	if len(k2) < k2LenBytes {
+		k2LenBytes = len(k2)
+	}
+	for i := 0; i < k2LenBytes; i++ {
 		// First set the right chunk of the previous byte
 		if keyLen%8 != 0 && keyLenBytes > 0 {
 			newKey[keyLenBytes+i-1] |= k2[i] >> (keyLen % 8)
@@ -157,12 +212,16 @@ func (k Key) Merge(keyLen Depth, k2 Key, k2Len Depth) Key {
 			newKey[keyLenBytes+i] |= k2[i] << ((8 - keyLen%8) % 8)
 		}
 	}
+	if len(newKey) > 0 {
+		newKey.clearTrailingBits(keyLen + k2Len)
+	}
 
 	return newKey
 }
 
-// AppendBit appends the given bit to the key.
+// AppendBit appends the given bit to the key of the given length in bits.
 //
+// Unlike other operations, any bits of k following the appended bit are kept.
 // This function is immutable and returns a new instance of Key.
 func (k Key) AppendBit(keyLen Depth, val bool) Key {
 	newKey := make(Key, (keyLen + 1).ToBytes())
@@ -177,10 +236,11 @@ func (k Key) AppendBit(keyLen Depth, val bool) Key {
 	return newKey
 }
 
-// CommonPrefix computes length of common prefix of k and k2.
+// CommonPrefixLen computes length of common prefix of k and k2 in bits.
 //
 // Additionally, keyBitLen and k2bitLen are key lengths in bits of k and k2
-// respectively.
+// respectively. The result never exceeds either length and is symmetric in
+// both keys.
 func (k Key) CommonPrefixLen(keyBitLen Depth, k2 Key, k2bitLen Depth) (bitLength Depth) {
 	minKeyLen := len(k)
 	if len(k2) < len(k) {
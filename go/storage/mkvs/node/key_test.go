@@ -1,6 +1,7 @@
 package node
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -98,3 +99,98 @@ func TestKeyCommonPrefixLen(t *testing.T) {
 	key = Key{0xab, 0xcd, 0xef, 0xff}
 	require.Equal(t, Depth(23), key.CommonPrefixLen(32, Key{0xab, 0xcd, 0xee, 0xff}, 32))
 }
+
+func TestKeyGetSetBit(t *testing.T) {
+	require := require.New(t)
+
+	key := Key{0x80, 0x01}
+	require.True(key.GetBit(0))
+	require.False(key.GetBit(7))
+	require.False(key.GetBit(8))
+	require.True(key.GetBit(15))
+	require.False(key.GetBit(16), "bits beyond the key should be unset")
+	require.False(Key{}.GetBit(0), "bits of a zero-length key should be unset")
+
+	// Set and clear bits at byte boundaries.
+	require.Equal(Key{0x81, 0x01}, key.SetBit(7, true))
+	require.Equal(Key{0x80, 0x81}, key.SetBit(8, true))
+	require.Equal(Key{0x00, 0x01}, key.SetBit(0, false))
+	require.Equal(Key{0x80, 0x00}, key.SetBit(15, false))
+	require.Equal(Key{0x80, 0x01}, key.SetBit(0, true), "setting a set bit should be a no-op")
+	require.Equal(Key{0x80, 0x01}, key, "SetBit should not modify the key")
+
+	require.Panics(func() { key.SetBit(16, true) }, "SetBit beyond the key should panic")
+	require.Panics(func() { Key{}.SetBit(0, false) }, "SetBit on a zero-length key should panic")
+}
+
+func TestKeyPrefix(t *testing.T) {
+	require := require.New(t)
+
+	key := Key{0xab, 0xcd, 0xef}
+	require.Equal(Key{}, key.Prefix(0))
+	require.Equal(Key{0xa8}, key.Prefix(5))
+	require.Equal(Key{0xab}, key.Prefix(8))
+	require.Equal(Key{0xab, 0x80}, key.Prefix(9))
+	require.Equal(key, key.Prefix(24))
+	require.Equal(Key{}, Key{}.Prefix(0))
+	require.Panics(func() { key.Prefix(25) }, "Prefix longer than the key should panic")
+
+	require.True(key.HasPrefix(Key{}, 0), "zero-length prefix should always match")
+	require.True(Key{}.HasPrefix(Key{}, 0), "zero-length prefix should match zero-length key")
+	require.True(key.HasPrefix(Key{0xaf}, 5), "bits following the prefix should be ignored")
+	require.False(key.HasPrefix(Key{0xaf}, 6))
+	require.True(key.HasPrefix(Key{0xab, 0xc0}, 10))
+	require.True(key.HasPrefix(key, 24))
+	require.False(key.HasPrefix(Key{0xab, 0xcd, 0xef, 0x00}, 25), "prefix longer than the key should not match")
+	require.False(key.HasPrefix(Key{0xab}, 9), "prefix length exceeding the prefix should not match")
+}
+
+// randomKey generates a random key of random bit length not exceeding maxBitLen, with any bits
+// following the bit length cleared.
+func randomKey(rng *rand.Rand, maxBitLen int) (Key, Depth) {
+	bitLen := Depth(rng.Intn(maxBitLen + 1))
+	key := make(Key, bitLen.ToBytes())
+	_, _ = rng.Read(key)
+	return key.Prefix(bitLen), bitLen
+}
+
+func TestKeySplitMergeRandom(t *testing.T) {
+	require := require.New(t)
+	rng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 10000; i++ {
+		key, keyLen := randomKey(rng, 64)
+		splitPoint := Depth(rng.Intn(int(keyLen) + 1))
+
+		prefix, suffix := key.Split(splitPoint, keyLen)
+		require.Len(prefix, splitPoint.ToBytes(), "prefix length")
+		require.Len(suffix, (keyLen - splitPoint).ToBytes(), "suffix length")
+		require.True(key.HasPrefix(prefix, splitPoint), "key should start with the prefix")
+
+		merged := prefix.Merge(splitPoint, suffix, keyLen-splitPoint)
+		require.Equal(key, merged, "Merge(Split(%X, %d, %d)) should be the original key", key, splitPoint, keyLen)
+	}
+}
+
+func TestKeyCommonPrefixLenRandom(t *testing.T) {
+	require := require.New(t)
+	rng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 10000; i++ {
+		k1, k1Len := randomKey(rng, 64)
+		k2, k2Len := randomKey(rng, 64)
+		// Make keys share a prefix more often than not.
+		if shared := Depth(rng.Intn(int(k1Len) + 1)); shared <= k2Len && rng.Intn(2) == 0 {
+			_, suffix := k2.Split(shared, k2Len)
+			k2 = k1.Prefix(shared).Merge(shared, suffix, k2Len-shared)
+		}
+
+		cp := k1.CommonPrefixLen(k1Len, k2, k2Len)
+		require.Equal(cp, k2.CommonPrefixLen(k2Len, k1, k1Len), "CommonPrefixLen should be symmetric")
+		require.True(cp <= k1Len && cp <= k2Len, "common prefix should not exceed either key")
+		require.True(k1.HasPrefix(k2, cp), "keys should share the common prefix")
+		if cp < k1Len && cp < k2Len {
+			require.NotEqual(k1.GetBit(cp), k2.GetBit(cp), "keys should differ after the common prefix")
+		}
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"container/list"
 	"encoding"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"unsafe"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
@@ -21,6 +25,15 @@ var (
 	// ErrMalformedKey is the error when a malformed key is encountered
 	// during deserialization.
 	ErrMalformedKey = errors.New("mkvs: malformed key")
+	// ErrMalformedRoot is the error when a malformed storage root is encountered
+	// while parsing its text form.
+	ErrMalformedRoot = errors.New("mkvs: malformed root")
+	// ErrInvalidRootHash is the error when the hash of a storage root in text
+	// form is invalid.
+	ErrInvalidRootHash = errors.New("mkvs: invalid root hash")
+	// ErrInvalidRootVersion is the error when the version of a storage root in
+	// text form is invalid.
+	ErrInvalidRootVersion = errors.New("mkvs: invalid root version")
 )
 
 const (
@@ -30,6 +43,12 @@ const (
 	PrefixInternalNode byte = 0x01
 	// Prefix used to mark a nil pointer in a subtree serialization.
 	PrefixNilNode byte = 0x02
+	// Prefix used in hash computations of leaf nodes in namespaced hash mode.
+	//
+	// Node prefixes must be distinct, including from PrefixVersionedNode.
+	PrefixNamespacedLeafNode byte = 0x04
+	// Prefix used in hash computations of internal nodes in namespaced hash mode.
+	PrefixNamespacedInternalNode byte = 0x05
 
 	// PointerSize is the size of a node pointer in memory.
 	PointerSize = uint64(unsafe.Sizeof(Pointer{}))
@@ -47,6 +66,9 @@ var (
 	_ encoding.BinaryUnmarshaler = (*InternalNode)(nil)
 	_ encoding.BinaryMarshaler   = (*LeafNode)(nil)
 	_ encoding.BinaryUnmarshaler = (*LeafNode)(nil)
+	_ encoding.TextMarshaler     = Root{}
+	_ encoding.TextUnmarshaler   = (*Root)(nil)
+	_ json.Unmarshaler           = (*Root)(nil)
 )
 
 // RootType is a storage root type.
@@ -78,6 +100,61 @@ func (r RootType) String() string {
 	}
 }
 
+// HashMode is the node hash construction used by a tree.
+type HashMode uint8
+
+const (
+	// HashModeDefault is the default node hash construction, which does not depend on the
+	// namespace, so identical subtrees in different namespaces have identical hashes.
+	HashModeDefault HashMode = 0
+	// HashModeNamespaced is the node hash construction which mixes the namespace into the hashes
+	// of all nodes, binding proofs to the namespace.
+	HashModeNamespaced HashMode = 1
+)
+
+// String returns the string representation of the hash mode.
+func (m HashMode) String() string {
+	switch m {
+	case HashModeDefault:
+		return "default"
+	case HashModeNamespaced:
+		return "namespaced"
+	default:
+		return fmt.Sprintf("[unknown hash mode: %d]", m)
+	}
+}
+
+// IsValid returns true iff the hash mode is supported.
+func (m HashMode) IsValid() bool {
+	return m <= HashModeNamespaced
+}
+
+// HashDomain is the domain in which node hashes are computed.
+//
+// The zero value is the domain of the default hash mode.
+type HashDomain struct {
+	// Mode is the hash mode.
+	Mode HashMode
+	// Namespace is the namespace mixed into node hashes in namespaced hash mode.
+	Namespace common.Namespace
+}
+
+// prefix returns the node prefix and the (possibly empty) namespace which precede the contents
+// of nodes with the given default-mode prefix when computing their hashes.
+func (d *HashDomain) prefix(nodePrefix byte) ([]byte, []byte) {
+	if d.Mode != HashModeNamespaced {
+		return []byte{nodePrefix}, nil
+	}
+
+	switch nodePrefix {
+	case PrefixLeafNode:
+		nodePrefix = PrefixNamespacedLeafNode
+	case PrefixInternalNode:
+		nodePrefix = PrefixNamespacedInternalNode
+	}
+	return []byte{nodePrefix}, d.Namespace[:]
+}
+
 // Root is a storage root.
 type Root struct {
 	// Namespace is the namespace under which the root is stored.
@@ -88,11 +165,129 @@ type Root struct {
 	Type RootType `json:"root_type"`
 	// Hash is the merkle root hash.
 	Hash hash.Hash `json:"hash"`
+	// HashMode is the node hash construction used by the tree under the root.
+	HashMode HashMode `json:"hash_mode,omitempty"`
 }
 
-// String returns the string representation of a storage root.
+// HashDomain returns the domain in which the hashes of nodes under the root are computed.
+func (r *Root) HashDomain() HashDomain {
+	return HashDomain{
+		Mode:      r.HashMode,
+		Namespace: r.Namespace,
+	}
+}
+
+// String returns the string representation of a storage root, which is its text form.
 func (r Root) String() string {
-	return fmt.Sprintf("<Root ns=%s version=%d type=%v hash=%s>", r.Namespace, r.Version, r.Type, r.Hash)
+	text, _ := r.MarshalText()
+	return string(text)
+}
+
+// MarshalText encodes a storage root into its canonical text form.
+//
+// The text form is "<namespace>:<version>:<hash>" with the namespace and hash in lowercase hex
+// and the version in decimal. In case the root has a type, the type is appended as ":<type>" and
+// in case it uses a non-default hash mode, the hash mode is further appended as ":<hash mode>".
+func (r Root) MarshalText() ([]byte, error) {
+	text := fmt.Sprintf("%s:%d:%s", hex.EncodeToString(r.Namespace[:]), r.Version, hex.EncodeToString(r.Hash[:]))
+	if r.Type != RootTypeInvalid || r.HashMode != HashModeDefault {
+		text += ":" + r.Type.String()
+	}
+	if r.HashMode != HashModeDefault {
+		text += ":" + r.HashMode.String()
+	}
+	return []byte(text), nil
+}
+
+// UnmarshalText decodes a storage root from its canonical text form.
+func (r *Root) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), ":")
+	if len(parts) < 3 || len(parts) > 5 {
+		return fmt.Errorf("%w: expected 3 to 5 fields, got %d", ErrMalformedRoot, len(parts))
+	}
+
+	var root Root
+	if err := root.Namespace.UnmarshalHex(parts[0]); err != nil {
+		return fmt.Errorf("%w: bad namespace: %s", ErrMalformedRoot, err)
+	}
+
+	// Only accept the canonical decimal form of versions.
+	version := parts[1]
+	if version == "" || (len(version) > 1 && version[0] == '0') || strings.TrimLeft(version, "0123456789") != "" {
+		return fmt.Errorf("%w: malformed version '%s'", ErrInvalidRootVersion, version)
+	}
+	var err error
+	if root.Version, err = strconv.ParseUint(version, 10, 64); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRootVersion, err)
+	}
+
+	if len(parts[2]) != 2*hash.Size {
+		return fmt.Errorf("%w: expected %d hex characters, got %d", ErrInvalidRootHash, 2*hash.Size, len(parts[2]))
+	}
+	if err = root.Hash.UnmarshalHex(parts[2]); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRootHash, err)
+	}
+
+	if len(parts) > 3 {
+		if root.Type, err = parseRootType(parts[3]); err != nil {
+			return err
+		}
+	}
+	if len(parts) > 4 {
+		if root.HashMode, err = parseHashMode(parts[4]); err != nil {
+			return err
+		}
+	}
+
+	// Make sure that the text form is canonical, e.g., that hex encodings are lowercase and that
+	// optional fields are only present when needed.
+	if canonical, _ := root.MarshalText(); !bytes.Equal(canonical, text) {
+		return fmt.Errorf("%w: non-canonical encoding", ErrMalformedRoot)
+	}
+
+	*r = root
+	return nil
+}
+
+// UnmarshalJSON decodes a JSON marshaled storage root.
+//
+// Besides the canonical text form, this also accepts the JSON object form used before roots had
+// a text form.
+func (r *Root) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return r.UnmarshalText([]byte(text))
+	}
+
+	type root Root
+	var decRoot root
+	if err := json.Unmarshal(data, &decRoot); err != nil {
+		return err
+	}
+	*r = Root(decRoot)
+	return nil
+}
+
+func parseRootType(text string) (RootType, error) {
+	for t := RootTypeInvalid; t <= RootTypeMax; t++ {
+		if t.String() == text {
+			return t, nil
+		}
+	}
+	return RootTypeInvalid, fmt.Errorf("%w: unknown root type '%s'", ErrMalformedRoot, text)
+}
+
+func parseHashMode(text string) (HashMode, error) {
+	for m := HashModeDefault; m.IsValid(); m++ {
+		if m.String() == text {
+			return m, nil
+		}
+	}
+	return HashModeDefault, fmt.Errorf("%w: unknown hash mode '%s'", ErrMalformedRoot, text)
 }
 
 // Empty sets the storage root to an empty root.
@@ -122,6 +317,9 @@ func (r *Root) Equal(other *Root) bool {
 	if r.Type != other.Type {
 		return false
 	}
+	if r.HashMode != other.HashMode {
+		return false
+	}
 	if !r.Namespace.Equal(&other.Namespace) {
 		return false
 	}
@@ -134,8 +332,8 @@ func (r *Root) Equal(other *Root) bool {
 }
 
 // Follows checks if another root follows the given root. A root follows
-// another iff the namespace matches and the version is either equal or
-// exactly one higher.
+// another iff the namespace and hash mode match and the version is either
+// equal or exactly one higher.
 //
 // It is the responsibility of the caller to check if the merkle roots
 // follow each other.
@@ -143,6 +341,9 @@ func (r *Root) Follows(other *Root) bool {
 	if r.Type != other.Type {
 		return false
 	}
+	if r.HashMode != other.HashMode {
+		return false
+	}
 	if !r.Namespace.Equal(&other.Namespace) {
 		return false
 	}
@@ -277,6 +478,12 @@ type Node interface {
 	// Does not mark the node as clean.
 	UpdateHash()
 
+	// UpdateHashInDomain updates the node's cached hash by recomputing it in
+	// the given hash domain.
+	//
+	// Does not mark the node as clean.
+	UpdateHashInDomain(domain HashDomain)
+
 	// Extract makes a copy of the node containing only hash references.
 	Extract() Node
 
@@ -325,13 +532,23 @@ func (n *InternalNode) Size() uint64 {
 //
 // Does not mark the node as clean.
 func (n *InternalNode) UpdateHash() {
+	n.UpdateHashInDomain(HashDomain{})
+}
+
+// UpdateHashInDomain updates the node's cached hash by recomputing it in the
+// given hash domain.
+//
+// Does not mark the node as clean.
+func (n *InternalNode) UpdateHashInDomain(domain HashDomain) {
 	leafNodeHash := n.LeafNode.GetHash()
 	leftHash := n.Left.GetHash()
 	rightHash := n.Right.GetHash()
 	labelBitLength := n.LabelBitLength.MarshalBinary()
+	prefix, ns := domain.prefix(PrefixInternalNode)
 
 	n.Hash.FromBytes(
-		[]byte{PrefixInternalNode},
+		prefix,
+		ns,
 		labelBitLength,
 		n.Label[:],
 		leafNodeHash[:],
@@ -558,11 +775,20 @@ func (n *LeafNode) GetHash() hash.Hash {
 //
 // Does not mark the node as clean.
 func (n *LeafNode) UpdateHash() {
+	n.UpdateHashInDomain(HashDomain{})
+}
+
+// UpdateHashInDomain updates the node's cached hash by recomputing it in the
+// given hash domain.
+//
+// Does not mark the node as clean.
+func (n *LeafNode) UpdateHashInDomain(domain HashDomain) {
 	var keyLen, valueLen [4]byte
 	binary.LittleEndian.PutUint32(keyLen[:], uint32(len(n.Key)))
 	binary.LittleEndian.PutUint32(valueLen[:], uint32(len(n.Value)))
+	prefix, ns := domain.prefix(PrefixLeafNode)
 
-	n.Hash.FromBytes([]byte{PrefixLeafNode}, keyLen[:], n.Key[:], valueLen[:], n.Value[:])
+	n.Hash.FromBytes(prefix, ns, keyLen[:], n.Key[:], valueLen[:], n.Value[:])
 }
 
 // Extract makes a copy of the node containing only hash references.
@@ -696,3 +922,16 @@ func UnmarshalBinary(bytes []byte) (Node, error) {
 	}
 	return node, nil
 }
+
+// UpdateDecodedHash recomputes the hash of a decoded node in the given hash
+// domain. For internal nodes, the hash of the embedded leaf node is updated as
+// well, while the hashes of the left and right children are taken as-is.
+//
+// Decoding computes node hashes in the default hash domain.
+func UpdateDecodedHash(n Node, domain HashDomain) {
+	if nd, ok := n.(*InternalNode); ok && nd.LeafNode != nil && nd.LeafNode.Node != nil {
+		nd.LeafNode.Node.UpdateHashInDomain(domain)
+		nd.LeafNode.Hash = nd.LeafNode.Node.GetHash()
+	}
+	n.UpdateHashInDomain(domain)
+}
@@ -1,10 +1,15 @@
 package node
 
 import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 )
 
@@ -108,6 +113,260 @@ func TestHashInternalNode(t *testing.T) {
 	require.Equal(t, "75c37c67c265e2c836f76dec35173fa336e976938ea46f088390a983e46efced", intNode.Hash.String())
 }
 
+func TestHashNodesNamespaced(t *testing.T) {
+	ns := common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0)
+	otherNs := common.NewTestNamespaceFromSeed([]byte("oasis mkvs other test ns"), 0)
+	domain := HashDomain{Mode: HashModeNamespaced, Namespace: ns}
+
+	leafNode := &LeafNode{
+		Key:   []byte("a golden key"),
+		Value: []byte("value"),
+	}
+	leafNode.UpdateHashInDomain(HashDomain{})
+	require.Equal(t, "5c05183d4158b5920b16833acb78ccda464da83f720f824177b3a55a75f9fd88", leafNode.Hash.String(),
+		"default domain should use the default hash construction")
+	leafNode.UpdateHashInDomain(HashDomain{Namespace: ns})
+	require.Equal(t, "5c05183d4158b5920b16833acb78ccda464da83f720f824177b3a55a75f9fd88", leafNode.Hash.String(),
+		"namespace should be ignored in default hash mode")
+	leafNode.UpdateHashInDomain(domain)
+	require.Equal(t, "1b2c47bf2cf9bf107c62b2819e257911943de04930e02f10e41450c48717abbb", leafNode.Hash.String())
+	leafNode.UpdateHashInDomain(HashDomain{Mode: HashModeNamespaced, Namespace: otherNs})
+	require.NotEqual(t, "1b2c47bf2cf9bf107c62b2819e257911943de04930e02f10e41450c48717abbb", leafNode.Hash.String(), "namespace should be mixed into the hash")
+
+	intNode := &InternalNode{
+		Label:          Key("abc"),
+		LabelBitLength: 23,
+		LeafNode:       &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone stop here"))},
+		Left:           &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone move to the left"))},
+		Right:          &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone move to the right"))},
+	}
+	intNode.UpdateHashInDomain(HashDomain{})
+	require.Equal(t, "75c37c67c265e2c836f76dec35173fa336e976938ea46f088390a983e46efced", intNode.Hash.String(),
+		"default domain should use the default hash construction")
+	intNode.UpdateHashInDomain(domain)
+	require.Equal(t, "85972851eb6a264ef5344c66ff8ce0c3075ab21e0c9efb9a7f40cbc75d914d7a", intNode.Hash.String())
+}
+
+func TestNodePrefixesDistinct(t *testing.T) {
+	prefixes := map[string]byte{
+		"PrefixLeafNode":               PrefixLeafNode,
+		"PrefixInternalNode":           PrefixInternalNode,
+		"PrefixNilNode":                PrefixNilNode,
+		"PrefixNamespacedLeafNode":     PrefixNamespacedLeafNode,
+		"PrefixNamespacedInternalNode": PrefixNamespacedInternalNode,
+		"PrefixVersionedNode":          PrefixVersionedNode,
+	}
+	seen := make(map[byte]string)
+	for name, prefix := range prefixes {
+		other, ok := seen[prefix]
+		require.False(t, ok, "%s collides with %s", name, other)
+		seen[prefix] = name
+	}
+}
+
+func TestUpdateDecodedHash(t *testing.T) {
+	ns := common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0)
+	domain := HashDomain{Mode: HashModeNamespaced, Namespace: ns}
+
+	leafNode := &LeafNode{
+		Key:   []byte("a golden key"),
+		Value: []byte("value"),
+	}
+	leafNode.UpdateHashInDomain(domain)
+	intNode := &InternalNode{
+		Label:          Key("abc"),
+		LabelBitLength: 24,
+		LeafNode:       &Pointer{Clean: true, Node: leafNode, Hash: leafNode.Hash},
+		Left:           &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone move to the left"))},
+		Right:          &Pointer{Clean: true, Hash: hash.NewFromBytes([]byte("everyone move to the right"))},
+	}
+	intNode.UpdateHashInDomain(domain)
+
+	raw, err := intNode.MarshalBinary()
+	require.NoError(t, err, "MarshalBinary")
+	decoded, err := UnmarshalBinary(raw)
+	require.NoError(t, err, "UnmarshalBinary")
+	require.NotEqual(t, intNode.Hash, decoded.GetHash(), "decoding should compute the default hash")
+
+	UpdateDecodedHash(decoded, domain)
+	require.Equal(t, intNode.Hash, decoded.GetHash(), "decoded hash should be updated")
+	require.Equal(t, leafNode.Hash, decoded.(*InternalNode).LeafNode.Hash, "embedded leaf node hash should be updated")
+}
+
+func TestRootHashMode(t *testing.T) {
+	var root Root
+	root.Empty()
+	root.Type = RootTypeState
+	root.Namespace = common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0)
+
+	require.Equal(t, HashDomain{Namespace: root.Namespace}, root.HashDomain())
+	encodedDefault := root.EncodedHash()
+
+	other := root
+	other.HashMode = HashModeNamespaced
+	require.Equal(t, HashDomain{Mode: HashModeNamespaced, Namespace: root.Namespace}, other.HashDomain())
+	require.False(t, root.Equal(&other), "roots with different hash modes should not be equal")
+	require.False(t, other.Follows(&root), "roots with different hash modes should not follow each other")
+	require.NotEqual(t, encodedDefault, other.EncodedHash(), "hash mode should be encoded")
+
+	// The encoding of roots in the default hash mode must not change.
+	var legacy struct {
+		Namespace common.Namespace `json:"ns"`
+		Version   uint64           `json:"version"`
+		Type      RootType         `json:"root_type"`
+		Hash      hash.Hash        `json:"hash"`
+	}
+	legacy.Namespace, legacy.Type, legacy.Hash = root.Namespace, root.Type, root.Hash
+	require.Equal(t, hash.NewFrom(legacy), encodedDefault, "default hash mode should not be encoded")
+
+	require.True(t, HashModeNamespaced.IsValid())
+	require.False(t, HashMode(2).IsValid())
+}
+
+func TestRootText(t *testing.T) {
+	require := require.New(t)
+
+	ns := common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0)
+	h := hash.NewFromBytes([]byte("oasis mkvs test root"))
+	nsHex, hHex := ns.String(), h.String()
+
+	for _, tc := range []struct {
+		root Root
+		text string
+	}{
+		{Root{}, "0000000000000000000000000000000000000000000000000000000000000000:0:0000000000000000000000000000000000000000000000000000000000000000"},
+		{Root{Namespace: ns, Version: 42, Hash: h}, nsHex + ":42:" + hHex},
+		{Root{Namespace: ns, Version: 42, Type: RootTypeState, Hash: h}, nsHex + ":42:" + hHex + ":state-root"},
+		{Root{Namespace: ns, Version: 1, Type: RootTypeIO, Hash: h}, nsHex + ":1:" + hHex + ":io-root"},
+		{Root{Namespace: ns, Version: 1, Type: RootTypeState, Hash: h, HashMode: HashModeNamespaced}, nsHex + ":1:" + hHex + ":state-root:namespaced"},
+		{Root{Namespace: ns, Version: 1, Hash: h, HashMode: HashModeNamespaced}, nsHex + ":1:" + hHex + ":invalid:namespaced"},
+		{Root{Namespace: ns, Version: ^uint64(0), Type: RootTypeState, Hash: h}, nsHex + ":18446744073709551615:" + hHex + ":state-root"},
+	} {
+		text, err := tc.root.MarshalText()
+		require.NoError(err, "MarshalText")
+		require.Equal(tc.text, string(text), "MarshalText")
+		require.Equal(tc.text, tc.root.String(), "String")
+
+		var dec Root
+		err = dec.UnmarshalText(text)
+		require.NoError(err, "UnmarshalText")
+		require.True(tc.root.Equal(&dec), "text form should round-trip")
+		require.Equal(tc.root, dec, "text form should round-trip")
+
+		data, err := json.Marshal(tc.root)
+		require.NoError(err, "json.Marshal")
+		require.Equal(`"`+tc.text+`"`, string(data), "JSON form should be the text form")
+
+		dec = Root{}
+		err = json.Unmarshal(data, &dec)
+		require.NoError(err, "json.Unmarshal")
+		require.Equal(tc.root, dec, "JSON form should round-trip")
+	}
+}
+
+func TestRootUnmarshalTextMalformed(t *testing.T) {
+	require := require.New(t)
+
+	ns := common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0)
+	h := hash.NewFromBytes([]byte("oasis mkvs test root"))
+	nsHex, hHex := ns.String(), h.String()
+
+	for _, tc := range []struct {
+		text string
+		err  error
+	}{
+		{"", ErrMalformedRoot},
+		{nsHex, ErrMalformedRoot},
+		{nsHex + ":1", ErrMalformedRoot},
+		{nsHex + ":1:" + hHex + ":state-root:namespaced:extra", ErrMalformedRoot},
+		{nsHex[2:] + ":1:" + hHex, ErrMalformedRoot},
+		{"zz" + nsHex[2:] + ":1:" + hHex, ErrMalformedRoot},
+		{strings.ToUpper(nsHex) + ":1:" + hHex, ErrMalformedRoot},
+		{nsHex + ":1:" + hHex + ":", ErrMalformedRoot},
+		{nsHex + ":1:" + hHex + ":storage-root", ErrMalformedRoot},
+		{nsHex + ":1:" + hHex + ":invalid", ErrMalformedRoot},
+		{nsHex + ":1:" + hHex + ":state-root:default", ErrMalformedRoot},
+		{nsHex + ":1:" + hHex + ":state-root:unknown", ErrMalformedRoot},
+		{nsHex + "::" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":-1:" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":+1:" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":01:" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":0x1:" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":1_000:" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":18446744073709551616:" + hHex, ErrInvalidRootVersion},
+		{nsHex + ":1:", ErrInvalidRootHash},
+		{nsHex + ":1:" + hHex[2:], ErrInvalidRootHash},
+		{nsHex + ":1:" + hHex + "00", ErrInvalidRootHash},
+		{nsHex + ":1:zz" + hHex[2:], ErrInvalidRootHash},
+		{nsHex + ":1:" + strings.ToUpper(hHex), ErrMalformedRoot},
+	} {
+		var root Root
+		err := root.UnmarshalText([]byte(tc.text))
+		require.ErrorIs(err, tc.err, "UnmarshalText(%s)", tc.text)
+		require.Equal(Root{}, root, "failed UnmarshalText should not modify the root")
+	}
+
+	// Any single-byte corruption of a valid text form should either fail to parse or result
+	// in a text form which round-trips.
+	valid := []byte(Root{Namespace: ns, Version: 12345, Type: RootTypeIO, Hash: h, HashMode: HashModeNamespaced}.String())
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+	for i := 0; i < 10000; i++ {
+		text := append([]byte{}, valid...)
+		switch rng.Intn(3) {
+		case 0:
+			text[rng.Intn(len(text))] = byte(rng.Intn(256))
+		case 1:
+			idx := rng.Intn(len(text))
+			text = append(text[:idx], text[idx+1:]...)
+		case 2:
+			idx := rng.Intn(len(text) + 1)
+			text = append(text[:idx], append([]byte{byte(rng.Intn(256))}, text[idx:]...)...)
+		}
+
+		var root Root
+		if err := root.UnmarshalText(text); err != nil {
+			continue
+		}
+		require.Equal(string(text), root.String(), "parsed text form should be canonical")
+	}
+}
+
+func TestRootUnmarshalJSON(t *testing.T) {
+	require := require.New(t)
+
+	root := Root{
+		Namespace: common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0),
+		Version:   7,
+		Type:      RootTypeState,
+		Hash:      hash.NewFromBytes([]byte("oasis mkvs test root")),
+		HashMode:  HashModeNamespaced,
+	}
+
+	// The JSON object form should still be accepted.
+	type legacyRoot Root
+	data, err := json.Marshal(legacyRoot(root))
+	require.NoError(err, "json.Marshal")
+	require.True(bytes.HasPrefix(data, []byte("{")), "legacy form should be an object")
+	var dec Root
+	err = json.Unmarshal(data, &dec)
+	require.NoError(err, "json.Unmarshal(legacy)")
+	require.Equal(root, dec, "legacy form should decode")
+
+	// Roots embedded in other structures should use the text form.
+	var wrapped struct {
+		Root Root `json:"root"`
+	}
+	wrapped.Root = root
+	data, err = json.Marshal(wrapped)
+	require.NoError(err, "json.Marshal")
+	require.Equal(`{"root":"`+root.String()+`"}`, string(data))
+
+	err = json.Unmarshal([]byte(`{"root":"`+root.String()+`:extra"}`), &wrapped)
+	require.ErrorIs(err, ErrMalformedRoot, "json.Unmarshal should fail on malformed roots")
+	err = json.Unmarshal([]byte(`{"root":42}`), &wrapped)
+	require.Error(err, "json.Unmarshal should fail on malformed roots")
+}
+
 func TestExtractLeafNode(t *testing.T) {
 	leafNode := &LeafNode{
 		Clean: true,
@@ -23,6 +23,9 @@ type treeOverlay struct {
 // While updates (inserts, removes) are stored in the overlay, reads are not cached in the overlay
 // as the inner tree has its own cache and double caching makes less sense.
 //
+// Reads and iteration merge the inner tree with the pending updates, including removals. The
+// overlay remains usable after Commit, at which point it starts over with no pending updates.
+//
 // The overlay is not safe for concurrent use.
 func NewOverlay(inner Tree) OverlayTree {
 	return &treeOverlay{
@@ -83,7 +86,7 @@ func (o *treeOverlay) Remove(ctx context.Context, key []byte) error {
 // Implements KeyValueTree.
 func (o *treeOverlay) NewIterator(ctx context.Context, options ...IteratorOption) Iterator {
 	return &treeOverlayIterator{
-		tree:    o,
+		dirty:   o.dirty,
 		inner:   o.inner.NewIterator(ctx, options...),
 		overlay: o.overlay.NewIterator(ctx),
 	}
@@ -111,6 +114,11 @@ func (o *treeOverlay) Commit(ctx context.Context) error {
 			return err
 		}
 	}
+
+	// Start over with an empty overlay as all updates are now in the inner tree. Otherwise the
+	// committed items would be returned twice by the merged iterator.
+	o.overlay.Close()
+	o.overlay = New(nil, nil, o.inner.RootType(), WithoutWriteLog())
 	o.dirty = make(map[string]bool)
 
 	return nil
@@ -130,7 +138,8 @@ func (o *treeOverlay) Close() {
 }
 
 type treeOverlayIterator struct {
-	tree *treeOverlay
+	// dirty are the keys for which entries from the inner iterator must be skipped.
+	dirty map[string]bool
 
 	inner   Iterator
 	overlay Iterator
@@ -183,7 +192,7 @@ func (it *treeOverlayIterator) Next() {
 
 func (it *treeOverlayIterator) updateIteratorPosition() {
 	// Skip over any dirty entries from the inner iterator.
-	for it.inner.Valid() && it.tree.dirty[string(it.inner.Key())] {
+	for it.inner.Valid() && it.dirty[string(it.inner.Key())] {
 		it.inner.Next()
 	}
 
@@ -221,11 +230,15 @@ func (it *treeOverlayIterator) GetProofBuilder() *syncer.ProofBuilder {
 	panic(fmt.Errorf("tree overlay: proofs are not supported"))
 }
 
+func (it *treeOverlayIterator) Cursor() (*IteratorCursor, error) {
+	return nil, ErrCursorUnsupported
+}
+
 func (it *treeOverlayIterator) Close() {
 	it.inner.Close()
 	it.overlay.Close()
 
 	it.key = nil
 	it.value = nil
-	it.tree = nil
+	it.dirty = nil
 }
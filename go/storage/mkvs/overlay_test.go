@@ -1,7 +1,11 @@
 package mkvs
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -170,3 +174,121 @@ func TestOverlay(t *testing.T) {
 	_, err = tree.Get(ctx, []byte("key"))
 	require.NoError(err, "Get")
 }
+
+// requireOverlayMatches checks that the overlay contains exactly the items of the given reference.
+func requireOverlayMatches(t *testing.T, overlay OverlayTree, reference map[string][]byte) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var expected writelog.WriteLog
+	for key, value := range reference {
+		expected = append(expected, writelog.LogEntry{Key: []byte(key), Value: value})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i].Key, expected[j].Key) < 0
+	})
+
+	for _, item := range expected {
+		value, err := overlay.Get(ctx, item.Key)
+		require.NoError(err, "Get")
+		require.Equal(item.Value, value, "Get should return the correct value")
+	}
+
+	var items writelog.WriteLog
+	it := overlay.NewIterator(ctx)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		items = append(items, writelog.LogEntry{Key: it.Key(), Value: it.Value()})
+	}
+	require.NoError(it.Err(), "iterator should not error")
+	require.Equal(expected, items, "iterator should return all items in order")
+
+	// Seeking to any item should continue from there.
+	for i, item := range expected {
+		it.Seek(item.Key)
+		require.True(it.Valid(), "iterator should be valid after Seek")
+		require.EqualValues(item.Key, it.Key(), "Seek should position at the correct key")
+		if i+1 < len(expected) {
+			it.Next()
+			require.True(it.Valid(), "iterator should be valid after Next")
+			require.EqualValues(expected[i+1].Key, it.Key(), "Next should move to the following key")
+		}
+	}
+}
+
+func TestOverlayReference(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+
+	const numKeys = 200
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("key %03d", i))
+	}
+
+	// Build the base tree and commit it.
+	var baseLog writelog.WriteLog
+	reference := make(map[string][]byte)
+	for i := 0; i < numKeys; i += 2 {
+		value := []byte(fmt.Sprintf("base %d", i))
+		baseLog = append(baseLog, writelog.LogEntry{Key: key(i), Value: value})
+		reference[string(key(i))] = value
+	}
+
+	tree := New(nil, nil, node.RootTypeState)
+	defer tree.Close()
+	direct := New(nil, nil, node.RootTypeState)
+	defer direct.Close()
+	for _, tr := range []Tree{tree, direct} {
+		err := tr.ApplyWriteLog(ctx, writelog.NewStaticIterator(baseLog))
+		require.NoError(err, "ApplyWriteLog")
+		_, _, err = tr.Commit(ctx, testNs, 0)
+		require.NoError(err, "Commit")
+	}
+
+	overlay := NewOverlay(tree)
+	defer overlay.Close()
+
+	for round := uint64(1); round <= 3; round++ {
+		// Apply random updates to the overlay, the reference and the directly updated tree.
+		for i := 0; i < numKeys; i++ {
+			k := key(rng.Intn(numKeys + 10))
+			var err error
+			switch rng.Intn(3) {
+			case 0:
+				value := []byte(fmt.Sprintf("round %d update %d", round, i))
+				err = overlay.Insert(ctx, k, value)
+				require.NoError(err, "Insert")
+				err = direct.Insert(ctx, k, value)
+				reference[string(k)] = value
+			case 1:
+				err = overlay.Remove(ctx, k)
+				require.NoError(err, "Remove")
+				err = direct.Remove(ctx, k)
+				delete(reference, string(k))
+			case 2:
+				var value []byte
+				value, err = overlay.RemoveExisting(ctx, k)
+				require.NoError(err, "RemoveExisting")
+				require.Equal(reference[string(k)], value, "RemoveExisting should return the previous value")
+				err = direct.Remove(ctx, k)
+				delete(reference, string(k))
+			}
+			require.NoError(err, "direct update")
+		}
+
+		requireOverlayMatches(t, overlay, reference)
+
+		// Commit the overlay and make sure the resulting root matches direct application.
+		err := overlay.Commit(ctx)
+		require.NoError(err, "Commit")
+		_, rootHash, err := tree.Commit(ctx, testNs, round)
+		require.NoError(err, "Commit")
+		_, directRootHash, err := direct.Commit(ctx, testNs, round)
+		require.NoError(err, "Commit")
+		require.Equal(directRootHash, rootHash, "committed root should match direct application")
+
+		// The overlay should remain usable after commit.
+		requireOverlayMatches(t, overlay, reference)
+	}
+}
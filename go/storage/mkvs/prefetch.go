@@ -16,6 +16,9 @@ func (t *tree) PrefetchPrefixes(ctx context.Context, prefixes [][]byte, limit ui
 	if t.cache.isClosed() {
 		return ErrClosed
 	}
+	if t.accessRecorder != nil {
+		t.accessRecorder.recordPrefixes(prefixes, limit)
+	}
 	if t.cache.rs == syncer.NopReadSyncer {
 		// If there is no remote syncer, we just do nothing.
 		return nil
@@ -31,22 +34,83 @@ func (t *tree) doPrefetchPrefixes(ctx context.Context, prefixes [][]byte, limit
 		ctx,
 		t.cache.pendingRoot,
 		func(ctx context.Context, ptr *node.Pointer, rs syncer.ReadSyncer) (*syncer.Proof, error) {
-			rsp, err := rs.SyncGetPrefixes(ctx, &syncer.GetPrefixesRequest{
-				Tree: syncer.TreeID{
-					Root:     t.cache.syncRoot,
-					Position: t.cache.syncRoot.Hash,
-				},
-				Prefixes: prefixes,
-				Limit:    limit,
+			return t.cache.versionedSync(ctx, func(version uint16) (*syncer.ProofResponse, error) {
+				return rs.SyncGetPrefixes(ctx, &syncer.GetPrefixesRequest{
+					Version: version,
+					Tree: syncer.TreeID{
+						Root:     t.cache.syncRoot,
+						Position: t.cache.syncRoot.Hash,
+					},
+					Prefixes: prefixes,
+					Limit:    limit,
+				})
 			})
-			if err != nil {
-				return nil, err
-			}
-			return &rsp.Proof, nil
 		},
 	)
 }
 
+// Implements Tree.
+func (t *tree) PrefetchKeys(ctx context.Context, keys [][]byte) error {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+	if t.cache.rs == syncer.NopReadSyncer {
+		// If there is no remote syncer, we just do nothing.
+		return nil
+	}
+
+	return t.doPrefetchKeys(ctx, keys)
+}
+
+func (t *tree) doPrefetchKeys(ctx context.Context, keys [][]byte) error {
+	for len(keys) > 0 {
+		// Multi-key requests must not be used before a protocol version supporting them has been
+		// negotiated, so fall back to fetching keys one by one until then.
+		if len(keys) > 1 && t.cache.syncVersion >= syncer.ProtocolVersion2 {
+			err := t.cache.remoteSync(
+				ctx,
+				t.cache.pendingRoot,
+				func(ctx context.Context, ptr *node.Pointer, rs syncer.ReadSyncer) (*syncer.Proof, error) {
+					// Multi-key requests are only made after a version has been negotiated, so
+					// they are never retried without a version.
+					return t.cache.versionedSync(ctx, func(version uint16) (*syncer.ProofResponse, error) {
+						return rs.SyncGet(ctx, &syncer.GetRequest{
+							Version: version,
+							Tree: syncer.TreeID{
+								Root:     t.cache.syncRoot,
+								Position: t.cache.syncRoot.Hash,
+							},
+							Key:  keys[0],
+							Keys: keys[1:],
+						})
+					})
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if t.cache.syncVersion >= syncer.ProtocolVersion2 {
+				return nil
+			}
+
+			// The remote read syncer has been downgraded in the meantime, so the proof only
+			// covers the first key. Fetch the remaining keys one by one.
+			keys = keys[1:]
+			continue
+		}
+
+		t.cache.markPosition()
+		if _, err := t.doGet(ctx, t.cache.pendingRoot, 0, keys[0], doGetOptions{}, false); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
 // Implements syncer.ReadSyncer.
 func (t *tree) SyncGetPrefixes(ctx context.Context, request *syncer.GetPrefixesRequest) (*syncer.ProofResponse, error) {
 	t.cache.Lock()
@@ -61,12 +125,21 @@ func (t *tree) SyncGetPrefixes(ctx context.Context, request *syncer.GetPrefixesR
 	if !t.cache.pendingRoot.IsClean() {
 		return nil, syncer.ErrDirtyRoot
 	}
+	version, err := negotiateSyncVersion(request.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, prefix := range request.Prefixes {
+		if err = t.checkKeySize(prefix); err != nil {
+			return nil, err
+		}
+	}
 
 	// First, trigger same prefetching locally if a remote read syncer
 	// is available. This is needed to ensure that the same optimization
 	// carries on to the next layer.
 	if t.cache.rs != syncer.NopReadSyncer {
-		err := t.doPrefetchPrefixes(ctx, request.Prefixes, request.Limit)
+		err = t.doPrefetchPrefixes(ctx, request.Prefixes, request.Limit)
 		if err != nil {
 			return nil, err
 		}
@@ -96,12 +169,13 @@ prefixLoop:
 		}
 	}
 
-	proof, err := it.GetProof()
+	proof, err := it.GetProofBuilder().BuildForVersion(ctx, version)
 	if err != nil {
 		return nil, err
 	}
 
 	return &syncer.ProofResponse{
-		Proof: *proof,
+		Version: syncer.ResponseVersion(request.Version, version),
+		Proof:   *proof,
 	}, nil
 }
@@ -0,0 +1,87 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+)
+
+// PrefixProof is a proof of whether a tree contains any keys with a given prefix.
+type PrefixProof struct {
+	// Empty is true iff the tree does not contain any keys with the prefix.
+	Empty bool `json:"empty"`
+	// Witness is the first key with the prefix in case the tree contains any.
+	Witness []byte `json:"witness,omitempty"`
+	// Proof is the proof anchored at the tree root.
+	Proof syncer.Proof `json:"proof"`
+}
+
+// Implements Tree.
+func (t *tree) ProvePrefixEmpty(ctx context.Context, prefix []byte) (*PrefixProof, error) {
+	if !t.cache.pendingRoot.IsClean() {
+		return nil, syncer.ErrDirtyRoot
+	}
+
+	// Seeking to the prefix visits the path down to where the prefix diverges from the tree
+	// and towards the first key following the prefix, so the proof covers both the (absent)
+	// subtree under the prefix and the witness.
+	it := t.NewIterator(ctx, WithProof(t.cache.pendingRoot.GetHash()))
+	defer it.Close()
+
+	it.Seek(prefix)
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	pp := PrefixProof{Empty: true}
+	if it.Valid() && bytes.HasPrefix(it.Key(), prefix) {
+		pp.Empty = false
+		pp.Witness = append([]byte{}, it.Key()...)
+	}
+
+	proof, err := it.GetProof()
+	if err != nil {
+		return nil, err
+	}
+	pp.Proof = *proof
+	return &pp, nil
+}
+
+// VerifyPrefixProof verifies that the tree with the given root contains keys with the given
+// prefix iff the proof says so, as attested by a proof returned by ProvePrefixEmpty. In case the
+// tree contains such keys, the witness must be the first one.
+func VerifyPrefixProof(ctx context.Context, root node.Root, prefix []byte, proof *PrefixProof) error {
+	if proof.Empty && proof.Witness != nil {
+		return fmt.Errorf("%w: witness for empty prefix", ErrInvalidPrefixProof)
+	}
+
+	pt, err := newProofTree(ctx, root, &proof.Proof)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPrefixProof, err)
+	}
+	defer pt.Close()
+
+	it := pt.NewIterator(ctx)
+	defer it.Close()
+
+	it.Seek(prefix)
+	if err = it.Err(); err != nil {
+		return fmt.Errorf("%w: incomplete proof: %s", ErrInvalidPrefixProof, err)
+	}
+	switch {
+	case it.Valid() && bytes.HasPrefix(it.Key(), prefix):
+		if proof.Empty {
+			return fmt.Errorf("%w: prefix contains key %X", ErrInvalidPrefixProof, it.Key())
+		}
+		if !bytes.Equal(proof.Witness, it.Key()) {
+			return fmt.Errorf("%w: expected witness %X got %X", ErrInvalidPrefixProof, it.Key(), proof.Witness)
+		}
+	default:
+		if !proof.Empty {
+			return fmt.Errorf("%w: prefix does not contain witness %X", ErrInvalidPrefixProof, proof.Witness)
+		}
+	}
+	return nil
+}
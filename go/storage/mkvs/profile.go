@@ -0,0 +1,143 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+)
+
+// AccessProfile is a serializable set of keys and prefixes that have been accessed during a
+// session. It can be used to warm up the cache of a tree before a similar session is started.
+type AccessProfile struct {
+	// Keys are the keys that have been looked up, in key order.
+	Keys [][]byte `json:"keys,omitempty"`
+	// Prefixes are the prefixes that have been prefetched, in prefix order.
+	Prefixes []PrefixAccess `json:"prefixes,omitempty"`
+}
+
+// PrefixAccess is a prefix access recorded in an access profile.
+type PrefixAccess struct {
+	// Prefix is the prefix.
+	Prefix []byte `json:"prefix"`
+	// Limit is the largest limit the prefix has been prefetched with.
+	Limit uint16 `json:"limit"`
+}
+
+// IsEmpty returns true iff the profile does not contain any accesses.
+func (p *AccessProfile) IsEmpty() bool {
+	return len(p.Keys) == 0 && len(p.Prefixes) == 0
+}
+
+// AccessRecorder records the keys and prefixes accessed via any trees it has been attached to.
+//
+// It is safe for concurrent use.
+type AccessRecorder struct {
+	sync.Mutex
+
+	keys     map[string]struct{}
+	prefixes map[string]uint16
+}
+
+// NewAccessRecorder creates a new access recorder.
+func NewAccessRecorder() *AccessRecorder {
+	return &AccessRecorder{
+		keys:     make(map[string]struct{}),
+		prefixes: make(map[string]uint16),
+	}
+}
+
+func (r *AccessRecorder) recordKey(key []byte) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.keys[string(key)] = struct{}{}
+}
+
+func (r *AccessRecorder) recordPrefixes(prefixes [][]byte, limit uint16) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, prefix := range prefixes {
+		if limit > r.prefixes[string(prefix)] {
+			r.prefixes[string(prefix)] = limit
+		}
+	}
+}
+
+// Profile returns the profile of all accesses recorded so far.
+func (r *AccessRecorder) Profile() *AccessProfile {
+	r.Lock()
+	defer r.Unlock()
+
+	var profile AccessProfile
+	for key := range r.keys {
+		profile.Keys = append(profile.Keys, []byte(key))
+	}
+	sort.Slice(profile.Keys, func(i, j int) bool {
+		return bytes.Compare(profile.Keys[i], profile.Keys[j]) < 0
+	})
+	for prefix, limit := range r.prefixes {
+		profile.Prefixes = append(profile.Prefixes, PrefixAccess{Prefix: []byte(prefix), Limit: limit})
+	}
+	sort.Slice(profile.Prefixes, func(i, j int) bool {
+		return bytes.Compare(profile.Prefixes[i].Prefix, profile.Prefixes[j].Prefix) < 0
+	})
+	return &profile
+}
+
+// Reset removes all recorded accesses.
+func (r *AccessRecorder) Reset() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.keys = make(map[string]struct{})
+	r.prefixes = make(map[string]uint16)
+}
+
+// WithAccessRecorder records all keys looked up via Get and all prefixes prefetched via
+// PrefetchPrefixes in the given access recorder.
+//
+// The same recorder may be attached to multiple trees, e.g., to record the accesses of a session
+// spanning multiple rounds.
+func WithAccessRecorder(recorder *AccessRecorder) Option {
+	return func(t *tree) {
+		t.accessRecorder = recorder
+	}
+}
+
+// Implements Tree.
+func (t *tree) PrefetchProfile(ctx context.Context, profile *AccessProfile) error {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+	if t.cache.rs == syncer.NopReadSyncer {
+		// If there is no remote syncer, we just do nothing.
+		return nil
+	}
+
+	// Prefetch prefixes using a single request for each distinct limit.
+	var limits []uint16
+	prefixes := make(map[uint16][][]byte)
+	for _, pa := range profile.Prefixes {
+		if _, ok := prefixes[pa.Limit]; !ok {
+			limits = append(limits, pa.Limit)
+		}
+		prefixes[pa.Limit] = append(prefixes[pa.Limit], pa.Prefix)
+	}
+	for _, limit := range limits {
+		if err := t.doPrefetchPrefixes(ctx, prefixes[limit], limit); err != nil {
+			return err
+		}
+	}
+
+	if len(profile.Keys) == 0 {
+		return nil
+	}
+	return t.doPrefetchKeys(ctx, profile.Keys)
+}
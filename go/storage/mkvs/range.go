@@ -0,0 +1,171 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+)
+
+// newProofTree verifies the given proof and returns a partial tree containing only the nodes
+// included in the proof. As there is neither a node database nor a remote syncer, operations on
+// the partial tree fail in case they need to visit any node that is not included in the proof.
+// Since all included nodes are authenticated by the root hash, successful operations yield the
+// same results as on the full tree.
+//
+// The proof is verified in the hash domain of the given root.
+func newProofTree(ctx context.Context, root node.Root, proof *syncer.Proof) (*tree, error) {
+	pv := syncer.ProofVerifier{Domain: root.HashDomain()}
+	subtree, err := pv.VerifyProof(ctx, root.Hash, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	pt := New(nil, nil, node.RootTypeInvalid, Capacity(0, 0)).(*tree)
+	pt.cache.setPendingRoot(subtree)
+	pt.cache.setSyncRoot(root)
+	return pt, nil
+}
+
+func checkRange(startKey, endKey []byte, limit int) error {
+	if limit <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidRangeLimit, limit)
+	}
+	if endKey != nil && bytes.Compare(endKey, startKey) < 0 {
+		return fmt.Errorf("%w: end key %X before start key %X", ErrInvalidRange, endKey, startKey)
+	}
+	return nil
+}
+
+// rangePrefetch returns the number of elements to prefetch when fetching a
+// range. One more element than the limit is prefetched so that the range
+// boundary can be determined without an additional round trip to a remote
+// syncer.
+func rangePrefetch(limit int) uint16 {
+	if limit < math.MaxUint16 {
+		return uint16(limit + 1)
+	}
+	return math.MaxUint16
+}
+
+// collectRange collects at most limit key/value pairs with keys in the range
+// [startKey, endKey) and returns the key following the last collected pair in
+// case the range has been truncated.
+func collectRange(it Iterator, startKey, endKey []byte, limit int) ([]KeyValue, []byte, error) {
+	var kvs []KeyValue
+	for it.Seek(startKey); it.Valid(); it.Next() {
+		if endKey != nil && bytes.Compare(it.Key(), endKey) >= 0 {
+			break
+		}
+		if len(kvs) == limit {
+			return kvs, it.Key(), nil
+		}
+		kvs = append(kvs, KeyValue{Key: it.Key(), Value: it.Value()})
+	}
+	if err := it.Err(); err != nil {
+		return nil, nil, err
+	}
+	return kvs, nil, nil
+}
+
+// Implements Tree.
+func (t *tree) GetRange(ctx context.Context, startKey, endKey []byte, limit int) ([]KeyValue, []byte, error) {
+	if err := checkRange(startKey, endKey, limit); err != nil {
+		return nil, nil, err
+	}
+
+	it := t.NewIterator(ctx, IteratorPrefetch(rangePrefetch(limit)))
+	defer it.Close()
+
+	return collectRange(it, startKey, endKey, limit)
+}
+
+// Implements Tree.
+func (t *tree) GetRangeWithProof(ctx context.Context, startKey, endKey []byte, limitNodes int) ([]KeyValue, *syncer.Proof, error) {
+	if err := checkRange(startKey, endKey, limitNodes); err != nil {
+		return nil, nil, err
+	}
+	if !t.cache.pendingRoot.IsClean() {
+		return nil, nil, syncer.ErrDirtyRoot
+	}
+
+	// Anchor the proof at the root so that it covers the whole path towards
+	// the start key in addition to all the subtrees spanned by the range.
+	it := t.NewIterator(ctx,
+		WithProof(t.cache.pendingRoot.GetHash()),
+		IteratorPrefetch(rangePrefetch(limitNodes)),
+	)
+	defer it.Close()
+
+	// NOTE: Iteration must always visit the first key after the returned
+	// range (if any) so that the proof also includes the range boundary.
+	kvs, _, err := collectRange(it, startKey, endKey, limitNodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := it.GetProof()
+	if err != nil {
+		return nil, nil, err
+	}
+	return kvs, proof, nil
+}
+
+// VerifyRangeProof verifies that the given key/value pairs are exactly the
+// pairs with keys in the range [startKey, endKey) of the tree with the given
+// root, as attested by a proof returned by GetRangeWithProof. A nil
+// endKey means that the range is not bounded from above.
+//
+// Both inclusion of all pairs and completeness of the range are verified. In
+// case GetRangeWithProof returned a truncated range, endKey should be set to
+// the immediate successor of the last returned key (e.g., the key with a zero
+// byte appended).
+func VerifyRangeProof(
+	ctx context.Context,
+	root node.Root,
+	startKey, endKey []byte,
+	kvs []KeyValue,
+	proof *syncer.Proof,
+) error {
+	if endKey != nil && bytes.Compare(endKey, startKey) < 0 {
+		return fmt.Errorf("%w: end key %X before start key %X", ErrInvalidRange, endKey, startKey)
+	}
+
+	// Iterate over the verified partial tree. A successful iteration yields
+	// exactly the contents of the range.
+	pt, err := newProofTree(ctx, root, proof)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRangeProof, err)
+	}
+	defer pt.Close()
+
+	it := pt.NewIterator(ctx)
+	defer it.Close()
+
+	var idx int
+	for it.Seek(startKey); it.Valid(); it.Next() {
+		if endKey != nil && bytes.Compare(it.Key(), endKey) >= 0 {
+			break
+		}
+		if idx >= len(kvs) {
+			return fmt.Errorf("%w: missing key %X", ErrInvalidRangeProof, it.Key())
+		}
+		kv := kvs[idx]
+		if !bytes.Equal(kv.Key, it.Key()) {
+			return fmt.Errorf("%w: expected key %X got %X", ErrInvalidRangeProof, it.Key(), kv.Key)
+		}
+		if !bytes.Equal(kv.Value, it.Value()) {
+			return fmt.Errorf("%w: bad value for key %X", ErrInvalidRangeProof, kv.Key)
+		}
+		idx++
+	}
+	if err = it.Err(); err != nil {
+		return fmt.Errorf("%w: incomplete proof: %s", ErrInvalidRangeProof, err)
+	}
+	if idx != len(kvs) {
+		return fmt.Errorf("%w: unexpected key %X", ErrInvalidRangeProof, kvs[idx].Key)
+	}
+	return nil
+}
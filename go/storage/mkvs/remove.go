@@ -9,18 +9,31 @@ import (
 
 // Implements Tree.
 func (t *tree) RemoveExisting(ctx context.Context, key []byte) ([]byte, error) {
+	_, existing, err := t.RemoveEx(ctx, key)
+	return existing, err
+}
+
+// Implements Tree.
+func (t *tree) RemoveEx(ctx context.Context, key []byte) (bool, []byte, error) {
+	if err := t.checkKeySize(key); err != nil {
+		return false, nil, err
+	}
+	if err := t.forks.copyOnWrite(ctx, t, key); err != nil {
+		return false, nil, err
+	}
+
 	t.cache.Lock()
 	defer t.cache.Unlock()
 
 	if t.cache.isClosed() {
-		return nil, ErrClosed
+		return false, nil, ErrClosed
 	}
 
 	// If the key has already been removed locally, don't try to remove it again.
 	var entry *pendingEntry
 	if !t.withoutWriteLog {
 		if entry = t.pendingWriteLog[node.ToMapKey(key)]; entry != nil && entry.value == nil {
-			return nil, nil
+			return false, nil, nil
 		}
 	}
 
@@ -29,7 +42,7 @@ func (t *tree) RemoveExisting(ctx context.Context, key []byte) ([]byte, error) {
 
 	newRoot, changed, existing, err := t.doRemove(ctx, t.cache.pendingRoot, 0, key, 0)
 	if err != nil {
-		return nil, err
+		return false, nil, err
 	}
 
 	// Update the pending write log.
@@ -42,7 +55,7 @@ func (t *tree) RemoveExisting(ctx context.Context, key []byte) ([]byte, error) {
 	}
 
 	t.cache.setPendingRoot(newRoot)
-	return existing, nil
+	return changed, existing, nil
 }
 
 // Implements Tree.
@@ -63,7 +76,7 @@ func (t *tree) doRemove(
 	}
 
 	// Dereference the node, possibly making a remote request.
-	nd, err := t.cache.derefNodePtr(ctx, ptr, t.newFetcherSyncGet(key, true))
+	nd, err := t.cache.derefNodePtr(ctx, ptr, bitDepth, key, t.newFetcherSyncGet(key, true))
 	if err != nil {
 		return nil, false, nil, err
 	}
@@ -99,11 +112,11 @@ func (t *tree) doRemove(
 			// NOTE: The leaf node is always included with the internal node.
 			remainingLeaf = n.LeafNode.Node
 		}
-		remainingLeft, err := t.cache.derefNodePtr(ctx, n.Left, t.newFetcherSyncGet(key, true))
+		remainingLeft, err := t.cache.derefNodePtr(ctx, n.Left, bitLength, key, t.newFetcherSyncGet(key, true))
 		if err != nil {
 			return nil, false, nil, err
 		}
-		remainingRight, err := t.cache.derefNodePtr(ctx, n.Right, t.newFetcherSyncGet(key, true))
+		remainingRight, err := t.cache.derefNodePtr(ctx, n.Right, bitLength, key, t.newFetcherSyncGet(key, true))
 		if err != nil {
 			return nil, false, nil, err
 		}
@@ -0,0 +1,58 @@
+package mkvs
+
+import (
+	"github.com/oasisprotocol/oasis-core/go/common/cache/lru"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// SharedCache is a node cache that can be shared between multiple trees backed by the same
+// node database (e.g., one tree per request when serving queries).
+//
+// Trees configured with a shared cache consult it before fetching nodes from the node database
+// and populate it with any nodes fetched from the node database. As nodes are immutable and
+// addressed by their hash, cached nodes are valid for any tree. Trees never share node instances
+// as each lookup returns a fresh copy of the cached node.
+//
+// A shared cache is safe for concurrent use by multiple trees.
+type SharedCache struct {
+	nodes *lru.Cache
+}
+
+func (sc *SharedCache) get(h hash.Hash) node.Node {
+	v, ok := sc.nodes.Get(h)
+	if !ok {
+		return nil
+	}
+	return v.(node.Node).Extract()
+}
+
+func (sc *SharedCache) put(n node.Node) {
+	// Nodes too large to fit into the cache are simply not cached.
+	_ = sc.nodes.Put(n.GetHash(), n.Extract())
+}
+
+// Size returns the current size of the cached nodes in bytes.
+func (sc *SharedCache) Size() uint64 {
+	return sc.nodes.Size()
+}
+
+// NewSharedCache creates a new shared node cache with the given capacity in bytes.
+//
+// If a capacity of 0 is specified, the cache will have an unlimited size (not recommended, as
+// this will cause unbounded memory growth).
+func NewSharedCache(capacity uint64) *SharedCache {
+	nodes, _ := lru.New(lru.Capacity(capacity, true))
+	return &SharedCache{
+		nodes: nodes,
+	}
+}
+
+// WithSharedCache configures the tree to use the given shared node cache.
+//
+// The shared cache must only be shared between trees backed by the same node database.
+func WithSharedCache(sc *SharedCache) Option {
+	return func(t *tree) {
+		t.cache.sharedCache = sc
+	}
+}
@@ -0,0 +1,228 @@
+package mkvs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	badgerDb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/badger"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+const sharedCacheTestKeys = 1000
+
+// countingNodeDB is a node database which counts node lookups.
+type countingNodeDB struct {
+	db.NodeDB
+
+	reads uint64
+}
+
+func (d *countingNodeDB) GetNode(root node.Root, ptr *node.Pointer) (node.Node, error) {
+	atomic.AddUint64(&d.reads, 1)
+	return d.NodeDB.GetNode(root, ptr)
+}
+
+func (d *countingNodeDB) resetReads() uint64 {
+	return atomic.SwapUint64(&d.reads, 0)
+}
+
+func sharedCacheTestKey(i int) []byte {
+	return []byte(fmt.Sprintf("key %d", i))
+}
+
+func sharedCacheTestValue(i int) []byte {
+	return []byte(fmt.Sprintf("value %d", i))
+}
+
+// newSharedCacheTestDB creates a new node database containing a single finalized root.
+func newSharedCacheTestDB(tb testing.TB) (*countingNodeDB, node.Root, func()) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "mkvs.sharedcache.badgerdb")
+	require.NoError(tb, err, "TempDir")
+	ndb, err := badgerDb.New(&db.Config{
+		DB:        dir,
+		NoFsync:   true,
+		Namespace: testNs,
+	})
+	require.NoError(tb, err, "New")
+	cleanup := func() {
+		ndb.Close()
+		os.RemoveAll(dir)
+	}
+
+	tree := New(nil, ndb, node.RootTypeState)
+	for i := 0; i < sharedCacheTestKeys; i++ {
+		err = tree.Insert(ctx, sharedCacheTestKey(i), sharedCacheTestValue(i))
+		require.NoError(tb, err, "Insert")
+	}
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(tb, err, "Commit")
+	tree.Close()
+
+	root := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+	err = ndb.Finalize(ctx, []node.Root{root})
+	require.NoError(tb, err, "Finalize")
+
+	return &countingNodeDB{NodeDB: ndb}, root, cleanup
+}
+
+func TestSharedCache(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ndb, root, cleanup := newSharedCacheTestDB(t)
+	defer cleanup()
+
+	sc := NewSharedCache(16 * 1024 * 1024)
+	get := func(i int) {
+		tree := NewWithRoot(nil, ndb, root, WithSharedCache(sc))
+		defer tree.Close()
+
+		value, err := tree.Get(ctx, sharedCacheTestKey(i))
+		require.NoError(err, "Get")
+		require.Equal(sharedCacheTestValue(i), value, "Get should return the correct value")
+	}
+
+	// The first tree populates the shared cache.
+	get(0)
+	require.NotZero(ndb.resetReads(), "first tree should read from the node database")
+	require.NotZero(sc.Size(), "shared cache should be populated")
+
+	// Further trees at the same root should not need to hit the node database.
+	for i := 0; i < 100; i++ {
+		get(0)
+	}
+	require.Zero(ndb.resetReads(), "further trees should be served from the shared cache")
+
+	// Lookups of other keys should only need to fetch nodes not yet cached.
+	get(1)
+	reads := ndb.resetReads()
+	get(1)
+	require.Zero(ndb.resetReads(), "repeated lookups should be served from the shared cache")
+
+	// Trees without the shared cache are not affected.
+	tree := NewWithRoot(nil, ndb, root)
+	defer tree.Close()
+	value, err := tree.Get(ctx, sharedCacheTestKey(1))
+	require.NoError(err, "Get")
+	require.Equal(sharedCacheTestValue(1), value, "Get should return the correct value")
+	require.True(ndb.resetReads() > reads, "trees without the shared cache should read from the node database")
+
+	// Modifications to one tree must not affect other trees sharing the cache.
+	tree = NewWithRoot(nil, ndb, root, WithSharedCache(sc))
+	defer tree.Close()
+	err = tree.Insert(ctx, sharedCacheTestKey(0), []byte("modified"))
+	require.NoError(err, "Insert")
+	err = tree.Remove(ctx, sharedCacheTestKey(1))
+	require.NoError(err, "Remove")
+	get(0)
+	get(1)
+}
+
+func TestSharedCacheEviction(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	ndb, root, cleanup := newSharedCacheTestDB(t)
+	defer cleanup()
+
+	const capacity = 4096
+	sc := NewSharedCache(capacity)
+	tree := NewWithRoot(nil, ndb, root, WithSharedCache(sc))
+	defer tree.Close()
+
+	for i := 0; i < sharedCacheTestKeys; i++ {
+		value, err := tree.Get(ctx, sharedCacheTestKey(i))
+		require.NoError(err, "Get")
+		require.Equal(sharedCacheTestValue(i), value, "Get should return the correct value")
+		require.True(sc.Size() <= capacity, "shared cache should not exceed its capacity")
+	}
+}
+
+func TestSharedCacheConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	ndb, root, cleanup := newSharedCacheTestDB(t)
+	defer cleanup()
+
+	// Use a small capacity so that nodes also get evicted concurrently.
+	sc := NewSharedCache(64 * 1024)
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 16)
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := w; i < sharedCacheTestKeys; i += 7 {
+				tree := NewWithRoot(nil, ndb, root, WithSharedCache(sc))
+				value, err := tree.Get(ctx, sharedCacheTestKey(i))
+				if err == nil && string(value) != string(sharedCacheTestValue(i)) {
+					err = fmt.Errorf("incorrect value for key %d: %s", i, value)
+				}
+				if err == nil && w%2 == 0 {
+					// Also modify the tree to make sure local changes do not leak.
+					err = tree.Insert(ctx, sharedCacheTestKey(i), []byte("modified"))
+				}
+				tree.Close()
+				if err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(t, err, "concurrent trees should return correct values")
+	}
+}
+
+func BenchmarkSharedCache(b *testing.B) {
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Shared=%v", shared), func(b *testing.B) {
+			benchmarkSharedCache(b, shared)
+		})
+	}
+}
+
+// benchmarkSharedCache performs 100 sequential single-Get trees at the same root and reports the
+// number of node database reads per operation.
+func benchmarkSharedCache(b *testing.B, shared bool) {
+	ctx := context.Background()
+
+	ndb, root, cleanup := newSharedCacheTestDB(b)
+	defer cleanup()
+
+	var options []Option
+	if shared {
+		options = append(options, WithSharedCache(NewSharedCache(16*1024*1024)))
+	}
+
+	ndb.resetReads()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 100; i++ {
+			tree := NewWithRoot(nil, ndb, root, options...)
+			if _, err := tree.Get(ctx, sharedCacheTestKey(i)); err != nil {
+				b.Fatalf("Get: %s", err)
+			}
+			tree.Close()
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(ndb.resetReads())/float64(b.N), "dbreads/op")
+}
@@ -0,0 +1,35 @@
+package mkvs
+
+import (
+	"context"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+// EstimateSizeDelta estimates the net change in the size of the tree (in bytes) after applying
+// the given write log, using the sizes of the values currently stored in the tree.
+//
+// The tree is only read and no modifications are made to it. See writelog.EstimateSizeDelta for
+// details on how the estimate is computed.
+func EstimateSizeDelta(ctx context.Context, tree ImmutableKeyValueTree, wl writelog.Iterator) (int64, error) {
+	var lookupErr error
+	delta, err := writelog.EstimateSizeDelta(wl, func(key []byte) (int, bool) {
+		if lookupErr != nil {
+			return 0, false
+		}
+
+		value, err := tree.Get(ctx, key)
+		if err != nil {
+			lookupErr = err
+			return 0, false
+		}
+		return len(value), value != nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if lookupErr != nil {
+		return 0, lookupErr
+	}
+	return delta, nil
+}
@@ -0,0 +1,161 @@
+package mkvs
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	db "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/api"
+	badgerDb "github.com/oasisprotocol/oasis-core/go/storage/mkvs/db/badger"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/writelog"
+)
+
+// sizeEstimateTolerance is the maximum relative difference between the estimated and the actual
+// tree size delta. Structural overhead depends on the shape of the tree (e.g., label lengths and
+// the number of internal nodes) which is only approximated by the estimate.
+const sizeEstimateTolerance = 0.01
+
+// liveTreeSize returns the total size of all serialized nodes reachable from the given root.
+func liveTreeSize(t *testing.T, ndb db.NodeDB, root node.Root) int64 {
+	var size func(ptr *node.Pointer) int64
+	size = func(ptr *node.Pointer) int64 {
+		if ptr == nil || ptr.Hash.IsEmpty() {
+			return 0
+		}
+		nd, err := ndb.GetNode(root, ptr)
+		require.NoError(t, err, "GetNode")
+		data, err := nd.MarshalBinary()
+		require.NoError(t, err, "MarshalBinary")
+
+		total := int64(len(data))
+		if n, ok := nd.(*node.InternalNode); ok {
+			// Leaf nodes are serialized as part of the internal node.
+			total += size(n.Left) + size(n.Right)
+		}
+		return total
+	}
+
+	if root.Hash.IsEmpty() {
+		return 0
+	}
+	return size(&node.Pointer{Clean: true, Hash: root.Hash})
+}
+
+func TestEstimateSizeDelta(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "mkvs.size.badgerdb")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dir)
+	ndb, err := badgerDb.New(&db.Config{
+		DB:        dir,
+		NoFsync:   true,
+		Namespace: testNs,
+	})
+	require.NoError(err, "New")
+	defer ndb.Close()
+
+	rng := rand.New(rand.NewSource(42))
+	randomBytes := func(n int) []byte {
+		b := make([]byte, n)
+		_, _ = rng.Read(b)
+		return b
+	}
+
+	// Populate the base tree.
+	var keys [][]byte
+	var wl writelog.WriteLog
+	for i := 0; i < 1000; i++ {
+		key := randomBytes(32)
+		keys = append(keys, key)
+		wl = append(wl, writelog.LogEntry{Key: key, Value: randomBytes(64)})
+	}
+
+	version := uint64(0)
+	root := node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState}
+	root.Hash.Empty()
+	apply := func(wl writelog.WriteLog) (estimate, actual int64) {
+		tree := NewWithRoot(nil, ndb, root)
+		defer tree.Close()
+
+		estimate, err = EstimateSizeDelta(ctx, tree, writelog.NewStaticIterator(wl))
+		require.NoError(err, "EstimateSizeDelta")
+
+		err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(err, "ApplyWriteLog")
+		_, rootHash, err := tree.Commit(ctx, testNs, version)
+		require.NoError(err, "Commit")
+		err = ndb.Finalize(ctx, []node.Root{{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}})
+		require.NoError(err, "Finalize")
+
+		newRoot := node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}
+		actual = liveTreeSize(t, ndb, newRoot) - liveTreeSize(t, ndb, root)
+		root = newRoot
+		version++
+		return
+	}
+	requireWithinTolerance := func(name string, estimate, actual int64) {
+		diff := math.Abs(float64(estimate-actual)) / math.Abs(float64(actual))
+		require.True(diff <= sizeEstimateTolerance,
+			"%s: estimate %d should be within tolerance of actual delta %d", name, estimate, actual)
+	}
+
+	estimate, actual := apply(wl)
+	requireWithinTolerance("initial", estimate, actual)
+
+	t.Run("InsertHeavy", func(t *testing.T) {
+		var wl writelog.WriteLog
+		for i := 0; i < 1000; i++ {
+			key := randomBytes(32)
+			keys = append(keys, key)
+			wl = append(wl, writelog.LogEntry{Key: key, Value: randomBytes(16 + rng.Intn(128))})
+		}
+		// Also overwrite some existing keys.
+		for _, key := range keys[:100] {
+			wl = append(wl, writelog.LogEntry{Key: key, Value: randomBytes(32)})
+		}
+
+		estimate, actual := apply(wl)
+		require.Greater(actual, int64(0), "tree should grow")
+		requireWithinTolerance("insert-heavy", estimate, actual)
+	})
+
+	t.Run("OverwriteHeavy", func(t *testing.T) {
+		var wl writelog.WriteLog
+		for _, key := range keys[:1500] {
+			wl = append(wl, writelog.LogEntry{Key: key, Value: randomBytes(128 + rng.Intn(128))})
+		}
+		// Also insert some new keys.
+		for i := 0; i < 10; i++ {
+			key := randomBytes(32)
+			keys = append(keys, key)
+			wl = append(wl, writelog.LogEntry{Key: key, Value: randomBytes(64)})
+		}
+
+		estimate, actual := apply(wl)
+		require.Greater(actual, int64(0), "tree should grow")
+		requireWithinTolerance("overwrite-heavy", estimate, actual)
+	})
+
+	t.Run("DeleteHeavy", func(t *testing.T) {
+		var wl writelog.WriteLog
+		for _, key := range keys[:1200] {
+			wl = append(wl, writelog.LogEntry{Key: key})
+		}
+		// Deleting non-existent keys has no effect.
+		for i := 0; i < 100; i++ {
+			wl = append(wl, writelog.LogEntry{Key: randomBytes(32)})
+		}
+
+		estimate, actual := apply(wl)
+		require.Less(actual, int64(0), "tree should shrink")
+		requireWithinTolerance("delete-heavy", estimate, actual)
+	})
+}
@@ -0,0 +1,131 @@
+package mkvs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+)
+
+// subtreeExportVersion is the version of the subtree export stream format.
+const subtreeExportVersion uint16 = 1
+
+// subtreeExportHeader is the header of a subtree export stream. It is followed by the CBOR-encoded
+// entries of a proof anchored at the tree root, in pre-order traversal.
+type subtreeExportHeader struct {
+	// Version is the stream format version.
+	Version uint16 `json:"v"`
+	// Root is the root hash the proof is anchored at. It is untrusted and only used as a quick
+	// sanity check before the proof is verified.
+	Root hash.Hash `json:"root"`
+	// Prefix is the exported key prefix.
+	Prefix []byte `json:"prefix"`
+}
+
+// Implements Tree.
+func (t *tree) ExportSubtree(ctx context.Context, prefix []byte, w io.Writer) error {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+	if !t.cache.pendingRoot.IsClean() {
+		return syncer.ErrDirtyRoot
+	}
+
+	// Anchor the proof at the root so that it binds the exported nodes to the full tree.
+	root := t.cache.pendingRoot.GetHash()
+	it := t.NewIterator(ctx, WithProof(root))
+	defer it.Close()
+
+	// NOTE: Iteration must always visit the first key after the prefix (if any) so that the
+	//       proof also includes the subtree boundary.
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		if !bytes.HasPrefix(it.Key(), prefix) {
+			break
+		}
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+	proof, err := it.GetProof()
+	if err != nil {
+		return err
+	}
+
+	enc := cbor.NewEncoder(w)
+	if err = enc.Encode(&subtreeExportHeader{
+		Version: subtreeExportVersion,
+		Root:    proof.UntrustedRoot,
+		Prefix:  prefix,
+	}); err != nil {
+		return fmt.Errorf("mkvs: failed to encode subtree export header: %w", err)
+	}
+	for _, entry := range proof.Entries {
+		if err = enc.Encode(entry); err != nil {
+			return fmt.Errorf("mkvs: failed to encode subtree export entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// Implements Tree.
+func (t *tree) ImportSubtree(ctx context.Context, r io.Reader) error {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+	if !t.cache.pendingRoot.IsClean() {
+		return syncer.ErrDirtyRoot
+	}
+
+	dec := cbor.NewDecoder(r)
+	var hdr subtreeExportHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return fmt.Errorf("mkvs: failed to decode subtree export header: %w", err)
+	}
+	if hdr.Version != subtreeExportVersion {
+		return fmt.Errorf("mkvs: unsupported subtree export version %d", hdr.Version)
+	}
+	root := t.cache.pendingRoot.GetHash()
+	if !hdr.Root.Equal(&root) {
+		return fmt.Errorf("%w (expected: %s got: %s)", ErrSubtreeRootMismatch, root, hdr.Root)
+	}
+
+	proof := syncer.Proof{
+		UntrustedRoot: hdr.Root,
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var entry []byte
+		if err := dec.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("mkvs: failed to decode subtree export entry: %w", err)
+		}
+		proof.Entries = append(proof.Entries, entry)
+	}
+
+	// Verify the proof against the local root and merge the resulting nodes into the cache, the
+	// same as if they were fetched via the read syncer.
+	return t.cache.remoteSync(
+		ctx,
+		t.cache.pendingRoot,
+		func(context.Context, *node.Pointer, syncer.ReadSyncer) (*syncer.Proof, error) {
+			return &proof, nil
+		},
+	)
+}
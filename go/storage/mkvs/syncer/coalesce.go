@@ -0,0 +1,226 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// DefaultCoalescingMaxKeys is the default maximum number of keys in a coalesced request.
+const DefaultCoalescingMaxKeys = 64
+
+// CoalescingConfig is the configuration of a coalescing read syncer.
+type CoalescingConfig struct {
+	// Window is the duration for which the first request of a batch waits for other requests to
+	// coalesce with before the batch is sent.
+	Window time.Duration
+	// MaxKeys is the maximum number of keys in a coalesced request. When a batch reaches the
+	// limit, it is sent immediately. If zero, DefaultCoalescingMaxKeys is used.
+	MaxKeys int
+}
+
+// coalescingKey identifies the requests that can be coalesced into the same batch.
+type coalescingKey struct {
+	root            node.Root
+	includeSiblings bool
+}
+
+type coalescedBatch struct {
+	key      coalescingKey
+	requests []*GetRequest
+	keys     [][]byte
+	seen     map[string]bool
+	version  uint16
+
+	timer   *time.Timer
+	flushed bool
+	waiters int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	done     chan struct{}
+	rsp      *ProofResponse
+	err      error
+	fallback bool
+}
+
+func (b *coalescedBatch) add(request *GetRequest) {
+	b.requests = append(b.requests, request)
+	if request.Version < b.version {
+		b.version = request.Version
+	}
+	for _, key := range append([][]byte{request.Key}, request.Keys...) {
+		if b.seen[string(key)] {
+			continue
+		}
+		b.seen[string(key)] = true
+		b.keys = append(b.keys, key)
+	}
+}
+
+// CoalescingSyncer is a ReadSyncer which coalesces SyncGet requests for the same root arriving
+// within a short window into a single multi-key request and shares the resulting proof between
+// all callers. This reduces the number of requests when many trees backed by the same read syncer
+// concurrently look up keys sharing the upper parts of the tree.
+//
+// Proofs of coalesced requests are anchored at the tree root. Requests that do not support
+// multi-key requests (protocol versions below ProtocolVersion2) as well as SyncGetPrefixes and
+// SyncIterate requests are forwarded as-is. In case the remote peer does not support multi-key
+// requests, the requests of the batch are forwarded individually. Note that shared responses must
+// not be modified.
+type CoalescingSyncer struct {
+	l sync.Mutex
+
+	rs  ReadSyncer
+	cfg CoalescingConfig
+
+	pending map[coalescingKey]*coalescedBatch
+}
+
+// NewCoalescingSyncer creates a new read syncer which coalesces concurrent SyncGet requests to the
+// given read syncer.
+func NewCoalescingSyncer(rs ReadSyncer, cfg CoalescingConfig) (*CoalescingSyncer, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("mkvs: invalid coalescing window: %s", cfg.Window)
+	}
+	switch {
+	case cfg.MaxKeys == 0:
+		cfg.MaxKeys = DefaultCoalescingMaxKeys
+	case cfg.MaxKeys < 0:
+		return nil, fmt.Errorf("mkvs: invalid maximum number of coalesced keys: %d", cfg.MaxKeys)
+	}
+
+	return &CoalescingSyncer{
+		rs:      rs,
+		cfg:     cfg,
+		pending: make(map[coalescingKey]*coalescedBatch),
+	}, nil
+}
+
+// join adds the given request to the pending batch for its root, creating the batch if needed.
+func (s *CoalescingSyncer) join(request *GetRequest) *coalescedBatch {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	key := coalescingKey{
+		root:            request.Tree.Root,
+		includeSiblings: request.IncludeSiblings,
+	}
+	b := s.pending[key]
+	if b == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		b = &coalescedBatch{
+			key:     key,
+			seen:    make(map[string]bool),
+			version: request.Version,
+			ctx:     ctx,
+			cancel:  cancel,
+			done:    make(chan struct{}),
+		}
+		b.timer = time.AfterFunc(s.cfg.Window, func() { s.flush(b) })
+		s.pending[key] = b
+	}
+	b.add(request)
+	b.waiters++
+
+	if len(b.keys) >= s.cfg.MaxKeys {
+		b.timer.Stop()
+		go s.flush(b)
+	}
+	return b
+}
+
+// leave removes a waiter whose context has been canceled from the given batch. Once there are no
+// more waiters, the batch is dropped in case it has not been sent yet, or its request is canceled
+// otherwise.
+func (s *CoalescingSyncer) leave(b *coalescedBatch) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	b.waiters--
+	if b.waiters > 0 {
+		return
+	}
+	if !b.flushed {
+		b.timer.Stop()
+		b.flushed = true
+		delete(s.pending, b.key)
+		b.err = context.Canceled
+		close(b.done)
+	}
+	b.cancel()
+}
+
+// flush sends the given batch unless it has already been sent.
+func (s *CoalescingSyncer) flush(b *coalescedBatch) {
+	s.l.Lock()
+	if b.flushed {
+		s.l.Unlock()
+		return
+	}
+	b.flushed = true
+	delete(s.pending, b.key)
+	s.l.Unlock()
+
+	defer close(b.done)
+	defer b.cancel()
+
+	// Forward single requests as-is to preserve the position of the proof.
+	if len(b.requests) == 1 {
+		b.rsp, b.err = s.rs.SyncGet(b.ctx, b.requests[0])
+		return
+	}
+
+	b.rsp, b.err = s.rs.SyncGet(b.ctx, &GetRequest{
+		Version: b.version,
+		Tree: TreeID{
+			Root:     b.key.root,
+			Position: b.key.root.Hash,
+		},
+		Key:             b.keys[0],
+		Keys:            b.keys[1:],
+		IncludeSiblings: b.key.includeSiblings,
+	})
+	switch {
+	case errors.Is(b.err, ErrFeatureNotNegotiated):
+		b.fallback = true
+	case b.err == nil && b.rsp.Version < ProtocolVersion2:
+		// Peers that predate multi-key requests only return a proof for the first key.
+		b.fallback = true
+	}
+}
+
+func (s *CoalescingSyncer) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	if request.Version < ProtocolVersion2 {
+		return s.rs.SyncGet(ctx, request)
+	}
+
+	b := s.join(request)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		s.leave(b)
+		return nil, ctx.Err()
+	}
+
+	if b.fallback {
+		return s.rs.SyncGet(ctx, request)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.rsp, nil
+}
+
+func (s *CoalescingSyncer) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	return s.rs.SyncGetPrefixes(ctx, request)
+}
+
+func (s *CoalescingSyncer) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	return s.rs.SyncIterate(ctx, request)
+}
@@ -0,0 +1,212 @@
+package syncer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+const (
+	// compactRootEmpty is the compact proof root type for empty trees.
+	compactRootEmpty byte = 0x00
+	// compactRootHash is the compact proof root type for proofs only containing the root hash.
+	compactRootHash byte = 0x01
+	// compactRootNode is the compact proof root type for proofs containing nodes.
+	compactRootNode byte = 0x02
+
+	// compactChildEmpty is the compact proof child type for empty subtrees.
+	compactChildEmpty byte = 0x00
+	// compactChildHash is the compact proof child type for subtree hashes.
+	compactChildHash byte = 0x01
+	// compactChildIncluded is the compact proof child type for included nodes.
+	compactChildIncluded byte = 0x02
+
+	// compactChildMask is the mask of a single child type in the children bitmap.
+	compactChildMask byte = 0x03
+)
+
+var errMalformedCompactProof = errors.New("verifier: malformed compact proof")
+
+// BuildCompact tries to build the proof using the compact proof encoding.
+//
+// The compact encoding starts with a root type byte. Proofs for empty trees consist of only the
+// root type byte, proofs which do not include the root node consist of the root type byte
+// followed by the 32-byte root hash. Otherwise the root type byte is followed by a post-order
+// stream of included nodes, where each node is encoded as the uvarint length of its compact
+// binary encoding (see node.Node.CompactMarshalBinary) followed by the encoding itself.
+//
+// Internal nodes are additionally followed by a bitmap byte holding the types of the left (low
+// bits) and right (high bits) child and by the 32-byte hashes of all children which are not
+// included in the proof. Included children immediately precede their parent in the stream while
+// empty children are omitted entirely.
+func (b *ProofBuilder) BuildCompact(ctx context.Context) (*Proof, error) {
+	proof := Proof{
+		UntrustedRoot: b.proofRoot(),
+	}
+
+	switch {
+	case proof.UntrustedRoot.IsEmpty():
+		proof.Compact = []byte{compactRootEmpty}
+	case b.included[proof.UntrustedRoot] == nil:
+		proof.Compact = append([]byte{compactRootHash}, proof.UntrustedRoot[:]...)
+	default:
+		proof.Compact = []byte{compactRootNode}
+		if err := b.buildCompact(ctx, &proof, proof.UntrustedRoot); err != nil {
+			return nil, err
+		}
+	}
+	return &proof, nil
+}
+
+// BuildForVersion tries to build the proof using the encoding for the given read syncer
+// protocol version.
+func (b *ProofBuilder) BuildForVersion(ctx context.Context, version uint16) (*Proof, error) {
+	if version >= ProtocolVersion3 {
+		return b.BuildCompact(ctx)
+	}
+	return b.Build(ctx)
+}
+
+func (b *ProofBuilder) buildCompact(ctx context.Context, proof *Proof, h hash.Hash) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Post-order traversal, add included children first.
+	n := b.included[h]
+	var (
+		bitmap byte
+		hashes []hash.Hash
+	)
+	for i, childHash := range n.children {
+		var kind byte
+		switch {
+		case childHash.IsEmpty():
+			kind = compactChildEmpty
+		case b.included[childHash] != nil:
+			kind = compactChildIncluded
+			if err := b.buildCompact(ctx, proof, childHash); err != nil {
+				return err
+			}
+		default:
+			kind = compactChildHash
+			hashes = append(hashes, childHash)
+		}
+		bitmap |= kind << (2 * i)
+	}
+
+	// And then add the visited node.
+	var size [binary.MaxVarintLen64]byte
+	proof.Compact = append(proof.Compact, size[:binary.PutUvarint(size[:], uint64(len(n.serialized)))]...)
+	proof.Compact = append(proof.Compact, n.serialized...)
+	if n.children != nil {
+		proof.Compact = append(proof.Compact, bitmap)
+		for _, childHash := range hashes {
+			proof.Compact = append(proof.Compact, childHash[:]...)
+		}
+	}
+
+	return nil
+}
+
+func (pv *ProofVerifier) verifyCompactProof(ctx context.Context, data []byte) (*node.Pointer, error) {
+	switch data[0] {
+	case compactRootEmpty:
+		if len(data) != 1 {
+			return nil, errMalformedCompactProof
+		}
+		return nil, nil
+	case compactRootHash:
+		var h hash.Hash
+		if err := h.UnmarshalBinary(data[1:]); err != nil {
+			return nil, err
+		}
+		return &node.Pointer{Clean: true, Hash: h}, nil
+	case compactRootNode:
+	default:
+		return nil, fmt.Errorf("verifier: unexpected root type in compact proof (%x)", data[0])
+	}
+
+	// Included nodes are in post-order, so the children of each internal node are at the top of
+	// the stack when the node itself is decoded.
+	var stack []*node.Pointer
+	for pos := 1; pos < len(data); {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		size, n := binary.Uvarint(data[pos:])
+		if n <= 0 || size > uint64(len(data)-pos-n) {
+			return nil, errMalformedCompactProof
+		}
+		pos += n
+		nd, err := node.UnmarshalBinary(data[pos : pos+int(size)])
+		if err != nil {
+			return nil, err
+		}
+		pos += int(size)
+
+		// Decoding computes hashes in the default hash domain. Hashes of internal nodes are
+		// recomputed below once their children are known.
+		if _, ok := nd.(*node.LeafNode); ok && pv.Domain.Mode != node.HashModeDefault {
+			nd.UpdateHashInDomain(pv.Domain)
+		}
+
+		// For internal nodes, also decode children.
+		if nd, ok := nd.(*node.InternalNode); ok {
+			if pos >= len(data) {
+				return nil, errMalformedCompactProof
+			}
+			bitmap := data[pos]
+			pos++
+
+			kinds := [2]byte{bitmap & compactChildMask, (bitmap >> 2) & compactChildMask}
+			if bitmap>>4 != 0 {
+				return nil, errMalformedCompactProof
+			}
+			var children [2]*node.Pointer
+			for i, kind := range kinds {
+				switch kind {
+				case compactChildEmpty, compactChildIncluded:
+				case compactChildHash:
+					if pos+hash.Size > len(data) {
+						return nil, errMalformedCompactProof
+					}
+					var h hash.Hash
+					if err = h.UnmarshalBinary(data[pos : pos+hash.Size]); err != nil {
+						return nil, err
+					}
+					pos += hash.Size
+					children[i] = &node.Pointer{Clean: true, Hash: h}
+				default:
+					return nil, errMalformedCompactProof
+				}
+			}
+			// The right child was added last.
+			for i := len(kinds) - 1; i >= 0; i-- {
+				if kinds[i] != compactChildIncluded {
+					continue
+				}
+				if len(stack) == 0 {
+					return nil, errMalformedCompactProof
+				}
+				children[i] = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+			nd.Left, nd.Right = children[0], children[1]
+
+			// Recompute hash as hashes were not recomputed for compact encoding.
+			node.UpdateDecodedHash(nd, pv.Domain)
+		}
+
+		stack = append(stack, &node.Pointer{Clean: true, Hash: nd.GetHash(), Node: nd})
+	}
+	if len(stack) != 1 {
+		return nil, errMalformedCompactProof
+	}
+	return stack[0], nil
+}
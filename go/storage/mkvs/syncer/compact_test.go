@@ -0,0 +1,52 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+func TestCompactProofMalformed(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	var pv ProofVerifier
+
+	leaf := node.LeafNode{Key: node.Key("key"), Value: []byte("value")}
+	leaf.UpdateHash()
+	leafData, err := leaf.CompactMarshalBinary()
+	require.NoError(err, "CompactMarshalBinary")
+	root := leaf.GetHash()
+
+	valid := append([]byte{compactRootNode, byte(len(leafData))}, leafData...)
+	_, err = pv.VerifyProof(ctx, root, &Proof{UntrustedRoot: root, Compact: valid})
+	require.NoError(err, "VerifyProof should not fail with a valid compact proof")
+
+	var emptyRoot hash.Hash
+	emptyRoot.Empty()
+	ptr, err := pv.VerifyProof(ctx, emptyRoot, &Proof{UntrustedRoot: emptyRoot, Compact: []byte{compactRootEmpty}})
+	require.NoError(err, "VerifyProof should not fail with a valid compact proof for an empty root")
+	require.Nil(ptr, "VerifyProof should return nil pointer for an empty root")
+
+	for _, tc := range []struct {
+		name  string
+		proof Proof
+	}{
+		{"BothEncodings", Proof{Entries: [][]byte{nil}, Compact: valid}},
+		{"UnknownRootType", Proof{Compact: []byte{0xaa}}},
+		{"TrailingEmptyRoot", Proof{Compact: []byte{compactRootEmpty, 0x00}}},
+		{"TruncatedRootHash", Proof{Compact: append([]byte{compactRootHash}, root[:10]...)}},
+		{"TruncatedNode", Proof{Compact: valid[:len(valid)-1]}},
+		{"MissingNode", Proof{Compact: []byte{compactRootNode}}},
+		{"TrailingNode", Proof{Compact: append(append([]byte{}, valid...), valid[1:]...)}},
+		{"BadLength", Proof{Compact: []byte{compactRootNode, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}}},
+	} {
+		tc.proof.UntrustedRoot = root
+		_, err = pv.VerifyProof(ctx, root, &tc.proof)
+		require.Error(err, "VerifyProof should fail with a malformed compact proof (%s)", tc.name)
+	}
+}
@@ -0,0 +1,191 @@
+package syncer
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+)
+
+var (
+	dedupLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oasis_storage_mkvs_syncer_dedup_lookups",
+			Help: "Number of deduplicating read syncer cache lookups.",
+		},
+		[]string{"result"},
+	)
+	dedupCacheSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "oasis_storage_mkvs_syncer_dedup_cache_bytes",
+			Help: "Total size of responses held in the deduplicating read syncer cache.",
+		},
+	)
+
+	dedupCollectors = []prometheus.Collector{
+		dedupLookups,
+		dedupCacheSize,
+	}
+
+	dedupHits   = dedupLookups.With(prometheus.Labels{"result": "hit"})
+	dedupMisses = dedupLookups.With(prometheus.Labels{"result": "miss"})
+
+	dedupMetricsOnce sync.Once
+)
+
+// DedupConfig is the configuration of a deduplicating read syncer.
+type DedupConfig struct {
+	// TTL is the duration for which a response is served from the cache.
+	TTL time.Duration
+	// MaxBytes is the maximum total size of the (serialized) cached responses. When the limit is
+	// exceeded, the oldest responses are evicted first.
+	MaxBytes uint64
+
+	// Now is the function used to obtain the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+type dedupEntry struct {
+	key       hash.Hash
+	rsp       *ProofResponse
+	size      uint64
+	expiresAt time.Time
+}
+
+// DedupSyncer is a ReadSyncer which caches responses of the inner read syncer for a short time
+// and serves identical requests from the cache.
+//
+// This is safe as responses are deterministic for a given root. Errors are never cached. Note
+// that cached responses are shared between callers and must not be modified.
+type DedupSyncer struct {
+	l sync.Mutex
+
+	rs  ReadSyncer
+	cfg DedupConfig
+
+	entries map[hash.Hash]*list.Element
+	lru     *list.List
+	size    uint64
+}
+
+// NewDedupSyncer creates a new read syncer which deduplicates identical requests to the given
+// read syncer within the configured TTL.
+func NewDedupSyncer(rs ReadSyncer, cfg DedupConfig) *DedupSyncer {
+	dedupMetricsOnce.Do(func() {
+		prometheus.MustRegister(dedupCollectors...)
+	})
+
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	return &DedupSyncer{
+		rs:      rs,
+		cfg:     cfg,
+		entries: make(map[hash.Hash]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func dedupKey(method string, request interface{}) hash.Hash {
+	// Requests include the tree root so the canonical encoding of the request identifies the
+	// response.
+	return hash.NewFromBytes([]byte(method), cbor.Marshal(request))
+}
+
+func (s *DedupSyncer) removeLocked(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*dedupEntry)
+	delete(s.entries, entry.key)
+	s.size -= entry.size
+}
+
+func (s *DedupSyncer) lookup(key hash.Hash) *ProofResponse {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*dedupEntry)
+	if !s.cfg.Now().Before(entry.expiresAt) {
+		s.removeLocked(elem)
+		dedupCacheSize.Sub(float64(entry.size))
+		return nil
+	}
+	return entry.rsp
+}
+
+func (s *DedupSyncer) insert(key hash.Hash, rsp *ProofResponse) {
+	size := uint64(len(cbor.Marshal(rsp)))
+	if size > s.cfg.MaxBytes {
+		return
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	oldSize := s.size
+	if elem, ok := s.entries[key]; ok {
+		s.removeLocked(elem)
+	}
+
+	// Evict expired entries and then the oldest entries until the new response fits. As all
+	// entries share the same TTL, the oldest entries are also the first to expire.
+	now := s.cfg.Now()
+	for elem := s.lru.Front(); elem != nil; elem = s.lru.Front() {
+		entry := elem.Value.(*dedupEntry)
+		if now.Before(entry.expiresAt) && s.size+size <= s.cfg.MaxBytes {
+			break
+		}
+		s.removeLocked(elem)
+	}
+
+	s.entries[key] = s.lru.PushBack(&dedupEntry{
+		key:       key,
+		rsp:       rsp,
+		size:      size,
+		expiresAt: now.Add(s.cfg.TTL),
+	})
+	s.size += size
+	dedupCacheSize.Add(float64(s.size) - float64(oldSize))
+}
+
+func (s *DedupSyncer) dedup(method string, request interface{}, fn func() (*ProofResponse, error)) (*ProofResponse, error) {
+	key := dedupKey(method, request)
+	if rsp := s.lookup(key); rsp != nil {
+		dedupHits.Inc()
+		return rsp, nil
+	}
+	dedupMisses.Inc()
+
+	rsp, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	s.insert(key, rsp)
+	return rsp, nil
+}
+
+func (s *DedupSyncer) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	return s.dedup("SyncGet", request, func() (*ProofResponse, error) {
+		return s.rs.SyncGet(ctx, request)
+	})
+}
+
+func (s *DedupSyncer) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	return s.dedup("SyncGetPrefixes", request, func() (*ProofResponse, error) {
+		return s.rs.SyncGetPrefixes(ctx, request)
+	})
+}
+
+func (s *DedupSyncer) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	return s.dedup("SyncIterate", request, func() (*ProofResponse, error) {
+		return s.rs.SyncIterate(ctx, request)
+	})
+}
@@ -0,0 +1,84 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+func TestDedupSyncer(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	now := time.Unix(1580461674, 0)
+	backend := &recordingSyncer{response: newTestResponse()}
+	rs := NewDedupSyncer(backend, DedupConfig{
+		TTL:      time.Second,
+		MaxBytes: 1024,
+		Now:      func() time.Time { return now },
+	})
+
+	request := &GetPrefixesRequest{
+		Tree: TreeID{
+			Root:     node.Root{Version: 1, Type: node.RootTypeState, Hash: backend.response.Proof.UntrustedRoot},
+			Position: backend.response.Proof.UntrustedRoot,
+		},
+		Prefixes: [][]byte{[]byte("prefix")},
+		Limit:    10,
+	}
+	for i := 0; i < 3; i++ {
+		rsp, err := rs.SyncGetPrefixes(ctx, request)
+		require.NoError(err, "SyncGetPrefixes")
+		require.Equal(backend.response, rsp, "SyncGetPrefixes should return the backend response")
+	}
+	require.Len(backend.requests, 1, "identical requests should only be forwarded once")
+
+	// Requests that differ in any field or in the method should not be deduplicated.
+	otherRequest := *request
+	otherRequest.Limit = 11
+	_, err := rs.SyncGetPrefixes(ctx, &otherRequest)
+	require.NoError(err, "SyncGetPrefixes")
+	_, err = rs.SyncIterate(ctx, &IterateRequest{Tree: request.Tree})
+	require.NoError(err, "SyncIterate")
+	require.Len(backend.requests, 3, "different requests should be forwarded")
+
+	// Once the TTL expires, the response should be recomputed.
+	now = now.Add(time.Second)
+	_, err = rs.SyncGetPrefixes(ctx, request)
+	require.NoError(err, "SyncGetPrefixes")
+	require.Len(backend.requests, 4, "requests should be forwarded after the TTL expires")
+	_, err = rs.SyncGetPrefixes(ctx, request)
+	require.NoError(err, "SyncGetPrefixes")
+	require.Len(backend.requests, 4, "recomputed response should be cached")
+}
+
+func TestDedupSyncerMaxBytes(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	backend := &recordingSyncer{response: newTestResponse()}
+	rspSize := uint64(len(cbor.Marshal(backend.response)))
+
+	// Responses larger than the cap should never be cached.
+	rs := NewDedupSyncer(backend, DedupConfig{TTL: time.Minute, MaxBytes: rspSize - 1})
+	for i := 0; i < 2; i++ {
+		_, err := rs.SyncGet(ctx, &GetRequest{Key: []byte("key")})
+		require.NoError(err, "SyncGet")
+	}
+	require.Len(backend.requests, 2, "oversized responses should not be cached")
+
+	// When the cap is reached, the oldest response should be evicted.
+	backend.requests = nil
+	rs = NewDedupSyncer(backend, DedupConfig{TTL: time.Minute, MaxBytes: 2 * rspSize})
+	for _, key := range []string{"key1", "key2", "key3", "key3", "key2", "key1"} {
+		_, err := rs.SyncGet(ctx, &GetRequest{Key: []byte(key)})
+		require.NoError(err, "SyncGet")
+	}
+	require.Len(backend.requests, 4, "oldest response should be evicted")
+	require.EqualValues(2*rspSize, rs.size, "cache size should be accounted")
+}
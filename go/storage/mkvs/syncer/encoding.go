@@ -0,0 +1,86 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+// ProvenKeyValue is a key/value pair whose inclusion in a tree has been proven.
+type ProvenKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// EncodeProofResponse serializes a proof response into its canonical CBOR wire encoding.
+//
+// The encoding is a CBOR map with a single "proof" key holding the proof. The proof is a CBOR map
+// with the following keys:
+//
+//   - "untrusted_root" is a 32-byte byte string containing the root hash the proof claims to be
+//     for.
+//   - "entries" is an array of proof entries in pre-order traversal of the proven subtree. Each
+//     entry is either null (an empty subtree), a byte string starting with 0x01 followed by the
+//     compact binary encoding of a full node (see node.Node.CompactMarshalBinary) or a byte string
+//     starting with 0x02 followed by the 32-byte hash of a subtree that is not part of the proof.
+//     Entries for the left and right children of an included internal node immediately follow the
+//     entry for that node.
+//   - "compact" is only present in proofs using the compact proof encoding, available since
+//     ProtocolVersion3, in which case "entries" is empty. It is a byte string containing the
+//     proof as described in ProofBuilder.BuildCompact.
+//
+// Since proofs are verified against root hashes, this encoding must remain stable.
+func EncodeProofResponse(rsp *ProofResponse) []byte {
+	return cbor.Marshal(rsp)
+}
+
+// DecodeProofResponse deserializes a proof response from its CBOR wire encoding as produced by
+// EncodeProofResponse.
+//
+// Note that decoding does not verify the proof, use VerifyProofResponse for that.
+func DecodeProofResponse(data []byte) (*ProofResponse, error) {
+	var rsp ProofResponse
+	if err := cbor.Unmarshal(data, &rsp); err != nil {
+		return nil, fmt.Errorf("syncer: malformed proof response: %w", err)
+	}
+	return &rsp, nil
+}
+
+// VerifyProofResponse verifies the proof contained in the given proof response against an
+// independently obtained root and returns all key/value pairs included in the proof in key
+// order. The proof is verified in the hash domain of the root.
+//
+// This can be used to check proofs without instantiating a tree.
+func VerifyProofResponse(ctx context.Context, root node.Root, rsp *ProofResponse) ([]ProvenKeyValue, error) {
+	pv := ProofVerifier{Domain: root.HashDomain()}
+	ptr, err := pv.VerifyProof(ctx, root.Hash, &rsp.Proof)
+	if err != nil {
+		return nil, err
+	}
+
+	var kvs []ProvenKeyValue
+	collectProvenKeyValues(ptr, &kvs)
+	return kvs, nil
+}
+
+func collectProvenKeyValues(ptr *node.Pointer, kvs *[]ProvenKeyValue) {
+	if ptr == nil || ptr.Node == nil {
+		return
+	}
+
+	switch n := ptr.Node.(type) {
+	case *node.InternalNode:
+		// The leaf node of an internal node has the shortest key in the subtree, so visiting it
+		// first results in key order.
+		collectProvenKeyValues(n.LeafNode, kvs)
+		collectProvenKeyValues(n.Left, kvs)
+		collectProvenKeyValues(n.Right, kvs)
+	case *node.LeafNode:
+		*kvs = append(*kvs, ProvenKeyValue{
+			Key:   n.Key,
+			Value: n.Value,
+		})
+	}
+}
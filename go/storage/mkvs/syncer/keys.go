@@ -0,0 +1,51 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+// MaxKeySize is the maximum size of keys (in bytes) that are accepted in read syncer requests.
+const MaxKeySize = 4096
+
+// ErrKeyTooLarge is the error returned when a key exceeds the maximum key size.
+var ErrKeyTooLarge = errors.New("mkvs: key too large")
+
+// CheckKeySize returns an error wrapping ErrKeyTooLarge in case the given key is larger than
+// maxKeySize bytes. A maxKeySize of zero disables the check.
+func CheckKeySize(key []byte, maxKeySize int) error {
+	if maxKeySize > 0 && len(key) > maxKeySize {
+		return fmt.Errorf("%w: %d bytes exceeds maximum of %d bytes", ErrKeyTooLarge, len(key), maxKeySize)
+	}
+	return nil
+}
+
+// UnmarshalCBOR decodes a CBOR marshalled get request, rejecting keys larger than MaxKeySize.
+func (r *GetRequest) UnmarshalCBOR(data []byte) error {
+	type gr GetRequest
+	if err := cbor.Unmarshal(data, (*gr)(r)); err != nil {
+		return err
+	}
+
+	if err := CheckKeySize(r.Key, MaxKeySize); err != nil {
+		return err
+	}
+	for _, key := range r.Keys {
+		if err := CheckKeySize(key, MaxKeySize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalCBOR decodes a CBOR marshalled iterate request, rejecting keys larger than MaxKeySize.
+func (r *IterateRequest) UnmarshalCBOR(data []byte) error {
+	type ir IterateRequest
+	if err := cbor.Unmarshal(data, (*ir)(r)); err != nil {
+		return err
+	}
+
+	return CheckKeySize(r.Key, MaxKeySize)
+}
@@ -0,0 +1,39 @@
+package syncer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+func TestKeySize(t *testing.T) {
+	require := require.New(t)
+
+	atLimit := bytes.Repeat([]byte{0x42}, MaxKeySize)
+	overLimit := bytes.Repeat([]byte{0x42}, MaxKeySize+1)
+
+	require.NoError(CheckKeySize(atLimit, MaxKeySize), "keys at the limit should be allowed")
+	require.ErrorIs(CheckKeySize(overLimit, MaxKeySize), ErrKeyTooLarge, "keys over the limit should be rejected")
+	require.NoError(CheckKeySize(overLimit, 0), "zero maximum key size should disable the check")
+
+	var getRq GetRequest
+	err := cbor.Unmarshal(cbor.Marshal(&GetRequest{Key: atLimit, Keys: [][]byte{atLimit}}), &getRq)
+	require.NoError(err, "GetRequest with keys at the limit should decode")
+	require.Equal(atLimit, getRq.Key, "decoded key")
+	require.Equal([][]byte{atLimit}, getRq.Keys, "decoded keys")
+	err = cbor.Unmarshal(cbor.Marshal(&GetRequest{Key: overLimit}), &getRq)
+	require.ErrorIs(err, ErrKeyTooLarge, "GetRequest with an oversized key should be rejected")
+	err = cbor.Unmarshal(cbor.Marshal(&GetRequest{Key: atLimit, Keys: [][]byte{[]byte("key"), overLimit}}), &getRq)
+	require.ErrorIs(err, ErrKeyTooLarge, "GetRequest with an oversized additional key should be rejected")
+
+	var itRq IterateRequest
+	err = cbor.Unmarshal(cbor.Marshal(&IterateRequest{Key: atLimit, Prefetch: 10}), &itRq)
+	require.NoError(err, "IterateRequest with a key at the limit should decode")
+	require.Equal(atLimit, itRq.Key, "decoded key")
+	require.EqualValues(10, itRq.Prefetch, "decoded prefetch")
+	err = cbor.Unmarshal(cbor.Marshal(&IterateRequest{Key: overLimit}), &itRq)
+	require.ErrorIs(err, ErrKeyTooLarge, "IterateRequest with an oversized key should be rejected")
+}
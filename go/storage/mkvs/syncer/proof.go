@@ -24,6 +24,11 @@ type Proof struct {
 	UntrustedRoot hash.Hash `json:"untrusted_root"`
 	// Entries are the proof entries in pre-order traversal.
 	Entries [][]byte `json:"entries"`
+	// Compact is the proof in the compact proof encoding (see ProofBuilder.BuildCompact), in
+	// which case there are no entries.
+	//
+	// Requires at least ProtocolVersion3.
+	Compact []byte `json:"compact,omitempty"`
 }
 
 type proofNode struct {
@@ -113,22 +118,25 @@ func (b *ProofBuilder) Size() uint64 {
 
 // Build tries to build the proof.
 func (b *ProofBuilder) Build(ctx context.Context) (*Proof, error) {
-	var proof Proof
-	switch b.HasSubtreeRoot() {
-	case true:
-		// A partial proof for the subtree is available, include that.
-		proof.UntrustedRoot = b.subtree
-	case false:
-		// No partial proof available, we need to use the tree root.
-		proof.UntrustedRoot = b.root
+	proof := Proof{
+		UntrustedRoot: b.proofRoot(),
 	}
-
 	if err := b.build(ctx, &proof, proof.UntrustedRoot); err != nil {
 		return nil, err
 	}
 	return &proof, nil
 }
 
+// proofRoot returns the root hash the proof should be anchored at.
+func (b *ProofBuilder) proofRoot() hash.Hash {
+	if b.HasSubtreeRoot() {
+		// A partial proof for the subtree is available, include that.
+		return b.subtree
+	}
+	// No partial proof available, we need to use the tree root.
+	return b.root
+}
+
 func (b *ProofBuilder) build(ctx context.Context, proof *Proof, h hash.Hash) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -164,7 +172,11 @@ func (b *ProofBuilder) build(ctx context.Context, proof *Proof, h hash.Hash) err
 }
 
 // ProofVerifier enables verifying proofs returned by the ReadSyncer API.
-type ProofVerifier struct{}
+type ProofVerifier struct {
+	// Domain is the hash domain in which node hashes are recomputed during verification. It
+	// must match the hash mode and namespace of the root the proofs are for.
+	Domain node.HashDomain
+}
 
 // VerifyProof verifies a proof and generates an in-memory subtree representing
 // the nodes which are included in the proof.
@@ -177,11 +189,21 @@ func (pv *ProofVerifier) VerifyProof(ctx context.Context, root hash.Hash, proof
 			proof.UntrustedRoot,
 		)
 	}
-	if len(proof.Entries) == 0 {
+
+	var (
+		rootNode *node.Pointer
+		err      error
+	)
+	switch {
+	case len(proof.Compact) > 0 && len(proof.Entries) > 0:
+		return nil, errors.New("verifier: proof has both entries and a compact encoding")
+	case len(proof.Compact) > 0:
+		rootNode, err = pv.verifyCompactProof(ctx, proof.Compact)
+	case len(proof.Entries) == 0:
 		return nil, errors.New("verifier: empty proof")
+	default:
+		_, rootNode, err = pv.verifyProof(ctx, proof, 0)
 	}
-
-	_, rootNode, err := pv.verifyProof(ctx, proof, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -225,6 +247,12 @@ func (pv *ProofVerifier) verifyProof(ctx context.Context, proof *Proof, idx int)
 			return -1, nil, err
 		}
 
+		// Decoding computes hashes in the default hash domain. Hashes of internal nodes are
+		// recomputed below once their children are known.
+		if _, ok := n.(*node.LeafNode); ok && pv.Domain.Mode != node.HashModeDefault {
+			n.UpdateHashInDomain(pv.Domain)
+		}
+
 		// For internal nodes, also decode children.
 		pos := idx + 1
 		if nd, ok := n.(*node.InternalNode); ok {
@@ -240,7 +268,7 @@ func (pv *ProofVerifier) verifyProof(ctx context.Context, proof *Proof, idx int)
 			}
 
 			// Recompute hash as hashes were not recomputed for compact encoding.
-			nd.UpdateHash()
+			node.UpdateDecodedHash(nd, pv.Domain)
 		}
 
 		return pos, &node.Pointer{Clean: true, Hash: n.GetHash(), Node: n}, nil
@@ -1,9 +1,14 @@
 package syncer
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 // StatsCollector is a ReadSyncer which collects call statistics.
 type StatsCollector struct {
+	l sync.Mutex
+
 	SyncGetCount         int
 	SyncGetPrefixesCount int
 	SyncIterateCount     int
@@ -19,16 +24,22 @@ func NewStatsCollector(rs ReadSyncer) *StatsCollector {
 }
 
 func (c *StatsCollector) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	c.l.Lock()
 	c.SyncGetCount++
+	c.l.Unlock()
 	return c.rs.SyncGet(ctx, request)
 }
 
 func (c *StatsCollector) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	c.l.Lock()
 	c.SyncGetPrefixesCount++
+	c.l.Unlock()
 	return c.rs.SyncGetPrefixes(ctx, request)
 }
 
 func (c *StatsCollector) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	c.l.Lock()
 	c.SyncIterateCount++
+	c.l.Unlock()
 	return c.rs.SyncIterate(ctx, request)
 }
@@ -31,13 +31,24 @@ type TreeID struct {
 
 // GetRequest is a request for the SyncGet operation.
 type GetRequest struct {
+	// Version is the latest protocol version supported by the client.
+	Version uint16 `json:"version,omitempty"`
+
 	Tree            TreeID `json:"tree"`
 	Key             []byte `json:"key"`
 	IncludeSiblings bool   `json:"include_siblings,omitempty"`
+
+	// Keys are additional keys to fetch in the same request.
+	//
+	// Requires at least ProtocolVersion2.
+	Keys [][]byte `json:"keys,omitempty"`
 }
 
 // GetPrefixesRequest is a request for the SyncGetPrefixes operation.
 type GetPrefixesRequest struct {
+	// Version is the latest protocol version supported by the client.
+	Version uint16 `json:"version,omitempty"`
+
 	Tree     TreeID   `json:"tree"`
 	Prefixes [][]byte `json:"prefixes"`
 	Limit    uint16   `json:"limit"`
@@ -45,6 +56,9 @@ type GetPrefixesRequest struct {
 
 // IterateRequest is a request for the SyncIterate operation.
 type IterateRequest struct {
+	// Version is the latest protocol version supported by the client.
+	Version uint16 `json:"version,omitempty"`
+
 	Tree     TreeID `json:"tree"`
 	Key      []byte `json:"key"`
 	Prefetch uint16 `json:"prefetch"`
@@ -52,6 +66,9 @@ type IterateRequest struct {
 
 // ProofResponse is a response for requests that produce proofs.
 type ProofResponse struct {
+	// Version is the protocol version negotiated by the server.
+	Version uint16 `json:"version,omitempty"`
+
 	Proof Proof `json:"proof"`
 }
 
@@ -0,0 +1,92 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ProtocolVersion1 is the initial read syncer protocol version. Requests and responses without
+	// an explicit protocol version use this version.
+	ProtocolVersion1 uint16 = 1
+	// ProtocolVersion2 adds support for fetching multiple keys in a single SyncGet request.
+	ProtocolVersion2 uint16 = 2
+	// ProtocolVersion3 adds support for the compact proof encoding in responses.
+	ProtocolVersion3 uint16 = 3
+
+	// LatestProtocolVersion is the latest supported read syncer protocol version.
+	LatestProtocolVersion = ProtocolVersion3
+	// MinProtocolVersion is the oldest supported read syncer protocol version.
+	MinProtocolVersion = ProtocolVersion1
+)
+
+var (
+	// ErrUnsupportedVersion is the error returned when the peer only supports read syncer protocol
+	// versions that are older than the oldest supported version.
+	ErrUnsupportedVersion = errors.New("mkvs: unsupported read syncer protocol version")
+	// ErrFeatureNotNegotiated is the error returned when a request uses a feature that is not
+	// available in the negotiated read syncer protocol version.
+	ErrFeatureNotNegotiated = errors.New("mkvs: feature not available in negotiated protocol version")
+)
+
+// VersionError is the error returned when the peer only supports read syncer protocol versions
+// that are older than the oldest supported version.
+type VersionError struct {
+	// PeerVersion is the latest protocol version supported by the peer.
+	PeerVersion uint16
+	// MinVersion is the oldest protocol version supported locally.
+	MinVersion uint16
+}
+
+// Error returns a string representation of the error.
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s: peer version %d is older than the oldest supported version %d",
+		ErrUnsupportedVersion, e.PeerVersion, e.MinVersion,
+	)
+}
+
+// Unwrap returns the underlying error.
+func (e *VersionError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+// NegotiateVersion returns the read syncer protocol version to use when talking to a peer which
+// supports protocol versions up to peerVersion, given that protocol versions in the range
+// [minVersion, latestVersion] are supported locally. A peerVersion of zero means that the peer
+// predates version negotiation and is treated as ProtocolVersion1.
+//
+// The negotiated version is the lower of the two latest versions. In case it is below minVersion,
+// a *VersionError is returned.
+func NegotiateVersion(minVersion, latestVersion, peerVersion uint16) (uint16, error) {
+	if peerVersion == 0 {
+		peerVersion = ProtocolVersion1
+	}
+	if peerVersion < minVersion {
+		return 0, &VersionError{PeerVersion: peerVersion, MinVersion: minVersion}
+	}
+	if peerVersion > latestVersion {
+		return latestVersion, nil
+	}
+	return peerVersion, nil
+}
+
+// ResponseVersion returns the protocol version that should be included in the response to a
+// request with the given protocol version, after the given version has been negotiated.
+//
+// Requests without an explicit protocol version come from peers that predate version
+// negotiation, so their responses must not include one either.
+func ResponseVersion(requestVersion, negotiatedVersion uint16) uint16 {
+	if requestVersion == 0 {
+		return 0
+	}
+	return negotiatedVersion
+}
+
+// CheckVersion checks that the request only uses features available in the given protocol
+// version.
+func (r *GetRequest) CheckVersion(version uint16) error {
+	if len(r.Keys) > 0 && version < ProtocolVersion2 {
+		return fmt.Errorf("%w: multi-key requests require version %d", ErrFeatureNotNegotiated, ProtocolVersion2)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package syncer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	require := require.New(t)
+
+	for _, tc := range []struct {
+		minVersion    uint16
+		latestVersion uint16
+		peerVersion   uint16
+		expected      uint16
+	}{
+		{ProtocolVersion1, ProtocolVersion2, 0, ProtocolVersion1},
+		{ProtocolVersion1, ProtocolVersion2, ProtocolVersion1, ProtocolVersion1},
+		{ProtocolVersion1, ProtocolVersion2, ProtocolVersion2, ProtocolVersion2},
+		{ProtocolVersion1, ProtocolVersion2, ProtocolVersion2 + 1, ProtocolVersion2},
+		{ProtocolVersion1, ProtocolVersion3, ProtocolVersion2, ProtocolVersion2},
+		{ProtocolVersion1, ProtocolVersion3, ProtocolVersion3, ProtocolVersion3},
+		{ProtocolVersion1, ProtocolVersion1, ProtocolVersion2, ProtocolVersion1},
+	} {
+		version, err := NegotiateVersion(tc.minVersion, tc.latestVersion, tc.peerVersion)
+		require.NoError(err, "NegotiateVersion(%d, %d, %d)", tc.minVersion, tc.latestVersion, tc.peerVersion)
+		require.Equal(tc.expected, version, "NegotiateVersion(%d, %d, %d)", tc.minVersion, tc.latestVersion, tc.peerVersion)
+	}
+
+	_, err := NegotiateVersion(ProtocolVersion2, ProtocolVersion2, 0)
+	require.ErrorIs(err, ErrUnsupportedVersion, "NegotiateVersion should fail for peers predating the minimum version")
+	var versionErr *VersionError
+	require.True(errors.As(err, &versionErr), "error should be a version error")
+	require.Equal(ProtocolVersion1, versionErr.PeerVersion, "peer version")
+	require.Equal(ProtocolVersion2, versionErr.MinVersion, "minimum version")
+
+	require.Zero(ResponseVersion(0, ProtocolVersion1), "legacy requests should get legacy responses")
+	require.Equal(ProtocolVersion1, ResponseVersion(ProtocolVersion2, ProtocolVersion1), "response version")
+
+	rq := GetRequest{Keys: [][]byte{[]byte("key")}}
+	require.ErrorIs(rq.CheckVersion(ProtocolVersion1), ErrFeatureNotNegotiated, "multi-key requests need version 2")
+	require.NoError(rq.CheckVersion(ProtocolVersion2), "multi-key requests should be allowed with version 2")
+}
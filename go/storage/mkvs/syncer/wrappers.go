@@ -0,0 +1,141 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+// ErrorSyncer is a ReadSyncer which fails every request with a fixed error.
+type ErrorSyncer struct {
+	err error
+}
+
+// NewErrorSyncer creates a new read syncer which fails every request with the given error.
+func NewErrorSyncer(err error) *ErrorSyncer {
+	return &ErrorSyncer{
+		err: err,
+	}
+}
+
+func (s *ErrorSyncer) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	return nil, s.err
+}
+
+func (s *ErrorSyncer) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	return nil, s.err
+}
+
+func (s *ErrorSyncer) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	return nil, s.err
+}
+
+// DelaySyncer is a ReadSyncer which delays every request to the inner read syncer by a fixed
+// duration.
+//
+// In case the context is canceled while waiting, the request fails with the context's error and
+// is not forwarded.
+type DelaySyncer struct {
+	rs    ReadSyncer
+	delay time.Duration
+}
+
+// NewDelaySyncer creates a new read syncer which delays every request to the given read syncer
+// by the given duration.
+func NewDelaySyncer(rs ReadSyncer, delay time.Duration) *DelaySyncer {
+	return &DelaySyncer{
+		rs:    rs,
+		delay: delay,
+	}
+}
+
+func (s *DelaySyncer) wait(ctx context.Context) error {
+	timer := time.NewTimer(s.delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *DelaySyncer) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.rs.SyncGet(ctx, request)
+}
+
+func (s *DelaySyncer) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.rs.SyncGetPrefixes(ctx, request)
+}
+
+func (s *DelaySyncer) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.rs.SyncIterate(ctx, request)
+}
+
+// SerializingSyncer is a ReadSyncer which passes all requests and responses to and from the inner
+// read syncer through a CBOR round trip, as if they were sent over the wire.
+type SerializingSyncer struct {
+	rs ReadSyncer
+}
+
+// NewSerializingSyncer creates a new read syncer which serializes all requests and responses to
+// and from the given read syncer.
+func NewSerializingSyncer(rs ReadSyncer) *SerializingSyncer {
+	return &SerializingSyncer{
+		rs: rs,
+	}
+}
+
+func roundTrip(src, dst interface{}) error {
+	return cbor.Unmarshal(cbor.Marshal(src), dst)
+}
+
+func (s *SerializingSyncer) forward(
+	request, decodedRequest interface{},
+	fn func() (*ProofResponse, error),
+) (*ProofResponse, error) {
+	if err := roundTrip(request, decodedRequest); err != nil {
+		return nil, err
+	}
+	rsp, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	var decodedRsp ProofResponse
+	if err = roundTrip(rsp, &decodedRsp); err != nil {
+		return nil, err
+	}
+	return &decodedRsp, nil
+}
+
+func (s *SerializingSyncer) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	var rq GetRequest
+	return s.forward(request, &rq, func() (*ProofResponse, error) {
+		return s.rs.SyncGet(ctx, &rq)
+	})
+}
+
+func (s *SerializingSyncer) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	var rq GetPrefixesRequest
+	return s.forward(request, &rq, func() (*ProofResponse, error) {
+		return s.rs.SyncGetPrefixes(ctx, &rq)
+	})
+}
+
+func (s *SerializingSyncer) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	var rq IterateRequest
+	return s.forward(request, &rq, func() (*ProofResponse, error) {
+		return s.rs.SyncIterate(ctx, &rq)
+	})
+}
@@ -0,0 +1,142 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+)
+
+// recordingSyncer is a read syncer which records all requests and returns a fixed response.
+type recordingSyncer struct {
+	requests []interface{}
+	response *ProofResponse
+}
+
+func (s *recordingSyncer) SyncGet(ctx context.Context, request *GetRequest) (*ProofResponse, error) {
+	s.requests = append(s.requests, request)
+	return s.response, nil
+}
+
+func (s *recordingSyncer) SyncGetPrefixes(ctx context.Context, request *GetPrefixesRequest) (*ProofResponse, error) {
+	s.requests = append(s.requests, request)
+	return s.response, nil
+}
+
+func (s *recordingSyncer) SyncIterate(ctx context.Context, request *IterateRequest) (*ProofResponse, error) {
+	s.requests = append(s.requests, request)
+	return s.response, nil
+}
+
+// syncAll performs a request of each kind and returns the responses and errors.
+func syncAll(ctx context.Context, rs ReadSyncer) ([]*ProofResponse, []error) {
+	var (
+		rsps []*ProofResponse
+		errs []error
+	)
+	for _, fn := range []func() (*ProofResponse, error){
+		func() (*ProofResponse, error) {
+			return rs.SyncGet(ctx, &GetRequest{Key: []byte("key"), IncludeSiblings: true})
+		},
+		func() (*ProofResponse, error) {
+			return rs.SyncGetPrefixes(ctx, &GetPrefixesRequest{Prefixes: [][]byte{[]byte("prefix")}, Limit: 10})
+		},
+		func() (*ProofResponse, error) {
+			return rs.SyncIterate(ctx, &IterateRequest{Key: []byte("key"), Prefetch: 10})
+		},
+	} {
+		rsp, err := fn()
+		rsps = append(rsps, rsp)
+		errs = append(errs, err)
+	}
+	return rsps, errs
+}
+
+func newTestResponse() *ProofResponse {
+	return &ProofResponse{
+		Proof: Proof{
+			UntrustedRoot: hash.NewFromBytes([]byte("root")),
+			Entries:       [][]byte{{0x01, 0x02}, {0x03}},
+		},
+	}
+}
+
+func TestNopReadSyncer(t *testing.T) {
+	_, errs := syncAll(context.Background(), NopReadSyncer)
+	for _, err := range errs {
+		require.ErrorIs(t, err, ErrUnsupported, "all requests should fail with ErrUnsupported")
+	}
+}
+
+func TestErrorSyncer(t *testing.T) {
+	testErr := errors.New("test error")
+	rsps, errs := syncAll(context.Background(), NewErrorSyncer(testErr))
+	for i := range errs {
+		require.ErrorIs(t, errs[i], testErr, "all requests should fail with the given error")
+		require.Nil(t, rsps[i], "failed requests should not return a response")
+	}
+}
+
+func TestDelaySyncer(t *testing.T) {
+	require := require.New(t)
+
+	const delay = 10 * time.Millisecond
+	inner := &recordingSyncer{response: newTestResponse()}
+	rs := NewDelaySyncer(inner, delay)
+
+	start := time.Now()
+	rsps, errs := syncAll(context.Background(), rs)
+	require.GreaterOrEqual(time.Since(start), 3*delay, "requests should be delayed")
+	for i := range errs {
+		require.NoError(errs[i], "requests should succeed")
+		require.Equal(inner.response, rsps[i], "response should be forwarded")
+	}
+	require.Len(inner.requests, 3, "requests should be forwarded")
+
+	// Canceled requests should not be forwarded.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rs = NewDelaySyncer(inner, time.Hour)
+	_, errs = syncAll(ctx, rs)
+	for _, err := range errs {
+		require.ErrorIs(err, context.Canceled, "canceled requests should fail")
+	}
+	require.Len(inner.requests, 3, "canceled requests should not be forwarded")
+}
+
+func TestSerializingSyncer(t *testing.T) {
+	require := require.New(t)
+
+	inner := &recordingSyncer{response: newTestResponse()}
+	rs := NewSerializingSyncer(inner)
+
+	getRq := &GetRequest{Key: []byte("key"), IncludeSiblings: true}
+	rsp, err := rs.SyncGet(context.Background(), getRq)
+	require.NoError(err, "SyncGet")
+	require.Len(inner.requests, 1, "request should be forwarded")
+	require.Equal(getRq, inner.requests[0], "forwarded request should be equal")
+	require.NotSame(getRq, inner.requests[0], "forwarded request should be a copy")
+	require.Equal(inner.response.Proof.UntrustedRoot, rsp.Proof.UntrustedRoot, "response should be forwarded")
+	require.NotSame(inner.response, rsp, "response should be a copy")
+	require.Equal(inner.response.Proof.Entries, rsp.Proof.Entries, "response entries should be forwarded")
+	require.NotSame(&inner.response.Proof.Entries[0][0], &rsp.Proof.Entries[0][0], "response entries should be copied")
+
+	_, errs := syncAll(context.Background(), rs)
+	for _, err := range errs {
+		require.NoError(err, "requests should succeed")
+	}
+	require.Len(inner.requests, 4, "requests should be forwarded")
+	require.IsType(&GetPrefixesRequest{}, inner.requests[2], "request type should be preserved")
+	require.IsType(&IterateRequest{}, inner.requests[3], "request type should be preserved")
+
+	// Errors should be propagated.
+	testErr := errors.New("test error")
+	_, errs = syncAll(context.Background(), NewSerializingSyncer(NewErrorSyncer(testErr)))
+	for _, err := range errs {
+		require.ErrorIs(err, testErr, "errors should be propagated")
+	}
+}
@@ -1,9 +1,15 @@
 package mkvs
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -85,8 +91,7 @@ func TestProof(t *testing.T) {
 	require.EqualValues(leftIntNode1.Right.Hash[:], proof.Entries[3][1:], "fourth entry hash should be correct (root.left.left)")
 	require.EqualValues(rootIntNode.Right.Hash[:], proof.Entries[4][1:], "fifth entry hash should be correct (root.right)")
 
-	// Proof should be stable.
-	// TODO: Provide multiple test vectors.
+	// Proof should be stable. See syncer/testdata/proof_vectors.json for more test vectors.
 	testVectorProof := base64.StdEncoding.EncodeToString(cbor.Marshal(proof))
 	require.EqualValues(
 		"omdlbnRyaWVzhUoBASQAa2V5IDACRgEBAQAAAlghAsFltYRhD4dAwHOdOmEigY1r02pJH6InhiibKlh9neYlWCECpsJnkjOnIgc4+yfvpsqCcIYHh5eld1hNMWTT7arAfHFYIQLhNTLWRbks1RBf52ulnlOTO+7D5EZNMYFzTx8U46sCnm51bnRydXN0ZWRfcm9vdFggWeZ8L9wIuOEN0Iu2uO/mFPzJZey4liX5fxf4fwcQRhM=",
@@ -169,3 +174,596 @@ func copyProof(p *syncer.Proof) *syncer.Proof {
 	}
 	return &result
 }
+
+// versionedSyncer is a remote read syncer stub that only supports the given range of read syncer
+// protocol versions.
+type versionedSyncer struct {
+	l sync.Mutex
+
+	inner syncer.ReadSyncer
+
+	minVersion    uint16
+	latestVersion uint16
+
+	requests         int
+	multiKeyRequests int
+}
+
+func (s *versionedSyncer) SyncGet(ctx context.Context, request *syncer.GetRequest) (*syncer.ProofResponse, error) {
+	version, err := syncer.NegotiateVersion(s.minVersion, s.latestVersion, request.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	s.l.Lock()
+	s.requests++
+	rq := *request
+	if len(rq.Keys) > 0 {
+		s.multiKeyRequests++
+		if s.latestVersion < syncer.ProtocolVersion2 {
+			// Old servers do not know about multi-key requests.
+			rq.Keys = nil
+		}
+	}
+	s.l.Unlock()
+	// Make sure the inner read syncer uses the negotiated protocol version.
+	rq.Version = syncer.ResponseVersion(request.Version, version)
+	rsp, err := s.inner.SyncGet(ctx, &rq)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Version = syncer.ResponseVersion(request.Version, version)
+	return rsp, nil
+}
+
+func (s *versionedSyncer) SyncGetPrefixes(ctx context.Context, request *syncer.GetPrefixesRequest) (*syncer.ProofResponse, error) {
+	return nil, syncer.ErrUnsupported
+}
+
+func (s *versionedSyncer) SyncIterate(ctx context.Context, request *syncer.IterateRequest) (*syncer.ProofResponse, error) {
+	return nil, syncer.ErrUnsupported
+}
+
+func TestSyncerVersionNegotiation(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	keys, values := generateKeyValuePairsEx("", 50)
+	var ns common.Namespace
+
+	server := New(nil, nil, node.RootTypeState)
+	for i, key := range keys {
+		err := server.Insert(ctx, key, values[i])
+		require.NoError(err, "Insert")
+	}
+	_, rootHash, err := server.Commit(ctx, ns, 0)
+	require.NoError(err, "Commit")
+	root := node.Root{Namespace: ns, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+
+	newClient := func(rs syncer.ReadSyncer) *tree {
+		return NewWithRoot(rs, nil, root).(*tree)
+	}
+	requireValues := func(client *tree, rs *versionedSyncer) {
+		requests := rs.requests
+		for i, key := range keys {
+			value, err := client.Get(ctx, key)
+			require.NoError(err, "Get")
+			require.Equal(values[i], value, "Get should return the correct value")
+		}
+		require.Equal(requests, rs.requests, "prefetched keys should not be fetched again")
+	}
+
+	// A latest version client talking to an old server should fall back to per-key gets.
+	rs := &versionedSyncer{inner: server, minVersion: syncer.ProtocolVersion1, latestVersion: syncer.ProtocolVersion1}
+	client := newClient(rs)
+	err = client.PrefetchKeys(ctx, keys)
+	require.NoError(err, "PrefetchKeys")
+	require.Zero(rs.multiKeyRequests, "multi-key requests should not be used with old servers")
+	require.EqualValues(syncer.ProtocolVersion1, client.cache.syncVersion, "negotiated version")
+	requireValues(client, rs)
+	client.Close()
+
+	// A latest version client talking to a latest version server should use multi-key gets once
+	// the protocol version has been negotiated.
+	rs = &versionedSyncer{inner: server, minVersion: syncer.ProtocolVersion1, latestVersion: syncer.ProtocolVersion2}
+	client = newClient(rs)
+	err = client.PrefetchKeys(ctx, keys)
+	require.NoError(err, "PrefetchKeys")
+	require.Equal(2, rs.requests, "the first key should be fetched alone to negotiate the version")
+	require.Equal(1, rs.multiKeyRequests, "remaining keys should be fetched using a single request")
+	require.EqualValues(syncer.ProtocolVersion2, client.cache.syncVersion, "negotiated version")
+	requireValues(client, rs)
+	client.Close()
+
+	// A server which is downgraded after the version has been negotiated should be handled.
+	rs = &versionedSyncer{inner: server, minVersion: syncer.ProtocolVersion1, latestVersion: syncer.ProtocolVersion2}
+	client = newClient(rs)
+	_, err = client.Get(ctx, keys[0])
+	require.NoError(err, "Get")
+	rs.latestVersion = syncer.ProtocolVersion1
+	err = client.PrefetchKeys(ctx, keys[1:])
+	require.NoError(err, "PrefetchKeys")
+	require.Equal(1, rs.multiKeyRequests, "multi-key request should be attempted")
+	require.EqualValues(syncer.ProtocolVersion1, client.cache.syncVersion, "negotiated version")
+	requireValues(client, rs)
+	client.Close()
+
+	// A server which dropped support for all versions supported by the client should fail hard.
+	rs = &versionedSyncer{inner: server, minVersion: syncer.LatestProtocolVersion + 1, latestVersion: syncer.LatestProtocolVersion + 1}
+	client = newClient(rs)
+	_, err = client.Get(ctx, keys[0])
+	require.ErrorIs(err, syncer.ErrUnsupportedVersion, "Get should fail with unsupported servers")
+	var versionErr *syncer.VersionError
+	require.True(errors.As(err, &versionErr), "error should be a version error")
+	require.EqualValues(syncer.LatestProtocolVersion, versionErr.PeerVersion, "peer version")
+	client.Close()
+
+	// Servers should reject requests using features that have not been negotiated.
+	_, err = server.SyncGet(ctx, &syncer.GetRequest{
+		Version: syncer.ProtocolVersion1,
+		Tree:    syncer.TreeID{Root: root, Position: rootHash},
+		Key:     keys[0],
+		Keys:    keys[1:],
+	})
+	require.ErrorIs(err, syncer.ErrFeatureNotNegotiated, "SyncGet should fail for features that have not been negotiated")
+
+	// Requests from clients which predate version negotiation should be answered without one.
+	rsp, err := server.SyncGet(ctx, &syncer.GetRequest{
+		Tree: syncer.TreeID{Root: root, Position: rootHash},
+		Key:  keys[0],
+	})
+	require.NoError(err, "SyncGet")
+	require.Zero(rsp.Version, "response version for legacy requests")
+	rsp, err = server.SyncGet(ctx, &syncer.GetRequest{
+		Version: syncer.ProtocolVersion1,
+		Tree:    syncer.TreeID{Root: root, Position: rootHash},
+		Key:     keys[0],
+	})
+	require.NoError(err, "SyncGet")
+	require.EqualValues(syncer.ProtocolVersion1, rsp.Version, "response version")
+}
+
+// legacyGetRequest is the SyncGet request as decoded by servers which predate version
+// negotiation.
+type legacyGetRequest struct {
+	Tree            syncer.TreeID `json:"tree"`
+	Key             []byte        `json:"key"`
+	IncludeSiblings bool          `json:"include_siblings,omitempty"`
+}
+
+// legacyGetPrefixesRequest is the SyncGetPrefixes request as decoded by servers which predate
+// version negotiation.
+type legacyGetPrefixesRequest struct {
+	Tree     syncer.TreeID `json:"tree"`
+	Prefixes [][]byte      `json:"prefixes"`
+	Limit    uint16        `json:"limit"`
+}
+
+// legacyIterateRequest is the SyncIterate request as decoded by servers which predate version
+// negotiation.
+type legacyIterateRequest struct {
+	Tree     syncer.TreeID `json:"tree"`
+	Key      []byte        `json:"key"`
+	Prefetch uint16        `json:"prefetch"`
+}
+
+// legacySyncer is a remote read syncer stub which predates version negotiation and strictly
+// decodes requests, like servers receiving requests over the wire do.
+type legacySyncer struct {
+	inner syncer.ReadSyncer
+
+	requests         int
+	rejectedRequests int
+}
+
+func (s *legacySyncer) decode(request, legacyRequest interface{}) error {
+	s.requests++
+	if err := cbor.Unmarshal(cbor.Marshal(request), legacyRequest); err != nil {
+		s.rejectedRequests++
+		return err
+	}
+	return nil
+}
+
+func (s *legacySyncer) SyncGet(ctx context.Context, request *syncer.GetRequest) (*syncer.ProofResponse, error) {
+	var rq legacyGetRequest
+	if err := s.decode(request, &rq); err != nil {
+		return nil, err
+	}
+	return s.inner.SyncGet(ctx, &syncer.GetRequest{
+		Tree:            rq.Tree,
+		Key:             rq.Key,
+		IncludeSiblings: rq.IncludeSiblings,
+	})
+}
+
+func (s *legacySyncer) SyncGetPrefixes(ctx context.Context, request *syncer.GetPrefixesRequest) (*syncer.ProofResponse, error) {
+	var rq legacyGetPrefixesRequest
+	if err := s.decode(request, &rq); err != nil {
+		return nil, err
+	}
+	return s.inner.SyncGetPrefixes(ctx, &syncer.GetPrefixesRequest{
+		Tree:     rq.Tree,
+		Prefixes: rq.Prefixes,
+		Limit:    rq.Limit,
+	})
+}
+
+func (s *legacySyncer) SyncIterate(ctx context.Context, request *syncer.IterateRequest) (*syncer.ProofResponse, error) {
+	var rq legacyIterateRequest
+	if err := s.decode(request, &rq); err != nil {
+		return nil, err
+	}
+	return s.inner.SyncIterate(ctx, &syncer.IterateRequest{
+		Tree:     rq.Tree,
+		Key:      rq.Key,
+		Prefetch: rq.Prefetch,
+	})
+}
+
+func TestSyncerLegacyServer(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	keys, values := generateKeyValuePairsEx("", 50)
+	var ns common.Namespace
+
+	server := New(nil, nil, node.RootTypeState)
+	for i, key := range keys {
+		err := server.Insert(ctx, key, values[i])
+		require.NoError(err, "Insert")
+	}
+	_, rootHash, err := server.Commit(ctx, ns, 0)
+	require.NoError(err, "Commit")
+	root := node.Root{Namespace: ns, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+
+	// Versioned requests should be rejected by legacy servers.
+	rs := &legacySyncer{inner: server}
+	_, err = rs.SyncGet(ctx, &syncer.GetRequest{
+		Version: syncer.LatestProtocolVersion,
+		Tree:    syncer.TreeID{Root: root, Position: rootHash},
+		Key:     keys[0],
+	})
+	require.Error(err, "legacy servers should reject versioned requests")
+
+	// Lookups should fall back to unversioned requests once and keep using them.
+	rs = &legacySyncer{inner: server}
+	client := NewWithRoot(rs, nil, root).(*tree)
+	for i, key := range keys {
+		var value []byte
+		value, err = client.Get(ctx, key)
+		require.NoError(err, "Get")
+		require.Equal(values[i], value, "Get should return the correct value")
+	}
+	require.Equal(1, rs.rejectedRequests, "only the first versioned request should be rejected")
+	require.True(client.cache.syncLegacy, "server should be treated as a legacy server")
+	require.EqualValues(syncer.ProtocolVersion1, client.cache.syncVersion, "negotiated version")
+	client.Close()
+
+	// Prefetching keys should not use multi-key requests.
+	rs = &legacySyncer{inner: server}
+	client = NewWithRoot(rs, nil, root).(*tree)
+	err = client.PrefetchKeys(ctx, keys)
+	require.NoError(err, "PrefetchKeys")
+	require.Equal(1, rs.rejectedRequests, "only the first versioned request should be rejected")
+	requests := rs.requests
+	for i, key := range keys {
+		var value []byte
+		value, err = client.Get(ctx, key)
+		require.NoError(err, "Get")
+		require.Equal(values[i], value, "Get should return the correct value")
+	}
+	require.Equal(requests, rs.requests, "prefetched keys should not be fetched again")
+	client.Close()
+
+	// Prefix prefetches and iteration should also fall back.
+	rs = &legacySyncer{inner: server}
+	client = NewWithRoot(rs, nil, root).(*tree)
+	err = client.PrefetchPrefixes(ctx, [][]byte{[]byte("")}, 10)
+	require.NoError(err, "PrefetchPrefixes")
+	require.Equal(1, rs.rejectedRequests, "only the first versioned request should be rejected")
+	client.Close()
+
+	rs = &legacySyncer{inner: server}
+	client = NewWithRoot(rs, nil, root).(*tree)
+	it := client.NewIterator(ctx, IteratorPrefetch(10))
+	var numItems int
+	for it.Rewind(); it.Valid(); it.Next() {
+		numItems++
+	}
+	require.NoError(it.Err(), "iterator")
+	it.Close()
+	require.Equal(len(keys), numItems, "iterator should visit all keys")
+	require.Equal(1, rs.rejectedRequests, "only the first versioned request should be rejected")
+	client.Close()
+}
+
+func TestCoalescingSyncer(t *testing.T) {
+	require := require.New(t)
+
+	const numGets = 50
+	ctx := context.Background()
+	keys, values := generateKeyValuePairsEx("", numGets)
+	var ns common.Namespace
+
+	server := New(nil, nil, node.RootTypeState)
+	defer server.Close()
+	for i, key := range keys {
+		err := server.Insert(ctx, key, values[i])
+		require.NoError(err, "Insert")
+	}
+	_, rootHash, err := server.Commit(ctx, ns, 0)
+	require.NoError(err, "Commit")
+	root := node.Root{Namespace: ns, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+
+	// getAll concurrently looks up all keys, each using a separate tree backed by the given read
+	// syncer, and returns the lookup errors.
+	getAll := func(rs syncer.ReadSyncer, ctxs []context.Context) []error {
+		var wg sync.WaitGroup
+		errs := make([]error, len(keys))
+		for i := range keys {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				client := NewWithRoot(rs, nil, root)
+				defer client.Close()
+				value, err := client.Get(ctxs[i], keys[i])
+				if err == nil && !bytes.Equal(values[i], value) {
+					err = fmt.Errorf("unexpected value for key %d: %s", i, value)
+				}
+				errs[i] = err
+			}(i)
+		}
+		wg.Wait()
+		return errs
+	}
+	backgroundCtxs := make([]context.Context, len(keys))
+	for i := range backgroundCtxs {
+		backgroundCtxs[i] = ctx
+	}
+	newCoalescingSyncer := func(rs syncer.ReadSyncer, window time.Duration) *syncer.CoalescingSyncer {
+		cs, cerr := syncer.NewCoalescingSyncer(rs, syncer.CoalescingConfig{Window: window, MaxKeys: 2 * numGets})
+		require.NoError(cerr, "NewCoalescingSyncer")
+		return cs
+	}
+
+	_, err = syncer.NewCoalescingSyncer(server, syncer.CoalescingConfig{})
+	require.Error(err, "NewCoalescingSyncer should fail without a window")
+
+	// Without coalescing, each lookup needs its own request.
+	stats := syncer.NewStatsCollector(server)
+	for i, err := range getAll(stats, backgroundCtxs) {
+		require.NoError(err, "Get %d", i)
+	}
+	require.Equal(numGets, stats.SyncGetCount, "each lookup should need a request")
+
+	// With coalescing, concurrent lookups should share requests.
+	stats = syncer.NewStatsCollector(server)
+	for i, err := range getAll(newCoalescingSyncer(stats, 50*time.Millisecond), backgroundCtxs) {
+		require.NoError(err, "Get %d", i)
+	}
+	require.Less(stats.SyncGetCount, numGets/5, "lookups should be coalesced")
+
+	// Canceling individual lookups should not affect other lookups.
+	stats = syncer.NewStatsCollector(server)
+	ctxs := make([]context.Context, len(keys))
+	for i := range ctxs {
+		ctxs[i] = ctx
+		if i%2 == 0 {
+			var cancel context.CancelFunc
+			ctxs[i], cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+		}
+	}
+	for i, err := range getAll(newCoalescingSyncer(stats, 200*time.Millisecond), ctxs) {
+		switch i % 2 {
+		case 0:
+			require.ErrorIs(err, context.DeadlineExceeded, "canceled Get %d should fail", i)
+		default:
+			require.NoError(err, "Get %d", i)
+		}
+	}
+	require.Less(stats.SyncGetCount, numGets/5, "lookups should be coalesced")
+
+	// Batches without any remaining waiters should be dropped.
+	stats = syncer.NewStatsCollector(server)
+	cs := newCoalescingSyncer(stats, 200*time.Millisecond)
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = NewWithRoot(cs, nil, root).Get(cancelCtx, keys[0])
+	require.ErrorIs(err, context.DeadlineExceeded, "canceled Get should fail")
+	time.Sleep(300 * time.Millisecond)
+	require.Zero(stats.SyncGetCount, "abandoned batches should not be sent")
+	value, err := NewWithRoot(cs, nil, root).Get(ctx, keys[0])
+	require.NoError(err, "Get")
+	require.Equal(values[0], value, "Get should return the correct value")
+
+	// Peers that do not support multi-key requests should get individual requests.
+	rs := &versionedSyncer{inner: server, minVersion: syncer.ProtocolVersion1, latestVersion: syncer.ProtocolVersion1}
+	for i, err := range getAll(newCoalescingSyncer(rs, 50*time.Millisecond), backgroundCtxs) {
+		require.NoError(err, "Get %d", i)
+	}
+	require.Greater(rs.requests, numGets, "lookups should fall back to individual requests")
+}
+
+func requireEqualProofTrees(require *require.Assertions, expected, actual *node.Pointer) {
+	if expected == nil {
+		require.Nil(actual, "subtree should be empty")
+		return
+	}
+	require.NotNil(actual, "subtree should not be empty")
+	require.Equal(expected.Hash, actual.Hash, "subtree hash should be the same")
+	require.Equal(expected.Node == nil, actual.Node == nil, "node inclusion should be the same")
+
+	if n, ok := expected.Node.(*node.InternalNode); ok {
+		an, ok := actual.Node.(*node.InternalNode)
+		require.True(ok, "node should be an internal node")
+		requireEqualProofTrees(require, n.Left, an.Left)
+		requireEqualProofTrees(require, n.Right, an.Right)
+	}
+}
+
+func TestCompactProof(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+	var ns common.Namespace
+
+	randomBytes := func(maxLen int) []byte {
+		b := make([]byte, 1+rng.Intn(maxLen))
+		_, _ = rng.Read(b)
+		return b
+	}
+	// verifyBoth verifies the proofs obtained using both the original and the compact encoding
+	// and makes sure that they result in the same subtree.
+	verifyBoth := func(rootHash hash.Hash, fetch func(version uint16) (*syncer.ProofResponse, error)) {
+		var pv syncer.ProofVerifier
+
+		rsp, err := fetch(syncer.ProtocolVersion2)
+		require.NoError(err, "fetching proof using protocol version 2")
+		require.Empty(rsp.Proof.Compact, "compact encoding should not be used with version 2")
+		expected, err := pv.VerifyProof(ctx, rootHash, &rsp.Proof)
+		require.NoError(err, "VerifyProof")
+
+		rsp, err = fetch(syncer.ProtocolVersion3)
+		require.NoError(err, "fetching proof using protocol version 3")
+		require.Empty(rsp.Proof.Entries, "compact encoding should be used with version 3")
+		require.NotEmpty(rsp.Proof.Compact, "compact encoding should be used with version 3")
+		actual, err := pv.VerifyProof(ctx, rootHash, &rsp.Proof)
+		require.NoError(err, "VerifyProof with the compact encoding")
+		requireEqualProofTrees(require, expected, actual)
+
+		// Encoded responses must round-trip.
+		dec, err := syncer.DecodeProofResponse(syncer.EncodeProofResponse(rsp))
+		require.NoError(err, "DecodeProofResponse")
+		require.Equal(rsp, dec, "decoded response should be the same")
+
+		// Any corruption must be detected.
+		if len(rsp.Proof.Compact) > 1 {
+			corrupted := append([]byte{}, rsp.Proof.Compact...)
+			corrupted[1+rng.Intn(len(corrupted)-1)] ^= byte(1 + rng.Intn(255))
+			_, err = pv.VerifyProof(ctx, rootHash, &syncer.Proof{UntrustedRoot: rootHash, Compact: corrupted})
+			require.Error(err, "VerifyProof should fail with a corrupted compact proof")
+
+			truncated := rsp.Proof.Compact[:1+rng.Intn(len(rsp.Proof.Compact)-1)]
+			_, err = pv.VerifyProof(ctx, rootHash, &syncer.Proof{UntrustedRoot: rootHash, Compact: truncated})
+			require.Error(err, "VerifyProof should fail with a truncated compact proof")
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		tree := New(nil, nil, node.RootTypeState)
+		var keys [][]byte
+		for j := rng.Intn(200); j > 0; j-- {
+			key := randomBytes(8)
+			err := tree.Insert(ctx, key, randomBytes(64))
+			require.NoError(err, "Insert")
+			keys = append(keys, key)
+		}
+		_, rootHash, err := tree.Commit(ctx, ns, 0)
+		require.NoError(err, "Commit")
+		treeID := syncer.TreeID{
+			Root:     node.Root{Namespace: ns, Version: 0, Type: node.RootTypeState, Hash: rootHash},
+			Position: rootHash,
+		}
+
+		for j := 0; j < 10; j++ {
+			// Look up both existing and missing keys.
+			key := randomBytes(8)
+			if len(keys) > 0 && rng.Intn(2) == 0 {
+				key = keys[rng.Intn(len(keys))]
+			}
+			includeSiblings := rng.Intn(2) == 0
+			verifyBoth(rootHash, func(version uint16) (*syncer.ProofResponse, error) {
+				return tree.SyncGet(ctx, &syncer.GetRequest{
+					Version:         version,
+					Tree:            treeID,
+					Key:             key,
+					IncludeSiblings: includeSiblings,
+				})
+			})
+
+			prefix := key[:1+rng.Intn(len(key))]
+			limit := uint16(rng.Intn(20))
+			verifyBoth(rootHash, func(version uint16) (*syncer.ProofResponse, error) {
+				return tree.SyncGetPrefixes(ctx, &syncer.GetPrefixesRequest{
+					Version:  version,
+					Tree:     treeID,
+					Prefixes: [][]byte{prefix},
+					Limit:    limit,
+				})
+			})
+
+			prefetch := uint16(rng.Intn(20))
+			verifyBoth(rootHash, func(version uint16) (*syncer.ProofResponse, error) {
+				return tree.SyncIterate(ctx, &syncer.IterateRequest{
+					Version:  version,
+					Tree:     treeID,
+					Key:      key,
+					Prefetch: prefetch,
+				})
+			})
+		}
+		tree.Close()
+	}
+
+	// Clients which do not support the compact encoding should keep receiving the original one.
+	tree := New(nil, nil, node.RootTypeState)
+	keys, values := generateKeyValuePairs()
+	for i, key := range keys {
+		err := tree.Insert(ctx, key, values[i])
+		require.NoError(err, "Insert")
+	}
+	_, rootHash, err := tree.Commit(ctx, ns, 0)
+	require.NoError(err, "Commit")
+	defer tree.Close()
+	treeID := syncer.TreeID{
+		Root:     node.Root{Namespace: ns, Version: 0, Type: node.RootTypeState, Hash: rootHash},
+		Position: rootHash,
+	}
+	for _, version := range []uint16{0, syncer.ProtocolVersion1, syncer.ProtocolVersion2} {
+		rsp, err := tree.SyncGet(ctx, &syncer.GetRequest{Version: version, Tree: treeID, Key: keys[0]})
+		require.NoError(err, "SyncGet")
+		require.Empty(rsp.Proof.Compact, "compact encoding should not be used with version %d", version)
+		require.NotEmpty(rsp.Proof.Entries, "original encoding should be used with version %d", version)
+	}
+
+	// Measure the size reduction on typical proofs for a populated tree.
+	proofSize := func(fetch func(version uint16) (*syncer.ProofResponse, error)) (int, int) {
+		rsp, err := fetch(syncer.ProtocolVersion2)
+		require.NoError(err, "fetching proof using protocol version 2")
+		original := len(syncer.EncodeProofResponse(rsp))
+		rsp, err = fetch(syncer.ProtocolVersion3)
+		require.NoError(err, "fetching proof using protocol version 3")
+		compact := len(syncer.EncodeProofResponse(rsp))
+		return original, compact
+	}
+
+	var getOriginal, getCompact int
+	for _, key := range keys {
+		original, compact := proofSize(func(version uint16) (*syncer.ProofResponse, error) {
+			return tree.SyncGet(ctx, &syncer.GetRequest{Version: version, Tree: treeID, Key: key})
+		})
+		getOriginal += original
+		getCompact += compact
+	}
+	require.Less(getCompact, getOriginal, "compact Get proofs should be smaller")
+	t.Logf("Get proofs: %d bytes -> %d bytes (%.1f%% smaller)",
+		getOriginal/len(keys), getCompact/len(keys), 100*(1-float64(getCompact)/float64(getOriginal)),
+	)
+
+	prefixOriginal, prefixCompact := proofSize(func(version uint16) (*syncer.ProofResponse, error) {
+		return tree.SyncGetPrefixes(ctx, &syncer.GetPrefixesRequest{
+			Version:  version,
+			Tree:     treeID,
+			Prefixes: [][]byte{[]byte("key 1"), []byte("key 5")},
+			Limit:    100,
+		})
+	})
+	require.Less(prefixCompact, prefixOriginal, "compact prefix proofs should be smaller")
+	t.Logf("prefix proofs: %d bytes -> %d bytes (%.1f%% smaller)",
+		prefixOriginal, prefixCompact, 100*(1-float64(prefixCompact)/float64(prefixOriginal)),
+	)
+}
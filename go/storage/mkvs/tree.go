@@ -15,14 +15,27 @@ type tree struct { // nolint: maligned
 	cache *cache
 
 	rootType node.RootType
+	// hasNodeDB is true iff the tree is backed by a node database.
+	hasNodeDB bool
 
 	// NOTE: This can be a map as updates are commutative.
 	pendingWriteLog map[string]*pendingEntry
 	withoutWriteLog bool
+	elideNoopWrites bool
+	// maxKeySize is the maximum size of keys in bytes (zero means unlimited).
+	maxKeySize int
+	// accessRecorder is the optional recorder of key and prefix accesses.
+	accessRecorder *AccessRecorder
 	// pendingRemovedNodes are the nodes that have been removed from the
 	// in-memory tree and should be marked for garbage collection if this
 	// tree is committed to the node database.
 	pendingRemovedNodes []node.Node
+
+	// forks are the active copy-on-write forks of this tree.
+	forks forkSet
+
+	// commitHooks are the tree-level hooks to fire after the next successful commit.
+	commitHooks []commitHook
 }
 
 type pendingEntry struct {
@@ -63,8 +76,43 @@ func WithoutWriteLog() Option {
 	}
 }
 
+// ElideNoopWrites omits write log entries for inserts which do not change the
+// value of an existing key.
+//
+// As such inserts do not modify the tree, root hashes are not affected.
+func ElideNoopWrites() Option {
+	return func(t *tree) {
+		t.elideNoopWrites = true
+	}
+}
+
+// DefaultMaxKeySize is the default maximum size of keys in bytes.
+const DefaultMaxKeySize = syncer.MaxKeySize
+
+// WithMaxKeySize sets the maximum size of keys in bytes. Operations using
+// larger keys fail with ErrKeyTooLarge without modifying the tree.
+//
+// If no maximum key size is specified, DefaultMaxKeySize is used. A maximum
+// key size of 0 disables the limit.
+func WithMaxKeySize(size int) Option {
+	return func(t *tree) {
+		t.maxKeySize = size
+	}
+}
+
+// WithHashMode sets the node hash construction used by a new empty tree.
+//
+// If no hash mode is specified, node.HashModeDefault is used. Trees created via
+// NewWithRoot always use the hash mode of the given root.
+func WithHashMode(mode node.HashMode) Option {
+	return func(t *tree) {
+		t.cache.syncRoot.HashMode = mode
+	}
+}
+
 // New creates a new empty MKVS tree backed by the given node database.
 func New(rs syncer.ReadSyncer, ndb db.NodeDB, rootType node.RootType, options ...Option) Tree {
+	hasNodeDB := ndb != nil
 	if rs == nil {
 		rs = syncer.NopReadSyncer
 	}
@@ -75,8 +123,10 @@ func New(rs syncer.ReadSyncer, ndb db.NodeDB, rootType node.RootType, options ..
 	t := &tree{
 		cache:           newCache(ndb, rs, rootType),
 		rootType:        rootType,
+		hasNodeDB:       hasNodeDB,
 		pendingWriteLog: make(map[string]*pendingEntry),
 		withoutWriteLog: false,
+		maxKeySize:      DefaultMaxKeySize,
 	}
 
 	for _, v := range options {
@@ -103,6 +153,14 @@ func (t *tree) NewIterator(ctx context.Context, options ...IteratorOption) Itera
 	return newTreeIterator(ctx, t, options...)
 }
 
+// Implements Tree.
+func (t *tree) NewIteratorAt(ctx context.Context, cursor *IteratorCursor, options ...IteratorOption) (Iterator, error) {
+	if t.cache.isClosed() {
+		return nil, ErrClosed
+	}
+	return newTreeIteratorAt(ctx, t, cursor, options...)
+}
+
 // Implements Tree.
 func (t *tree) ApplyWriteLog(ctx context.Context, wl writelog.Iterator) error {
 	for {
@@ -132,6 +190,44 @@ func (t *tree) ApplyWriteLog(ctx context.Context, wl writelog.Iterator) error {
 	return nil
 }
 
+// checkKeySize returns an error in case the key exceeds the maximum key size.
+func (t *tree) checkKeySize(key []byte) error {
+	return syncer.CheckKeySize(key, t.maxKeySize)
+}
+
+// Implements Tree.
+func (t *tree) ValidateRoot(ctx context.Context) error {
+	t.cache.Lock()
+	defer t.cache.Unlock()
+
+	if t.cache.isClosed() {
+		return ErrClosed
+	}
+	// Without a node database there is nothing to check against.
+	if !t.hasNodeDB {
+		return nil
+	}
+
+	root := t.cache.getSyncRoot()
+	if t.cache.db.HasRoot(root) {
+		return nil
+	}
+	// Nodes that are missing locally may still be fetched via the read syncer.
+	if t.cache.rs != syncer.NopReadSyncer {
+		return nil
+	}
+
+	earliestVersion, err := t.cache.db.GetEarliestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	latestVersion, err := t.cache.db.GetLatestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	return newRootError(root, earliestVersion, latestVersion)
+}
+
 // Implements Tree.
 func (t *tree) RootType() node.RootType {
 	return t.rootType
@@ -5,11 +5,15 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -38,17 +42,11 @@ const (
 
 var (
 	testNs = common.NewTestNamespaceFromSeed([]byte("oasis mkvs test ns"), 0)
-
-	_ syncer.ReadSyncer = (*dummySerialSyncer)(nil)
 )
 
 // NodeDBFactory is a function that creates a new node database for the given namespace.
 type NodeDBFactory func(ns common.Namespace) (db.NodeDB, error)
 
-type dummySerialSyncer struct {
-	backing syncer.ReadSyncer
-}
-
 // writeLogToMap is a helper for getting unordered WriteLog.
 func writeLogToMap(wl writelog.WriteLog) map[string]string {
 	writeLogSet := make(map[string]string)
@@ -76,60 +74,6 @@ func foldWriteLogIterator(t *testing.T, w writelog.Iterator) writelog.WriteLog {
 	return writeLog
 }
 
-func (s *dummySerialSyncer) SyncGet(ctx context.Context, request *syncer.GetRequest) (*syncer.ProofResponse, error) {
-	raw := cbor.Marshal(request)
-	var rq syncer.GetRequest
-	if err := cbor.Unmarshal(raw, &rq); err != nil {
-		return nil, err
-	}
-	rsp, err := s.backing.SyncGet(ctx, &rq)
-	if err != nil {
-		return nil, err
-	}
-	raw = cbor.Marshal(rsp)
-	var rs syncer.ProofResponse
-	if err := cbor.Unmarshal(raw, &rs); err != nil {
-		return nil, err
-	}
-	return &rs, nil
-}
-
-func (s *dummySerialSyncer) SyncGetPrefixes(ctx context.Context, request *syncer.GetPrefixesRequest) (*syncer.ProofResponse, error) {
-	raw := cbor.Marshal(request)
-	var rq syncer.GetPrefixesRequest
-	if err := cbor.Unmarshal(raw, &rq); err != nil {
-		return nil, err
-	}
-	rsp, err := s.backing.SyncGetPrefixes(ctx, &rq)
-	if err != nil {
-		return nil, err
-	}
-	raw = cbor.Marshal(rsp)
-	var rs syncer.ProofResponse
-	if err := cbor.Unmarshal(raw, &rs); err != nil {
-		return nil, err
-	}
-	return &rs, nil
-}
-
-func (s *dummySerialSyncer) SyncIterate(ctx context.Context, request *syncer.IterateRequest) (*syncer.ProofResponse, error) {
-	raw := cbor.Marshal(request)
-	var rq syncer.IterateRequest
-	if err := cbor.Unmarshal(raw, &rq); err != nil {
-		return nil, err
-	}
-	rsp, err := s.backing.SyncIterate(ctx, &rq)
-	if err != nil {
-		return nil, err
-	}
-	raw = cbor.Marshal(rsp)
-	var rs syncer.ProofResponse
-	if err := cbor.Unmarshal(raw, &rs); err != nil {
-		return nil, err
-	}
-	return &rs, nil
-}
-
 func testBasic(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 	tree := New(nil, ndb, node.RootTypeState)
@@ -624,6 +568,452 @@ func testSyncerBasic(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	require.Equal(t, 0, stats.SyncIterateCount, "SyncIterate count")
 }
 
+func testSyncerErrors(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values, r, tree := generatePopulatedTree(t, ndb)
+
+	// Errors returned by the syncer should be propagated.
+	testErr := errors.New("test syncer error")
+	remoteTree := NewWithRoot(syncer.NewErrorSyncer(testErr), nil, r, Capacity(0, 0))
+	_, err := remoteTree.Get(ctx, keys[0])
+	require.ErrorIs(t, err, testErr, "Get should fail with the syncer error")
+
+	// Slow syncers should be subject to context deadlines.
+	remoteTree = NewWithRoot(syncer.NewDelaySyncer(tree, time.Hour), nil, r, Capacity(0, 0))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = remoteTree.Get(timeoutCtx, keys[0])
+	require.ErrorIs(t, err, context.DeadlineExceeded, "Get should fail when the deadline is exceeded")
+
+	// Delayed requests should eventually succeed.
+	remoteTree = NewWithRoot(syncer.NewDelaySyncer(syncer.NewSerializingSyncer(tree), time.Millisecond), nil, r, Capacity(0, 0))
+	value, err := remoteTree.Get(ctx, keys[0])
+	require.NoError(t, err, "Get")
+	require.Equal(t, values[0], value)
+}
+
+func testGetRange(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values, r, tree := generatePopulatedTree(t, ndb)
+
+	expected := make(map[string][]byte)
+	for i := range keys {
+		expected[string(keys[i])] = values[i]
+	}
+
+	pageThrough := func(t *testing.T, tree Tree) {
+		items := make(map[string][]byte)
+		var (
+			startKey []byte
+			lastKey  []byte
+			pages    int
+		)
+		for {
+			kvs, nextKey, err := tree.GetRange(ctx, startKey, nil, 7)
+			require.NoError(t, err, "GetRange")
+			require.LessOrEqual(t, len(kvs), 7, "GetRange should respect the limit")
+			pages++
+
+			for _, kv := range kvs {
+				require.True(t, bytes.Compare(kv.Key, lastKey) > 0, "GetRange should return keys in order")
+				items[string(kv.Key)] = kv.Value
+				lastKey = kv.Key
+			}
+			if nextKey == nil {
+				break
+			}
+			require.Len(t, kvs, 7, "non-final pages should be full")
+			startKey = nextKey
+		}
+		require.Equal(t, expected, items, "paging should return all items")
+		require.Equal(t, (len(keys)+6)/7, pages, "number of pages")
+	}
+
+	t.Run("Local", func(t *testing.T) {
+		pageThrough(t, tree)
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		stats := syncer.NewStatsCollector(tree)
+		remoteTree := NewWithRoot(stats, nil, r, Capacity(0, 0))
+		pageThrough(t, remoteTree)
+
+		require.Equal(t, 0, stats.SyncGetCount, "SyncGet count")
+		require.Equal(t, 0, stats.SyncGetPrefixesCount, "SyncGetPrefixes count")
+		require.True(t, stats.SyncIterateCount > 0, "SyncIterate count")
+		require.True(t, stats.SyncIterateCount <= (len(keys)+6)/7, "SyncIterate count should be bounded by the number of pages")
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		kvs, nextKey, err := tree.GetRange(ctx, []byte("key 1"), []byte("key 2"), 1000)
+		require.NoError(t, err, "GetRange")
+		require.Nil(t, nextKey, "GetRange should not return a continuation key")
+		require.Len(t, kvs, 111, "GetRange should return all keys in range")
+		for _, kv := range kvs {
+			require.True(t, bytes.HasPrefix(kv.Key, []byte("key 1")), "GetRange should respect bounds")
+		}
+	})
+
+	t.Run("EmptyRange", func(t *testing.T) {
+		kvs, nextKey, err := tree.GetRange(ctx, []byte("key 1"), []byte("key 1"), 7)
+		require.NoError(t, err, "GetRange")
+		require.Empty(t, kvs, "GetRange should return no items for an empty range")
+		require.Nil(t, nextKey, "GetRange should not return a continuation key")
+
+		kvs, nextKey, err = tree.GetRange(ctx, []byte("zzz"), nil, 7)
+		require.NoError(t, err, "GetRange")
+		require.Empty(t, kvs, "GetRange should return no items past the last key")
+		require.Nil(t, nextKey, "GetRange should not return a continuation key")
+	})
+
+	t.Run("InvalidArguments", func(t *testing.T) {
+		_, _, err := tree.GetRange(ctx, nil, nil, 0)
+		require.ErrorIs(t, err, ErrInvalidRangeLimit, "GetRange should fail with zero limit")
+		_, _, err = tree.GetRange(ctx, []byte("key 2"), []byte("key 1"), 7)
+		require.ErrorIs(t, err, ErrInvalidRange, "GetRange should fail when end key is before start key")
+	})
+}
+
+func testGetRangeWithProof(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	_, _, r, tree := generatePopulatedTree(t, ndb)
+
+	startKey, endKey := []byte("key 1"), []byte("key 2")
+
+	checkRange := func(t *testing.T, tree Tree) {
+		kvs, proof, err := tree.GetRangeWithProof(ctx, startKey, endKey, 1000)
+		require.NoError(t, err, "GetRangeWithProof")
+		require.Len(t, kvs, 111, "GetRangeWithProof should return all keys in range")
+
+		expected, _, err := tree.GetRange(ctx, startKey, endKey, 1000)
+		require.NoError(t, err, "GetRange")
+		require.Equal(t, expected, kvs, "GetRangeWithProof should return the same items as GetRange")
+
+		err = VerifyRangeProof(ctx, r, startKey, endKey, kvs, proof)
+		require.NoError(t, err, "VerifyRangeProof")
+	}
+
+	t.Run("Local", func(t *testing.T) {
+		checkRange(t, tree)
+	})
+
+	t.Run("Remote", func(t *testing.T) {
+		remoteTree := NewWithRoot(tree, nil, r, Capacity(0, 0))
+		checkRange(t, remoteTree)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		kvs, proof, err := tree.GetRangeWithProof(ctx, startKey, endKey, 7)
+		require.NoError(t, err, "GetRangeWithProof")
+		require.Len(t, kvs, 7, "GetRangeWithProof should respect the limit")
+
+		lastKey := kvs[len(kvs)-1].Key
+		err = VerifyRangeProof(ctx, r, startKey, append(append([]byte{}, lastKey...), 0x00), kvs, proof)
+		require.NoError(t, err, "VerifyRangeProof up to the last returned key")
+
+		err = VerifyRangeProof(ctx, r, startKey, endKey, kvs, proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should fail for the whole range")
+	})
+
+	t.Run("Unbounded", func(t *testing.T) {
+		kvs, proof, err := tree.GetRangeWithProof(ctx, []byte("key 99"), nil, 1000)
+		require.NoError(t, err, "GetRangeWithProof")
+		require.NotEmpty(t, kvs, "GetRangeWithProof should return the tail of the tree")
+
+		err = VerifyRangeProof(ctx, r, []byte("key 99"), nil, kvs, proof)
+		require.NoError(t, err, "VerifyRangeProof")
+	})
+
+	t.Run("EmptyRange", func(t *testing.T) {
+		kvs, proof, err := tree.GetRangeWithProof(ctx, []byte("zzz"), nil, 7)
+		require.NoError(t, err, "GetRangeWithProof")
+		require.Empty(t, kvs, "GetRangeWithProof should return no items past the last key")
+
+		err = VerifyRangeProof(ctx, r, []byte("zzz"), nil, kvs, proof)
+		require.NoError(t, err, "VerifyRangeProof")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		kvs, proof, err := tree.GetRangeWithProof(ctx, startKey, endKey, 1000)
+		require.NoError(t, err, "GetRangeWithProof")
+
+		// Dropping a key from the middle of the range must be detected.
+		dropped := append(append([]KeyValue{}, kvs[:50]...), kvs[51:]...)
+		err = VerifyRangeProof(ctx, r, startKey, endKey, dropped, proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should detect a missing key")
+
+		// Dropping the last key of the range must be detected.
+		err = VerifyRangeProof(ctx, r, startKey, endKey, kvs[:len(kvs)-1], proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should detect a missing last key")
+
+		// Modifying a value must be detected.
+		modified := append([]KeyValue{}, kvs...)
+		modified[10] = KeyValue{Key: modified[10].Key, Value: []byte("tampered")}
+		err = VerifyRangeProof(ctx, r, startKey, endKey, modified, proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should detect a modified value")
+
+		// Adding a key must be detected.
+		added := append(append([]KeyValue{}, kvs...), KeyValue{Key: []byte("key 1zz"), Value: []byte("extra")})
+		err = VerifyRangeProof(ctx, r, startKey, endKey, added, proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should detect an extra key")
+
+		// Removing nodes from the proof must be detected.
+		prunedProof := &syncer.Proof{
+			UntrustedRoot: proof.UntrustedRoot,
+			Entries:       proof.Entries[:len(proof.Entries)/2],
+		}
+		err = VerifyRangeProof(ctx, r, startKey, endKey, kvs, prunedProof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should detect a pruned proof")
+
+		// A proof must not verify against a different root.
+		otherRoot := r
+		otherRoot.Hash.FromBytes([]byte("not the root"))
+		err = VerifyRangeProof(ctx, otherRoot, startKey, endKey, kvs, proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should fail for a different root")
+	})
+
+	t.Run("IncompleteProof", func(t *testing.T) {
+		// A proof for a sub-range does not attest to the completeness of a wider range.
+		kvs, proof, err := tree.GetRangeWithProof(ctx, []byte("key 10"), []byte("key 11"), 1000)
+		require.NoError(t, err, "GetRangeWithProof")
+
+		err = VerifyRangeProof(ctx, r, startKey, endKey, kvs, proof)
+		require.ErrorIs(t, err, ErrInvalidRangeProof, "VerifyRangeProof should fail for a wider range")
+	})
+
+	t.Run("DirtyTree", func(t *testing.T) {
+		dirtyTree := NewWithRoot(tree, nil, r, Capacity(0, 0))
+		err := dirtyTree.Insert(ctx, []byte("key 1zz"), []byte("dirty"))
+		require.NoError(t, err, "Insert")
+
+		_, _, err = dirtyTree.GetRangeWithProof(ctx, startKey, endKey, 1000)
+		require.ErrorIs(t, err, syncer.ErrDirtyRoot, "GetRangeWithProof should fail on a dirty tree")
+	})
+}
+
+func testProvePrefixEmpty(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	_, _, r, tree := generatePopulatedTree(t, ndb)
+
+	// A prefix that diverges from all keys in the tree should be empty, as should prefixes that
+	// sort before and after all keys.
+	for _, prefix := range [][]byte{[]byte("key 1a"), []byte("a"), []byte("zzz")} {
+		pp, err := tree.ProvePrefixEmpty(ctx, prefix)
+		require.NoError(t, err, "ProvePrefixEmpty")
+		require.True(t, pp.Empty, "prefix %s should be empty", prefix)
+		require.Nil(t, pp.Witness, "empty prefix should not have a witness")
+
+		err = VerifyPrefixProof(ctx, r, prefix, pp)
+		require.NoError(t, err, "VerifyPrefixProof")
+	}
+
+	// A used prefix should not be empty, with the first key under the prefix as the witness.
+	pp, err := tree.ProvePrefixEmpty(ctx, []byte("key 1"))
+	require.NoError(t, err, "ProvePrefixEmpty")
+	require.False(t, pp.Empty, "used prefix should not be empty")
+	require.EqualValues(t, "key 1", pp.Witness, "witness should be the first key under the prefix")
+	err = VerifyPrefixProof(ctx, r, []byte("key 1"), pp)
+	require.NoError(t, err, "VerifyPrefixProof")
+
+	// Proofs should also be generated when using a remote syncer.
+	prefix := []byte("key 1a")
+	remoteTree := NewWithRoot(tree, nil, r, Capacity(0, 0))
+	pp, err = remoteTree.ProvePrefixEmpty(ctx, prefix)
+	require.NoError(t, err, "ProvePrefixEmpty")
+	require.True(t, pp.Empty, "prefix should be empty")
+	err = VerifyPrefixProof(ctx, r, prefix, pp)
+	require.NoError(t, err, "VerifyPrefixProof")
+	remoteTree.Close()
+
+	// Claiming that the prefix is not empty must be detected.
+	err = VerifyPrefixProof(ctx, r, prefix, &PrefixProof{Witness: []byte("key 1a"), Proof: pp.Proof})
+	require.ErrorIs(t, err, ErrInvalidPrefixProof, "VerifyPrefixProof should detect a bogus witness")
+
+	// A proof must not verify against a different root or prefix.
+	otherRoot := r
+	otherRoot.Hash.FromBytes([]byte("not the root"))
+	err = VerifyPrefixProof(ctx, otherRoot, prefix, pp)
+	require.ErrorIs(t, err, ErrInvalidPrefixProof, "VerifyPrefixProof should fail for a different root")
+	err = VerifyPrefixProof(ctx, r, []byte("key 1"), pp)
+	require.ErrorIs(t, err, ErrInvalidPrefixProof, "VerifyPrefixProof should fail for a used prefix")
+	emptyProof := pp
+
+	// Inserting a key under the prefix should make it non-empty.
+	err = tree.Insert(ctx, []byte("key 1a 2"), []byte("value"))
+	require.NoError(t, err, "Insert")
+	_, err = tree.ProvePrefixEmpty(ctx, prefix)
+	require.ErrorIs(t, err, syncer.ErrDirtyRoot, "ProvePrefixEmpty should fail with uncommitted changes")
+	err = tree.Insert(ctx, []byte("key 1a 1"), []byte("value"))
+	require.NoError(t, err, "Insert")
+	_, newRoot, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+	root := r
+	root.Hash = newRoot
+
+	pp, err = tree.ProvePrefixEmpty(ctx, prefix)
+	require.NoError(t, err, "ProvePrefixEmpty")
+	require.False(t, pp.Empty, "prefix should not be empty after insert")
+	require.EqualValues(t, "key 1a 1", pp.Witness, "witness should be the first key under the prefix")
+	err = VerifyPrefixProof(ctx, root, prefix, pp)
+	require.NoError(t, err, "VerifyPrefixProof")
+
+	// Claiming that the prefix is empty or using a different witness must be detected.
+	err = VerifyPrefixProof(ctx, root, prefix, &PrefixProof{Empty: true, Proof: pp.Proof})
+	require.ErrorIs(t, err, ErrInvalidPrefixProof, "VerifyPrefixProof should detect a withheld witness")
+	err = VerifyPrefixProof(ctx, root, prefix, &PrefixProof{Witness: []byte("key 1a 2"), Proof: pp.Proof})
+	require.ErrorIs(t, err, ErrInvalidPrefixProof, "VerifyPrefixProof should detect a wrong witness")
+	err = VerifyPrefixProof(ctx, root, prefix, emptyProof)
+	require.ErrorIs(t, err, ErrInvalidPrefixProof, "VerifyPrefixProof should fail for a stale proof")
+
+	// An empty tree should not contain any prefix.
+	emptyTree := New(nil, ndb, node.RootTypeState)
+	defer emptyTree.Close()
+	pp, err = emptyTree.ProvePrefixEmpty(ctx, prefix)
+	require.NoError(t, err, "ProvePrefixEmpty")
+	require.True(t, pp.Empty, "empty tree should not contain any prefix")
+	emptyRoot := r
+	emptyRoot.Hash.Empty()
+	err = VerifyPrefixProof(ctx, emptyRoot, prefix, pp)
+	require.NoError(t, err, "VerifyPrefixProof")
+}
+
+// generateIterationOrderKeys generates a randomized set of keys together with keys that exercise
+// the edge cases of the iteration order (empty keys, keys that are prefixes of other keys and keys
+// that differ only in the discriminator bit).
+func generateIterationOrderKeys(rng *rand.Rand) []node.Key {
+	keySet := make(map[string]bool)
+	for _, k := range [][]byte{
+		{},
+		{0x00},
+		{0x00, 0x00},
+		{0x7f},
+		{0x7f, 0xab},
+		{0x7f, 0xff},
+		{0x80},
+		{0xff},
+		{0xff, 0xab},
+		{0xff, 0xff},
+		[]byte("foo"),
+		[]byte("foo bar"),
+		[]byte("foo\x00"),
+	} {
+		keySet[string(k)] = true
+	}
+	for i := 0; i < 200; i++ {
+		k := make([]byte, rng.Intn(5))
+		_, _ = rng.Read(k)
+		keySet[string(k)] = true
+	}
+
+	keys := make([]node.Key, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, node.Key(k))
+	}
+	// Randomize the insertion order.
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	return keys
+}
+
+// collectIterator returns all keys visited by the iterator after seeking to the given key.
+func collectIterator(t *testing.T, it Iterator, seek node.Key) []node.Key {
+	var keys []node.Key
+	for it.Seek(seek); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+	require.NoError(t, it.Err(), "iterator should not fail")
+	return keys
+}
+
+func testIterationOrder(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+
+	keys := generateIterationOrderKeys(rng)
+
+	// Iteration order must match byte-wise key order.
+	expected := make([]node.Key, len(keys))
+	copy(expected, keys)
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i], expected[j]) < 0
+	})
+
+	// Cache-only tree without a node database.
+	cacheTree := New(nil, nil, node.RootTypeState)
+	defer cacheTree.Close()
+	for _, k := range keys {
+		err := cacheTree.Insert(ctx, k, k)
+		require.NoError(t, err, "Insert")
+	}
+
+	// Tree backed by the node database.
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+	for _, k := range keys {
+		err := tree.Insert(ctx, k, k)
+		require.NoError(t, err, "Insert")
+	}
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+	root := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+		Hash:      rootHash,
+	}
+	localTree := NewWithRoot(nil, ndb, root, Capacity(0, 0))
+	defer localTree.Close()
+
+	// Remote tree backed by a syncer, with and without prefetching.
+	remoteTree := NewWithRoot(syncer.NewSerializingSyncer(tree), nil, root, Capacity(0, 0))
+	defer remoteTree.Close()
+
+	configs := []struct {
+		name string
+		tree Tree
+		opts []IteratorOption
+	}{
+		{"CacheOnly", cacheTree, nil},
+		{"Local", localTree, nil},
+		{"Remote", remoteTree, nil},
+		{"RemotePrefetch", remoteTree, []IteratorOption{IteratorPrefetch(10)}},
+	}
+
+	// Seek to every key, every key with a bit flipped or appended and a few random keys.
+	seeks := []node.Key{nil, {}}
+	for _, k := range expected {
+		seeks = append(seeks, k, append(append(node.Key{}, k...), 0x00), append(append(node.Key{}, k...), 0xff))
+		if len(k) > 0 {
+			flipped := append(node.Key{}, k...)
+			flipped[0] ^= 0x80
+			seeks = append(seeks, flipped)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		k := make(node.Key, rng.Intn(5))
+		_, _ = rng.Read(k)
+		seeks = append(seeks, k)
+	}
+
+	for _, cfg := range configs {
+		t.Run(cfg.name, func(t *testing.T) {
+			it := cfg.tree.NewIterator(ctx, cfg.opts...)
+			defer it.Close()
+
+			require.Equal(t, expected, collectIterator(t, it, nil), "full iteration order should match key order")
+			for _, seek := range seeks {
+				pos := sort.Search(len(expected), func(i int) bool {
+					return bytes.Compare(expected[i], seek) >= 0
+				})
+				var expectedAfterSeek []node.Key
+				if pos < len(expected) {
+					expectedAfterSeek = expected[pos:]
+				}
+				require.Equal(t, expectedAfterSeek, collectIterator(t, it, seek), "iteration order after seek to %X", seek)
+			}
+		})
+	}
+}
+
 func testSyncerRootEmptyLabelNeedsDeref(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 	tree := New(nil, ndb, node.RootTypeState)
@@ -780,9 +1170,7 @@ func testSyncerNilNodes(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	_, root, err := tree.Commit(ctx, testNs, 0)
 	require.NoError(t, err, "Commit")
 
-	wire := &dummySerialSyncer{
-		backing: tree,
-	}
+	wire := syncer.NewSerializingSyncer(tree)
 	remote := NewWithRoot(wire, nil, node.Root{
 		Namespace: testNs,
 		Version:   0,
@@ -819,6 +1207,295 @@ func testSyncerPrefetchPrefixes(t *testing.T, ndb db.NodeDB, factory NodeDBFacto
 	require.EqualValues(t, 0, stats.SyncIterateCount, "SyncIterate should not be called")
 }
 
+func testInsertRemoveEx(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values, root, tree := generatePopulatedTree(t, ndb)
+
+	// Perform the same operations on two remote trees, only using the extended variants on one.
+	stats := syncer.NewStatsCollector(tree)
+	plainTree := NewWithRoot(stats, nil, root, Capacity(0, 0))
+	defer plainTree.Close()
+	statsEx := syncer.NewStatsCollector(tree)
+	remoteTree := NewWithRoot(statsEx, nil, root, Capacity(0, 0))
+	defer remoteTree.Close()
+
+	// Overwrite existing keys.
+	for i := 0; i < len(keys); i += 10 {
+		newValue := []byte(fmt.Sprintf("overwritten %d", i))
+		err := plainTree.Insert(ctx, keys[i], newValue)
+		require.NoError(t, err, "Insert")
+		existed, prevValue, err := remoteTree.InsertEx(ctx, keys[i], newValue)
+		require.NoError(t, err, "InsertEx")
+		require.True(t, existed, "InsertEx should report existing keys")
+		require.Equal(t, values[i], prevValue, "InsertEx should return the previous value")
+
+		// Overwriting again should return the locally updated value.
+		existed, prevValue, err = remoteTree.InsertEx(ctx, keys[i], newValue)
+		require.NoError(t, err, "InsertEx")
+		require.True(t, existed, "InsertEx should report existing keys")
+		require.Equal(t, newValue, prevValue, "InsertEx should return the updated value")
+	}
+
+	// Insert fresh keys.
+	for _, key := range [][]byte{[]byte("fresh key"), []byte("key"), []byte("key 1000")} {
+		err := plainTree.Insert(ctx, key, []byte("fresh"))
+		require.NoError(t, err, "Insert")
+		existed, prevValue, err := remoteTree.InsertEx(ctx, key, []byte("fresh"))
+		require.NoError(t, err, "InsertEx")
+		require.False(t, existed, "InsertEx should not report fresh keys as existing")
+		require.Nil(t, prevValue, "InsertEx should not return a previous value for fresh keys")
+	}
+
+	// Remove existing keys.
+	for i := 5; i < len(keys); i += 10 {
+		err := plainTree.Remove(ctx, keys[i])
+		require.NoError(t, err, "Remove")
+		existed, prevValue, err := remoteTree.RemoveEx(ctx, keys[i])
+		require.NoError(t, err, "RemoveEx")
+		require.True(t, existed, "RemoveEx should report existing keys")
+		require.Equal(t, values[i], prevValue, "RemoveEx should return the removed value")
+
+		// Removing again should not remove anything.
+		existed, prevValue, err = remoteTree.RemoveEx(ctx, keys[i])
+		require.NoError(t, err, "RemoveEx")
+		require.False(t, existed, "RemoveEx should not report removed keys as existing")
+		require.Nil(t, prevValue, "RemoveEx should not return a value for removed keys")
+	}
+
+	// Remove non-existent keys.
+	for _, key := range [][]byte{[]byte("missing key"), []byte("key 10000")} {
+		err := plainTree.Remove(ctx, key)
+		require.NoError(t, err, "Remove")
+		existed, prevValue, err := remoteTree.RemoveEx(ctx, key)
+		require.NoError(t, err, "RemoveEx")
+		require.False(t, existed, "RemoveEx should not report missing keys as existing")
+		require.Nil(t, prevValue, "RemoveEx should not return a value for missing keys")
+	}
+
+	require.Equal(t, stats.SyncGetCount, statsEx.SyncGetCount, "SyncGet count should be unchanged")
+	require.Equal(t, stats.SyncGetPrefixesCount, statsEx.SyncGetPrefixesCount, "SyncGetPrefixes count should be unchanged")
+	require.Equal(t, stats.SyncIterateCount, statsEx.SyncIterateCount, "SyncIterate count should be unchanged")
+
+	// Both trees should end up with the same root.
+	_, plainRoot, err := plainTree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	_, exRoot, err := remoteTree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	require.Equal(t, plainRoot, exRoot, "InsertEx/RemoveEx should result in the same root")
+}
+
+func testCompareAndSwap(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values, root, tree := generatePopulatedTree(t, ndb)
+
+	// Perform the same operations on two remote trees, only using the conditional variants on one.
+	stats := syncer.NewStatsCollector(tree)
+	plainTree := NewWithRoot(stats, nil, root, Capacity(0, 0))
+	defer plainTree.Close()
+	statsEx := syncer.NewStatsCollector(tree)
+	remoteTree := NewWithRoot(statsEx, nil, root, Capacity(0, 0))
+	defer remoteTree.Close()
+
+	// requireSingleFetch performs the given operation and checks that it required at most one
+	// remote fetch.
+	requireSingleFetch := func(fn func()) {
+		count := statsEx.SyncGetCount
+		fn()
+		require.LessOrEqual(t, statsEx.SyncGetCount-count, 1, "at most one remote fetch should occur per call")
+	}
+
+	// Successful swaps of existing keys.
+	for i := 0; i < len(keys); i += 10 {
+		newValue := []byte(fmt.Sprintf("swapped %d", i))
+		err := plainTree.Insert(ctx, keys[i], newValue)
+		require.NoError(t, err, "Insert")
+		requireSingleFetch(func() {
+			swapped, actual, err := remoteTree.CompareAndSwap(ctx, keys[i], values[i], newValue)
+			require.NoError(t, err, "CompareAndSwap")
+			require.True(t, swapped, "CompareAndSwap should swap matching values")
+			require.Equal(t, values[i], actual, "CompareAndSwap should return the previous value")
+		})
+	}
+
+	// Failed swaps of existing keys should return the actual value.
+	for i := 1; i < len(keys); i += 10 {
+		requireSingleFetch(func() {
+			swapped, actual, err := remoteTree.CompareAndSwap(ctx, keys[i], []byte("wrong value"), []byte("never"))
+			require.NoError(t, err, "CompareAndSwap")
+			require.False(t, swapped, "CompareAndSwap should not swap mismatching values")
+			require.Equal(t, values[i], actual, "CompareAndSwap should return the actual value")
+		})
+		swapped, actual, err := remoteTree.CompareAndSwap(ctx, keys[i], nil, []byte("never"))
+		require.NoError(t, err, "CompareAndSwap")
+		require.False(t, swapped, "CompareAndSwap should not swap existing keys expected to be missing")
+		require.Equal(t, values[i], actual, "CompareAndSwap should return the actual value")
+	}
+
+	// Swaps of missing keys.
+	for _, key := range [][]byte{[]byte("fresh key"), []byte("key"), []byte("key 1000")} {
+		requireSingleFetch(func() {
+			swapped, actual, err := remoteTree.CompareAndSwap(ctx, key, []byte("value"), []byte("never"))
+			require.NoError(t, err, "CompareAndSwap")
+			require.False(t, swapped, "CompareAndSwap should not swap missing keys expected to exist")
+			require.Nil(t, actual, "CompareAndSwap should not return a value for missing keys")
+		})
+
+		err := plainTree.Insert(ctx, key, []byte("fresh"))
+		require.NoError(t, err, "Insert")
+		swapped, actual, err := remoteTree.CompareAndSwap(ctx, key, nil, []byte("fresh"))
+		require.NoError(t, err, "CompareAndSwap")
+		require.True(t, swapped, "CompareAndSwap should insert missing keys expected to be missing")
+		require.Nil(t, actual, "CompareAndSwap should not return a value for missing keys")
+	}
+
+	// GetOrInsert on present keys.
+	for i := 2; i < len(keys); i += 10 {
+		requireSingleFetch(func() {
+			value, inserted, err := remoteTree.GetOrInsert(ctx, keys[i], []byte("default"))
+			require.NoError(t, err, "GetOrInsert")
+			require.False(t, inserted, "GetOrInsert should not insert present keys")
+			require.Equal(t, values[i], value, "GetOrInsert should return the present value")
+		})
+	}
+
+	// GetOrInsert on absent keys.
+	for _, key := range [][]byte{[]byte("another fresh key"), []byte("key 2000")} {
+		err := plainTree.Insert(ctx, key, []byte("default"))
+		require.NoError(t, err, "Insert")
+		requireSingleFetch(func() {
+			value, inserted, err := remoteTree.GetOrInsert(ctx, key, []byte("default"))
+			require.NoError(t, err, "GetOrInsert")
+			require.True(t, inserted, "GetOrInsert should insert absent keys")
+			require.Equal(t, []byte("default"), value, "GetOrInsert should return the inserted value")
+		})
+
+		value, inserted, err := remoteTree.GetOrInsert(ctx, key, []byte("other"))
+		require.NoError(t, err, "GetOrInsert")
+		require.False(t, inserted, "GetOrInsert should not insert keys twice")
+		require.Equal(t, []byte("default"), value, "GetOrInsert should return the inserted value")
+	}
+
+	// Both trees should end up with the same root as failed swaps should not modify the tree.
+	_, plainRoot, err := plainTree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	_, exRoot, err := remoteTree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	require.Equal(t, plainRoot, exRoot, "CompareAndSwap/GetOrInsert should result in the same root")
+}
+
+func testSyncerAccessProfile(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values, root, tree := generatePopulatedTree(t, ndb)
+
+	// Record the accesses of the first session.
+	recorder := NewAccessRecorder()
+	stats := syncer.NewStatsCollector(tree)
+	remoteTree := NewWithRoot(stats, nil, root, Capacity(0, 0), WithAccessRecorder(recorder))
+	err := remoteTree.PrefetchPrefixes(ctx, [][]byte{[]byte("key 1")}, 1000)
+	require.NoError(t, err, "PrefetchPrefixes")
+	sessionKeys := [][]byte{keys[0], keys[500], keys[999], []byte("missing key")}
+	for _, key := range sessionKeys {
+		_, err = remoteTree.Get(ctx, key)
+		require.NoError(t, err, "Get")
+	}
+	require.NotZero(t, stats.SyncGetCount, "first session should use SyncGet")
+	remoteTree.Close()
+
+	profile := recorder.Profile()
+	require.Len(t, profile.Keys, len(sessionKeys), "profile should contain all looked up keys")
+	require.Equal(t, []PrefixAccess{{Prefix: []byte("key 1"), Limit: 1000}}, profile.Prefixes, "profile should contain all prefixes")
+
+	var decProfile AccessProfile
+	err = cbor.Unmarshal(cbor.Marshal(profile), &decProfile)
+	require.NoError(t, err, "AccessProfile should round-trip")
+	require.Equal(t, profile, &decProfile, "AccessProfile should round-trip")
+
+	// Prime the second session using the recorded profile.
+	stats = syncer.NewStatsCollector(tree)
+	remoteTree = NewWithRoot(stats, nil, root, Capacity(0, 0))
+	defer remoteTree.Close()
+	err = remoteTree.PrefetchProfile(ctx, &decProfile)
+	require.NoError(t, err, "PrefetchProfile")
+	require.EqualValues(t, 1, stats.SyncGetPrefixesCount, "prefixes should be prefetched using a single request")
+	require.LessOrEqual(t, stats.SyncGetCount, 2, "keys should be prefetched using batched requests")
+
+	stats.SyncGetCount = 0
+	for _, key := range sessionKeys {
+		_, err = remoteTree.Get(ctx, key)
+		require.NoError(t, err, "Get")
+	}
+	for i, key := range keys {
+		if !bytes.HasPrefix(key, []byte("key 1")) {
+			continue
+		}
+		var v []byte
+		v, err = remoteTree.Get(ctx, key)
+		require.NoError(t, err, "Get")
+		require.Equal(t, values[i], v)
+	}
+	require.EqualValues(t, 0, stats.SyncGetCount, "recorded keys should not require SyncGet")
+	require.EqualValues(t, 1, stats.SyncGetPrefixesCount, "recorded prefixes should not require SyncGetPrefixes")
+	require.EqualValues(t, 0, stats.SyncIterateCount, "SyncIterate should not be called")
+}
+
+func testSubtreeExportImport(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values, root, tree := generatePopulatedTree(t, ndb)
+
+	prefix := []byte("key 1")
+	var buf bytes.Buffer
+	err := tree.ExportSubtree(ctx, prefix, &buf)
+	require.NoError(t, err, "ExportSubtree")
+	export := buf.Bytes()
+
+	// Import into a tree without a node database and without a read syncer.
+	localTree := NewWithRoot(nil, nil, root, Capacity(0, 0))
+	defer localTree.Close()
+	err = localTree.ImportSubtree(ctx, bytes.NewReader(export))
+	require.NoError(t, err, "ImportSubtree")
+
+	var numKeys int
+	for i, key := range keys {
+		if !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		value, gerr := localTree.Get(ctx, key)
+		require.NoError(t, gerr, "Get")
+		require.Equal(t, values[i], value, "Get should return the correct value")
+		numKeys++
+	}
+	require.NotZero(t, numKeys, "exported prefix should not be empty")
+
+	// Keys far from the exported prefix are not available without a read syncer.
+	_, err = localTree.Get(ctx, []byte("key 5"))
+	require.Error(t, err, "Get outside of the exported prefix should fail")
+
+	// Absence of keys under the exported prefix should be provable as well.
+	value, err := localTree.Get(ctx, []byte("key 1 missing"))
+	require.NoError(t, err, "Get of a missing key under the exported prefix")
+	require.Nil(t, value, "Get of a missing key under the exported prefix")
+
+	// Importing into a tree with a different root should fail.
+	otherRoot := root
+	otherRoot.Hash = hash.NewFromBytes([]byte("other root"))
+	otherTree := NewWithRoot(nil, nil, otherRoot, Capacity(0, 0))
+	defer otherTree.Close()
+	err = otherTree.ImportSubtree(ctx, bytes.NewReader(export))
+	require.ErrorIs(t, err, ErrSubtreeRootMismatch, "ImportSubtree with a different root should fail")
+
+	// Importing a truncated export should fail.
+	truncatedTree := NewWithRoot(nil, nil, root, Capacity(0, 0))
+	defer truncatedTree.Close()
+	err = truncatedTree.ImportSubtree(ctx, bytes.NewReader(export[:len(export)/2]))
+	require.Error(t, err, "ImportSubtree of a truncated export should fail")
+
+	// Exporting from a tree with uncommitted changes should fail.
+	err = tree.Insert(ctx, []byte("key 1 dirty"), []byte("dirty"))
+	require.NoError(t, err, "Insert")
+	err = tree.ExportSubtree(ctx, prefix, &buf)
+	require.ErrorIs(t, err, syncer.ErrDirtyRoot, "ExportSubtree with uncommitted changes should fail")
+}
+
 func testValueEviction(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 	tree := New(nil, ndb, node.RootTypeState, Capacity(0, 512)).(*tree)
@@ -942,6 +1619,34 @@ func testApplyWriteLog(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	require.True(t, rootHash.IsEmpty(), "root hash must be empty after removal of all items")
 }
 
+func testApplyChunkedWriteLog(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	keys, values := generateKeyValuePairsEx("", 5000)
+
+	var writeLog writelog.WriteLog
+	for i := range keys {
+		writeLog = append(writeLog, writelog.LogEntry{Key: keys[i], Value: values[i]})
+	}
+
+	tree := New(nil, ndb, node.RootTypeState)
+	err := tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(writeLog))
+	require.NoError(t, err, "ApplyWriteLog")
+	_, expectedRoot, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+
+	for _, maxBytes := range []int{128, 1024, 16 * 1024, 1024 * 1024} {
+		chunks := writelog.NewChunkedIterator(writelog.NewStaticIterator(writeLog), maxBytes)
+
+		tree = New(nil, ndb, node.RootTypeState)
+		err = tree.ApplyWriteLog(ctx, writelog.NewReassemblingIterator(chunks))
+		require.NoError(t, err, "ApplyWriteLog")
+		var rootHash hash.Hash
+		_, rootHash, err = tree.Commit(ctx, testNs, 0)
+		require.NoError(t, err, "Commit")
+		require.Equal(t, expectedRoot, rootHash, "root hash must be the same (max bytes: %d)", maxBytes)
+	}
+}
+
 func testOnCommitHooks(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	var emptyRoot hash.Hash
 	emptyRoot.Empty()
@@ -975,6 +1680,99 @@ func testOnCommitHooks(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	require.EqualValues(t, calls, []int{1, 2, 3}, "OnCommit hooks should fire in order")
 }
 
+func testTreeOnCommitHooks(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	tree := New(nil, ndb, node.RootTypeState).(*tree)
+
+	var calls []string
+	var roots []node.Root
+	tree.OnCommit(func(root node.Root) {
+		calls = append(calls, "first")
+		roots = append(roots, root)
+	})
+	tree.OnCommitPersist(func(root node.Root) {
+		calls = append(calls, "persist")
+		roots = append(roots, root)
+	})
+	tree.OnCommit(func(root node.Root) {
+		// Hooks must be able to use the tree.
+		value, err := tree.Get(ctx, []byte("foo"))
+		require.NoError(t, err, "Get")
+		require.EqualValues(t, []byte("bar"), value, "hooks should observe the committed tree")
+		calls = append(calls, "third")
+	})
+
+	err := tree.Insert(ctx, []byte("foo"), []byte("bar"))
+	require.NoError(t, err, "Insert")
+
+	// Hooks should not fire for commits that are not persisted.
+	_, _, err = tree.Commit(ctx, testNs, 0, NoPersist())
+	require.NoError(t, err, "Commit")
+	require.Empty(t, calls, "hooks should not fire for commits that are not persisted")
+
+	// Hooks should not fire for failed commits.
+	var badRoot node.Root
+	badRoot.Namespace = testNs
+	badRoot.Type = node.RootTypeState
+	badRoot.Hash.Empty()
+	_, err = tree.CommitKnown(ctx, badRoot)
+	require.ErrorIs(t, err, ErrKnownRootMismatch, "CommitKnown")
+	require.Empty(t, calls, "hooks should not fire for failed commits")
+
+	// All hooks should fire in registration order after a successful commit.
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+	require.EqualValues(t, []string{"first", "persist", "third"}, calls, "hooks should fire in order")
+	expectedRoot := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+		Hash:      rootHash,
+	}
+	require.EqualValues(t, []node.Root{expectedRoot, expectedRoot}, roots, "hooks should receive the new root")
+
+	// Hooks should be cleared after firing.
+	calls = nil
+	err = tree.Insert(ctx, []byte("foo"), []byte("baz"))
+	require.NoError(t, err, "Insert")
+	_, rootHash1, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	require.Empty(t, calls, "hooks should be cleared after firing")
+
+	// Tree-level hooks should fire after batch-level hooks.
+	var cleanOnFire bool
+	err = tree.Insert(ctx, []byte("foo"), []byte("qux"))
+	require.NoError(t, err, "Insert")
+	tree.OnCommit(func(root node.Root) {
+		cleanOnFire = tree.cache.pendingRoot.IsClean()
+	})
+	_, _, err = tree.Commit(ctx, testNs, 2)
+	require.NoError(t, err, "Commit")
+	require.True(t, cleanOnFire, "committed nodes should be marked clean before tree-level hooks fire")
+
+	// Only hooks registered via OnCommitPersist should fire for CommitKnown.
+	calls = nil
+	otherTree := NewWithRoot(nil, ndb, expectedRoot)
+	otherTree.OnCommit(func(root node.Root) {
+		calls = append(calls, "commit")
+	})
+	otherTree.OnCommitPersist(func(root node.Root) {
+		calls = append(calls, "persist")
+	})
+	err = otherTree.Insert(ctx, []byte("foo"), []byte("baz"))
+	require.NoError(t, err, "Insert")
+	_, err = otherTree.CommitKnown(ctx, node.Root{Namespace: testNs, Version: 1, Type: node.RootTypeState, Hash: rootHash1})
+	require.NoError(t, err, "CommitKnown")
+	require.EqualValues(t, []string{"persist"}, calls, "only persist hooks should fire for CommitKnown")
+
+	// Hooks that did not fire for CommitKnown remain registered.
+	err = otherTree.Insert(ctx, []byte("foo"), []byte("quux"))
+	require.NoError(t, err, "Insert")
+	_, _, err = otherTree.Commit(ctx, testNs, 2)
+	require.NoError(t, err, "Commit")
+	require.EqualValues(t, []string{"persist", "commit"}, calls, "remaining hooks should fire on the next commit")
+}
+
 func testCommitNoPersist(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 	tree := New(nil, ndb, node.RootTypeState)
@@ -1023,6 +1821,75 @@ func testCommitNoPersist(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	require.EqualValues(t, []byte("we will persist everything"), value)
 }
 
+func testCommitNoWriteLog(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+
+	emptyRoot := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+	}
+	emptyRoot.Hash.Empty()
+
+	commit := func(version uint64, key, value string, options ...CommitOption) (writelog.WriteLog, node.Root) {
+		err := tree.Insert(ctx, []byte(key), []byte(value))
+		require.NoError(t, err, "Insert")
+		log, rootHash, err := tree.Commit(ctx, testNs, version, options...)
+		require.NoError(t, err, "Commit")
+
+		root := node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}
+		err = ndb.Finalize(ctx, []node.Root{root})
+		require.NoError(t, err, "Finalize")
+		return log, root
+	}
+
+	log, root1 := commit(0, "foo", "bar")
+	require.Len(t, log, 1, "write log should contain one item")
+
+	log, root2 := commit(1, "moo", "boo", NoWriteLog())
+	require.Nil(t, log, "write log should not be constructed")
+
+	log, root3 := commit(2, "goo", "zoo", NoPersistWriteLog())
+	require.EqualValues(t, writelog.WriteLog{writelog.LogEntry{Key: []byte("goo"), Value: []byte("zoo")}}, log,
+		"write log should be constructed")
+
+	// Everything except the write logs should have been persisted.
+	verifyTree := NewWithRoot(nil, ndb, root3)
+	defer verifyTree.Close()
+	for _, kv := range []KeyValue{
+		{Key: []byte("foo"), Value: []byte("bar")},
+		{Key: []byte("moo"), Value: []byte("boo")},
+		{Key: []byte("goo"), Value: []byte("zoo")},
+	} {
+		value, err := verifyTree.Get(ctx, kv.Key)
+		require.NoError(t, err, "Get")
+		require.EqualValues(t, kv.Value, value)
+	}
+
+	wli, err := ndb.GetWriteLog(ctx, emptyRoot, root1)
+	require.NoError(t, err, "GetWriteLog")
+	require.Len(t, foldWriteLogIterator(t, wli), 1, "stored write log should be available")
+
+	for _, pair := range [][2]node.Root{{root1, root2}, {root2, root3}} {
+		_, err = ndb.GetWriteLog(ctx, pair[0], pair[1])
+		require.ErrorIs(t, err, db.ErrWriteLogNotAvailable, "GetWriteLog for a root committed without a write log")
+	}
+
+	// Write logs should remain unavailable after the nodes have been pruned.
+	err = ndb.PruneNodes(ctx, 0)
+	require.NoError(t, err, "PruneNodes")
+	err = ndb.PruneNodes(ctx, 1)
+	require.NoError(t, err, "PruneNodes")
+
+	wli, err = ndb.GetWriteLog(ctx, emptyRoot, root1)
+	require.NoError(t, err, "GetWriteLog")
+	require.Len(t, foldWriteLogIterator(t, wli), 1, "retained write log should be available")
+	_, err = ndb.GetWriteLog(ctx, root1, root2)
+	require.ErrorIs(t, err, db.ErrWriteLogNotAvailable, "GetWriteLog for a retained root committed without a write log")
+}
+
 func testHasRoot(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	// Test that an empty root is always implicitly present.
 	root := node.Root{
@@ -1133,37 +2000,245 @@ func testGetRootsForVersion(t *testing.T, ndb db.NodeDB, factory NodeDBFactory)
 	require.Len(t, roots, 0, "GetRootsForVersion should return no roots for later versions")
 }
 
+func testEmptyRoot(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+
+	var emptyRoot node.Root
+	emptyRoot.Empty()
+	emptyRoot.Namespace = testNs
+	emptyRoot.Type = node.RootTypeState
+
+	// Commit an empty tree in version 0.
+	tree := New(nil, ndb, node.RootTypeState)
+	wl, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+	require.True(t, rootHash.IsEmpty(), "committing an empty tree should result in an empty root")
+	require.Empty(t, wl, "committing an empty tree should result in an empty write log")
+
+	// The empty root should be registered for the version.
+	roots, err := ndb.GetRootsForVersion(ctx, 0)
+	require.NoError(t, err, "GetRootsForVersion")
+	require.EqualValues(t, []node.Root{emptyRoot}, roots, "GetRootsForVersion should return the empty root")
+	require.True(t, ndb.HasRoot(emptyRoot), "HasRoot should return true on empty root")
+
+	// Committing the empty tree again should be a no-op.
+	_, _, err = New(nil, ndb, node.RootTypeState).Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+
+	// The write log from the empty root to itself should be empty.
+	wli, err := ndb.GetWriteLog(ctx, emptyRoot, emptyRoot)
+	require.NoError(t, err, "GetWriteLog")
+	require.Empty(t, foldWriteLogIterator(t, wli), "write log from the empty root to itself should be empty")
+
+	// Finalize version 0 with only the empty root.
+	err = ndb.Finalize(ctx, []node.Root{emptyRoot})
+	require.NoError(t, err, "Finalize")
+	latestVersion, err := ndb.GetLatestVersion(ctx)
+	require.NoError(t, err, "GetLatestVersion")
+	require.EqualValues(t, 0, latestVersion, "GetLatestVersion should return the empty root version")
+
+	roots, err = ndb.GetRootsForVersion(ctx, 0)
+	require.NoError(t, err, "GetRootsForVersion")
+	require.EqualValues(t, []node.Root{emptyRoot}, roots, "GetRootsForVersion should keep the finalized empty root")
+
+	// Derive a non-empty root in version 1 from the empty root.
+	tree = NewWithRoot(nil, ndb, emptyRoot)
+	err = tree.Insert(ctx, []byte("foo"), []byte("bar"))
+	require.NoError(t, err, "Insert")
+	_, rootHash1, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(t, err, "Commit")
+	root1 := node.Root{
+		Namespace: testNs,
+		Version:   1,
+		Type:      node.RootTypeState,
+		Hash:      rootHash1,
+	}
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(t, err, "Finalize")
+
+	// Remove everything in version 2, resulting in an empty root again.
+	err = tree.Remove(ctx, []byte("foo"))
+	require.NoError(t, err, "Remove")
+	_, rootHash2, err := tree.Commit(ctx, testNs, 2)
+	require.NoError(t, err, "Commit")
+	require.True(t, rootHash2.IsEmpty(), "removing all keys should result in an empty root")
+	emptyRoot2 := emptyRoot
+	emptyRoot2.Version = 2
+	err = ndb.Finalize(ctx, []node.Root{emptyRoot2})
+	require.NoError(t, err, "Finalize")
+
+	roots, err = ndb.GetRootsForVersion(ctx, 2)
+	require.NoError(t, err, "GetRootsForVersion")
+	require.EqualValues(t, []node.Root{emptyRoot2}, roots, "GetRootsForVersion should return the empty root")
+
+	wli, err = ndb.GetWriteLog(ctx, root1, emptyRoot2)
+	require.NoError(t, err, "GetWriteLog")
+	require.Equal(t, writelog.WriteLog{writelog.LogEntry{Key: []byte("foo")}}, foldWriteLogIterator(t, wli))
+	wli, err = ndb.GetWriteLog(ctx, emptyRoot2, emptyRoot2)
+	require.NoError(t, err, "GetWriteLog")
+	require.Empty(t, foldWriteLogIterator(t, wli), "write log from the empty root to itself should be empty")
+
+	// Pruning versions with empty roots should work.
+	err = ndb.Prune(ctx, 0)
+	require.NoError(t, err, "Prune")
+	err = ndb.Prune(ctx, 1)
+	require.NoError(t, err, "Prune")
+
+	roots, err = ndb.GetRootsForVersion(ctx, 0)
+	require.NoError(t, err, "GetRootsForVersion")
+	require.Empty(t, roots, "GetRootsForVersion should not return roots of pruned versions")
+	earliestVersion, err := ndb.GetEarliestVersion(ctx)
+	require.NoError(t, err, "GetEarliestVersion")
+	require.EqualValues(t, 2, earliestVersion, "GetEarliestVersion should return the earliest remaining version")
+
+	// The empty root in the remaining version should still be usable.
+	tree = NewWithRoot(nil, ndb, emptyRoot2)
+	defer tree.Close()
+	value, err := tree.Get(ctx, []byte("foo"))
+	require.NoError(t, err, "Get")
+	require.Nil(t, value, "Get should return nil for removed keys")
+	err = tree.Insert(ctx, []byte("moo"), []byte("boo"))
+	require.NoError(t, err, "Insert")
+	_, _, err = tree.Commit(ctx, testNs, 3)
+	require.NoError(t, err, "Commit")
+}
+
 func testSize(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 
-	size, err := ndb.Size()
-	require.NoError(t, err, "Size")
+	size, err := ndb.Size()
+	require.NoError(t, err, "Size")
+
+	// Put something in the database.
+	tree := New(nil, ndb, node.RootTypeState)
+	err = tree.Insert(ctx, []byte("foo"), []byte("bar"))
+	require.NoError(t, err, "Insert")
+	_, rootHash1, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(t, err, "Commit")
+	root1 := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+		Hash:      rootHash1,
+	}
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(t, err, "Finalize")
+
+	// Reopen database to force flush.
+	ndb.Close()
+	ndb, err = factory(testNs)
+	require.NoError(t, err, "ndb.New")
+	defer ndb.Close()
+
+	// Make sure size reports something that makes sense.
+	newSize, err := ndb.Size()
+	require.NoError(t, err, "Size")
+	require.True(t, newSize > size, "Size should be greater than before")
+}
+
+func testCommitIdempotent(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+
+	emptyRoot := node.Root{
+		Namespace: testNs,
+		Version:   0,
+		Type:      node.RootTypeState,
+	}
+	emptyRoot.Hash.Empty()
+
+	// commit applies the given write log on top of the given root and commits it, returning the
+	// new root and the number of times the OnCommit hooks fired.
+	commit := func(prevRoot node.Root, version uint64, wl writelog.WriteLog) (node.Root, int, error) {
+		tree := NewWithRoot(nil, ndb, prevRoot)
+		defer tree.Close()
+
+		var hooks int
+		tree.OnCommit(func(node.Root) {
+			hooks++
+		})
+
+		err := tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(wl))
+		require.NoError(t, err, "ApplyWriteLog")
+		_, rootHash, err := tree.Commit(ctx, testNs, version)
+		return node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}, hooks, err
+	}
+	writeLogLen := func(startRoot, endRoot node.Root) int {
+		it, err := ndb.GetWriteLog(ctx, startRoot, endRoot)
+		require.NoError(t, err, "GetWriteLog")
+		var n int
+		for {
+			more, err := it.Next()
+			require.NoError(t, err, "Next")
+			if !more {
+				return n
+			}
+			n++
+		}
+	}
+	storage := func() *db.StorageBreakdown {
+		breakdown, err := ndb.StorageBreakdown(ctx)
+		require.NoError(t, err, "StorageBreakdown")
+		return breakdown
+	}
+	requireRoots := func(version uint64, expected int) {
+		roots, err := ndb.GetRootsForVersion(ctx, version)
+		require.NoError(t, err, "GetRootsForVersion")
+		require.Len(t, roots, expected, "number of roots in version %d", version)
+	}
+
+	wl0 := writelog.WriteLog{{Key: []byte("foo"), Value: []byte("bar")}}
+	wl1 := writelog.WriteLog{{Key: []byte("foo"), Value: []byte("baz")}, {Key: []byte("moo"), Value: []byte("boo")}}
+	wl2 := writelog.WriteLog{{Key: []byte("goo"), Value: []byte("zoo")}}
 
-	// Put something in the database.
-	tree := New(nil, ndb, node.RootTypeState)
-	err = tree.Insert(ctx, []byte("foo"), []byte("bar"))
-	require.NoError(t, err, "Insert")
-	_, rootHash1, err := tree.Commit(ctx, testNs, 0)
+	root0, hooks, err := commit(emptyRoot, 0, wl0)
 	require.NoError(t, err, "Commit")
-	root1 := node.Root{
-		Namespace: testNs,
-		Version:   0,
-		Type:      node.RootTypeState,
-		Hash:      rootHash1,
-	}
-	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.Equal(t, 1, hooks, "OnCommit hooks should fire")
+	err = ndb.Finalize(ctx, []node.Root{root0})
 	require.NoError(t, err, "Finalize")
 
-	// Reopen database to force flush.
-	ndb.Close()
-	ndb, err = factory(testNs)
-	require.NoError(t, err, "ndb.New")
-	defer ndb.Close()
+	// Committing an existing root into a non-finalized version should be a no-op.
+	root1, hooks, err := commit(root0, 1, wl1)
+	require.NoError(t, err, "Commit")
+	require.Equal(t, 1, hooks, "OnCommit hooks should fire")
+	require.Equal(t, len(wl1), writeLogLen(root0, root1))
+	stored := storage()
+
+	again, hooks, err := commit(root0, 1, wl1)
+	require.NoError(t, err, "Commit should succeed for an existing root")
+	require.Equal(t, root1, again, "committing identical content should result in the same root")
+	require.Equal(t, 1, hooks, "OnCommit hooks should fire for an existing root")
+	require.Equal(t, len(wl1), writeLogLen(root0, root1), "write log should not be stored twice")
+	require.Equal(t, stored, storage(), "committing an existing root should not store anything")
+	requireRoots(1, 1)
+
+	// Committing a new root into a non-finalized version should succeed.
+	root1b, hooks, err := commit(root0, 1, wl2)
+	require.NoError(t, err, "Commit should succeed for a new root")
+	require.Equal(t, 1, hooks, "OnCommit hooks should fire")
+	require.NotEqual(t, root1, root1b)
+	requireRoots(1, 2)
 
-	// Make sure size reports something that makes sense.
-	newSize, err := ndb.Size()
-	require.NoError(t, err, "Size")
-	require.True(t, newSize > size, "Size should be greater than before")
+	err = ndb.Finalize(ctx, []node.Root{root1})
+	require.NoError(t, err, "Finalize")
+	requireRoots(1, 1)
+	stored = storage()
+
+	// Committing a finalized root into a finalized version should be a no-op.
+	again, hooks, err = commit(root0, 1, wl1)
+	require.NoError(t, err, "Commit should succeed for a finalized root")
+	require.Equal(t, root1, again, "committing identical content should result in the same root")
+	require.Equal(t, 1, hooks, "OnCommit hooks should fire for a finalized root")
+	require.Equal(t, len(wl1), writeLogLen(root0, root1), "write log should not be stored twice")
+	require.Equal(t, stored, storage(), "committing a finalized root should not store anything")
+	requireRoots(1, 1)
+
+	// Committing a discarded root into a finalized version should fail.
+	_, hooks, err = commit(root0, 1, wl2)
+	require.ErrorIs(t, err, db.ErrAlreadyFinalized, "Commit should fail for a discarded root")
+	require.Zero(t, hooks, "OnCommit hooks should not fire on failure")
+	require.False(t, ndb.HasRoot(root1b), "discarded root should not be resurrected")
+	require.Equal(t, stored, storage(), "failed commit should not store anything")
+	requireRoots(1, 1)
 }
 
 func testMergeWriteLog(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
@@ -1253,6 +2328,88 @@ func testMergeWriteLog(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	_ = writelog.DrainIterator(wli)
 }
 
+func testElideNoopWrites(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	keys, values := generateKeyValuePairsEx("elide ", 100)
+	tree := New(nil, ndb, node.RootTypeState, ElideNoopWrites())
+	for i := range keys {
+		err := tree.Insert(ctx, keys[i], values[i])
+		require.NoError(err, "Insert")
+	}
+	_, rootHash1, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	root1 := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash1}
+
+	// Overwrite half of the keys with identical values and change the other half.
+	update := func(tree Tree) {
+		for i := range keys {
+			value := values[i]
+			if i%2 == 1 {
+				value = append([]byte("changed "), value...)
+			}
+			err = tree.Insert(ctx, keys[i], value)
+			require.NoError(err, "Insert")
+		}
+		err = tree.Insert(ctx, []byte("elide new key"), []byte("new value"))
+		require.NoError(err, "Insert")
+	}
+
+	expectedWriteLog := writelog.WriteLog{{Key: []byte("elide new key"), Value: []byte("new value")}}
+	for i := 1; i < len(keys); i += 2 {
+		expectedWriteLog = append(expectedWriteLog, writelog.LogEntry{
+			Key:   keys[i],
+			Value: append([]byte("changed "), values[i]...),
+		})
+	}
+
+	tree = NewWithRoot(nil, ndb, root1, ElideNoopWrites())
+	update(tree)
+	writeLog, rootHash2, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(err, "Commit")
+	require.Equal(writeLogToMap(expectedWriteLog), writeLogToMap(writeLog), "write log should only contain changed keys")
+	root2 := node.Root{Namespace: testNs, Version: 1, Type: node.RootTypeState, Hash: rootHash2}
+
+	// Root hashes should not be affected.
+	refTree := New(nil, nil, node.RootTypeState)
+	for i := range keys {
+		err = refTree.Insert(ctx, keys[i], values[i])
+		require.NoError(err, "Insert")
+	}
+	_, _, err = refTree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	update(refTree)
+	refWriteLog, refRootHash, err := refTree.Commit(ctx, testNs, 1)
+	require.NoError(err, "Commit")
+	require.Equal(rootHash2, refRootHash, "root hash should not be affected")
+	require.Len(refWriteLog, len(keys)+1, "write log should contain all keys without eliding")
+
+	// The stored write log should reproduce the new root.
+	wli, err := ndb.GetWriteLog(ctx, root1, root2)
+	require.NoError(err, "GetWriteLog")
+	storedWriteLog := foldWriteLogIterator(t, wli)
+	require.Equal(writeLogToMap(expectedWriteLog), writeLogToMap(storedWriteLog), "stored write log should only contain changed keys")
+
+	tree = NewWithRoot(nil, ndb, root1)
+	err = tree.ApplyWriteLog(ctx, writelog.NewStaticIterator(storedWriteLog))
+	require.NoError(err, "ApplyWriteLog")
+	_, rootHash, err := tree.Commit(ctx, testNs, 1)
+	require.NoError(err, "Commit")
+	require.Equal(rootHash2, rootHash, "applying the write log should reproduce the root")
+
+	// Changing a value and changing it back should still be recorded.
+	tree = NewWithRoot(nil, ndb, root2, ElideNoopWrites())
+	err = tree.Insert(ctx, keys[0], []byte("temporary"))
+	require.NoError(err, "Insert")
+	err = tree.Insert(ctx, keys[0], values[0])
+	require.NoError(err, "Insert")
+	writeLog, rootHash, err = tree.Commit(ctx, testNs, 2)
+	require.NoError(err, "Commit")
+	require.Equal(rootHash2, rootHash, "root hash should not change")
+	require.Equal(writelog.WriteLog{{Key: keys[0], Value: values[0]}}, writeLog, "write log should contain the rewritten key")
+}
+
 func testPruneBasic(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 	tree := New(nil, ndb, node.RootTypeState)
@@ -1344,6 +2501,8 @@ func testPruneBasic(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 
 	// Keys must still be available in version 2.
 	tree = NewWithRoot(nil, ndb, node.Root{Namespace: testNs, Version: 2, Type: node.RootTypeState, Hash: rootHash3})
+	err = tree.ValidateRoot(ctx)
+	require.NoError(t, err, "ValidateRoot")
 	value, err := tree.Get(ctx, []byte("blah"))
 	require.NoError(t, err, "Get")
 	require.EqualValues(t, []byte("ugh"), value)
@@ -1360,8 +2519,34 @@ func testPruneBasic(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 
 	// Version 0 must be gone.
 	tree = NewWithRoot(nil, ndb, node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash1})
+	err = tree.ValidateRoot(ctx)
+	require.ErrorIs(t, err, db.ErrVersionNotFound, "ValidateRoot should fail for pruned versions")
+	var rootErr *RootError
+	require.True(t, errors.As(err, &rootErr), "ValidateRoot should return a RootError")
+	require.True(t, rootErr.Pruned(), "RootError should report the version as pruned")
+	require.EqualValues(t, 1, rootErr.EarliestVersion, "RootError should report the earliest version")
 	_, err = tree.Get(ctx, []byte("foo"))
 	require.Error(t, err, "Get")
+
+	// Unknown roots at retained versions must be reported as such.
+	tree = NewWithRoot(nil, ndb, node.Root{Namespace: testNs, Version: 1, Type: node.RootTypeState, Hash: rootHash3})
+	err = tree.ValidateRoot(ctx)
+	require.ErrorIs(t, err, db.ErrRootNotFound, "ValidateRoot should fail for unknown roots")
+	require.True(t, errors.As(err, &rootErr), "ValidateRoot should return a RootError")
+	require.False(t, rootErr.Pruned(), "RootError should not report the version as pruned")
+	tree = NewWithRoot(nil, ndb, node.Root{Namespace: testNs, Version: 3, Type: node.RootTypeState, Hash: rootHash3})
+	err = tree.ValidateRoot(ctx)
+	require.ErrorIs(t, err, db.ErrRootNotFound, "ValidateRoot should fail for unknown versions")
+
+	// Trees without a node database are not checked.
+	remoteTree := NewWithRoot(nil, ndb, node.Root{Namespace: testNs, Version: 2, Type: node.RootTypeState, Hash: rootHash3})
+	defer remoteTree.Close()
+	tree = NewWithRoot(remoteTree, nil, node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash1})
+	err = tree.ValidateRoot(ctx)
+	require.NoError(t, err, "ValidateRoot should not check remote trees")
+	tree.Close()
+	err = tree.ValidateRoot(ctx)
+	require.ErrorIs(t, err, ErrClosed, "ValidateRoot should fail on closed trees")
 }
 
 func testPruneManyVersions(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
@@ -1414,6 +2599,387 @@ func testPruneManyVersions(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	}
 }
 
+func testWriteLogIterator(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	ctx := context.Background()
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+
+	const numVersions = 10
+	const numPairsPerVersion = 10
+
+	stateRoot := node.Root{Namespace: testNs, Type: node.RootTypeState}
+	stateRoot.Hash.Empty()
+	for r := 0; r < numVersions; r++ {
+		for p := 0; p < numPairsPerVersion; p++ {
+			key := []byte(fmt.Sprintf("key %d/%d", r, p))
+			value := []byte(fmt.Sprintf("value %d/%d", r, p))
+			err := tree.Insert(ctx, key, value)
+			require.NoError(t, err, "Insert")
+		}
+		// Also update some keys from earlier versions and remove others.
+		if r > 0 {
+			err := tree.Insert(ctx, []byte(fmt.Sprintf("key %d/0", r-1)), []byte("updated"))
+			require.NoError(t, err, "Insert")
+			err = tree.Remove(ctx, []byte(fmt.Sprintf("key %d/1", r-1)))
+			require.NoError(t, err, "Remove")
+		}
+
+		// Commit a lone root which will be discarded during finalization.
+		loneTree := NewWithRoot(nil, ndb, stateRoot)
+		err := loneTree.Insert(ctx, []byte("lone"), []byte("root"))
+		require.NoError(t, err, "Insert")
+		_, _, err = loneTree.Commit(ctx, testNs, uint64(r))
+		require.NoError(t, err, "Commit")
+		loneTree.Close()
+
+		_, rootHash, err := tree.Commit(ctx, testNs, uint64(r))
+		require.NoError(t, err, "Commit")
+		stateRoot = node.Root{Namespace: testNs, Version: uint64(r), Type: node.RootTypeState, Hash: rootHash}
+
+		// Derive two I/O roots within the same version.
+		ioTree := New(nil, ndb, node.RootTypeIO)
+		err = ioTree.Insert(ctx, []byte("input"), []byte(fmt.Sprintf("input %d", r)))
+		require.NoError(t, err, "Insert")
+		_, _, err = ioTree.Commit(ctx, testNs, uint64(r))
+		require.NoError(t, err, "Commit")
+		err = ioTree.Insert(ctx, []byte("output"), []byte(fmt.Sprintf("output %d", r)))
+		require.NoError(t, err, "Insert")
+		_, ioRootHash, err := ioTree.Commit(ctx, testNs, uint64(r))
+		require.NoError(t, err, "Commit")
+		ioTree.Close()
+		ioRoot := node.Root{Namespace: testNs, Version: uint64(r), Type: node.RootTypeIO, Hash: ioRootHash}
+
+		err = ndb.Finalize(ctx, []node.Root{stateRoot, ioRoot})
+		require.NoError(t, err, "Finalize")
+	}
+
+	// Reconstruct the final tree by sequentially applying all write logs.
+	it, err := ndb.WriteLogIterator(ctx, 0, numVersions-1, testNs)
+	require.NoError(t, err, "WriteLogIterator")
+
+	trees := make(map[node.RootType]Tree)
+	var numWriteLogs int
+	for {
+		more, err := it.Next()
+		require.NoError(t, err, "Next")
+		if !more {
+			break
+		}
+		wl, err := it.Value()
+		require.NoError(t, err, "Value")
+		numWriteLogs++
+
+		rtTree := trees[wl.DstRoot.Type]
+		if wl.SrcRoot.Hash.IsEmpty() {
+			rtTree = New(nil, nil, wl.DstRoot.Type)
+			trees[wl.DstRoot.Type] = rtTree
+		}
+		require.NotNil(t, rtTree, "write log source root should be known")
+		if wl.SrcRoot.Type == node.RootTypeState && !wl.SrcRoot.Hash.IsEmpty() {
+			require.Equal(t, wl.SrcRoot.Version+1, wl.DstRoot.Version, "state roots should follow the previous version")
+		}
+
+		err = rtTree.ApplyWriteLog(ctx, wl.WriteLog)
+		require.NoError(t, err, "ApplyWriteLog")
+		_, rootHash, err := rtTree.Commit(ctx, testNs, wl.DstRoot.Version)
+		require.NoError(t, err, "Commit")
+		require.Equal(t, wl.DstRoot.Hash, rootHash, "applying the write log should result in the destination root")
+	}
+	// Each version has one state write log and two I/O write logs.
+	require.Equal(t, 3*numVersions, numWriteLogs, "all write logs of finalized roots should be returned")
+
+	_, rootHash, err := trees[node.RootTypeState].Commit(ctx, testNs, numVersions-1)
+	require.NoError(t, err, "Commit")
+	require.Equal(t, stateRoot.Hash, rootHash, "reconstructed tree should match the final tree")
+	value, err := trees[node.RootTypeState].Get(ctx, []byte("key 8/0"))
+	require.NoError(t, err, "Get")
+	require.EqualValues(t, "updated", value)
+
+	// Invalid ranges.
+	_, err = ndb.WriteLogIterator(ctx, 0, numVersions, testNs)
+	require.ErrorIs(t, err, db.ErrNotFinalized, "WriteLogIterator with non-finalized versions")
+	var otherNs common.Namespace
+	_, err = ndb.WriteLogIterator(ctx, 0, numVersions-1, otherNs)
+	require.ErrorIs(t, err, db.ErrBadNamespace, "WriteLogIterator with a different namespace")
+
+	// Pruned write logs.
+	it, err = ndb.WriteLogIterator(ctx, 0, numVersions-1, testNs)
+	require.NoError(t, err, "WriteLogIterator")
+	err = ndb.Prune(ctx, 0)
+	require.NoError(t, err, "Prune")
+	_, err = it.Next()
+	require.ErrorIs(t, err, db.ErrWriteLogsPruned, "Next after pruning write logs")
+	_, err = ndb.WriteLogIterator(ctx, 0, numVersions-1, testNs)
+	require.ErrorIs(t, err, db.ErrWriteLogsPruned, "WriteLogIterator with pruned versions")
+
+	// Write logs retained after pruning nodes should still be returned.
+	err = ndb.PruneNodes(ctx, 1)
+	require.NoError(t, err, "PruneNodes")
+	it, err = ndb.WriteLogIterator(ctx, 1, 1, testNs)
+	require.NoError(t, err, "WriteLogIterator")
+	numWriteLogs = 0
+	for {
+		more, err := it.Next()
+		require.NoError(t, err, "Next")
+		if !more {
+			break
+		}
+		wl, err := it.Value()
+		require.NoError(t, err, "Value")
+		require.NotEmpty(t, foldWriteLogIterator(t, wl.WriteLog), "retained write log should not be empty")
+		numWriteLogs++
+	}
+	require.Equal(t, 3, numWriteLogs, "retained write logs should be returned")
+}
+
+func testVisitResumable(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	require := require.New(t)
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+	for i := 0; i < 5000; i++ {
+		key := make([]byte, 1+rng.Intn(32))
+		_, _ = rng.Read(key)
+		err := tree.Insert(ctx, key, []byte(fmt.Sprintf("value %d", i)))
+		require.NoError(err, "Insert")
+	}
+	_, rootHash, err := tree.Commit(ctx, testNs, 0)
+	require.NoError(err, "Commit")
+	root := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHash}
+
+	var full []hash.Hash
+	err = db.Visit(ctx, ndb, root, func(ctx context.Context, n node.Node) bool {
+		full = append(full, n.GetHash())
+		return true
+	})
+	require.NoError(err, "Visit")
+
+	// Interrupt the traversal at random points, only keeping the nodes visited before the last
+	// persisted token, and resume from it until the traversal completes.
+	const interval = 50
+	var (
+		visited   []hash.Hash
+		persisted []byte
+		resumes   int
+	)
+	for {
+		var token *db.VisitToken
+		if persisted != nil {
+			token = new(db.VisitToken)
+			err = cbor.Unmarshal(persisted, token)
+			require.NoError(err, "Unmarshal token")
+		}
+
+		pending := append([]hash.Hash{}, visited...)
+		visitCtx, cancel := context.WithCancel(ctx)
+		interruptAt := rng.Intn(20 * interval)
+		err = db.VisitResumable(visitCtx, ndb, root, token,
+			func(ctx context.Context, n node.Node) bool {
+				pending = append(pending, n.GetHash())
+				if interruptAt--; interruptAt == 0 {
+					cancel()
+				}
+				return true
+			},
+			interval,
+			func(ctx context.Context, token *db.VisitToken) error {
+				persisted = cbor.Marshal(token)
+				require.True(len(persisted) < 4096, "token should be small")
+				visited = append([]hash.Hash{}, pending...)
+				return nil
+			},
+		)
+		cancel()
+		if err == nil {
+			visited = pending
+			break
+		}
+		require.ErrorIs(err, context.Canceled, "VisitResumable")
+		resumes++
+	}
+	require.NotZero(resumes, "traversal should be interrupted")
+	require.Equal(full, visited, "resumed traversal should visit each node exactly once")
+
+	// Tokens for a different root should be rejected.
+	var token *db.VisitToken
+	err = db.VisitResumable(ctx, ndb, root, nil, func(ctx context.Context, n node.Node) bool {
+		return true
+	}, 1, func(ctx context.Context, t *db.VisitToken) error {
+		token = t
+		return errors.New("stop")
+	})
+	require.Error(err, "VisitResumable")
+	otherRoot := root
+	otherRoot.Version = 1
+	err = db.VisitResumable(ctx, ndb, otherRoot, token, func(ctx context.Context, n node.Node) bool {
+		return true
+	}, 0, nil)
+	require.ErrorIs(err, db.ErrInvalidVisitToken, "VisitResumable should reject tokens for other roots")
+}
+
+func testChangedKeys(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	foldChangedKeys := func(it ChangedKeysIterator) []ChangedKey {
+		var changes []ChangedKey
+		for {
+			more, err := it.Next()
+			require.NoError(err, "Next")
+			if !more {
+				break
+			}
+			change, err := it.Value()
+			require.NoError(err, "Value")
+			changes = append(changes, change)
+		}
+		_, err := it.Value()
+		require.ErrorIs(err, writelog.ErrIteratorInvalid, "Value on an exhausted iterator")
+		return changes
+	}
+
+	// Compute the expected changes from the contents of the trees.
+	expectedChanges := func(before, after map[string]string) []ChangedKey {
+		var changes []ChangedKey
+		for key, value := range after {
+			if prev, ok := before[key]; !ok || prev != value {
+				changes = append(changes, ChangedKey{Key: node.Key(key), Type: writelog.LogInsert})
+			}
+		}
+		for key := range before {
+			if _, ok := after[key]; !ok {
+				changes = append(changes, ChangedKey{Key: node.Key(key), Type: writelog.LogDelete})
+			}
+		}
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].Key.Compare(changes[j].Key) < 0
+		})
+		return changes
+	}
+
+	// Compare both the write log and the structural diff code paths.
+	checkChanges := func(startRoot, endRoot node.Root, before, after map[string]string, msg string) {
+		expected := expectedChanges(before, after)
+
+		it, err := ChangedKeys(ctx, ndb, startRoot, endRoot)
+		require.NoError(err, "ChangedKeys")
+		require.Equal(expected, foldChangedKeys(it), "changed keys should be correct (%s)", msg)
+
+		it, err = changedKeysFromDiff(ctx, ndb, startRoot, endRoot)
+		require.NoError(err, "changedKeysFromDiff")
+		require.Equal(expected, foldChangedKeys(it), "structural diff should be correct (%s)", msg)
+	}
+
+	contents := make(map[string]string)
+	tree := New(nil, ndb, node.RootTypeState, ElideNoopWrites())
+	defer tree.Close()
+	commit := func(version uint64, update func(), options ...CommitOption) (node.Root, map[string]string) {
+		update()
+		_, rootHash, err := tree.Commit(ctx, testNs, version, options...)
+		require.NoError(err, "Commit")
+		root := node.Root{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}
+		err = ndb.Finalize(ctx, []node.Root{root})
+		require.NoError(err, "Finalize")
+
+		snapshot := make(map[string]string, len(contents))
+		for k, v := range contents {
+			snapshot[k] = v
+		}
+		return root, snapshot
+	}
+	insert := func(key, value []byte) {
+		err := tree.Insert(ctx, key, value)
+		require.NoError(err, "Insert")
+		contents[string(key)] = string(value)
+	}
+	remove := func(key []byte) {
+		err := tree.Remove(ctx, key)
+		require.NoError(err, "Remove")
+		delete(contents, string(key))
+	}
+
+	emptyRoot := node.Root{Namespace: testNs, Version: 0, Type: node.RootTypeState}
+	emptyRoot.Hash.Empty()
+
+	keys, values := generateKeyValuePairsEx("changed ", 500)
+	root0, contents0 := commit(0, func() {
+		for i := range keys {
+			insert(keys[i], values[i])
+		}
+	})
+
+	// Update, remove and insert some keys, including keys ending at internal nodes.
+	root1, contents1 := commit(1, func() {
+		for i := 0; i < len(keys); i += 7 {
+			insert(keys[i], []byte("updated"))
+		}
+		for i := 3; i < len(keys); i += 11 {
+			remove(keys[i])
+		}
+		insert(keys[1], values[1])
+		insert([]byte("changed key 1"), []byte("unchanged key with a new value"))
+		insert([]byte("changed key 4"), []byte("prefix"))
+		insert([]byte("changed key 42 and more"), []byte("extension"))
+		insert([]byte("changed"), []byte("prefix of all keys"))
+	})
+
+	// Commit the next version without a write log to force the structural diff.
+	root2, contents2 := commit(2, func() {
+		for i := 5; i < len(keys); i += 13 {
+			insert(keys[i], []byte("updated again"))
+		}
+		for i := 2; i < len(keys); i += 17 {
+			remove(keys[i])
+		}
+		remove([]byte("changed"))
+		insert([]byte("changed key 99 and more"), []byte("extension"))
+	}, NoWriteLog())
+	_, err := ndb.GetWriteLog(ctx, root1, root2)
+	require.ErrorIs(err, db.ErrWriteLogNotAvailable, "write log should not be available")
+
+	// Removing everything should remove all keys.
+	root3, contents3 := commit(3, func() {
+		for key := range contents {
+			remove([]byte(key))
+		}
+	}, NoWriteLog())
+	require.True(root3.Hash.IsEmpty(), "tree should be empty")
+
+	checkChanges(emptyRoot, root0, nil, contents0, "empty to root 0")
+	checkChanges(root0, root1, contents0, contents1, "root 0 to root 1")
+	checkChanges(root1, root2, contents1, contents2, "root 1 to root 2")
+	checkChanges(root2, root3, contents2, contents3, "root 2 to root 3")
+	checkChanges(root1, root1, contents1, contents1, "same root")
+
+	// Small changes should not require traversing the whole tree.
+	root4, contents4 := commit(4, func() {
+		insert(keys[0], []byte("small change"))
+		insert(keys[1], []byte("small change"))
+	}, NoWriteLog())
+	root5, contents5 := commit(5, func() {
+		insert(keys[2], []byte("small change"))
+	}, NoWriteLog())
+	checkChanges(root4, root5, contents4, contents5, "small change")
+	counting := &countingNodeDB{NodeDB: ndb}
+	it, err := ChangedKeys(ctx, counting, root4, root5)
+	require.NoError(err, "ChangedKeys")
+	require.Len(foldChangedKeys(it), 1, "small change should change a single key")
+	require.True(counting.resetReads() < 50, "identical subtrees should be skipped")
+
+	// Roots must follow each other.
+	_, err = ChangedKeys(ctx, ndb, root0, root2)
+	require.ErrorIs(err, db.ErrRootMustFollowOld, "ChangedKeys with roots not following each other")
+
+	// Roots must exist.
+	bogusRoot := root5
+	bogusRoot.Version = 6
+	bogusRoot.Hash = hash.NewFromBytes([]byte("bogus root"))
+	_, err = ChangedKeys(ctx, ndb, root5, bogusRoot)
+	require.ErrorIs(err, db.ErrRootNotFound, "ChangedKeys with a missing root")
+}
+
 func testPruneForkedRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	ctx := context.Background()
 
@@ -1780,8 +3346,50 @@ func testPruneLoneRootsShared4(t *testing.T, ndb db.NodeDB, factory NodeDBFactor
 	require.EqualValues([]byte("bar"), value)
 }
 
+// finalizeFunc finalizes the given version comprising the passed list of finalized roots.
+type finalizeFunc func(ctx context.Context, ndb db.NodeDB, version uint64, roots []node.Root) error
+
+func finalizeWithList(ctx context.Context, ndb db.NodeDB, version uint64, roots []node.Root) error {
+	return ndb.Finalize(ctx, roots)
+}
+
+func finalizeWithFilter(ctx context.Context, ndb db.NodeDB, version uint64, roots []node.Root) error {
+	keep := make(map[hash.Hash]bool)
+	for _, root := range roots {
+		keep[root.Hash] = true
+	}
+	return ndb.FinalizeWithFilter(ctx, version, func(root node.Root) bool {
+		return keep[root.Hash]
+	})
+}
+
+// hasRoots returns whether each of the given roots exists in the node database.
+func hasRoots(ndb db.NodeDB, version uint64, hashes ...hash.Hash) []bool {
+	var exists []bool
+	for _, h := range hashes {
+		exists = append(exists, ndb.HasRoot(node.Root{
+			Namespace: testNs,
+			Version:   version,
+			Type:      node.RootTypeState,
+			Hash:      h,
+		}))
+	}
+	return exists
+}
+
 func testPruneLoneRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	runPruneLoneRoots(t, ndb, factory, finalizeWithList)
+}
+
+func testPruneLoneRootsWithFilter(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
+	runPruneLoneRoots(t, ndb, factory, finalizeWithFilter)
+}
+
+// runPruneLoneRoots runs the lone root pruning scenario using the given finalization function and
+// returns which of the roots in each version remained after the version has been finalized.
+func runPruneLoneRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory, finalize finalizeFunc) []bool {
 	ctx := context.Background()
+	var remaining []bool
 
 	// Create a root in version 0.
 	tree := New(nil, ndb, node.RootTypeState)
@@ -1823,8 +3431,9 @@ func testPruneLoneRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 			Hash:      hash,
 		})
 	}
-	err = ndb.Finalize(ctx, finalRoots)
+	err = finalize(ctx, ndb, 0, finalRoots)
 	require.NoError(t, err, "Finalize")
+	remaining = append(remaining, hasRoots(ndb, 0, rootHashR0_1, rootHashR0_2, rootHashR0_3, rootHashR0_4)...)
 
 	// Create a distinct root in version 1.
 	tree = New(nil, ndb, node.RootTypeState)
@@ -1910,8 +3519,12 @@ func testPruneLoneRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 			Hash:      hash,
 		})
 	}
-	err = ndb.Finalize(ctx, finalRoots)
+	err = finalize(ctx, ndb, 1, finalRoots)
 	require.NoError(t, err, "Finalize")
+	remaining = append(remaining, hasRoots(ndb, 1,
+		rootHashR1_1, rootHashR1_2, rootHashR1_3, rootHashR1_4, rootHashR1_5,
+		rootHashR1_6, rootHashR1_7, rootHashR1_8, rootHashR1_9, rootHashR1_10,
+	)...)
 
 	// Create a distinct root in version 2.
 	tree = New(nil, ndb, node.RootTypeState)
@@ -1944,8 +3557,9 @@ func testPruneLoneRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 			Hash:      hash,
 		})
 	}
-	err = ndb.Finalize(ctx, finalRoots)
+	err = finalize(ctx, ndb, 2, finalRoots)
 	require.NoError(t, err, "Finalize")
+	remaining = append(remaining, hasRoots(ndb, 2, rootHashR2_1, rootHashR2_2, rootHashR2_3)...)
 
 	// Prune versions 0 and 1, all of the lone root's node should have been removed.
 	err = ndb.Prune(ctx, 0)
@@ -1977,6 +3591,8 @@ func testPruneLoneRoots(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 			require.NotNil(t, value, "value should exist (%d, %s)", root.Version, key)
 		}
 	}
+
+	return remaining
 }
 
 func testErrors(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
@@ -2026,10 +3642,14 @@ func testErrors(t *testing.T, ndb db.NodeDB, factory NodeDBFactory) {
 	require.Error(t, err, "Commit should fail for invalid root")
 	require.Equal(t, db.ErrRootNotFound, err)
 
-	// Finalizing a version twice should fail.
+	// Finalizing a version twice with the same roots should be a no-op.
 	err = ndb.Finalize(ctx, []node.Root{{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHashR0_1}})
 	require.NoError(t, err, "Finalize")
 	err = ndb.Finalize(ctx, []node.Root{{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHashR0_1}})
+	require.NoError(t, err, "Finalize should succeed with the same roots")
+
+	// Finalizing a version twice with different roots should fail.
+	err = ndb.Finalize(ctx, []node.Root{{Namespace: testNs, Version: 0, Type: node.RootTypeState, Hash: rootHashR1_1}})
 	require.Error(t, err, "Finalize should fail as version is already finalized")
 	require.Equal(t, db.ErrAlreadyFinalized, err)
 
@@ -2214,26 +3834,45 @@ func testBackend(
 		{"InsertCommitBatch", testInsertCommitBatch},
 		{"InsertCommitEach", testInsertCommitEach},
 		{"Remove", testRemove},
+		{"InsertRemoveEx", testInsertRemoveEx},
+		{"CompareAndSwap", testCompareAndSwap},
 		{"ApplyWriteLog", testApplyWriteLog},
+		{"ApplyChunkedWriteLog", testApplyChunkedWriteLog},
 		{"SyncerBasic", testSyncerBasic},
+		{"SyncerErrors", testSyncerErrors},
+		{"GetRange", testGetRange},
+		{"GetRangeWithProof", testGetRangeWithProof},
+		{"ProvePrefixEmpty", testProvePrefixEmpty},
+		{"IterationOrder", testIterationOrder},
 		{"SyncerRootEmptyLabelNeedsDeref", testSyncerRootEmptyLabelNeedsDeref},
 		{"SyncerRemove", testSyncerRemove},
 		{"SyncerInsert", testSyncerInsert},
 		{"SyncerNilNodes", testSyncerNilNodes},
 		{"SyncerPrefetchPrefixes", testSyncerPrefetchPrefixes},
+		{"SyncerAccessProfile", testSyncerAccessProfile},
+		{"SubtreeExportImport", testSubtreeExportImport},
 		{"ValueEviction", testValueEviction},
 		{"NodeEviction", testNodeEviction},
 		{"DoubleInsertWithEviction", testDoubleInsertWithEviction},
 		{"DebugDump", testDebugDumpLocal},
 		{"OnCommitHooks", testOnCommitHooks},
+		{"TreeOnCommitHooks", testTreeOnCommitHooks},
 		{"CommitNoPersist", testCommitNoPersist},
+		{"CommitNoWriteLog", testCommitNoWriteLog},
+		{"CommitIdempotent", testCommitIdempotent},
 		{"MergeWriteLog", testMergeWriteLog},
+		{"ElideNoopWrites", testElideNoopWrites},
 		{"HasRoot", testHasRoot},
 		{"GetRootsForVersion", testGetRootsForVersion},
+		{"EmptyRoot", testEmptyRoot},
 		{"Size", testSize},
 		{"PruneBasic", testPruneBasic},
 		{"PruneManyVersions", testPruneManyVersions},
+		{"WriteLogIterator", testWriteLogIterator},
+		{"VisitResumable", testVisitResumable},
+		{"ChangedKeys", testChangedKeys},
 		{"PruneLoneRoots", testPruneLoneRoots},
+		{"PruneLoneRootsWithFilter", testPruneLoneRootsWithFilter},
 		{"PruneLoneRootsShared", testPruneLoneRootsShared},
 		{"PruneLoneRootsShared2", testPruneLoneRootsShared2},
 		{"PruneLoneRootsShared3", testPruneLoneRootsShared3},
@@ -2269,28 +3908,61 @@ func testBackend(
 	}
 }
 
+func initBadgerBackend(t *testing.T) (NodeDBFactory, func()) {
+	return initBadgerBackendWithShards(t, 0)
+}
+
+func initShardedBadgerBackend(t *testing.T) (NodeDBFactory, func()) {
+	return initBadgerBackendWithShards(t, 16)
+}
+
+func initBadgerBackendWithShards(t *testing.T, nodeKeyShards int) (NodeDBFactory, func()) {
+	// Create a new random temporary directory under /tmp.
+	dir, err := ioutil.TempDir("", "mkvs.test.badger")
+	require.NoError(t, err, "TempDir")
+
+	// Create a Badger-backed Node DB factory.
+	factory := func(ns common.Namespace) (db.NodeDB, error) {
+		return badgerDb.New(&db.Config{
+			DB:             dir,
+			NoFsync:        true,
+			Namespace:      ns,
+			BlockCacheSize: 16 * 1024 * 1024,
+			NodeKeyShards:  nodeKeyShards,
+		})
+	}
+
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	return factory, cleanup
+}
+
 func TestBadgerBackend(t *testing.T) {
-	testBackend(t, func(t *testing.T) (NodeDBFactory, func()) {
-		// Create a new random temporary directory under /tmp.
-		dir, err := ioutil.TempDir("", "mkvs.test.badger")
-		require.NoError(t, err, "TempDir")
-
-		// Create a Badger-backed Node DB factory.
-		factory := func(ns common.Namespace) (db.NodeDB, error) {
-			return badgerDb.New(&db.Config{
-				DB:           dir,
-				NoFsync:      true,
-				Namespace:    ns,
-				MaxCacheSize: 16 * 1024 * 1024,
-			})
-		}
+	testBackend(t, initBadgerBackend, nil)
+}
 
-		cleanup := func() {
-			os.RemoveAll(dir)
-		}
+func TestBadgerBackendSharded(t *testing.T) {
+	testBackend(t, initShardedBadgerBackend, nil)
+}
+
+func TestFinalizeWithFilterEquivalence(t *testing.T) {
+	var remaining [][]bool
+	for _, finalize := range []finalizeFunc{finalizeWithList, finalizeWithFilter} {
+		func() {
+			factory, cleanup := initBadgerBackend(t)
+			defer cleanup()
+			ndb, err := factory(testNs)
+			require.NoError(t, err, "ndb.New")
+			defer ndb.Close()
+
+			remaining = append(remaining, runPruneLoneRoots(t, ndb, factory, finalize))
+		}()
+	}
 
-		return factory, cleanup
-	}, nil)
+	require.Equal(t, remaining[0], remaining[1], "finalizing with a filter should keep the same roots as finalizing with a list")
+	require.Contains(t, remaining[0], false, "some roots should have been discarded")
 }
 
 func BenchmarkInsertCommitBatch1(b *testing.B) {
@@ -2309,6 +3981,54 @@ func BenchmarkInsertCommitBatch1000(b *testing.B) {
 	benchmarkInsertBatch(b, 1000, true)
 }
 
+func BenchmarkCommitWriteLog(b *testing.B) {
+	for _, tc := range []struct {
+		name    string
+		options []CommitOption
+	}{
+		{"WriteLog", nil},
+		{"NoPersistWriteLog", []CommitOption{NoPersistWriteLog()}},
+		{"NoWriteLog", []CommitOption{NoWriteLog()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			benchmarkCommitWriteLog(b, tc.options...)
+		})
+	}
+}
+
+func benchmarkCommitWriteLog(b *testing.B, options ...CommitOption) {
+	const numValues = 1000
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "mkvs.bench.badgerdb")
+	require.NoError(b, err, "TempDir")
+	defer os.RemoveAll(dir)
+	ndb, err := badgerDb.New(&db.Config{
+		DB:             dir,
+		Namespace:      testNs,
+		BlockCacheSize: 16 * 1024 * 1024,
+	})
+	require.NoError(b, err, "New")
+	defer ndb.Close()
+	tree := New(nil, ndb, node.RootTypeState)
+	defer tree.Close()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		for i := 0; i < numValues; i++ {
+			key := []byte(fmt.Sprintf("key %d", i))
+			value := []byte(fmt.Sprintf("value %d %d", i, n))
+
+			_ = tree.Insert(ctx, key, value)
+		}
+		b.StartTimer()
+
+		_, _, err = tree.Commit(ctx, testNs, uint64(n), options...)
+		require.NoError(b, err, "Commit")
+	}
+}
+
 func BenchmarkInsertNoCommitBatch1(b *testing.B) {
 	benchmarkInsertBatch(b, 1, false)
 }
@@ -2333,9 +4053,9 @@ func benchmarkInsertBatch(b *testing.B, numValues int, commit bool) {
 		require.NoError(b, err, "TempDir")
 		defer os.RemoveAll(dir)
 		ndb, err := badgerDb.New(&db.Config{
-			DB:           dir,
-			Namespace:    testNs,
-			MaxCacheSize: 16 * 1024 * 1024,
+			DB:             dir,
+			Namespace:      testNs,
+			BlockCacheSize: 16 * 1024 * 1024,
 		})
 		require.NoError(b, err, "New")
 		tree := New(nil, ndb, node.RootTypeState)
@@ -2353,6 +4073,73 @@ func benchmarkInsertBatch(b *testing.B, numValues int, commit bool) {
 	}
 }
 
+func BenchmarkNodeKeyShards(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("Commit/Shards%d", shards), func(b *testing.B) {
+			benchmarkNodeKeyShards(b, shards, false)
+		})
+		b.Run(fmt.Sprintf("Prune/Shards%d", shards), func(b *testing.B) {
+			benchmarkNodeKeyShards(b, shards, true)
+		})
+	}
+}
+
+func benchmarkNodeKeyShards(b *testing.B, nodeKeyShards int, prune bool) {
+	const (
+		numVersions = 4
+		numValues   = 10_000
+	)
+	ctx := context.Background()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		dir, err := ioutil.TempDir("", "mkvs.bench.badgerdb")
+		require.NoError(b, err, "TempDir")
+		ndb, err := badgerDb.New(&db.Config{
+			DB:             dir,
+			NoFsync:        true,
+			Namespace:      testNs,
+			BlockCacheSize: 16 * 1024 * 1024,
+			NodeKeyShards:  nodeKeyShards,
+		})
+		require.NoError(b, err, "New")
+
+		// Commit a number of versions, each updating all values.
+		if !prune {
+			b.StartTimer()
+		}
+		tree := New(nil, ndb, node.RootTypeState)
+		for version := uint64(0); version < numVersions; version++ {
+			for i := 0; i < numValues; i++ {
+				key := []byte(fmt.Sprintf("key %d", i))
+				value := []byte(fmt.Sprintf("value %d %d", version, i))
+				err = tree.Insert(ctx, key, value)
+				require.NoError(b, err, "Insert")
+			}
+			var rootHash hash.Hash
+			_, rootHash, err = tree.Commit(ctx, testNs, version)
+			require.NoError(b, err, "Commit")
+			err = ndb.Finalize(ctx, []node.Root{{Namespace: testNs, Version: version, Type: node.RootTypeState, Hash: rootHash}})
+			require.NoError(b, err, "Finalize")
+		}
+		tree.Close()
+		b.StopTimer()
+
+		// Prune all but the last version.
+		if prune {
+			b.StartTimer()
+			for version := uint64(0); version < numVersions-1; version++ {
+				err = ndb.Prune(ctx, version)
+				require.NoError(b, err, "Prune")
+			}
+			b.StopTimer()
+		}
+
+		ndb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
 func generateKeyValuePairsEx(prefix string, count int) ([][]byte, [][]byte) {
 	keys := make([][]byte, count)
 	values := make([][]byte, count)
@@ -0,0 +1,57 @@
+package mkvs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/syncer"
+)
+
+// negotiateSyncVersion negotiates the read syncer protocol version for a request received from
+// a remote client supporting protocol versions up to the given version.
+func negotiateSyncVersion(requestVersion uint16) (uint16, error) {
+	return syncer.NegotiateVersion(syncer.MinProtocolVersion, syncer.LatestProtocolVersion, requestVersion)
+}
+
+// updateSyncVersion updates the read syncer protocol version negotiated with the remote read
+// syncer based on the protocol version of one of its responses.
+func (c *cache) updateSyncVersion(responseVersion uint16) error {
+	version, err := negotiateSyncVersion(responseVersion)
+	if err != nil {
+		return err
+	}
+	c.syncVersion = version
+	return nil
+}
+
+// versionedSync performs a request against the remote read syncer, passing the protocol version
+// that should be included in the request, and updates the negotiated protocol version based on
+// its response.
+//
+// Remote read syncers which predate version negotiation decode requests strictly and reject the
+// unknown version field. Therefore, until a version has been negotiated, a failed versioned
+// request is retried once without the version and in case that succeeds, the remote read syncer
+// is treated as a legacy one from then on.
+func (c *cache) versionedSync(
+	ctx context.Context,
+	fn func(version uint16) (*syncer.ProofResponse, error),
+) (*syncer.Proof, error) {
+	version := syncer.LatestProtocolVersion
+	if c.syncLegacy {
+		version = 0
+	}
+
+	rsp, err := fn(version)
+	if err != nil && version != 0 && c.syncVersion == 0 && ctx.Err() == nil && !errors.Is(err, syncer.ErrUnsupportedVersion) {
+		if rsp, err = fn(0); err == nil {
+			c.syncLegacy = true
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = c.updateSyncVersion(rsp.Version); err != nil {
+		return nil, err
+	}
+	return &rsp.Proof, nil
+}
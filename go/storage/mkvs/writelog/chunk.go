@@ -0,0 +1,272 @@
+package writelog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+var (
+	_ ChunkIterator = (*chunkedIterator)(nil)
+	_ ChunkIterator = (*staticChunkIterator)(nil)
+	_ Iterator      = (*reassemblingIterator)(nil)
+
+	// ErrChunkEntryTooLarge is the error returned when a single write log entry does not fit
+	// into a chunk of the requested maximum size.
+	ErrChunkEntryTooLarge = errors.New("mkvs: write log entry too large for chunk")
+	// ErrChunkOutOfOrder is the error returned when a chunk is received out of order.
+	ErrChunkOutOfOrder = errors.New("mkvs: write log chunk out of order")
+	// ErrChunkCountMismatch is the error returned when the number of entries in a chunk does not
+	// match its declared entry count.
+	ErrChunkCountMismatch = errors.New("mkvs: write log chunk entry count mismatch")
+	// ErrChunkMissing is the error returned when the chunk stream ends before the final chunk.
+	ErrChunkMissing = errors.New("mkvs: write log chunk stream incomplete")
+	// ErrChunkAfterFinal is the error returned when a chunk is received after the final chunk.
+	ErrChunkAfterFinal = errors.New("mkvs: write log chunk after final chunk")
+
+	// chunkOverhead is the maximum number of bytes a serialized chunk takes in addition to the
+	// serialized entries it contains.
+	chunkOverhead = len(cbor.Marshal(&Chunk{
+		Index: math.MaxUint64,
+		Count: math.MaxUint64,
+		Final: true,
+	})) + 8 // Maximum size of the CBOR array header.
+)
+
+// Chunk is a size-bounded part of a write log.
+type Chunk struct {
+	// Index is the index of the chunk in the chunk stream, starting at zero.
+	Index uint64 `json:"index"`
+	// Count is the number of write log entries in the chunk.
+	Count uint64 `json:"count"`
+	// Final is true if this is the last chunk in the chunk stream.
+	Final bool `json:"final"`
+	// Entries are the write log entries in the chunk.
+	Entries WriteLog `json:"entries"`
+}
+
+// Iterator returns an iterator over the write log entries in the chunk.
+func (c *Chunk) Iterator() Iterator {
+	return NewStaticIterator(c.Entries)
+}
+
+// ChunkIterator iterates over write log chunks.
+type ChunkIterator interface {
+	// Next advances the iterator to the next chunk and returns false if there are no more chunks.
+	Next() (bool, error)
+	// Value returns the chunk the iterator is currently pointing to.
+	Value() (*Chunk, error)
+}
+
+type chunkedIterator struct {
+	it       Iterator
+	maxBytes int
+
+	index   uint64
+	pending *LogEntry
+	current *Chunk
+	done    bool
+}
+
+func (ci *chunkedIterator) nextEntry() (*LogEntry, error) {
+	if ci.pending != nil {
+		entry := ci.pending
+		ci.pending = nil
+		return entry, nil
+	}
+
+	more, err := ci.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	if !more {
+		return nil, nil
+	}
+	entry, err := ci.it.Value()
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (ci *chunkedIterator) Next() (bool, error) {
+	ci.current = nil
+	if ci.done {
+		return false, nil
+	}
+
+	chunk := &Chunk{
+		Index: ci.index,
+	}
+	size := chunkOverhead
+	for {
+		entry, err := ci.nextEntry()
+		if err != nil {
+			return false, err
+		}
+		if entry == nil {
+			chunk.Final = true
+			break
+		}
+
+		entrySize := len(cbor.Marshal(entry))
+		if chunkOverhead+entrySize > ci.maxBytes {
+			return false, fmt.Errorf("%w: entry size %d exceeds %d",
+				ErrChunkEntryTooLarge, chunkOverhead+entrySize, ci.maxBytes,
+			)
+		}
+		if size+entrySize > ci.maxBytes {
+			ci.pending = entry
+			break
+		}
+
+		chunk.Entries = append(chunk.Entries, *entry)
+		size += entrySize
+	}
+	chunk.Count = uint64(len(chunk.Entries))
+
+	ci.index++
+	ci.current = chunk
+	ci.done = chunk.Final
+	return true, nil
+}
+
+func (ci *chunkedIterator) Value() (*Chunk, error) {
+	if ci.current == nil {
+		return nil, ErrIteratorInvalid
+	}
+	return ci.current, nil
+}
+
+// NewChunkedIterator returns a new chunk iterator that splits the given write log iterator into
+// successive chunks, each of which serializes to at most maxBytes bytes.
+//
+// The last chunk is always marked as final, so an empty write log results in a single empty
+// final chunk.
+func NewChunkedIterator(it Iterator, maxBytes int) ChunkIterator {
+	return &chunkedIterator{
+		it:       it,
+		maxBytes: maxBytes,
+	}
+}
+
+type reassemblingIterator struct {
+	chunks ChunkIterator
+
+	index   uint64
+	current Iterator
+	final   bool
+	done    bool
+}
+
+func (ri *reassemblingIterator) nextChunk() error {
+	more, err := ri.chunks.Next()
+	if err != nil {
+		return err
+	}
+	if !more {
+		return fmt.Errorf("%w: no final chunk after %d chunks", ErrChunkMissing, ri.index)
+	}
+	chunk, err := ri.chunks.Value()
+	if err != nil {
+		return err
+	}
+
+	if chunk.Index != ri.index {
+		return fmt.Errorf("%w: expected chunk %d, got %d", ErrChunkOutOfOrder, ri.index, chunk.Index)
+	}
+	if chunk.Count != uint64(len(chunk.Entries)) {
+		return fmt.Errorf("%w: chunk %d declares %d entries, has %d",
+			ErrChunkCountMismatch, chunk.Index, chunk.Count, len(chunk.Entries),
+		)
+	}
+
+	ri.index++
+	ri.current = chunk.Iterator()
+	ri.final = chunk.Final
+	return nil
+}
+
+func (ri *reassemblingIterator) Next() (bool, error) {
+	if ri.done {
+		return false, nil
+	}
+
+	for {
+		if ri.current != nil {
+			more, err := ri.current.Next()
+			if err != nil {
+				return false, err
+			}
+			if more {
+				return true, nil
+			}
+			ri.current = nil
+		}
+
+		if ri.final {
+			// Make sure that nothing follows the final chunk.
+			more, err := ri.chunks.Next()
+			if err != nil {
+				return false, err
+			}
+			if more {
+				return false, fmt.Errorf("%w: chunk %d", ErrChunkAfterFinal, ri.index)
+			}
+			ri.done = true
+			return false, nil
+		}
+
+		if err := ri.nextChunk(); err != nil {
+			return false, err
+		}
+	}
+}
+
+func (ri *reassemblingIterator) Value() (LogEntry, error) {
+	if ri.current == nil {
+		return LogEntry{}, ErrIteratorInvalid
+	}
+	return ri.current.Value()
+}
+
+// NewReassemblingIterator returns a new write log iterator that reassembles a write log from the
+// given chunk iterator.
+//
+// Chunks must be received in order and the stream must end with a final chunk, otherwise the
+// iterator will return an error instead of silently truncating the write log.
+func NewReassemblingIterator(chunks ChunkIterator) Iterator {
+	return &reassemblingIterator{
+		chunks: chunks,
+	}
+}
+
+type staticChunkIterator struct {
+	cursor int
+	chunks []*Chunk
+}
+
+func (i *staticChunkIterator) Next() (bool, error) {
+	i.cursor++
+	if i.cursor >= len(i.chunks) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (i *staticChunkIterator) Value() (*Chunk, error) {
+	if i.cursor < 0 || i.cursor >= len(i.chunks) {
+		return nil, ErrIteratorInvalid
+	}
+	return i.chunks[i.cursor], nil
+}
+
+// NewStaticChunkIterator returns a new chunk iterator that's backed by a static in-memory array.
+func NewStaticChunkIterator(chunks []*Chunk) ChunkIterator {
+	return &staticChunkIterator{
+		cursor: -1,
+		chunks: chunks,
+	}
+}
@@ -0,0 +1,118 @@
+package writelog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+func collectChunks(t *testing.T, it ChunkIterator) []*Chunk {
+	var chunks []*Chunk
+	for {
+		more, err := it.Next()
+		require.NoError(t, err, "it.Next()")
+		if !more {
+			break
+		}
+		chunk, err := it.Value()
+		require.NoError(t, err, "it.Value()")
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func collectWriteLog(it Iterator) (WriteLog, error) {
+	var wl WriteLog
+	for {
+		more, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return wl, nil
+		}
+		entry, err := it.Value()
+		if err != nil {
+			return nil, err
+		}
+		wl = append(wl, entry)
+	}
+}
+
+func TestChunkedIterator(t *testing.T) {
+	wl := makeWriteLog()
+
+	for _, maxBytes := range []int{80, 100, 512, 4096, 1 << 20} {
+		chunks := collectChunks(t, NewChunkedIterator(NewStaticIterator(wl), maxBytes))
+		require.NotEmpty(t, chunks, "there should be at least one chunk")
+		for idx, chunk := range chunks {
+			require.EqualValues(t, idx, chunk.Index, "chunk index should be correct")
+			require.EqualValues(t, len(chunk.Entries), chunk.Count, "chunk count should be correct")
+			require.Equal(t, idx == len(chunks)-1, chunk.Final, "only the last chunk should be final")
+			require.LessOrEqual(t, len(cbor.Marshal(chunk)), maxBytes, "serialized chunk should fit")
+		}
+
+		reassembled, err := collectWriteLog(NewReassemblingIterator(NewStaticChunkIterator(chunks)))
+		require.NoError(t, err, "reassembling should succeed")
+		require.True(t, wl.Equal(reassembled), "reassembled write log should be equal")
+	}
+
+	// Empty write log.
+	chunks := collectChunks(t, NewChunkedIterator(NewStaticIterator(nil), 64))
+	require.Len(t, chunks, 1, "empty write log should result in a single chunk")
+	require.True(t, chunks[0].Final, "single chunk should be final")
+	require.EqualValues(t, 0, chunks[0].Count, "single chunk should be empty")
+
+	// Entry too large.
+	it := NewChunkedIterator(NewStaticIterator(wl), 32)
+	_, err := it.Next()
+	require.ErrorIs(t, err, ErrChunkEntryTooLarge)
+}
+
+func TestReassemblingIteratorErrors(t *testing.T) {
+	wl := makeWriteLog()
+	chunks := collectChunks(t, NewChunkedIterator(NewStaticIterator(wl), 256))
+	require.True(t, len(chunks) > 2, "there should be multiple chunks")
+
+	reassemble := func(chunks []*Chunk) error {
+		_, err := collectWriteLog(NewReassemblingIterator(NewStaticChunkIterator(chunks)))
+		return err
+	}
+
+	// Missing final chunk.
+	err := reassemble(chunks[:len(chunks)-1])
+	require.ErrorIs(t, err, ErrChunkMissing)
+
+	// No chunks at all.
+	err = reassemble(nil)
+	require.ErrorIs(t, err, ErrChunkMissing)
+
+	// Missing intermediate chunk.
+	missing := append([]*Chunk{}, chunks[0])
+	missing = append(missing, chunks[2:]...)
+	err = reassemble(missing)
+	require.ErrorIs(t, err, ErrChunkOutOfOrder)
+
+	// Reordered chunks.
+	reordered := append([]*Chunk{}, chunks...)
+	reordered[0], reordered[1] = reordered[1], reordered[0]
+	err = reassemble(reordered)
+	require.ErrorIs(t, err, ErrChunkOutOfOrder)
+
+	// Truncated chunk.
+	truncated := append([]*Chunk{}, chunks...)
+	truncated[1] = &Chunk{
+		Index:   chunks[1].Index,
+		Count:   chunks[1].Count,
+		Final:   chunks[1].Final,
+		Entries: chunks[1].Entries[:len(chunks[1].Entries)-1],
+	}
+	err = reassemble(truncated)
+	require.ErrorIs(t, err, ErrChunkCountMismatch)
+
+	// Chunk after final chunk.
+	err = reassemble(append(append([]*Chunk{}, chunks...), chunks[0]))
+	require.ErrorIs(t, err, ErrChunkAfterFinal)
+}
@@ -0,0 +1,67 @@
+package writelog
+
+import (
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/storage/mkvs/node"
+)
+
+const (
+	// LeafOverhead is the number of bytes a serialized leaf node adds on top of its key and value.
+	//
+	// It consists of the node prefix, the key bit length and the value length.
+	LeafOverhead = 1 + node.DepthSize + node.ValueLengthSize
+
+	// InternalOverhead is the estimated number of bytes of the internal node added to the tree
+	// when a new leaf is inserted (or removed when a leaf is deleted).
+	//
+	// It consists of the node prefix, the label bit length, a single label byte (labels between
+	// uniformly distributed keys are short), the nil leaf marker and two child hashes.
+	InternalOverhead = 1 + node.DepthSize + 1 + 1 + 2*hash.Size
+
+	// EntryOverhead is the estimated structural overhead of a single key stored in the tree.
+	EntryOverhead = LeafOverhead + InternalOverhead
+)
+
+// LookupFunc looks up the size of the value currently stored under the given key.
+type LookupFunc func(key []byte) (existingSize int, exists bool)
+
+// EstimateSizeDelta estimates the net change in the size of the tree (in bytes) after applying
+// the write log, without doing any tree work.
+//
+// Inserting a new key accounts for its key and value together with the structural overhead of
+// a new leaf and internal node, overwriting a key accounts for the difference in value sizes and
+// deleting a key subtracts everything its insertion would have added. Deleting a key which does
+// not exist has no effect.
+//
+// The estimate assumes unique keys in the write log and exact structural overhead is only
+// approximated, see EntryOverhead.
+func EstimateSizeDelta(it Iterator, lookup LookupFunc) (int64, error) {
+	var delta int64
+	for {
+		more, err := it.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !more {
+			break
+		}
+
+		entry, err := it.Value()
+		if err != nil {
+			return 0, err
+		}
+
+		existingSize, exists := lookup(entry.Key)
+		switch {
+		case entry.Type() == LogDelete && !exists:
+			// Removing a non-existent key is a no-op.
+		case entry.Type() == LogDelete:
+			delta -= int64(len(entry.Key) + existingSize + EntryOverhead)
+		case exists:
+			delta += int64(len(entry.Value) - existingSize)
+		default:
+			delta += int64(len(entry.Key) + len(entry.Value) + EntryOverhead)
+		}
+	}
+	return delta, nil
+}
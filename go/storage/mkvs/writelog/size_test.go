@@ -0,0 +1,38 @@
+package writelog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateSizeDelta(t *testing.T) {
+	require := require.New(t)
+
+	existing := map[string]int{
+		"overwrite": 10,
+		"delete":    20,
+	}
+	lookup := func(key []byte) (int, bool) {
+		size, ok := existing[string(key)]
+		return size, ok
+	}
+
+	wl := WriteLog{
+		{Key: []byte("insert"), Value: []byte("value")},
+		{Key: []byte("overwrite"), Value: []byte("short")},
+		{Key: []byte("delete"), Value: nil},
+		{Key: []byte("missing"), Value: nil},
+	}
+	delta, err := EstimateSizeDelta(NewStaticIterator(wl), lookup)
+	require.NoError(err, "EstimateSizeDelta")
+
+	expected := int64(len("insert")+len("value")+EntryOverhead) +
+		int64(len("short")-10) -
+		int64(len("delete")+20+EntryOverhead)
+	require.EqualValues(expected, delta, "estimated size delta should be correct")
+
+	delta, err = EstimateSizeDelta(NewStaticIterator(nil), lookup)
+	require.NoError(err, "EstimateSizeDelta")
+	require.EqualValues(0, delta, "empty write log should not change the size")
+}
@@ -22,9 +22,9 @@ func TestCrashingBackendDoNotInterfere(t *testing.T) {
 
 	var (
 		cfg = api.Config{
-			Backend:      database.BackendNameBadgerDB,
-			Namespace:    testNs,
-			MaxCacheSize: 16 * 1024 * 1024,
+			Backend:        database.BackendNameBadgerDB,
+			Namespace:      testNs,
+			BlockCacheSize: 16 * 1024 * 1024,
 		}
 		err error
 	)
@@ -36,8 +36,14 @@ const (
 	// CfgBackend configures the storage backend flag.
 	CfgBackend = "worker.storage.backend"
 
-	// CfgMaxCacheSize configures the maximum in-memory cache size.
-	CfgMaxCacheSize = "worker.storage.max_cache_size"
+	// CfgBlockCacheSize configures the maximum in-memory block cache size.
+	CfgBlockCacheSize = "worker.storage.block_cache_size"
+
+	// CfgIndexCacheSize configures the maximum in-memory index cache size.
+	CfgIndexCacheSize = "worker.storage.index_cache_size"
+
+	// CfgMaxApplySizeDelta configures the maximum estimated state growth of a single apply.
+	CfgMaxApplySizeDelta = "worker.storage.max_apply_size_delta"
 
 	cfgCrashEnabled = "worker.storage.crash.enabled"
 )
@@ -57,10 +63,13 @@ func NewLocalBackend(
 	identity *identity.Identity,
 ) (api.LocalBackend, error) {
 	cfg := &api.Config{
-		Backend:      strings.ToLower(viper.GetString(CfgBackend)),
-		DB:           dataDir,
-		Namespace:    namespace,
-		MaxCacheSize: int64(viper.GetSizeInBytes(CfgMaxCacheSize)),
+		Backend:        strings.ToLower(viper.GetString(CfgBackend)),
+		DB:             dataDir,
+		Namespace:      namespace,
+		BlockCacheSize: int64(viper.GetSizeInBytes(CfgBlockCacheSize)),
+		IndexCacheSize: int64(viper.GetSizeInBytes(CfgIndexCacheSize)),
+
+		MaxApplySizeDelta: int64(viper.GetSizeInBytes(CfgMaxApplySizeDelta)),
 	}
 
 	var (
@@ -94,7 +103,9 @@ func init() {
 	Flags.Bool(CfgWorkerCheckpointSyncDisabled, false, "Disable initial storage sync from checkpoints")
 
 	Flags.String(CfgBackend, database.BackendNameBadgerDB, "Storage backend")
-	Flags.String(CfgMaxCacheSize, "64mb", "Maximum in-memory cache size")
+	Flags.String(CfgBlockCacheSize, "64mb", "Maximum in-memory block cache size")
+	Flags.String(CfgIndexCacheSize, "0", "Maximum in-memory index cache size (0 keeps all indices in memory)")
+	Flags.String(CfgMaxApplySizeDelta, "0", "Maximum estimated state growth of a single apply (0 disables the limit)")
 
 	Flags.Bool(cfgCrashEnabled, false, "UNSAFE: Enable the crashing storage wrapper")
 	_ = Flags.MarkHidden(cfgCrashEnabled)
@@ -7,7 +7,7 @@
 use std::collections::BTreeMap;
 
 use crate::{
-    common::quantity::Quantity,
+    common::{crypto::signature::PublicKey, quantity::Quantity},
     consensus::{address::Address, beacon::EpochTime},
 };
 
@@ -82,6 +82,48 @@ pub struct GeneralAccount {
 
     #[cbor(optional)]
     pub allowances: Option<BTreeMap<Address, Quantity>>,
+
+    #[cbor(optional)]
+    pub allowance_expiries: Option<BTreeMap<Address, i64>>,
+
+    #[cbor(optional)]
+    #[cbor(rename = "multisig")]
+    pub multi_sig: Option<MultiSigDescriptor>,
+
+    #[cbor(optional)]
+    pub metadata: Option<Vec<u8>>,
+
+    #[cbor(optional)]
+    pub transfer_limit: Option<TransferLimit>,
+
+    #[cbor(optional)]
+    #[cbor(default)]
+    pub created_at: i64,
+}
+
+/// Multi-signature account descriptor.
+#[derive(Clone, Debug, Default, PartialEq, Eq, Hash, cbor::Encode, cbor::Decode)]
+pub struct MultiSigDescriptor {
+    pub signers: Vec<PublicKey>,
+    pub threshold: u16,
+}
+
+/// Per-epoch limit on outgoing transfers from an account.
+#[derive(Clone, Debug, Default, PartialEq, Eq, Hash, cbor::Encode, cbor::Decode)]
+pub struct TransferLimit {
+    pub amount: Quantity,
+
+    #[cbor(optional)]
+    #[cbor(default)]
+    pub epoch: EpochTime,
+
+    #[cbor(optional)]
+    #[cbor(default)]
+    pub spent: Quantity,
+
+    #[cbor(optional)]
+    #[cbor(default)]
+    pub removal_epoch: EpochTime,
 }
 
 /// Escrow account.
@@ -220,6 +262,39 @@ mod tests {
                 }
                 },
         ),
+        (
+            "oWdnZW5lcmFsp2diYWxhbmNlQQpobWV0YWRhdGFIbWV0YWRhdGFobXVsdGlzaWeiZ3NpZ25lcnOBWCC62t0eVf///////////////////////////////////2l0aHJlc2hvbGQBamFsbG93YW5jZXOhVQD3xN7WIRPiwoLqhnIjpUTtVda6bkFkamNyZWF0ZWRfYXQLbnRyYW5zZmVyX2xpbWl0pGVlcG9jaANlc3BlbnRBB2ZhbW91bnRCA+htcmVtb3ZhbF9lcG9jaAVyYWxsb3dhbmNlX2V4cGlyaWVzoVUA98Te1iET4sKC6oZyI6VE7VXWum4YKg==",
+            Account {
+                general: GeneralAccount {
+                    balance: Quantity::from(10u32),
+                    allowances: Some(
+                        [(COMMON_POOL_ADDRESS.clone(), Quantity::from(100u32))]
+                            .iter()
+                            .cloned()
+                            .collect(),
+                    ),
+                    allowance_expiries: Some(
+                        [(COMMON_POOL_ADDRESS.clone(), 42)].iter().cloned().collect(),
+                    ),
+                    multi_sig: Some(MultiSigDescriptor {
+                        signers: vec![PublicKey::from(
+                            "badadd1e55ffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+                        )],
+                        threshold: 1,
+                    }),
+                    metadata: Some(b"metadata".to_vec()),
+                    transfer_limit: Some(TransferLimit {
+                        amount: Quantity::from(1000u32),
+                        epoch: 3,
+                        spent: Quantity::from(7u32),
+                        removal_epoch: 5,
+                    }),
+                    created_at: 11,
+                    ..Default::default()
+                },
+                ..Default::default()
+            },
+        ),
         (
             "oWZlc2Nyb3ejZmFjdGl2ZaJnYmFsYW5jZUIETGx0b3RhbF9zaGFyZXNBC3FzdGFrZV9hY2N1bXVsYXRvcqFmY2xhaW1zoWZlbnRpdHmCoWVjb25zdEFNoWZnbG9iYWwCc2NvbW1pc3Npb25fc2NoZWR1bGWhZmJvdW5kc4GjZXN0YXJ0GCFocmF0ZV9tYXhCA+hocmF0ZV9taW5BCg==",
             Account {
@@ -263,6 +338,12 @@ mod tests {
             let dec: Account = cbor::from_slice(&base64::decode(encoded_base64).unwrap())
                 .expect("account should deserialize correctly");
             assert_eq!(dec, rr, "decoded account should match the expected value");
+            let enc = cbor::to_vec(dec);
+            assert_eq!(
+                base64::encode(enc),
+                encoded_base64,
+                "account should serialize correctly"
+            );
         }
     }
 